@@ -65,11 +65,8 @@ func (c CellExtent) Contains(cell CellIndex) bool {
 	return !cell.isAboveOrRightOf(c.UpperRightCell()) && !cell.isBelowOrLeftOf(c.LowerLeftCell())
 }
 
-func (c CellExtent) ContainsLonLat(lon float64, lat float64, cellWidth float64, cellHeight float64) bool {
-	x := int(lon / cellWidth)
-	y := int(lat / cellHeight)
-
-	return x >= c.LowerLeftCell().X() && y >= c.LowerLeftCell().Y() && x <= c.UpperRightCell().X() && y <= c.UpperRightCell().Y()
+func (c CellExtent) ContainsLonLat(lon float64, lat float64, cellScheme CellScheme) bool {
+	return c.Contains(cellScheme.GetCellIndexForCoordinate(lon, lat))
 }
 
 func (c CellExtent) ContainsAny(cells []CellIndex) bool {
@@ -112,10 +109,9 @@ func (c CellExtent) GetCellIndices() []CellIndex {
 	return indices
 }
 
-func (c CellExtent) ToPolygon(cellWidth float64, cellHeight float64) orb.Polygon {
-	lowerLeft := c[0].ToPoint(cellWidth, cellHeight)
-	maxCell := CellIndex{c[1].X() + 1, c[1].Y() + 1}
-	upperRight := maxCell.ToPoint(cellWidth, cellHeight)
+func (c CellExtent) ToPolygon(cellScheme CellScheme) orb.Polygon {
+	lowerLeft := cellScheme.GetCellBound(c[0]).Min
+	upperRight := cellScheme.GetCellBound(c[1]).Max
 	return orb.Polygon{
 		orb.Ring{
 			lowerLeft,
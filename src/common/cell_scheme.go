@@ -0,0 +1,99 @@
+package common
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"math"
+)
+
+const (
+	CellSchemeLatLon    = "latlon"
+	CellSchemeEqualArea = "equal-area"
+)
+
+// CellScheme maps coordinates to the cells of an index. The x index of a cell only depends on the longitude and the y
+// index only on the latitude, both growing with their coordinate. Therefore, the cells of a bbox are always all cells
+// between the cells of its lower-left and upper-right corner.
+type CellScheme interface {
+	GetCellIndexForCoordinate(lon float64, lat float64) CellIndex
+	// GetCellBound returns the area covered by the given cell.
+	GetCellBound(cell CellIndex) orb.Bound
+	// Name returns one of the CellScheme... constants. It's stored in the index metadata, so that queries use the same
+	// scheme as the import.
+	Name() string
+}
+
+// NewCellScheme returns the cell scheme with the given name. An empty name means the lat/lon scheme, which is used by
+// indices created before other schemes existed.
+func NewCellScheme(name string, cellWidth float64, cellHeight float64) (CellScheme, error) {
+	switch name {
+	case "", CellSchemeLatLon:
+		return &LatLonCellScheme{CellWidth: cellWidth, CellHeight: cellHeight}, nil
+	case CellSchemeEqualArea:
+		return &EqualAreaCellScheme{CellWidth: cellWidth, CellHeight: cellHeight}, nil
+	}
+	return nil, errors.Errorf("Unknown cell scheme '%s'", name)
+}
+
+// LatLonCellScheme divides the coordinates into cells of the same size in degrees. Cells near the poles are therefore
+// much smaller (in m²) than cells near the equator.
+type LatLonCellScheme struct {
+	CellWidth  float64
+	CellHeight float64
+}
+
+func (s *LatLonCellScheme) GetCellIndexForCoordinate(lon float64, lat float64) CellIndex {
+	return GetCellIndexForCoordinate(lon, lat, s.CellWidth, s.CellHeight)
+}
+
+func (s *LatLonCellScheme) GetCellBound(cell CellIndex) orb.Bound {
+	return orb.Bound{
+		Min: cell.ToPoint(s.CellWidth, s.CellHeight),
+		Max: CellIndex{cell.X() + 1, cell.Y() + 1}.ToPoint(s.CellWidth, s.CellHeight),
+	}
+}
+
+func (s *LatLonCellScheme) Name() string {
+	return CellSchemeLatLon
+}
+
+// EqualAreaCellScheme divides the coordinates into cells of the same area (in m²) using the cylindrical equal-area
+// projection: The rows are equally spaced in the sine of the latitude, so they get higher (in degrees) towards the
+// poles. The given cell height is the height of the rows at the equator.
+type EqualAreaCellScheme struct {
+	CellWidth  float64
+	CellHeight float64
+}
+
+func (s *EqualAreaCellScheme) GetCellIndexForCoordinate(lon float64, lat float64) CellIndex {
+	return CellIndex{
+		int(math.Floor(lon / s.CellWidth)),
+		int(math.Floor(math.Sin(degreesToRadians(lat)) / s.rowHeight())),
+	}
+}
+
+func (s *EqualAreaCellScheme) GetCellBound(cell CellIndex) orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{float64(cell.X()) * s.CellWidth, s.rowLatitude(cell.Y())},
+		Max: orb.Point{float64(cell.X()+1) * s.CellWidth, s.rowLatitude(cell.Y() + 1)},
+	}
+}
+
+func (s *EqualAreaCellScheme) Name() string {
+	return CellSchemeEqualArea
+}
+
+// rowHeight returns the height of a row in the sine of the latitude.
+func (s *EqualAreaCellScheme) rowHeight() float64 {
+	return math.Sin(degreesToRadians(s.CellHeight))
+}
+
+// rowLatitude returns the latitude of the lower border of the given row.
+func (s *EqualAreaCellScheme) rowLatitude(y int) float64 {
+	sinLat := math.Max(-1, math.Min(1, float64(y)*s.rowHeight()))
+	return math.Asin(sinLat) * 180 / math.Pi
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestNewCellScheme(t *testing.T) {
+	// Act
+	defaultScheme, defaultErr := NewCellScheme("", 0.1, 0.1)
+	equalAreaScheme, equalAreaErr := NewCellScheme(CellSchemeEqualArea, 0.1, 0.1)
+	_, unknownErr := NewCellScheme("foo", 0.1, 0.1)
+
+	// Assert
+	AssertNil(t, defaultErr)
+	AssertEqual(t, CellSchemeLatLon, defaultScheme.Name())
+	AssertNil(t, equalAreaErr)
+	AssertEqual(t, CellSchemeEqualArea, equalAreaScheme.Name())
+	AssertNotNil(t, unknownErr)
+}
+
+func TestLatLonCellScheme_getCellBound(t *testing.T) {
+	// Arrange
+	scheme := &LatLonCellScheme{CellWidth: 10, CellHeight: 5}
+
+	// Act
+	cell := scheme.GetCellIndexForCoordinate(25, 12)
+	bound := scheme.GetCellBound(cell)
+
+	// Assert
+	AssertEqual(t, CellIndex{2, 2}, cell)
+	AssertEqual(t, 20.0, bound.Min.Lon())
+	AssertEqual(t, 10.0, bound.Min.Lat())
+	AssertEqual(t, 30.0, bound.Max.Lon())
+	AssertEqual(t, 15.0, bound.Max.Lat())
+}
+
+func TestEqualAreaCellScheme_coordinatesWithinCellBound(t *testing.T) {
+	// Arrange
+	scheme := &EqualAreaCellScheme{CellWidth: 1, CellHeight: 1}
+
+	for _, coordinate := range [][2]float64{{0.5, 0.5}, {-0.5, -0.5}, {9.9, 53.5}, {-70.3, -85.2}, {179.9, 89.9}, {12.3, -45}} {
+		// Act
+		bound := scheme.GetCellBound(scheme.GetCellIndexForCoordinate(coordinate[0], coordinate[1]))
+
+		// Assert
+		AssertTrue(t, bound.Min.Lon() <= coordinate[0] && coordinate[0] < bound.Max.Lon())
+		AssertTrue(t, bound.Min.Lat() <= coordinate[1] && coordinate[1] < bound.Max.Lat())
+	}
+}
+
+func TestEqualAreaCellScheme_rowsGetHigherTowardsPoles(t *testing.T) {
+	// Arrange
+	scheme := &EqualAreaCellScheme{CellWidth: 1, CellHeight: 1}
+
+	// Act
+	equatorBound := scheme.GetCellBound(scheme.GetCellIndexForCoordinate(0.5, 0.5))
+	polarBound := scheme.GetCellBound(scheme.GetCellIndexForCoordinate(0.5, 80.5))
+
+	// Assert
+	AssertTrue(t, equatorBound.Max.Lat()-equatorBound.Min.Lat() < 1.001)
+	AssertTrue(t, polarBound.Max.Lat()-polarBound.Min.Lat() > 5)
+	AssertEqual(t, CellIndex{0, -1}, scheme.GetCellIndexForCoordinate(0.5, -0.5))
+}
@@ -125,48 +125,49 @@ func TestGridCellExtent_containsLonLat(t *testing.T) {
 		CellIndex{10, 10},
 		CellIndex{20, 20},
 	}
+	cellScheme := &LatLonCellScheme{CellWidth: 10, CellHeight: 10}
 
 	// Lower-left corner
-	AssertFalse(t, extent.ContainsLonLat(90, 110, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(90, 100, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(90, 90, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(100, 110, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(100, 100, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(100, 90, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(110, 110, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(110, 100, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(110, 90, 10, 10))
+	AssertFalse(t, extent.ContainsLonLat(90, 110, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(90, 100, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(90, 90, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(100, 110, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(100, 100, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(100, 90, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(110, 110, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(110, 100, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(110, 90, cellScheme))
 
 	// Lower-right corner
-	AssertTrue(t, extent.ContainsLonLat(190, 110, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(190, 100, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(190, 90, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(200, 110, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(200, 100, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(200, 90, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(210, 110, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(210, 100, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(210, 90, 10, 10))
+	AssertTrue(t, extent.ContainsLonLat(190, 110, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(190, 100, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(190, 90, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(200, 110, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(200, 100, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(200, 90, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(210, 110, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(210, 100, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(210, 90, cellScheme))
 
 	// Upper-left corner
-	AssertFalse(t, extent.ContainsLonLat(90, 210, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(90, 200, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(90, 190, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(100, 210, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(100, 200, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(100, 190, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(110, 210, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(110, 200, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(110, 190, 10, 10))
+	AssertFalse(t, extent.ContainsLonLat(90, 210, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(90, 200, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(90, 190, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(100, 210, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(100, 200, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(100, 190, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(110, 210, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(110, 200, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(110, 190, cellScheme))
 
 	// Upper-right corner
-	AssertFalse(t, extent.ContainsLonLat(190, 210, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(190, 200, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(190, 190, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(200, 210, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(200, 200, 10, 10))
-	AssertTrue(t, extent.ContainsLonLat(200, 190, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(210, 210, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(210, 200, 10, 10))
-	AssertFalse(t, extent.ContainsLonLat(210, 190, 10, 10))
+	AssertFalse(t, extent.ContainsLonLat(190, 210, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(190, 200, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(190, 190, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(200, 210, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(200, 200, cellScheme))
+	AssertTrue(t, extent.ContainsLonLat(200, 190, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(210, 210, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(210, 200, cellScheme))
+	AssertFalse(t, extent.ContainsLonLat(210, 190, cellScheme))
 }
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const metersPerFoot = 0.3048
+
+// ParseElevation parses the value of an "ele" tag into meters. Besides plain numbers, values with a unit ("123 m",
+// "400 ft") and a decimal comma ("123,5") are supported. The second return value is false for all other values, e.g.
+// ranges like "100-200" or texts.
+func ParseElevation(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+
+	factor := 1.0
+	if strings.HasSuffix(value, "ft") {
+		factor = metersPerFoot
+		value = strings.TrimSuffix(value, "ft")
+	} else if strings.HasSuffix(value, "m") {
+		value = strings.TrimSuffix(value, "m")
+	}
+	value = strings.TrimSpace(value)
+	value = strings.Replace(value, ",", ".", 1)
+
+	elevation, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(elevation) || math.IsInf(elevation, 0) {
+		return 0, false
+	}
+
+	return elevation * factor, true
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestParseElevation(t *testing.T) {
+	for _, testCase := range []struct {
+		value             string
+		expectedElevation float64
+		expectedOk        bool
+	}{
+		{"1234", 1234, true},
+		{"-12.5", -12.5, true},
+		{" 1234 m", 1234, true},
+		{"1234m", 1234, true},
+		{"123,5", 123.5, true},
+		{"1000 ft", 304.8, true},
+		{"", 0, false},
+		{"m", 0, false},
+		{"100-200", 0, false},
+		{"unknown", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+	} {
+		// Act
+		elevation, ok := ParseElevation(testCase.value)
+
+		// Assert
+		AssertEqual(t, testCase.expectedOk, ok)
+		AssertApprox(t, testCase.expectedElevation, elevation, 0.00001)
+	}
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// MemoryConsumer is a cache whose memory usage is tracked by a MemoryAccountant.
+type MemoryConsumer interface {
+	// EvictMemory frees approximately the given amount of bytes, e.g. by evicting cache entries, and removes them from
+	// its account. Consumers that are not safe for concurrent use might free the memory later, e.g. on their next use.
+	EvictMemory(bytes int64)
+}
+
+// MemoryAccountant tracks the memory of all caches of the process, which register themselves with an account. When
+// the total usage exceeds the limit, the accountant asks the caches to evict entries, beginning with the largest cache.
+// This keeps the whole process within the limit, whereas the sizes of the individual caches vary with the workload. A
+// limit of 0 or less only tracks the usage. The accountant can be used in concurrent goroutines.
+type MemoryAccountant struct {
+	limitInBytes int64
+	accounts     map[*MemoryAccount]bool
+	mutex        *sync.Mutex
+
+	// True while an eviction is running, s. enforceLimit.
+	evicting *atomic.Bool
+}
+
+// MemoryAccount is the account of one cache at the MemoryAccountant. All functions can be called on a nil account,
+// which does nothing, so caches without accountant don't need to check for it.
+type MemoryAccount struct {
+	name        string
+	consumer    MemoryConsumer
+	accountant  *MemoryAccountant
+	usedInBytes *atomic.Int64
+}
+
+func NewMemoryAccountant(limitInBytes int64) *MemoryAccountant {
+	return &MemoryAccountant{
+		limitInBytes: limitInBytes,
+		accounts:     map[*MemoryAccount]bool{},
+		mutex:        &sync.Mutex{},
+		evicting:     &atomic.Bool{},
+	}
+}
+
+// Register creates a new account for the given consumer. The name is used to group the usage in GetUsage. Returns nil
+// when the accountant is nil.
+func (a *MemoryAccountant) Register(name string, consumer MemoryConsumer) *MemoryAccount {
+	if a == nil {
+		return nil
+	}
+
+	account := &MemoryAccount{
+		name:        name,
+		consumer:    consumer,
+		accountant:  a,
+		usedInBytes: &atomic.Int64{},
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.accounts[account] = true
+
+	return account
+}
+
+func (a *MemoryAccountant) GetLimitBytes() int64 {
+	return a.limitInBytes
+}
+
+// GetUsedBytes returns the memory used by all registered consumers together.
+func (a *MemoryAccountant) GetUsedBytes() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var usedInBytes int64
+	for account := range a.accounts {
+		usedInBytes += account.GetUsedBytes()
+	}
+	return usedInBytes
+}
+
+// GetUsage returns the used memory per consumer name.
+func (a *MemoryAccountant) GetUsage() map[string]int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	usage := map[string]int64{}
+	for account := range a.accounts {
+		usage[account.name] += account.GetUsedBytes()
+	}
+	return usage
+}
+
+// enforceLimit starts an eviction in a separate goroutine when the limit is exceeded. Consumers usually add memory
+// while holding their own locks, which they need again for the eviction, so the eviction must not happen within the
+// call adding the memory. Only one eviction runs at a time.
+func (a *MemoryAccountant) enforceLimit() {
+	if a.limitInBytes <= 0 || a.GetUsedBytes() <= a.limitInBytes {
+		return
+	}
+	if !a.evicting.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer a.evicting.Store(false)
+		a.evict()
+	}()
+}
+
+// evict asks the consumers to free the memory exceeding the limit, beginning with the consumer using the most memory.
+func (a *MemoryAccountant) evict() {
+	excessInBytes := a.GetUsedBytes() - a.limitInBytes
+	if a.limitInBytes <= 0 || excessInBytes <= 0 {
+		return
+	}
+
+	a.mutex.Lock()
+	accounts := make([]*MemoryAccount, 0, len(a.accounts))
+	for account := range a.accounts {
+		accounts = append(accounts, account)
+	}
+	a.mutex.Unlock()
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].GetUsedBytes() > accounts[j].GetUsedBytes()
+	})
+
+	for _, account := range accounts {
+		if excessInBytes <= 0 {
+			break
+		}
+
+		requestedBytes := min(account.GetUsedBytes(), excessInBytes)
+		if requestedBytes <= 0 {
+			continue
+		}
+
+		sigolo.Debugf("Memory limit of %d MB exceeded, evict %d KB from %s", a.limitInBytes/1024/1024, requestedBytes/1024, account.name)
+		account.consumer.EvictMemory(requestedBytes)
+		excessInBytes -= requestedBytes
+	}
+}
+
+// Add adds the given amount of bytes to the account and starts an eviction when the limit of the accountant is
+// exceeded.
+func (a *MemoryAccount) Add(bytes int64) {
+	if a == nil {
+		return
+	}
+	a.usedInBytes.Add(bytes)
+	a.accountant.enforceLimit()
+}
+
+// Remove removes the given amount of bytes, which must have been added before, from the account.
+func (a *MemoryAccount) Remove(bytes int64) {
+	if a == nil {
+		return
+	}
+	a.usedInBytes.Add(-bytes)
+}
+
+func (a *MemoryAccount) GetUsedBytes() int64 {
+	if a == nil {
+		return 0
+	}
+	return a.usedInBytes.Load()
+}
+
+// Unregister removes the account from the accountant, e.g. when the cache isn't used anymore. Later calls of Add and
+// Remove are still possible but don't affect the accountant anymore.
+func (a *MemoryAccount) Unregister() {
+	if a == nil {
+		return
+	}
+
+	a.accountant.mutex.Lock()
+	defer a.accountant.mutex.Unlock()
+	delete(a.accountant.accounts, a)
+}
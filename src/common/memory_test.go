@@ -0,0 +1,99 @@
+package common
+
+import (
+	"testing"
+)
+
+type testMemoryConsumer struct {
+	account        *MemoryAccount
+	requestedBytes int64
+}
+
+func (c *testMemoryConsumer) EvictMemory(bytes int64) {
+	c.requestedBytes += bytes
+	c.account.Remove(bytes)
+}
+
+func TestMemoryAccountant_evict(t *testing.T) {
+	// Arrange
+	accountant := NewMemoryAccountant(100)
+	smallConsumer := &testMemoryConsumer{}
+	smallConsumer.account = accountant.Register("small", smallConsumer)
+	largeConsumer := &testMemoryConsumer{}
+	largeConsumer.account = accountant.Register("large", largeConsumer)
+
+	// Don't use Add, since it would start the eviction in the background
+	smallConsumer.account.usedInBytes.Store(40)
+	largeConsumer.account.usedInBytes.Store(90)
+
+	// Act
+	accountant.evict()
+
+	// Assert
+	AssertEqual(t, int64(0), smallConsumer.requestedBytes)
+	AssertEqual(t, int64(30), largeConsumer.requestedBytes)
+	AssertEqual(t, int64(100), accountant.GetUsedBytes())
+}
+
+func TestMemoryAccountant_evictFromMultipleConsumers(t *testing.T) {
+	// Arrange
+	accountant := NewMemoryAccountant(10)
+	smallConsumer := &testMemoryConsumer{}
+	smallConsumer.account = accountant.Register("small", smallConsumer)
+	largeConsumer := &testMemoryConsumer{}
+	largeConsumer.account = accountant.Register("large", largeConsumer)
+
+	smallConsumer.account.usedInBytes.Store(20)
+	largeConsumer.account.usedInBytes.Store(30)
+
+	// Act
+	accountant.evict()
+
+	// Assert
+	AssertEqual(t, int64(10), smallConsumer.requestedBytes)
+	AssertEqual(t, int64(30), largeConsumer.requestedBytes)
+	AssertEqual(t, int64(10), accountant.GetUsedBytes())
+}
+
+func TestMemoryAccountant_unlimited(t *testing.T) {
+	// Arrange
+	accountant := NewMemoryAccountant(0)
+	consumer := &testMemoryConsumer{}
+	consumer.account = accountant.Register("foo", consumer)
+
+	// Act
+	consumer.account.Add(1000)
+	accountant.evict()
+
+	// Assert
+	AssertEqual(t, int64(0), consumer.requestedBytes)
+	AssertEqual(t, map[string]int64{"foo": 1000}, accountant.GetUsage())
+}
+
+func TestMemoryAccount_Unregister(t *testing.T) {
+	// Arrange
+	accountant := NewMemoryAccountant(0)
+	account := accountant.Register("foo", &testMemoryConsumer{})
+	account.Add(10)
+
+	// Act
+	account.Unregister()
+
+	// Assert
+	AssertEqual(t, int64(0), accountant.GetUsedBytes())
+}
+
+func TestMemoryAccount_nilAccountant(t *testing.T) {
+	// Arrange
+	var accountant *MemoryAccountant
+
+	// Act
+	account := accountant.Register("foo", &testMemoryConsumer{})
+	account.Add(10)
+	account.Remove(5)
+	account.Unregister()
+
+	// Assert
+	AssertNil(t, account)
+	AssertEqual(t, int64(0), account.GetUsedBytes())
+}
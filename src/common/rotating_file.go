@@ -0,0 +1,116 @@
+package common
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+)
+
+// RotatingFileWriter appends to a file and rotates it when it exceeds a maximum size: The file is renamed to
+// "<filename>.1", an existing "<filename>.1" to "<filename>.2" and so on. Only the given number of rotated files is
+// kept, older ones are removed. Each write is either completely in the old or in the new file. The writer can be used
+// in concurrent goroutines.
+type RotatingFileWriter struct {
+	filename       string
+	maxSizeInBytes int64 // 0 or less disables the rotation
+	maxBackups     int
+	file           *os.File
+	sizeInBytes    int64
+	mutex          *sync.Mutex
+}
+
+func NewRotatingFileWriter(filename string, maxSizeInBytes int64, maxBackups int) (*RotatingFileWriter, error) {
+	writer := &RotatingFileWriter{
+		filename:       filename,
+		maxSizeInBytes: maxSizeInBytes,
+		maxBackups:     maxBackups,
+		mutex:          &sync.Mutex{},
+	}
+
+	err := writer.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (w *RotatingFileWriter) Write(data []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.maxSizeInBytes > 0 && w.sizeInBytes > 0 && w.sizeInBytes+int64(len(data)) > w.maxSizeInBytes {
+		err := w.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(data)
+	w.sizeInBytes += int64(n)
+	if err != nil {
+		return n, errors.Wrapf(err, "Unable to write to file %s", w.filename)
+	}
+	return n, nil
+}
+
+func (w *RotatingFileWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.file.Close()
+}
+
+// open opens the file for appending. This function does NOT use locking.
+func (w *RotatingFileWriter) open() error {
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open file %s", w.filename)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "Unable to get size of file %s", w.filename)
+	}
+
+	w.file = file
+	w.sizeInBytes = fileInfo.Size()
+	return nil
+}
+
+// rotate renames the current and rotated files and opens a new empty file. This function does NOT use locking.
+func (w *RotatingFileWriter) rotate() error {
+	err := w.file.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to close file %s before rotating it", w.filename)
+	}
+
+	if w.maxBackups <= 0 {
+		err = os.Remove(w.filename)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to remove file %s", w.filename)
+		}
+		return w.open()
+	}
+
+	// The oldest file is overwritten by the rename, if it exists
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		err = os.Rename(w.getBackupFilename(i), w.getBackupFilename(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Unable to rotate file %s", w.getBackupFilename(i))
+		}
+	}
+
+	err = os.Rename(w.filename, w.getBackupFilename(1))
+	if err != nil {
+		return errors.Wrapf(err, "Unable to rotate file %s", w.filename)
+	}
+
+	return w.open()
+}
+
+func (w *RotatingFileWriter) getBackupFilename(number int) string {
+	return fmt.Sprintf("%s.%d", w.filename, number)
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFileWriter_Write(t *testing.T) {
+	// Arrange
+	filename := filepath.Join(t.TempDir(), "access.log")
+	writer, err := NewRotatingFileWriter(filename, 10, 2)
+	AssertNil(t, err)
+
+	// Act
+	for _, data := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err = writer.Write([]byte(data))
+		AssertNil(t, err)
+	}
+	err = writer.Close()
+
+	// Assert
+	AssertNil(t, err)
+	for filename, expectedContent := range map[string]string{
+		filename:        "gggg\n",
+		filename + ".1": "eeee\nffff\n",
+		filename + ".2": "cccc\ndddd\n",
+	} {
+		content, err := os.ReadFile(filename)
+		AssertNil(t, err)
+		AssertEqual(t, expectedContent, string(content))
+	}
+	_, err = os.Stat(filename + ".3")
+	AssertTrue(t, os.IsNotExist(err))
+}
+
+func TestRotatingFileWriter_appendsToExistingFile(t *testing.T) {
+	// Arrange
+	filename := filepath.Join(t.TempDir(), "access.log")
+	AssertNil(t, os.WriteFile(filename, []byte("aaaa\n"), 0644))
+	writer, err := NewRotatingFileWriter(filename, 10, 1)
+	AssertNil(t, err)
+
+	// Act
+	_, err = writer.Write([]byte("bbbb\n"))
+	AssertNil(t, err)
+	_, err = writer.Write([]byte("cccc\n"))
+	AssertNil(t, err)
+	AssertNil(t, writer.Close())
+
+	// Assert
+	content, err := os.ReadFile(filename)
+	AssertNil(t, err)
+	AssertEqual(t, "cccc\n", string(content))
+	content, err = os.ReadFile(filename + ".1")
+	AssertNil(t, err)
+	AssertEqual(t, "aaaa\nbbbb\n", string(content))
+}
+
+func TestRotatingFileWriter_withoutBackups(t *testing.T) {
+	// Arrange
+	filename := filepath.Join(t.TempDir(), "access.log")
+	writer, err := NewRotatingFileWriter(filename, 5, 0)
+	AssertNil(t, err)
+
+	// Act
+	_, err = writer.Write([]byte("aaaa\n"))
+	AssertNil(t, err)
+	_, err = writer.Write([]byte("bbbb\n"))
+	AssertNil(t, err)
+	AssertNil(t, writer.Close())
+
+	// Assert
+	content, err := os.ReadFile(filename)
+	AssertNil(t, err)
+	AssertEqual(t, "bbbb\n", string(content))
+	_, err = os.Stat(filename + ".1")
+	AssertTrue(t, os.IsNotExist(err))
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"github.com/pkg/errors"
+	"runtime"
+)
+
+const DefaultCellCacheSize = 10
+
+// Settings contains all concurrency and memory knobs of soq. They can be set via CLI flags or SOQ_* environment
+// variables, see the README for details.
+type Settings struct {
+	// Number of goroutines reading cells of the grid index in parallel when a query fetches features.
+	ReaderThreads int
+	// Number of goroutines decoding blocks of the OSM PBF file during the import.
+	ImportWorkers int
+	// Number of goroutines applying the filter of a statement to the read cells in parallel during queries.
+	FilterWorkers int
+	// Maximum number of cell files kept in the cell cache of each loaded index. Preloaded cells are not counted.
+	CellCacheSize int
+	// Tracks the memory of all caches (cell caches and sub-statement caches) and evicts cache entries when the memory
+	// limit of the process is exceeded. Nil disables the accounting.
+	MemoryAccountant *MemoryAccountant
+}
+
+// DefaultSettings returns settings derived from GOMAXPROCS, which is the number of CPUs unless set otherwise.
+func DefaultSettings() Settings {
+	procs := runtime.GOMAXPROCS(0)
+	return Settings{
+		ReaderThreads: procs,
+		ImportWorkers: procs,
+		FilterWorkers: procs,
+		CellCacheSize: DefaultCellCacheSize,
+	}
+}
+
+func (s Settings) Validate() error {
+	if s.ReaderThreads < 1 {
+		return errors.Errorf("Invalid number of reader threads %d, it must be at least 1", s.ReaderThreads)
+	}
+	if s.ImportWorkers < 1 {
+		return errors.Errorf("Invalid number of import workers %d, it must be at least 1", s.ImportWorkers)
+	}
+	if s.FilterWorkers < 1 {
+		return errors.Errorf("Invalid number of filter workers %d, it must be at least 1", s.FilterWorkers)
+	}
+	if s.CellCacheSize < 1 {
+		return errors.Errorf("Invalid cell cache size %d, it must be at least 1", s.CellCacheSize)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package common
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestSettings_defaultsFromGomaxprocs(t *testing.T) {
+	// Act
+	settings := DefaultSettings()
+
+	// Assert
+	AssertEqual(t, runtime.GOMAXPROCS(0), settings.ReaderThreads)
+	AssertEqual(t, runtime.GOMAXPROCS(0), settings.ImportWorkers)
+	AssertEqual(t, runtime.GOMAXPROCS(0), settings.FilterWorkers)
+	AssertEqual(t, DefaultCellCacheSize, settings.CellCacheSize)
+	AssertNil(t, settings.Validate())
+}
+
+func TestSettings_validateInvalidValues(t *testing.T) {
+	// Act & Assert
+	AssertNotNil(t, Settings{ReaderThreads: 0, ImportWorkers: 1, FilterWorkers: 1, CellCacheSize: 1}.Validate())
+	AssertNotNil(t, Settings{ReaderThreads: 1, ImportWorkers: -1, FilterWorkers: 1, CellCacheSize: 1}.Validate())
+	AssertNotNil(t, Settings{ReaderThreads: 1, ImportWorkers: 1, FilterWorkers: 0, CellCacheSize: 1}.Validate())
+	AssertNotNil(t, Settings{ReaderThreads: 1, ImportWorkers: 1, FilterWorkers: 1, CellCacheSize: 0}.Validate())
+	AssertNil(t, Settings{ReaderThreads: 1, ImportWorkers: 1, FilterWorkers: 1, CellCacheSize: 1}.Validate())
+}
@@ -0,0 +1,63 @@
+package common
+
+// LevenshteinDistance returns the minimum number of single-character insertions, deletions and substitutions needed
+// to turn a into b. Characters are compared as runes, so multibyte characters count as one character.
+func LevenshteinDistance(a string, b string) int {
+	aRunes := []rune(a)
+	bRunes := []rune(b)
+
+	// Only two rows of the distance matrix are needed at a time.
+	previousRow := make([]int, len(bRunes)+1)
+	currentRow := make([]int, len(bRunes)+1)
+	for j := range previousRow {
+		previousRow[j] = j
+	}
+
+	for i := 1; i <= len(aRunes); i++ {
+		currentRow[0] = i
+		for j := 1; j <= len(bRunes); j++ {
+			substitutionCost := 1
+			if aRunes[i-1] == bRunes[j-1] {
+				substitutionCost = 0
+			}
+			currentRow[j] = min(
+				previousRow[j]+1,                  // deletion
+				currentRow[j-1]+1,                 // insertion
+				previousRow[j-1]+substitutionCost, // substitution
+			)
+		}
+		previousRow, currentRow = currentRow, previousRow
+	}
+
+	return previousRow[len(bRunes)]
+}
+
+// TrigramSimilarity returns the Jaccard similarity (between 0 and 1) of the trigram sets of both strings. The strings
+// are padded with spaces so that short strings and word beginnings also produce trigrams.
+func TrigramSimilarity(a string, b string) float64 {
+	aTrigrams := getTrigrams(a)
+	bTrigrams := getTrigrams(b)
+
+	commonTrigrams := 0
+	for trigram := range aTrigrams {
+		if bTrigrams[trigram] {
+			commonTrigrams++
+		}
+	}
+
+	allTrigrams := len(aTrigrams) + len(bTrigrams) - commonTrigrams
+	if allTrigrams == 0 {
+		return 1
+	}
+
+	return float64(commonTrigrams) / float64(allTrigrams)
+}
+
+func getTrigrams(s string) map[string]bool {
+	runes := []rune("  " + s + " ")
+	trigrams := map[string]bool{}
+	for i := 0; i+3 <= len(runes); i++ {
+		trigrams[string(runes[i:i+3])] = true
+	}
+	return trigrams
+}
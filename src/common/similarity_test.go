@@ -0,0 +1,21 @@
+package common
+
+import "testing"
+
+func TestLevenshteinDistance(t *testing.T) {
+	// Act & Assert
+	AssertEqual(t, 0, LevenshteinDistance("cafe", "cafe"))
+	AssertEqual(t, 1, LevenshteinDistance("caffe", "cafe"))
+	AssertEqual(t, 2, LevenshteinDistance("resturant", "restaurant2"))
+	AssertEqual(t, 3, LevenshteinDistance("kitten", "sitting"))
+	AssertEqual(t, 4, LevenshteinDistance("", "cafe"))
+	AssertEqual(t, 2, LevenshteinDistance("straße", "strasse")) // "ß" is one character and not two bytes
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	// Act & Assert
+	AssertEqual(t, 1.0, TrigramSimilarity("cafe", "cafe"))
+	AssertEqual(t, 0.0, TrigramSimilarity("abc", "xyz"))
+	AssertTrue(t, TrigramSimilarity("fast_food", "fastfood") > 0.4)
+	AssertTrue(t, TrigramSimilarity("fast_food", "fastfood") < 1)
+}
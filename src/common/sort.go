@@ -75,6 +75,14 @@ func IsLessThan(s1, s2 string) bool {
 	return s1Sortable.isLessThan(s2Sortable)
 }
 
+// IsNumericallyEqual returns true if s1 and s2 are both numbers with the same value but possibly different notations,
+// e.g. "2" and "2.0".
+func IsNumericallyEqual(s1, s2 string) bool {
+	s1Sortable := toSortableString(s1)
+	s2Sortable := toSortableString(s2)
+	return s1Sortable.isNumber && s2Sortable.isNumber && s1Sortable.number == s2Sortable.number
+}
+
 func extractNumberPrefix(s string) string {
 	var prefix []rune
 
@@ -100,9 +108,11 @@ func isNumber(s string) bool {
 	}
 
 	for i, c := range s {
-		if c == '-' && i != 0 {
-			// A dash is only allowed at the beginning
-			return false
+		if c == '-' {
+			if i != 0 {
+				// A dash is only allowed at the beginning
+				return false
+			}
 		} else if c == '.' {
 			if containsDecimalPoint {
 				// Decimal point already found -> invalid since two decimal points do not make sense
@@ -45,3 +45,22 @@ func TestSort_onlyStrings(t *testing.T) {
 	// Assert
 	AssertEqual(t, []string{"a", "b", "bar", "foo"}, output)
 }
+
+func TestSort_negativeNumbers(t *testing.T) {
+	// Arrange
+	input := []string{"-1.5", "0", "-3", "0.5", "-10"}
+
+	// Act
+	output := Sort(input)
+
+	// Assert
+	AssertEqual(t, []string{"-10", "-3", "-1.5", "0", "0.5"}, output)
+}
+
+func TestIsNumericallyEqual(t *testing.T) {
+	AssertTrue(t, IsNumericallyEqual("2", "2.0"))
+	AssertTrue(t, IsNumericallyEqual("-1.50", "-1.5"))
+	AssertFalse(t, IsNumericallyEqual("2", "2.5"))
+	AssertFalse(t, IsNumericallyEqual("2 m", "2"))
+	AssertFalse(t, IsNumericallyEqual("abc", "abc"))
+}
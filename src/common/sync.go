@@ -0,0 +1,54 @@
+package common
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+// SyncFile flushes the content of the given file from the OS page cache to the storage device (fsync).
+func SyncFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open file %s to sync it", filename)
+	}
+	defer file.Close()
+
+	err = file.Sync()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to sync file %s", filename)
+	}
+	return nil
+}
+
+// SyncDirectory flushes the entries of the given directory to the storage device. This is needed to make newly created
+// files and folders within this directory survive a crash, syncing the files themselves is not enough.
+func SyncDirectory(directory string) error {
+	return SyncFile(directory)
+}
+
+// SyncFilesAndDirectories syncs all given files and afterwards their parent directories. Each directory is only synced
+// once.
+func SyncFilesAndDirectories(filenames ...string) error {
+	var directories []string
+	for _, filename := range filenames {
+		err := SyncFile(filename)
+		if err != nil {
+			return err
+		}
+
+		directory := filepath.Dir(filename)
+		if !Contains(directories, directory) {
+			directories = append(directories, directory)
+		}
+	}
+
+	for _, directory := range directories {
+		err := SyncDirectory(directory)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncFilesAndDirectories(t *testing.T) {
+	// Arrange
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "foo")
+	err := os.WriteFile(filename, []byte("bar"), 0644)
+	AssertNil(t, err)
+
+	// Act
+	err = SyncFilesAndDirectories(filename, filename)
+
+	// Assert
+	AssertNil(t, err)
+}
+
+func TestSyncFilesAndDirectories_notExistingFile(t *testing.T) {
+	// Act
+	err := SyncFilesAndDirectories(filepath.Join(t.TempDir(), "foo"))
+
+	// Assert
+	AssertNotNil(t, err)
+}
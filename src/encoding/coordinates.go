@@ -0,0 +1,88 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// CoordinatePrecision determines how the coordinates of nodes are stored in the cell files. Each node record contains
+// its precision in its flags, so readers don't need to know the precision of an index. The nodes of ways are always
+// stored as fixed-point numbers (s. Way), bboxes of relations always as 32-bit floats.
+type CoordinatePrecision string
+
+const (
+	// CoordinatePrecisionFloat32 stores coordinates as 32-bit floats (8 bytes per node). Their accuracy decreases with
+	// larger values, it's a few 1e-6 degrees (up to ~1 m) in Europe and about 1e-5 degrees at a longitude of 180°.
+	CoordinatePrecisionFloat32 CoordinatePrecision = "float32"
+	// CoordinatePrecisionFixed stores coordinates as 32-bit fixed-point numbers with 7 decimal places (8 bytes per
+	// node), which is the precision of OSM data (~1 cm).
+	CoordinatePrecisionFixed CoordinatePrecision = "fixed"
+	// CoordinatePrecisionFloat64 stores coordinates as 64-bit floats (16 bytes per node).
+	CoordinatePrecisionFloat64 CoordinatePrecision = "float64"
+)
+
+// ParseCoordinatePrecision returns the precision with the given name. An empty name means CoordinatePrecisionFloat32,
+// which is used by indices created before other precisions existed.
+func ParseCoordinatePrecision(name string) (CoordinatePrecision, error) {
+	switch CoordinatePrecision(name) {
+	case "", CoordinatePrecisionFloat32:
+		return CoordinatePrecisionFloat32, nil
+	case CoordinatePrecisionFixed, CoordinatePrecisionFloat64:
+		return CoordinatePrecision(name), nil
+	}
+	return "", errors.Errorf("Unknown coordinate precision '%s'", name)
+}
+
+// coordinatesBytes returns the number of bytes of lon and lat together.
+func (p CoordinatePrecision) coordinatesBytes() int {
+	if p == CoordinatePrecisionFloat64 {
+		return 8 + 8
+	}
+	return 4 + 4
+}
+
+func (p CoordinatePrecision) nodeFlags() byte {
+	switch p {
+	case CoordinatePrecisionFixed:
+		return nodeFlagFixedPointCoordinates
+	case CoordinatePrecisionFloat64:
+		return nodeFlagFloat64Coordinates
+	}
+	return 0
+}
+
+func coordinatePrecisionFromNodeFlags(flags byte) CoordinatePrecision {
+	if flags&nodeFlagFixedPointCoordinates != 0 {
+		return CoordinatePrecisionFixed
+	} else if flags&nodeFlagFloat64Coordinates != 0 {
+		return CoordinatePrecisionFloat64
+	}
+	return CoordinatePrecisionFloat32
+}
+
+// encodeCoordinates writes lon and lat and returns the number of written bytes.
+func (p CoordinatePrecision) encodeCoordinates(data []byte, lon float64, lat float64) int {
+	switch p {
+	case CoordinatePrecisionFixed:
+		putFixedPoint(data[0:], lon)
+		putFixedPoint(data[4:], lat)
+	case CoordinatePrecisionFloat64:
+		binary.LittleEndian.PutUint64(data[0:], math.Float64bits(lon))
+		binary.LittleEndian.PutUint64(data[8:], math.Float64bits(lat))
+	default:
+		putFloat(data[0:], lon)
+		putFloat(data[4:], lat)
+	}
+	return p.coordinatesBytes()
+}
+
+func (p CoordinatePrecision) decodeCoordinates(data []byte) (float64, float64) {
+	switch p {
+	case CoordinatePrecisionFixed:
+		return getFixedPoint(data[0:]), getFixedPoint(data[4:])
+	case CoordinatePrecisionFloat64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data[0:])), math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))
+	}
+	return getFloat(data[0:]), getFloat(data[4:])
+}
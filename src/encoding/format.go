@@ -0,0 +1,20 @@
+// Package encoding contains the binary formats of the features stored by soq. Each object type has a record type to
+// encode features and a record view to decode them. The views only read the parts of a record that are actually
+// requested, which allows skipping records based on their ID or tags without decoding them completely.
+package encoding
+
+// FormatVersion is the version of the binary format of the cell files. It's increased whenever the format changes in an
+// incompatible way, which requires a new import of the data.
+//
+// Versions:
+//   - 0: Initial format (indices without metadata file or without version field)
+//   - 1: Relations contain member roles
+//   - 2: Relations contain the types of their members in the original order
+//   - 3: Nodes contain a flags field and optionally their elevation
+//   - 4: Way nodes are stored as delta-encoded varints with fixed-point coordinates
+//   - 5: Nodes store their coordinates after the flags, which define the coordinate precision
+//   - 6: Ways and relations contain a flags field and all records optionally the changeset and user of the object
+//   - 7: All records optionally contain the validity interval of the object version (full-history imports)
+//   - 8: Ways contain the bbox of their nodes
+//   - 9: Nodes store their flags after the ID and nodes without tags and relations are stored as compact records
+const FormatVersion = 9
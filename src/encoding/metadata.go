@@ -0,0 +1,48 @@
+package encoding
+
+import (
+	"encoding/binary"
+)
+
+/*
+	The OSM metadata of an object is only stored when the record has the metadata flag set (nodeFlagMetadata for nodes
+	and flagMetadata for all other records):
+
+	Names: | changeset | user |
+	Bytes: |     8     |   4  |
+
+	The user is the index of the user name in the user dictionary of the tag-index.
+*/
+
+const (
+	flagMetadata = 1 << 0 // The record contains the changeset and user of the object (ways, relations and temp. records).
+
+	metadataBytes = 8 + 4 // changeset as 64-bit integer and user index as 32-bit integer
+)
+
+// encodeMetadata writes the changeset and user and returns the number of written bytes.
+func encodeMetadata(data []byte, changeset uint64, user int) int {
+	binary.LittleEndian.PutUint64(data[0:], changeset)
+	binary.LittleEndian.PutUint32(data[8:], uint32(user))
+	return metadataBytes
+}
+
+func decodeMetadata(data []byte) (uint64, int) {
+	return binary.LittleEndian.Uint64(data[0:]), int(binary.LittleEndian.Uint32(data[8:]))
+}
+
+// metadataSize returns the number of bytes of the metadata section of a record to encode.
+func metadataSize(hasMetadata bool) int {
+	if hasMetadata {
+		return metadataBytes
+	}
+	return 0
+}
+
+// getMetadataBytes returns the number of bytes of the metadata section of an encoded record with the given flags.
+func getMetadataBytes(flags byte, metadataFlag byte) int {
+	if flags&metadataFlag != 0 {
+		return metadataBytes
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package encoding
+
+import (
+	"github.com/paulmach/osm"
+	"soq/common"
+	"testing"
+)
+
+func TestNode_encodeAndDecodeWithMetadata(t *testing.T) {
+	// Arrange
+	node := &Node{
+		ID:           123,
+		Keys:         []int{3},
+		Values:       []int{12},
+		WayIds:       []osm.WayID{10},
+		Elevation:    12.5,
+		HasElevation: true,
+		Changeset:    987654321,
+		User:         42,
+		HasMetadata:  true,
+	}
+	data := make([]byte, node.Size())
+
+	// Act
+	err := node.Encode(data)
+	record := NodeRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 23+4+12+8+8, node.Size())
+	common.AssertEqual(t, node.Size(), NodeRecord(data[:NodeHeaderBytes]).Size())
+	changeset, user, hasMetadata := record.Metadata()
+	common.AssertTrue(t, hasMetadata)
+	common.AssertEqual(t, node.Changeset, changeset)
+	common.AssertEqual(t, node.User, user)
+	elevation, _ := record.Elevation()
+	common.AssertEqual(t, node.Elevation, elevation)
+	keys, values := record.Tags()
+	common.AssertEqual(t, node.Keys, keys)
+	common.AssertEqual(t, node.Values, values)
+	common.AssertEqual(t, node.WayIds, record.WayIds())
+}
+
+func TestWayAndRelation_encodeAndDecodeWithMetadata(t *testing.T) {
+	// Arrange
+	way := &Way{
+		ID:          1,
+		Keys:        []int{3},
+		Values:      []int{4},
+		Nodes:       osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}, {ID: 2, Lon: 1.5, Lat: 2.5}},
+		RelationIds: []osm.RelationID{5},
+		Changeset:   11,
+		User:        7,
+		HasMetadata: true,
+	}
+	relation := &Relation{
+		ID:          5,
+		Keys:        []int{3},
+		Values:      []int{4},
+		WayIds:      []osm.WayID{1},
+		WayRoles:    []string{"outer"},
+		Changeset:   12,
+		User:        8,
+		HasMetadata: true,
+	}
+	wayData := make([]byte, way.Size())
+	relationData := make([]byte, relation.Size())
+
+	// Act
+	wayErr := way.Encode(wayData)
+	relationErr := relation.Encode(relationData)
+	wayRecord := WayRecord(wayData)
+	relationRecord := RelationRecord(relationData)
+
+	// Assert
+	common.AssertNil(t, wayErr)
+	common.AssertNil(t, relationErr)
+
+	common.AssertEqual(t, way.Size(), WayRecord(wayData[:WayHeaderBytes]).Size())
+	changeset, user, hasMetadata := wayRecord.Metadata()
+	common.AssertTrue(t, hasMetadata)
+	common.AssertEqual(t, way.Changeset, changeset)
+	common.AssertEqual(t, way.User, user)
+	keys, _ := wayRecord.Tags()
+	common.AssertEqual(t, way.Keys, keys)
+	common.AssertEqual(t, way.Nodes, wayRecord.Nodes())
+	common.AssertEqual(t, way.RelationIds, wayRecord.RelationIds())
+
+	common.AssertEqual(t, relation.Size(), RelationRecord(relationData[:RelationHeaderBytes]).Size())
+	changeset, user, hasMetadata = relationRecord.Metadata()
+	common.AssertTrue(t, hasMetadata)
+	common.AssertEqual(t, relation.Changeset, changeset)
+	common.AssertEqual(t, relation.User, user)
+	keys, _ = relationRecord.Tags()
+	common.AssertEqual(t, relation.Keys, keys)
+	common.AssertEqual(t, relation.WayIds, relationRecord.WayIds())
+	_, wayRoles, _ := relationRecord.Roles()
+	common.AssertEqual(t, relation.WayRoles, wayRoles)
+}
+
+func TestRecords_withoutMetadata(t *testing.T) {
+	// Arrange
+	way := &Way{ID: 1, Nodes: osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}}}
+	data := make([]byte, way.Size())
+
+	// Act
+	err := way.Encode(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	_, _, hasMetadata := WayRecord(data).Metadata()
+	common.AssertFalse(t, hasMetadata)
+}
+
+func TestTempRecords_encodeAndDecodeWithMetadata(t *testing.T) {
+	// Arrange
+	node := &TempNode{ID: 1, Keys: []int{1}, Values: []int{2}, Changeset: 21, User: 3, HasMetadata: true}
+	way := &TempWay{ID: 2, Keys: []int{1}, Values: []int{2}, Nodes: osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}}, Changeset: 22, User: 4, HasMetadata: true}
+	relation := &TempRelation{ID: 3, Keys: []int{1}, Values: []int{2}, NodeIds: []osm.NodeID{1}, NodeRoles: []string{"stop"}, Changeset: 23, User: 5, HasMetadata: true}
+	nodeData := make([]byte, node.Size())
+	wayData := make([]byte, way.Size())
+	relationData := make([]byte, relation.Size())
+
+	// Act
+	common.AssertNil(t, node.Encode(nodeData))
+	common.AssertNil(t, way.Encode(wayData))
+	common.AssertNil(t, relation.Encode(relationData))
+
+	// Assert
+	common.AssertEqual(t, node.Size(), TempNodeRecord(nodeData[:TempNodeHeaderBytes]).Size())
+	changeset, user, hasMetadata := TempNodeRecord(nodeData).Metadata()
+	common.AssertTrue(t, hasMetadata)
+	common.AssertEqual(t, node.Changeset, changeset)
+	common.AssertEqual(t, node.User, user)
+	keys, _ := TempNodeRecord(nodeData).Tags()
+	common.AssertEqual(t, node.Keys, keys)
+
+	common.AssertEqual(t, way.Size(), TempWayRecord(wayData[:TempWayHeaderBytes]).Size())
+	changeset, user, hasMetadata = TempWayRecord(wayData).Metadata()
+	common.AssertTrue(t, hasMetadata)
+	common.AssertEqual(t, way.Changeset, changeset)
+	common.AssertEqual(t, way.User, user)
+	common.AssertEqual(t, way.Nodes, TempWayRecord(wayData).Nodes())
+
+	common.AssertEqual(t, relation.Size(), TempRelationRecord(relationData[:TempRelationHeaderBytes]).Size())
+	changeset, user, hasMetadata = TempRelationRecord(relationData).Metadata()
+	common.AssertTrue(t, hasMetadata)
+	common.AssertEqual(t, relation.Changeset, changeset)
+	common.AssertEqual(t, relation.User, user)
+	common.AssertEqual(t, relation.NodeIds, TempRelationRecord(relationData).NodeIds())
+}
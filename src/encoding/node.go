@@ -0,0 +1,267 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+/*
+	Node record format of the cell files:
+
+	Names: | osmId | flags | num. tags | num. ways | num. rels |   lon  |   lat  | elevation | metadata | validity |          encodedTags          |     way IDs     |   relation IDs  |
+	Bytes: |   8   |   1   |     2     |     2     |     2     |  4 / 8 |  4 / 8 |   0 / 4   |  0 / 12  |  0 / 16  | key (32 bit) | value (32 bit) | <num. ways> * 8 | <num. rels> * 8 |
+
+	Tags are stored as a list of "num. tags" many key-value-pairs.
+
+	Nodes without tags and relations (i.e. the majority of nodes, which are only part of ways) are stored as compact
+	record, which is marked by the nodeFlagCompact bit and has no tag and relation counts:
+
+	Names: | osmId | flags | num. ways |   lon  |   lat  | elevation | metadata | validity |     way IDs     |
+	Bytes: |   8   |   1   |     2     |  4 / 8 |  4 / 8 |   0 / 4   |  0 / 12  |  0 / 16  | <num. ways> * 8 |
+
+	The flags are a bit-field (s. nodeFlag* constants). The coordinates are 32-bit floats, 32-bit fixed-point numbers
+	(s. nodeFlagFixedPointCoordinates) or 64-bit floats (s. nodeFlagFloat64Coordinates), s. CoordinatePrecision. The
+	elevation is a 32-bit float in meters and only exists when the nodeFlagElevation bit is set. The metadata (s.
+	encodeMetadata) only exists when the nodeFlagMetadata bit is set and the validity (s. encodeValidity) only when the
+	nodeFlagValidity bit is set.
+*/
+
+// NodeHeaderBytes is the number of bytes needed to determine the size of a node record. Compact records have a
+// shorter header (s. compactNodeHeaderBytes) but are always larger than this.
+const NodeHeaderBytes = 8 + 1 + 2 + 2 + 2 // = 15
+
+const compactNodeHeaderBytes = 8 + 1 + 2 // = 11
+
+const (
+	nodeFlagElevation             = 1 << 0 // The record contains the elevation of the node.
+	nodeFlagFixedPointCoordinates = 1 << 1 // The coordinates are 32-bit fixed-point numbers.
+	nodeFlagFloat64Coordinates    = 1 << 2 // The coordinates are 64-bit floats.
+	nodeFlagMetadata              = 1 << 3 // The record contains the changeset and user of the node.
+	nodeFlagValidity              = 1 << 4 // The record contains the validity interval of the node version.
+	nodeFlagCompact               = 1 << 5 // The record has no tags and relations and therefore no counts for them.
+
+	elevationBytes = 4 // elevation as 32-bit float
+)
+
+type Node struct {
+	ID          uint64
+	Lon         float64
+	Lat         float64
+	Keys        []int
+	Values      []int
+	WayIds      []osm.WayID
+	RelationIds []osm.RelationID
+
+	// Elevation in meters, which is only stored when HasElevation is true.
+	Elevation    float64
+	HasElevation bool
+
+	// How the coordinates are stored. Empty means CoordinatePrecisionFloat32.
+	CoordinatePrecision CoordinatePrecision
+
+	// OSM metadata, which is only stored when HasMetadata is true. The user is the index in the user dictionary.
+	Changeset   uint64
+	User        int
+	HasMetadata bool
+
+	// Validity interval of this version as unix timestamps, which is only stored when HasValidity is true.
+	ValidFrom   int64
+	ValidTo     int64
+	HasValidity bool
+}
+
+// Size returns the number of bytes of the encoded node.
+func (n *Node) Size() int {
+	return n.headerBytes() + n.CoordinatePrecision.coordinatesBytes() + n.elevationBytes() + metadataSize(n.HasMetadata) + validitySize(n.HasValidity) + len(n.Keys)*tagBytes + len(n.WayIds)*idBytes + len(n.RelationIds)*idBytes
+}
+
+// isCompact returns true when the node is stored as compact record without tag and relation counts.
+func (n *Node) isCompact() bool {
+	return len(n.Keys) == 0 && len(n.RelationIds) == 0
+}
+
+func (n *Node) headerBytes() int {
+	if n.isCompact() {
+		return compactNodeHeaderBytes
+	}
+	return NodeHeaderBytes
+}
+
+func (n *Node) elevationBytes() int {
+	if n.HasElevation {
+		return elevationBytes
+	}
+	return 0
+}
+
+// Encode writes the node into the given data slice, which must have at least Size() bytes.
+func (n *Node) Encode(data []byte) error {
+	if len(n.Keys) != len(n.Values) {
+		return errors.Errorf("Number of keys and values for node %d different: keys %d, values %d", n.ID, len(n.Keys), len(n.Values))
+	}
+
+	binary.LittleEndian.PutUint64(data[0:], n.ID)
+	data[8] = n.CoordinatePrecision.nodeFlags()
+	if n.isCompact() {
+		data[8] |= nodeFlagCompact
+		putCount(data[9:], len(n.WayIds))
+	} else {
+		putCount(data[9:], len(n.Keys))
+		putCount(data[11:], len(n.WayIds))
+		putCount(data[13:], len(n.RelationIds))
+	}
+
+	pos := n.headerBytes()
+	pos += n.CoordinatePrecision.encodeCoordinates(data[pos:], n.Lon, n.Lat)
+
+	if n.HasElevation {
+		data[8] |= nodeFlagElevation
+		putFloat(data[pos:], n.Elevation)
+		pos += elevationBytes
+	}
+
+	if n.HasMetadata {
+		data[8] |= nodeFlagMetadata
+		pos += encodeMetadata(data[pos:], n.Changeset, n.User)
+	}
+
+	if n.HasValidity {
+		data[8] |= nodeFlagValidity
+		pos += encodeValidity(data[pos:], n.ValidFrom, n.ValidTo)
+	}
+
+	pos += encodeTags(data[pos:], n.Keys, n.Values)
+	pos += encodeIds(data[pos:], n.WayIds)
+	encodeIds(data[pos:], n.RelationIds)
+
+	return nil
+}
+
+// NodeRecord is an encoded node starting at the beginning of the slice. Only the requested fields are decoded.
+type NodeRecord []byte
+
+func (r NodeRecord) ID() uint64 {
+	return binary.LittleEndian.Uint64(r[0:])
+}
+
+func (r NodeRecord) Lon() float64 {
+	lon, _ := r.coordinatePrecision().decodeCoordinates(r[r.headerBytes():])
+	return lon
+}
+
+func (r NodeRecord) Lat() float64 {
+	_, lat := r.coordinatePrecision().decodeCoordinates(r[r.headerBytes():])
+	return lat
+}
+
+func (r NodeRecord) isCompact() bool {
+	return r[8]&nodeFlagCompact != 0
+}
+
+func (r NodeRecord) headerBytes() int {
+	if r.isCompact() {
+		return compactNodeHeaderBytes
+	}
+	return NodeHeaderBytes
+}
+
+func (r NodeRecord) numberOfTags() int {
+	if r.isCompact() {
+		return 0
+	}
+	return getCount(r[9:])
+}
+
+func (r NodeRecord) numberOfWayIds() int {
+	if r.isCompact() {
+		return getCount(r[9:])
+	}
+	return getCount(r[11:])
+}
+
+func (r NodeRecord) numberOfRelationIds() int {
+	if r.isCompact() {
+		return 0
+	}
+	return getCount(r[13:])
+}
+
+func (r NodeRecord) hasElevation() bool {
+	return r[8]&nodeFlagElevation != 0
+}
+
+func (r NodeRecord) coordinatePrecision() CoordinatePrecision {
+	return coordinatePrecisionFromNodeFlags(r[8])
+}
+
+// dataStart returns the position of the first field after the coordinates, the elevation, the metadata and the
+// validity.
+func (r NodeRecord) dataStart() int {
+	return r.validityStart() + getValidityBytes(r[8], nodeFlagValidity)
+}
+
+func (r NodeRecord) validityStart() int {
+	return r.metadataStart() + getMetadataBytes(r[8], nodeFlagMetadata)
+}
+
+func (r NodeRecord) metadataStart() int {
+	return r.headerBytes() + r.coordinatePrecision().coordinatesBytes() + r.elevationBytes()
+}
+
+func (r NodeRecord) elevationBytes() int {
+	if r.hasElevation() {
+		return elevationBytes
+	}
+	return 0
+}
+
+// Elevation returns the elevation of the node in meters. The second return value is false when the record doesn't
+// contain an elevation.
+func (r NodeRecord) Elevation() (float64, bool) {
+	if !r.hasElevation() {
+		return 0, false
+	}
+	return getFloat(r[r.headerBytes()+r.coordinatePrecision().coordinatesBytes():]), true
+}
+
+// Metadata returns the changeset and the user index of the node. The third return value is false when the record
+// doesn't contain metadata.
+func (r NodeRecord) Metadata() (uint64, int, bool) {
+	if r[8]&nodeFlagMetadata == 0 {
+		return 0, 0, false
+	}
+	changeset, user := decodeMetadata(r[r.metadataStart():])
+	return changeset, user, true
+}
+
+// Validity returns the start and end of the validity interval of the node version. The third return value is false
+// when the record doesn't contain a validity.
+func (r NodeRecord) Validity() (int64, int64, bool) {
+	if r[8]&nodeFlagValidity == 0 {
+		return 0, 0, false
+	}
+	validFrom, validTo := decodeValidity(r[r.validityStart():])
+	return validFrom, validTo, true
+}
+
+// Tags returns the keys and values of the node.
+func (r NodeRecord) Tags() ([]int, []int) {
+	return decodeTags(r[r.dataStart():], r.numberOfTags())
+}
+
+func (r NodeRecord) WayIds() []osm.WayID {
+	pos := r.dataStart() + r.numberOfTags()*tagBytes
+	return decodeIds[osm.WayID](r[pos:], r.numberOfWayIds())
+}
+
+func (r NodeRecord) RelationIds() []osm.RelationID {
+	pos := r.dataStart() + r.numberOfTags()*tagBytes + r.numberOfWayIds()*idBytes
+	return decodeIds[osm.RelationID](r[pos:], r.numberOfRelationIds())
+}
+
+// Size returns the number of bytes of this record. Only the header is needed for this, so the slice might end before
+// the end of the record.
+func (r NodeRecord) Size() int {
+	return r.dataStart() + r.numberOfTags()*tagBytes + r.numberOfWayIds()*idBytes + r.numberOfRelationIds()*idBytes
+}
@@ -0,0 +1,190 @@
+package encoding
+
+import (
+	"github.com/paulmach/osm"
+	"soq/common"
+	"testing"
+)
+
+func TestNode_encodeAndDecode(t *testing.T) {
+	// Arrange
+	node := &Node{
+		ID:          123,
+		Lon:         1.5,
+		Lat:         -2.25,
+		Keys:        []int{3, 7},
+		Values:      []int{0, 12},
+		WayIds:      []osm.WayID{10, 11},
+		RelationIds: []osm.RelationID{20},
+	}
+	data := make([]byte, node.Size())
+
+	// Act
+	err := node.Encode(data)
+	record := NodeRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 23+2*8+2*8+8, node.Size())
+	common.AssertEqual(t, node.Size(), record.Size())
+	common.AssertEqual(t, node.ID, record.ID())
+	common.AssertEqual(t, node.Lon, record.Lon())
+	common.AssertEqual(t, node.Lat, record.Lat())
+	keys, values := record.Tags()
+	common.AssertEqual(t, node.Keys, keys)
+	common.AssertEqual(t, node.Values, values)
+	common.AssertEqual(t, node.WayIds, record.WayIds())
+	common.AssertEqual(t, node.RelationIds, record.RelationIds())
+	_, hasElevation := record.Elevation()
+	common.AssertFalse(t, hasElevation)
+}
+
+func TestNode_encodeAndDecodeCompact(t *testing.T) {
+	// Arrange
+	node := &Node{
+		ID:     123,
+		Lon:    1.5,
+		Lat:    -2.25,
+		Keys:   []int{},
+		Values: []int{},
+		WayIds: []osm.WayID{10, 11},
+	}
+	data := make([]byte, node.Size())
+
+	// Act
+	err := node.Encode(data)
+	record := NodeRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 19+2*8, node.Size())
+	common.AssertTrue(t, record.isCompact())
+	common.AssertEqual(t, node.Size(), record.Size())
+	common.AssertEqual(t, node.Size(), NodeRecord(data[:NodeHeaderBytes]).Size())
+	common.AssertEqual(t, node.ID, record.ID())
+	common.AssertEqual(t, node.Lon, record.Lon())
+	common.AssertEqual(t, node.Lat, record.Lat())
+	keys, values := record.Tags()
+	common.AssertEqual(t, 0, len(keys))
+	common.AssertEqual(t, 0, len(values))
+	common.AssertEqual(t, node.WayIds, record.WayIds())
+	common.AssertEqual(t, 0, len(record.RelationIds()))
+}
+
+func TestNode_encodeAndDecodeWithElevation(t *testing.T) {
+	// Arrange
+	node := &Node{
+		ID:           123,
+		Keys:         []int{3},
+		Values:       []int{12},
+		WayIds:       []osm.WayID{10},
+		RelationIds:  []osm.RelationID{20},
+		Elevation:    1234.5,
+		HasElevation: true,
+	}
+	data := make([]byte, node.Size())
+
+	// Act
+	err := node.Encode(data)
+	record := NodeRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 23+4+8+8+8, node.Size())
+	common.AssertEqual(t, node.Size(), NodeRecord(data[:NodeHeaderBytes]).Size())
+	elevation, hasElevation := record.Elevation()
+	common.AssertTrue(t, hasElevation)
+	common.AssertEqual(t, node.Elevation, elevation)
+	keys, values := record.Tags()
+	common.AssertEqual(t, node.Keys, keys)
+	common.AssertEqual(t, node.Values, values)
+	common.AssertEqual(t, node.WayIds, record.WayIds())
+	common.AssertEqual(t, node.RelationIds, record.RelationIds())
+}
+
+func TestNode_encodeAndDecodeWithCoordinatePrecision(t *testing.T) {
+	for _, testCase := range []struct {
+		precision         CoordinatePrecision
+		expectedSize      int
+		expectedPrecision float64
+	}{
+		{"", 15 + 8 + 4 + 8, 1e-5},
+		{CoordinatePrecisionFloat32, 15 + 8 + 4 + 8, 1e-5},
+		{CoordinatePrecisionFixed, 15 + 8 + 4 + 8, 1e-9},
+		{CoordinatePrecisionFloat64, 15 + 16 + 4 + 8, 0},
+	} {
+		// Arrange
+		node := &Node{
+			ID:                  123,
+			Lon:                 179.9876543,
+			Lat:                 -53.5512345,
+			Keys:                []int{3},
+			Values:              []int{12},
+			Elevation:           12.5,
+			HasElevation:        true,
+			CoordinatePrecision: testCase.precision,
+		}
+		data := make([]byte, node.Size())
+
+		// Act
+		err := node.Encode(data)
+		record := NodeRecord(data)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expectedSize, node.Size())
+		common.AssertEqual(t, node.Size(), NodeRecord(data[:NodeHeaderBytes]).Size())
+		common.AssertApprox(t, node.Lon, record.Lon(), testCase.expectedPrecision)
+		common.AssertApprox(t, node.Lat, record.Lat(), testCase.expectedPrecision)
+		elevation, hasElevation := record.Elevation()
+		common.AssertTrue(t, hasElevation)
+		common.AssertEqual(t, 12.5, elevation)
+		keys, values := record.Tags()
+		common.AssertEqual(t, node.Keys, keys)
+		common.AssertEqual(t, node.Values, values)
+	}
+}
+
+func TestParseCoordinatePrecision(t *testing.T) {
+	for name, expectedPrecision := range map[string]CoordinatePrecision{
+		"":        CoordinatePrecisionFloat32,
+		"float32": CoordinatePrecisionFloat32,
+		"fixed":   CoordinatePrecisionFixed,
+		"float64": CoordinatePrecisionFloat64,
+	} {
+		// Act
+		precision, err := ParseCoordinatePrecision(name)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, expectedPrecision, precision)
+	}
+
+	_, err := ParseCoordinatePrecision("float16")
+	common.AssertNotNil(t, err)
+}
+
+func TestNode_sizeFromHeaderOnly(t *testing.T) {
+	// Arrange
+	node := &Node{ID: 1, Keys: []int{1}, Values: []int{2}, WayIds: []osm.WayID{3}}
+	data := make([]byte, node.Size())
+	err := node.Encode(data)
+	common.AssertNil(t, err)
+
+	// Act
+	size := NodeRecord(data[:NodeHeaderBytes]).Size()
+
+	// Assert
+	common.AssertEqual(t, len(data), size)
+}
+
+func TestNode_differentNumberOfKeysAndValues(t *testing.T) {
+	// Arrange
+	node := &Node{ID: 1, Keys: []int{1, 2}, Values: []int{2}}
+
+	// Act
+	err := node.Encode(make([]byte, 100))
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
@@ -0,0 +1,272 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"math"
+	ownOsm "soq/osm"
+)
+
+const (
+	tagBytes     = 4 + 4     // key and value index as 32-bit integers
+	idBytes      = 8         // IDs are all 64-bit integers
+	wayNodeBytes = 8 + 4 + 4 // ID as 64-bit integer followed by lon and lat as 32-bit fixed-point numbers (temporary features only)
+	bboxBytes    = 4 * 4     // min-lon, min-lat, max-lon and max-lat as 32-bit floats (fixed-point numbers for ways)
+	memberBytes  = 1         // type of a relation member as 8-bit integer
+
+	// Factor of fixed-point coordinates, which is the precision of OSM coordinates (7 decimal places).
+	coordinateFactor = 1e7
+)
+
+type osmId interface {
+	osm.NodeID | osm.WayID | osm.RelationID
+}
+
+func putFloat(data []byte, value float64) {
+	binary.LittleEndian.PutUint32(data, math.Float32bits(float32(value)))
+}
+
+func getFloat(data []byte) float64 {
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+}
+
+// putFixedPoint writes the coordinate as 32-bit fixed-point number, s. coordinateFactor.
+func putFixedPoint(data []byte, coordinate float64) {
+	binary.LittleEndian.PutUint32(data, uint32(int32(toFixedPoint(coordinate))))
+}
+
+func getFixedPoint(data []byte) float64 {
+	return fromFixedPoint(int64(int32(binary.LittleEndian.Uint32(data))))
+}
+
+func putCount(data []byte, count int) {
+	binary.LittleEndian.PutUint16(data, uint16(count))
+}
+
+func getCount(data []byte) int {
+	return int(binary.LittleEndian.Uint16(data))
+}
+
+// encodeTags writes the tags as list of key-value-pairs and returns the number of written bytes.
+func encodeTags(data []byte, keys []int, values []int) int {
+	pos := 0
+	for i := range keys {
+		binary.LittleEndian.PutUint32(data[pos:], uint32(keys[i]))
+		binary.LittleEndian.PutUint32(data[pos+4:], uint32(values[i]))
+		pos += tagBytes
+	}
+	return pos
+}
+
+func decodeTags(data []byte, numberOfTags int) ([]int, []int) {
+	keys := make([]int, numberOfTags)
+	values := make([]int, numberOfTags)
+	for i := 0; i < numberOfTags; i++ {
+		keys[i] = int(binary.LittleEndian.Uint32(data[i*tagBytes:]))
+		values[i] = int(binary.LittleEndian.Uint32(data[i*tagBytes+4:]))
+	}
+	return keys, values
+}
+
+func encodeIds[T osmId](data []byte, ids []T) int {
+	for i, id := range ids {
+		binary.LittleEndian.PutUint64(data[i*idBytes:], uint64(id))
+	}
+	return len(ids) * idBytes
+}
+
+func decodeIds[T osmId](data []byte, count int) []T {
+	ids := make([]T, count)
+	for i := 0; i < count; i++ {
+		ids[i] = T(binary.LittleEndian.Uint64(data[i*idBytes:]))
+	}
+	return ids
+}
+
+func encodeWayNodes(data []byte, nodes osm.WayNodes) int {
+	for i, node := range nodes {
+		pos := i * wayNodeBytes
+		binary.LittleEndian.PutUint64(data[pos:], uint64(node.ID))
+		putFixedPoint(data[pos+8:], node.Lon)
+		putFixedPoint(data[pos+12:], node.Lat)
+	}
+	return len(nodes) * wayNodeBytes
+}
+
+func decodeWayNodes(data []byte, count int) osm.WayNodes {
+	nodes := make(osm.WayNodes, count)
+	for i := 0; i < count; i++ {
+		pos := i * wayNodeBytes
+		nodes[i] = osm.WayNode{
+			ID:  osm.NodeID(binary.LittleEndian.Uint64(data[pos:])),
+			Lon: getFixedPoint(data[pos+8:]),
+			Lat: getFixedPoint(data[pos+12:]),
+		}
+	}
+	return nodes
+}
+
+// encodeDeltaWayNodes writes the nodes as varints of the difference to the previous node: The ID followed by lon and lat
+// as fixed-point numbers (s. coordinateFactor). The data must have at least deltaWayNodesSize(nodes) bytes. The number
+// of written bytes is returned.
+func encodeDeltaWayNodes(data []byte, nodes osm.WayNodes) int {
+	pos := 0
+	var previousId, previousLon, previousLat int64
+	for _, node := range nodes {
+		id, lon, lat := int64(node.ID), toFixedPoint(node.Lon), toFixedPoint(node.Lat)
+		pos += binary.PutVarint(data[pos:], id-previousId)
+		pos += binary.PutVarint(data[pos:], lon-previousLon)
+		pos += binary.PutVarint(data[pos:], lat-previousLat)
+		previousId, previousLon, previousLat = id, lon, lat
+	}
+	return pos
+}
+
+// deltaWayNodesSize returns the number of bytes encodeDeltaWayNodes writes for the given nodes.
+func deltaWayNodesSize(nodes osm.WayNodes) int {
+	size := 0
+	var previousId, previousLon, previousLat int64
+	for _, node := range nodes {
+		id, lon, lat := int64(node.ID), toFixedPoint(node.Lon), toFixedPoint(node.Lat)
+		size += varintSize(id-previousId) + varintSize(lon-previousLon) + varintSize(lat-previousLat)
+		previousId, previousLon, previousLat = id, lon, lat
+	}
+	return size
+}
+
+// decodeDeltaWayNodes decodes the given number of nodes written by encodeDeltaWayNodes. The data must only contain the
+// encoded nodes. Decoding stops at the end of the data, so corrupt data results in fewer nodes.
+func decodeDeltaWayNodes(data []byte, count int) osm.WayNodes {
+	nodes := make(osm.WayNodes, 0, count)
+	pos := 0
+	var id, lon, lat int64
+	for i := 0; i < count; i++ {
+		var deltas [3]int64
+		for j := range deltas {
+			delta, n := binary.Varint(data[pos:])
+			if n <= 0 {
+				return nodes
+			}
+			deltas[j] = delta
+			pos += n
+		}
+
+		id, lon, lat = id+deltas[0], lon+deltas[1], lat+deltas[2]
+		nodes = append(nodes, osm.WayNode{
+			ID:  osm.NodeID(id),
+			Lon: fromFixedPoint(lon),
+			Lat: fromFixedPoint(lat),
+		})
+	}
+	return nodes
+}
+
+func toFixedPoint(coordinate float64) int64 {
+	return int64(math.Round(coordinate * coordinateFactor))
+}
+
+func fromFixedPoint(value int64) float64 {
+	return float64(value) / coordinateFactor
+}
+
+// varintSize returns the number of bytes binary.PutVarint needs for the given value.
+func varintSize(value int64) int {
+	zigzagValue := uint64(value<<1) ^ uint64(value>>63)
+	size := 1
+	for zigzagValue >= 0x80 {
+		zigzagValue >>= 7
+		size++
+	}
+	return size
+}
+
+func encodeBbox(data []byte, bbox orb.Bound) int {
+	putFloat(data[0:], bbox.Min.Lon())
+	putFloat(data[4:], bbox.Min.Lat())
+	putFloat(data[8:], bbox.Max.Lon())
+	putFloat(data[12:], bbox.Max.Lat())
+	return bboxBytes
+}
+
+func decodeBbox(data []byte) orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{getFloat(data[0:]), getFloat(data[4:])},
+		Max: orb.Point{getFloat(data[8:]), getFloat(data[12:])},
+	}
+}
+
+// encodeWayNodesBbox writes the bbox of the given nodes as 32-bit fixed-point numbers (s. coordinateFactor) and returns
+// the number of written bytes. The bbox of a way without nodes is 0,0,0,0.
+func encodeWayNodesBbox(data []byte, nodes osm.WayNodes) int {
+	var minLon, minLat, maxLon, maxLat int64
+	for i, node := range nodes {
+		lon := toFixedPoint(node.Lon)
+		lat := toFixedPoint(node.Lat)
+		if i == 0 {
+			minLon, minLat, maxLon, maxLat = lon, lat, lon, lat
+			continue
+		}
+		minLon, minLat = min(minLon, lon), min(minLat, lat)
+		maxLon, maxLat = max(maxLon, lon), max(maxLat, lat)
+	}
+
+	binary.LittleEndian.PutUint32(data[0:], uint32(int32(minLon)))
+	binary.LittleEndian.PutUint32(data[4:], uint32(int32(minLat)))
+	binary.LittleEndian.PutUint32(data[8:], uint32(int32(maxLon)))
+	binary.LittleEndian.PutUint32(data[12:], uint32(int32(maxLat)))
+	return bboxBytes
+}
+
+func decodeFixedPointBbox(data []byte) orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{getFixedPoint(data[0:]), getFixedPoint(data[4:])},
+		Max: orb.Point{getFixedPoint(data[8:]), getFixedPoint(data[12:])},
+	}
+}
+
+// getMemberTypes returns the types of all relation members in their original order. Without member types, the members
+// are assumed to be grouped by type, which is the order of the separate ID lists (nodes, ways, child relations).
+func getMemberTypes(memberTypes []ownOsm.OsmObjectType, numberOfNodes int, numberOfWays int, numberOfChildRelations int) ([]ownOsm.OsmObjectType, error) {
+	if len(memberTypes) == 0 {
+		memberTypes = make([]ownOsm.OsmObjectType, 0, numberOfNodes+numberOfWays+numberOfChildRelations)
+		for i := 0; i < numberOfNodes; i++ {
+			memberTypes = append(memberTypes, ownOsm.OsmObjNode)
+		}
+		for i := 0; i < numberOfWays; i++ {
+			memberTypes = append(memberTypes, ownOsm.OsmObjWay)
+		}
+		for i := 0; i < numberOfChildRelations; i++ {
+			memberTypes = append(memberTypes, ownOsm.OsmObjRelation)
+		}
+		return memberTypes, nil
+	}
+
+	counts := map[ownOsm.OsmObjectType]int{}
+	for _, memberType := range memberTypes {
+		counts[memberType]++
+	}
+	if len(memberTypes) != numberOfNodes+numberOfWays+numberOfChildRelations ||
+		counts[ownOsm.OsmObjNode] != numberOfNodes ||
+		counts[ownOsm.OsmObjWay] != numberOfWays ||
+		counts[ownOsm.OsmObjRelation] != numberOfChildRelations {
+		return nil, errors.Errorf("Member types (%d nodes, %d ways, %d relations) don't match the member IDs (%d nodes, %d ways, %d relations)", counts[ownOsm.OsmObjNode], counts[ownOsm.OsmObjWay], counts[ownOsm.OsmObjRelation], numberOfNodes, numberOfWays, numberOfChildRelations)
+	}
+	return memberTypes, nil
+}
+
+func encodeMemberTypes(data []byte, memberTypes []ownOsm.OsmObjectType) int {
+	for i, memberType := range memberTypes {
+		data[i] = byte(memberType)
+	}
+	return len(memberTypes) * memberBytes
+}
+
+func decodeMemberTypes(data []byte, count int) []ownOsm.OsmObjectType {
+	memberTypes := make([]ownOsm.OsmObjectType, count)
+	for i := 0; i < count; i++ {
+		memberTypes[i] = ownOsm.OsmObjectType(data[i])
+	}
+	return memberTypes
+}
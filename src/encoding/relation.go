@@ -0,0 +1,232 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	ownOsm "soq/osm"
+)
+
+/*
+	Relation record format of the cell files:
+
+	Names: | osmId | bbox | num. tags | num. nodes | num. ways | num. child rels | num. parent rels | role bytes | flags | metadata | validity |          encodedTags          |     node IDs     |     way IDs     |    child rel. IDs     |    parent rel. IDs     |     roles    |    member types    |
+	Bytes: |   8   |  16  |     2     |      2     |     2     |        2        |         2        |      4     |   1   |  0 / 12  |  0 / 16  | key (32 bit) | value (32 bit) | <num. nodes> * 8 | <num. ways> * 8 | <num. child rels> * 8 | <num. parent rels> * 8 | <role bytes> | <num. members> * 1 |
+
+	The flags are a bit-field, the metadata (s. encodeMetadata) only exists when the flagMetadata bit is set and the
+	validity (s. encodeValidity) only when the flagValidity bit is set.
+
+	Tags are stored as a list of "num. tags" many key-value-pairs.
+
+	The "bbox" field are 4 32-bit floats for the min-lon, min-lat, max-lon and max-lat values.
+
+	The roles of the node, way and child relation members are stored in this order (s. EncodeRoles for the format).
+
+	The member types contain the type (s. ownOsm.OsmObjectType) of each node, way and child relation member in the
+	order of the OSM data. The "num. members" is the sum of the node, way and child relation counts. Together with the
+	separate ID and role lists, this restores the original order and interleaving of all members.
+*/
+
+// RelationHeaderBytes is the number of bytes needed to determine the size of a relation record.
+const RelationHeaderBytes = 8 + bboxBytes + 2 + 2 + 2 + 2 + 2 + 4 + 1 // = 39
+
+type Relation struct {
+	ID                 uint64
+	Bbox               orb.Bound
+	Keys               []int
+	Values             []int
+	NodeIds            []osm.NodeID
+	WayIds             []osm.WayID
+	ChildRelationIds   []osm.RelationID
+	ParentRelationIds  []osm.RelationID
+	NodeRoles          []string
+	WayRoles           []string
+	ChildRelationRoles []string
+	// Type of each member in the order of the OSM data. When empty, the members are assumed to be grouped by type.
+	MemberTypes []ownOsm.OsmObjectType
+
+	// OSM metadata, which is only stored when HasMetadata is true. The user is the index in the user dictionary.
+	Changeset   uint64
+	User        int
+	HasMetadata bool
+
+	// Validity interval of this version as unix timestamps, which is only stored when HasValidity is true.
+	ValidFrom   int64
+	ValidTo     int64
+	HasValidity bool
+}
+
+// Size returns the number of bytes of the encoded relation.
+func (r *Relation) Size() int {
+	numberOfMembers := len(r.NodeIds) + len(r.WayIds) + len(r.ChildRelationIds)
+	numberOfIds := numberOfMembers + len(r.ParentRelationIds)
+	return RelationHeaderBytes + metadataSize(r.HasMetadata) + validitySize(r.HasValidity) + len(r.Keys)*tagBytes + numberOfIds*idBytes + r.roleBytes() + numberOfMembers*memberBytes
+}
+
+func (r *Relation) roleBytes() int {
+	return GetEncodedRolesSize(r.NodeRoles, r.WayRoles, r.ChildRelationRoles)
+}
+
+// Encode writes the relation into the given data slice, which must have at least Size() bytes.
+func (r *Relation) Encode(data []byte) error {
+	if len(r.Keys) != len(r.Values) {
+		return errors.Errorf("Number of keys and values for relation %d different: keys %d, values %d", r.ID, len(r.Keys), len(r.Values))
+	}
+
+	memberTypes, err := getMemberTypes(r.MemberTypes, len(r.NodeIds), len(r.WayIds), len(r.ChildRelationIds))
+	if err != nil {
+		return errors.Wrapf(err, "Invalid members of relation %d", r.ID)
+	}
+
+	binary.LittleEndian.PutUint64(data[0:], r.ID)
+	encodeBbox(data[8:], r.Bbox)
+	putCount(data[24:], len(r.Keys))
+	putCount(data[26:], len(r.NodeIds))
+	putCount(data[28:], len(r.WayIds))
+	putCount(data[30:], len(r.ChildRelationIds))
+	putCount(data[32:], len(r.ParentRelationIds))
+	binary.LittleEndian.PutUint32(data[34:], uint32(r.roleBytes()))
+
+	data[38] = 0
+	pos := RelationHeaderBytes
+	if r.HasMetadata {
+		data[38] |= flagMetadata
+		pos += encodeMetadata(data[pos:], r.Changeset, r.User)
+	}
+	if r.HasValidity {
+		data[38] |= flagValidity
+		pos += encodeValidity(data[pos:], r.ValidFrom, r.ValidTo)
+	}
+
+	pos += encodeTags(data[pos:], r.Keys, r.Values)
+	pos += encodeIds(data[pos:], r.NodeIds)
+	pos += encodeIds(data[pos:], r.WayIds)
+	pos += encodeIds(data[pos:], r.ChildRelationIds)
+	pos += encodeIds(data[pos:], r.ParentRelationIds)
+	pos += EncodeRoles(data[pos:], r.NodeRoles)
+	pos += EncodeRoles(data[pos:], r.WayRoles)
+	pos += EncodeRoles(data[pos:], r.ChildRelationRoles)
+	encodeMemberTypes(data[pos:], memberTypes)
+
+	return nil
+}
+
+// RelationRecord is an encoded relation starting at the beginning of the slice. Only the requested fields are decoded.
+type RelationRecord []byte
+
+func (r RelationRecord) ID() uint64 {
+	return binary.LittleEndian.Uint64(r[0:])
+}
+
+func (r RelationRecord) Bbox() orb.Bound {
+	return decodeBbox(r[8:])
+}
+
+func (r RelationRecord) numberOfTags() int {
+	return getCount(r[24:])
+}
+
+func (r RelationRecord) numberOfNodeIds() int {
+	return getCount(r[26:])
+}
+
+func (r RelationRecord) numberOfWayIds() int {
+	return getCount(r[28:])
+}
+
+func (r RelationRecord) numberOfChildRelationIds() int {
+	return getCount(r[30:])
+}
+
+func (r RelationRecord) numberOfParentRelationIds() int {
+	return getCount(r[32:])
+}
+
+func (r RelationRecord) roleBytes() int {
+	return int(binary.LittleEndian.Uint32(r[34:]))
+}
+
+// Metadata returns the changeset and the user index of the relation. The third return value is false when the record
+// doesn't contain metadata.
+func (r RelationRecord) Metadata() (uint64, int, bool) {
+	if r[38]&flagMetadata == 0 {
+		return 0, 0, false
+	}
+	changeset, user := decodeMetadata(r[RelationHeaderBytes:])
+	return changeset, user, true
+}
+
+// Validity returns the start and end of the validity interval of the relation version. The third return value is
+// false when the record doesn't contain a validity.
+func (r RelationRecord) Validity() (int64, int64, bool) {
+	if r[38]&flagValidity == 0 {
+		return 0, 0, false
+	}
+	validFrom, validTo := decodeValidity(r[r.validityPos():])
+	return validFrom, validTo, true
+}
+
+func (r RelationRecord) validityPos() int {
+	return RelationHeaderBytes + getMetadataBytes(r[38], flagMetadata)
+}
+
+func (r RelationRecord) tagsPos() int {
+	return r.validityPos() + getValidityBytes(r[38], flagValidity)
+}
+
+// Tags returns the keys and values of the relation.
+func (r RelationRecord) Tags() ([]int, []int) {
+	return decodeTags(r[r.tagsPos():], r.numberOfTags())
+}
+
+func (r RelationRecord) nodeIdsPos() int {
+	return r.tagsPos() + r.numberOfTags()*tagBytes
+}
+
+func (r RelationRecord) NodeIds() []osm.NodeID {
+	return decodeIds[osm.NodeID](r[r.nodeIdsPos():], r.numberOfNodeIds())
+}
+
+func (r RelationRecord) WayIds() []osm.WayID {
+	pos := r.nodeIdsPos() + r.numberOfNodeIds()*idBytes
+	return decodeIds[osm.WayID](r[pos:], r.numberOfWayIds())
+}
+
+func (r RelationRecord) ChildRelationIds() []osm.RelationID {
+	pos := r.nodeIdsPos() + (r.numberOfNodeIds()+r.numberOfWayIds())*idBytes
+	return decodeIds[osm.RelationID](r[pos:], r.numberOfChildRelationIds())
+}
+
+func (r RelationRecord) ParentRelationIds() []osm.RelationID {
+	pos := r.nodeIdsPos() + (r.numberOfNodeIds()+r.numberOfWayIds()+r.numberOfChildRelationIds())*idBytes
+	return decodeIds[osm.RelationID](r[pos:], r.numberOfParentRelationIds())
+}
+
+// Roles returns the roles of the node, way and child relation members.
+func (r RelationRecord) Roles() ([]string, []string, []string) {
+	pos := r.nodeIdsPos() + (r.numberOfNodeIds()+r.numberOfWayIds()+r.numberOfChildRelationIds()+r.numberOfParentRelationIds())*idBytes
+	nodeRoles, roleBytes := DecodeRoles(r[pos:], r.numberOfNodeIds())
+	pos += roleBytes
+	wayRoles, roleBytes := DecodeRoles(r[pos:], r.numberOfWayIds())
+	pos += roleBytes
+	childRelationRoles, _ := DecodeRoles(r[pos:], r.numberOfChildRelationIds())
+	return nodeRoles, wayRoles, childRelationRoles
+}
+
+func (r RelationRecord) numberOfMembers() int {
+	return r.numberOfNodeIds() + r.numberOfWayIds() + r.numberOfChildRelationIds()
+}
+
+// MemberTypes returns the type of each member in the order of the OSM data.
+func (r RelationRecord) MemberTypes() []ownOsm.OsmObjectType {
+	pos := r.nodeIdsPos() + (r.numberOfMembers()+r.numberOfParentRelationIds())*idBytes + r.roleBytes()
+	return decodeMemberTypes(r[pos:], r.numberOfMembers())
+}
+
+// Size returns the number of bytes of this record. Only the header is needed for this, so the slice might end before
+// the end of the record.
+func (r RelationRecord) Size() int {
+	numberOfIds := r.numberOfMembers() + r.numberOfParentRelationIds()
+	return r.nodeIdsPos() + numberOfIds*idBytes + r.roleBytes() + r.numberOfMembers()*memberBytes
+}
@@ -0,0 +1,110 @@
+package encoding
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"soq/common"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func TestRelation_encodeAndDecode(t *testing.T) {
+	// Arrange
+	relation := &Relation{
+		ID:                 123,
+		Bbox:               orb.Bound{Min: orb.Point{1, 2}, Max: orb.Point{3.5, 4.5}},
+		Keys:               []int{3, 4},
+		Values:             []int{5, 6},
+		NodeIds:            []osm.NodeID{1},
+		WayIds:             []osm.WayID{2, 3},
+		ChildRelationIds:   []osm.RelationID{4},
+		ParentRelationIds:  []osm.RelationID{5, 6},
+		NodeRoles:          []string{"label"},
+		WayRoles:           []string{"outer", ""},
+		ChildRelationRoles: []string{"subarea"},
+	}
+	data := make([]byte, relation.Size())
+
+	// Act
+	err := relation.Encode(data)
+	record := RelationRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, relation.Size(), record.Size())
+	common.AssertEqual(t, relation.ID, record.ID())
+	common.AssertEqual(t, relation.Bbox, record.Bbox())
+	keys, values := record.Tags()
+	common.AssertEqual(t, relation.Keys, keys)
+	common.AssertEqual(t, relation.Values, values)
+	common.AssertEqual(t, relation.NodeIds, record.NodeIds())
+	common.AssertEqual(t, relation.WayIds, record.WayIds())
+	common.AssertEqual(t, relation.ChildRelationIds, record.ChildRelationIds())
+	common.AssertEqual(t, relation.ParentRelationIds, record.ParentRelationIds())
+	nodeRoles, wayRoles, childRelationRoles := record.Roles()
+	common.AssertEqual(t, relation.NodeRoles, nodeRoles)
+	common.AssertEqual(t, relation.WayRoles, wayRoles)
+	common.AssertEqual(t, relation.ChildRelationRoles, childRelationRoles)
+	common.AssertEqual(t, []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjWay, ownOsm.OsmObjRelation}, record.MemberTypes())
+}
+
+func TestRelation_encodeAndDecodeMemberOrder(t *testing.T) {
+	// Arrange
+	relation := &Relation{
+		ID:          123,
+		NodeIds:     []osm.NodeID{1, 2},
+		WayIds:      []osm.WayID{3},
+		NodeRoles:   []string{"stop", "stop"},
+		WayRoles:    []string{""},
+		MemberTypes: []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjNode},
+	}
+	data := make([]byte, relation.Size())
+
+	// Act
+	err := relation.Encode(data)
+	record := RelationRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, relation.Size(), record.Size())
+	common.AssertEqual(t, relation.MemberTypes, record.MemberTypes())
+	common.AssertEqual(t, relation.NodeIds, record.NodeIds())
+	common.AssertEqual(t, relation.WayIds, record.WayIds())
+}
+
+func TestRelation_encodeWithWrongMemberTypes(t *testing.T) {
+	// Arrange
+	relation := &Relation{
+		ID:          123,
+		NodeIds:     []osm.NodeID{1, 2},
+		NodeRoles:   []string{"", ""},
+		MemberTypes: []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay},
+	}
+	data := make([]byte, relation.Size())
+
+	// Act
+	err := relation.Encode(data)
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestRelation_sizeFromHeaderOnly(t *testing.T) {
+	// Arrange
+	relation := &Relation{
+		ID:        1,
+		WayIds:    []osm.WayID{2},
+		WayRoles:  []string{"inner"},
+		Keys:      []int{},
+		Values:    []int{},
+		NodeRoles: []string{},
+	}
+	data := make([]byte, relation.Size())
+	common.AssertNil(t, relation.Encode(data))
+
+	// Act
+	size := RelationRecord(data[:RelationHeaderBytes]).Size()
+
+	// Assert
+	common.AssertEqual(t, 39+8+6+1, size)
+}
@@ -0,0 +1,42 @@
+package encoding
+
+// maxRoleLength is the maximum number of bytes of a stored role. Longer roles are truncated, which doesn't happen for
+// any real-world role.
+const maxRoleLength = 255
+
+// GetEncodedRolesSize returns the number of bytes EncodeRoles needs to store all given roles.
+func GetEncodedRolesSize(roleLists ...[]string) int {
+	size := 0
+	for _, roles := range roleLists {
+		for _, role := range roles {
+			size += 1 + min(len(role), maxRoleLength)
+		}
+	}
+	return size
+}
+
+// EncodeRoles writes the given roles into the data slice and returns the number of written bytes. Each role is stored
+// as one byte for its length followed by the bytes of the role itself.
+func EncodeRoles(data []byte, roles []string) int {
+	pos := 0
+	for _, role := range roles {
+		roleLength := min(len(role), maxRoleLength)
+		data[pos] = byte(roleLength)
+		copy(data[pos+1:], role[:roleLength])
+		pos += 1 + roleLength
+	}
+	return pos
+}
+
+// DecodeRoles reads the given number of roles, which have been written by EncodeRoles, from the data slice. It returns
+// the roles and the number of read bytes.
+func DecodeRoles(data []byte, numberOfRoles int) ([]string, int) {
+	roles := make([]string, numberOfRoles)
+	pos := 0
+	for i := 0; i < numberOfRoles; i++ {
+		roleLength := int(data[pos])
+		roles[i] = string(data[pos+1 : pos+1+roleLength])
+		pos += 1 + roleLength
+	}
+	return roles, pos
+}
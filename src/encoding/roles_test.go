@@ -0,0 +1,36 @@
+package encoding
+
+import (
+	"soq/common"
+	"strings"
+	"testing"
+)
+
+func TestRoles_encodeAndDecode(t *testing.T) {
+	// Arrange
+	roles := []string{"outer", "", "inner"}
+	data := make([]byte, GetEncodedRolesSize(roles))
+
+	// Act
+	writtenBytes := EncodeRoles(data, roles)
+	decodedRoles, readBytes := DecodeRoles(data, len(roles))
+
+	// Assert
+	common.AssertEqual(t, 13, writtenBytes)
+	common.AssertEqual(t, 13, readBytes)
+	common.AssertEqual(t, roles, decodedRoles)
+}
+
+func TestRoles_truncateLongRoles(t *testing.T) {
+	// Arrange
+	roles := []string{strings.Repeat("a", 300)}
+	data := make([]byte, GetEncodedRolesSize(roles))
+
+	// Act
+	EncodeRoles(data, roles)
+	decodedRoles, readBytes := DecodeRoles(data, len(roles))
+
+	// Assert
+	common.AssertEqual(t, 256, readBytes)
+	common.AssertEqual(t, []string{strings.Repeat("a", 255)}, decodedRoles)
+}
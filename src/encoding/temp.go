@@ -0,0 +1,408 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	ownOsm "soq/osm"
+)
+
+/*
+	The temporary features are written during the first pass of the import and only contain the data available in the
+	OSM input file. Way and relation IDs of nodes, bboxes and parent relations are added when writing the cells.
+
+	Node:     | osmId | lon | lat | num. tags | flags | metadata | validity | encodedTags |
+	Bytes:    |   8   |  4  |  4  |     2     |   1   |  0 / 12  |  0 / 16  | <num. tags> * 8 |
+
+	Way:      | osmId | num. tags | num. nodes | flags | metadata | validity | encodedTags | nodes |
+	Bytes:    |   8   |     2     |      2     |   1   |  0 / 12  |  0 / 16  | <num. tags> * 8 | <num. nodes> * 16 |
+
+	Relation: | osmId | num. tags | num. nodes | num. ways | num. child rels | role bytes | flags | metadata | validity | encodedTags | node IDs | way IDs | child rel. IDs | roles | member types |
+	Bytes:    |   8   |     2     |      2     |     2     |        2        |      4     |   1   |  0 / 12  |  0 / 16  | <num. tags> * 8 | <num. nodes> * 8 | <num. ways> * 8 | <num. child rels> * 8 | <role bytes> | <num. members> * 1 |
+
+	The coordinates of nodes and way nodes are 32-bit fixed-point numbers with 7 decimal places, which is the precision
+	of OSM data. This way, the cell files can store them with any CoordinatePrecision. The encoding of the flags, metadata,
+	validity, tags, IDs, roles and member types is the same as in the cell files.
+*/
+
+const (
+	// TempNodeHeaderBytes is the number of bytes needed to determine the size of a temporary node record.
+	TempNodeHeaderBytes = 8 + 4 + 4 + 2 + 1 // = 19
+	// TempWayHeaderBytes is the number of bytes needed to determine the size of a temporary way record.
+	TempWayHeaderBytes = 8 + 2 + 2 + 1 // = 13
+	// TempRelationHeaderBytes is the number of bytes needed to determine the size of a temporary relation record.
+	TempRelationHeaderBytes = 8 + 2 + 2 + 2 + 2 + 4 + 1 // = 21
+)
+
+type TempNode struct {
+	ID     osm.NodeID
+	Point  orb.Point
+	Keys   []int
+	Values []int
+
+	// OSM metadata, which is only stored when HasMetadata is true. The user is the index in the user dictionary.
+	Changeset   uint64
+	User        int
+	HasMetadata bool
+
+	// Validity interval of this version as unix timestamps, which is only stored when HasValidity is true.
+	ValidFrom   int64
+	ValidTo     int64
+	HasValidity bool
+}
+
+func (n *TempNode) Size() int {
+	return TempNodeHeaderBytes + metadataSize(n.HasMetadata) + validitySize(n.HasValidity) + len(n.Keys)*tagBytes
+}
+
+// Encode writes the node into the given data slice, which must have at least Size() bytes.
+func (n *TempNode) Encode(data []byte) error {
+	if len(n.Keys) != len(n.Values) {
+		return errors.Errorf("Number of keys and values for node %d different: keys %d, values %d", n.ID, len(n.Keys), len(n.Values))
+	}
+
+	binary.LittleEndian.PutUint64(data[0:], uint64(n.ID))
+	putFixedPoint(data[8:], n.Point.Lon())
+	putFixedPoint(data[12:], n.Point.Lat())
+	putCount(data[16:], len(n.Keys))
+
+	data[18] = 0
+	pos := TempNodeHeaderBytes
+	if n.HasMetadata {
+		data[18] |= flagMetadata
+		pos += encodeMetadata(data[pos:], n.Changeset, n.User)
+	}
+	if n.HasValidity {
+		data[18] |= flagValidity
+		pos += encodeValidity(data[pos:], n.ValidFrom, n.ValidTo)
+	}
+
+	encodeTags(data[pos:], n.Keys, n.Values)
+
+	return nil
+}
+
+// TempNodeRecord is an encoded temporary node starting at the beginning of the slice.
+type TempNodeRecord []byte
+
+func (r TempNodeRecord) ID() uint64 {
+	return binary.LittleEndian.Uint64(r[0:])
+}
+
+func (r TempNodeRecord) Lon() float64 {
+	return getFixedPoint(r[8:])
+}
+
+func (r TempNodeRecord) Lat() float64 {
+	return getFixedPoint(r[12:])
+}
+
+// Metadata returns the changeset and the user index of the node. The third return value is false when the record
+// doesn't contain metadata.
+func (r TempNodeRecord) Metadata() (uint64, int, bool) {
+	if r[18]&flagMetadata == 0 {
+		return 0, 0, false
+	}
+	changeset, user := decodeMetadata(r[TempNodeHeaderBytes:])
+	return changeset, user, true
+}
+
+// Validity returns the start and end of the validity interval of the node version. The third return value is false
+// when the record doesn't contain a validity.
+func (r TempNodeRecord) Validity() (int64, int64, bool) {
+	if r[18]&flagValidity == 0 {
+		return 0, 0, false
+	}
+	validFrom, validTo := decodeValidity(r[r.validityPos():])
+	return validFrom, validTo, true
+}
+
+func (r TempNodeRecord) validityPos() int {
+	return TempNodeHeaderBytes + getMetadataBytes(r[18], flagMetadata)
+}
+
+func (r TempNodeRecord) tagsPos() int {
+	return r.validityPos() + getValidityBytes(r[18], flagValidity)
+}
+
+func (r TempNodeRecord) Tags() ([]int, []int) {
+	return decodeTags(r[r.tagsPos():], getCount(r[16:]))
+}
+
+// Size returns the number of bytes of this record. Only the first TempNodeHeaderBytes bytes are needed for this.
+func (r TempNodeRecord) Size() int {
+	return r.tagsPos() + getCount(r[16:])*tagBytes
+}
+
+type TempWay struct {
+	ID     osm.WayID
+	Keys   []int
+	Values []int
+	Nodes  osm.WayNodes
+
+	// OSM metadata, which is only stored when HasMetadata is true. The user is the index in the user dictionary.
+	Changeset   uint64
+	User        int
+	HasMetadata bool
+
+	// Validity interval of this version as unix timestamps, which is only stored when HasValidity is true.
+	ValidFrom   int64
+	ValidTo     int64
+	HasValidity bool
+}
+
+func (w *TempWay) Size() int {
+	return TempWayHeaderBytes + metadataSize(w.HasMetadata) + validitySize(w.HasValidity) + len(w.Keys)*tagBytes + len(w.Nodes)*wayNodeBytes
+}
+
+// Encode writes the way into the given data slice, which must have at least Size() bytes.
+func (w *TempWay) Encode(data []byte) error {
+	if len(w.Keys) != len(w.Values) {
+		return errors.Errorf("Number of keys and values for way %d different: keys %d, values %d", w.ID, len(w.Keys), len(w.Values))
+	}
+
+	binary.LittleEndian.PutUint64(data[0:], uint64(w.ID))
+	putCount(data[8:], len(w.Keys))
+	putCount(data[10:], len(w.Nodes))
+
+	data[12] = 0
+	pos := TempWayHeaderBytes
+	if w.HasMetadata {
+		data[12] |= flagMetadata
+		pos += encodeMetadata(data[pos:], w.Changeset, w.User)
+	}
+	if w.HasValidity {
+		data[12] |= flagValidity
+		pos += encodeValidity(data[pos:], w.ValidFrom, w.ValidTo)
+	}
+
+	pos += encodeTags(data[pos:], w.Keys, w.Values)
+	encodeWayNodes(data[pos:], w.Nodes)
+
+	return nil
+}
+
+// TempWayRecord is an encoded temporary way starting at the beginning of the slice.
+type TempWayRecord []byte
+
+func (r TempWayRecord) ID() uint64 {
+	return binary.LittleEndian.Uint64(r[0:])
+}
+
+// Metadata returns the changeset and the user index of the way. The third return value is false when the record
+// doesn't contain metadata.
+func (r TempWayRecord) Metadata() (uint64, int, bool) {
+	if r[12]&flagMetadata == 0 {
+		return 0, 0, false
+	}
+	changeset, user := decodeMetadata(r[TempWayHeaderBytes:])
+	return changeset, user, true
+}
+
+// Validity returns the start and end of the validity interval of the way version. The third return value is false
+// when the record doesn't contain a validity.
+func (r TempWayRecord) Validity() (int64, int64, bool) {
+	if r[12]&flagValidity == 0 {
+		return 0, 0, false
+	}
+	validFrom, validTo := decodeValidity(r[r.validityPos():])
+	return validFrom, validTo, true
+}
+
+func (r TempWayRecord) validityPos() int {
+	return TempWayHeaderBytes + getMetadataBytes(r[12], flagMetadata)
+}
+
+func (r TempWayRecord) tagsPos() int {
+	return r.validityPos() + getValidityBytes(r[12], flagValidity)
+}
+
+func (r TempWayRecord) Tags() ([]int, []int) {
+	return decodeTags(r[r.tagsPos():], getCount(r[8:]))
+}
+
+func (r TempWayRecord) Nodes() osm.WayNodes {
+	return decodeWayNodes(r[r.tagsPos()+getCount(r[8:])*tagBytes:], getCount(r[10:]))
+}
+
+// Size returns the number of bytes of this record. Only the first TempWayHeaderBytes bytes are needed for this.
+func (r TempWayRecord) Size() int {
+	return r.tagsPos() + getCount(r[8:])*tagBytes + getCount(r[10:])*wayNodeBytes
+}
+
+type TempRelation struct {
+	ID                 osm.RelationID
+	Keys               []int
+	Values             []int
+	NodeIds            []osm.NodeID
+	WayIds             []osm.WayID
+	ChildRelationIds   []osm.RelationID
+	NodeRoles          []string
+	WayRoles           []string
+	ChildRelationRoles []string
+	MemberTypes        []ownOsm.OsmObjectType
+
+	// OSM metadata, which is only stored when HasMetadata is true. The user is the index in the user dictionary.
+	Changeset   uint64
+	User        int
+	HasMetadata bool
+
+	// Validity interval of this version as unix timestamps, which is only stored when HasValidity is true.
+	ValidFrom   int64
+	ValidTo     int64
+	HasValidity bool
+}
+
+func (r *TempRelation) Size() int {
+	numberOfIds := len(r.NodeIds) + len(r.WayIds) + len(r.ChildRelationIds)
+	return TempRelationHeaderBytes + metadataSize(r.HasMetadata) + validitySize(r.HasValidity) + len(r.Keys)*tagBytes + numberOfIds*idBytes + r.roleBytes() + numberOfIds*memberBytes
+}
+
+func (r *TempRelation) roleBytes() int {
+	return GetEncodedRolesSize(r.NodeRoles, r.WayRoles, r.ChildRelationRoles)
+}
+
+// Encode writes the relation into the given data slice, which must have at least Size() bytes.
+func (r *TempRelation) Encode(data []byte) error {
+	if len(r.Keys) != len(r.Values) {
+		return errors.Errorf("Number of keys and values for relation %d different: keys %d, values %d", r.ID, len(r.Keys), len(r.Values))
+	}
+
+	memberTypes, err := getMemberTypes(r.MemberTypes, len(r.NodeIds), len(r.WayIds), len(r.ChildRelationIds))
+	if err != nil {
+		return errors.Wrapf(err, "Invalid members of relation %d", r.ID)
+	}
+
+	binary.LittleEndian.PutUint64(data[0:], uint64(r.ID))
+	putCount(data[8:], len(r.Keys))
+	putCount(data[10:], len(r.NodeIds))
+	putCount(data[12:], len(r.WayIds))
+	putCount(data[14:], len(r.ChildRelationIds))
+	binary.LittleEndian.PutUint32(data[16:], uint32(r.roleBytes()))
+
+	data[20] = 0
+	pos := TempRelationHeaderBytes
+	if r.HasMetadata {
+		data[20] |= flagMetadata
+		pos += encodeMetadata(data[pos:], r.Changeset, r.User)
+	}
+	if r.HasValidity {
+		data[20] |= flagValidity
+		pos += encodeValidity(data[pos:], r.ValidFrom, r.ValidTo)
+	}
+
+	pos += encodeTags(data[pos:], r.Keys, r.Values)
+	pos += encodeIds(data[pos:], r.NodeIds)
+	pos += encodeIds(data[pos:], r.WayIds)
+	pos += encodeIds(data[pos:], r.ChildRelationIds)
+	pos += EncodeRoles(data[pos:], r.NodeRoles)
+	pos += EncodeRoles(data[pos:], r.WayRoles)
+	pos += EncodeRoles(data[pos:], r.ChildRelationRoles)
+	encodeMemberTypes(data[pos:], memberTypes)
+
+	return nil
+}
+
+// TempRelationRecord is an encoded temporary relation starting at the beginning of the slice.
+type TempRelationRecord []byte
+
+func (r TempRelationRecord) ID() uint64 {
+	return binary.LittleEndian.Uint64(r[0:])
+}
+
+func (r TempRelationRecord) numberOfTags() int {
+	return getCount(r[8:])
+}
+
+func (r TempRelationRecord) numberOfNodeIds() int {
+	return getCount(r[10:])
+}
+
+func (r TempRelationRecord) numberOfWayIds() int {
+	return getCount(r[12:])
+}
+
+func (r TempRelationRecord) numberOfChildRelationIds() int {
+	return getCount(r[14:])
+}
+
+// Metadata returns the changeset and the user index of the relation. The third return value is false when the record
+// doesn't contain metadata.
+func (r TempRelationRecord) Metadata() (uint64, int, bool) {
+	if r[20]&flagMetadata == 0 {
+		return 0, 0, false
+	}
+	changeset, user := decodeMetadata(r[TempRelationHeaderBytes:])
+	return changeset, user, true
+}
+
+// Validity returns the start and end of the validity interval of the relation version. The third return value is false
+// when the record doesn't contain a validity.
+func (r TempRelationRecord) Validity() (int64, int64, bool) {
+	if r[20]&flagValidity == 0 {
+		return 0, 0, false
+	}
+	validFrom, validTo := decodeValidity(r[r.validityPos():])
+	return validFrom, validTo, true
+}
+
+func (r TempRelationRecord) validityPos() int {
+	return TempRelationHeaderBytes + getMetadataBytes(r[20], flagMetadata)
+}
+
+func (r TempRelationRecord) tagsPos() int {
+	return r.validityPos() + getValidityBytes(r[20], flagValidity)
+}
+
+func (r TempRelationRecord) Tags() ([]int, []int) {
+	return decodeTags(r[r.tagsPos():], r.numberOfTags())
+}
+
+func (r TempRelationRecord) nodeIdsPos() int {
+	return r.tagsPos() + r.numberOfTags()*tagBytes
+}
+
+func (r TempRelationRecord) NodeIds() []osm.NodeID {
+	return decodeIds[osm.NodeID](r[r.nodeIdsPos():], r.numberOfNodeIds())
+}
+
+func (r TempRelationRecord) WayIds() []osm.WayID {
+	pos := r.nodeIdsPos() + r.numberOfNodeIds()*idBytes
+	return decodeIds[osm.WayID](r[pos:], r.numberOfWayIds())
+}
+
+func (r TempRelationRecord) ChildRelationIds() []osm.RelationID {
+	pos := r.nodeIdsPos() + (r.numberOfNodeIds()+r.numberOfWayIds())*idBytes
+	return decodeIds[osm.RelationID](r[pos:], r.numberOfChildRelationIds())
+}
+
+// Roles returns the roles of the node, way and child relation members.
+func (r TempRelationRecord) Roles() ([]string, []string, []string) {
+	pos := r.nodeIdsPos() + (r.numberOfNodeIds()+r.numberOfWayIds()+r.numberOfChildRelationIds())*idBytes
+	nodeRoles, roleBytes := DecodeRoles(r[pos:], r.numberOfNodeIds())
+	pos += roleBytes
+	wayRoles, roleBytes := DecodeRoles(r[pos:], r.numberOfWayIds())
+	pos += roleBytes
+	childRelationRoles, _ := DecodeRoles(r[pos:], r.numberOfChildRelationIds())
+	return nodeRoles, wayRoles, childRelationRoles
+}
+
+func (r TempRelationRecord) numberOfMembers() int {
+	return r.numberOfNodeIds() + r.numberOfWayIds() + r.numberOfChildRelationIds()
+}
+
+func (r TempRelationRecord) roleBytes() int {
+	return int(binary.LittleEndian.Uint32(r[16:]))
+}
+
+// MemberTypes returns the type of each member in the order of the OSM data.
+func (r TempRelationRecord) MemberTypes() []ownOsm.OsmObjectType {
+	pos := r.nodeIdsPos() + r.numberOfMembers()*idBytes + r.roleBytes()
+	return decodeMemberTypes(r[pos:], r.numberOfMembers())
+}
+
+// Size returns the number of bytes of this record. Only the first TempRelationHeaderBytes bytes are needed for this.
+func (r TempRelationRecord) Size() int {
+	return r.nodeIdsPos() + r.numberOfMembers()*(idBytes+memberBytes) + r.roleBytes()
+}
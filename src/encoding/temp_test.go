@@ -0,0 +1,92 @@
+package encoding
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"soq/common"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func TestTempNode_encodeAndDecode(t *testing.T) {
+	// Arrange
+	node := &TempNode{ID: 123, Point: orb.Point{1.5, -2.5}, Keys: []int{1, 2}, Values: []int{3, 4}}
+	data := make([]byte, node.Size())
+
+	// Act
+	err := node.Encode(data)
+	record := TempNodeRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 19+2*8, node.Size())
+	common.AssertEqual(t, node.Size(), TempNodeRecord(data[:TempNodeHeaderBytes]).Size())
+	common.AssertEqual(t, uint64(123), record.ID())
+	common.AssertEqual(t, 1.5, record.Lon())
+	common.AssertEqual(t, -2.5, record.Lat())
+	keys, values := record.Tags()
+	common.AssertEqual(t, node.Keys, keys)
+	common.AssertEqual(t, node.Values, values)
+}
+
+func TestTempWay_encodeAndDecode(t *testing.T) {
+	// Arrange
+	way := &TempWay{
+		ID:     123,
+		Keys:   []int{1},
+		Values: []int{3},
+		Nodes:  osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}, {ID: 2, Lon: 3, Lat: 4}},
+	}
+	data := make([]byte, way.Size())
+
+	// Act
+	err := way.Encode(data)
+	record := TempWayRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 13+8+2*16, way.Size())
+	common.AssertEqual(t, way.Size(), TempWayRecord(data[:TempWayHeaderBytes]).Size())
+	common.AssertEqual(t, uint64(123), record.ID())
+	keys, values := record.Tags()
+	common.AssertEqual(t, way.Keys, keys)
+	common.AssertEqual(t, way.Values, values)
+	common.AssertEqual(t, way.Nodes, record.Nodes())
+}
+
+func TestTempRelation_encodeAndDecode(t *testing.T) {
+	// Arrange
+	relation := &TempRelation{
+		ID:                 123,
+		Keys:               []int{1},
+		Values:             []int{3},
+		NodeIds:            []osm.NodeID{1, 2},
+		WayIds:             []osm.WayID{3},
+		ChildRelationIds:   []osm.RelationID{4},
+		NodeRoles:          []string{"stop", "platform"},
+		WayRoles:           []string{""},
+		ChildRelationRoles: []string{"subarea"},
+		MemberTypes:        []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjRelation, ownOsm.OsmObjNode},
+	}
+	data := make([]byte, relation.Size())
+
+	// Act
+	err := relation.Encode(data)
+	record := TempRelationRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, relation.Size(), TempRelationRecord(data[:TempRelationHeaderBytes]).Size())
+	common.AssertEqual(t, uint64(123), record.ID())
+	keys, values := record.Tags()
+	common.AssertEqual(t, relation.Keys, keys)
+	common.AssertEqual(t, relation.Values, values)
+	common.AssertEqual(t, relation.NodeIds, record.NodeIds())
+	common.AssertEqual(t, relation.WayIds, record.WayIds())
+	common.AssertEqual(t, relation.ChildRelationIds, record.ChildRelationIds())
+	nodeRoles, wayRoles, childRelationRoles := record.Roles()
+	common.AssertEqual(t, relation.NodeRoles, nodeRoles)
+	common.AssertEqual(t, relation.WayRoles, wayRoles)
+	common.AssertEqual(t, relation.ChildRelationRoles, childRelationRoles)
+	common.AssertEqual(t, relation.MemberTypes, record.MemberTypes())
+}
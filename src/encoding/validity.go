@@ -0,0 +1,50 @@
+package encoding
+
+import (
+	"encoding/binary"
+)
+
+/*
+	The validity of an object version is only stored when the record has the validity flag set (nodeFlagValidity for
+	nodes and flagValidity for all other records). It follows the metadata section:
+
+	Names: | valid from | valid to |
+	Bytes: |      8     |     8    |
+
+	Both are unix timestamps in seconds. The version is valid from (inclusive) its own timestamp until (exclusive) the
+	timestamp of the next version or the deletion of the object. Versions still valid at the end of the history have
+	math.MaxInt64 as end.
+*/
+
+const (
+	flagValidity = 1 << 1 // The record contains the validity interval of the object version (ways, relations and temp. records).
+
+	validityBytes = 8 + 8 // start and end as 64-bit unix timestamps
+)
+
+// encodeValidity writes the start and end of the validity interval and returns the number of written bytes.
+func encodeValidity(data []byte, validFrom int64, validTo int64) int {
+	binary.LittleEndian.PutUint64(data[0:], uint64(validFrom))
+	binary.LittleEndian.PutUint64(data[8:], uint64(validTo))
+	return validityBytes
+}
+
+func decodeValidity(data []byte) (int64, int64) {
+	return int64(binary.LittleEndian.Uint64(data[0:])), int64(binary.LittleEndian.Uint64(data[8:]))
+}
+
+// validitySize returns the number of bytes of the validity section of a record to encode.
+func validitySize(hasValidity bool) int {
+	if hasValidity {
+		return validityBytes
+	}
+	return 0
+}
+
+// getValidityBytes returns the number of bytes of the validity section of an encoded record with the given flags.
+func getValidityBytes(flags byte, validityFlag byte) int {
+	if flags&validityFlag != 0 {
+		return validityBytes
+	}
+	return 0
+}
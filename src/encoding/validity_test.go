@@ -0,0 +1,145 @@
+package encoding
+
+import (
+	"github.com/paulmach/osm"
+	"math"
+	"soq/common"
+	"testing"
+)
+
+func TestNode_encodeAndDecodeWithValidity(t *testing.T) {
+	// Arrange
+	node := &Node{
+		ID:          123,
+		Keys:        []int{3},
+		Values:      []int{12},
+		WayIds:      []osm.WayID{10},
+		Changeset:   987654321,
+		User:        42,
+		HasMetadata: true,
+		ValidFrom:   1577836800,
+		ValidTo:     math.MaxInt64,
+		HasValidity: true,
+	}
+	data := make([]byte, node.Size())
+
+	// Act
+	err := node.Encode(data)
+	record := NodeRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 23+12+16+8+8, node.Size())
+	common.AssertEqual(t, node.Size(), NodeRecord(data[:NodeHeaderBytes]).Size())
+	validFrom, validTo, hasValidity := record.Validity()
+	common.AssertTrue(t, hasValidity)
+	common.AssertEqual(t, node.ValidFrom, validFrom)
+	common.AssertEqual(t, node.ValidTo, validTo)
+	changeset, _, _ := record.Metadata()
+	common.AssertEqual(t, node.Changeset, changeset)
+	keys, values := record.Tags()
+	common.AssertEqual(t, node.Keys, keys)
+	common.AssertEqual(t, node.Values, values)
+	common.AssertEqual(t, node.WayIds, record.WayIds())
+}
+
+func TestWayAndRelation_encodeAndDecodeWithValidity(t *testing.T) {
+	// Arrange
+	way := &Way{
+		ID:          1,
+		Keys:        []int{3},
+		Values:      []int{4},
+		Nodes:       osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}, {ID: 2, Lon: 1.5, Lat: 2.5}},
+		RelationIds: []osm.RelationID{5},
+		ValidFrom:   100,
+		ValidTo:     200,
+		HasValidity: true,
+	}
+	relation := &Relation{
+		ID:          5,
+		Keys:        []int{3},
+		Values:      []int{4},
+		WayIds:      []osm.WayID{1},
+		WayRoles:    []string{"outer"},
+		Changeset:   12,
+		User:        8,
+		HasMetadata: true,
+		ValidFrom:   300,
+		ValidTo:     400,
+		HasValidity: true,
+	}
+	wayData := make([]byte, way.Size())
+	relationData := make([]byte, relation.Size())
+
+	// Act
+	wayErr := way.Encode(wayData)
+	relationErr := relation.Encode(relationData)
+	wayRecord := WayRecord(wayData)
+	relationRecord := RelationRecord(relationData)
+
+	// Assert
+	common.AssertNil(t, wayErr)
+	common.AssertNil(t, relationErr)
+
+	common.AssertEqual(t, way.Size(), WayRecord(wayData[:WayHeaderBytes]).Size())
+	validFrom, validTo, hasValidity := wayRecord.Validity()
+	common.AssertTrue(t, hasValidity)
+	common.AssertEqual(t, way.ValidFrom, validFrom)
+	common.AssertEqual(t, way.ValidTo, validTo)
+	_, _, hasMetadata := wayRecord.Metadata()
+	common.AssertFalse(t, hasMetadata)
+	common.AssertEqual(t, way.Nodes, wayRecord.Nodes())
+	common.AssertEqual(t, way.RelationIds, wayRecord.RelationIds())
+
+	common.AssertEqual(t, relation.Size(), RelationRecord(relationData[:RelationHeaderBytes]).Size())
+	validFrom, validTo, hasValidity = relationRecord.Validity()
+	common.AssertTrue(t, hasValidity)
+	common.AssertEqual(t, relation.ValidFrom, validFrom)
+	common.AssertEqual(t, relation.ValidTo, validTo)
+	changeset, user, _ := relationRecord.Metadata()
+	common.AssertEqual(t, relation.Changeset, changeset)
+	common.AssertEqual(t, relation.User, user)
+	common.AssertEqual(t, relation.WayIds, relationRecord.WayIds())
+	_, wayRoles, _ := relationRecord.Roles()
+	common.AssertEqual(t, relation.WayRoles, wayRoles)
+}
+
+func TestTempRecords_encodeAndDecodeWithValidity(t *testing.T) {
+	// Arrange
+	node := &TempNode{ID: 1, Keys: []int{1}, Values: []int{2}, ValidFrom: 10, ValidTo: 20, HasValidity: true}
+	way := &TempWay{ID: 2, Keys: []int{1}, Values: []int{2}, Nodes: osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}}, Changeset: 22, User: 4, HasMetadata: true, ValidFrom: 30, ValidTo: 40, HasValidity: true}
+	relation := &TempRelation{ID: 3, Keys: []int{1}, Values: []int{2}, NodeIds: []osm.NodeID{1}, NodeRoles: []string{"stop"}, ValidFrom: 50, ValidTo: 60, HasValidity: true}
+	nodeData := make([]byte, node.Size())
+	wayData := make([]byte, way.Size())
+	relationData := make([]byte, relation.Size())
+
+	// Act
+	common.AssertNil(t, node.Encode(nodeData))
+	common.AssertNil(t, way.Encode(wayData))
+	common.AssertNil(t, relation.Encode(relationData))
+
+	// Assert
+	common.AssertEqual(t, node.Size(), TempNodeRecord(nodeData[:TempNodeHeaderBytes]).Size())
+	validFrom, validTo, hasValidity := TempNodeRecord(nodeData).Validity()
+	common.AssertTrue(t, hasValidity)
+	common.AssertEqual(t, node.ValidFrom, validFrom)
+	common.AssertEqual(t, node.ValidTo, validTo)
+	keys, _ := TempNodeRecord(nodeData).Tags()
+	common.AssertEqual(t, node.Keys, keys)
+
+	common.AssertEqual(t, way.Size(), TempWayRecord(wayData[:TempWayHeaderBytes]).Size())
+	validFrom, validTo, hasValidity = TempWayRecord(wayData).Validity()
+	common.AssertTrue(t, hasValidity)
+	common.AssertEqual(t, way.ValidFrom, validFrom)
+	common.AssertEqual(t, way.ValidTo, validTo)
+	changeset, _, _ := TempWayRecord(wayData).Metadata()
+	common.AssertEqual(t, way.Changeset, changeset)
+	common.AssertEqual(t, way.Nodes, TempWayRecord(wayData).Nodes())
+
+	common.AssertEqual(t, relation.Size(), TempRelationRecord(relationData[:TempRelationHeaderBytes]).Size())
+	validFrom, validTo, hasValidity = TempRelationRecord(relationData).Validity()
+	common.AssertTrue(t, hasValidity)
+	common.AssertEqual(t, relation.ValidFrom, validFrom)
+	common.AssertEqual(t, relation.ValidTo, validTo)
+	common.AssertEqual(t, relation.NodeIds, TempRelationRecord(relationData).NodeIds())
+}
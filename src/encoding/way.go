@@ -0,0 +1,166 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+/*
+	Way record format of the cell files:
+
+	Names: | osmId | bbox | num. tags | num. nodes | num. rels | node bytes | flags | metadata | validity |          encodedTags          |     nodes    |       rels      |
+	Bytes: |   8   |  16  |     2     |      2     |     2     |      4     |   1   |  0 / 12  |  0 / 16  | key (32 bit) | value (32 bit) | <node bytes> | <num. rels> * 8 |
+
+	The "bbox" field contains the min-lon, min-lat, max-lon and max-lat of all nodes as 32-bit fixed-point numbers (s.
+	coordinateFactor), so it's exactly the bbox of the decoded nodes. This allows skipping ways outside a query bbox
+	without decoding their nodes.
+
+	The flags are a bit-field, the metadata (s. encodeMetadata) only exists when the flagMetadata bit is set and the
+	validity (s. encodeValidity) only when the flagValidity bit is set.
+
+	Tags are stored as a list of "num. tags" many key-value-pairs.
+
+	The nodes section contains all nodes, not only the ones within this cell. This enables geometric checks, even
+	in cases where no way-node is within this cell. Each node is stored as three varints (s. encoding/binary) of the
+	difference to the previous node (the first node is stored as difference to 0):
+	<id><lon><lat>
+	The coordinates are fixed-point numbers with 7 decimal places. Since consecutive nodes are close to each other and
+	often have similar IDs, most nodes need 5 to 8 bytes instead of 16 bytes with absolute values.
+*/
+
+// WayHeaderBytes is the number of bytes needed to determine the size of a way record.
+const WayHeaderBytes = 8 + bboxBytes + 2 + 2 + 2 + 4 + 1 // = 35
+
+type Way struct {
+	ID          uint64
+	Keys        []int
+	Values      []int
+	Nodes       osm.WayNodes
+	RelationIds []osm.RelationID
+
+	// OSM metadata, which is only stored when HasMetadata is true. The user is the index in the user dictionary.
+	Changeset   uint64
+	User        int
+	HasMetadata bool
+
+	// Validity interval of this version as unix timestamps, which is only stored when HasValidity is true.
+	ValidFrom   int64
+	ValidTo     int64
+	HasValidity bool
+}
+
+// Size returns the number of bytes of the encoded way.
+func (w *Way) Size() int {
+	return WayHeaderBytes + metadataSize(w.HasMetadata) + validitySize(w.HasValidity) + len(w.Keys)*tagBytes + deltaWayNodesSize(w.Nodes) + len(w.RelationIds)*idBytes
+}
+
+// Encode writes the way into the given data slice, which must have at least Size() bytes.
+func (w *Way) Encode(data []byte) error {
+	if len(w.Keys) != len(w.Values) {
+		return errors.Errorf("Number of keys and values for way %d different: keys %d, values %d", w.ID, len(w.Keys), len(w.Values))
+	}
+
+	binary.LittleEndian.PutUint64(data[0:], w.ID)
+	encodeWayNodesBbox(data[8:], w.Nodes)
+	putCount(data[24:], len(w.Keys))
+	putCount(data[26:], len(w.Nodes))
+	putCount(data[28:], len(w.RelationIds))
+
+	data[34] = 0
+	pos := WayHeaderBytes
+	if w.HasMetadata {
+		data[34] |= flagMetadata
+		pos += encodeMetadata(data[pos:], w.Changeset, w.User)
+	}
+	if w.HasValidity {
+		data[34] |= flagValidity
+		pos += encodeValidity(data[pos:], w.ValidFrom, w.ValidTo)
+	}
+
+	pos += encodeTags(data[pos:], w.Keys, w.Values)
+	nodeBytes := encodeDeltaWayNodes(data[pos:], w.Nodes)
+	binary.LittleEndian.PutUint32(data[30:], uint32(nodeBytes))
+	pos += nodeBytes
+	encodeIds(data[pos:], w.RelationIds)
+
+	return nil
+}
+
+// WayRecord is an encoded way starting at the beginning of the slice. Only the requested fields are decoded.
+type WayRecord []byte
+
+func (r WayRecord) ID() uint64 {
+	return binary.LittleEndian.Uint64(r[0:])
+}
+
+// Bbox returns the bbox of the nodes of the way without decoding them.
+func (r WayRecord) Bbox() orb.Bound {
+	return decodeFixedPointBbox(r[8:])
+}
+
+func (r WayRecord) numberOfTags() int {
+	return getCount(r[24:])
+}
+
+func (r WayRecord) numberOfNodes() int {
+	return getCount(r[26:])
+}
+
+func (r WayRecord) numberOfRelationIds() int {
+	return getCount(r[28:])
+}
+
+func (r WayRecord) numberOfNodeBytes() int {
+	return int(binary.LittleEndian.Uint32(r[30:]))
+}
+
+// Metadata returns the changeset and the user index of the way. The third return value is false when the record
+// doesn't contain metadata.
+func (r WayRecord) Metadata() (uint64, int, bool) {
+	if r[34]&flagMetadata == 0 {
+		return 0, 0, false
+	}
+	changeset, user := decodeMetadata(r[WayHeaderBytes:])
+	return changeset, user, true
+}
+
+// Validity returns the start and end of the validity interval of the way version. The third return value is false
+// when the record doesn't contain a validity.
+func (r WayRecord) Validity() (int64, int64, bool) {
+	if r[34]&flagValidity == 0 {
+		return 0, 0, false
+	}
+	validFrom, validTo := decodeValidity(r[r.validityPos():])
+	return validFrom, validTo, true
+}
+
+func (r WayRecord) validityPos() int {
+	return WayHeaderBytes + getMetadataBytes(r[34], flagMetadata)
+}
+
+func (r WayRecord) tagsPos() int {
+	return r.validityPos() + getValidityBytes(r[34], flagValidity)
+}
+
+// Tags returns the keys and values of the way.
+func (r WayRecord) Tags() ([]int, []int) {
+	return decodeTags(r[r.tagsPos():], r.numberOfTags())
+}
+
+func (r WayRecord) Nodes() osm.WayNodes {
+	pos := r.tagsPos() + r.numberOfTags()*tagBytes
+	return decodeDeltaWayNodes(r[pos:pos+r.numberOfNodeBytes()], r.numberOfNodes())
+}
+
+func (r WayRecord) RelationIds() []osm.RelationID {
+	pos := r.tagsPos() + r.numberOfTags()*tagBytes + r.numberOfNodeBytes()
+	return decodeIds[osm.RelationID](r[pos:], r.numberOfRelationIds())
+}
+
+// Size returns the number of bytes of this record. Only the header is needed for this, so the slice might end before
+// the end of the record.
+func (r WayRecord) Size() int {
+	return r.tagsPos() + r.numberOfTags()*tagBytes + r.numberOfNodeBytes() + r.numberOfRelationIds()*idBytes
+}
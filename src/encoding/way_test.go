@@ -0,0 +1,98 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"math"
+	"soq/common"
+	"testing"
+)
+
+func TestWay_encodeAndDecode(t *testing.T) {
+	// Arrange
+	way := &Way{
+		ID:     123,
+		Keys:   []int{3},
+		Values: []int{5},
+		Nodes: osm.WayNodes{
+			{ID: 1, Lon: 1.5, Lat: 2.5},
+			{ID: 2, Lon: -1.25, Lat: 0.75},
+		},
+		RelationIds: []osm.RelationID{20, 21},
+	}
+	data := make([]byte, way.Size())
+
+	// Act
+	err := way.Encode(data)
+	record := WayRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	// Each node needs 1 byte for the ID delta and 4 bytes for each coordinate
+	common.AssertEqual(t, 35+8+2*9+2*8, way.Size())
+	common.AssertEqual(t, way.Size(), record.Size())
+	common.AssertEqual(t, way.ID, record.ID())
+	keys, values := record.Tags()
+	common.AssertEqual(t, way.Keys, keys)
+	common.AssertEqual(t, way.Values, values)
+	common.AssertEqual(t, way.Nodes, record.Nodes())
+	common.AssertEqual(t, way.RelationIds, record.RelationIds())
+	common.AssertEqual(t, orb.Bound{Min: orb.Point{-1.25, 0.75}, Max: orb.Point{1.5, 2.5}}, record.Bbox())
+}
+
+func TestWay_multipleRecords(t *testing.T) {
+	// Arrange
+	firstWay := &Way{ID: 1, Keys: []int{1}, Values: []int{1}, Nodes: osm.WayNodes{{ID: 5, Lon: 1, Lat: 2}}}
+	secondWay := &Way{ID: 2, Keys: []int{}, Values: []int{}, Nodes: osm.WayNodes{{ID: 6, Lon: 3, Lat: 4}}}
+	data := make([]byte, firstWay.Size()+secondWay.Size())
+	common.AssertNil(t, firstWay.Encode(data))
+	common.AssertNil(t, secondWay.Encode(data[firstWay.Size():]))
+
+	// Act
+	firstRecord := WayRecord(data)
+	secondRecord := WayRecord(data[firstRecord.Size():])
+
+	// Assert
+	common.AssertEqual(t, uint64(1), firstRecord.ID())
+	common.AssertEqual(t, uint64(2), secondRecord.ID())
+	common.AssertEqual(t, secondWay.Nodes, secondRecord.Nodes())
+}
+
+func TestWay_encodeAndDecode_deltaEncodedNodes(t *testing.T) {
+	// Arrange
+	way := &Way{
+		ID:     1,
+		Keys:   []int{},
+		Values: []int{},
+		Nodes: osm.WayNodes{
+			{ID: 4000000001, Lon: 9.9876543, Lat: 53.5512345},
+			{ID: 4000000002, Lon: 9.9877001, Lat: 53.5512999},
+			{ID: 3999999990, Lon: 9.9875, Lat: 53.5511},
+			{ID: 12, Lon: -179.9999999, Lat: -89.9999999},
+		},
+	}
+	data := make([]byte, way.Size())
+
+	// Act
+	err := way.Encode(data)
+	record := WayRecord(data)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, way.Size(), record.Size())
+	common.AssertEqual(t, way.Nodes, record.Nodes())
+	// The second and third node are close to their predecessor and need 5 instead of 16 bytes
+	common.AssertEqual(t, 2*5, deltaWayNodesSize(way.Nodes[:3])-deltaWayNodesSize(way.Nodes[:1]))
+}
+
+func TestVarintSize(t *testing.T) {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	for _, value := range []int64{0, 1, -1, 63, -64, 64, -65, 8191, 8192, 1800000000, -1800000000, math.MaxInt64, math.MinInt64} {
+		// Act
+		size := varintSize(value)
+
+		// Assert
+		common.AssertEqual(t, binary.PutVarint(buffer, value), size)
+	}
+}
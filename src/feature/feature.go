@@ -3,6 +3,9 @@ package feature
 import (
 	"github.com/paulmach/orb"
 	"github.com/paulmach/osm"
+	"math"
+	ownOsm "soq/osm"
+	"time"
 )
 
 type Feature interface {
@@ -15,13 +18,68 @@ type Feature interface {
 	HasKey(keyIndex int) bool
 	GetValueIndex(keyIndex int) int
 	HasTag(keyIndex int, valueIndex int) bool
+	// GetMetadata returns nil when the index doesn't contain the metadata of the feature.
+	GetMetadata() *Metadata
+	// GetValidity returns nil when the index doesn't contain the history of the data.
+	GetValidity() *Validity
 	Print()
 }
 
+// Metadata contains the OSM metadata of a feature, which is only stored when the data has been imported with the
+// metadata option.
+type Metadata struct {
+	Changeset uint64
+	// Index of the user name in the user dictionary of the tag-index.
+	User int
+}
+
+// NewMetadata returns the metadata with the given changeset and user or nil when hasMetadata is false. This fits the
+// Metadata functions of the encoded records.
+func NewMetadata(changeset uint64, user int, hasMetadata bool) *Metadata {
+	if !hasMetadata {
+		return nil
+	}
+	return &Metadata{Changeset: changeset, User: user}
+}
+
+// ValidForever is the end of the validity of object versions that are still valid at the end of the history.
+const ValidForever = math.MaxInt64
+
+// Validity is the time interval in which a version of an OSM object was the current one. It only exists when the data
+// has been imported from a full-history file.
+type Validity struct {
+	// Unix timestamp of the version (inclusive).
+	From int64
+	// Unix timestamp of the next version or the deletion of the object (exclusive), ValidForever for current versions.
+	To int64
+}
+
+// NewValidity returns the validity with the given interval or nil when hasValidity is false. This fits the Validity
+// functions of the encoded records.
+func NewValidity(validFrom int64, validTo int64, hasValidity bool) *Validity {
+	if !hasValidity {
+		return nil
+	}
+	return &Validity{From: validFrom, To: validTo}
+}
+
+// IsValidAt returns true when the version was the current one at the given time. Without validity (nil), the feature
+// is always valid.
+func (v *Validity) IsValidAt(t time.Time) bool {
+	if v == nil {
+		return true
+	}
+	unixTime := t.Unix()
+	return v.From <= unixTime && unixTime < v.To
+}
+
 type NodeFeature interface {
 	Feature
 	GetLon() float64
 	GetLat() float64
+	// GetElevation returns the elevation in meters. The second return value is false when the node has no (valid)
+	// elevation.
+	GetElevation() (float64, bool)
 	GetWayIds() []osm.WayID
 	SetWayIds(wayIds []osm.WayID)
 	GetRelationIds() []osm.RelationID
@@ -40,7 +98,20 @@ type RelationFeature interface {
 	GetNodeIds() []osm.NodeID
 	GetWayIds() []osm.WayID
 	GetChildRelationIds() []osm.RelationID
+	GetNodeRoles() []string
+	GetWayRoles() []string
+	GetChildRelationRoles() []string
+	// GetMembers returns the node, way and child relation members in the order of the OSM data.
+	GetMembers() []RelationMember
 	GetParentRelationIds() []osm.RelationID
 	SetParentRelationIds(relationIds []osm.RelationID)
 	SetGeometry(geometry orb.Geometry)
 }
+
+// RelationMember is a single member of a relation. The order of the members is the one of the OSM data, which matters
+// e.g. for the stops of route relations.
+type RelationMember struct {
+	Type ownOsm.OsmObjectType
+	ID   uint64
+	Role string
+}
@@ -0,0 +1,12 @@
+package feature
+
+// FeatureIterator provides features one after another instead of all at once, which allows processing large results
+// without holding them in memory.
+type FeatureIterator interface {
+	// Next moves to the next feature and returns false when there are no more features or an error occurred.
+	Next() bool
+	// Feature returns the current feature. Only valid after Next returned true.
+	Feature() Feature
+	// Err returns the error that stopped the iteration or nil if all features have been read.
+	Err() error
+}
@@ -0,0 +1,47 @@
+package feature
+
+import (
+	"github.com/paulmach/osm"
+	"unsafe"
+)
+
+const (
+	// Rough per-object overhead of an encoded feature (struct, interface header, slice headers, geometry pointer).
+	featureBaseSizeInBytes = 96
+	wayNodeSizeInBytes     = int64(unsafe.Sizeof(osm.WayNode{}))
+	pointSizeInBytes       = 16
+	idSizeInBytes          = 8
+)
+
+// EstimateSize returns the approximate amount of bytes the given feature occupies in memory. This is not
+// accurate but good enough to detect pathological queries.
+func EstimateSize(f Feature) int64 {
+	size := int64(featureBaseSizeInBytes)
+	size += int64(len(f.GetKeys())+len(f.GetValues())) * 8
+
+	switch typedFeature := f.(type) {
+	case NodeFeature:
+		size += pointSizeInBytes
+		size += int64(len(typedFeature.GetWayIds())+len(typedFeature.GetRelationIds())) * idSizeInBytes
+	case WayFeature:
+		numberOfNodes := int64(len(typedFeature.GetNodes()))
+		size += numberOfNodes * (wayNodeSizeInBytes + pointSizeInBytes) // Way nodes and the LineString geometry
+		size += int64(len(typedFeature.GetRelationIds())) * idSizeInBytes
+	case RelationFeature:
+		size += 5 * pointSizeInBytes // Bbox polygon
+		size += int64(len(typedFeature.GetNodeIds())+len(typedFeature.GetWayIds())+len(typedFeature.GetChildRelationIds())+len(typedFeature.GetParentRelationIds())) * idSizeInBytes
+	}
+
+	return size
+}
+
+// EstimateSizes returns the approximate amount of bytes all given features occupy in memory, s. EstimateSize.
+func EstimateSizes(features []Feature) int64 {
+	var size int64
+	for _, f := range features {
+		if f != nil {
+			size += EstimateSize(f)
+		}
+	}
+	return size
+}
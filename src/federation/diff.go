@@ -0,0 +1,125 @@
+package federation
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"hash/fnv"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"sort"
+)
+
+// DiffEntry identifies an OSM object in the report of a diff.
+type DiffEntry struct {
+	Type string `json:"type"`
+	ID   uint64 `json:"id"`
+}
+
+// DiffReport contains the objects of the query result that differ between two indices, each list is sorted by type and
+// ID.
+type DiffReport struct {
+	// Objects only contained in the result of the new index.
+	Added []DiffEntry `json:"added"`
+	// Objects only contained in the result of the old index.
+	Removed []DiffEntry `json:"removed"`
+	// Objects contained in both results but with different tags.
+	Changed []DiffEntry `json:"changed"`
+}
+
+type diffKey struct {
+	objectType ownOsm.OsmObjectType
+	id         uint64
+}
+
+// Diff executes the query on the old and the new index and compares the results by the IDs and tags of the objects.
+// Changes of the geometry only are not detected.
+func Diff(queryString string, oldIndex *NamedIndex, newIndex *NamedIndex, memoryLimit int64, settings common.Settings) (*DiffReport, error) {
+	oldTagHashes, err := getTagHashesOfResult(queryString, oldIndex, memoryLimit, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	newTagHashes, err := getTagHashesOfResult(queryString, newIndex, memoryLimit, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{
+		Added:   []DiffEntry{},
+		Removed: []DiffEntry{},
+		Changed: []DiffEntry{},
+	}
+	for key, newTagHash := range newTagHashes {
+		oldTagHash, existedBefore := oldTagHashes[key]
+		if !existedBefore {
+			report.Added = append(report.Added, key.toEntry())
+		} else if oldTagHash != newTagHash {
+			report.Changed = append(report.Changed, key.toEntry())
+		}
+	}
+	for key := range oldTagHashes {
+		if _, stillExists := newTagHashes[key]; !stillExists {
+			report.Removed = append(report.Removed, key.toEntry())
+		}
+	}
+
+	sortDiffEntries(report.Added)
+	sortDiffEntries(report.Removed)
+	sortDiffEntries(report.Changed)
+
+	sigolo.Infof("Found %d added, %d removed and %d changed objects", len(report.Added), len(report.Removed), len(report.Changed))
+
+	return report, nil
+}
+
+// getTagHashesOfResult executes the query on the index and returns the tag hash of each object of the result.
+func getTagHashesOfResult(queryString string, namedIndex *NamedIndex, memoryLimit int64, settings common.Settings) (map[diffKey]uint64, error) {
+	_, features, err := executeOnIndex(queryString, namedIndex, memoryLimit, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	tagHashes := map[diffKey]uint64{}
+	for _, f := range features {
+		key := diffKey{objectType: getObjectType(f), id: f.GetID()}
+		tagHashes[key] = getTagHash(f, namedIndex.TagIndex)
+	}
+
+	return tagHashes, nil
+}
+
+// getTagHash returns a hash of the tags of the feature. The key and value indices differ between indices, so the hash
+// is calculated from the sorted key-value strings.
+func getTagHash(f feature.Feature, tagIndex *index.TagIndex) uint64 {
+	keys := f.GetKeys()
+	values := f.GetValues()
+
+	var tags []string
+	for i, key := range keys {
+		tags = append(tags, tagIndex.GetKeyFromIndex(key)+"="+tagIndex.GetValueForKey(key, values[i]))
+	}
+	sort.Strings(tags)
+
+	hash := fnv.New64a()
+	for _, tag := range tags {
+		// The zero byte separates the tags, it's not allowed within keys and values.
+		hash.Write([]byte(tag))
+		hash.Write([]byte{0})
+	}
+	return hash.Sum64()
+}
+
+func (k diffKey) toEntry() DiffEntry {
+	return DiffEntry{Type: k.objectType.String(), ID: k.id}
+}
+
+func sortDiffEntries(entries []DiffEntry) {
+	typeOrder := map[string]int{"node": 0, "way": 1, "relation": 2}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return typeOrder[entries[i].Type] < typeOrder[entries[j].Type]
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
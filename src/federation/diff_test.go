@@ -0,0 +1,36 @@
+package federation
+
+import (
+	"soq/common"
+	"soq/index"
+	"testing"
+)
+
+func TestGetTagHash(t *testing.T) {
+	// Arrange
+	oldTagIndex := index.NewTagIndex([]string{"amenity", "name"}, [][]string{{"bench", "cafe"}, {"Foo"}})
+	newTagIndex := index.NewTagIndex([]string{"name", "amenity"}, [][]string{{"Bar", "Foo"}, {"cafe"}})
+	oldFeature := &index.EncodedNodeFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Keys: []int{0, 1}, Values: []int{1, 0}}}
+	newFeature := &index.EncodedNodeFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Keys: []int{0, 1}, Values: []int{1, 0}}}
+	changedFeature := &index.EncodedNodeFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Keys: []int{0, 1}, Values: []int{0, 0}}}
+
+	// Act
+	oldHash := getTagHash(oldFeature, oldTagIndex)
+	newHash := getTagHash(newFeature, newTagIndex)
+	changedHash := getTagHash(changedFeature, newTagIndex)
+
+	// Assert
+	common.AssertEqual(t, oldHash, newHash)
+	common.AssertTrue(t, oldHash != changedHash)
+}
+
+func TestSortDiffEntries(t *testing.T) {
+	// Arrange
+	entries := []DiffEntry{{Type: "relation", ID: 1}, {Type: "node", ID: 5}, {Type: "way", ID: 2}, {Type: "node", ID: 3}}
+
+	// Act
+	sortDiffEntries(entries)
+
+	// Assert
+	common.AssertEqual(t, []DiffEntry{{Type: "node", ID: 3}, {Type: "node", ID: 5}, {Type: "way", ID: 2}, {Type: "relation", ID: 1}}, entries)
+}
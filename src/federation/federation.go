@@ -0,0 +1,162 @@
+package federation
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"soq/parser"
+	"soq/query"
+)
+
+// NamedIndicesFolder contains the named indices, each in a sub-folder with its name. They can be selected in queries
+// with "USING <name>, <name>, ...".
+const NamedIndicesFolder = "soq-indices"
+
+// NamedIndex is a loaded index from the folder of named indices.
+type NamedIndex struct {
+	Name          string
+	TagIndex      *index.TagIndex
+	GeometryIndex index.GeometryIndex
+}
+
+// Result contains the merged results of all indices of a federated query.
+type Result struct {
+	// One feature set per index in the order of the given indices, since each index has its own tag-index.
+	FeatureSets []index.FeatureSet
+	// Assertions are checked on the result of each index separately.
+	FailedAssertions []error
+}
+
+// GetNamedIndexFolder returns the folder of the index with the given name.
+func GetNamedIndexFolder(namedIndicesFolder string, name string) (string, error) {
+	if !parser.IsValidIndexName(name) {
+		return "", errors.Errorf("Invalid index name '%s', only letters and '_' are allowed", name)
+	}
+	return path.Join(namedIndicesFolder, name), nil
+}
+
+// LoadNamedIndices loads the indices with the given names from the folder of named indices.
+func LoadNamedIndices(namedIndicesFolder string, names []string, cellSize float64, checkFeatureValidity bool, settings common.Settings) ([]*NamedIndex, error) {
+	var namedIndices []*NamedIndex
+
+	for _, name := range names {
+		indexFolder, err := GetNamedIndexFolder(namedIndicesFolder, name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = os.Stat(indexFolder); errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrapf(index.ErrIndexMissing, "Index '%s' does not exist, import data with '--name %s' first", name, name)
+		}
+
+		namedIndex, err := LoadIndex(name, indexFolder, cellSize, checkFeatureValidity, settings)
+		if err != nil {
+			return nil, err
+		}
+		namedIndices = append(namedIndices, namedIndex)
+	}
+
+	return namedIndices, nil
+}
+
+// LoadIndex loads the index in the given folder. The name is only used in log and error messages.
+func LoadIndex(name string, indexFolder string, cellSize float64, checkFeatureValidity bool, settings common.Settings) (*NamedIndex, error) {
+	indexFolder, err := index.ResolveIndexFolder(indexFolder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to load index '%s'", name)
+	}
+
+	sigolo.Infof("Load index '%s' from %s", name, indexFolder)
+	tagIndex, err := index.LoadTagIndex(indexFolder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to load tag-index of index '%s'", name)
+	}
+
+	geometryIndex, err := index.LoadGridIndex(indexFolder, cellSize, cellSize, checkFeatureValidity, tagIndex, settings)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to load grid-index of index '%s'", name)
+	}
+
+	return &NamedIndex{
+		Name:          name,
+		TagIndex:      tagIndex,
+		GeometryIndex: geometryIndex,
+	}, nil
+}
+
+// Execute parses and executes the query on each of the given indices. Features contained in multiple indices, e.g.
+// along the border of two adjacent extracts, are only part of the result of the first index containing them.
+func Execute(queryString string, namedIndices []*NamedIndex, memoryLimit int64, settings common.Settings) (*Result, error) {
+	result := &Result{}
+	seenFeatures := map[ownOsm.OsmObjectType]map[uint64]bool{
+		ownOsm.OsmObjNode:     {},
+		ownOsm.OsmObjWay:      {},
+		ownOsm.OsmObjRelation: {},
+	}
+
+	for _, namedIndex := range namedIndices {
+		q, features, err := executeOnIndex(queryString, namedIndex, memoryLimit, settings)
+		if err != nil {
+			return nil, err
+		}
+
+		var newFeatures []feature.Feature
+		for _, f := range features {
+			objectType := getObjectType(f)
+			if seenFeatures[objectType][f.GetID()] {
+				continue
+			}
+			seenFeatures[objectType][f.GetID()] = true
+			newFeatures = append(newFeatures, f)
+		}
+		sigolo.Infof("Found %d features in index '%s', %d of them are new", len(features), namedIndex.Name, len(newFeatures))
+
+		result.FeatureSets = append(result.FeatureSets, index.FeatureSet{Features: newFeatures, TagIndex: namedIndex.TagIndex})
+		for _, failedAssertion := range q.GetFailedAssertions() {
+			result.FailedAssertions = append(result.FailedAssertions, errors.Wrapf(failedAssertion, "Assertion failed on index '%s'", namedIndex.Name))
+		}
+	}
+
+	return result, nil
+}
+
+// executeOnIndex parses and executes the query on the given index. The query is parsed for each index, since the
+// tag-indices differ.
+func executeOnIndex(queryString string, namedIndex *NamedIndex, memoryLimit int64, settings common.Settings) (*query.Query, []feature.Feature, error) {
+	sigolo.Infof("Execute query on index '%s'", namedIndex.Name)
+
+	q, err := parser.ParseQueryString(queryString, namedIndex.TagIndex, namedIndex.GeometryIndex)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Unable to parse query for index '%s'", namedIndex.Name)
+	}
+	if q.HasStatistics() {
+		return nil, nil, errors.New("Value statistics are not supported for queries on multiple indices")
+	}
+	if q.IsIntrospection() {
+		return nil, nil, errors.New("Listing keys or values is not supported for queries on multiple indices")
+	}
+	q.SetMemoryLimit(memoryLimit)
+	q.SetFilterWorkers(settings.FilterWorkers)
+	q.SetMemoryAccountant(settings.MemoryAccountant)
+
+	features, err := q.Execute(namedIndex.GeometryIndex)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Unable to execute query on index '%s'", namedIndex.Name)
+	}
+
+	return q, features, nil
+}
+
+func getObjectType(f feature.Feature) ownOsm.OsmObjectType {
+	switch f.(type) {
+	case feature.WayFeature:
+		return ownOsm.OsmObjWay
+	case feature.RelationFeature:
+		return ownOsm.OsmObjRelation
+	}
+	return ownOsm.OsmObjNode
+}
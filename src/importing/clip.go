@@ -0,0 +1,160 @@
+package importing
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// LoadClipPolygon reads all polygons and multipolygons of the given GeoJSON file. The file may contain a feature
+// collection, a single feature or a plain geometry.
+func LoadClipPolygon(filename string) (orb.MultiPolygon, error) {
+	geojsonBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read clip polygon file %s", filename)
+	}
+
+	var geometries []orb.Geometry
+	if featureCollection, err := geojson.UnmarshalFeatureCollection(geojsonBytes); err == nil && featureCollection.Type == "FeatureCollection" {
+		for _, f := range featureCollection.Features {
+			geometries = append(geometries, f.Geometry)
+		}
+	} else if f, err := geojson.UnmarshalFeature(geojsonBytes); err == nil && f.Type == "Feature" {
+		geometries = append(geometries, f.Geometry)
+	} else if geometry, err := geojson.UnmarshalGeometry(geojsonBytes); err == nil {
+		geometries = append(geometries, geometry.Geometry())
+	} else {
+		return nil, errors.Wrapf(err, "Unable to parse clip polygon file %s as GeoJSON", filename)
+	}
+
+	var multiPolygon orb.MultiPolygon
+	for _, geometry := range geometries {
+		switch typedGeometry := geometry.(type) {
+		case orb.Polygon:
+			multiPolygon = append(multiPolygon, typedGeometry)
+		case orb.MultiPolygon:
+			multiPolygon = append(multiPolygon, typedGeometry...)
+		}
+	}
+
+	if len(multiPolygon) == 0 {
+		return nil, errors.Errorf("Clip polygon file %s contains no polygon or multipolygon", filename)
+	}
+
+	return multiPolygon, nil
+}
+
+// ClipFilter implements the OsmDataHandler and determines which OSM objects are within a polygon. Ways are complete,
+// i.e. a way with at least one node inside the polygon is kept with all of its nodes, even when some of them are
+// outside. Relations with at least one kept member are kept (with all of their members) as well as their parent
+// relations.
+//
+// This handler must see the whole data before other handlers can be wrapped with Wrap to only receive the kept objects.
+type ClipFilter struct {
+	objectFilter
+	polygon orb.MultiPolygon
+	bound   orb.Bound
+
+	// Child relations of the not (yet) kept relations. Parents of kept child relations are determined in Done.
+	relationToChildRelations map[osm.RelationID][]osm.RelationID
+}
+
+func NewClipFilter(polygon orb.MultiPolygon) *ClipFilter {
+	return &ClipFilter{
+		objectFilter:             newObjectFilter(),
+		polygon:                  polygon,
+		bound:                    polygon.Bound(),
+		relationToChildRelations: map[osm.RelationID][]osm.RelationID{},
+	}
+}
+
+func (c *ClipFilter) Name() string {
+	return "ClipFilter"
+}
+
+func (c *ClipFilter) Init() error {
+	return nil
+}
+
+func (c *ClipFilter) HandleNode(node *osm.Node) error {
+	if c.contains(node.Lon, node.Lat) {
+		c.nodeIds[node.ID] = true
+	}
+	return nil
+}
+
+func (c *ClipFilter) HandleWay(way *osm.Way) error {
+	wayIsInside := false
+	for _, node := range way.Nodes {
+		if c.contains(node.Lon, node.Lat) {
+			wayIsInside = true
+			break
+		}
+	}
+	if !wayIsInside {
+		return nil
+	}
+
+	c.wayIds[way.ID] = true
+	for _, node := range way.Nodes {
+		c.nodeIds[node.ID] = true
+	}
+
+	return nil
+}
+
+func (c *ClipFilter) HandleRelation(relation *osm.Relation) error {
+	var childRelationIds []osm.RelationID
+	for _, member := range relation.Members {
+		switch member.Type {
+		case osm.TypeNode:
+			if c.nodeIds[osm.NodeID(member.Ref)] {
+				c.relationIds[relation.ID] = true
+				return nil
+			}
+		case osm.TypeWay:
+			if c.wayIds[osm.WayID(member.Ref)] {
+				c.relationIds[relation.ID] = true
+				return nil
+			}
+		case osm.TypeRelation:
+			childRelationIds = append(childRelationIds, osm.RelationID(member.Ref))
+		}
+	}
+
+	if len(childRelationIds) > 0 {
+		c.relationToChildRelations[relation.ID] = childRelationIds
+	}
+
+	return nil
+}
+
+// Done adds all relations having a kept child relation. This is repeated until no new relation has been added, so that
+// whole relation hierarchies are kept.
+func (c *ClipFilter) Done() error {
+	for relationAdded := true; relationAdded; {
+		relationAdded = false
+		for relationId, childRelationIds := range c.relationToChildRelations {
+			for _, childRelationId := range childRelationIds {
+				if c.relationIds[childRelationId] {
+					c.relationIds[relationId] = true
+					delete(c.relationToChildRelations, relationId)
+					relationAdded = true
+					break
+				}
+			}
+		}
+	}
+
+	c.relationToChildRelations = nil
+
+	return nil
+}
+
+func (c *ClipFilter) contains(lon float64, lat float64) bool {
+	point := orb.Point{lon, lat}
+	return c.bound.Contains(point) && planar.MultiPolygonContains(c.polygon, point)
+}
@@ -0,0 +1,112 @@
+package importing
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"os"
+	"path"
+	"soq/common"
+	"testing"
+)
+
+var clipTestPolygon = orb.MultiPolygon{{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}}
+
+func TestClipFilter(t *testing.T) {
+	// Arrange
+	nodeInside := &osm.Node{ID: 1, Lon: 5, Lat: 5}
+	nodeOutsideOfWay := &osm.Node{ID: 2, Lon: 15, Lat: 5}
+	nodeOutside := &osm.Node{ID: 3, Lon: 15, Lat: 15}
+	wayCrossingBoundary := &osm.Way{ID: 10, Nodes: osm.WayNodes{{ID: 1, Lon: 5, Lat: 5}, {ID: 2, Lon: 15, Lat: 5}}}
+	wayOutside := &osm.Way{ID: 11, Nodes: osm.WayNodes{{ID: 3, Lon: 15, Lat: 15}, {ID: 2, Lon: 15, Lat: 5}}}
+	relationWithWay := &osm.Relation{ID: 20, Members: osm.Members{{Type: osm.TypeWay, Ref: 11}, {Type: osm.TypeWay, Ref: 10}}}
+	relationOutside := &osm.Relation{ID: 21, Members: osm.Members{{Type: osm.TypeNode, Ref: 3}}}
+	parentRelation := &osm.Relation{ID: 22, Members: osm.Members{{Type: osm.TypeRelation, Ref: 23}, {Type: osm.TypeRelation, Ref: 21}}}
+	relationWithRelation := &osm.Relation{ID: 23, Members: osm.Members{{Type: osm.TypeRelation, Ref: 20}}}
+
+	clipFilter := NewClipFilter(clipTestPolygon)
+
+	// Act
+	for _, node := range []*osm.Node{nodeInside, nodeOutsideOfWay, nodeOutside} {
+		common.AssertNil(t, clipFilter.HandleNode(node))
+	}
+	for _, way := range []*osm.Way{wayCrossingBoundary, wayOutside} {
+		common.AssertNil(t, clipFilter.HandleWay(way))
+	}
+	for _, relation := range []*osm.Relation{relationWithWay, relationOutside, parentRelation, relationWithRelation} {
+		common.AssertNil(t, clipFilter.HandleRelation(relation))
+	}
+	common.AssertNil(t, clipFilter.Done())
+
+	// Assert
+	common.AssertEqual(t, map[osm.NodeID]bool{1: true, 2: true}, clipFilter.nodeIds)
+	common.AssertEqual(t, map[osm.WayID]bool{10: true}, clipFilter.wayIds)
+	common.AssertEqual(t, map[osm.RelationID]bool{20: true, 22: true, 23: true}, clipFilter.relationIds)
+}
+
+func TestClipFilter_Wrap(t *testing.T) {
+	// Arrange
+	clipFilter := NewClipFilter(clipTestPolygon)
+	common.AssertNil(t, clipFilter.HandleNode(&osm.Node{ID: 1, Lon: 5, Lat: 5}))
+	handler := &countingDataHandler{}
+	wrappedHandler := clipFilter.Wrap(handler)
+
+	// Act
+	common.AssertNil(t, wrappedHandler.HandleNode(&osm.Node{ID: 1, Lon: 5, Lat: 5}))
+	common.AssertNil(t, wrappedHandler.HandleNode(&osm.Node{ID: 2, Lon: 15, Lat: 5}))
+	common.AssertNil(t, wrappedHandler.HandleWay(&osm.Way{ID: 10}))
+	common.AssertNil(t, wrappedHandler.HandleRelation(&osm.Relation{ID: 20}))
+
+	// Assert
+	common.AssertEqual(t, 1, handler.nodes)
+	common.AssertEqual(t, 0, handler.ways)
+	common.AssertEqual(t, 0, handler.relations)
+}
+
+func TestLoadClipPolygon(t *testing.T) {
+	// Arrange
+	folder := t.TempDir()
+	files := map[string]string{
+		"collection.geojson": `{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[10,0],[10,10],[0,10],[0,0]]]}}, {"type": "Feature", "properties": {}, "geometry": {"type": "Point", "coordinates": [1,2]}}]}`,
+		"feature.geojson":    `{"type": "Feature", "properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [[[[0,0],[10,0],[10,10],[0,10],[0,0]]]]}}`,
+		"geometry.geojson":   `{"type": "Polygon", "coordinates": [[[0,0],[10,0],[10,10],[0,10],[0,0]]]}`,
+	}
+
+	for filename, content := range files {
+		err := os.WriteFile(path.Join(folder, filename), []byte(content), 0644)
+		common.AssertNil(t, err)
+
+		// Act
+		polygon, err := LoadClipPolygon(path.Join(folder, filename))
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, clipTestPolygon, polygon)
+	}
+}
+
+func TestLoadClipPolygon_noPolygon(t *testing.T) {
+	// Arrange
+	filename := path.Join(t.TempDir(), "point.geojson")
+	err := os.WriteFile(filename, []byte(`{"type": "Point", "coordinates": [1,2]}`), 0644)
+	common.AssertNil(t, err)
+
+	// Act
+	polygon, err := LoadClipPolygon(filename)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, polygon)
+}
+
+type countingDataHandler struct {
+	nodes     int
+	ways      int
+	relations int
+}
+
+func (h *countingDataHandler) Name() string                       { return "countingDataHandler" }
+func (h *countingDataHandler) Init() error                        { return nil }
+func (h *countingDataHandler) HandleNode(*osm.Node) error         { h.nodes++; return nil }
+func (h *countingDataHandler) HandleWay(*osm.Way) error           { h.ways++; return nil }
+func (h *countingDataHandler) HandleRelation(*osm.Relation) error { h.relations++; return nil }
+func (h *countingDataHandler) Done() error                        { return nil }
@@ -0,0 +1,164 @@
+package importing
+
+import (
+	"encoding/json"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"math"
+	"os"
+	"soq/common"
+	ownOsm "soq/osm"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DerivedTagTransformCopy uses the value as it is.
+	DerivedTagTransformCopy = "copy"
+	// DerivedTagTransformLowercase converts the value to lower case, e.g. "Hauptstraße" -> "hauptstraße".
+	DerivedTagTransformLowercase = "lowercase"
+	// DerivedTagTransformNumber normalizes numbers, e.g. "2,50" -> "2.5". Other values are skipped.
+	DerivedTagTransformNumber = "number"
+	// DerivedTagTransformMeters converts lengths with unit into meters, e.g. "10 ft" -> "3.048". Values without unit are
+	// considered to be meters. Other values are skipped.
+	DerivedTagTransformMeters = "meters"
+)
+
+var derivedTagTransforms = map[string]func(value string) (string, bool){
+	DerivedTagTransformCopy: func(value string) (string, bool) {
+		return value, true
+	},
+	DerivedTagTransformLowercase: func(value string) (string, bool) {
+		return strings.ToLower(value), true
+	},
+	DerivedTagTransformNumber: func(value string) (string, bool) {
+		number, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(value), ",", ".", 1), 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), true
+	},
+	DerivedTagTransformMeters: func(value string) (string, bool) {
+		meters, ok := common.ParseElevation(value)
+		if !ok {
+			return "", false
+		}
+		return strconv.FormatFloat(meters, 'f', -1, 64), true
+	},
+}
+
+// DerivedTagRule computes the tag with the derived key from the value of the key, e.g. the cleaned number
+// "levels_numeric=3" from "building:levels=3,0".
+type DerivedTagRule struct {
+	Key        string `json:"key"`
+	DerivedKey string `json:"derivedKey"`
+	// One of the DerivedTagTransform constants, e.g. "number".
+	Transform string `json:"transform"`
+}
+
+// DerivedTags contains the rules to compute additional tags during the import. The derived tags are stored like normal
+// tags, so queries can use them (e.g. "levels_numeric>=3"). Objects already having the derived key keep their value.
+type DerivedTags []DerivedTagRule
+
+// LoadDerivedTags reads the derived tag rules from the given JSON file. The file contains a list of DerivedTagRule
+// objects, e.g. [{"key": "building:levels", "derivedKey": "levels_numeric", "transform": "number"}].
+func LoadDerivedTags(filename string) (DerivedTags, error) {
+	rulesBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read derived tags file %s", filename)
+	}
+
+	derivedTags := DerivedTags{}
+	err = json.Unmarshal(rulesBytes, &derivedTags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse derived tags file %s", filename)
+	}
+
+	for i, rule := range derivedTags {
+		if rule.Key == "" || rule.DerivedKey == "" {
+			return nil, errors.Errorf("Rule %d of derived tags file %s needs a key and a derived key", i, filename)
+		}
+		if _, ok := derivedTagTransforms[rule.Transform]; !ok {
+			return nil, errors.Errorf("Unknown transform '%s' of rule %d in derived tags file %s", rule.Transform, i, filename)
+		}
+	}
+
+	return derivedTags, nil
+}
+
+// derive returns the tags including the derived tags. The given tags are not changed, the second return value is false
+// when no tag has been derived.
+func (d DerivedTags) derive(tags osm.Tags) (osm.Tags, bool) {
+	var derivedTags osm.Tags
+	for _, rule := range d {
+		value := tags.Find(rule.Key)
+		if value == "" || tags.HasTag(rule.DerivedKey) || derivedTags.HasTag(rule.DerivedKey) {
+			continue
+		}
+
+		derivedValue, ok := derivedTagTransforms[rule.Transform](value)
+		if !ok || derivedValue == "" {
+			continue
+		}
+		derivedTags = append(derivedTags, osm.Tag{Key: rule.DerivedKey, Value: derivedValue})
+	}
+
+	if len(derivedTags) == 0 {
+		return tags, false
+	}
+	return append(append(make(osm.Tags, 0, len(tags)+len(derivedTags)), tags...), derivedTags...), true
+}
+
+// Wrap returns a handler passing the OSM objects with their derived tags to the given handler.
+func (d DerivedTags) Wrap(handler ownOsm.OsmDataHandler) ownOsm.OsmDataHandler {
+	return &derivedTagsHandler{
+		derivedTags: d,
+		handler:     handler,
+	}
+}
+
+// derivedTagsHandler passes copies with the derived tags to the wrapped handler, since handlers must not change the
+// received objects.
+type derivedTagsHandler struct {
+	derivedTags DerivedTags
+	handler     ownOsm.OsmDataHandler
+}
+
+func (h *derivedTagsHandler) Name() string {
+	return h.handler.Name() + " (derived tags)"
+}
+
+func (h *derivedTagsHandler) Init() error {
+	return h.handler.Init()
+}
+
+func (h *derivedTagsHandler) HandleNode(node *osm.Node) error {
+	if tags, derived := h.derivedTags.derive(node.Tags); derived {
+		nodeCopy := *node
+		nodeCopy.Tags = tags
+		node = &nodeCopy
+	}
+	return h.handler.HandleNode(node)
+}
+
+func (h *derivedTagsHandler) HandleWay(way *osm.Way) error {
+	if tags, derived := h.derivedTags.derive(way.Tags); derived {
+		wayCopy := *way
+		wayCopy.Tags = tags
+		way = &wayCopy
+	}
+	return h.handler.HandleWay(way)
+}
+
+func (h *derivedTagsHandler) HandleRelation(relation *osm.Relation) error {
+	if tags, derived := h.derivedTags.derive(relation.Tags); derived {
+		relationCopy := *relation
+		relationCopy.Tags = tags
+		relation = &relationCopy
+	}
+	return h.handler.HandleRelation(relation)
+}
+
+func (h *derivedTagsHandler) Done() error {
+	return h.handler.Done()
+}
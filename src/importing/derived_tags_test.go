@@ -0,0 +1,108 @@
+package importing
+
+import (
+	"github.com/paulmach/osm"
+	"os"
+	"path"
+	"soq/common"
+	"testing"
+)
+
+// collectingDataHandler stores all received objects.
+type collectingDataHandler struct {
+	nodes     []*osm.Node
+	ways      []*osm.Way
+	relations []*osm.Relation
+}
+
+func (h *collectingDataHandler) Name() string { return "collectingDataHandler" }
+func (h *collectingDataHandler) Init() error  { return nil }
+func (h *collectingDataHandler) HandleNode(node *osm.Node) error {
+	h.nodes = append(h.nodes, node)
+	return nil
+}
+func (h *collectingDataHandler) HandleWay(way *osm.Way) error {
+	h.ways = append(h.ways, way)
+	return nil
+}
+func (h *collectingDataHandler) HandleRelation(relation *osm.Relation) error {
+	h.relations = append(h.relations, relation)
+	return nil
+}
+func (h *collectingDataHandler) Done() error { return nil }
+
+func TestDerivedTags_derive(t *testing.T) {
+	// Arrange
+	derivedTags := DerivedTags{
+		{Key: "building:levels", DerivedKey: "levels_numeric", Transform: DerivedTagTransformNumber},
+		{Key: "name", DerivedKey: "name_lower", Transform: DerivedTagTransformLowercase},
+		{Key: "height", DerivedKey: "height_m", Transform: DerivedTagTransformMeters},
+		{Key: "ref", DerivedKey: "name", Transform: DerivedTagTransformCopy},
+	}
+
+	for _, testCase := range []struct {
+		tags         osm.Tags
+		expectedTags osm.Tags
+	}{
+		{
+			osm.Tags{{Key: "building:levels", Value: "3,0"}, {Key: "name", Value: "Rathaus"}, {Key: "height", Value: "10 ft"}},
+			osm.Tags{{Key: "building:levels", Value: "3,0"}, {Key: "name", Value: "Rathaus"}, {Key: "height", Value: "10 ft"}, {Key: "levels_numeric", Value: "3"}, {Key: "name_lower", Value: "rathaus"}, {Key: "height_m", Value: "3.048"}},
+		},
+		{
+			// Invalid numbers are skipped and existing tags are not overwritten
+			osm.Tags{{Key: "building:levels", Value: "3-4"}, {Key: "ref", Value: "A1"}, {Key: "name", Value: "Foo"}},
+			osm.Tags{{Key: "building:levels", Value: "3-4"}, {Key: "ref", Value: "A1"}, {Key: "name", Value: "Foo"}, {Key: "name_lower", Value: "foo"}},
+		},
+		{
+			osm.Tags{{Key: "highway", Value: "primary"}},
+			osm.Tags{{Key: "highway", Value: "primary"}},
+		},
+	} {
+		// Act
+		tags, _ := derivedTags.derive(testCase.tags)
+
+		// Assert
+		common.AssertEqual(t, testCase.expectedTags, tags)
+	}
+}
+
+func TestDerivedTags_Wrap(t *testing.T) {
+	// Arrange
+	derivedTags := DerivedTags{{Key: "name", DerivedKey: "name_lower", Transform: DerivedTagTransformLowercase}}
+	collector := &collectingDataHandler{}
+	handler := derivedTags.Wrap(collector)
+	node := &osm.Node{ID: 1, Tags: osm.Tags{{Key: "name", Value: "Foo"}}}
+	way := &osm.Way{ID: 2, Tags: osm.Tags{{Key: "highway", Value: "primary"}}}
+
+	// Act
+	common.AssertNil(t, handler.HandleNode(node))
+	common.AssertNil(t, handler.HandleWay(way))
+
+	// Assert
+	common.AssertEqual(t, osm.Tags{{Key: "name", Value: "Foo"}, {Key: "name_lower", Value: "foo"}}, collector.nodes[0].Tags)
+	common.AssertEqual(t, osm.NodeID(1), collector.nodes[0].ID)
+	common.AssertEqual(t, osm.Tags{{Key: "name", Value: "Foo"}}, node.Tags)
+	common.AssertEqual(t, way, collector.ways[0])
+}
+
+func TestLoadDerivedTags(t *testing.T) {
+	// Arrange
+	folder := t.TempDir()
+	validFile := path.Join(folder, "valid.json")
+	common.AssertNil(t, os.WriteFile(validFile, []byte(`[{"key": "building:levels", "derivedKey": "levels_numeric", "transform": "number"}]`), 0644))
+	unknownTransformFile := path.Join(folder, "unknown-transform.json")
+	common.AssertNil(t, os.WriteFile(unknownTransformFile, []byte(`[{"key": "name", "derivedKey": "name_upper", "transform": "uppercase"}]`), 0644))
+	missingKeyFile := path.Join(folder, "missing-key.json")
+	common.AssertNil(t, os.WriteFile(missingKeyFile, []byte(`[{"key": "name", "transform": "copy"}]`), 0644))
+
+	// Act
+	derivedTags, err := LoadDerivedTags(validFile)
+	_, unknownTransformErr := LoadDerivedTags(unknownTransformFile)
+	_, missingKeyErr := LoadDerivedTags(missingKeyFile)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, DerivedTags{{Key: "building:levels", DerivedKey: "levels_numeric", Transform: DerivedTagTransformNumber}}, derivedTags)
+	common.AssertNotNil(t, unknownTransformErr)
+	common.AssertNotNil(t, missingKeyErr)
+}
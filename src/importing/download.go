@@ -0,0 +1,170 @@
+package importing
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const partialDownloadFileExtension = ".part"
+
+var (
+	maxDownloadAttempts   = 5
+	downloadRetryDelay    = 5 * time.Second
+	downloadProgressDelay = 30 * time.Second
+)
+
+// IsUrl returns true when the given import input is an HTTP(S) URL instead of a local file.
+func IsUrl(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// DownloadInputFile downloads the OSM data of the given URL (e.g. a PBF file from Geofabrik or an Overpass interpreter
+// URL returning XML) into the given folder and returns the path of the downloaded file. The import reads the input
+// multiple times, so the data can't be streamed directly into the import.
+//
+// The data is first written into a ".part" file. Interrupted downloads are resumed with HTTP range requests, either by
+// the next retry or by the next call of this function. An already completely downloaded file is reused, the caller
+// should therefore remove the file once it's not needed anymore.
+func DownloadInputFile(inputUrl string, folder string) (string, error) {
+	filename, err := getDownloadFilename(inputUrl)
+	if err != nil {
+		return "", err
+	}
+	filePath := path.Join(folder, filename)
+	partialFilePath := filePath + partialDownloadFileExtension
+
+	if _, err = os.Stat(filePath); err == nil {
+		sigolo.Infof("Use already downloaded file %s", filePath)
+		return filePath, nil
+	}
+
+	err = os.MkdirAll(folder, os.ModePerm)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to create download folder %s", folder)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = downloadOrResume(inputUrl, partialFilePath)
+		if err == nil {
+			break
+		}
+		if attempt >= maxDownloadAttempts {
+			return "", errors.Wrapf(err, "Download of %s failed after %d attempts", inputUrl, attempt)
+		}
+
+		sigolo.Warnf("Download attempt %d of %d failed, retry in %s: %s", attempt, maxDownloadAttempts, downloadRetryDelay, err.Error())
+		time.Sleep(downloadRetryDelay)
+	}
+
+	err = os.Rename(partialFilePath, filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to rename downloaded file %s to %s", partialFilePath, filePath)
+	}
+
+	return filePath, nil
+}
+
+// getDownloadFilename returns the last path segment of PBF URLs. All other URLs (e.g. of the Overpass API) are assumed
+// to return XML and get a generic name.
+func getDownloadFilename(inputUrl string) (string, error) {
+	parsedUrl, err := url.Parse(inputUrl)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid URL %s", inputUrl)
+	}
+
+	filename := path.Base(parsedUrl.Path)
+	if strings.HasSuffix(filename, ".pbf") {
+		return filename, nil
+	}
+	return "download.osm", nil
+}
+
+// downloadOrResume appends the remaining data to the given file. Servers not supporting range requests send the whole
+// data again, in which case the file is overwritten.
+func downloadOrResume(inputUrl string, filePath string) error {
+	existingBytes := int64(0)
+	if info, err := os.Stat(filePath); err == nil {
+		existingBytes = info.Size()
+	}
+
+	request, err := http.NewRequest(http.MethodGet, inputUrl, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create request for %s", inputUrl)
+	}
+	if existingBytes > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", existingBytes))
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "Request to %s failed", inputUrl)
+	}
+	defer response.Body.Close()
+
+	fileFlags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case response.StatusCode == http.StatusPartialContent:
+		sigolo.Infof("Resume download of %s at %d bytes", inputUrl, existingBytes)
+		fileFlags |= os.O_APPEND
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && existingBytes > 0:
+		// The file has been downloaded completely, only the renaming was interrupted.
+		return nil
+	case response.StatusCode == http.StatusOK:
+		sigolo.Infof("Download %s", inputUrl)
+		fileFlags |= os.O_TRUNC
+		existingBytes = 0
+	default:
+		return errors.Errorf("Request to %s failed with status %s", inputUrl, response.Status)
+	}
+
+	file, err := os.OpenFile(filePath, fileFlags, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open download file %s", filePath)
+	}
+	defer file.Close()
+
+	progressWriter := &downloadProgressWriter{
+		writer:         file,
+		writtenBytes:   existingBytes,
+		totalBytes:     existingBytes + response.ContentLength,
+		lastReportTime: time.Now(),
+	}
+	_, err = io.Copy(progressWriter, response.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Download of %s interrupted after %d bytes", inputUrl, progressWriter.writtenBytes)
+	}
+
+	return nil
+}
+
+// downloadProgressWriter logs the download progress in regular intervals.
+type downloadProgressWriter struct {
+	writer         io.Writer
+	writtenBytes   int64
+	totalBytes     int64 // Less than the written bytes when the server sent no content length.
+	lastReportTime time.Time
+}
+
+func (w *downloadProgressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.writtenBytes += int64(n)
+
+	if time.Since(w.lastReportTime) >= downloadProgressDelay {
+		w.lastReportTime = time.Now()
+		if w.totalBytes >= w.writtenBytes {
+			sigolo.Infof("Downloaded %d of %d MB", w.writtenBytes/1024/1024, w.totalBytes/1024/1024)
+		} else {
+			sigolo.Infof("Downloaded %d MB", w.writtenBytes/1024/1024)
+		}
+	}
+
+	return n, err
+}
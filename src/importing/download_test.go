@@ -0,0 +1,83 @@
+package importing
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"soq/common"
+	"testing"
+	"time"
+)
+
+var downloadTestData = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+func newDownloadTestServer(t *testing.T, requestedRanges *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		*requestedRanges = append(*requestedRanges, request.Header.Get("Range"))
+		http.ServeContent(writer, request, "data.osm.pbf", time.Time{}, bytes.NewReader(downloadTestData))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadInputFile(t *testing.T) {
+	// Arrange
+	var requestedRanges []string
+	server := newDownloadTestServer(t, &requestedRanges)
+	folder := t.TempDir()
+
+	// Act
+	filePath, err := DownloadInputFile(server.URL+"/europe/hamburg-latest.osm.pbf", folder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, path.Join(folder, "hamburg-latest.osm.pbf"), filePath)
+	content, err := os.ReadFile(filePath)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, downloadTestData, content)
+	common.AssertEqual(t, []string{""}, requestedRanges)
+}
+
+func TestDownloadInputFile_resumePartialDownload(t *testing.T) {
+	// Arrange
+	var requestedRanges []string
+	server := newDownloadTestServer(t, &requestedRanges)
+	folder := t.TempDir()
+	err := os.WriteFile(path.Join(folder, "download.osm"+partialDownloadFileExtension), downloadTestData[:10], 0644)
+	common.AssertNil(t, err)
+
+	// Act
+	filePath, err := DownloadInputFile(server.URL+"/api/interpreter?data=foo", folder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, path.Join(folder, "download.osm"), filePath)
+	content, err := os.ReadFile(filePath)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, downloadTestData, content)
+	common.AssertEqual(t, []string{"bytes=10-"}, requestedRanges)
+}
+
+func TestDownloadInputFile_failingServer(t *testing.T) {
+	// Arrange
+	originalAttempts, originalDelay := maxDownloadAttempts, downloadRetryDelay
+	maxDownloadAttempts, downloadRetryDelay = 2, 0
+	defer func() { maxDownloadAttempts, downloadRetryDelay = originalAttempts, originalDelay }()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Act
+	filePath, err := DownloadInputFile(server.URL+"/data.osm.pbf", t.TempDir())
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertEqual(t, "", filePath)
+	common.AssertEqual(t, 2, requests)
+}
@@ -0,0 +1,220 @@
+package importing
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/encoding"
+	ownOsm "soq/osm"
+	"time"
+)
+
+// ImportEstimate is the result of a dry-run of an import, s. EstimateImport.
+type ImportEstimate struct {
+	Nodes          int `json:"nodes"`
+	TaggedNodes    int `json:"taggedNodes"`
+	Ways           int `json:"ways"`
+	Relations      int `json:"relations"`
+	DistinctKeys   int `json:"distinctKeys"`
+	DistinctValues int `json:"distinctValues"`
+
+	// Number of cells containing at least one node or way.
+	Cells int `json:"cells"`
+	// Number of nodes and ways in the cell with the most features.
+	MaxFeaturesPerCell int `json:"maxFeaturesPerCell"`
+	// Number of cells with more nodes or more ways than the split threshold, which are split into sub-cells.
+	CellsAboveSplitThreshold int `json:"cellsAboveSplitThreshold"`
+
+	EstimatedCellBytes     int64 `json:"estimatedCellBytes"`
+	EstimatedTagIndexBytes int64 `json:"estimatedTagIndexBytes"`
+	EstimatedIndexBytes    int64 `json:"estimatedIndexBytes"`
+}
+
+// EstimateImport reads the input file once and estimates the size of the index an import with the given options
+// would create, without writing anything. The cell sizes are calculated with the encoding of the index. Ways are stored
+// in every cell they cover, relations are only counted once, since their cells are only known after reading their
+// members. The estimate of data with many large relations is therefore too small.
+func EstimateImport(inputFile string, cellScheme common.CellScheme, cellSplitThreshold int, coordinatePrecision encoding.CoordinatePrecision, skipUntaggedNodes bool, storeMetadata bool, settings common.Settings) (*ImportEstimate, error) {
+	sigolo.Infof("Estimate import of OSM data file %s", inputFile)
+	startTime := time.Now()
+
+	estimator := newImportEstimator(cellScheme, cellSplitThreshold, coordinatePrecision, skipUntaggedNodes, storeMetadata)
+	err := ownOsm.NewOsmReader(settings.ImportWorkers).Read(inputFile, estimator)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading OSM data")
+	}
+
+	sigolo.Infof("Estimated import in %s", time.Since(startTime))
+	return estimator.estimate, nil
+}
+
+type cellFeatureCount struct {
+	nodes int
+	ways  int
+}
+
+// importEstimator is an OSM data handler collecting the statistics of the ImportEstimate.
+type importEstimator struct {
+	cellScheme          common.CellScheme
+	cellSplitThreshold  int
+	coordinatePrecision encoding.CoordinatePrecision
+	skipUntaggedNodes   bool
+	storeMetadata       bool
+
+	estimate *ImportEstimate
+	values   map[string]map[string]bool
+	cells    map[common.CellIndex]*cellFeatureCount
+	// Number of IDs of ways and relations stored in the records of their nodes, ways and child relations.
+	references int64
+	// Only the length of the tag slices is relevant for the record sizes, so all records use (a part of) this slice.
+	tags []int
+}
+
+func newImportEstimator(cellScheme common.CellScheme, cellSplitThreshold int, coordinatePrecision encoding.CoordinatePrecision, skipUntaggedNodes bool, storeMetadata bool) *importEstimator {
+	return &importEstimator{
+		cellScheme:          cellScheme,
+		cellSplitThreshold:  cellSplitThreshold,
+		coordinatePrecision: coordinatePrecision,
+		skipUntaggedNodes:   skipUntaggedNodes,
+		storeMetadata:       storeMetadata,
+		estimate:            &ImportEstimate{},
+		values:              map[string]map[string]bool{},
+		cells:               map[common.CellIndex]*cellFeatureCount{},
+	}
+}
+
+func (e *importEstimator) Name() string {
+	return "ImportEstimator"
+}
+
+func (e *importEstimator) Init() error {
+	return nil
+}
+
+func (e *importEstimator) HandleNode(node *osm.Node) error {
+	e.estimate.Nodes++
+	if len(node.Tags) > 0 {
+		e.estimate.TaggedNodes++
+	} else if e.skipUntaggedNodes {
+		return nil
+	}
+	e.addTags(node.Tags)
+
+	record := &encoding.Node{
+		Keys:                e.getTagSlice(len(node.Tags)),
+		Values:              e.getTagSlice(len(node.Tags)),
+		CoordinatePrecision: e.coordinatePrecision,
+		HasMetadata:         e.storeMetadata,
+	}
+	e.estimate.EstimatedCellBytes += int64(record.Size())
+	e.getCell(e.cellScheme.GetCellIndexForCoordinate(node.Lon, node.Lat)).nodes++
+
+	return nil
+}
+
+func (e *importEstimator) HandleWay(way *osm.Way) error {
+	e.estimate.Ways++
+	e.addTags(way.Tags)
+
+	wayCells := map[common.CellIndex]bool{}
+	for _, wayNode := range way.Nodes {
+		wayCells[e.cellScheme.GetCellIndexForCoordinate(wayNode.Lon, wayNode.Lat)] = true
+	}
+
+	record := &encoding.Way{
+		Keys:        e.getTagSlice(len(way.Tags)),
+		Values:      e.getTagSlice(len(way.Tags)),
+		Nodes:       way.Nodes,
+		HasMetadata: e.storeMetadata,
+	}
+	e.estimate.EstimatedCellBytes += int64(record.Size() * len(wayCells))
+	for cell := range wayCells {
+		e.getCell(cell).ways++
+	}
+	e.references += int64(len(way.Nodes))
+
+	return nil
+}
+
+func (e *importEstimator) HandleRelation(relation *osm.Relation) error {
+	e.estimate.Relations++
+	e.addTags(relation.Tags)
+
+	record := &encoding.Relation{
+		Keys:        e.getTagSlice(len(relation.Tags)),
+		Values:      e.getTagSlice(len(relation.Tags)),
+		HasMetadata: e.storeMetadata,
+	}
+	for _, member := range relation.Members {
+		switch member.Type {
+		case osm.TypeNode:
+			record.NodeIds = append(record.NodeIds, osm.NodeID(member.Ref))
+			record.NodeRoles = append(record.NodeRoles, member.Role)
+		case osm.TypeWay:
+			record.WayIds = append(record.WayIds, osm.WayID(member.Ref))
+			record.WayRoles = append(record.WayRoles, member.Role)
+		case osm.TypeRelation:
+			record.ChildRelationIds = append(record.ChildRelationIds, osm.RelationID(member.Ref))
+			record.ChildRelationRoles = append(record.ChildRelationRoles, member.Role)
+		}
+	}
+	e.estimate.EstimatedCellBytes += int64(record.Size())
+	e.references += int64(len(relation.Members))
+
+	return nil
+}
+
+func (e *importEstimator) Done() error {
+	// The size of an ID is the size of a record with one way ID more than a record without any IDs.
+	referenceBytes := (&encoding.Node{WayIds: []osm.WayID{0}}).Size() - (&encoding.Node{}).Size()
+	e.estimate.EstimatedCellBytes += e.references * int64(referenceBytes)
+
+	e.estimate.DistinctKeys = len(e.values)
+	for key, values := range e.values {
+		e.estimate.DistinctValues += len(values)
+		// Each key is stored once and each value with a separator.
+		e.estimate.EstimatedTagIndexBytes += int64(len(key) + 1)
+		for value := range values {
+			e.estimate.EstimatedTagIndexBytes += int64(len(value) + 1)
+		}
+	}
+
+	e.estimate.Cells = len(e.cells)
+	for _, count := range e.cells {
+		e.estimate.MaxFeaturesPerCell = max(e.estimate.MaxFeaturesPerCell, count.nodes+count.ways)
+		if e.cellSplitThreshold > 0 && (count.nodes > e.cellSplitThreshold || count.ways > e.cellSplitThreshold) {
+			e.estimate.CellsAboveSplitThreshold++
+		}
+	}
+
+	e.estimate.EstimatedIndexBytes = e.estimate.EstimatedCellBytes + e.estimate.EstimatedTagIndexBytes
+	return nil
+}
+
+func (e *importEstimator) addTags(tags osm.Tags) {
+	for _, tag := range tags {
+		values, ok := e.values[tag.Key]
+		if !ok {
+			values = map[string]bool{}
+			e.values[tag.Key] = values
+		}
+		values[tag.Value] = true
+	}
+}
+
+func (e *importEstimator) getTagSlice(length int) []int {
+	if len(e.tags) < length {
+		e.tags = make([]int, length)
+	}
+	return e.tags[:length]
+}
+
+func (e *importEstimator) getCell(cell common.CellIndex) *cellFeatureCount {
+	count, ok := e.cells[cell]
+	if !ok {
+		count = &cellFeatureCount{}
+		e.cells[cell] = count
+	}
+	return count
+}
@@ -0,0 +1,42 @@
+package importing
+
+import (
+	"github.com/paulmach/osm"
+	"soq/common"
+	"soq/encoding"
+	"testing"
+)
+
+func TestImportEstimator(t *testing.T) {
+	// Arrange
+	estimator := newImportEstimator(&common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, 1, encoding.CoordinatePrecisionFloat32, true, false)
+
+	// Act
+	common.AssertNil(t, estimator.HandleNode(&osm.Node{ID: 1, Lon: 0.5, Lat: 0.5, Tags: osm.Tags{{Key: "amenity", Value: "bench"}}}))
+	common.AssertNil(t, estimator.HandleNode(&osm.Node{ID: 2, Lon: 0.6, Lat: 0.5, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}}))
+	common.AssertNil(t, estimator.HandleNode(&osm.Node{ID: 3, Lon: 1.5, Lat: 0.5}))
+	common.AssertNil(t, estimator.HandleWay(&osm.Way{ID: 10, Tags: osm.Tags{{Key: "highway", Value: "path"}}, Nodes: osm.WayNodes{{ID: 1, Lon: 0.5, Lat: 0.5}, {ID: 3, Lon: 1.5, Lat: 0.5}}}))
+	common.AssertNil(t, estimator.HandleRelation(&osm.Relation{ID: 100, Tags: osm.Tags{{Key: "type", Value: "route"}}, Members: osm.Members{{Type: osm.TypeWay, Ref: 10, Role: ""}}}))
+	common.AssertNil(t, estimator.Done())
+
+	// Assert
+	estimate := estimator.estimate
+	common.AssertEqual(t, 3, estimate.Nodes)
+	common.AssertEqual(t, 2, estimate.TaggedNodes)
+	common.AssertEqual(t, 1, estimate.Ways)
+	common.AssertEqual(t, 1, estimate.Relations)
+	common.AssertEqual(t, 3, estimate.DistinctKeys)
+	common.AssertEqual(t, 4, estimate.DistinctValues)
+
+	// The untagged node is skipped, but the way covers both cells.
+	common.AssertEqual(t, 2, estimate.Cells)
+	common.AssertEqual(t, 3, estimate.MaxFeaturesPerCell)
+	common.AssertEqual(t, 1, estimate.CellsAboveSplitThreshold)
+
+	nodeSize := (&encoding.Node{Keys: []int{0}, Values: []int{0}}).Size()
+	waySize := (&encoding.Way{Keys: []int{0}, Values: []int{0}, Nodes: osm.WayNodes{{ID: 1, Lon: 0.5, Lat: 0.5}, {ID: 3, Lon: 1.5, Lat: 0.5}}}).Size()
+	relationSize := (&encoding.Relation{Keys: []int{0}, Values: []int{0}, WayIds: []osm.WayID{10}, WayRoles: []string{""}}).Size()
+	common.AssertEqual(t, int64(2*nodeSize+2*waySize+relationSize+3*8), estimate.EstimatedCellBytes)
+	common.AssertEqual(t, int64(len("amenity=bench|cafe\nhighway=path\ntype=route\n")), estimate.EstimatedTagIndexBytes)
+	common.AssertEqual(t, estimate.EstimatedCellBytes+estimate.EstimatedTagIndexBytes, estimate.EstimatedIndexBytes)
+}
@@ -0,0 +1,68 @@
+package importing
+
+import (
+	"github.com/paulmach/osm"
+	ownOsm "soq/osm"
+)
+
+// objectFilter contains the IDs of all OSM objects that should be imported. It's filled by a filtering handler (e.g.
+// the ClipFilter) in a separate pass over the input data before the actual import.
+type objectFilter struct {
+	nodeIds     map[osm.NodeID]bool
+	wayIds      map[osm.WayID]bool
+	relationIds map[osm.RelationID]bool
+}
+
+func newObjectFilter() objectFilter {
+	return objectFilter{
+		nodeIds:     map[osm.NodeID]bool{},
+		wayIds:      map[osm.WayID]bool{},
+		relationIds: map[osm.RelationID]bool{},
+	}
+}
+
+// Wrap returns a handler passing only the OSM objects kept by this filter to the given handler.
+func (f *objectFilter) Wrap(handler ownOsm.OsmDataHandler) ownOsm.OsmDataHandler {
+	return &filteredDataHandler{
+		filter:  f,
+		handler: handler,
+	}
+}
+
+type filteredDataHandler struct {
+	filter  *objectFilter
+	handler ownOsm.OsmDataHandler
+}
+
+func (h *filteredDataHandler) Name() string {
+	return h.handler.Name() + " (filtered)"
+}
+
+func (h *filteredDataHandler) Init() error {
+	return h.handler.Init()
+}
+
+func (h *filteredDataHandler) HandleNode(node *osm.Node) error {
+	if !h.filter.nodeIds[node.ID] {
+		return nil
+	}
+	return h.handler.HandleNode(node)
+}
+
+func (h *filteredDataHandler) HandleWay(way *osm.Way) error {
+	if !h.filter.wayIds[way.ID] {
+		return nil
+	}
+	return h.handler.HandleWay(way)
+}
+
+func (h *filteredDataHandler) HandleRelation(relation *osm.Relation) error {
+	if !h.filter.relationIds[relation.ID] {
+		return nil
+	}
+	return h.handler.HandleRelation(relation)
+}
+
+func (h *filteredDataHandler) Done() error {
+	return h.handler.Done()
+}
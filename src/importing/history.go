@@ -0,0 +1,102 @@
+package importing
+
+import (
+	"github.com/paulmach/osm"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"time"
+)
+
+// newVisibleObjectsHandler returns a handler passing only visible OSM objects to the given handler. Full-history files
+// contain the deleted versions of objects, which have no tags and no valid location.
+func newVisibleObjectsHandler(handler ownOsm.OsmDataHandler) ownOsm.OsmDataHandler {
+	return &visibleObjectsHandler{
+		handler: handler,
+	}
+}
+
+type visibleObjectsHandler struct {
+	handler ownOsm.OsmDataHandler
+}
+
+func (h *visibleObjectsHandler) Name() string {
+	return h.handler.Name() + " (visible objects)"
+}
+
+func (h *visibleObjectsHandler) Init() error {
+	return h.handler.Init()
+}
+
+func (h *visibleObjectsHandler) HandleNode(node *osm.Node) error {
+	if !node.Visible {
+		return nil
+	}
+	return h.handler.HandleNode(node)
+}
+
+func (h *visibleObjectsHandler) HandleWay(way *osm.Way) error {
+	if !way.Visible {
+		return nil
+	}
+	return h.handler.HandleWay(way)
+}
+
+func (h *visibleObjectsHandler) HandleRelation(relation *osm.Relation) error {
+	if !relation.Visible {
+		return nil
+	}
+	return h.handler.HandleRelation(relation)
+}
+
+func (h *visibleObjectsHandler) Done() error {
+	return h.handler.Done()
+}
+
+// versionBuffer holds back the last version of an object until the following version is known, since the timestamp of
+// the following version ends the validity of the last one. Full-history files contain all versions of an object one
+// after another, ordered by their version number.
+type versionBuffer[T any] struct {
+	write func(object T, validity *feature.Validity) error
+
+	previous    T
+	previousId  int64
+	validFrom   int64
+	hasPrevious bool
+}
+
+func newVersionBuffer[T any](write func(object T, validity *feature.Validity) error) *versionBuffer[T] {
+	return &versionBuffer[T]{
+		write: write,
+	}
+}
+
+// add handles the next version of an object and writes the previous version. Deleted versions (not visible) are not
+// written, they only end the validity of the previous version.
+func (b *versionBuffer[T]) add(object T, id int64, timestamp time.Time, visible bool) error {
+	if b.hasPrevious {
+		var validTo int64 = feature.ValidForever
+		if id == b.previousId {
+			validTo = timestamp.Unix()
+		}
+		err := b.write(b.previous, &feature.Validity{From: b.validFrom, To: validTo})
+		if err != nil {
+			return err
+		}
+	}
+
+	b.previous = object
+	b.previousId = id
+	b.validFrom = timestamp.Unix()
+	b.hasPrevious = visible
+
+	return nil
+}
+
+// flush writes the last version, which is still valid at the end of the history.
+func (b *versionBuffer[T]) flush() error {
+	if !b.hasPrevious {
+		return nil
+	}
+	b.hasPrevious = false
+	return b.write(b.previous, &feature.Validity{From: b.validFrom, To: feature.ValidForever})
+}
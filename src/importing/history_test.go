@@ -0,0 +1,54 @@
+package importing
+
+import (
+	"github.com/paulmach/osm"
+	"soq/common"
+	"soq/feature"
+	"testing"
+	"time"
+)
+
+func TestVisibleObjectsHandler(t *testing.T) {
+	// Arrange
+	handler := &countingDataHandler{}
+	visibleHandler := newVisibleObjectsHandler(handler)
+
+	// Act
+	common.AssertNil(t, visibleHandler.HandleNode(&osm.Node{ID: 1, Visible: true}))
+	common.AssertNil(t, visibleHandler.HandleNode(&osm.Node{ID: 1, Visible: false}))
+	common.AssertNil(t, visibleHandler.HandleWay(&osm.Way{ID: 10, Visible: false}))
+	common.AssertNil(t, visibleHandler.HandleRelation(&osm.Relation{ID: 20, Visible: true}))
+
+	// Assert
+	common.AssertEqual(t, 1, handler.nodes)
+	common.AssertEqual(t, 0, handler.ways)
+	common.AssertEqual(t, 1, handler.relations)
+}
+
+func TestVersionBuffer(t *testing.T) {
+	// Arrange
+	var writtenIds []int64
+	var writtenValidities []feature.Validity
+	buffer := newVersionBuffer(func(id int64, validity *feature.Validity) error {
+		writtenIds = append(writtenIds, id)
+		writtenValidities = append(writtenValidities, *validity)
+		return nil
+	})
+
+	// Act
+	common.AssertNil(t, buffer.add(1, 1, time.Unix(100, 0), true))
+	common.AssertNil(t, buffer.add(1, 1, time.Unix(200, 0), true))
+	common.AssertNil(t, buffer.add(2, 2, time.Unix(150, 0), true))
+	common.AssertNil(t, buffer.add(2, 2, time.Unix(300, 0), false))
+	common.AssertNil(t, buffer.add(3, 3, time.Unix(400, 0), true))
+	common.AssertNil(t, buffer.flush())
+
+	// Assert
+	common.AssertEqual(t, []int64{1, 1, 2, 3}, writtenIds)
+	common.AssertEqual(t, []feature.Validity{
+		{From: 100, To: 200},
+		{From: 200, To: feature.ValidForever},
+		{From: 150, To: 300},
+		{From: 400, To: feature.ValidForever},
+	}, writtenValidities)
+}
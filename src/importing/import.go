@@ -2,45 +2,189 @@ package importing
 
 import (
 	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 	"github.com/pkg/errors"
 	"os"
 	"path"
 	"soq/common"
+	"soq/encoding"
 	"soq/feature"
 	"soq/index"
 	"soq/osm"
+	"soq/parser"
 	"strings"
 	"time"
 )
 
-func Import(inputFile string, cellWidth float64, cellHeight float64, indexBaseFolder string) error {
+// TemporaryFeatureFolder is the folder within the index folder, in which the temporary features are stored during the
+// import. It's removed once the grid-index has been created.
+const TemporaryFeatureFolder = "import-temp-cell"
+
+// SubExtentsFilename is the GeoJSON file within the index folder with the sub-extents, in which the import processed the
+// temporary features.
+const SubExtentsFilename = "sub-extents.geojson"
+
+// ImportOptions configure what Import stores in the index and how.
+type ImportOptions struct {
+	CellScheme common.CellScheme
+	// Cells with more features of one object type than this threshold are split into sub-cells, 0 disables splitting.
+	CellSplitThreshold  int
+	CoordinatePrecision encoding.CoordinatePrecision
+	// Nodes without tags are not stored as standalone features, which reduces the index size noticeably.
+	SkipUntaggedNodes bool
+	// Store the changeset and user of each object, which enables the "changeset" and "user" filters.
+	StoreMetadata bool
+	// The input is a full-history file. All versions of the objects are stored with their validity interval, which
+	// enables queries at a point in time ("at" clause).
+	History bool
+	// Sync all index files and folders to the storage device at the end of each import step.
+	Durable bool
+	// Identical input files result in byte-identical indices.
+	Reproducible bool
+	// Only objects within this polygon are imported, s. ClipFilter for details. Nil means no clipping.
+	ClipPolygon orb.MultiPolygon
+	// Only objects matching this filter expression are imported, s. KeepFilter for details. Empty means all objects.
+	KeepExpression string
+	// Tags added to the objects after the clip polygon and keep expression have been applied, so the keep expression
+	// can't use them.
+	DerivedTags DerivedTags
+	// Additional handlers running during the tag-index creation. They therefore see the same objects as the index, i.e.
+	// only the objects within the clip polygon and matching the keep expression and, for full-history files, only the
+	// visible versions.
+	Handlers []osm.OsmDataHandler
+}
+
+// Import reads the given OSM file and creates the tag-index and grid-index in the given folder. The index is written into
+// a new version folder, which replaces the existing index only once the import finished (s. index.ActivateIndexVersion).
+// Readers of the existing index are therefore not affected by a running or failed import.
+func Import(inputFile string, indexBaseFolder string, options ImportOptions, settings common.Settings) error {
 	if !strings.HasSuffix(inputFile, ".osm") && !strings.HasSuffix(inputFile, ".pbf") {
-		sigolo.Error("Input file must be an .osm or .pbf file")
-		os.Exit(1)
+		return errors.Errorf("Input file %s must be an .osm or .pbf file", inputFile)
+	}
+
+	if options.KeepExpression != "" {
+		// Check the syntax before reading the input data. The actual expression needs the tag-index of the data.
+		emptyTagIndex := index.NewTagIndex([]string{}, [][]string{})
+		emptyTagIndex.SetUsers([]string{})
+		_, err := parser.ParseFilterExpression(options.KeepExpression, emptyTagIndex)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid keep expression '%s'", options.KeepExpression)
+		}
+	}
+
+	versionFolder, err := index.NewIndexVersionFolder(indexBaseFolder)
+	if err != nil {
+		return err
 	}
 
+	err = importIntoFolder(inputFile, versionFolder, options, settings)
+	if err != nil {
+		removeErr := os.RemoveAll(versionFolder)
+		if removeErr != nil {
+			sigolo.Warnf("Unable to remove folder %s of the failed import: %+v", versionFolder, removeErr)
+		}
+		return err
+	}
+
+	return index.ActivateIndexVersion(indexBaseFolder, versionFolder, options.Durable)
+}
+
+// importIntoFolder creates the tag-index and grid-index in the given empty folder.
+func importIntoFolder(inputFile string, indexBaseFolder string, options ImportOptions, settings common.Settings) error {
 	baseFolder := path.Join(indexBaseFolder, index.GridIndexFolder)
 
 	sigolo.Infof("Start import of OSM data file %s", inputFile)
 	importStartTime := time.Now()
 
+	// Deleted versions in full-history files only end the validity of the previous version of the object. Therefore, only
+	// the temporary feature importer gets them and all other handlers only see the visible versions.
+	visible := func(handler osm.OsmDataHandler) osm.OsmDataHandler { return handler }
+	if options.History {
+		visible = newVisibleObjectsHandler
+	}
+
 	// TODO Idea: Determine node density during tag index creation. The write temp features into the cell-extents instead of one huge file. This prevents reading this huge file over and over again.
 
+	//
+	// 0. Determine objects within the clip polygon and matching the keep expression
+	//
+	// All other steps only see these objects, so the index only contains them.
+	filter := func(handler osm.OsmDataHandler) osm.OsmDataHandler { return handler }
+	if options.ClipPolygon != nil {
+		sigolo.Info("Determine objects within clip polygon")
+		currentStepStartTime := time.Now()
+
+		clipFilter := NewClipFilter(options.ClipPolygon)
+		err := osm.NewOsmReader(settings.ImportWorkers).Read(inputFile, visible(clipFilter))
+		if err != nil {
+			return errors.Wrapf(err, "Error clipping OSM data")
+		}
+		filter = clipFilter.Wrap
+
+		sigolo.Infof("Found %d nodes, %d ways and %d relations within clip polygon in %s", len(clipFilter.nodeIds), len(clipFilter.wayIds), len(clipFilter.relationIds), time.Since(currentStepStartTime))
+	}
+
+	if options.KeepExpression != "" {
+		sigolo.Info("Determine objects matching the keep expression")
+		currentStepStartTime := time.Now()
+
+		// The expression can only be parsed with a tag-index of the whole data. This tag-index is not stored, the
+		// stored one only contains the tags of the kept objects. The users are always collected, so that the expression
+		// can filter by user.
+		tagIndexCreator := index.NewTagIndexCreator(true)
+		err := osm.NewOsmReader(settings.ImportWorkers).Read(inputFile, filter(visible(tagIndexCreator)))
+		if err != nil {
+			return errors.Wrapf(err, "Error creating temporary tag-index")
+		}
+
+		fullTagIndex := tagIndexCreator.CreateTagIndex()
+		expression, err := parser.ParseFilterExpression(options.KeepExpression, fullTagIndex)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid keep expression '%s'", options.KeepExpression)
+		}
+
+		keepFilter := NewKeepFilter(expression, fullTagIndex)
+		err = osm.NewOsmReader(settings.ImportWorkers).Read(inputFile, filter(visible(keepFilter)))
+		if err != nil {
+			return errors.Wrapf(err, "Error filtering OSM data")
+		}
+
+		clip := filter
+		filter = func(handler osm.OsmDataHandler) osm.OsmDataHandler { return clip(keepFilter.Wrap(handler)) }
+
+		sigolo.Infof("Found %d nodes, %d ways and %d relations matching the keep expression in %s", len(keepFilter.nodeIds), len(keepFilter.wayIds), len(keepFilter.relationIds), time.Since(currentStepStartTime))
+	}
+
+	// All following steps get the objects with their derived tags, so that they're part of the tag-index and features.
+	if len(options.DerivedTags) > 0 {
+		keep := filter
+		filter = func(handler osm.OsmDataHandler) osm.OsmDataHandler { return keep(options.DerivedTags.Wrap(handler)) }
+	}
+
 	//
 	// 1. Create tag index
 	//
 	sigolo.Info("Create tag-index")
 	currentStepStartTime := time.Now()
 
-	tagIndexCreator := index.NewTagIndexCreator()
-	osmDensityAggregator := osm.NewOsmDensityAggregator(cellWidth, cellHeight)
+	// The users are only needed when the metadata is stored. Without users, the temporary features contain no metadata.
+	tagIndexCreator := index.NewTagIndexCreator(options.StoreMetadata)
+	osmDensityAggregator := osm.NewOsmDensityAggregator(options.CellScheme)
+
+	tagIndexHandlers := []osm.OsmDataHandler{filter(visible(tagIndexCreator)), filter(visible(osmDensityAggregator))}
+	for _, handler := range options.Handlers {
+		tagIndexHandlers = append(tagIndexHandlers, filter(visible(handler)))
+	}
 
-	osmReader := osm.NewOsmReader()
-	err := osmReader.Read(inputFile, tagIndexCreator, osmDensityAggregator)
+	osmReader := osm.NewOsmReader(settings.ImportWorkers)
+	err := osmReader.Read(inputFile, tagIndexHandlers...)
 	if err != nil {
 		return errors.Wrapf(err, "Error importing OSM data")
 	}
+	if osmDensityAggregator.InputDataCellExtent == nil {
+		return errors.New("No nodes found in the input data, nothing to import")
+	}
 
 	sigolo.Debugf("Create and save tag-index")
 	tagIndex := tagIndexCreator.CreateTagIndex()
@@ -49,6 +193,16 @@ func Import(inputFile string, cellWidth float64, cellHeight float64, indexBaseFo
 	if err != nil {
 		return errors.Wrapf(err, "Error writing tag index file to %s", index.TagIndexFilename)
 	}
+	if options.Durable {
+		tagIndexFiles := []string{path.Join(indexBaseFolder, index.TagIndexFilename), path.Join(indexBaseFolder, index.TagIndexCountsFilename)}
+		if options.StoreMetadata {
+			tagIndexFiles = append(tagIndexFiles, path.Join(indexBaseFolder, index.TagIndexUsersFilename))
+		}
+		err = common.SyncFilesAndDirectories(tagIndexFiles...)
+		if err != nil {
+			return errors.Wrapf(err, "Error syncing tag index to storage device")
+		}
+	}
 	sigolo.Debugf("Tag-index creation done and stored to disk")
 
 	duration := time.Since(currentStepStartTime)
@@ -94,14 +248,15 @@ func Import(inputFile string, cellWidth float64, cellHeight float64, indexBaseFo
 	// TODO Make the GeoJSON creation configurable
 	featureCollection := geojson.NewFeatureCollection()
 	for _, subExtent := range subExtents {
-		geoJsonFeature := geojson.NewFeature(subExtent.ToPolygon(cellWidth, cellHeight))
+		geoJsonFeature := geojson.NewFeature(subExtent.ToPolygon(options.CellScheme))
 		featureCollection.Features = append(featureCollection.Features, geoJsonFeature)
 	}
 	geojsonBytes, err := featureCollection.MarshalJSON()
 	if err != nil {
 		sigolo.Warnf("Error marshalling sub-extents to GeoJSON: %+v", err)
 	} else {
-		err = os.WriteFile("./sub-extents.geojson", geojsonBytes, 0644)
+		subExtentsFile := path.Join(indexBaseFolder, SubExtentsFilename)
+		err = os.WriteFile(subExtentsFile, geojsonBytes, 0644)
 		if err != nil {
 			sigolo.Warnf("Error writing sub-extent GeoJSON file: %+v", err)
 		}
@@ -113,11 +268,11 @@ func Import(inputFile string, cellWidth float64, cellHeight float64, indexBaseFo
 	sigolo.Info("Write temporary features")
 	currentStepStartTime = time.Now()
 
-	tmpFeatureRepo := NewTemporaryFeatureRepository(cellWidth, cellHeight, "import-temp-cell")
-	temporaryFeatureImporter := NewTemporaryFeatureImporter(tmpFeatureRepo, tagIndex, subExtents, cellWidth, cellHeight)
+	tmpFeatureRepo := NewTemporaryFeatureRepository(options.CellScheme, path.Join(indexBaseFolder, TemporaryFeatureFolder))
+	temporaryFeatureImporter := NewTemporaryFeatureImporter(tmpFeatureRepo, tagIndex, subExtents, options.CellScheme, options.History)
 
-	osmReader = osm.NewOsmReader()
-	err = osmReader.Read(inputFile, temporaryFeatureImporter)
+	osmReader = osm.NewOsmReader(settings.ImportWorkers)
+	err = osmReader.Read(inputFile, filter(temporaryFeatureImporter))
 	if err != nil {
 		return errors.Wrapf(err, "Error importing OSM data")
 	}
@@ -131,11 +286,7 @@ func Import(inputFile string, cellWidth float64, cellHeight float64, indexBaseFo
 	sigolo.Info("Read temp features and write them as normal features into cells")
 	currentStepStartTime = time.Now()
 
-	sigolo.Debugf("Remove the grid-index base folder %s", baseFolder)
-	err = os.RemoveAll(baseFolder)
-	if err != nil {
-		return errors.Wrapf(err, "Unable to remove grid-index base folder %s", baseFolder)
-	}
+	keyStatistics := index.NewKeyStatistics()
 
 	sigolo.Debugf("Start processing %d sub-extents", len(subExtents))
 	for i, subExtent := range subExtents {
@@ -143,11 +294,19 @@ func Import(inputFile string, cellWidth float64, cellHeight float64, indexBaseFo
 		sigolo.Debugf("=== Process sub-extent %v (%d / %d) ===", subExtent, i+1, len(subExtents))
 
 		tmpFeatureChannel := make(chan feature.Feature, 1000)
-		go tmpFeatureRepo.ReadFeatures(tmpFeatureChannel, subExtent) // TODO error handling
-		err = index.ImportTempFeatures(tmpFeatureChannel, baseFolder, cellWidth, cellHeight, subExtent)
+		readErrChannel := make(chan error, 1)
+		go func() {
+			readErrChannel <- tmpFeatureRepo.ReadFeatures(tmpFeatureChannel, subExtent)
+		}()
+		err = index.ImportTempFeatures(tmpFeatureChannel, baseFolder, options.CellScheme, subExtent, tagIndex, options.SkipUntaggedNodes, options.Durable, keyStatistics, options.CellSplitThreshold, options.Reproducible, options.CoordinatePrecision)
+		// The channel is drained by ImportTempFeatures in case of an error, so the reading always finishes.
+		readErr := <-readErrChannel
 		if err != nil {
 			return err
 		}
+		if readErr != nil {
+			return readErr
+		}
 
 		duration = time.Since(currentSubExtentStartTime)
 		sigolo.Debugf("Processed sub-extent %v in %s", subExtent, duration)
@@ -156,6 +315,52 @@ func Import(inputFile string, cellWidth float64, cellHeight float64, indexBaseFo
 	duration = time.Since(currentStepStartTime)
 	sigolo.Infof("Created grid index in %s", duration)
 
+	err = tmpFeatureRepo.Clear()
+	if err != nil {
+		return err
+	}
+
+	err = keyStatistics.SaveToFile(indexBaseFolder)
+	if err != nil {
+		return err
+	}
+
+	createdAt := time.Now()
+	if options.Reproducible {
+		// The creation time must not depend on when the import ran. The modification time of the input file still
+		// changes with new data, which is what the server needs to detect a new index.
+		inputFileInfo, err := os.Stat(inputFile)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to get modification time of input file %s", inputFile)
+		}
+		createdAt = inputFileInfo.ModTime().UTC()
+	}
+
+	extent := inputDataCellExtent.ToPolygon(options.CellScheme).Bound()
+	metadata := &index.IndexMetadata{
+		FormatVersion:        index.FormatVersion,
+		UntaggedNodesSkipped: options.SkipUntaggedNodes,
+		MetadataStored:       options.StoreMetadata,
+		History:              options.History,
+		CellKeyBitmaps:       true,
+		Extent:               &extent,
+		CellScheme:           options.CellScheme.Name(),
+		CellSplitThreshold:   options.CellSplitThreshold,
+		CoordinatePrecision:  options.CoordinatePrecision,
+		CreatedAt:            createdAt,
+	}
+	// The metadata file is written last and marks the index as complete.
+	err = metadata.SaveToFile(indexBaseFolder)
+	if err != nil {
+		return err
+	}
+	if options.Durable {
+		err = common.SyncFilesAndDirectories(path.Join(indexBaseFolder, index.KeyStatisticsFilename), path.Join(indexBaseFolder, index.MetadataFilename))
+		if err != nil {
+			return errors.Wrapf(err, "Error syncing index metadata to storage device")
+		}
+	}
+
 	duration = time.Since(importStartTime)
 	sigolo.Infof("Finished import in %s", duration)
 
@@ -1,23 +1,62 @@
 package importing
 
 import (
+	"os"
+	"path"
 	"soq/common"
+	"soq/encoding"
 	"soq/index"
 	"testing"
 )
 
+func newTestImportOptions() ImportOptions {
+	return ImportOptions{
+		CellScheme:          &common.LatLonCellScheme{CellWidth: 0.1, CellHeight: 0.1},
+		CoordinatePrecision: encoding.CoordinatePrecisionFloat32,
+	}
+}
+
+func TestImport_unknownFileExtension(t *testing.T) {
+	// Act
+	err := Import("data.json", t.TempDir(), newTestImportOptions(), common.DefaultSettings())
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestImport_temporaryFilesWithinIndexFolder(t *testing.T) {
+	// Arrange
+	indexBaseFolder := t.TempDir()
+
+	// Act
+	err := Import("../../test-small.osm", indexBaseFolder, newTestImportOptions(), common.DefaultSettings())
+
+	// Assert
+	common.AssertNil(t, err)
+	_, err = os.Stat(path.Join(indexBaseFolder, index.MetadataFilename))
+	common.AssertNil(t, err)
+	_, err = os.Stat(path.Join(indexBaseFolder, SubExtentsFilename))
+	common.AssertNil(t, err)
+	_, err = os.Stat(path.Join(indexBaseFolder, TemporaryFeatureFolder))
+	common.AssertTrue(t, os.IsNotExist(err))
+	_, err = os.Stat(TemporaryFeatureFolder)
+	common.AssertTrue(t, os.IsNotExist(err))
+	_, err = os.Stat(SubExtentsFilename)
+	common.AssertTrue(t, os.IsNotExist(err))
+}
+
 func TestImport_getNextExtent(t *testing.T) {
-	c00 := index.CellIndex{0, 0}
-	c10 := index.CellIndex{1, 0}
-	c20 := index.CellIndex{2, 0}
-	c01 := index.CellIndex{0, 1}
-	c11 := index.CellIndex{1, 1}
-	c21 := index.CellIndex{2, 1}
-	c02 := index.CellIndex{0, 2}
-	c12 := index.CellIndex{1, 2}
-	c22 := index.CellIndex{2, 2}
-
-	cellsToProcessedState := map[index.CellIndex]bool{}
+	c00 := common.CellIndex{0, 0}
+	c10 := common.CellIndex{1, 0}
+	c20 := common.CellIndex{2, 0}
+	c01 := common.CellIndex{0, 1}
+	c11 := common.CellIndex{1, 1}
+	c21 := common.CellIndex{2, 1}
+	c02 := common.CellIndex{0, 2}
+	c12 := common.CellIndex{1, 2}
+	c22 := common.CellIndex{2, 2}
+
+	cellsToProcessedState := map[common.CellIndex]bool{}
 
 	cellsToProcessedState[c00] = false
 	cellsToProcessedState[c10] = false
@@ -31,7 +70,7 @@ func TestImport_getNextExtent(t *testing.T) {
 	cellsToProcessedState[c12] = false
 	cellsToProcessedState[c22] = false
 
-	cellToNodeCount := map[index.CellIndex]int{}
+	cellToNodeCount := map[common.CellIndex]int{}
 
 	/*
 		10	3	0
@@ -52,36 +91,36 @@ func TestImport_getNextExtent(t *testing.T) {
 	cellToNodeCount[c22] = 0
 
 	extent := getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{0, 0}, index.CellIndex{1, 1}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{0, 0}, common.CellIndex{1, 1}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{2, 0}, index.CellIndex{2, 0}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{2, 0}, common.CellIndex{2, 0}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{2, 1}, index.CellIndex{2, 1}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{2, 1}, common.CellIndex{2, 1}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{0, 2}, index.CellIndex{0, 2}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{0, 2}, common.CellIndex{0, 2}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{1, 2}, index.CellIndex{2, 2}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{1, 2}, common.CellIndex{2, 2}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
 	common.AssertNil(t, extent)
 }
 
 func TestImport_getNextExtent_rightMostExtent(t *testing.T) {
-	c00 := index.CellIndex{0, 0}
-	c10 := index.CellIndex{1, 0}
-	c20 := index.CellIndex{2, 0}
-	c01 := index.CellIndex{0, 1}
-	c11 := index.CellIndex{1, 1}
-	c21 := index.CellIndex{2, 1}
-	c02 := index.CellIndex{0, 2}
-	c12 := index.CellIndex{1, 2}
-	c22 := index.CellIndex{2, 2}
-
-	cellsToProcessedState := map[index.CellIndex]bool{}
+	c00 := common.CellIndex{0, 0}
+	c10 := common.CellIndex{1, 0}
+	c20 := common.CellIndex{2, 0}
+	c01 := common.CellIndex{0, 1}
+	c11 := common.CellIndex{1, 1}
+	c21 := common.CellIndex{2, 1}
+	c02 := common.CellIndex{0, 2}
+	c12 := common.CellIndex{1, 2}
+	c22 := common.CellIndex{2, 2}
+
+	cellsToProcessedState := map[common.CellIndex]bool{}
 
 	cellsToProcessedState[c00] = false
 	cellsToProcessedState[c10] = false
@@ -95,7 +134,7 @@ func TestImport_getNextExtent_rightMostExtent(t *testing.T) {
 	cellsToProcessedState[c12] = false
 	cellsToProcessedState[c22] = false
 
-	cellToNodeCount := map[index.CellIndex]int{}
+	cellToNodeCount := map[common.CellIndex]int{}
 
 	/*
 		1	2	0
@@ -116,16 +155,16 @@ func TestImport_getNextExtent_rightMostExtent(t *testing.T) {
 	cellToNodeCount[c22] = 0
 
 	extent := getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{0, 0}, index.CellIndex{1, 0}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{0, 0}, common.CellIndex{1, 0}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{2, 0}, index.CellIndex{2, 2}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{2, 0}, common.CellIndex{2, 2}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{0, 1}, index.CellIndex{1, 1}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{0, 1}, common.CellIndex{1, 1}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
-	common.AssertEqual(t, &index.CellExtent{index.CellIndex{0, 2}, index.CellIndex{1, 2}}, extent)
+	common.AssertEqual(t, &common.CellExtent{common.CellIndex{0, 2}, common.CellIndex{1, 2}}, extent)
 
 	extent = getNextExtent(cellsToProcessedState, cellToNodeCount, 5)
 	common.AssertNil(t, extent)
@@ -0,0 +1,118 @@
+package importing
+
+import (
+	"github.com/paulmach/osm"
+	"soq/index"
+	"soq/query"
+)
+
+// KeepFilter implements the OsmDataHandler and determines which OSM objects match a filter expression (e.g.
+// "highway=* OR railway=*"). The direct members of matching relations are kept as well, so that the geometry of the
+// relations can be built.
+//
+// This handler must see the whole data before other handlers can be wrapped with Wrap to only receive the kept objects.
+type KeepFilter struct {
+	objectFilter
+	expression query.FilterExpression
+	tagIndex   *index.TagIndex
+}
+
+// NewKeepFilter creates a filter for the given expression. The tag-index must contain all tags of the data, since tags
+// unknown to the tag-index can't be evaluated.
+func NewKeepFilter(expression query.FilterExpression, tagIndex *index.TagIndex) *KeepFilter {
+	return &KeepFilter{
+		objectFilter: newObjectFilter(),
+		expression:   expression,
+		tagIndex:     tagIndex,
+	}
+}
+
+func (k *KeepFilter) Name() string {
+	return "KeepFilter"
+}
+
+func (k *KeepFilter) Init() error {
+	return nil
+}
+
+func (k *KeepFilter) HandleNode(node *osm.Node) error {
+	encodedKeys, encodedValues := k.tagIndex.EncodeTags(node.Tags)
+	applies, err := k.expression.Applies(&index.EncodedNodeFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       uint64(node.ID),
+			Keys:     encodedKeys,
+			Values:   encodedValues,
+			Metadata: k.tagIndex.EncodeMetadata(node.ChangesetID, node.User),
+		},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if applies {
+		k.nodeIds[node.ID] = true
+	}
+	return nil
+}
+
+func (k *KeepFilter) HandleWay(way *osm.Way) error {
+	encodedKeys, encodedValues := k.tagIndex.EncodeTags(way.Tags)
+	applies, err := k.expression.Applies(&index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       uint64(way.ID),
+			Keys:     encodedKeys,
+			Values:   encodedValues,
+			Metadata: k.tagIndex.EncodeMetadata(way.ChangesetID, way.User),
+		},
+		Nodes: way.Nodes,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if applies {
+		k.wayIds[way.ID] = true
+	}
+	return nil
+}
+
+func (k *KeepFilter) HandleRelation(relation *osm.Relation) error {
+	if k.relationIds[relation.ID] {
+		// Already kept as member of another relation
+		return nil
+	}
+
+	encodedKeys, encodedValues := k.tagIndex.EncodeTags(relation.Tags)
+	applies, err := k.expression.Applies(&index.EncodedRelationFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       uint64(relation.ID),
+			Keys:     encodedKeys,
+			Values:   encodedValues,
+			Metadata: k.tagIndex.EncodeMetadata(relation.ChangesetID, relation.User),
+		},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !applies {
+		return nil
+	}
+
+	k.relationIds[relation.ID] = true
+	for _, member := range relation.Members {
+		switch member.Type {
+		case osm.TypeNode:
+			k.nodeIds[osm.NodeID(member.Ref)] = true
+		case osm.TypeWay:
+			k.wayIds[osm.WayID(member.Ref)] = true
+		case osm.TypeRelation:
+			k.relationIds[osm.RelationID(member.Ref)] = true
+		}
+	}
+
+	return nil
+}
+
+func (k *KeepFilter) Done() error {
+	return nil
+}
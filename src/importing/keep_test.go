@@ -0,0 +1,33 @@
+package importing
+
+import (
+	"github.com/paulmach/osm"
+	"soq/common"
+	"soq/index"
+	"soq/parser"
+	"testing"
+)
+
+func TestKeepFilter(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "highway", "type"}, [][]string{{"bench"}, {"primary"}, {"route"}})
+	expression, err := parser.ParseFilterExpression("highway=* OR type=route", tagIndex)
+	common.AssertNil(t, err)
+	keepFilter := NewKeepFilter(expression, tagIndex)
+
+	// Act
+	common.AssertNil(t, keepFilter.HandleNode(&osm.Node{ID: 1, Tags: osm.Tags{{Key: "amenity", Value: "bench"}}}))
+	common.AssertNil(t, keepFilter.HandleNode(&osm.Node{ID: 2, Tags: osm.Tags{{Key: "highway", Value: "primary"}}}))
+	common.AssertNil(t, keepFilter.HandleWay(&osm.Way{ID: 10, Tags: osm.Tags{{Key: "highway", Value: "primary"}}}))
+	common.AssertNil(t, keepFilter.HandleWay(&osm.Way{ID: 11, Tags: osm.Tags{{Key: "amenity", Value: "bench"}}}))
+	common.AssertNil(t, keepFilter.HandleWay(&osm.Way{ID: 12}))
+	common.AssertNil(t, keepFilter.HandleRelation(&osm.Relation{ID: 20, Tags: osm.Tags{{Key: "type", Value: "route"}}, Members: osm.Members{{Type: osm.TypeWay, Ref: 12}, {Type: osm.TypeNode, Ref: 3}, {Type: osm.TypeRelation, Ref: 21}}}))
+	common.AssertNil(t, keepFilter.HandleRelation(&osm.Relation{ID: 21}))
+	common.AssertNil(t, keepFilter.HandleRelation(&osm.Relation{ID: 22}))
+	common.AssertNil(t, keepFilter.Done())
+
+	// Assert
+	common.AssertEqual(t, map[osm.NodeID]bool{2: true, 3: true}, keepFilter.nodeIds)
+	common.AssertEqual(t, map[osm.WayID]bool{10: true, 12: true}, keepFilter.wayIds)
+	common.AssertEqual(t, map[osm.RelationID]bool{20: true, 21: true}, keepFilter.relationIds)
+}
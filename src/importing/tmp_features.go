@@ -2,16 +2,15 @@ package importing
 
 import (
 	"bufio"
-	"encoding/binary"
 	"fmt"
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/osm"
 	"github.com/pkg/errors"
 	"io"
-	"math"
 	"os"
 	"soq/common"
+	"soq/encoding"
 	"soq/feature"
 	"soq/index"
 	ownIo "soq/io"
@@ -41,12 +40,20 @@ type TemporaryFeatureImporter struct {
 	relationWriter         *bufio.Writer
 	relationFile           *os.File
 	cellExtents            []common.CellExtent
-	cellWidth              float64
-	cellHeight             float64
+	cellScheme             common.CellScheme
+
+	// When true, the input contains all versions of the objects, which are written with their validity interval.
+	history          bool
+	nodeVersions     *versionBuffer[*osm.Node]
+	wayVersions      *versionBuffer[*osm.Way]
+	relationVersions *versionBuffer[*osm.Relation]
 }
 
-func NewTemporaryFeatureImporter(repository *TemporaryFeatureRepository, tagIndex *index.TagIndex, cellExtents []common.CellExtent, cellWidth float64, cellHeight float64) *TemporaryFeatureImporter {
-	return &TemporaryFeatureImporter{
+// NewTemporaryFeatureImporter creates an importer writing the OSM objects into temporary cell files of the given
+// extents. When history is true, the input must be a full-history file and each version is written as separate feature
+// with its validity interval.
+func NewTemporaryFeatureImporter(repository *TemporaryFeatureRepository, tagIndex *index.TagIndex, cellExtents []common.CellExtent, cellScheme common.CellScheme, history bool) *TemporaryFeatureImporter {
+	importer := &TemporaryFeatureImporter{
 		repository:             repository,
 		tagIndex:               tagIndex,
 		tagIndexTempValueArray: tagIndex.NewTempEncodedValueArray(),
@@ -55,9 +62,13 @@ func NewTemporaryFeatureImporter(repository *TemporaryFeatureRepository, tagInde
 		wayWriter:              map[common.CellExtent]*bufio.Writer{},
 		wayFiles:               map[common.CellExtent]*os.File{},
 		cellExtents:            cellExtents,
-		cellWidth:              cellWidth,
-		cellHeight:             cellHeight,
+		cellScheme:             cellScheme,
+		history:                history,
 	}
+	importer.nodeVersions = newVersionBuffer(importer.writeNode)
+	importer.wayVersions = newVersionBuffer(importer.writeWay)
+	importer.relationVersions = newVersionBuffer(importer.writeRelation)
+	return importer
 }
 
 func (i *TemporaryFeatureImporter) Name() string {
@@ -98,9 +109,16 @@ func (i *TemporaryFeatureImporter) Init() error {
 }
 
 func (i *TemporaryFeatureImporter) HandleNode(node *osm.Node) error {
+	if i.history {
+		return i.nodeVersions.add(node, int64(node.ID), node.Timestamp, node.Visible)
+	}
+	return i.writeNode(node, nil)
+}
+
+func (i *TemporaryFeatureImporter) writeNode(node *osm.Node, validity *feature.Validity) error {
 	var writer io.Writer
 	for _, cellExtent := range i.cellExtents {
-		if cellExtent.ContainsLonLat(node.Lon, node.Lat, i.cellWidth, i.cellHeight) {
+		if cellExtent.ContainsLonLat(node.Lon, node.Lat, i.cellScheme) {
 			writer = i.nodeWriter[cellExtent]
 			break
 		}
@@ -110,17 +128,26 @@ func (i *TemporaryFeatureImporter) HandleNode(node *osm.Node) error {
 	}
 
 	encodedKeys, encodedValues := i.tagIndex.EncodeTags(node.Tags)
+	metadata := i.tagIndex.EncodeMetadata(node.ChangesetID, node.User)
 	point := node.Point()
-	return i.repository.writeNodeData(node.ID, encodedKeys, encodedValues, &point, writer)
+	return i.repository.writeNodeData(node.ID, encodedKeys, encodedValues, metadata, validity, &point, writer)
 }
 
 func (i *TemporaryFeatureImporter) HandleWay(way *osm.Way) error {
+	if i.history {
+		return i.wayVersions.add(way, int64(way.ID), way.Timestamp, way.Visible)
+	}
+	return i.writeWay(way, nil)
+}
+
+func (i *TemporaryFeatureImporter) writeWay(way *osm.Way, validity *feature.Validity) error {
 	encodedKeys, encodedValues := i.tagIndex.EncodeTags(way.Tags)
-	data := i.repository.getWayData(way.ID, encodedKeys, encodedValues, way.Nodes)
+	metadata := i.tagIndex.EncodeMetadata(way.ChangesetID, way.User)
+	data := i.repository.getWayData(way.ID, encodedKeys, encodedValues, metadata, validity, way.Nodes)
 
 	for _, cellExtent := range i.cellExtents {
 		for _, node := range way.Nodes {
-			if cellExtent.ContainsLonLat(node.Lon, node.Lat, i.cellWidth, i.cellHeight) {
+			if cellExtent.ContainsLonLat(node.Lon, node.Lat, i.cellScheme) {
 				writer := i.wayWriter[cellExtent]
 				_, err := writer.Write(data)
 				if err != nil {
@@ -135,30 +162,63 @@ func (i *TemporaryFeatureImporter) HandleWay(way *osm.Way) error {
 }
 
 func (i *TemporaryFeatureImporter) HandleRelation(relation *osm.Relation) error {
+	if i.history {
+		return i.relationVersions.add(relation, int64(relation.ID), relation.Timestamp, relation.Visible)
+	}
+	return i.writeRelation(relation, nil)
+}
+
+func (i *TemporaryFeatureImporter) writeRelation(relation *osm.Relation, validity *feature.Validity) error {
 	var nodeIds []osm.NodeID
 	var wayIds []osm.WayID
 	var childRelationIds []osm.RelationID
+	var nodeRoles []string
+	var wayRoles []string
+	var childRelationRoles []string
+	var memberTypes []ownOsm.OsmObjectType
 
 	for _, member := range relation.Members {
 		switch member.Type {
 		case osm.TypeNode:
 			nodeId := osm.NodeID(member.Ref)
 			nodeIds = append(nodeIds, nodeId)
+			nodeRoles = append(nodeRoles, member.Role)
+			memberTypes = append(memberTypes, ownOsm.OsmObjNode)
 		case osm.TypeWay:
 			wayId := osm.WayID(member.Ref)
 			wayIds = append(wayIds, wayId)
+			wayRoles = append(wayRoles, member.Role)
+			memberTypes = append(memberTypes, ownOsm.OsmObjWay)
 		case osm.TypeRelation:
 			relId := osm.RelationID(member.Ref)
 			childRelationIds = append(childRelationIds, relId)
+			childRelationRoles = append(childRelationRoles, member.Role)
+			memberTypes = append(memberTypes, ownOsm.OsmObjRelation)
 		}
 	}
 
 	encodedKeys, encodedValues := i.tagIndex.EncodeTags(relation.Tags)
-	return i.repository.writeRelationData(relation.ID, encodedKeys, encodedValues, nodeIds, wayIds, childRelationIds, i.relationWriter)
+	metadata := i.tagIndex.EncodeMetadata(relation.ChangesetID, relation.User)
+	return i.repository.writeRelationData(relation.ID, encodedKeys, encodedValues, metadata, validity, nodeIds, wayIds, childRelationIds, nodeRoles, wayRoles, childRelationRoles, memberTypes, i.relationWriter)
 }
 
 func (i *TemporaryFeatureImporter) Done() error {
 	var err error
+	if i.history {
+		err = i.nodeVersions.flush()
+		if err != nil {
+			return err
+		}
+		err = i.wayVersions.flush()
+		if err != nil {
+			return err
+		}
+		err = i.relationVersions.flush()
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, writer := range i.nodeWriter {
 		err = writer.Flush()
 		if err != nil {
@@ -201,11 +261,10 @@ type TemporaryFeatureRepository struct {
 	index.BaseGridIndex
 }
 
-func NewTemporaryFeatureRepository(cellWidth float64, cellHeight float64, baseFolder string) *TemporaryFeatureRepository {
+func NewTemporaryFeatureRepository(cellScheme common.CellScheme, baseFolder string) *TemporaryFeatureRepository {
 	gridIndexWriter := &TemporaryFeatureRepository{
 		BaseGridIndex: index.BaseGridIndex{
-			CellWidth:  cellWidth,
-			CellHeight: cellHeight,
+			CellScheme: cellScheme,
 			BaseFolder: baseFolder,
 		},
 	}
@@ -222,436 +281,268 @@ func (r *TemporaryFeatureRepository) Clear() error {
 	return nil
 }
 
-func (r *TemporaryFeatureRepository) writeNodeData(id osm.NodeID, keys []int, values []int, point *orb.Point, f io.Writer) error {
-	/*
-		Entry format:
-
-		Names: | osmId | lon | lat | num. tags |          encodedTags          |
-		Bytes: |   8   |  4  |  4  |     2     | key (32 bit) | value (32 bit) |
-
-		Tags are stored as a list of "num. tags" many key-value-pairs.
-	*/
-
-	if len(keys) != len(values) {
-		return errors.Errorf("Number of keys and values for node %d different: keys %d, values %d", id, len(keys), len(values))
+func (r *TemporaryFeatureRepository) writeNodeData(id osm.NodeID, keys []int, values []int, metadata *feature.Metadata, validity *feature.Validity, point *orb.Point, f io.Writer) error {
+	// See the encoding package for format details.
+	record := &encoding.TempNode{
+		ID:     id,
+		Point:  *point,
+		Keys:   keys,
+		Values: values,
+	}
+	if metadata != nil {
+		record.Changeset, record.User, record.HasMetadata = metadata.Changeset, metadata.User, true
+	}
+	if validity != nil {
+		record.ValidFrom, record.ValidTo, record.HasValidity = validity.From, validity.To, true
 	}
-	numberOfTags := len(keys)
-
-	// The number of key-bins to store is determined by the bin with the highest index that is not empty (i.e. all 0s).
-	// If only the first bin contains some 1s (i.e. keys that are set on the feature) and the next 100 bins are empty,
-	// then there's no reason to store those empty bins. This reduced the cell-file size for hamburg-latest (45 MB PBF)
-	// by a factor of ten!
-	headerBytesCount := 8 + 4 + 4 + 2 // = 18
-	byteCount := headerBytesCount
-	byteCount += len(keys) * 4
-	byteCount += len(values) * 4
 
+	byteCount := record.Size()
 	ensureDataSliceSize(byteCount)
 
-	binary.LittleEndian.PutUint64(data[0:], uint64(id))
-	binary.LittleEndian.PutUint32(data[8:], math.Float32bits(float32(point.Lon())))
-	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(float32(point.Lat())))
-	binary.LittleEndian.PutUint16(data[16:], uint16(numberOfTags))
-
-	pos := headerBytesCount
-
-	/*
-		Write tags
-	*/
-	for i := 0; i < numberOfTags; i++ {
-		binary.LittleEndian.PutUint32(data[pos:], uint32(keys[i]))
-		pos += 4
-		binary.LittleEndian.PutUint32(data[pos:], uint32(values[i]))
-		pos += 4
+	err := record.Encode(data)
+	if err != nil {
+		return err
 	}
 
-	_, err := f.Write(data[0:byteCount])
+	_, err = f.Write(data[0:byteCount])
 	return err
 }
 
-func (r *TemporaryFeatureRepository) getWayData(id osm.WayID, keys []int, values []int, nodes osm.WayNodes) []byte {
-	/*
-		Entry format:
-
-		Names: | osmId | num. keys | num. tags |          encodedTags          |       nodes       |
-		Bytes: |   8   |     2     |      2    | key (32 bit) | value (32 bit) | <num. nodes> * 16 |
-
-		Tags are stored as a list of "num. tags" many key-value-pairs.
-
-		The nodes section contains all nodes, not only the ones within this cell. This enables geometric checks, even
-		in cases where no way-node is within this cell. The nodes are stores in the following way:
-		<id (64-bit)><lon (32-bit)><lat (23-bit)>
-	*/
-
-	if len(keys) != len(values) {
-		return nil
+func (r *TemporaryFeatureRepository) getWayData(id osm.WayID, keys []int, values []int, metadata *feature.Metadata, validity *feature.Validity, nodes osm.WayNodes) []byte {
+	// See the encoding package for format details.
+	record := &encoding.TempWay{
+		ID:     id,
+		Keys:   keys,
+		Values: values,
+		Nodes:  nodes,
+	}
+	if metadata != nil {
+		record.Changeset, record.User, record.HasMetadata = metadata.Changeset, metadata.User, true
+	}
+	if validity != nil {
+		record.ValidFrom, record.ValidTo, record.HasValidity = validity.From, validity.To, true
 	}
-	numberOfTags := len(keys)
-
-	nodeIdBytes := len(nodes) * 16 // Each ID is a 64-bit int + 2*4 bytes for lat/lon
-
-	headerByteCount := 8 + 2 + 2 // = 12
-	byteCount := headerByteCount
-	byteCount += numberOfTags * 4
-	byteCount += numberOfTags * 4
-	byteCount += nodeIdBytes
 
+	byteCount := record.Size()
 	ensureDataSliceSize(byteCount)
 
-	/*
-		Write header
-	*/
-	binary.LittleEndian.PutUint64(data[0:], uint64(id))
-	binary.LittleEndian.PutUint16(data[8:], uint16(numberOfTags))
-	binary.LittleEndian.PutUint16(data[10:], uint16(len(nodes)))
-
-	pos := headerByteCount
-
-	/*
-		Write tags
-	*/
-	for i := 0; i < numberOfTags; i++ {
-		binary.LittleEndian.PutUint32(data[pos:], uint32(keys[i]))
-		pos += 4
-		binary.LittleEndian.PutUint32(data[pos:], uint32(values[i]))
-		pos += 4
-	}
-
-	/*
-		Write nodes
-	*/
-	for _, node := range nodes {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(node.ID))
-		binary.LittleEndian.PutUint32(data[pos+8:], math.Float32bits(float32(node.Lon)))
-		binary.LittleEndian.PutUint32(data[pos+12:], math.Float32bits(float32(node.Lat)))
-		pos += 16
+	err := record.Encode(data)
+	if err != nil {
+		return nil
 	}
 
 	return data[0:byteCount]
 }
 
-func (r *TemporaryFeatureRepository) writeRelationData(id osm.RelationID, keys []int, values []int, nodeIds []osm.NodeID, wayIds []osm.WayID, childRelationIds []osm.RelationID, f io.Writer) error {
-	/*
-		Entry format:
-
-		Names: | osmId | num. keys | num. tags |  num. ways | num. child rels |          encodedTags          |     node IDs      |     way IDs     |    child rel. IDs     |
-		Bytes: |   8   |     2     |      2    |      2     |        2        | key (32 bit) | value (32 bit) |  <num. nodes> * 8 | <num. ways> * 8 | <num. child rels> * 8 |
-
-		Tags are stored as a list of "num. tags" many key-value-pairs.
-
-		The "bbox" field are 4 32-bit floats for the min-lon, min-lat, max-lon and max-lat values.
-
-		// TODO store real geometry. Including geometry of sub-relations?
-	*/
-	if len(keys) != len(values) {
-		return errors.Errorf("Number of keys and values for node %d different: keys %d, values %d", id, len(keys), len(values))
+func (r *TemporaryFeatureRepository) writeRelationData(id osm.RelationID, keys []int, values []int, metadata *feature.Metadata, validity *feature.Validity, nodeIds []osm.NodeID, wayIds []osm.WayID, childRelationIds []osm.RelationID, nodeRoles []string, wayRoles []string, childRelationRoles []string, memberTypes []ownOsm.OsmObjectType, f io.Writer) error {
+	// See the encoding package for format details.
+	record := &encoding.TempRelation{
+		ID:                 id,
+		Keys:               keys,
+		Values:             values,
+		NodeIds:            nodeIds,
+		WayIds:             wayIds,
+		ChildRelationIds:   childRelationIds,
+		NodeRoles:          nodeRoles,
+		WayRoles:           wayRoles,
+		ChildRelationRoles: childRelationRoles,
+		MemberTypes:        memberTypes,
 	}
-	numberOfTags := len(keys)
-
-	nodeIdBytes := len(nodeIds) * 8                   // IDs are all 64-bit integers
-	wayIdBytes := len(wayIds) * 8                     // IDs are all 64-bit integers
-	childRelationIdBytes := len(childRelationIds) * 8 // IDs are all 64-bit integers
-
-	headerBytesCount := 8 + 2 + 2 + 2 + 2 + 2
-	byteCount := headerBytesCount
-	byteCount += numberOfTags * 4
-	byteCount += numberOfTags * 4
-	byteCount += nodeIdBytes
-	byteCount += wayIdBytes
-	byteCount += childRelationIdBytes
-
-	ensureDataSliceSize(byteCount)
-
-	binary.LittleEndian.PutUint64(data[0:], uint64(id))
-	binary.LittleEndian.PutUint16(data[8:], uint16(numberOfTags))
-	binary.LittleEndian.PutUint16(data[10:], uint16(len(nodeIds)))
-	binary.LittleEndian.PutUint16(data[12:], uint16(len(wayIds)))
-	binary.LittleEndian.PutUint16(data[14:], uint16(len(childRelationIds)))
-
-	pos := headerBytesCount
-
-	/*
-		Write tags
-	*/
-	for i := 0; i < numberOfTags; i++ {
-		binary.LittleEndian.PutUint32(data[pos:], uint32(keys[i]))
-		pos += 4
-		binary.LittleEndian.PutUint32(data[pos:], uint32(values[i]))
-		pos += 4
+	if metadata != nil {
+		record.Changeset, record.User, record.HasMetadata = metadata.Changeset, metadata.User, true
 	}
-
-	/*
-		Write node-IDs
-	*/
-	for _, nodeId := range nodeIds {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(nodeId))
-		pos += 8
+	if validity != nil {
+		record.ValidFrom, record.ValidTo, record.HasValidity = validity.From, validity.To, true
 	}
 
-	/*
-		Write way-IDs
-	*/
-	for _, wayId := range wayIds {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(wayId))
-		pos += 8
-	}
+	byteCount := record.Size()
+	ensureDataSliceSize(byteCount)
 
-	/*
-		Write child relation-IDs
-	*/
-	for _, relationId := range childRelationIds {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(relationId))
-		pos += 8
+	err := record.Encode(data)
+	if err != nil {
+		return err
 	}
 
-	_, err := f.Write(data[0:byteCount])
+	_, err = f.Write(data[0:byteCount])
 	return err
 }
 
-// TODO Create own tmp feature object that is only a wrapper for []byte. This makes deserialization faster. Of course such object should contain methods to obtain necessary data (ID, geometry, ...).
+// ReadFeatures sends all temporary features within the given extent into the channel, which is closed afterward, also
+// in case of an error.
 func (r *TemporaryFeatureRepository) ReadFeatures(readFeatureChannel chan feature.Feature, extent common.CellExtent) error {
-	cellFile, err := getFileForExtent(r.BaseFolder, ownOsm.OsmObjNode.String(), extent)
-	if err != nil {
-		return errors.Wrapf(err, "Unable to open tmp node-feature cell %s", cellFile.Name())
-	}
-	cellReader := ownIo.NewIndexReader(cellFile)
-	r.readNodesFromCellData(readFeatureChannel, cellReader, extent)
-	err = cellFile.Close()
+	defer close(readFeatureChannel)
+
+	cellFileName := getFilenameForExtent(r.BaseFolder, ownOsm.OsmObjNode.String(), extent)
+	err := readCellFile(cellFileName, func(reader *ownIo.IndexedReader) error {
+		return r.readNodesFromCellData(readFeatureChannel, reader, extent)
+	})
 	if err != nil {
-		return errors.Wrapf(err, "Unable to close tmp node-feature cell %s", cellFile.Name())
+		return errors.Wrapf(err, "Unable to read tmp node-feature cell %s", cellFileName)
 	}
 
-	cellFile, err = getFileForExtent(r.BaseFolder, ownOsm.OsmObjWay.String(), extent)
+	cellFileName = getFilenameForExtent(r.BaseFolder, ownOsm.OsmObjWay.String(), extent)
+	err = readCellFile(cellFileName, func(reader *ownIo.IndexedReader) error {
+		return r.readWaysFromCellData(readFeatureChannel, reader, extent)
+	})
 	if err != nil {
-		return errors.Wrapf(err, "Unable to open tmp way-feature cell %s", cellFile.Name())
+		return errors.Wrapf(err, "Unable to read tmp way-feature cell %s", cellFileName)
 	}
-	cellReader = ownIo.NewIndexReader(cellFile)
-	r.readWaysFromCellData(readFeatureChannel, cellReader, extent)
-	err = cellFile.Close()
+
+	cellFileName = fmt.Sprintf("%s/%s.tmpcell", r.BaseFolder, ownOsm.OsmObjRelation.String())
+	err = readCellFile(cellFileName, func(reader *ownIo.IndexedReader) error {
+		return r.readRelationsFromCellData(readFeatureChannel, reader)
+	})
 	if err != nil {
-		return errors.Wrapf(err, "Unable to close tmp way-feature cell %s", cellFile.Name())
+		return errors.Wrapf(err, "Unable to read tmp relation-feature cell %s", cellFileName)
 	}
 
-	cellFileName := fmt.Sprintf("%s/%s.tmpcell", r.BaseFolder, ownOsm.OsmObjRelation.String())
-	cellFile, err = os.OpenFile(cellFileName, os.O_RDONLY, 0644)
+	return nil
+}
+
+// readCellFile opens the given temporary cell file and passes a reader of it to the given function.
+func readCellFile(cellFileName string, read func(reader *ownIo.IndexedReader) error) error {
+	cellFile, err := os.OpenFile(cellFileName, os.O_RDONLY, 0644)
 	if err != nil {
-		return errors.Wrapf(err, "Unable to open tmp relation-feature cell %s", cellFile.Name())
+		return err
 	}
-	cellReader = ownIo.NewIndexReader(cellFile)
-	r.readRelationsFromCellData(readFeatureChannel, cellReader)
-	err = cellFile.Close()
+
+	err = read(ownIo.NewIndexReader(cellFile))
+	closeErr := cellFile.Close()
 	if err != nil {
-		return errors.Wrapf(err, "Unable to close tmp relation-feature cell %s", cellFile.Name())
+		return err
 	}
-
-	close(readFeatureChannel)
-
-	return nil
+	return closeErr
 }
 
-func (r *TemporaryFeatureRepository) readNodesFromCellData(output chan feature.Feature, reader *ownIo.IndexedReader, extent common.CellExtent) {
+func (r *TemporaryFeatureRepository) readNodesFromCellData(output chan feature.Feature, reader *ownIo.IndexedReader, extent common.CellExtent) error {
 	for pos := int64(0); reader.Has(pos); {
-		// See format details (bit position, field sizes, etc.) in function "writeNodeData".
-
-		/*
-			Read header fields
-		*/
-		osmId := reader.Uint64(pos + 0)
-		lon := reader.Float32(pos + 8)
-		lat := reader.Float32(pos + 12)
-		numberOfTags := reader.IntFromUint16(pos + 16)
-
-		headerBytesCount := 8 + 4 + 4 + 2 // = 18
-
-		pos += int64(headerBytesCount)
-
-		if !extent.ContainsLonLat(float64(lon), float64(lat), r.CellWidth, r.CellHeight) {
-			pos += int64(numberOfTags * 4) // keys
-			pos += int64(numberOfTags * 4) // values
-			continue
+		// See format details (bit position, field sizes, etc.) in the encoding package.
+		header, err := reader.Read(pos, encoding.TempNodeHeaderBytes)
+		if err != nil {
+			return err
 		}
+		recordSize := encoding.TempNodeRecord(header).Size()
+		data, err := reader.Read(pos, recordSize)
+		if err != nil {
+			return err
+		}
+		record := encoding.TempNodeRecord(data)
+		pos += int64(recordSize)
 
-		/*
-			Read tags
-		*/
-		encodedKeys := make([]int, numberOfTags)
-		encodedValues := make([]int, numberOfTags)
-
-		for i := 0; i < numberOfTags; i++ {
-			encodedKeys[i] = reader.IntFromUint32(pos)
-			pos += 4
-			encodedValues[i] = reader.IntFromUint32(pos)
-			pos += 4
+		lon := record.Lon()
+		lat := record.Lat()
+		if !extent.ContainsLonLat(lon, lat, r.CellScheme) {
+			continue
 		}
 
-		/*
-			Create encoded feature from raw data
-		*/
+		encodedKeys, encodedValues := record.Tags()
 		encodedFeature := &index.EncodedNodeFeature{
 			AbstractEncodedFeature: index.AbstractEncodedFeature{
-				ID:       osmId,
-				Geometry: &orb.Point{float64(lon), float64(lat)},
+				ID:       record.ID(),
+				Geometry: &orb.Point{lon, lat},
 				Keys:     encodedKeys,
 				Values:   encodedValues,
+				Metadata: feature.NewMetadata(record.Metadata()),
+				Validity: feature.NewValidity(record.Validity()),
 			},
 		}
 
 		output <- encodedFeature
 	}
+
+	return nil
 }
 
-func (r *TemporaryFeatureRepository) readWaysFromCellData(output chan feature.Feature, reader *ownIo.IndexedReader, extent common.CellExtent) {
+func (r *TemporaryFeatureRepository) readWaysFromCellData(output chan feature.Feature, reader *ownIo.IndexedReader, extent common.CellExtent) error {
 	for pos := int64(0); reader.Has(pos); {
-		// See format details (bit position, field sizes, etc.) in function "writeWayData".
-
-		/*
-			Read header fields
-		*/
-		osmId := reader.Uint64(pos + 0)
-		numberOfTags := reader.IntFromUint16(pos + 8)
-		numNodes := reader.IntFromUint16(pos + 10)
-
-		headerBytesCount := 8 + 2 + 2 // = 12
-
-		pos += int64(headerBytesCount)
-
-		/*
-			Read tags
-		*/
-		encodedKeys := make([]int, numberOfTags)
-		encodedValues := make([]int, numberOfTags)
-
-		for i := 0; i < numberOfTags; i++ {
-			encodedKeys[i] = reader.IntFromUint32(pos)
-			pos += 4
-			encodedValues[i] = reader.IntFromUint32(pos)
-			pos += 4
+		// See format details (bit position, field sizes, etc.) in the encoding package.
+		header, err := reader.Read(pos, encoding.TempWayHeaderBytes)
+		if err != nil {
+			return err
+		}
+		recordSize := encoding.TempWayRecord(header).Size()
+		data, err := reader.Read(pos, recordSize)
+		if err != nil {
+			return err
 		}
+		record := encoding.TempWayRecord(data)
+		pos += int64(recordSize)
 
-		/*
-			Read node-IDs
-		*/
-		nodes := make([]osm.WayNode, numNodes)
+		nodes := record.Nodes()
 		extentContainsWay := false
-		for i := 0; i < numNodes; i++ {
-			id := osm.NodeID(reader.Int64(pos))
-			lon := float64(reader.Float32(pos + 8))
-			lat := float64(reader.Float32(pos + 12))
-
-			nodes[i] = osm.WayNode{
-				ID:  id,
-				Lon: lon,
-				Lat: lat,
+		for _, node := range nodes {
+			if extent.ContainsLonLat(node.Lon, node.Lat, r.CellScheme) {
+				extentContainsWay = true
+				break
 			}
-			pos += 16
-
-			extentContainsWay = extentContainsWay || extent.ContainsLonLat(lon, lat, r.CellWidth, r.CellHeight)
 		}
 
 		if !extentContainsWay {
 			continue
 		}
 
-		/*
-			Create encoded feature from raw data
-		*/
 		lineString := make(orb.LineString, len(nodes))
 		for i, node := range nodes {
 			lineString[i] = orb.Point{node.Lon, node.Lat}
 		}
 
+		encodedKeys, encodedValues := record.Tags()
 		encodedFeature := &index.EncodedWayFeature{
 			AbstractEncodedFeature: index.AbstractEncodedFeature{
-				ID:       osmId,
+				ID:       record.ID(),
 				Keys:     encodedKeys,
 				Values:   encodedValues,
 				Geometry: &lineString,
+				Metadata: feature.NewMetadata(record.Metadata()),
+				Validity: feature.NewValidity(record.Validity()),
 			},
 			Nodes: nodes,
 		}
 
 		output <- encodedFeature
 	}
+
+	return nil
 }
 
-func (r *TemporaryFeatureRepository) readRelationsFromCellData(output chan feature.Feature, reader *ownIo.IndexedReader) {
+func (r *TemporaryFeatureRepository) readRelationsFromCellData(output chan feature.Feature, reader *ownIo.IndexedReader) error {
 	for pos := int64(0); reader.Has(pos); {
-		// See format details (bit position, field sizes, etc.) in function "writeRelationData".
-
-		/*
-			Read header fields
-		*/
-		osmId := reader.Uint64(pos + 0)
-		numberOfTags := reader.IntFromUint16(pos + 8)
-		numNodeIds := reader.IntFromUint16(pos + 10)
-		numWayIds := reader.IntFromUint16(pos + 12)
-		numChildRelationIds := reader.IntFromUint16(pos + 14)
-
-		headerBytesCount := 8 + 2 + 2 + 2 + 2 // = 16
-
-		pos += int64(headerBytesCount)
-
-		/*
-			Read tags
-		*/
-		encodedKeys := make([]int, numberOfTags)
-		encodedValues := make([]int, numberOfTags)
-
-		for i := 0; i < numberOfTags; i++ {
-			encodedKeys[i] = reader.IntFromUint32(pos)
-			pos += 4
-			encodedValues[i] = reader.IntFromUint32(pos)
-			pos += 4
-		}
-
-		/*
-			Read node-IDs
-		*/
-		nodeIds := make([]osm.NodeID, numNodeIds)
-		for i := 0; i < numNodeIds; i++ {
-			nodeIds[i] = osm.NodeID(reader.Int64(pos))
-			pos += 8
-		}
-
-		/*
-			Read way-IDs
-		*/
-		wayIds := make([]osm.WayID, numWayIds)
-		for i := 0; i < numWayIds; i++ {
-			wayIds[i] = osm.WayID(reader.Int64(pos))
-			pos += 8
+		// See format details (bit position, field sizes, etc.) in the encoding package.
+		header, err := reader.Read(pos, encoding.TempRelationHeaderBytes)
+		if err != nil {
+			return err
 		}
-
-		/*
-			Read child relation-IDs
-		*/
-		childRelationIds := make([]osm.RelationID, numChildRelationIds)
-		for i := 0; i < numChildRelationIds; i++ {
-			childRelationIds[i] = osm.RelationID(reader.Int64(pos))
-			pos += 8
+		recordSize := encoding.TempRelationRecord(header).Size()
+		data, err := reader.Read(pos, recordSize)
+		if err != nil {
+			return err
 		}
+		record := encoding.TempRelationRecord(data)
+		pos += int64(recordSize)
 
-		/*
-			Create encoded feature from raw data
-		*/
+		encodedKeys, encodedValues := record.Tags()
+		nodeRoles, wayRoles, childRelationRoles := record.Roles()
 		encodedFeature := &index.EncodedRelationFeature{
 			AbstractEncodedFeature: index.AbstractEncodedFeature{
-				ID:     osmId,
-				Keys:   encodedKeys,
-				Values: encodedValues,
+				ID:       record.ID(),
+				Keys:     encodedKeys,
+				Values:   encodedValues,
+				Metadata: feature.NewMetadata(record.Metadata()),
+				Validity: feature.NewValidity(record.Validity()),
 			},
-			NodeIds:          nodeIds,
-			WayIds:           wayIds,
-			ChildRelationIds: childRelationIds,
+			NodeIds:            record.NodeIds(),
+			WayIds:             record.WayIds(),
+			ChildRelationIds:   record.ChildRelationIds(),
+			NodeRoles:          nodeRoles,
+			WayRoles:           wayRoles,
+			ChildRelationRoles: childRelationRoles,
+			MemberTypes:        record.MemberTypes(),
 		}
 
 		output <- encodedFeature
 	}
-}
 
-func getFileForExtent(cellFolderName string, filename string, cellExtent common.CellExtent) (*os.File, error) {
-	cellFileName := getFilenameForExtent(cellFolderName, filename, cellExtent)
-	return os.OpenFile(cellFileName, os.O_RDONLY, 0644)
+	return nil
 }
 
 func getFileWriterForExtent(cellFolderName string, filename string, cellExtent common.CellExtent) (*os.File, *bufio.Writer, error) {
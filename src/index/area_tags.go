@@ -0,0 +1,101 @@
+package index
+
+import (
+	"encoding/json"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"os"
+	"soq/common"
+	"soq/feature"
+)
+
+// AreaTagRule decides for one key whether closed ways with this key describe an area.
+type AreaTagRule struct {
+	// Values of the key for which closed ways are areas. Empty means all values except the excluded ones.
+	Values []string `json:"values,omitempty"`
+	// Values of the key for which closed ways are no areas, e.g. "natural=coastline".
+	ExcludedValues []string `json:"excludedValues,omitempty"`
+}
+
+func (r AreaTagRule) matches(value string) bool {
+	if common.Contains(r.ExcludedValues, value) {
+		return false
+	}
+	return len(r.Values) == 0 || common.Contains(r.Values, value)
+}
+
+// AreaTagTable maps keys to the rules deciding whether closed ways with these keys are written as polygons instead of
+// line strings. A closed way is an area when at least one of its tags matches a rule and it has no "area=no" tag.
+type AreaTagTable map[string]AreaTagRule
+
+// DefaultAreaTagTable contains the common keys of areas. Keys like "highway" or "barrier" are linear features even
+// when their ways are closed (e.g. roundabouts), so they're only areas with "area=yes".
+var DefaultAreaTagTable = AreaTagTable{
+	"area":             {Values: []string{"yes"}},
+	"amenity":          {},
+	"building":         {},
+	"building:part":    {},
+	"landuse":          {},
+	"leisure":          {},
+	"natural":          {ExcludedValues: []string{"coastline", "cliff", "ridge", "arete", "tree_row"}},
+	"shop":             {},
+	"tourism":          {},
+	"historic":         {},
+	"military":         {},
+	"place":            {},
+	"aeroway":          {ExcludedValues: []string{"runway", "taxiway", "parking_position"}},
+	"man_made":         {ExcludedValues: []string{"cutline", "embankment", "pipeline", "breakwater", "groyne"}},
+	"power":            {Values: []string{"plant", "substation", "generator", "transformer"}},
+	"waterway":         {Values: []string{"riverbank", "dock", "boatyard", "dam"}},
+	"public_transport": {Values: []string{"platform", "station"}},
+}
+
+// LoadAreaTagTable reads an area tag table from the given JSON file. The file contains an object with keys as
+// properties and AreaTagRule objects as values, e.g. {"building": {}, "natural": {"excludedValues": ["coastline"]}}.
+func LoadAreaTagTable(filename string) (AreaTagTable, error) {
+	tableBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read area tag file %s", filename)
+	}
+
+	table := AreaTagTable{}
+	err = json.Unmarshal(tableBytes, &table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse area tag file %s", filename)
+	}
+
+	return table, nil
+}
+
+// isArea returns true when the tags of the feature match a rule of the table and the feature has no "area=no" tag.
+func (t AreaTagTable) isArea(encodedFeature feature.Feature, tagIndex *TagIndex) bool {
+	isArea := false
+	for i, keyIndex := range encodedFeature.GetKeys() {
+		key := tagIndex.GetKeyFromIndex(keyIndex)
+		value := tagIndex.GetValueForKey(keyIndex, encodedFeature.GetValues()[i])
+
+		if key == "area" && value == "no" {
+			return false
+		}
+		if rule, ok := t[key]; ok && rule.matches(value) {
+			isArea = true
+		}
+	}
+	return isArea
+}
+
+// toAreaGeometry returns the geometry of the feature as polygon when it's a closed way describing an area according to
+// the table. All other geometries are returned unchanged.
+func (t AreaTagTable) toAreaGeometry(encodedFeature feature.Feature, tagIndex *TagIndex) orb.Geometry {
+	geometry := encodedFeature.GetGeometry()
+	if _, isWay := encodedFeature.(feature.WayFeature); !isWay {
+		return geometry
+	}
+
+	lineString, ok := DereferenceGeometry(geometry).(orb.LineString)
+	if !ok || len(lineString) < 4 || !orb.Ring(lineString).Closed() || !t.isArea(encodedFeature, tagIndex) {
+		return geometry
+	}
+
+	return orb.Polygon{orb.Ring(lineString)}
+}
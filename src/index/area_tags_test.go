@@ -0,0 +1,68 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"os"
+	"path"
+	"soq/common"
+	"testing"
+)
+
+func newTestAreaWay(keys []int, values []int, geometry orb.LineString) *EncodedWayFeature {
+	return &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: &geometry, Keys: keys, Values: values},
+	}
+}
+
+func TestAreaTagTable_toAreaGeometry(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"area", "building", "highway", "natural"}, [][]string{{"no", "yes"}, {"yes"}, {"pedestrian"}, {"coastline", "wood"}})
+	closedLineString := orb.LineString{{0, 0}, {1, 0}, {1, 1}, {0, 0}}
+	openLineString := orb.LineString{{0, 0}, {1, 0}, {1, 1}}
+
+	for _, testCase := range []struct {
+		way           *EncodedWayFeature
+		expectPolygon bool
+	}{
+		{newTestAreaWay([]int{1}, []int{0}, closedLineString), true},
+		{newTestAreaWay([]int{1}, []int{0}, openLineString), false},
+		{newTestAreaWay([]int{0, 1}, []int{0, 0}, closedLineString), false},
+		{newTestAreaWay([]int{2}, []int{0}, closedLineString), false},
+		{newTestAreaWay([]int{0, 2}, []int{1, 0}, closedLineString), true},
+		{newTestAreaWay([]int{3}, []int{0}, closedLineString), false},
+		{newTestAreaWay([]int{3}, []int{1}, closedLineString), true},
+	} {
+		// Act
+		geometry := DefaultAreaTagTable.toAreaGeometry(testCase.way, tagIndex)
+
+		// Assert
+		_, isPolygon := geometry.(orb.Polygon)
+		common.AssertEqual(t, testCase.expectPolygon, isPolygon)
+	}
+}
+
+func TestAreaTagTable_toAreaGeometry_emptyTable(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"building"}, [][]string{{"yes"}})
+	way := newTestAreaWay([]int{0}, []int{0}, orb.LineString{{0, 0}, {1, 0}, {1, 1}, {0, 0}})
+
+	// Act
+	geometry := AreaTagTable{}.toAreaGeometry(way, tagIndex)
+
+	// Assert
+	common.AssertEqual(t, way.GetGeometry(), geometry)
+}
+
+func TestLoadAreaTagTable(t *testing.T) {
+	// Arrange
+	filename := path.Join(t.TempDir(), "area-tags.json")
+	err := os.WriteFile(filename, []byte(`{"building": {}, "natural": {"excludedValues": ["coastline"]}}`), 0644)
+	common.AssertNil(t, err)
+
+	// Act
+	table, err := LoadAreaTagTable(filename)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, AreaTagTable{"building": {}, "natural": {ExcludedValues: []string{"coastline"}}}, table)
+}
@@ -3,6 +3,7 @@ package index
 import (
 	"github.com/pkg/errors"
 	"math"
+	"soq/common"
 	"soq/feature"
 	"sync"
 	"time"
@@ -30,27 +31,46 @@ type featureCache interface {
 	// appendAll adds the given entries to the array is the given filename. It returns an error when this file is not
 	// cached.
 	appendAll(filename string, features []feature.Feature) error
+
+	// pin excludes the entry of the given file from the eviction, so that it stays cached until the cache is discarded.
+	// Pinned entries don't count towards the maximum size of the cache. It returns false when the file is not cached.
+	pin(filename string) bool
+
+	// unregister removes the cache from the memory accountant it's registered at (if any).
+	unregister()
 }
 
 // lruFeatureCache is a simple LRU (least recently used) cache for files containing encoded features. It has an internal
 // locking mechanism and can be used in concurrent goroutines. The eviction strategy uses the UTC nanoseconds as
 // measurement for the recency of entries. This timestamp only gets updates when data is read, not when it's written.
+//
+// When registered at a memory accountant, the estimated size of the cached features is added to the account and the
+// accountant can evict unpinned entries in addition to the normal eviction based on the maximum size.
 type lruFeatureCache struct {
 	featureCache                map[string][]feature.Feature // Filename to feature within it
-	featureCacheLastAccessTimes map[string]int64             // Filename to UTC millis of last access
+	featureCacheLastAccessTimes map[string]int64             // Filename to UTC millis of last access. Pinned entries are not listed here.
+	featureCacheSizes           map[string]int64             // Filename to estimated size of its features in bytes
 	featureCacheMutex           *sync.Mutex
-	maxSize                     int // Maximum number of entries this cache should hold
+	maxSize                     int                   // Maximum number of unpinned entries this cache should hold
+	account                     *common.MemoryAccount // Might be nil when the memory is not accounted
 }
 
 func newLruCache(maxSize int) *lruFeatureCache {
 	return &lruFeatureCache{
 		featureCache:                map[string][]feature.Feature{},
 		featureCacheLastAccessTimes: map[string]int64{},
+		featureCacheSizes:           map[string]int64{},
 		featureCacheMutex:           &sync.Mutex{},
 		maxSize:                     maxSize,
 	}
 }
 
+// registerAt registers the cache at the given accountant, which might be nil. This must happen before the cache is
+// used.
+func (c *lruFeatureCache) registerAt(accountant *common.MemoryAccountant) {
+	c.account = accountant.Register("cell cache", c)
+}
+
 // has checks whether the given file is cached. This function does NOT use locking since it performs an atomic operation.
 func (c lruFeatureCache) has(filename string) bool {
 	_, ok := c.featureCache[filename]
@@ -65,7 +85,7 @@ func (c lruFeatureCache) getAll(filename string) ([]feature.Feature, error) {
 		return nil, errors.Errorf("Given filename %s is not in the cache", filename)
 	}
 
-	c.featureCacheLastAccessTimes[filename] = time.Now().UTC().UnixNano()
+	c.touchUnsafe(filename)
 	features := c.featureCache[filename]
 
 	return features, nil
@@ -105,7 +125,7 @@ func (c lruFeatureCache) insertOrAppend(filename string, features []feature.Feat
 	defer c.featureCacheMutex.Unlock()
 
 	if c.has(filename) {
-		c.featureCache[filename] = append(c.featureCache[filename], features...)
+		c.appendUnsafe(filename, features)
 	} else {
 		c.insertUnsafe(filename, features)
 	}
@@ -114,15 +134,42 @@ func (c lruFeatureCache) insertOrAppend(filename string, features []feature.Feat
 // insertUnsafe is the core functionality of the insertion of elements. This function does NOT use locking and is meant
 // for internal use only! Use insert to normally insert elements.
 func (c lruFeatureCache) insertUnsafe(filename string, features []feature.Feature) {
-	if len(c.featureCache) >= c.maxSize {
+	if len(c.featureCacheLastAccessTimes) >= c.maxSize {
 		// Cache is full -> evict entry that has been unused the longest
-		longestUnusedFilename := c.getMinEntry()
-		delete(c.featureCache, longestUnusedFilename)
-		delete(c.featureCacheLastAccessTimes, longestUnusedFilename)
+		c.removeUnsafe(c.getMinEntry())
 	}
 
+	size := feature.EstimateSizes(features)
 	c.featureCacheLastAccessTimes[filename] = time.Now().UTC().UnixNano()
 	c.featureCache[filename] = features
+	c.featureCacheSizes[filename] = size
+	c.account.Add(size)
+}
+
+// appendUnsafe appends the features to the existing entry. This function does NOT use locking and is meant for internal
+// use only!
+func (c lruFeatureCache) appendUnsafe(filename string, features []feature.Feature) {
+	size := feature.EstimateSizes(features)
+	c.featureCache[filename] = append(c.featureCache[filename], features...)
+	c.featureCacheSizes[filename] += size
+	c.account.Add(size)
+}
+
+// removeUnsafe removes the entry of the given file. This function does NOT use locking and is meant for internal use
+// only!
+func (c lruFeatureCache) removeUnsafe(filename string) {
+	c.account.Remove(c.featureCacheSizes[filename])
+	delete(c.featureCache, filename)
+	delete(c.featureCacheLastAccessTimes, filename)
+	delete(c.featureCacheSizes, filename)
+}
+
+// touchUnsafe updates the access time of the given unpinned entry. This function does NOT use locking and is meant for
+// internal use only!
+func (c lruFeatureCache) touchUnsafe(filename string) {
+	if _, isUnpinned := c.featureCacheLastAccessTimes[filename]; isUnpinned {
+		c.featureCacheLastAccessTimes[filename] = time.Now().UTC().UnixNano()
+	}
 }
 
 // getMinEntry returns the entry that hasn't been used longest. This function does NOT use locking and is meant for
@@ -149,7 +196,37 @@ func (c lruFeatureCache) appendAll(filename string, additionalFeatures []feature
 		return errors.Errorf("Given filename %s is not in the cache", filename)
 	}
 
-	c.featureCache[filename] = append(c.featureCache[filename], additionalFeatures...)
+	c.appendUnsafe(filename, additionalFeatures)
 
 	return nil
 }
+
+func (c lruFeatureCache) pin(filename string) bool {
+	c.featureCacheMutex.Lock()
+	defer c.featureCacheMutex.Unlock()
+
+	if !c.has(filename) {
+		return false
+	}
+
+	delete(c.featureCacheLastAccessTimes, filename)
+	return true
+}
+
+// EvictMemory evicts the entries that have been unused the longest until the given amount of bytes is freed. Pinned
+// entries are not evicted.
+func (c lruFeatureCache) EvictMemory(bytes int64) {
+	c.featureCacheMutex.Lock()
+	defer c.featureCacheMutex.Unlock()
+
+	var freedBytes int64
+	for freedBytes < bytes && len(c.featureCacheLastAccessTimes) > 0 {
+		filename := c.getMinEntry()
+		freedBytes += c.featureCacheSizes[filename]
+		c.removeUnsafe(filename)
+	}
+}
+
+func (c lruFeatureCache) unregister() {
+	c.account.Unregister()
+}
@@ -12,13 +12,13 @@ func TestLruCache_insertAndEviction(t *testing.T) {
 	cache := newLruCache(3)
 
 	filenameA := "A"
-	entryA := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entryA := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 	filenameB := "B"
-	entryB := []feature.Feature{&feature.EncodedWayFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entryB := []feature.Feature{&EncodedWayFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 	filenameC := "C"
-	entryC := []feature.Feature{&feature.EncodedRelationFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entryC := []feature.Feature{&EncodedRelationFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 	filenameD := "D"
-	entryD := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}, WayIds: []osm.WayID{}}}
+	entryD := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}, WayIds: []osm.WayID{}}}
 
 	common.AssertFalse(t, cache.has(filenameA))
 	common.AssertFalse(t, cache.has(filenameB))
@@ -66,7 +66,7 @@ func TestLruCache_insertTwice(t *testing.T) {
 	cache := newLruCache(3)
 
 	filename := "A"
-	entry := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entry := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 
 	common.AssertFalse(t, cache.has(filename))
 	err := cache.insert(filename, entry)
@@ -87,7 +87,7 @@ func TestLruCache_insertOrAppend(t *testing.T) {
 	cache := newLruCache(3)
 
 	filename := "A"
-	entry := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entry := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 
 	common.AssertFalse(t, cache.has(filename))
 	cache.insertOrAppend(filename, entry)
@@ -108,7 +108,7 @@ func TestLruCache_getAll(t *testing.T) {
 	cache := newLruCache(3)
 
 	filename := "A"
-	entry := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entry := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 
 	err := cache.insert(filename, entry)
 	common.AssertNil(t, err)
@@ -156,11 +156,11 @@ func TestLruCache_getOrInsertFullCache(t *testing.T) {
 
 	// Insert entries
 	filenameA := "A"
-	entryA := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entryA := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 	filenameB := "B"
-	entryB := []feature.Feature{&feature.EncodedWayFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entryB := []feature.Feature{&EncodedWayFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 	filenameC := "C"
-	entryC := []feature.Feature{&feature.EncodedRelationFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entryC := []feature.Feature{&EncodedRelationFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 
 	err := cache.insert(filenameA, entryA)
 	time.Sleep(10 * time.Nanosecond)
@@ -205,8 +205,8 @@ func TestLruCache_appendAll(t *testing.T) {
 	cache := newLruCache(3)
 
 	filename := "A"
-	entry := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
-	additionalFeatures := []feature.Feature{&feature.EncodedWayFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entry := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
+	additionalFeatures := []feature.Feature{&EncodedWayFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 
 	err := cache.insert(filename, entry)
 	common.AssertNil(t, err)
@@ -226,7 +226,7 @@ func TestLruCache_appendAllNotExisting(t *testing.T) {
 	cache := newLruCache(3)
 
 	filename := "A"
-	entry := []feature.Feature{&feature.EncodedNodeFeature{AbstractEncodedFeature: feature.AbstractEncodedFeature{}}}
+	entry := []feature.Feature{&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{}}}
 
 	// Act
 	err := cache.appendAll(filename, entry)
@@ -0,0 +1,274 @@
+package index
+
+import (
+	"encoding/binary"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"soq/common"
+	"soq/encoding"
+	ownOsm "soq/osm"
+	"sort"
+	"strconv"
+)
+
+const CellRTreeFileExtension = ".rtree"
+
+// Cells with fewer ways don't get an R-tree, since decoding all their ways is cheap anyway.
+const cellRTreeMinWays = 128
+
+// Maximum number of children of each node of the R-tree.
+const cellRTreeNodeSize = 16
+
+const cellRTreeBoundSize = 4 * 4
+const cellRTreeItemSize = cellRTreeBoundSize + 4
+
+// CellRTreeItem is the bbox of a record in a cell file and the byte offset of the record within the file.
+type CellRTreeItem struct {
+	Bound  orb.Bound
+	Offset int
+}
+
+// CellRTree is a packed R-tree of the bboxes of the records in a cell file. It's stored next to the cell file and
+// allows decoding only the records whose bbox intersects the queried bbox. The tree is built bottom-up (sort-tile-
+// recursive) and stored level by level, the bboxes of the nodes are rounded outwards to float32:
+//
+//	[number of items: uint32] [items: 4 x float32 bbox + uint32 offset]... [nodes of level 1: 4 x float32 bbox]... ...
+//
+// The children of the i-th node of a level are the nodes (or items) i*cellRTreeNodeSize to (i+1)*cellRTreeNodeSize-1
+// of the level below, so that no child pointers need to be stored. The last level consists of the root node.
+type CellRTree []byte
+
+func NewCellRTree(items []CellRTreeItem) CellRTree {
+	items = sortTileRecursive(items)
+
+	levelSizes := getCellRTreeLevelSizes(len(items))
+	size := 4 + len(items)*cellRTreeItemSize
+	for _, levelSize := range levelSizes[1:] {
+		size += levelSize * cellRTreeBoundSize
+	}
+
+	tree := make(CellRTree, size)
+	binary.LittleEndian.PutUint32(tree, uint32(len(items)))
+
+	var levelBounds []orb.Bound
+	pos := 4
+	for _, item := range items {
+		putCellRTreeBound(tree[pos:], item.Bound)
+		binary.LittleEndian.PutUint32(tree[pos+cellRTreeBoundSize:], uint32(item.Offset))
+		pos += cellRTreeItemSize
+		levelBounds = append(levelBounds, item.Bound)
+	}
+
+	for _, levelSize := range levelSizes[1:] {
+		var nodeBounds []orb.Bound
+		for i := 0; i < levelSize; i++ {
+			children := levelBounds[i*cellRTreeNodeSize : min((i+1)*cellRTreeNodeSize, len(levelBounds))]
+			bound := children[0]
+			for _, child := range children[1:] {
+				bound = bound.Union(child)
+			}
+			putCellRTreeBound(tree[pos:], bound)
+			pos += cellRTreeBoundSize
+			nodeBounds = append(nodeBounds, bound)
+		}
+		levelBounds = nodeBounds
+	}
+
+	return tree
+}
+
+// sortTileRecursive sorts the items into vertical slices by the x-coordinate of their center and each slice by the
+// y-coordinate, so that consecutive items (which end up in the same node) are close to each other.
+func sortTileRecursive(items []CellRTreeItem) []CellRTreeItem {
+	items = slices.Clone(items)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Bound.Center().X() < items[j].Bound.Center().X()
+	})
+
+	numberOfNodes := (len(items) + cellRTreeNodeSize - 1) / cellRTreeNodeSize
+	sliceSize := int(math.Ceil(math.Sqrt(float64(numberOfNodes)))) * cellRTreeNodeSize
+	for start := 0; start < len(items); start += sliceSize {
+		slice := items[start:min(start+sliceSize, len(items))]
+		sort.SliceStable(slice, func(i, j int) bool {
+			return slice[i].Bound.Center().Y() < slice[j].Bound.Center().Y()
+		})
+	}
+
+	return items
+}
+
+// getCellRTreeLevelSizes returns the number of entries of each level, starting with the items.
+func getCellRTreeLevelSizes(numberOfItems int) []int {
+	levelSizes := []int{numberOfItems}
+	for levelSize := numberOfItems; levelSize > 1; {
+		levelSize = (levelSize + cellRTreeNodeSize - 1) / cellRTreeNodeSize
+		levelSizes = append(levelSizes, levelSize)
+	}
+	return levelSizes
+}
+
+// Len returns the number of items in this tree.
+func (t CellRTree) Len() int {
+	return int(binary.LittleEndian.Uint32(t))
+}
+
+// Search returns the ascending offsets of all records whose bbox intersects the given bbox.
+func (t CellRTree) Search(bbox orb.Bound) []int {
+	numberOfItems := t.Len()
+	if numberOfItems == 0 {
+		return nil
+	}
+
+	levelSizes := getCellRTreeLevelSizes(numberOfItems)
+	// Byte positions of the levels, the nodes of level 1 come right after the items.
+	levelStarts := []int{4, 4 + numberOfItems*cellRTreeItemSize}
+	for level := 2; level < len(levelSizes); level++ {
+		levelStarts = append(levelStarts, levelStarts[level-1]+levelSizes[level-1]*cellRTreeBoundSize)
+	}
+
+	var offsets []int
+	var searchNode func(level int, index int)
+	searchNode = func(level int, index int) {
+		if level == 0 {
+			pos := levelStarts[0] + index*cellRTreeItemSize
+			if getCellRTreeBound(t[pos:]).Intersects(bbox) {
+				offsets = append(offsets, int(binary.LittleEndian.Uint32(t[pos+cellRTreeBoundSize:])))
+			}
+			return
+		}
+
+		if !getCellRTreeBound(t[levelStarts[level]+index*cellRTreeBoundSize:]).Intersects(bbox) {
+			return
+		}
+		for child := index * cellRTreeNodeSize; child < min((index+1)*cellRTreeNodeSize, levelSizes[level-1]); child++ {
+			searchNode(level-1, child)
+		}
+	}
+	searchNode(len(levelSizes)-1, 0)
+
+	slices.Sort(offsets)
+	return offsets
+}
+
+// validate checks whether the size of the tree matches its number of items.
+func (t CellRTree) validate() error {
+	if len(t) < 4 {
+		return errors.Errorf("R-tree has only %d bytes", len(t))
+	}
+
+	levelSizes := getCellRTreeLevelSizes(t.Len())
+	expectedSize := 4 + t.Len()*cellRTreeItemSize
+	for _, levelSize := range levelSizes[1:] {
+		expectedSize += levelSize * cellRTreeBoundSize
+	}
+	if len(t) != expectedSize {
+		return errors.Errorf("R-tree with %d items has %d bytes but should have %d bytes", t.Len(), len(t), expectedSize)
+	}
+
+	return nil
+}
+
+// putCellRTreeBound writes the bound with float32 coordinates, which are rounded outwards so that the stored bound
+// contains the original one.
+func putCellRTreeBound(data []byte, bound orb.Bound) {
+	binary.LittleEndian.PutUint32(data[0:], math.Float32bits(roundFloat32(bound.Min.X(), -1)))
+	binary.LittleEndian.PutUint32(data[4:], math.Float32bits(roundFloat32(bound.Min.Y(), -1)))
+	binary.LittleEndian.PutUint32(data[8:], math.Float32bits(roundFloat32(bound.Max.X(), 1)))
+	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(roundFloat32(bound.Max.Y(), 1)))
+}
+
+func getCellRTreeBound(data []byte) orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{
+			float64(math.Float32frombits(binary.LittleEndian.Uint32(data[0:]))),
+			float64(math.Float32frombits(binary.LittleEndian.Uint32(data[4:]))),
+		},
+		Max: orb.Point{
+			float64(math.Float32frombits(binary.LittleEndian.Uint32(data[8:]))),
+			float64(math.Float32frombits(binary.LittleEndian.Uint32(data[12:]))),
+		},
+	}
+}
+
+// roundFloat32 converts the value to float32 and rounds it towards the given direction (-1 or 1) when it's not exactly
+// representable.
+func roundFloat32(value float64, direction float64) float32 {
+	rounded := float32(value)
+	if float64(rounded)*direction < value*direction {
+		rounded = math.Nextafter32(rounded, float32(math.Inf(int(direction))))
+	}
+	return rounded
+}
+
+func getCellRTreeFileName(baseFolder string, cellX int, cellY int, objectType ownOsm.OsmObjectType) string {
+	return path.Join(baseFolder, objectType.String(), strconv.Itoa(cellX), strconv.Itoa(cellY)+CellRTreeFileExtension)
+}
+
+// writeCellRTree reads the given (closed) way cell file and writes the R-tree of its records next to it.
+func (g *GridIndexWriter) writeCellRTree(cell common.CellIndex) error {
+	cellFileName := getCellFileName(g.BaseFolder, cell.X(), cell.Y(), ownOsm.OsmObjWay)
+	data, err := readIndexFile(cellFileName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read cell file %s to build its R-tree", cellFileName)
+	}
+
+	var items []CellRTreeItem
+	for pos := 0; pos < len(data); {
+		// See format details (bit position, field sizes, etc.) in the encoding package.
+		record := encoding.WayRecord(data[pos:])
+		items = append(items, CellRTreeItem{Bound: record.Bbox(), Offset: pos})
+		pos += record.Size()
+	}
+
+	tree := NewCellRTree(items)
+	treeFileName := getCellRTreeFileName(g.BaseFolder, cell.X(), cell.Y(), ownOsm.OsmObjWay)
+	sigolo.Tracef("Write R-tree with %d items and %d bytes to %s", len(items), len(tree), treeFileName)
+
+	file, err := os.Create(treeFileName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create R-tree file %s", treeFileName)
+	}
+
+	_, err = file.Write(tree)
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "Unable to write R-tree file %s", treeFileName)
+	}
+
+	if g.durable {
+		err = file.Sync()
+		if err != nil {
+			file.Close()
+			return errors.Wrapf(err, "Unable to sync R-tree file %s", treeFileName)
+		}
+		g.addFolderWithNewFiles(path.Dir(treeFileName))
+	}
+
+	return file.Close()
+}
+
+// readCellRTree reads the R-tree of the given cell. Nil is returned for cells without R-tree file, e.g. because they
+// contain only a few features.
+func (g *GridIndexReader) readCellRTree(cellX int, cellY int, objectType ownOsm.OsmObjectType) (CellRTree, error) {
+	treeFileName := getCellRTreeFileName(g.BaseFolder, cellX, cellY, objectType)
+
+	data, err := readIndexFile(treeFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read R-tree file %s", treeFileName)
+	}
+
+	tree := CellRTree(data)
+	err = tree.validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid R-tree file %s", treeFileName)
+	}
+
+	return tree, nil
+}
@@ -0,0 +1,97 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"os"
+	"soq/common"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"sort"
+	"testing"
+)
+
+func TestCellRTree_Search(t *testing.T) {
+	// Arrange
+	var items []CellRTreeItem
+	for i := 0; i < 1000; i++ {
+		lon := float64(i%40) * 0.025
+		lat := float64(i/40) * 0.04
+		items = append(items, CellRTreeItem{Bound: orb.Bound{Min: orb.Point{lon, lat}, Max: orb.Point{lon + 0.01, lat + 0.01}}, Offset: i * 10})
+	}
+	bbox := orb.Bound{Min: orb.Point{0.3, 0.3}, Max: orb.Point{0.5, 0.42}}
+
+	// Act
+	tree := NewCellRTree(items)
+	offsets := tree.Search(bbox)
+
+	// Assert
+	common.AssertNil(t, tree.validate())
+	common.AssertEqual(t, 1000, tree.Len())
+	var expectedOffsets []int
+	for _, item := range items {
+		if item.Bound.Intersects(bbox) {
+			expectedOffsets = append(expectedOffsets, item.Offset)
+		}
+	}
+	common.AssertEqual(t, expectedOffsets, offsets)
+	common.AssertEqual(t, 0, len(tree.Search(orb.Bound{Min: orb.Point{2, 2}, Max: orb.Point{3, 3}})))
+}
+
+func TestCellRTree_boundsAreRoundedOutwards(t *testing.T) {
+	// Arrange
+	bound := orb.Bound{Min: orb.Point{0.1, 0.1}, Max: orb.Point{0.3, 0.3}}
+	tree := NewCellRTree([]CellRTreeItem{{Bound: bound, Offset: 42}})
+
+	// Act
+	offsetsAtMin := tree.Search(orb.Bound{Min: orb.Point{0, 0}, Max: bound.Min})
+	offsetsAtMax := tree.Search(orb.Bound{Min: bound.Max, Max: orb.Point{1, 1}})
+
+	// Assert
+	common.AssertEqual(t, []int{42}, offsetsAtMin)
+	common.AssertEqual(t, []int{42}, offsetsAtMax)
+}
+
+func TestGridIndexReader_Get_waysReadWithRTree(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	cell := common.CellIndex{0, 0}
+	gridIndexWriter := NewGridIndexWriter(&common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, baseFolder)
+	for i := 0; i < cellRTreeMinWays; i++ {
+		lon := float64(i%16)*0.06 + 0.01
+		lat := float64(i/16)*0.1 + 0.01
+		way := &EncodedWayFeature{
+			AbstractEncodedFeature: AbstractEncodedFeature{ID: uint64(i + 1), Geometry: &orb.LineString{{lon, lat}, {lon + 0.02, lat + 0.02}}, Keys: []int{}, Values: []int{}},
+			Nodes:                  osm.WayNodes{{ID: 1, Lon: lon, Lat: lat}, {ID: 2, Lon: lon + 0.02, Lat: lat + 0.02}},
+		}
+		gridIndexWriter.cacheRawEncodedWays[cell] = append(gridIndexWriter.cacheRawEncodedWays[cell], feature.WayFeature(way))
+	}
+
+	err := gridIndexWriter.addAdditionalIdsToObjectsInCells([]common.CellIndex{cell})
+	common.AssertNil(t, err)
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: gridIndexWriter.BaseGridIndex,
+		cellCache:     newLruCache(10),
+		metadata:      &IndexMetadata{},
+	}
+
+	// Act
+	bbox := orb.Bound{Min: orb.Point{0.1, 0.1}, Max: orb.Point{0.2, 0.2}}
+	resultChannel, err := gridIndexReader.Get(&bbox, ownOsm.OsmObjWay, nil, nil, nil)
+	common.AssertNil(t, err)
+	var ids []uint64
+	for result := range resultChannel {
+		for _, f := range result.Features {
+			ids = append(ids, f.GetID())
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	// Assert
+	_, statErr := os.Stat(getCellRTreeFileName(baseFolder, 0, 0, ownOsm.OsmObjWay))
+	common.AssertNil(t, statErr)
+	common.AssertEqual(t, []uint64{19, 20}, ids)
+	cachedFeatures, _ := gridIndexReader.cellCache.getAll(getCellFileName(baseFolder, 0, 0, ownOsm.OsmObjWay))
+	common.AssertEqual(t, 0, len(cachedFeatures))
+}
@@ -0,0 +1,56 @@
+package index
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	ownOsm "soq/osm"
+)
+
+// CorruptCellError is returned when a cell file contains incomplete records, e.g. because it has been truncated by a
+// full disk or an aborted copy. Readers of the grid index skip such cells instead of failing the whole query, the
+// corrupt cell is then part of the GetFeaturesResult. The verify command finds and quarantines corrupt cells.
+type CorruptCellError struct {
+	Filename   string
+	ObjectType ownOsm.OsmObjectType
+	cause      error
+}
+
+// NewCorruptCellError creates the error for the given cell file. Implementations of GeometryIndex use it to report
+// corrupt cells in their GetFeaturesResult.
+func NewCorruptCellError(filename string, objectType ownOsm.OsmObjectType, cause error) *CorruptCellError {
+	return &CorruptCellError{
+		Filename:   filename,
+		ObjectType: objectType,
+		cause:      cause,
+	}
+}
+
+func (e *CorruptCellError) Error() string {
+	return fmt.Sprintf("Corrupt %s cell file %s: %s", e.ObjectType.String(), e.Filename, e.cause.Error())
+}
+
+func (e *CorruptCellError) Unwrap() error {
+	return e.cause
+}
+
+// checkCellData returns a CorruptCellError when the given data of a cell file contains incomplete records. The decoding
+// functions assume complete records, so this must be checked before decoding.
+func checkCellData(data []byte, filename string, objectType ownOsm.OsmObjectType) error {
+	err := verifyCellDataStructure(data, objectType)
+	if err != nil {
+		return NewCorruptCellError(filename, objectType, err)
+	}
+	return nil
+}
+
+// getCorruptCellError returns the CorruptCellError within the given error or nil when the error has another cause. A
+// warning is logged for corrupt cells, since they're skipped by the caller.
+func getCorruptCellError(err error) *CorruptCellError {
+	var corruptCellError *CorruptCellError
+	if !errors.As(err, &corruptCellError) {
+		return nil
+	}
+	sigolo.Warnf("Skip corrupt cell, the result is incomplete: %s", corruptCellError.Error())
+	return corruptCellError
+}
@@ -0,0 +1,165 @@
+package index
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/pkg/errors"
+	"io"
+	"soq/feature"
+	"strconv"
+	"time"
+)
+
+const (
+	// OutputFormatCsv writes one row per feature with the columns of OutputOptions.Columns.
+	OutputFormatCsv = "csv"
+
+	// CsvGeometryColumn is the column containing the geometry of the feature as WKT.
+	CsvGeometryColumn = "geom_wkt"
+)
+
+// DefaultCsvColumns are used when no columns are given.
+var DefaultCsvColumns = []string{"@type", "@id", CsvGeometryColumn}
+
+// csvFeatureWriter writes features as rows of a CSV file. Each column is a property of the GeoJSON feature (i.e. a tag
+// key or a property like "@id") or CsvGeometryColumn.
+type csvFeatureWriter struct {
+	writer  *csv.Writer
+	columns []string
+	options OutputOptions
+}
+
+func newCsvFeatureWriter(options OutputOptions, writer io.Writer) (*csvFeatureWriter, error) {
+	columns := options.Columns
+	if len(columns) == 0 {
+		columns = DefaultCsvColumns
+	}
+
+	csvWriter := &csvFeatureWriter{
+		writer:  csv.NewWriter(writer),
+		columns: columns,
+		options: options,
+	}
+
+	err := csvWriter.writer.Write(columns)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to write CSV header")
+	}
+
+	return csvWriter, nil
+}
+
+// write writes the feature (and its resolved member ways, if any) as rows.
+func (w *csvFeatureWriter) write(encodedFeature feature.Feature, tagIndex *TagIndex) error {
+	for _, geoJsonFeature := range toGeoJsonFeatures(encodedFeature, tagIndex, w.options) {
+		row, err := w.toRow(geoJsonFeature)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to convert feature %d into CSV row", encodedFeature.GetID())
+		}
+
+		err = w.writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvFeatureWriter) toRow(geoJsonFeature *geojson.Feature) ([]string, error) {
+	row := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		if column == CsvGeometryColumn {
+			row[i] = wkt.MarshalString(DereferenceGeometry(geoJsonFeature.Geometry))
+			continue
+		}
+
+		value, ok := geoJsonFeature.Properties[column]
+		if !ok {
+			continue
+		}
+
+		switch typedValue := value.(type) {
+		case string:
+			row[i] = typedValue
+		case uint64:
+			row[i] = strconv.FormatUint(typedValue, 10)
+		case float64:
+			row[i] = strconv.FormatFloat(typedValue, 'f', -1, 64)
+		default:
+			// Structured properties like "@centroid" or "@members" are written as JSON.
+			jsonBytes, err := json.Marshal(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Unable to marshal property '%s'", column)
+			}
+			row[i] = string(jsonBytes)
+		}
+	}
+	return row, nil
+}
+
+func (w *csvFeatureWriter) flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// writeFeatureSetsAsCsv writes the features of all sets as rows of one CSV file with a header row.
+func writeFeatureSetsAsCsv(featureSets []FeatureSet, options OutputOptions, writer io.Writer) error {
+	sigolo.Info("Write features as CSV")
+	writeStartTime := time.Now()
+
+	csvWriter, err := newCsvFeatureWriter(options, writer)
+	if err != nil {
+		return err
+	}
+
+	for _, featureSet := range featureSets {
+		for _, encodedFeature := range featureSet.Features {
+			err = csvWriter.write(encodedFeature, featureSet.TagIndex)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = csvWriter.flush()
+	if err != nil {
+		return err
+	}
+
+	sigolo.Infof("Finished writing in %s", time.Since(writeStartTime))
+	return nil
+}
+
+// writeFeatureIteratorAsCsv is like writeFeatureSetsAsCsv but for the features of the iterator.
+func writeFeatureIteratorAsCsv(iterator feature.FeatureIterator, tagIndex *TagIndex, options OutputOptions, writer io.Writer) error {
+	sigolo.Info("Write features as CSV")
+	writeStartTime := time.Now()
+
+	csvWriter, err := newCsvFeatureWriter(options, writer)
+	if err != nil {
+		return err
+	}
+
+	numberOfFeatures := 0
+	for iterator.Next() {
+		err = csvWriter.write(iterator.Feature(), tagIndex)
+		if err != nil {
+			return err
+		}
+		numberOfFeatures++
+	}
+	if iterator.Err() != nil {
+		return iterator.Err()
+	}
+
+	err = csvWriter.flush()
+	if err != nil {
+		return err
+	}
+
+	sigolo.Infof("Finished writing %d features in %s", numberOfFeatures, time.Since(writeStartTime))
+	return nil
+}
@@ -0,0 +1,42 @@
+package index
+
+import (
+	"bytes"
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"testing"
+)
+
+func TestWriteFeatures_csv(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"building", "name"}, [][]string{{"yes"}, {"Foo, Bar"}})
+	node := &EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: &orb.Point{1.5, 2}, Keys: []int{1}, Values: []int{0}}}
+	way := &EncodedWayFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 2, Geometry: &orb.LineString{{0, 0}, {1, 0}, {1, 1}, {0, 0}}, Keys: []int{0}, Values: []int{0}}}
+	options := OutputOptions{Columns: []string{"@type", "@id", "name", "geom_wkt"}}
+
+	// Act
+	output := &bytes.Buffer{}
+	err := WriteFeatures([]feature.Feature{node, way}, tagIndex, OutputFormatCsv, options, output)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, `@type,@id,name,geom_wkt
+node,1,"Foo, Bar",POINT(1.5 2)
+way,2,,"POLYGON((0 0,1 0,1 1,0 0))"
+`, output.String())
+}
+
+func TestWriteFeatureIterator_csvDefaultColumns(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+	node := &EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: &orb.Point{1, 2}, Keys: []int{0}, Values: []int{0}}}
+
+	// Act
+	output := &bytes.Buffer{}
+	err := WriteFeatureIterator(&sliceFeatureIterator{features: []feature.Feature{node}, index: -1}, tagIndex, OutputFormatCsv, OutputOptions{}, output)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, "@type,@id,geom_wkt\nnode,1,POINT(1 2)\n", output.String())
+}
@@ -0,0 +1,54 @@
+package index
+
+import (
+	"soq/common"
+)
+
+// ElevationKey is the key whose values are stored as numerical elevation of nodes, s. common.ParseElevation.
+const ElevationKey = "ele"
+
+// elevationTable contains the parsed elevation of each value of the "ele" key. The values are parsed once during the
+// import instead of once per node.
+type elevationTable struct {
+	keyIndex   int
+	elevations []float64
+	valid      []bool
+}
+
+// newElevationTable parses all values of the elevation key. Returns nil when the key doesn't exist in the tag index.
+func newElevationTable(tagIndex *TagIndex) *elevationTable {
+	keyIndex := tagIndex.GetKeyIndexFromKeyString(ElevationKey)
+	if keyIndex == NotFound {
+		return nil
+	}
+
+	values := tagIndex.GetValuesForKey(keyIndex)
+	table := &elevationTable{
+		keyIndex:   keyIndex,
+		elevations: make([]float64, len(values)),
+		valid:      make([]bool, len(values)),
+	}
+	for i, value := range values {
+		table.elevations[i], table.valid[i] = common.ParseElevation(value)
+	}
+
+	return table
+}
+
+// getElevation returns the elevation of a feature with the given tags. The second return value is false when the
+// feature has no elevation tag or its value is no valid elevation.
+func (t *elevationTable) getElevation(keys []int, values []int) (float64, bool) {
+	for i, key := range keys {
+		if key != t.keyIndex {
+			continue
+		}
+
+		value := values[i]
+		if value < 0 || value >= len(t.elevations) || !t.valid[value] {
+			return 0, false
+		}
+		return t.elevations[value], true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package index
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestElevationTable_getElevation(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"ele", "natural"}, [][]string{{"1200 m", "950", "unknown"}, {"peak"}})
+	table := newElevationTable(tagIndex)
+
+	// Act
+	elevation, ok := table.getElevation([]int{1, 0}, []int{0, 0})
+	_, unknownOk := table.getElevation([]int{0}, []int{2})
+	_, withoutKeyOk := table.getElevation([]int{1}, []int{0})
+
+	// Assert
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, 1200.0, elevation)
+	common.AssertFalse(t, unknownOk)
+	common.AssertFalse(t, withoutKeyOk)
+}
+
+func TestNewElevationTable_withoutElevationKey(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"natural"}, [][]string{{"peak"}})
+
+	// Act
+	table := newElevationTable(tagIndex)
+
+	// Assert
+	common.AssertNil(t, table)
+}
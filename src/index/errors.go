@@ -0,0 +1,10 @@
+package index
+
+import "github.com/pkg/errors"
+
+// ErrIndexMissing is matched (s. errors.Is) by errors occurring because an index doesn't exist, e.g. when the import
+// hasn't run yet or removed the old index.
+var ErrIndexMissing = errors.New("Index not found")
+
+// ErrUnknownKey is matched (s. errors.Is) by errors occurring because a key doesn't exist in the tag-index.
+var ErrUnknownKey = errors.New("Unknown key")
@@ -4,6 +4,8 @@ import (
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/osm"
+	"soq/feature"
+	ownOsm "soq/osm"
 )
 
 type AbstractEncodedFeature struct {
@@ -11,14 +13,17 @@ type AbstractEncodedFeature struct {
 
 	Geometry orb.Geometry
 
-	// A bit-string defining which keys are set and which aren't. A 1 at index i says that the key with numeric
-	// representation i is set.
+	// A list of all key indices set on this feature.
 	Keys []int
 
-	// A list of all set values. The i-th entry corresponds to the i-th 1 in the keys bit-string and holds the numeric
-	// representation of the value. This means the amount of entries in this array is equal to the amount of ones in
-	// the keys bit-string.
+	// A list of all value indices. The i-th entry is the value of the i-th key in the Keys list.
 	Values []int
+
+	// The changeset and user of the feature, which is nil when the index doesn't contain metadata.
+	Metadata *feature.Metadata
+
+	// The validity interval of this version of the feature, which is nil when the index doesn't contain the history.
+	Validity *feature.Validity
 }
 
 func (f *AbstractEncodedFeature) GetID() uint64 {
@@ -37,38 +42,37 @@ func (f *AbstractEncodedFeature) GetValues() []int {
 	return f.Values
 }
 
-func (f *AbstractEncodedFeature) HasKey(keyIndex int) bool {
-	if keyIndex == -1 {
-		return false
-	}
-
-	bin := keyIndex / 8 // Element of the array
+func (f *AbstractEncodedFeature) GetMetadata() *feature.Metadata {
+	return f.Metadata
+}
 
-	// In case a key is requested that not even exists in the current bin, then if course the key is not set.
-	if bin > len(f.GetKeys())-1 {
-		return false
-	}
+func (f *AbstractEncodedFeature) GetValidity() *feature.Validity {
+	return f.Validity
+}
 
-	idxInBin := keyIndex % 8 // Bit position within the byte
-	return f.GetKeys()[bin]&(1<<idxInBin) != 0
+func (f *AbstractEncodedFeature) HasKey(keyIndex int) bool {
+	return f.getTagPosition(keyIndex) != -1
 }
 
 // GetValueIndex returns the value index (numerical representation of the actual value) for a given key index. This
 // function assumes that the key is set on the feature. Use featureHasKey to check this.
 func (f *AbstractEncodedFeature) GetValueIndex(keyIndex int) int {
-	// Go through all bits to count the number of 1's.
-	// TODO This can probably be optimised by preprocessing this (i.e. map from keyIndex to position in values array)
-	valueIndexPosition := 0
-	for i := 0; i < keyIndex; i++ {
-		bin := i / 8      // Element of the array
-		idxInBin := i % 8 // Bit position within the byte
-		if f.GetKeys()[bin]&(1<<idxInBin) != 0 {
-			// Key at "i" is set -> store its value
-			valueIndexPosition++
+	return f.GetValues()[f.getTagPosition(keyIndex)]
+}
+
+// getTagPosition returns the position of the given key in the keys list or -1 if the key is not set.
+func (f *AbstractEncodedFeature) getTagPosition(keyIndex int) int {
+	if keyIndex == -1 {
+		return -1
+	}
+
+	for i, k := range f.GetKeys() {
+		if k == keyIndex {
+			return i
 		}
 	}
 
-	return f.GetValues()[valueIndexPosition]
+	return -1
 }
 
 func (f *AbstractEncodedFeature) HasTag(keyIndex int, valueIndex int) bool {
@@ -87,13 +91,6 @@ func (f *AbstractEncodedFeature) Print() {
 	sigolo.Tracef("Feature:")
 	sigolo.Tracef("  id=%d", f.GetID())
 	sigolo.Tracef("  keys=%v", f.GetKeys())
-	var setKeyBits []int
-	for i := 0; i < len(f.GetKeys())*8; i++ {
-		if f.HasKey(i) {
-			setKeyBits = append(setKeyBits, i)
-		}
-	}
-	sigolo.Tracef("  set key bit positions=%v", setKeyBits)
 	sigolo.Tracef("  values=%v", f.GetValues())
 }
 
@@ -101,6 +98,13 @@ type EncodedNodeFeature struct {
 	AbstractEncodedFeature
 	WayIds      []osm.WayID      // An ID list of all ways this node is part of.
 	RelationIds []osm.RelationID // An ID list of all relations this node is part of.
+
+	Elevation    float64 // The numerically decoded "ele" tag in meters. Only valid when HasElevation is true.
+	HasElevation bool
+}
+
+func (f *EncodedNodeFeature) GetElevation() (float64, bool) {
+	return f.Elevation, f.HasElevation
 }
 
 func (f *EncodedNodeFeature) GetWayIds() []osm.WayID {
@@ -151,6 +155,15 @@ type EncodedRelationFeature struct {
 	WayIds            []osm.WayID
 	ChildRelationIds  []osm.RelationID
 	ParentRelationIds []osm.RelationID
+
+	// Roles of the members. The i-th role belongs to the i-th ID of the corresponding member list above.
+	NodeRoles          []string
+	WayRoles           []string
+	ChildRelationRoles []string
+
+	// Type of each member in the order of the OSM data. The i-th member of a certain type is the i-th ID of the
+	// corresponding member list above. When empty, the members are assumed to be grouped by type.
+	MemberTypes []ownOsm.OsmObjectType
 }
 
 func (f *EncodedRelationFeature) GetNodeIds() []osm.NodeID {
@@ -165,6 +178,73 @@ func (f *EncodedRelationFeature) GetChildRelationIds() []osm.RelationID {
 	return f.ChildRelationIds
 }
 
+func (f *EncodedRelationFeature) GetNodeRoles() []string {
+	return f.NodeRoles
+}
+
+func (f *EncodedRelationFeature) GetWayRoles() []string {
+	return f.WayRoles
+}
+
+func (f *EncodedRelationFeature) GetChildRelationRoles() []string {
+	return f.ChildRelationRoles
+}
+
+// GetMembers combines the separate member lists into one list in the order of the OSM data.
+func (f *EncodedRelationFeature) GetMembers() []feature.RelationMember {
+	memberTypes := f.MemberTypes
+	if len(memberTypes) == 0 {
+		for range f.NodeIds {
+			memberTypes = append(memberTypes, ownOsm.OsmObjNode)
+		}
+		for range f.WayIds {
+			memberTypes = append(memberTypes, ownOsm.OsmObjWay)
+		}
+		for range f.ChildRelationIds {
+			memberTypes = append(memberTypes, ownOsm.OsmObjRelation)
+		}
+	}
+
+	members := make([]feature.RelationMember, 0, len(memberTypes))
+	nextNode, nextWay, nextChildRelation := 0, 0, 0
+	for _, memberType := range memberTypes {
+		member := feature.RelationMember{Type: memberType}
+		switch memberType {
+		case ownOsm.OsmObjNode:
+			if nextNode >= len(f.NodeIds) {
+				continue
+			}
+			member.ID = uint64(f.NodeIds[nextNode])
+			member.Role = getRole(f.NodeRoles, nextNode)
+			nextNode++
+		case ownOsm.OsmObjWay:
+			if nextWay >= len(f.WayIds) {
+				continue
+			}
+			member.ID = uint64(f.WayIds[nextWay])
+			member.Role = getRole(f.WayRoles, nextWay)
+			nextWay++
+		case ownOsm.OsmObjRelation:
+			if nextChildRelation >= len(f.ChildRelationIds) {
+				continue
+			}
+			member.ID = uint64(f.ChildRelationIds[nextChildRelation])
+			member.Role = getRole(f.ChildRelationRoles, nextChildRelation)
+			nextChildRelation++
+		}
+		members = append(members, member)
+	}
+
+	return members
+}
+
+func getRole(roles []string, i int) string {
+	if i < len(roles) {
+		return roles[i]
+	}
+	return ""
+}
+
 func (f *EncodedRelationFeature) GetParentRelationIds() []osm.RelationID {
 	return f.ParentRelationIds
 }
@@ -176,3 +256,58 @@ func (f *EncodedRelationFeature) SetParentRelationIds(relationIds []osm.Relation
 func (f *EncodedRelationFeature) SetGeometry(geometry orb.Geometry) {
 	f.Geometry = geometry
 }
+
+// WithSelectedTags returns a copy of the given feature that only contains the tags with the given key indices. The
+// given feature is not changed, since it might be shared, e.g. with the cell cache.
+func WithSelectedTags(f feature.Feature, keyIndices []int) feature.Feature {
+	var keys []int
+	var values []int
+	for i, keyIndex := range f.GetKeys() {
+		for _, selectedKeyIndex := range keyIndices {
+			if keyIndex == selectedKeyIndex {
+				keys = append(keys, keyIndex)
+				values = append(values, f.GetValues()[i])
+				break
+			}
+		}
+	}
+
+	featureCopy, abstractFeatureCopy := copyFeature(f)
+	if featureCopy == nil {
+		sigolo.Warnf("Unable to select tags of feature %d with unsupported type %T", f.GetID(), f)
+		return f
+	}
+	abstractFeatureCopy.Keys, abstractFeatureCopy.Values = keys, values
+
+	return featureCopy
+}
+
+// WithGeometry returns a copy of the given feature with the given geometry. The given feature is not changed, since it
+// might be shared, e.g. with the cell cache.
+func WithGeometry(f feature.Feature, geometry orb.Geometry) feature.Feature {
+	featureCopy, abstractFeatureCopy := copyFeature(f)
+	if featureCopy == nil {
+		sigolo.Warnf("Unable to change geometry of feature %d with unsupported type %T", f.GetID(), f)
+		return f
+	}
+	abstractFeatureCopy.Geometry = geometry
+
+	return featureCopy
+}
+
+// copyFeature returns a shallow copy of the given feature together with its abstract part, so that callers can change
+// the common fields of the copy. Nil is returned for unsupported feature types.
+func copyFeature(f feature.Feature) (feature.Feature, *AbstractEncodedFeature) {
+	switch typedFeature := f.(type) {
+	case *EncodedNodeFeature:
+		featureCopy := *typedFeature
+		return &featureCopy, &featureCopy.AbstractEncodedFeature
+	case *EncodedWayFeature:
+		featureCopy := *typedFeature
+		return &featureCopy, &featureCopy.AbstractEncodedFeature
+	case *EncodedRelationFeature:
+		featureCopy := *typedFeature
+		return &featureCopy, &featureCopy.AbstractEncodedFeature
+	}
+	return nil, nil
+}
@@ -1,7 +1,11 @@
 package index
 
 import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
 	"soq/common"
+	soqFeature "soq/feature"
+	ownOsm "soq/osm"
 	"testing"
 )
 
@@ -10,8 +14,8 @@ func TestEncodedFeature_GetValueIndex(t *testing.T) {
 	feature := EncodedNodeFeature{
 		AbstractEncodedFeature: AbstractEncodedFeature{
 			Geometry: nil,
-			Keys:     []byte{138}, // Little endian: 0101 0001 -> available key indices are 1, 3 and 7
-			Values:   []int{5, 6, 7},
+			Keys:     []int{1, 7, 3},
+			Values:   []int{5, 7, 6},
 		},
 	}
 
@@ -28,9 +32,98 @@ func TestEncodedFeature_GetValueIndex(t *testing.T) {
 	value7 := feature.GetValueIndex(7)
 	common.AssertEqual(t, 7, value7)
 
+	common.AssertFalse(t, feature.HasKey(-1))
 	common.AssertFalse(t, feature.HasKey(0))
 	common.AssertFalse(t, feature.HasKey(2))
 	common.AssertFalse(t, feature.HasKey(4))
 	common.AssertFalse(t, feature.HasKey(5))
 	common.AssertFalse(t, feature.HasKey(6))
+	common.AssertFalse(t, feature.HasKey(8))
+}
+
+func TestEncodedFeature_HasTag(t *testing.T) {
+	// Arrange
+	feature := EncodedNodeFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			Keys:   []int{2, 0},
+			Values: []int{5, 3},
+		},
+	}
+
+	// Act & Assert
+	common.AssertTrue(t, feature.HasTag(2, 5))
+	common.AssertTrue(t, feature.HasTag(0, 3))
+	common.AssertFalse(t, feature.HasTag(2, 3))
+	common.AssertFalse(t, feature.HasTag(1, 5))
+}
+
+func TestEncodedFeature_WithSelectedTags(t *testing.T) {
+	// Arrange
+	feature := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			ID:       123,
+			Geometry: &orb.LineString{{1, 2}, {3, 4}},
+			Keys:     []int{1, 7, 3},
+			Values:   []int{5, 7, 6},
+		},
+	}
+
+	// Act
+	selectedFeature := WithSelectedTags(feature, []int{3, 1, 10})
+
+	// Assert
+	selectedWay, ok := selectedFeature.(*EncodedWayFeature)
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, uint64(123), selectedWay.GetID())
+	common.AssertEqual(t, feature.Geometry, selectedWay.GetGeometry())
+	common.AssertEqual(t, []int{1, 3}, selectedWay.GetKeys())
+	common.AssertEqual(t, []int{5, 6}, selectedWay.GetValues())
+
+	// Original feature must not be changed
+	common.AssertEqual(t, []int{1, 7, 3}, feature.GetKeys())
+	common.AssertEqual(t, []int{5, 7, 6}, feature.GetValues())
+}
+
+func TestEncodedRelationFeature_GetMembers(t *testing.T) {
+	// Arrange
+	relation := &EncodedRelationFeature{
+		NodeIds:            []osm.NodeID{1, 2},
+		WayIds:             []osm.WayID{3},
+		ChildRelationIds:   []osm.RelationID{4},
+		NodeRoles:          []string{"stop", "stop"},
+		WayRoles:           []string{""},
+		ChildRelationRoles: []string{"subarea"},
+		MemberTypes:        []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjRelation, ownOsm.OsmObjNode},
+	}
+
+	// Act
+	members := relation.GetMembers()
+
+	// Assert
+	common.AssertEqual(t, []soqFeature.RelationMember{
+		{Type: ownOsm.OsmObjNode, ID: 1, Role: "stop"},
+		{Type: ownOsm.OsmObjWay, ID: 3, Role: ""},
+		{Type: ownOsm.OsmObjRelation, ID: 4, Role: "subarea"},
+		{Type: ownOsm.OsmObjNode, ID: 2, Role: "stop"},
+	}, members)
+}
+
+func TestEncodedRelationFeature_GetMembersWithoutMemberTypes(t *testing.T) {
+	// Arrange
+	relation := &EncodedRelationFeature{
+		NodeIds:   []osm.NodeID{1},
+		WayIds:    []osm.WayID{2, 3},
+		NodeRoles: []string{"label"},
+		WayRoles:  []string{"outer"},
+	}
+
+	// Act
+	members := relation.GetMembers()
+
+	// Assert
+	common.AssertEqual(t, []soqFeature.RelationMember{
+		{Type: ownOsm.OsmObjNode, ID: 1, Role: "label"},
+		{Type: ownOsm.OsmObjWay, ID: 2, Role: "outer"},
+		{Type: ownOsm.OsmObjWay, ID: 3, Role: ""},
+	}, members)
 }
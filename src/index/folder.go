@@ -0,0 +1,192 @@
+package index
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"soq/common"
+	"strings"
+	"time"
+)
+
+// An index folder is a symlink to the folder of the current version of the index, which lies next to it, e.g.
+// "soq-index" -> "soq-index.version-20250101-120000.000000000". Imports write into a new version folder and activate it
+// by replacing the symlink, so readers either see the complete old or the complete new index.
+const indexVersionSeparator = ".version-"
+
+// NewIndexVersionFolder creates an empty folder for a new version of the given index folder. Activate it with
+// ActivateIndexVersion once all files have been written.
+func NewIndexVersionFolder(indexBaseFolder string) (string, error) {
+	indexBaseFolder = filepath.Clean(indexBaseFolder)
+
+	err := os.MkdirAll(filepath.Dir(indexBaseFolder), os.ModePerm)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to create parent folder of index folder %s", indexBaseFolder)
+	}
+
+	versionFolder := getIndexVersionFolderName(indexBaseFolder)
+	err = os.Mkdir(versionFolder, os.ModePerm)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to create index version folder %s", versionFolder)
+	}
+
+	return versionFolder, nil
+}
+
+// ActivateIndexVersion lets the given index folder point to the given version folder (s. NewIndexVersionFolder). The
+// symlink is replaced atomically. The previously active version is kept, so that readers which loaded it before can
+// finish their work. Older versions are removed unless a reader still uses them (s. lockIndexVersion), such versions
+// are removed by a later activation. An index folder of an import without versions becomes the previous
+// version, in which case the index folder doesn't exist for a short moment.
+func ActivateIndexVersion(indexBaseFolder string, versionFolder string, durable bool) error {
+	indexBaseFolder = filepath.Clean(indexBaseFolder)
+	parentFolder := filepath.Dir(indexBaseFolder)
+
+	linkName := indexBaseFolder + ".link"
+	err := os.Remove(linkName)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Unable to remove old symlink %s", linkName)
+	}
+	// Relative targets keep working when the parent folder is moved.
+	err = os.Symlink(filepath.Base(versionFolder), linkName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create symlink to index version %s", versionFolder)
+	}
+
+	previousVersionFolder := ""
+	info, err := os.Lstat(indexBaseFolder)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(indexBaseFolder)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read symlink of index folder %s", indexBaseFolder)
+		}
+		previousVersionFolder = target
+		if !filepath.IsAbs(target) {
+			previousVersionFolder = filepath.Join(parentFolder, target)
+		}
+	} else if err == nil {
+		// A rename can't replace a folder, so it's moved away first.
+		previousVersionFolder = getIndexVersionFolderName(indexBaseFolder)
+		err = os.Rename(indexBaseFolder, previousVersionFolder)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to move index folder %s to %s", indexBaseFolder, previousVersionFolder)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Unable to get file info of index folder %s", indexBaseFolder)
+	}
+
+	err = os.Rename(linkName, indexBaseFolder)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to replace index folder %s by symlink to %s", indexBaseFolder, versionFolder)
+	}
+	if durable {
+		err = common.SyncDirectory(parentFolder)
+		if err != nil {
+			return err
+		}
+	}
+	sigolo.Debugf("Activated index version %s", versionFolder)
+
+	// A moved index folder without versions is newer than the new version, so the older of both must be kept.
+	oldestKeptVersionFolder := versionFolder
+	if previousVersionFolder != "" && filepath.Base(previousVersionFolder) < filepath.Base(versionFolder) {
+		oldestKeptVersionFolder = previousVersionFolder
+	}
+	removeOutdatedIndexVersions(indexBaseFolder, oldestKeptVersionFolder)
+	return nil
+}
+
+// ResolveIndexFolder returns the folder of the currently active version of the given index folder. Readers should load
+// all parts of the index from this folder, so that they keep using one version even when a new one is activated in the
+// meantime. Mounted packs and index folders without versions are returned unchanged.
+func ResolveIndexFolder(indexBaseFolder string) (string, error) {
+	if IsMountedPack(indexBaseFolder) {
+		return indexBaseFolder, nil
+	}
+
+	resolvedFolder, err := filepath.EvalSymlinks(indexBaseFolder)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to resolve index folder %s", indexBaseFolder)
+	}
+	return resolvedFolder, nil
+}
+
+// removeOutdatedIndexVersions removes all version folders of the given index folder created before the given version.
+// Newer folders might belong to running imports and are kept, just like folders locked by a reader. Errors are only
+// logged, since the new version is already active.
+func removeOutdatedIndexVersions(indexBaseFolder string, oldestKeptVersionFolder string) {
+	parentFolder := filepath.Dir(indexBaseFolder)
+	entries, err := os.ReadDir(parentFolder)
+	if err != nil {
+		sigolo.Warnf("Unable to list old index versions in %s: %+v", parentFolder, err)
+		return
+	}
+
+	versionPrefix := filepath.Base(indexBaseFolder) + indexVersionSeparator
+	for _, entry := range entries {
+		// The names contain the creation time and are therefore ordered by it.
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), versionPrefix) || entry.Name() >= filepath.Base(oldestKeptVersionFolder) {
+			continue
+		}
+
+		versionFolder := filepath.Join(parentFolder, entry.Name())
+		fd, locked, err := tryLockFolderExclusive(versionFolder)
+		if err != nil {
+			sigolo.Warnf("Unable to lock old index version %s: %+v", versionFolder, err)
+			continue
+		}
+		if !locked {
+			sigolo.Debugf("Keep old index version %s, it's still in use", versionFolder)
+			continue
+		}
+
+		sigolo.Debugf("Remove old index version %s", versionFolder)
+		err = os.RemoveAll(versionFolder)
+		if err != nil {
+			sigolo.Warnf("Unable to remove old index version %s: %+v", versionFolder, err)
+		}
+		unlockFolder(fd)
+	}
+}
+
+// indexVersionLock keeps the version folder of an index from being removed by ActivateIndexVersion while it's read.
+type indexVersionLock struct {
+	fd int
+}
+
+// lockIndexVersion locks the given (resolved, s. ResolveIndexFolder) index folder with a shared lock, which is held
+// until the lock is released or the process ends. Mounted packs are never removed and need no lock.
+func lockIndexVersion(indexFolder string) (*indexVersionLock, error) {
+	if IsMountedPack(indexFolder) {
+		return nil, nil
+	}
+
+	fd, err := lockFolderShared(indexFolder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to lock index folder %s", indexFolder)
+	}
+
+	// The folder might have been removed between resolving and locking it.
+	_, err = os.Stat(indexFolder)
+	if err != nil {
+		unlockFolder(fd)
+		return nil, errors.Wrapf(err, "Unable to lock index folder %s", indexFolder)
+	}
+
+	return &indexVersionLock{fd: fd}, nil
+}
+
+// release allows removing the locked folder. Releasing a lock multiple times has no effect.
+func (l *indexVersionLock) release() {
+	if l == nil {
+		return
+	}
+	unlockFolder(l.fd)
+	l.fd = -1
+}
+
+// getIndexVersionFolderName returns the name of a new version folder, which contains the current time.
+func getIndexVersionFolderName(indexBaseFolder string) string {
+	return indexBaseFolder + indexVersionSeparator + time.Now().UTC().Format("20060102-150405.000000000")
+}
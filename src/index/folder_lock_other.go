@@ -0,0 +1,16 @@
+//go:build !unix
+
+package index
+
+// lockFolderShared does nothing on systems without file locks.
+func lockFolderShared(folder string) (int, error) {
+	return -1, nil
+}
+
+// tryLockFolderExclusive always succeeds on systems without file locks.
+func tryLockFolderExclusive(folder string) (int, bool, error) {
+	return -1, true, nil
+}
+
+func unlockFolder(fd int) {
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package index
+
+import (
+	"syscall"
+)
+
+// lockFolderShared opens the given folder and locks it with a shared lock, which is held until unlockFolder is called
+// with the returned file descriptor or the process ends.
+func lockFolderShared(folder string) (int, error) {
+	fd, err := syscall.Open(folder, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return -1, err
+	}
+
+	err = syscall.Flock(fd, syscall.LOCK_SH)
+	if err != nil {
+		_ = syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// tryLockFolderExclusive opens the given folder and locks it with an exclusive lock. False is returned, when another
+// process or reader holds a lock on the folder.
+func tryLockFolderExclusive(folder string) (int, bool, error) {
+	fd, err := syscall.Open(folder, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return -1, false, err
+	}
+
+	err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		_ = syscall.Close(fd)
+		return -1, false, nil
+	}
+	if err != nil {
+		_ = syscall.Close(fd)
+		return -1, false, err
+	}
+	return fd, true, nil
+}
+
+// unlockFolder releases the lock of the given file descriptor.
+func unlockFolder(fd int) {
+	if fd >= 0 {
+		_ = syscall.Close(fd)
+	}
+}
@@ -0,0 +1,131 @@
+package index
+
+import (
+	"os"
+	"path"
+	"soq/common"
+	"testing"
+)
+
+func writeTestVersion(t *testing.T, indexBaseFolder string, content string) string {
+	versionFolder, err := NewIndexVersionFolder(indexBaseFolder)
+	common.AssertNil(t, err)
+	common.AssertNil(t, os.WriteFile(path.Join(versionFolder, "data"), []byte(content), 0644))
+	return versionFolder
+}
+
+func readTestVersion(t *testing.T, folder string) string {
+	content, err := os.ReadFile(path.Join(folder, "data"))
+	common.AssertNil(t, err)
+	return string(content)
+}
+
+func TestActivateIndexVersion(t *testing.T) {
+	// Arrange
+	indexBaseFolder := path.Join(t.TempDir(), "soq-index")
+	firstVersion := writeTestVersion(t, indexBaseFolder, "first")
+	common.AssertNil(t, ActivateIndexVersion(indexBaseFolder, firstVersion, false))
+	secondVersion := writeTestVersion(t, indexBaseFolder, "second")
+
+	// Act
+	err := ActivateIndexVersion(indexBaseFolder, secondVersion, false)
+
+	// Assert
+	common.AssertNil(t, err)
+	resolvedFolder, err := ResolveIndexFolder(indexBaseFolder)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, secondVersion, resolvedFolder)
+	common.AssertEqual(t, "second", readTestVersion(t, indexBaseFolder))
+	// Readers of the previous version can still finish their work
+	common.AssertEqual(t, "first", readTestVersion(t, firstVersion))
+}
+
+func TestActivateIndexVersion_removesOutdatedVersions(t *testing.T) {
+	// Arrange
+	parentFolder := t.TempDir()
+	indexBaseFolder := path.Join(parentFolder, "soq-index")
+	otherFolder := path.Join(parentFolder, "soq-index-backup")
+	common.AssertNil(t, os.Mkdir(otherFolder, os.ModePerm))
+	var versions []string
+	for _, content := range []string{"first", "second"} {
+		version := writeTestVersion(t, indexBaseFolder, content)
+		common.AssertNil(t, ActivateIndexVersion(indexBaseFolder, version, false))
+		versions = append(versions, version)
+	}
+	thirdVersion := writeTestVersion(t, indexBaseFolder, "third")
+	runningImportVersion := writeTestVersion(t, indexBaseFolder, "running")
+
+	// Act
+	err := ActivateIndexVersion(indexBaseFolder, thirdVersion, false)
+
+	// Assert
+	common.AssertNil(t, err)
+	_, err = os.Stat(versions[0])
+	common.AssertTrue(t, os.IsNotExist(err))
+	common.AssertEqual(t, "second", readTestVersion(t, versions[1]))
+	common.AssertEqual(t, "third", readTestVersion(t, indexBaseFolder))
+	common.AssertEqual(t, "running", readTestVersion(t, runningImportVersion))
+	_, err = os.Stat(otherFolder)
+	common.AssertNil(t, err)
+}
+
+func TestActivateIndexVersion_folderWithoutVersions(t *testing.T) {
+	// Arrange
+	indexBaseFolder := path.Join(t.TempDir(), "soq-index")
+	common.AssertNil(t, os.Mkdir(indexBaseFolder, os.ModePerm))
+	common.AssertNil(t, os.WriteFile(path.Join(indexBaseFolder, "data"), []byte("old"), 0644))
+	newVersion := writeTestVersion(t, indexBaseFolder, "new")
+
+	// Act
+	err := ActivateIndexVersion(indexBaseFolder, newVersion, false)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, "new", readTestVersion(t, indexBaseFolder))
+	entries, err := os.ReadDir(path.Dir(indexBaseFolder))
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 3, len(entries)) // The symlink, the new version and the old folder as previous version
+}
+
+func TestResolveIndexFolder_folderWithoutVersions(t *testing.T) {
+	// Arrange
+	indexBaseFolder := t.TempDir()
+
+	// Act
+	resolvedFolder, err := ResolveIndexFolder(indexBaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, indexBaseFolder, resolvedFolder)
+}
+
+func TestActivateIndexVersion_keepsLockedVersions(t *testing.T) {
+	// Arrange
+	indexBaseFolder := path.Join(t.TempDir(), "soq-index")
+	var versions []string
+	for _, content := range []string{"first", "second"} {
+		version := writeTestVersion(t, indexBaseFolder, content)
+		common.AssertNil(t, ActivateIndexVersion(indexBaseFolder, version, false))
+		versions = append(versions, version)
+	}
+	lock, err := lockIndexVersion(versions[0])
+	common.AssertNil(t, err)
+	thirdVersion := writeTestVersion(t, indexBaseFolder, "third")
+	fourthVersion := writeTestVersion(t, indexBaseFolder, "fourth")
+
+	// Act
+	err = ActivateIndexVersion(indexBaseFolder, thirdVersion, false)
+	common.AssertNil(t, err)
+	firstVersionWhileLocked := readTestVersion(t, versions[0])
+	lock.release()
+	err = ActivateIndexVersion(indexBaseFolder, fourthVersion, false)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, "first", firstVersionWhileLocked)
+	_, err = os.Stat(versions[0])
+	common.AssertTrue(t, os.IsNotExist(err))
+	_, err = os.Stat(versions[1])
+	common.AssertTrue(t, os.IsNotExist(err))
+	common.AssertEqual(t, "fourth", readTestVersion(t, indexBaseFolder))
+}
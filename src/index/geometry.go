@@ -6,16 +6,96 @@ import (
 	"soq/common"
 	"soq/feature"
 	ownOsm "soq/osm"
+	"time"
 )
 
 type GetFeaturesResult struct {
 	Cell     common.CellIndex
 	Features []feature.Feature
+	// True when the cell hasn't been read, e.g. because its key bitmap shows that it contains no matching features.
+	Skipped bool
+	// Time it took to read and decode the features of the cell (or to get them from the cache).
+	DecodeDuration time.Duration
+	// Set when the cell file is corrupt. Such cells are skipped and contain no features, so the result is incomplete.
+	CorruptCell *CorruptCellError
+	// Set when the cell couldn't be read for other reasons, e.g. a failed read of the file. The result contains no
+	// features and consumers should stop and return this error.
+	Err error
 }
 
+// IdFilter determines whether a feature with the given OSM ID should be read. Features not matching the filter can be
+// skipped by the index without decoding them.
+type IdFilter func(id uint64) bool
+
+// KeyFilter determines whether a cell might contain matching features based on the keys occurring in that cell. The
+// hasKey function reports whether a key occurs in the cell. Cells not matching the filter can be skipped by the index
+// without reading them.
+type KeyFilter func(hasKey func(key int) bool) bool
+
+// TagFilter determines whether a feature with the given encoded keys and values should be read. Features not matching
+// the filter can be skipped by the index without decoding their geometry and other data.
+type TagFilter func(keys []int, values []int) bool
+
+// Maximum distance in degrees between the coordinate of a way node and its stored node feature. Stored coordinates are
+// float32 values, which are accurate to about 1e-5 degrees at a longitude of 180°.
+const nodeCellTolerance = 1e-5
+
+// WayNodesResult contains the node features of a way in the order of the node list of the way.
+type WayNodesResult struct {
+	// The i-th entry is the feature of the i-th way node or nil when the node doesn't exist in the index. Nodes occurring
+	// multiple times in a way (e.g. the first and last node of closed ways) are at all of their positions.
+	Nodes []feature.NodeFeature
+	// IDs of the nodes not found in the index (e.g. untagged nodes skipped during the import), each ID only once.
+	MissingNodeIds []osm.NodeID
+}
+
+func newWayNodesResult(wayNodes osm.WayNodes, foundNodes map[uint64]feature.NodeFeature) *WayNodesResult {
+	result := &WayNodesResult{
+		Nodes: make([]feature.NodeFeature, len(wayNodes)),
+	}
+
+	reportedMissingNodes := map[osm.NodeID]bool{}
+	for i, wayNode := range wayNodes {
+		node, found := foundNodes[uint64(wayNode.ID)]
+		if found {
+			result.Nodes[i] = node
+		} else if !reportedMissingNodes[wayNode.ID] {
+			reportedMissingNodes[wayNode.ID] = true
+			result.MissingNodeIds = append(result.MissingNodeIds, wayNode.ID)
+		}
+	}
+
+	return result
+}
+
+// IsComplete returns true when all nodes of the way have been found.
+func (r *WayNodesResult) IsComplete() bool {
+	return len(r.MissingNodeIds) == 0
+}
+
+// GeometryIndex stores the features in cells, which are determined by a common.CellScheme. The grid index
+// (GridIndexReader) is the only implementation, the cell scheme stored in the index metadata decides how coordinates
+// are mapped to cells.
 type GeometryIndex interface {
-	Get(bbox *orb.Bound, objectType ownOsm.OsmObjectType) (chan *GetFeaturesResult, error)
+	// Get returns all features of the given type within the bbox. The optional ID filter (might be nil) can be used to
+	// only get features with certain IDs. The optional key filter (might be nil) can be used to skip cells without
+	// certain keys. Features from non-skipped cells might not match the key filter. The optional tag filter (might be
+	// nil) can be used to only get features with certain tags.
+	Get(bbox *orb.Bound, objectType ownOsm.OsmObjectType, idFilter IdFilter, keyFilter KeyFilter, tagFilter TagFilter) (chan *GetFeaturesResult, error)
+	// GetFeaturesForCells returns all features of the given type within the given cells, regardless of their geometry.
 	GetFeaturesForCells(cells []common.CellIndex, objectType ownOsm.OsmObjectType) chan *GetFeaturesResult
-	GetNodes(nodes osm.WayNodes) (chan *GetFeaturesResult, error)
+	// GetNodes returns the node features of the given way nodes, s. WayNodesResult.
+	GetNodes(nodes osm.WayNodes) (*WayNodesResult, error)
+	// MightContainNodes returns false when the given cell definitely contains none of the given nodes. This is cheaper
+	// than reading the cell.
+	MightContainNodes(cell common.CellIndex, nodeIds []uint64) (bool, error)
+	// GetCellIndexForCoordinate returns the cell containing the given coordinate. The cells of a bbox are all cells
+	// between the cells of its lower-left and upper-right corner.
 	GetCellIndexForCoordinate(x float64, y float64) common.CellIndex
+	GetMetadata() *IndexMetadata
+	// GetKeyStatistics returns the key counts recorded during the import. Might be nil for older indices.
+	GetKeyStatistics() *KeyStatistics
+	// At returns a view of this index only containing the feature versions valid at the given time. Features of indices
+	// without history (s. IndexMetadata.History) are always valid.
+	At(t time.Time) GeometryIndex
 }
@@ -1,19 +1,18 @@
 package index
 
 import (
-	"encoding/binary"
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/osm"
 	"github.com/pkg/errors"
-	"math"
 	"os"
 	"path"
 	"soq/common"
+	"soq/encoding"
 	"soq/feature"
 	ownOsm "soq/osm"
-	"strconv"
 	"sync"
+	"time"
 )
 
 type GridIndexReader struct {
@@ -21,30 +20,131 @@ type GridIndexReader struct {
 
 	checkFeatureValidity bool
 	cellCache            featureCache
+	metadata             *IndexMetadata
+	readerThreads        int
+	relationGeometries   *RelationGeometryStore
+	keyStatistics        *KeyStatistics
+	splitCells           sync.Map   // Sub-cells per split file name, s. getSubCells.
+	validAt              *time.Time // Only feature versions valid at this time are returned. Nil returns all versions.
+	versionLock          *indexVersionLock
 }
 
-func LoadGridIndex(indexBaseFolder string, cellWidth float64, cellHeight float64, checkFeatureValidity bool, tagIndex *TagIndex) *GridIndexReader {
+// LoadGridIndex loads the grid-index of the given index folder. An error is returned when the index can't be used, e.g.
+// because of an outdated format version, so that the caller decides whether to exit or e.g. to keep using an old index.
+//
+// The cells are read lazily, so the index folder is locked until Close is called, which keeps imports from removing it.
+func LoadGridIndex(indexBaseFolder string, cellWidth float64, cellHeight float64, checkFeatureValidity bool, tagIndex *TagIndex, settings common.Settings) (*GridIndexReader, error) {
+	versionLock, err := lockIndexVersion(indexBaseFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := loadGridIndex(indexBaseFolder, cellWidth, cellHeight, checkFeatureValidity, tagIndex, settings)
+	if err != nil {
+		versionLock.release()
+		return nil, err
+	}
+
+	reader.versionLock = versionLock
+	return reader, nil
+}
+
+func loadGridIndex(indexBaseFolder string, cellWidth float64, cellHeight float64, checkFeatureValidity bool, tagIndex *TagIndex, settings common.Settings) (*GridIndexReader, error) {
+	metadata, err := LoadIndexMetadata(indexBaseFolder)
+	if err != nil {
+		return nil, err
+	}
+	err = metadata.CheckFormatVersion()
+	if err != nil {
+		return nil, err
+	}
+	relationGeometries, err := LoadRelationGeometryStore(indexBaseFolder)
+	if err != nil {
+		return nil, err
+	}
+	keyStatistics, err := LoadKeyStatistics(indexBaseFolder)
+	if err != nil {
+		return nil, err
+	}
+	cellScheme, err := common.NewCellScheme(metadata.CellScheme, cellWidth, cellHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	cellCache := newLruCache(settings.CellCacheSize)
+	cellCache.registerAt(settings.MemoryAccountant)
+
 	return &GridIndexReader{
 		BaseGridIndex: BaseGridIndex{
 			TagIndex:   tagIndex,
-			CellWidth:  cellWidth,
-			CellHeight: cellHeight,
+			CellScheme: cellScheme,
 			BaseFolder: path.Join(indexBaseFolder, GridIndexFolder),
 		},
 		checkFeatureValidity: checkFeatureValidity,
-		cellCache:            newLruCache(10), // TODO make this max-size parameter configurable
+		cellCache:            cellCache,
+		metadata:             metadata,
+		readerThreads:        settings.ReaderThreads,
+		relationGeometries:   relationGeometries,
+		keyStatistics:        keyStatistics,
+	}, nil
+}
+
+// Close removes the caches of this index from the memory accountant and allows imports to remove its index folder
+// (s. ActivateIndexVersion). The index must not be used afterwards.
+func (g *GridIndexReader) Close() {
+	g.cellCache.unregister()
+	g.versionLock.release()
+}
+
+func (g *GridIndexReader) GetMetadata() *IndexMetadata {
+	return g.metadata
+}
+
+func (g *GridIndexReader) GetKeyStatistics() *KeyStatistics {
+	return g.keyStatistics
+}
+
+// At returns a reader of the same index only returning the feature versions valid at the given time. Both readers share
+// their cell cache, since the cached features contain all versions.
+func (g *GridIndexReader) At(t time.Time) GeometryIndex {
+	return &GridIndexReader{
+		BaseGridIndex:        g.BaseGridIndex,
+		checkFeatureValidity: g.checkFeatureValidity,
+		cellCache:            g.cellCache,
+		metadata:             g.metadata,
+		readerThreads:        g.readerThreads,
+		relationGeometries:   g.relationGeometries,
+		keyStatistics:        g.keyStatistics,
+		validAt:              &t,
 	}
 }
 
-func (g *GridIndexReader) Get(bbox *orb.Bound, objectType ownOsm.OsmObjectType) (chan *GetFeaturesResult, error) {
+// isValid returns true when the given feature is valid at the time of this reader, s. At.
+func (g *GridIndexReader) isValid(encodedFeature feature.Feature) bool {
+	return g.validAt == nil || encodedFeature.GetValidity().IsValidAt(*g.validAt)
+}
+
+func (g *GridIndexReader) Get(bbox *orb.Bound, objectType ownOsm.OsmObjectType, idFilter IdFilter, keyFilter KeyFilter, tagFilter TagFilter) (chan *GetFeaturesResult, error) {
 	sigolo.Debugf("Get feature from bbox=%#v", bbox)
 	minCell := g.GetCellIndexForCoordinate(bbox.Min.Lon(), bbox.Min.Lat())
 	maxCell := g.GetCellIndexForCoordinate(bbox.Max.Lon(), bbox.Max.Lat())
 
+	if !g.metadata.CellKeyBitmaps {
+		// The index has no key bitmaps, so the key filter can't be used.
+		keyFilter = nil
+	}
+
+	var returnedIds *idSet
+	if objectType != ownOsm.OsmObjNode {
+		// Ways and relations are stored in every cell they cover. They're only returned from the first cell read, which
+		// also prevents decoding them again in the other cells.
+		returnedIds = newIdSet()
+	}
+
 	resultChannel := make(chan *GetFeaturesResult)
 
 	go func() {
-		numThreads := 3
+		numThreads := max(g.readerThreads, 1)
 
 		// Group the cells into columns of equal size so that each goroutine below can handle on column.
 		cellColumns := maxCell.X() - minCell.X() + 1 // min and max are inclusive, therefore +1
@@ -65,7 +165,7 @@ func (g *GridIndexReader) Get(bbox *orb.Bound, objectType ownOsm.OsmObjectType)
 				maxColX = maxCell.X()
 			}
 
-			go g.getFeaturesForCellsWithBbox(resultChannel, &wg, bbox, minColX, maxColX, minCell.Y(), maxCell.Y(), objectType)
+			go g.getFeaturesForCellsWithBbox(resultChannel, &wg, bbox, minColX, maxColX, minCell.Y(), maxCell.Y(), objectType, idFilter, keyFilter, tagFilter, returnedIds)
 		}
 
 		wg.Wait()
@@ -77,68 +177,96 @@ func (g *GridIndexReader) Get(bbox *orb.Bound, objectType ownOsm.OsmObjectType)
 	return resultChannel, nil // Remove error from return, since it doesn't make any sense here
 }
 
-func (g *GridIndexReader) GetNodes(nodes osm.WayNodes) (chan *GetFeaturesResult, error) {
-	cells := map[common.CellIndex][]uint64{}            // just a lookup table to quickly see if a cell has already been collected
-	innerCellBounds := map[common.CellIndex]orb.Bound{} // just a lookup table to quickly see if a cell has already been collected
+// GetNodes returns the node features of the given way nodes in the order of the way nodes. Nodes are usually read from
+// the cell of their way node coordinate. Nodes not found there are searched in the neighboring cells as well, since
+// coordinates close to a cell border might end up in the neighboring cell due to the limited precision of the stored
+// coordinates.
+func (g *GridIndexReader) GetNodes(nodes osm.WayNodes) (*WayNodesResult, error) {
+	wantedNodeIds := map[uint64]bool{}
+	cellsToRead := map[common.CellIndex]bool{}
 	for _, node := range nodes {
-		cell := g.GetCellIndexForCoordinate(node.Lon, node.Lat)
-		if _, ok := cells[cell]; !ok {
-			// New cell -> Create it and add first node ID
-			cells[cell] = []uint64{uint64(node.ID)}
-			innerCellBounds[cell] = node.Point().Bound()
-		} else {
-			// Cell has been seen before -> just add the new node ID
-			cells[cell] = append(cells[cell], uint64(node.ID))
-			innerCellBounds[cell] = innerCellBounds[cell].Union(node.Point().Bound())
-		}
+		wantedNodeIds[uint64(node.ID)] = true
+		cellsToRead[g.GetCellIndexForCoordinate(node.Lon, node.Lat)] = true
 	}
 
-	var resultChannel = make(chan *GetFeaturesResult, 10)
-
-	if len(cells) == 0 {
-		close(resultChannel)
-		return resultChannel, nil
+	foundNodes := map[uint64]feature.NodeFeature{}
+	readCells := map[common.CellIndex]bool{}
+	err := g.readNodesFromCells(cellsToRead, wantedNodeIds, foundNodes, readCells)
+	if err != nil {
+		return nil, err
 	}
 
-	go func() {
-		for cell, nodeIds := range cells {
-			innerCellBound := innerCellBounds[cell]
-			outputBuffer := []feature.Feature{}
-
-			unfilteredFeatures, err := g.readFeaturesFromCellFile(cell[0], cell[1], ownOsm.OsmObjNode)
-			sigolo.FatalCheck(err)
-
-			for i := 0; i < len(unfilteredFeatures); i++ {
-				encodedFeature := unfilteredFeatures[i]
-				if encodedFeature != nil {
-					// TODO Getting the bound, geometry and filtering takes quite long. Try to optimize this (maybe with a "encodedFeature.IsWithin()" func?)
-					featureBound := encodedFeature.GetGeometry().Bound()
-					notWithinCellContent := (innerCellBound.Max[0] < featureBound.Min[0]) ||
-						(innerCellBound.Min[0] > featureBound.Max[0]) ||
-						(innerCellBound.Max[1] < featureBound.Min[1]) ||
-						(innerCellBound.Min[1] > featureBound.Max[1])
-					if notWithinCellContent {
-						continue
-					}
-
-					for j := 0; j < len(nodeIds); j++ {
-						if encodedFeature.GetID() == nodeIds[j] {
-							outputBuffer = append(outputBuffer, encodedFeature)
-							break
-						}
+	if len(foundNodes) < len(wantedNodeIds) {
+		neighborCells := map[common.CellIndex]bool{}
+		for _, node := range nodes {
+			if _, found := foundNodes[uint64(node.ID)]; found {
+				continue
+			}
+			for _, lon := range []float64{node.Lon - nodeCellTolerance, node.Lon + nodeCellTolerance} {
+				for _, lat := range []float64{node.Lat - nodeCellTolerance, node.Lat + nodeCellTolerance} {
+					cell := g.GetCellIndexForCoordinate(lon, lat)
+					if !readCells[cell] {
+						neighborCells[cell] = true
 					}
 				}
 			}
+		}
 
-			resultChannel <- &GetFeaturesResult{
-				Cell:     cell,
-				Features: outputBuffer,
+		err = g.readNodesFromCells(neighborCells, wantedNodeIds, foundNodes, readCells)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newWayNodesResult(nodes, foundNodes), nil
+}
+
+// readNodesFromCells adds all wanted nodes of the given cells to the found nodes. Cells already read are skipped and all
+// other cells are added to the read cells. Cells whose node ID filter contains none of the missing nodes are not read.
+func (g *GridIndexReader) readNodesFromCells(cells map[common.CellIndex]bool, wantedNodeIds map[uint64]bool, foundNodes map[uint64]feature.NodeFeature, readCells map[common.CellIndex]bool) error {
+	idFilter := func(id uint64) bool {
+		return wantedNodeIds[id]
+	}
+
+	var wantedNodeIdList []uint64
+	for id := range wantedNodeIds {
+		if _, found := foundNodes[id]; !found {
+			wantedNodeIdList = append(wantedNodeIdList, id)
+		}
+	}
+
+	for cell := range cells {
+		if readCells[cell] {
+			continue
+		}
+		readCells[cell] = true
+
+		nodeIdFilter, err := g.readCellNodeIdFilter(cell.X(), cell.Y())
+		if err != nil {
+			return err
+		}
+		if !nodeIdFilter.MightContainAny(wantedNodeIdList) {
+			sigolo.Tracef("Skip cell %v since it contains none of the wanted nodes", cell)
+			continue
+		}
+
+		cellFeatures, err := g.readFeaturesFromCellFile(cell.X(), cell.Y(), ownOsm.OsmObjNode, idFilter, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, encodedFeature := range cellFeatures {
+			// Cached cells contain all features, so the ID has to be checked again.
+			if encodedFeature == nil || !wantedNodeIds[encodedFeature.GetID()] {
+				continue
+			}
+			if nodeFeature, ok := encodedFeature.(feature.NodeFeature); ok {
+				foundNodes[nodeFeature.GetID()] = nodeFeature
 			}
 		}
-		close(resultChannel)
-	}()
+	}
 
-	return resultChannel, nil
+	return nil
 }
 
 func (g *GridIndexReader) GetFeaturesForCells(cells []common.CellIndex, objectType ownOsm.OsmObjectType) chan *GetFeaturesResult {
@@ -151,9 +279,21 @@ func (g *GridIndexReader) GetFeaturesForCells(cells []common.CellIndex, objectTy
 				Features: []feature.Feature{},
 			}
 
-			encodedFeatures, err := g.readFeaturesFromCellFile(cell[0], cell[1], objectType)
-			sigolo.FatalCheck(err)
+			startTime := time.Now()
+			encodedFeatures, err := g.readFeaturesFromCellFile(cell[0], cell[1], objectType, nil, nil)
+			if featuresInCell.CorruptCell = getCorruptCellError(err); featuresInCell.CorruptCell != nil {
+				resultChannel <- featuresInCell
+				continue
+			} else if err != nil {
+				featuresInCell.Err = err
+				resultChannel <- featuresInCell
+				continue
+			}
+			if objectType == ownOsm.OsmObjRelation {
+				encodedFeatures = g.withRelationGeometries(encodedFeatures)
+			}
 			featuresInCell.Features = encodedFeatures
+			featuresInCell.DecodeDuration = time.Since(startTime)
 
 			resultChannel <- featuresInCell
 		}
@@ -163,8 +303,11 @@ func (g *GridIndexReader) GetFeaturesForCells(cells []common.CellIndex, objectTy
 	return resultChannel
 }
 
-func (g *GridIndexReader) getFeaturesForCellsWithBbox(output chan *GetFeaturesResult, wg *sync.WaitGroup, bbox *orb.Bound, minCellX int, maxCellX int, minCellY int, maxCellY int, objectType ownOsm.OsmObjectType) {
+// getFeaturesForCellsWithBbox reads the features of the given cells that are within the bbox. Features whose ID is in
+// the given set of returned IDs (might be nil) are skipped and all other features are added to it.
+func (g *GridIndexReader) getFeaturesForCellsWithBbox(output chan *GetFeaturesResult, wg *sync.WaitGroup, bbox *orb.Bound, minCellX int, maxCellX int, minCellY int, maxCellY int, objectType ownOsm.OsmObjectType, idFilter IdFilter, keyFilter KeyFilter, tagFilter TagFilter, returnedIds *idSet) {
 	sigolo.Debugf("Get %s features for cells minX=%d, minY=%d / maxX=%d, maxY=%d", objectType.String(), minCellX, minCellY, maxCellX, maxCellY)
+
 	for cellX := minCellX; cellX <= maxCellX; cellX++ {
 		for cellY := minCellY; cellY <= maxCellY; cellY++ {
 			sigolo.Debugf("Get %s features for cell X=%d, Y=%d", objectType.String(), cellX, cellY)
@@ -174,14 +317,52 @@ func (g *GridIndexReader) getFeaturesForCellsWithBbox(output chan *GetFeaturesRe
 				Features: []feature.Feature{},
 			}
 
-			encodedFeatures, err := g.readFeaturesFromCellFile(cellX, cellY, objectType)
-			sigolo.FatalCheck(err)
+			if keyFilter != nil {
+				keyBitmap, err := g.readCellKeyBitmap(cellX, cellY, objectType)
+				if err != nil {
+					featuresInBbox.Err = err
+					output <- featuresInBbox
+					continue
+				}
+				if !keyFilter(keyBitmap.HasKey) {
+					sigolo.Debugf("Skip cell X=%d, Y=%d since it contains no %s features with the required keys", cellX, cellY, objectType.String())
+					featuresInBbox.Skipped = true
+					output <- featuresInBbox
+					continue
+				}
+			}
+
+			startTime := time.Now()
+			// The returned IDs are checked after reading the cell instead of passing them as ID filter, since reading with
+			// an ID filter bypasses the cell cache.
+			encodedFeatures, err := g.readFeaturesFromCellFileInBbox(cellX, cellY, bbox, objectType, idFilter, tagFilter)
+			if featuresInBbox.CorruptCell = getCorruptCellError(err); featuresInBbox.CorruptCell != nil {
+				output <- featuresInBbox
+				continue
+			} else if err != nil {
+				featuresInBbox.Err = err
+				output <- featuresInBbox
+				continue
+			}
 
 			for i := 0; i < len(encodedFeatures); i++ {
-				if encodedFeatures[i] != nil && bbox.Intersects(encodedFeatures[i].GetGeometry().Bound()) {
-					featuresInBbox.Features = append(featuresInBbox.Features, encodedFeatures[i])
+				encodedFeature := encodedFeatures[i]
+				if encodedFeature == nil || idFilter != nil && !idFilter(encodedFeature.GetID()) {
+					continue
+				}
+				if objectType == ownOsm.OsmObjRelation {
+					encodedFeature = g.withRelationGeometry(encodedFeature)
+				}
+				if !bbox.Intersects(encodedFeature.GetGeometry().Bound()) {
+					continue
 				}
+				// Another goroutine might have read the same feature in the meantime, so the ID has to be checked again.
+				if returnedIds != nil && !returnedIds.add(encodedFeature.GetID()) {
+					continue
+				}
+				featuresInBbox.Features = append(featuresInBbox.Features, encodedFeature)
 			}
+			featuresInBbox.DecodeDuration = time.Since(startTime)
 
 			output <- featuresInBbox
 		}
@@ -191,15 +372,132 @@ func (g *GridIndexReader) getFeaturesForCellsWithBbox(output chan *GetFeaturesRe
 }
 
 // readFeaturesFromCellFile reads all features from the specified cell and writes them periodically to the output channel.
-func (g *GridIndexReader) readFeaturesFromCellFile(cellX int, cellY int, objectType ownOsm.OsmObjectType) ([]feature.Feature, error) {
-	cellFolderName := path.Join(g.BaseFolder, objectType.String(), strconv.Itoa(cellX))
-	cellFileName := path.Join(cellFolderName, strconv.Itoa(cellY)+".cell")
+// When an ID or tag filter is given and the cell is not cached, only the features matching the filters are decoded and
+// the result is not cached, since it's incomplete. The returned features might therefore contain features not matching
+// the filters (when they come from the cache), so callers have to apply the filters themselves.
+func (g *GridIndexReader) readFeaturesFromCellFile(cellX int, cellY int, objectType ownOsm.OsmObjectType, idFilter IdFilter, tagFilter TagFilter) ([]feature.Feature, error) {
+	return g.readFeaturesFromCellFileInBbox(cellX, cellY, nil, objectType, idFilter, tagFilter)
+}
 
-	if _, err := os.Stat(cellFileName); errors.Is(err, os.ErrNotExist) {
-		sigolo.Tracef("Cell file %s does not exist, I'll return an empty feature list", cellFileName)
+// readFeaturesFromCellFileInBbox is like readFeaturesFromCellFile but only reads the sub-cells with features within the
+// given bbox (nil means all sub-cells) when the cell has been split during the import. Ways and relations belonging to
+// multiple sub-cells are only returned once. Feature versions not valid at the time of this reader (s. At) are
+// not returned.
+func (g *GridIndexReader) readFeaturesFromCellFileInBbox(cellX int, cellY int, bbox *orb.Bound, objectType ownOsm.OsmObjectType, idFilter IdFilter, tagFilter TagFilter) ([]feature.Feature, error) {
+	cellFileNames, err := g.getCellFileNames(cellX, cellY, objectType, bbox)
+	if err != nil {
+		return nil, err
+	}
+	if len(cellFileNames) == 0 {
+		sigolo.Tracef("Cell x=%d, y=%d, type=%s does not exist, I'll return an empty feature list", cellX, cellY, objectType)
 		return nil, nil
+	}
+	if len(cellFileNames) == 1 {
+		features, usedRTree, err := g.readFeaturesFromFileWithRTree(cellX, cellY, cellFileNames[0], bbox, objectType, idFilter, tagFilter)
+		if !usedRTree && err == nil {
+			features, err = g.readFeaturesFromFile(cellFileNames[0], bbox, objectType, idFilter, tagFilter)
+		}
+		if err != nil || g.validAt == nil {
+			return features, err
+		}
+		// The features might come from the cache, so they're copied instead of filtered in-place.
+		var validFeatures []feature.Feature
+		for _, encodedFeature := range features {
+			if encodedFeature != nil && g.isValid(encodedFeature) {
+				validFeatures = append(validFeatures, encodedFeature)
+			}
+		}
+		return validFeatures, nil
+	}
+
+	var features []feature.Feature
+	readIds := map[uint64]bool{}
+	for _, cellFileName := range cellFileNames {
+		subCellFeatures, err := g.readFeaturesFromFile(cellFileName, bbox, objectType, idFilter, tagFilter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, encodedFeature := range subCellFeatures {
+			if encodedFeature == nil || !g.isValid(encodedFeature) {
+				continue
+			}
+			if objectType != ownOsm.OsmObjNode {
+				if readIds[encodedFeature.GetID()] {
+					continue
+				}
+				readIds[encodedFeature.GetID()] = true
+			}
+			features = append(features, encodedFeature)
+		}
+	}
+
+	return features, nil
+}
+
+// readFeaturesFromFileWithRTree decodes only the ways of the given cell file whose bbox intersects the given bbox by
+// using the R-tree of the cell, s. CellRTree. The returned bool is false when the R-tree hasn't been used, e.g. because
+// the cell has no R-tree, is already cached or the bbox covers all ways anyway. The result is not cached, since it's
+// incomplete.
+func (g *GridIndexReader) readFeaturesFromFileWithRTree(cellX int, cellY int, cellFileName string, bbox *orb.Bound, objectType ownOsm.OsmObjectType, idFilter IdFilter, tagFilter TagFilter) ([]feature.Feature, bool, error) {
+	if bbox == nil || objectType != ownOsm.OsmObjWay || cellFileName != getCellFileName(g.BaseFolder, cellX, cellY, objectType) {
+		return nil, false, nil
+	}
+	if cachedFeatures, err := g.cellCache.getAll(cellFileName); err == nil && len(cachedFeatures) > 0 {
+		return nil, false, nil
+	}
+
+	tree, err := g.readCellRTree(cellX, cellY, objectType)
+	if err != nil || tree == nil {
+		return nil, false, err
+	}
+
+	offsets := tree.Search(*bbox)
+	if len(offsets) == tree.Len() {
+		return nil, false, nil
+	}
+
+	sigolo.Tracef("Read %d of %d ways of cell file %s using its R-tree", len(offsets), tree.Len(), cellFileName)
+	data, err := readIndexFile(cellFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, true, nil
 	} else if err != nil {
-		return nil, errors.Wrapf(err, "Unable to get existance status of cell file %s", cellFileName)
+		return nil, true, errors.Wrapf(err, "Unable to read cell file %s, type=%s", cellFileName, objectType)
+	}
+	err = checkCellData(data, cellFileName, objectType)
+	if err != nil {
+		return nil, true, err
+	}
+
+	features := g.readWaysAtOffsets(data, offsets, bbox, idFilter, tagFilter)
+	return features, true, g.checkValidity(features)
+}
+
+// readFeaturesFromFile reads the features of an existing (sub-)cell file, s. readFeaturesFromCellFile. When an ID or tag
+// filter is given, ways outside the given bbox (might be nil) are skipped as well.
+func (g *GridIndexReader) readFeaturesFromFile(cellFileName string, bbox *orb.Bound, objectType ownOsm.OsmObjectType, idFilter IdFilter, tagFilter TagFilter) ([]feature.Feature, error) {
+	if idFilter != nil || tagFilter != nil {
+		cachedFeatures, err := g.cellCache.getAll(cellFileName)
+		if err == nil && len(cachedFeatures) > 0 {
+			sigolo.Tracef("Use features from cache for cell file %s", cellFileName)
+			return cachedFeatures, nil
+		}
+
+		sigolo.Tracef("Read cell file %s with ID or tag filter", cellFileName)
+		data, err := readIndexFile(cellFileName)
+		if errors.Is(err, os.ErrNotExist) {
+			// Sub-cell files might have been moved into the quarantine while still being listed in the split file.
+			return nil, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read cell file %s, type=%s", cellFileName, objectType)
+		}
+		err = checkCellData(data, cellFileName, objectType)
+		if err != nil {
+			return nil, err
+		}
+
+		features := g.readFeaturesFromCellData(data, objectType, bbox, idFilter, tagFilter)
+		return features, g.checkValidity(features)
 	}
 
 	cachedFeatures, entryIsNew, err := g.cellCache.getOrInsert(cellFileName)
@@ -211,10 +509,36 @@ func (g *GridIndexReader) readFeaturesFromCellFile(cellX int, cellY int, objectT
 	}
 
 	sigolo.Tracef("Read cell file %s", cellFileName)
-	data, err := os.ReadFile(cellFileName)
+	data, err := readIndexFile(cellFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read cell file %s, type=%s", cellFileName, objectType)
+	}
+	err = checkCellData(data, cellFileName, objectType)
+	if err != nil {
+		// The cache entry stays empty, so that the next read checks the file again.
+		return nil, err
+	}
+
+	features := g.readFeaturesFromCellData(data, objectType, nil, nil, nil)
+	err = g.checkValidity(features)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Unable to read cell x=%d, y=%d, type=%s", cellX, cellY, objectType)
+		return nil, err
 	}
+	cachedFeatures = append(cachedFeatures, features...)
+
+	g.cellCache.insertOrAppend(cellFileName, cachedFeatures)
+
+	return cachedFeatures, nil
+}
+
+// readFeaturesFromCellData decodes all features of the given object type from the raw cell data. Records with IDs not
+// matching the given ID filter and way records outside the given bbox are skipped without decoding them. Records with
+// tags not matching the given tag filter are skipped after decoding only their tags. The bbox and both filters might be
+// nil to decode all features.
+func (g *GridIndexReader) readFeaturesFromCellData(data []byte, objectType ownOsm.OsmObjectType, bbox *orb.Bound, idFilter IdFilter, tagFilter TagFilter) []feature.Feature {
+	var features []feature.Feature
 
 	readFeatureChannel := make(chan []feature.Feature)
 	featureCachedWaitGroup := &sync.WaitGroup{}
@@ -222,18 +546,18 @@ func (g *GridIndexReader) readFeaturesFromCellFile(cellX int, cellY int, objectT
 	go func() {
 		for readFeatures := range readFeatureChannel {
 			// TODO not-null check needed for the features?
-			cachedFeatures = append(cachedFeatures, readFeatures...)
+			features = append(features, readFeatures...)
 		}
 		featureCachedWaitGroup.Done()
 	}()
 
 	switch objectType {
 	case ownOsm.OsmObjNode:
-		g.readNodesFromCellData(readFeatureChannel, data)
+		g.readNodesFromCellData(readFeatureChannel, data, idFilter, tagFilter)
 	case ownOsm.OsmObjWay:
-		g.readWaysFromCellData(readFeatureChannel, data)
+		g.readWaysFromCellData(readFeatureChannel, data, bbox, idFilter, tagFilter)
 	case ownOsm.OsmObjRelation:
-		g.readRelationsFromCellData(readFeatureChannel, data)
+		g.readRelationsFromCellData(readFeatureChannel, data, idFilter, tagFilter)
 	default:
 		panic("Unsupported object type to read: " + objectType.String())
 	}
@@ -241,82 +565,43 @@ func (g *GridIndexReader) readFeaturesFromCellFile(cellX int, cellY int, objectT
 	close(readFeatureChannel)
 	featureCachedWaitGroup.Wait()
 
-	g.cellCache.insertOrAppend(cellFileName, cachedFeatures)
-
-	return cachedFeatures, nil
+	return features
 }
 
-func (g *GridIndexReader) readNodesFromCellData(output chan []feature.Feature, data []byte) {
+func (g *GridIndexReader) readNodesFromCellData(output chan []feature.Feature, data []byte, idFilter IdFilter, tagFilter TagFilter) {
 	outputBuffer := make([]feature.Feature, 1000)
 	currentBufferPos := 0
 
 	for pos := 0; pos < len(data); {
-		// See format details (bit position, field sizes, etc.) in function "writeNodeData".
-
-		/*
-			Read header fields
-		*/
-		osmId := binary.LittleEndian.Uint64(data[pos+0:])
-		lon := math.Float32frombits(binary.LittleEndian.Uint32(data[pos+8:]))
-		lat := math.Float32frombits(binary.LittleEndian.Uint32(data[pos+12:]))
-		numberOfTags := int(binary.LittleEndian.Uint16(data[pos+16:]))
-		numWayIds := int(binary.LittleEndian.Uint16(data[pos+18:]))
-		numRelationIds := int(binary.LittleEndian.Uint16(data[pos+20:]))
-
-		headerBytesCount := 8 + 4 + 4 + 2 + 2 + 2 // = 22
-
-		sigolo.Tracef("Read feature pos=%d, id=%d, lon=%f, lat=%f, numberOfTags=%d", pos, osmId, lon, lat, numberOfTags)
-
-		pos += headerBytesCount
-
-		/*
-			Read tags
-		*/
-		encodedKeys := make([]int, numberOfTags)
-		encodedValues := make([]int, numberOfTags)
-
-		for i := 0; i < numberOfTags; i++ {
-			encodedKeys[i] = int(binary.LittleEndian.Uint32(data[pos:]))
-			pos += 4
-			encodedValues[i] = int(binary.LittleEndian.Uint32(data[pos:]))
-			pos += 4
-		}
-
-		/*
-			Read way-IDs
-		*/
-		wayIds := make([]osm.WayID, numWayIds)
-		for i := 0; i < numWayIds; i++ {
-			wayIds[i] = osm.WayID(binary.LittleEndian.Uint64(data[pos:]))
-			pos += 8
-		}
-
-		/*
-			Read relation-IDs
-		*/
-		relationIds := make([]osm.RelationID, numRelationIds)
-		for i := 0; i < numRelationIds; i++ {
-			relationIds[i] = osm.RelationID(binary.LittleEndian.Uint64(data[pos:]))
-			pos += 8
-		}
-
-		/*
-			Create encoded feature from raw data
-		*/
+		// See format details (bit position, field sizes, etc.) in the encoding package.
+		record := encoding.NodeRecord(data[pos:])
+		pos += record.Size()
+
+		osmId := record.ID()
+		if idFilter != nil && !idFilter(osmId) {
+			continue
+		}
+
+		sigolo.Tracef("Read feature id=%d", osmId)
+
+		encodedKeys, encodedValues := record.Tags()
+		if tagFilter != nil && !tagFilter(encodedKeys, encodedValues) {
+			continue
+		}
+
 		encodedFeature := &EncodedNodeFeature{
 			AbstractEncodedFeature: AbstractEncodedFeature{
 				ID:       osmId,
-				Geometry: &orb.Point{float64(lon), float64(lat)},
+				Geometry: &orb.Point{record.Lon(), record.Lat()},
 				Keys:     encodedKeys,
 				Values:   encodedValues,
+				Metadata: feature.NewMetadata(record.Metadata()),
+				Validity: feature.NewValidity(record.Validity()),
 			},
-			WayIds:      wayIds,
-			RelationIds: relationIds,
-		}
-		if g.checkFeatureValidity {
-			sigolo.Debugf("Check validity of feature %d", encodedFeature.ID)
-			g.checkValidity(encodedFeature)
+			WayIds:      record.WayIds(),
+			RelationIds: record.RelationIds(),
 		}
+		encodedFeature.Elevation, encodedFeature.HasElevation = record.Elevation()
 
 		outputBuffer[currentBufferPos] = encodedFeature
 		currentBufferPos++
@@ -331,87 +616,21 @@ func (g *GridIndexReader) readNodesFromCellData(output chan []feature.Feature, d
 	output <- outputBuffer
 }
 
-func (g *GridIndexReader) readWaysFromCellData(output chan []feature.Feature, data []byte) {
+func (g *GridIndexReader) readWaysFromCellData(output chan []feature.Feature, data []byte, bbox *orb.Bound, idFilter IdFilter, tagFilter TagFilter) {
 	outputBuffer := make([]feature.Feature, 1000)
 	currentBufferPos := 0
-	totalReadFeatures := 0
 
 	for pos := 0; pos < len(data); {
-		// See format details (bit position, field sizes, etc.) in function "writeWayData".
-
-		/*
-			Read header fields
-		*/
-		osmId := binary.LittleEndian.Uint64(data[pos+0:])
-		numberOfTags := int(binary.LittleEndian.Uint16(data[pos+8:]))
-		numNodes := int(binary.LittleEndian.Uint16(data[pos+10:]))
-		numRelationIds := int(binary.LittleEndian.Uint16(data[pos+12:]))
-
-		headerBytesCount := 8 + 2 + 2 + 2
-
-		sigolo.Tracef("Read feature pos=%d, id=%d, numberOfTags=%d", pos, osmId, numberOfTags)
-
-		pos += headerBytesCount
-
-		/*
-			Read tags
-		*/
-		encodedKeys := make([]int, numberOfTags)
-		encodedValues := make([]int, numberOfTags)
-
-		for i := 0; i < numberOfTags; i++ {
-			encodedKeys[i] = int(binary.LittleEndian.Uint32(data[pos:]))
-			pos += 4
-			encodedValues[i] = int(binary.LittleEndian.Uint32(data[pos:]))
-			pos += 4
-		}
-
-		/*
-			Read node-IDs
-		*/
-		nodes := make([]osm.WayNode, numNodes)
-		for i := 0; i < numNodes; i++ {
-			nodes[i] = osm.WayNode{
-				ID:  osm.NodeID(binary.LittleEndian.Uint64(data[pos:])),
-				Lon: float64(math.Float32frombits(binary.LittleEndian.Uint32(data[(pos + 8):]))),
-				Lat: float64(math.Float32frombits(binary.LittleEndian.Uint32(data[(pos + 12):]))),
-			}
-			pos += 16
-		}
+		// See format details (bit position, field sizes, etc.) in the encoding package.
+		record := encoding.WayRecord(data[pos:])
+		pos += record.Size()
 
-		/*
-			Read relation-IDs
-		*/
-		var relationIds []osm.RelationID
-		for i := 0; i < numRelationIds; i++ {
-			relationIds = append(relationIds, osm.RelationID(binary.LittleEndian.Uint64(data[pos:])))
-			pos += 8
-		}
-
-		/*
-			Create encoded feature from raw data
-		*/
-		lineString := make(orb.LineString, len(nodes))
-		for i, node := range nodes {
-			lineString[i] = orb.Point{node.Lon, node.Lat}
-		}
-
-		encodedFeature := EncodedWayFeature{
-			AbstractEncodedFeature: AbstractEncodedFeature{
-				ID:       osmId,
-				Keys:     encodedKeys,
-				Values:   encodedValues,
-				Geometry: &lineString,
-			},
-			Nodes:       nodes,
-			RelationIds: relationIds,
-		}
-		if g.checkFeatureValidity {
-			sigolo.Debugf("Check validity of feature %d", encodedFeature.ID)
-			g.checkValidity(&encodedFeature)
+		encodedFeature := g.decodeWayRecord(record, bbox, idFilter, tagFilter)
+		if encodedFeature == nil {
+			continue
 		}
 
-		outputBuffer[currentBufferPos] = &encodedFeature
+		outputBuffer[currentBufferPos] = encodedFeature
 		currentBufferPos++
 
 		if currentBufferPos == len(outputBuffer)-1 {
@@ -419,113 +638,106 @@ func (g *GridIndexReader) readWaysFromCellData(output chan []feature.Feature, da
 			outputBuffer = make([]feature.Feature, len(outputBuffer))
 			currentBufferPos = 0
 		}
-
-		totalReadFeatures++
 	}
 
 	output <- outputBuffer
 }
 
-func (g *GridIndexReader) readRelationsFromCellData(output chan []feature.Feature, data []byte) {
+// readWaysAtOffsets decodes the way records starting at the given byte offsets of the raw cell data, s.
+// readWaysFromCellData.
+func (g *GridIndexReader) readWaysAtOffsets(data []byte, offsets []int, bbox *orb.Bound, idFilter IdFilter, tagFilter TagFilter) []feature.Feature {
+	var features []feature.Feature
+	for _, offset := range offsets {
+		encodedFeature := g.decodeWayRecord(encoding.WayRecord(data[offset:]), bbox, idFilter, tagFilter)
+		if encodedFeature != nil {
+			features = append(features, encodedFeature)
+		}
+	}
+	return features
+}
+
+// decodeWayRecord decodes the given way record. Nil is returned when the record doesn't match the given ID or tag filter
+// or when its bbox doesn't intersect the given bbox (all might be nil).
+func (g *GridIndexReader) decodeWayRecord(record encoding.WayRecord, bbox *orb.Bound, idFilter IdFilter, tagFilter TagFilter) *EncodedWayFeature {
+	osmId := record.ID()
+	if idFilter != nil && !idFilter(osmId) {
+		return nil
+	}
+
+	// The stored bbox is exactly the one of the decoded nodes, so this doesn't skip any way intersecting the bbox.
+	if bbox != nil && !bbox.Intersects(record.Bbox()) {
+		return nil
+	}
+
+	sigolo.Tracef("Read feature id=%d", osmId)
+
+	encodedKeys, encodedValues := record.Tags()
+	if tagFilter != nil && !tagFilter(encodedKeys, encodedValues) {
+		return nil
+	}
+
+	nodes := record.Nodes()
+	lineString := make(orb.LineString, len(nodes))
+	for i, node := range nodes {
+		lineString[i] = orb.Point{node.Lon, node.Lat}
+	}
+
+	encodedFeature := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			ID:       osmId,
+			Keys:     encodedKeys,
+			Values:   encodedValues,
+			Geometry: &lineString,
+			Metadata: feature.NewMetadata(record.Metadata()),
+			Validity: feature.NewValidity(record.Validity()),
+		},
+		Nodes:       nodes,
+		RelationIds: record.RelationIds(),
+	}
+	return encodedFeature
+}
+
+func (g *GridIndexReader) readRelationsFromCellData(output chan []feature.Feature, data []byte, idFilter IdFilter, tagFilter TagFilter) {
 	outputBuffer := make([]feature.Feature, 1000)
 	currentBufferPos := 0
 
 	for pos := 0; pos < len(data); {
-		// See format details (bit position, field sizes, etc.) in function "writeRelationData".
-
-		/*
-			Read header fields
-		*/
-		osmId := binary.LittleEndian.Uint64(data[pos+0:])
-		minLon := math.Float32frombits(binary.LittleEndian.Uint32(data[pos+8:]))
-		minLat := math.Float32frombits(binary.LittleEndian.Uint32(data[pos+12:]))
-		maxLon := math.Float32frombits(binary.LittleEndian.Uint32(data[pos+16:]))
-		maxLat := math.Float32frombits(binary.LittleEndian.Uint32(data[pos+20:]))
-		numberOfTags := int(binary.LittleEndian.Uint16(data[pos+24:]))
-		numNodeIds := int(binary.LittleEndian.Uint16(data[pos+26:]))
-		numWayIds := int(binary.LittleEndian.Uint16(data[pos+28:]))
-		numChildRelationIds := int(binary.LittleEndian.Uint16(data[pos+30:]))
-		numParentRelationIds := int(binary.LittleEndian.Uint16(data[pos+32:]))
-
-		bbox := orb.Bound{
-			Min: orb.Point{float64(minLon), float64(minLat)},
-			Max: orb.Point{float64(maxLon), float64(maxLat)},
-		}
-
-		headerBytesCount := 8 + 16 + 2 + 2 + 2 + 2 + 2 // = 34
-
-		sigolo.Tracef("Read feature pos=%d, id=%d, bbox=%v, numberOfTags=%d", pos, osmId, bbox, numberOfTags)
-
-		pos += headerBytesCount
-
-		/*
-			Read tags
-		*/
-		encodedKeys := make([]int, numberOfTags)
-		encodedValues := make([]int, numberOfTags)
-
-		for i := 0; i < numberOfTags; i++ {
-			encodedKeys[i] = int(binary.LittleEndian.Uint32(data[pos:]))
-			pos += 4
-			encodedValues[i] = int(binary.LittleEndian.Uint32(data[pos:]))
-			pos += 4
-		}
-
-		/*
-			Read node-IDs
-		*/
-		nodeIds := make([]osm.NodeID, numNodeIds)
-		for i := 0; i < numNodeIds; i++ {
-			nodeIds[i] = osm.NodeID(binary.LittleEndian.Uint64(data[pos:]))
-			pos += 8
-		}
-
-		/*
-			Read way-IDs
-		*/
-		wayIds := make([]osm.WayID, numWayIds)
-		for i := 0; i < numWayIds; i++ {
-			wayIds[i] = osm.WayID(binary.LittleEndian.Uint64(data[pos:]))
-			pos += 8
-		}
-
-		/*
-			Read child relation-IDs
-		*/
-		childRelationIds := make([]osm.RelationID, numChildRelationIds)
-		for i := 0; i < numChildRelationIds; i++ {
-			childRelationIds[i] = osm.RelationID(binary.LittleEndian.Uint64(data[pos:]))
-			pos += 8
-		}
-
-		/*
-			Read relation-IDs
-		*/
-		parentRelationIds := make([]osm.RelationID, numParentRelationIds)
-		for i := 0; i < numParentRelationIds; i++ {
-			parentRelationIds[i] = osm.RelationID(binary.LittleEndian.Uint64(data[pos:]))
-			pos += 8
-		}
-
-		/*
-			Create encoded feature from raw data
-		*/
-		bboxPolygon := bbox.ToPolygon()
+		// See format details (bit position, field sizes, etc.) in the encoding package.
+		record := encoding.RelationRecord(data[pos:])
+		pos += record.Size()
+
+		osmId := record.ID()
+		if idFilter != nil && !idFilter(osmId) {
+			continue
+		}
+
+		sigolo.Tracef("Read feature id=%d", osmId)
+
+		encodedKeys, encodedValues := record.Tags()
+		if tagFilter != nil && !tagFilter(encodedKeys, encodedValues) {
+			continue
+		}
+
+		nodeRoles, wayRoles, childRelationRoles := record.Roles()
+
+		bboxPolygon := record.Bbox().ToPolygon()
 		encodedFeature := &EncodedRelationFeature{
 			AbstractEncodedFeature: AbstractEncodedFeature{
 				ID:       osmId,
 				Geometry: &bboxPolygon, // This is probably temporary until the real geometry collection is stored
 				Keys:     encodedKeys,
 				Values:   encodedValues,
+				Metadata: feature.NewMetadata(record.Metadata()),
+				Validity: feature.NewValidity(record.Validity()),
 			},
-			NodeIds:           nodeIds,
-			WayIds:            wayIds,
-			ChildRelationIds:  childRelationIds,
-			ParentRelationIds: parentRelationIds,
-		}
-		if g.checkFeatureValidity {
-			sigolo.Debugf("Check validity of feature %d", encodedFeature.ID)
-			g.checkValidity(encodedFeature)
+			NodeIds:            record.NodeIds(),
+			WayIds:             record.WayIds(),
+			ChildRelationIds:   record.ChildRelationIds(),
+			ParentRelationIds:  record.ParentRelationIds(),
+			NodeRoles:          nodeRoles,
+			WayRoles:           wayRoles,
+			ChildRelationRoles: childRelationRoles,
+			MemberTypes:        record.MemberTypes(),
 		}
 
 		outputBuffer[currentBufferPos] = encodedFeature
@@ -541,167 +753,74 @@ func (g *GridIndexReader) readRelationsFromCellData(output chan []feature.Featur
 	output <- outputBuffer
 }
 
-// readNodeToWayMappingFromCellData is a simplified version of the general way-reading function. It returns a mapping of
-// node-ID to way-IDs for the given cell file. Therefore, it can be used to determine which ways a node belongs to,
-// without reading whole encoded features.
-func (g *GridIndexReader) readNodeToWayMappingFromCellData(cellX int, cellY int) (map[uint64][]osm.WayID, error) {
-	cellFolderName := path.Join(g.BaseFolder, ownOsm.OsmObjWay.String(), strconv.Itoa(cellX))
-	cellFileName := path.Join(cellFolderName, strconv.Itoa(cellY)+".cell")
-
-	if _, err := os.Stat(cellFileName); errors.Is(err, os.ErrNotExist) {
-		sigolo.Tracef("Cell file %s does not exist, I'll return an empty feature list", cellFileName)
-		return nil, nil
-	} else if err != nil {
-		return nil, errors.Wrapf(err, "Unable to get existance status of cell file %s", cellFileName)
+// checkValidity validates the given features (s. validateFeature) when this reader checks the feature validity and
+// returns the first error.
+func (g *GridIndexReader) checkValidity(features []feature.Feature) error {
+	if !g.checkFeatureValidity {
+		return nil
 	}
-
-	sigolo.Tracef("Read cell file %s", cellFileName)
-	data, err := os.ReadFile(cellFileName)
-	if err != nil {
-		return nil, errors.Wrapf(err, "Unable to read cell x=%d, y=%d, type=%s", cellX, cellY, ownOsm.OsmObjWay.String())
-	}
-
-	nodeToWays := map[uint64][]osm.WayID{}
-
-	for pos := 0; pos < len(data); {
-		// See format details (bit position, field sizes, etc.) in function "writeWayData".
-
-		/*
-			Read general information of the feature
-		*/
-		osmId := binary.LittleEndian.Uint64(data[pos+0:])
-		numEncodedKeyBytes := int(binary.LittleEndian.Uint16(data[pos+8:]))
-		numValues := int(binary.LittleEndian.Uint16(data[pos+10:]))
-		encodedValuesBytes := numValues * 3 // Multiplication since each value is an int with 3 bytes
-		numNodes := int(binary.LittleEndian.Uint16(data[pos+12:]))
-		nodeBytes := numNodes * 16
-		numRelationIds := int(binary.LittleEndian.Uint16(data[pos+14:]))
-		relationIdBytes := numRelationIds * 8
-
-		headerBytesCount := 8 + 2 + 2 + 2 + 2
-
-		sigolo.Tracef("Read feature pos=%d, id=%d, numKeys=%d, numValues=%d", pos, osmId, numEncodedKeyBytes, numValues)
-
-		encodedValuesStartIndex := pos + headerBytesCount + numEncodedKeyBytes
-
-		/*
-			Read the node-IDs of the way
-		*/
-		nodesStartIndex := encodedValuesStartIndex + encodedValuesBytes
-		for i := 0; i < numNodes; i++ {
-			nodeIdIndex := nodesStartIndex + i*16
-			nodeId := binary.LittleEndian.Uint64(data[nodeIdIndex:])
-
-			if _, ok := nodeToWays[nodeId]; !ok {
-				nodeToWays[nodeId] = []osm.WayID{osm.WayID(osmId)}
-			} else {
-				nodeToWays[nodeId] = append(nodeToWays[nodeId], osm.WayID(osmId))
-			}
+	for _, encodedFeature := range features {
+		if encodedFeature == nil {
+			continue
+		}
+		sigolo.Debugf("Check validity of feature %d", encodedFeature.GetID())
+		err := g.validateFeature(encodedFeature)
+		if err != nil {
+			return err
 		}
-
-		pos += headerBytesCount + numEncodedKeyBytes + encodedValuesBytes + nodeBytes + relationIdBytes
 	}
-
-	return nodeToWays, nil
+	return nil
 }
 
-// readObjectsToRelationMappingFromCellData is a simplified version of the general relations-reading function. It returns
-// a mapping of node-ID to relation-IDs for the given cell file. Therefore, it can be used to determine which relations
-// a node belongs to, without reading whole encoded features.
-func (g *GridIndexReader) readObjectsToRelationMappingFromCellData(cellX int, cellY int) (map[uint64][]osm.RelationID, map[uint64][]osm.RelationID, map[uint64][]osm.RelationID, error) {
-	cellFolderName := path.Join(g.BaseFolder, ownOsm.OsmObjRelation.String(), strconv.Itoa(cellX))
-	cellFileName := path.Join(cellFolderName, strconv.Itoa(cellY)+".cell")
+// validateFeature checks whether the encoded tags of the given feature are consistent with the tag index.
+func (g *GridIndexReader) validateFeature(encodedFeature feature.Feature) error {
+	keys := encodedFeature.GetKeys()
+	values := encodedFeature.GetValues()
 
-	if _, err := os.Stat(cellFileName); errors.Is(err, os.ErrNotExist) {
-		sigolo.Tracef("Cell file %s does not exist, I'll return an empty feature list", cellFileName)
-		return nil, nil, nil, nil
-	} else if err != nil {
-		return nil, nil, nil, errors.Wrapf(err, "Unable to get existance status of cell file %s", cellFileName)
+	if len(keys) != len(values) {
+		return errors.Errorf("Invalid number of value indices found in feature %d: Expected %d values but found %d", encodedFeature.GetID(), len(keys), len(values))
 	}
 
-	sigolo.Tracef("Read cell file %s", cellFileName)
-	data, err := os.ReadFile(cellFileName)
-	if err != nil {
-		return nil, nil, nil, errors.Wrapf(err, "Unable to read cell x=%d, y=%d, type=%s", cellX, cellY, ownOsm.OsmObjWay.String())
-	}
-
-	nodeToRelations := make(map[uint64][]osm.RelationID)
-	wayToRelations := make(map[uint64][]osm.RelationID)
-	relationToParentRelations := make(map[uint64][]osm.RelationID)
-
-	for pos := 0; pos < len(data); {
-		// See format details (bit position, field sizes, etc.) in function "writeRelationData".
-
-		/*
-			Read general information of the feature
-		*/
-		relationId := osm.RelationID(binary.LittleEndian.Uint64(data[pos+0:]))
-		numEncodedKeyBytes := int(binary.LittleEndian.Uint16(data[pos+24:]))
-		numValues := int(binary.LittleEndian.Uint16(data[pos+16:]))
-		encodedValuesBytes := numValues * 3 // Multiplication since each value is an int with 3 bytes
-		numNodeIds := int(binary.LittleEndian.Uint16(data[pos+28:]))
-		numWayIds := int(binary.LittleEndian.Uint16(data[pos+30:]))
-		numChildRelationIds := int(binary.LittleEndian.Uint16(data[pos+32:]))
-		numParentRelationIds := int(binary.LittleEndian.Uint16(data[pos+34:]))
-		parentRelationBytes := numParentRelationIds * 8
-
-		headerBytesCount := 8 + 16 + 2 + 2 + 2 + 2 + 2 + 2 // = 36
-
-		sigolo.Tracef("Read feature pos=%d, id=%d, numKeys=%d, numValues=%d", pos, relationId, numEncodedKeyBytes, numValues)
-
-		/*
-			Read the node-IDs of the relation
-		*/
-		pos += headerBytesCount + numEncodedKeyBytes + encodedValuesBytes
-		for i := 0; i < numNodeIds; i++ {
-			nodeId := binary.LittleEndian.Uint64(data[pos:])
-			nodeToRelations[nodeId] = append(nodeToRelations[nodeId], relationId)
-			pos += 8
+	for i, keyIndex := range keys {
+		if keyIndex < 0 || keyIndex >= len(g.TagIndex.keyMap) {
+			return errors.Errorf("Invalid key found in feature %d: keyIndex=%d, allowedMaxKeyIndex=%d", encodedFeature.GetID(), keyIndex, len(g.TagIndex.keyMap)-1)
 		}
 
-		/*
-			Read the way-IDs of the relation
-		*/
-		for i := 0; i < numWayIds; i++ {
-			wayId := binary.LittleEndian.Uint64(data[pos:])
-			wayToRelations[wayId] = append(wayToRelations[wayId], relationId)
-			pos += 8
+		valueIndex := values[i]
+		if valueIndex < 0 || valueIndex >= len(g.TagIndex.valueMap[keyIndex]) {
+			return errors.Errorf("Invalid key value found in feature %d: keyIndex=%d, valueIndex=%d, allowedMaxValueIndex=%d", encodedFeature.GetID(), keyIndex, valueIndex, len(g.TagIndex.valueMap[keyIndex])-1)
 		}
-
-		/*
-			Read the child relation-IDs of the current relation to create the inverse mapping
-		*/
-		for i := 0; i < numChildRelationIds; i++ {
-			childRelationId := binary.LittleEndian.Uint64(data[pos:])
-			relationToParentRelations[childRelationId] = append(relationToParentRelations[childRelationId], relationId)
-			pos += 8
-		}
-
-		pos += parentRelationBytes
 	}
 
-	return nodeToRelations, wayToRelations, relationToParentRelations, nil
+	return nil
 }
 
-func (g *GridIndexReader) checkValidity(encodedFeature feature.Feature) {
-	// Check keys
-	if len(encodedFeature.GetKeys()) > len(g.TagIndex.keyMap) {
-		sigolo.Fatalf("Invalid length of keys in feature %d: Expected less than %d but found %d", encodedFeature.GetID(), len(g.TagIndex.keyMap), len(encodedFeature.GetKeys()))
-	}
+// idSet is a set of OSM IDs, which can be used by concurrent goroutines.
+type idSet struct {
+	ids   map[uint64]bool
+	mutex *sync.RWMutex
+}
 
-	// Check values
-	numberOfSetKeys := 0
-	for keyIndex := 0; keyIndex < len(encodedFeature.GetKeys())*8; keyIndex++ {
-		if encodedFeature.HasKey(keyIndex) {
-			valueIndex := encodedFeature.GetValueIndex(keyIndex)
-			if valueIndex > len(g.TagIndex.valueMap[keyIndex])-1 {
-				sigolo.Fatalf("Invalid key value found in feature %d: keyIndex=%d, valueIndex=%d, allowedMaxValueIndex=%d", encodedFeature.GetID(), keyIndex, valueIndex, len(g.TagIndex.valueMap[keyIndex])-1)
-			}
-			numberOfSetKeys++
-		}
+func newIdSet() *idSet {
+	return &idSet{
+		ids:   map[uint64]bool{},
+		mutex: &sync.RWMutex{},
 	}
+}
+
+func (s *idSet) contains(id uint64) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.ids[id]
+}
 
-	if numberOfSetKeys > len(encodedFeature.GetValues()) {
-		sigolo.Fatalf("Invalid number of value indices found in feature %d: Expected %d values but found %d", encodedFeature.GetID(), len(encodedFeature.GetValues())-1, numberOfSetKeys)
+// add adds the ID and returns false when it was already part of the set.
+func (s *idSet) add(id uint64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ids[id] {
+		return false
 	}
+	s.ids[id] = true
+	return true
 }
@@ -0,0 +1,292 @@
+package index
+
+import (
+	"bytes"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"os"
+	"path"
+	"slices"
+	"soq/common"
+	"soq/encoding"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestGridIndexReader_readWaysFromCellData_tagFilter(t *testing.T) {
+	// Arrange
+	gridIndexWriter := &GridIndexWriter{}
+	gridIndexReader := &GridIndexReader{}
+
+	f := bytes.NewBuffer([]byte{})
+
+	for id, key := range []int{1, 2, 1} {
+		err := gridIndexWriter.writeWayData(&EncodedWayFeature{
+			AbstractEncodedFeature: AbstractEncodedFeature{
+				ID:     uint64(id),
+				Keys:   []int{key},
+				Values: []int{0},
+			},
+			Nodes:       osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}, {ID: 2, Lon: 3, Lat: 4}},
+			RelationIds: []osm.RelationID{5},
+		}, f)
+		common.AssertNil(t, err)
+	}
+
+	outputChannel := make(chan []feature.Feature)
+	var result []feature.Feature
+	resultWaitGroup := &sync.WaitGroup{}
+	resultWaitGroup.Add(1)
+
+	// Act
+	go func() {
+		for features := range outputChannel {
+			for _, f := range features {
+				if f != nil {
+					result = append(result, f)
+				}
+			}
+		}
+		resultWaitGroup.Done()
+	}()
+	gridIndexReader.readWaysFromCellData(outputChannel, f.Bytes(), nil, nil, func(keys []int, values []int) bool {
+		return keys[0] == 1
+	})
+	close(outputChannel)
+	resultWaitGroup.Wait()
+
+	// Assert
+	common.AssertEqual(t, 2, len(result))
+	common.AssertEqual(t, uint64(0), result[0].GetID())
+	common.AssertEqual(t, uint64(2), result[1].GetID())
+	common.AssertEqual(t, 2, len(result[1].(*EncodedWayFeature).Nodes))
+	common.AssertEqual(t, []osm.RelationID{5}, result[1].(*EncodedWayFeature).RelationIds)
+}
+
+func TestGridIndexReader_decodeWayRecord_bbox(t *testing.T) {
+	// Arrange
+	gridIndexWriter := &GridIndexWriter{}
+	gridIndexReader := &GridIndexReader{}
+
+	f := bytes.NewBuffer([]byte{})
+	err := gridIndexWriter.writeWayData(&EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Keys: []int{}, Values: []int{}},
+		Nodes:                  osm.WayNodes{{ID: 1, Lon: 1, Lat: 2}, {ID: 2, Lon: 3, Lat: 4}},
+	}, f)
+	common.AssertNil(t, err)
+	record := encoding.WayRecord(f.Bytes())
+
+	// Act
+	wayInBbox := gridIndexReader.decodeWayRecord(record, &orb.Bound{Min: orb.Point{3, 4}, Max: orb.Point{5, 5}}, nil, nil)
+	wayOutsideBbox := gridIndexReader.decodeWayRecord(record, &orb.Bound{Min: orb.Point{3.5, 1}, Max: orb.Point{5, 5}}, nil, nil)
+	wayWithoutBbox := gridIndexReader.decodeWayRecord(record, nil, nil, nil)
+
+	// Assert
+	common.AssertNotNil(t, wayInBbox)
+	common.AssertNil(t, wayOutsideBbox)
+	common.AssertNotNil(t, wayWithoutBbox)
+}
+
+func TestGridIndexReader_GetNodes(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	writeTestNodeCell(t, baseFolder, common.CellIndex{0, 0}, map[uint64]orb.Point{1: {0.5, 0.5}, 2: {0.6, 0.6}})
+	// Node 3 is stored in the neighboring cell, even though its way node coordinate is within cell 0,0.
+	writeTestNodeCell(t, baseFolder, common.CellIndex{1, 0}, map[uint64]orb.Point{3: {1, 0.5}})
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: BaseGridIndex{CellScheme: &common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, BaseFolder: baseFolder},
+		cellCache:     newLruCache(10),
+	}
+	wayNodes := osm.WayNodes{
+		{ID: 1, Lon: 0.5, Lat: 0.5},
+		{ID: 3, Lon: 0.999999, Lat: 0.5},
+		{ID: 4, Lon: 0.7, Lat: 0.7},
+		{ID: 1, Lon: 0.5, Lat: 0.5},
+	}
+
+	// Act
+	result, err := gridIndexReader.GetNodes(wayNodes)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertFalse(t, result.IsComplete())
+	common.AssertEqual(t, []osm.NodeID{4}, result.MissingNodeIds)
+	common.AssertEqual(t, 4, len(result.Nodes))
+	common.AssertEqual(t, uint64(1), result.Nodes[0].GetID())
+	common.AssertEqual(t, uint64(3), result.Nodes[1].GetID())
+	common.AssertNil(t, result.Nodes[2])
+	common.AssertEqual(t, uint64(1), result.Nodes[3].GetID())
+}
+
+func TestGridIndexReader_Get_waysAcrossCellsOnlyReturnedOnce(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	way := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			ID:     1,
+			Keys:   []int{},
+			Values: []int{},
+		},
+		Nodes: osm.WayNodes{{ID: 1, Lon: 0.5, Lat: 0.5}, {ID: 2, Lon: 1.5, Lat: 0.5}, {ID: 3, Lon: 2.5, Lat: 0.5}},
+	}
+	otherWay := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			ID:     2,
+			Keys:   []int{},
+			Values: []int{},
+		},
+		Nodes: osm.WayNodes{{ID: 4, Lon: 1.2, Lat: 0.2}, {ID: 5, Lon: 1.8, Lat: 0.2}},
+	}
+	writeTestWayCell(t, baseFolder, common.CellIndex{0, 0}, way)
+	writeTestWayCell(t, baseFolder, common.CellIndex{1, 0}, way, otherWay)
+	writeTestWayCell(t, baseFolder, common.CellIndex{2, 0}, way)
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: BaseGridIndex{CellScheme: &common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, BaseFolder: baseFolder},
+		cellCache:     newLruCache(10),
+		readerThreads: 3,
+		metadata:      &IndexMetadata{},
+	}
+
+	// Act
+	resultChannel, err := gridIndexReader.Get(&orb.Bound{Min: orb.Point{0.1, 0.1}, Max: orb.Point{2.9, 0.9}}, ownOsm.OsmObjWay, nil, nil, nil)
+	common.AssertNil(t, err)
+
+	var ids []uint64
+	for result := range resultChannel {
+		for _, f := range result.Features {
+			ids = append(ids, f.GetID())
+		}
+	}
+
+	// Assert
+	slices.Sort(ids)
+	common.AssertEqual(t, []uint64{1, 2}, ids)
+	// Without ID filter, the read cells are cached.
+	common.AssertTrue(t, gridIndexReader.cellCache.has(getCellFileName(baseFolder, 1, 0, ownOsm.OsmObjWay)))
+}
+
+func TestGridIndexReader_Get_corruptCellSkipped(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	way := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			ID:     1,
+			Keys:   []int{},
+			Values: []int{},
+		},
+		Nodes: osm.WayNodes{{ID: 1, Lon: 0.2, Lat: 0.5}, {ID: 2, Lon: 0.8, Lat: 0.5}},
+	}
+	otherWay := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			ID:     2,
+			Keys:   []int{},
+			Values: []int{},
+		},
+		Nodes: osm.WayNodes{{ID: 3, Lon: 1.2, Lat: 0.5}, {ID: 4, Lon: 1.8, Lat: 0.5}},
+	}
+	writeTestWayCell(t, baseFolder, common.CellIndex{0, 0}, way)
+	writeTestWayCell(t, baseFolder, common.CellIndex{1, 0}, otherWay)
+
+	// Truncate the second cell within its only record
+	corruptCellFile := getCellFileName(baseFolder, 1, 0, ownOsm.OsmObjWay)
+	data, err := os.ReadFile(corruptCellFile)
+	common.AssertNil(t, err)
+	common.AssertNil(t, os.WriteFile(corruptCellFile, data[:len(data)-5], 0644))
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: BaseGridIndex{CellScheme: &common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, BaseFolder: baseFolder},
+		cellCache:     newLruCache(10),
+		readerThreads: 1,
+		metadata:      &IndexMetadata{},
+	}
+
+	// Act
+	resultChannel, err := gridIndexReader.Get(&orb.Bound{Min: orb.Point{0.1, 0.1}, Max: orb.Point{1.9, 0.9}}, ownOsm.OsmObjWay, nil, nil, nil)
+	common.AssertNil(t, err)
+
+	var ids []uint64
+	var corruptCells []*CorruptCellError
+	for result := range resultChannel {
+		for _, f := range result.Features {
+			ids = append(ids, f.GetID())
+		}
+		if result.CorruptCell != nil {
+			corruptCells = append(corruptCells, result.CorruptCell)
+		}
+	}
+
+	// Assert
+	common.AssertEqual(t, []uint64{1}, ids)
+	common.AssertEqual(t, 1, len(corruptCells))
+	common.AssertEqual(t, corruptCellFile, corruptCells[0].Filename)
+	common.AssertEqual(t, ownOsm.OsmObjWay, corruptCells[0].ObjectType)
+}
+
+func TestGridIndexReader_Get_unreadableCellReturnsError(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+
+	// A folder instead of the cell file can't be read
+	unreadableCellFile := getCellFileName(baseFolder, 0, 0, ownOsm.OsmObjWay)
+	common.AssertNil(t, os.MkdirAll(unreadableCellFile, os.ModePerm))
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: BaseGridIndex{CellScheme: &common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, BaseFolder: baseFolder},
+		cellCache:     newLruCache(10),
+		readerThreads: 1,
+		metadata:      &IndexMetadata{},
+	}
+
+	// Act
+	resultChannel, err := gridIndexReader.Get(&orb.Bound{Min: orb.Point{0.1, 0.1}, Max: orb.Point{0.9, 0.9}}, ownOsm.OsmObjWay, nil, nil, nil)
+	common.AssertNil(t, err)
+
+	var results []*GetFeaturesResult
+	for result := range resultChannel {
+		results = append(results, result)
+	}
+
+	// Assert
+	common.AssertEqual(t, 1, len(results))
+	common.AssertNotNil(t, results[0].Err)
+	common.AssertEqual(t, 0, len(results[0].Features))
+}
+
+func writeTestWayCell(t *testing.T, baseFolder string, cell common.CellIndex, ways ...*EncodedWayFeature) {
+	gridIndexWriter := &GridIndexWriter{}
+	f := bytes.NewBuffer([]byte{})
+
+	for _, way := range ways {
+		common.AssertNil(t, gridIndexWriter.writeWayData(way, f))
+	}
+
+	cellFolder := path.Join(baseFolder, ownOsm.OsmObjWay.String(), strconv.Itoa(cell.X()))
+	common.AssertNil(t, os.MkdirAll(cellFolder, os.ModePerm))
+	common.AssertNil(t, os.WriteFile(path.Join(cellFolder, strconv.Itoa(cell.Y())+".cell"), f.Bytes(), 0644))
+}
+
+func writeTestNodeCell(t *testing.T, baseFolder string, cell common.CellIndex, nodes map[uint64]orb.Point) {
+	gridIndexWriter := &GridIndexWriter{}
+	f := bytes.NewBuffer([]byte{})
+
+	for id, point := range nodes {
+		err := gridIndexWriter.writeNodeData(&EncodedNodeFeature{
+			AbstractEncodedFeature: AbstractEncodedFeature{
+				ID:       id,
+				Geometry: &point,
+				Keys:     []int{},
+				Values:   []int{},
+			},
+		}, f)
+		common.AssertNil(t, err)
+	}
+
+	cellFolder := path.Join(baseFolder, ownOsm.OsmObjNode.String(), strconv.Itoa(cell.X()))
+	common.AssertNil(t, os.MkdirAll(cellFolder, os.ModePerm))
+	common.AssertNil(t, os.WriteFile(path.Join(cellFolder, strconv.Itoa(cell.Y())+".cell"), f.Bytes(), 0644))
+}
@@ -2,42 +2,71 @@ package index
 
 import (
 	"bufio"
-	"encoding/binary"
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/osm"
 	"github.com/pkg/errors"
 	"io"
-	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 	"soq/common"
+	"soq/encoding"
 	"soq/feature"
 	ownOsm "soq/osm"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 )
 
-// Slice that contains the data of the feature that should be written to disk. These slice is reused to reduce garbage
-// collection. This is a simple solutions and cannot safely be used for concurrent writes!
-var data = make([]byte, 1000)
+// Number of shards the open cell files are distributed to. Each shard has its own mutex, so that goroutines writing
+// into different cells rarely wait for each other.
+const cellFileShardCount = 64
+
+// Pool of slices into which features are encoded before they are written to disk. The slices are reused to reduce
+// garbage collection and each goroutine takes its own slice from the pool, so features can be encoded concurrently.
+var encodeBufferPool = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 1000)
+		return &buffer
+	},
+}
 
-func ensureDataSliceSize(byteCount int) {
-	for cap(data) < byteCount {
-		newSize := cap(data) * 2
-		sigolo.Debugf("Resize data slice from %d to %d", cap(data), newSize)
-		data = make([]byte, newSize)
-	}
+// encodableRecord is a record of the encoding package that can be written into a cell file.
+type encodableRecord interface {
+	Size() int
+	Encode(data []byte) error
+}
+
+// cellFileWriter is the buffered writer of one open cell file. Several goroutines might write into the same cell, so
+// each write is guarded by the mutex of the writer. Records are always written with one Write call and therefore never
+// interleave.
+type cellFileWriter struct {
+	writer *bufio.Writer
+	file   *os.File
+	mutex  *sync.Mutex
+}
+
+func (w *cellFileWriter) Write(data []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.Write(data)
+}
+
+// cellFileShard contains the writers of the open cell files of some cells.
+type cellFileShard struct {
+	mutex   *sync.Mutex
+	writers map[int64]*[3]*cellFileWriter // Key is a aggregation of the cells x and y coordinate. The array index is based on the object type. Value be a pointer to not create unnecessary files.
 }
 
+// GridIndexWriter writes the cells of a grid-index. Different cells can be written concurrently, the raw encoded
+// features are cached per cell.
 type GridIndexWriter struct {
 	BaseGridIndex
 
-	cacheFileWriterFiles     map[io.Writer]*os.File
-	cacheFileWriters         map[int64]*[3]*bufio.Writer // Key is a aggregation of the cells x and y coordinate. The array index is based on the object type. Value be a pointer to not create unnecessary files.
-	cacheFileMutexes         map[io.Writer]*sync.Mutex
-	cacheFileMutex           *sync.Mutex
+	cellFileShards           [cellFileShardCount]*cellFileShard
+	cacheRawEncodedMutex     *sync.RWMutex
 	cacheRawEncodedNodes     map[common.CellIndex][]feature.NodeFeature
 	cacheRawEncodedWays      map[common.CellIndex][]feature.WayFeature
 	cacheRawEncodedRelations map[common.CellIndex][]feature.RelationFeature
@@ -45,10 +74,50 @@ type GridIndexWriter struct {
 	// During writing, some of the half-written data must be read again. This requires some functionality of the
 	// GridIndexReader during importing data and writing a new index.
 	gridIndexReader *GridIndexReader
+
+	// When true, nodes without tags are not written into the cells. They're still part of the ways and relations.
+	skipUntaggedNodes bool
+
+	// When true, cell files are synced to the storage device before closing them and the folders with new cell files
+	// are synced at the end of each sub-extent.
+	durable bool
+	// Folders in which new cell files have been created since the last sync. Only filled in durable mode.
+	foldersWithNewFiles      map[string]bool
+	foldersWithNewFilesMutex *sync.Mutex
+
+	// Collects the key counts of all written cells. Might be nil, in which case no statistics are recorded.
+	keyStatistics *KeyStatistics
+
+	// Cells with more features of one object type are split into sub-cells, s. splitIntoSubCells. 0 disables splitting.
+	cellSplitThreshold int
+
+	// When true, the features of each cell are sorted by ID before writing them, so that identical input data results
+	// in identical cell files.
+	sortFeaturesById bool
+
+	// How the coordinates of nodes are stored in the cells. Empty means encoding.CoordinatePrecisionFloat32.
+	coordinatePrecision encoding.CoordinatePrecision
+
+	// Parsed values of the "ele" key, which are stored as elevation of the nodes. Might be nil, in which case only the
+	// elevation already present on the node features is written.
+	elevations *elevationTable
 }
 
-func ImportTempFeatures(tempRawFeatureChannel chan feature.Feature, baseFolder string, cellWidth float64, cellHeight float64, cellExtent common.CellExtent) error {
-	gridIndexWriter := NewGridIndexWriter(cellWidth, cellHeight, baseFolder)
+// ImportTempFeatures writes the temporary features of the given cell extent into the cells of the grid-index. In
+// durable mode, all written cell files and their folders are synced to the storage device before this returns. The key
+// counts of the written cells are added to the given key statistics (might be nil). Cells with more features of one
+// object type than the split threshold (0 disables splitting) are split into sub-cells. When sortFeaturesById is true,
+// the cell files are identical for identical input data. The tag index is used to store the "ele" tag of nodes as
+// numerical elevation. The coordinates of nodes are stored with the given precision.
+func ImportTempFeatures(tempRawFeatureChannel chan feature.Feature, baseFolder string, cellScheme common.CellScheme, cellExtent common.CellExtent, tagIndex *TagIndex, skipUntaggedNodes bool, durable bool, keyStatistics *KeyStatistics, cellSplitThreshold int, sortFeaturesById bool, coordinatePrecision encoding.CoordinatePrecision) error {
+	gridIndexWriter := NewGridIndexWriter(cellScheme, baseFolder)
+	gridIndexWriter.elevations = newElevationTable(tagIndex)
+	gridIndexWriter.skipUntaggedNodes = skipUntaggedNodes
+	gridIndexWriter.durable = durable
+	gridIndexWriter.keyStatistics = keyStatistics
+	gridIndexWriter.cellSplitThreshold = cellSplitThreshold
+	gridIndexWriter.sortFeaturesById = sortFeaturesById
+	gridIndexWriter.coordinatePrecision = coordinatePrecision
 
 	sigolo.Debug("Read OSM data and write them as raw encoded features")
 
@@ -57,23 +126,26 @@ func ImportTempFeatures(tempRawFeatureChannel chan feature.Feature, baseFolder s
 		return err
 	}
 
-	gridIndexWriter.addAdditionalIdsToObjectsInCells(cellExtent.GetCellIndices())
+	err = gridIndexWriter.addAdditionalIdsToObjectsInCells(cellExtent.GetCellIndices())
+	if err != nil {
+		return err
+	}
+
+	if durable {
+		return gridIndexWriter.syncFoldersWithNewFiles()
+	}
 
 	return nil
 }
 
-func NewGridIndexWriter(cellWidth float64, cellHeight float64, baseFolder string) *GridIndexWriter {
+func NewGridIndexWriter(cellScheme common.CellScheme, baseFolder string) *GridIndexWriter {
 	baseGridIndex := BaseGridIndex{
-		CellWidth:  cellWidth,
-		CellHeight: cellHeight,
+		CellScheme: cellScheme,
 		BaseFolder: baseFolder,
 	}
 	gridIndexWriter := &GridIndexWriter{
 		BaseGridIndex:            baseGridIndex,
-		cacheFileWriterFiles:     map[io.Writer]*os.File{},
-		cacheFileWriters:         map[int64]*[3]*bufio.Writer{},
-		cacheFileMutexes:         map[io.Writer]*sync.Mutex{},
-		cacheFileMutex:           &sync.Mutex{},
+		cacheRawEncodedMutex:     &sync.RWMutex{},
 		cacheRawEncodedNodes:     map[common.CellIndex][]feature.NodeFeature{},
 		cacheRawEncodedWays:      map[common.CellIndex][]feature.WayFeature{},
 		cacheRawEncodedRelations: map[common.CellIndex][]feature.RelationFeature{},
@@ -81,6 +153,14 @@ func NewGridIndexWriter(cellWidth float64, cellHeight float64, baseFolder string
 			BaseGridIndex:        baseGridIndex,
 			checkFeatureValidity: false,
 		},
+		foldersWithNewFiles:      map[string]bool{},
+		foldersWithNewFilesMutex: &sync.Mutex{},
+	}
+	for i := range gridIndexWriter.cellFileShards {
+		gridIndexWriter.cellFileShards[i] = &cellFileShard{
+			mutex:   &sync.Mutex{},
+			writers: map[int64]*[3]*cellFileWriter{},
+		}
 	}
 	return gridIndexWriter
 }
@@ -105,6 +185,10 @@ func (g *GridIndexWriter) WriteOsmToRawEncodedFeatures(tempRawFeatureChannel cha
 	nodeToPoint := map[osm.NodeID]*orb.Point{}
 	wayToBound := map[osm.WayID]*orb.Bound{}
 
+	// When returning early because of an error, the remaining features are still read, so that the goroutine filling the
+	// channel is able to finish.
+	defer drainFeatureChannel(tempRawFeatureChannel)
+
 	sigolo.Debug("Process nodes (1/3)")
 	for obj := range tempRawFeatureChannel {
 		switch rawFeature := obj.(type) {
@@ -114,8 +198,14 @@ func (g *GridIndexWriter) WriteOsmToRawEncodedFeatures(tempRawFeatureChannel cha
 			id := osm.NodeID(rawFeature.GetID())
 			nodeToPoint[id] = rawFeature.GetGeometry().(*orb.Point)
 
+			if g.skipUntaggedNodes && len(rawFeature.GetKeys()) == 0 {
+				continue
+			}
+
 			err := g.writeOsmObjectToCellCache(cell, rawFeature)
-			sigolo.FatalCheck(err)
+			if err != nil {
+				return err
+			}
 		case feature.WayFeature:
 			if !firstWayHasBeenProcessed {
 				sigolo.Debug("Start processing ways (2/3)")
@@ -141,7 +231,9 @@ func (g *GridIndexWriter) WriteOsmToRawEncodedFeatures(tempRawFeatureChannel cha
 
 			for _, cell := range wayCells {
 				err := g.writeOsmObjectToCellCache(cell, rawFeature)
-				sigolo.FatalCheck(err)
+				if err != nil {
+					return err
+				}
 			}
 		case feature.RelationFeature:
 			if !firstRelationHasBeenProcessed {
@@ -240,7 +332,9 @@ func (g *GridIndexWriter) WriteOsmToRawEncodedFeatures(tempRawFeatureChannel cha
 
 			for _, cell := range relCells {
 				err := g.writeOsmObjectToCellCache(cell, rawFeature)
-				sigolo.FatalCheck(err)
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -251,12 +345,18 @@ func (g *GridIndexWriter) WriteOsmToRawEncodedFeatures(tempRawFeatureChannel cha
 	return nil
 }
 
-func (g *GridIndexWriter) addAdditionalIdsToObjectsInCells(cells []common.CellIndex) {
+func (g *GridIndexWriter) addAdditionalIdsToObjectsInCells(cells []common.CellIndex) error {
 	numberOfCells := len(cells)
 	sigolo.Debugf("Start adding way and relation IDs to raw encoded nodes in %d cells", numberOfCells)
 
 	importStartTime := time.Now()
 
+	if g.sortFeaturesById {
+		// The IDs of the ways and relations added to the features depend on the order of the features as well, so this
+		// must be done before collecting them.
+		g.sortCachedFeatures(cells)
+	}
+
 	nodeToRelations := make(map[uint64][]osm.RelationID)
 	waysToRelations := make(map[uint64][]osm.RelationID)
 	relationsToParentRelations := make(map[uint64][]osm.RelationID)
@@ -278,55 +378,155 @@ func (g *GridIndexWriter) addAdditionalIdsToObjectsInCells(cells []common.CellIn
 	}
 
 	for _, cell := range cells {
-		sigolo.Tracef("[Cell %v] Adding additional IDs and writing encoded features to disk", cell)
-
-		err := g.addAdditionalIdsToObjectsOfType(ownOsm.OsmObjNode, nodeToRelations, cell)
+		err := g.writeCell(cell, nodeToRelations, waysToRelations, relationsToParentRelations)
 		if err != nil {
-			sigolo.Errorf("Error adding additional IDs to nodes: %+v", err)
-			// TODO return error
+			return err
 		}
+	}
 
-		err = g.addAdditionalIdsToObjectsOfType(ownOsm.OsmObjWay, waysToRelations, cell)
-		if err != nil {
-			sigolo.Errorf("Error adding additional IDs to ways: %+v", err)
-			// TODO return error
+	importDuration := time.Since(importStartTime)
+	sigolo.Debugf("Done adding way IDs to raw encoded nodes in %s", importDuration)
+
+	return nil
+}
+
+// sortCachedFeatures sorts the cached features of the given cells by their ID.
+func (g *GridIndexWriter) sortCachedFeatures(cells []common.CellIndex) {
+	g.cacheRawEncodedMutex.Lock()
+	defer g.cacheRawEncodedMutex.Unlock()
+
+	for _, cell := range cells {
+		nodes := g.cacheRawEncodedNodes[cell]
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].GetID() < nodes[j].GetID() })
+		ways := g.cacheRawEncodedWays[cell]
+		sort.Slice(ways, func(i, j int) bool { return ways[i].GetID() < ways[j].GetID() })
+		relations := g.cacheRawEncodedRelations[cell]
+		sort.Slice(relations, func(i, j int) bool { return relations[i].GetID() < relations[j].GetID() })
+	}
+}
+
+// writeCell adds the way and relation IDs to the cached features of the given cell, writes them to disk and closes the
+// cell files. This can be called concurrently for different cells.
+func (g *GridIndexWriter) writeCell(cell common.CellIndex, nodeToRelations map[uint64][]osm.RelationID, waysToRelations map[uint64][]osm.RelationID, relationsToParentRelations map[uint64][]osm.RelationID) error {
+	sigolo.Tracef("[Cell %v] Adding additional IDs and writing encoded features to disk", cell)
+
+	// The cached ways are removed while writing them, so their number is needed beforehand. Split cells have no R-tree,
+	// since their sub-cells are already small.
+	numberOfWays := g.getNumberOfCachedFeatures(ownOsm.OsmObjWay, cell)
+	writeRTree := numberOfWays >= cellRTreeMinWays && (g.cellSplitThreshold <= 0 || numberOfWays <= g.cellSplitThreshold)
+
+	err := g.addAdditionalIdsToObjectsOfType(ownOsm.OsmObjNode, nodeToRelations, cell)
+	if err != nil {
+		return errors.Wrapf(err, "Error adding additional IDs to nodes of cell %v", cell)
+	}
+
+	err = g.addAdditionalIdsToObjectsOfType(ownOsm.OsmObjWay, waysToRelations, cell)
+	if err != nil {
+		return errors.Wrapf(err, "Error adding additional IDs to ways of cell %v", cell)
+	}
+
+	err = g.addAdditionalIdsToObjectsOfType(ownOsm.OsmObjRelation, relationsToParentRelations, cell)
+	if err != nil {
+		return errors.Wrapf(err, "Error adding additional IDs to relations of cell %v", cell)
+	}
+
+	err = g.closeCellFiles(cell)
+	if err != nil {
+		return err
+	}
+
+	if writeRTree {
+		return g.writeCellRTree(cell)
+	}
+	return nil
+}
+
+// closeCellFiles flushes and closes all open cell files of the given cell. All files are closed even when one of them
+// fails, the first error is returned. Files that couldn't be flushed completely are not synced.
+func (g *GridIndexWriter) closeCellFiles(cell common.CellIndex) error {
+	cellPositionKey := g.getMapKeyForCell(cell.X(), cell.Y())
+	shard := g.getCellFileShard(cellPositionKey)
+
+	shard.mutex.Lock()
+	writers, ok := shard.writers[cellPositionKey]
+	delete(shard.writers, cellPositionKey)
+	shard.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	var firstErr error
+	for _, writer := range writers {
+		if writer == nil {
+			continue
 		}
 
-		err = g.addAdditionalIdsToObjectsOfType(ownOsm.OsmObjRelation, relationsToParentRelations, cell)
+		err := g.closeCellFile(writer)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// closeCellFile flushes, syncs (in durable mode) and closes the file of the writer.
+func (g *GridIndexWriter) closeCellFile(writer *cellFileWriter) error {
+	writer.mutex.Lock()
+	err := writer.writer.Flush()
+	writer.mutex.Unlock()
+	if err != nil {
+		writer.file.Close()
+		return errors.Wrapf(err, "Error flushing buffered writer for file %s", writer.file.Name())
+	}
+
+	if g.durable {
+		err = writer.file.Sync()
 		if err != nil {
-			sigolo.Errorf("Error adding additional IDs to relations: %+v", err)
-			// TODO return error
+			writer.file.Close()
+			return errors.Wrapf(err, "Unable to sync cell file %s", writer.file.Name())
 		}
+	}
 
-		cellPositionKey := g.getMapKeyForCell(cell.X(), cell.Y())
-		if writers, ok := g.cacheFileWriters[cellPositionKey]; ok {
-			for writerIndex, writer := range writers {
-				if writer == nil {
-					continue
-				}
+	err = writer.file.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Error closing file %s", writer.file.Name())
+	}
+	return nil
+}
 
-				file := g.cacheFileWriterFiles[writer]
+// addFolderWithNewFiles remembers the folder to be synced by syncFoldersWithNewFiles.
+func (g *GridIndexWriter) addFolderWithNewFiles(folder string) {
+	g.foldersWithNewFilesMutex.Lock()
+	defer g.foldersWithNewFilesMutex.Unlock()
+	g.foldersWithNewFiles[folder] = true
+}
 
-				err = writer.Flush()
-				if err != nil {
-					sigolo.Errorf("Error flushing buffered writer %d for file %s", writerIndex, file.Name())
-					// TODO return error
-				}
+// syncFoldersWithNewFiles syncs all folders in which new cell files have been created. Their parent folders up to the
+// folder containing the grid-index are synced as well, since they might have been created too.
+func (g *GridIndexWriter) syncFoldersWithNewFiles() error {
+	indexBaseFolder := filepath.Dir(g.BaseFolder)
+	syncedFolders := map[string]bool{}
 
-				err = file.Close()
-				if err != nil {
-					sigolo.Errorf("Error closing file %s", file.Name())
-					// TODO return error
-				}
+	for folder := range g.foldersWithNewFiles {
+		for ; !syncedFolders[folder]; folder = filepath.Dir(folder) {
+			err := common.SyncDirectory(folder)
+			if err != nil {
+				return err
+			}
+			syncedFolders[folder] = true
 
-				delete(g.cacheFileWriterFiles, writer)
+			if folder == indexBaseFolder || folder == filepath.Dir(folder) {
+				break
 			}
-			delete(g.cacheFileWriters, cellPositionKey)
 		}
 	}
 
-	importDuration := time.Since(importStartTime)
-	sigolo.Debugf("Done adding way IDs to raw encoded nodes in %s", importDuration)
+	sigolo.Debugf("Synced %d folders to storage device", len(syncedFolders))
+	g.foldersWithNewFiles = map[string]bool{}
+
+	return nil
 }
 
 // addAdditionalIdsToObjectsOfType adds the reverse IDs to the given object type. For example nodes themselves do not
@@ -335,87 +535,154 @@ func (g *GridIndexWriter) addAdditionalIdsToObjectsInCells(cells []common.CellIn
 // relations this object is part of.
 func (g *GridIndexWriter) addAdditionalIdsToObjectsOfType(objectType ownOsm.OsmObjectType, objectTypeToRelationMapping map[uint64][]osm.RelationID, cell common.CellIndex) error {
 	var err error
+	var keyBitmap KeyBitmap
+	keyCounts := map[int]int{}
+	numberOfWrittenFeatures := 0
+
+	// Cells with too many features are split into sub-cells, which requires all features of the cell at once.
+	splitCell := g.cellSplitThreshold > 0 && g.getNumberOfCachedFeatures(objectType, cell) > g.cellSplitThreshold
+	var featuresToSplit []feature.Feature
+	var nodeIds []uint64
+	writeFeature := func(encFeature feature.Feature) error {
+		if splitCell {
+			featuresToSplit = append(featuresToSplit, encFeature)
+		} else {
+			err := g.writeOsmObjectToCell(cell.X(), cell.Y(), encFeature)
+			if err != nil {
+				return err
+			}
+		}
+		keyBitmap = keyBitmap.WithKeys(encFeature.GetKeys())
+		countKeys(keyCounts, encFeature.GetKeys())
+		numberOfWrittenFeatures++
+		return nil
+	}
 
-	//cellFolderName := path.Join(g.BaseFolder, objectType.String(), strconv.Itoa(cell.X()))
-	//cellFileName := path.Join(cellFolderName, strconv.Itoa(cell.Y())+".cell")
-
-	//if _, err := os.Stat(cellFileName); errors.Is(err, os.ErrNotExist) {
-	//	if objectType == ownOsm.OsmObjNode {
-	//		// We got all the cells in which nodes are. When this cell doesn't exist, then something went really wrong.
-	//		util.LogFatalBug("Cell file %s for nodes could not be found in the list of node-cells. This is a critical error and should not have happened", cellFileName)
-	//	}
-	//	// We found a cell only containing nodes. This might happen sometimes and is ok.
-	//	sigolo.Debugf("Cell file %s for OSM object type %v does not exist, since it might only contain nodes", cellFileName, objectType)
-	//	return nil
-	//}
-	//sigolo.FatalCheck(errors.Wrapf(err, "Unable to get existance status of cell file %s", cellFileName))
-
-	//sigolo.Tracef("[Cell %v] Read cell file %s", cell, cellFileName)
-	//data, err := os.ReadFile(cellFileName)
-	//sigolo.FatalCheck(errors.Wrapf(err, "Unable to read %v-cell x=%d, y=%d", objectType, cell.X(), cell.Y()))
-
-	//sigolo.Tracef("[Cell %v] Read %v objects from cell and write them including additional IDs", cell, objectType)
-	//readFeatureChannel := make(chan []feature.Feature)
-	//var finishWaitGroup sync.WaitGroup
-	//finishWaitGroup.Add(1)
-
-	// TODO Use the data-bytes directly without deserialization first. This probably saves a lot of time.
-	//go func() {
-	//	for encFeatures := range readFeatureChannel {
-	//		for _, encFeature := range encFeatures {
-	//			if encFeature == nil {
-	//				continue
-	//			}
+	g.cacheRawEncodedMutex.RLock()
+	nodes := g.cacheRawEncodedNodes[cell]
+	ways := g.cacheRawEncodedWays[cell]
+	relations := g.cacheRawEncodedRelations[cell]
+	g.cacheRawEncodedMutex.RUnlock()
 
 	switch objectType {
 	case ownOsm.OsmObjNode:
 		nodeToWays := map[uint64][]osm.WayID{}
-		ways := g.cacheRawEncodedWays[cell]
 		for _, way := range ways {
 			for _, nodeId := range way.GetNodes().NodeIDs() {
 				nodeToWays[uint64(nodeId)] = append(nodeToWays[uint64(nodeId)], osm.WayID(way.GetID()))
 			}
 		}
 
-		for _, encFeature := range g.cacheRawEncodedNodes[cell] {
+		for _, encFeature := range nodes {
 			if wayIds, ok := nodeToWays[encFeature.GetID()]; ok {
 				encFeature.SetWayIds(wayIds)
 			}
 			if relationIds, ok := objectTypeToRelationMapping[encFeature.GetID()]; ok {
 				encFeature.SetRelationIds(relationIds)
 			}
-
-			err = g.writeOsmObjectToCell(cell.X(), cell.Y(), encFeature)
-			sigolo.FatalCheck(err)
+			err = writeFeature(encFeature)
+			if err != nil {
+				return err
+			}
+			nodeIds = append(nodeIds, encFeature.GetID())
 		}
-		delete(g.cacheRawEncodedNodes, cell)
+		g.removeCachedFeatures(objectType, cell)
 	case ownOsm.OsmObjWay:
-		for _, encFeature := range g.cacheRawEncodedWays[cell] {
+		for _, encFeature := range ways {
 			if relationIds, ok := objectTypeToRelationMapping[encFeature.GetID()]; ok {
 				encFeature.SetRelationIds(relationIds)
 			}
-
-			err = g.writeOsmObjectToCell(cell.X(), cell.Y(), encFeature)
-			sigolo.FatalCheck(err)
+			err = writeFeature(encFeature)
+			if err != nil {
+				return err
+			}
 		}
-		delete(g.cacheRawEncodedWays, cell)
+		g.removeCachedFeatures(objectType, cell)
 	case ownOsm.OsmObjRelation:
-		for _, encFeature := range g.cacheRawEncodedRelations[cell] {
+		for _, encFeature := range relations {
 			if relationIds, ok := objectTypeToRelationMapping[encFeature.GetID()]; ok {
 				encFeature.SetParentRelationIds(relationIds)
 			}
-
-			err = g.writeOsmObjectToCell(cell.X(), cell.Y(), encFeature)
-			sigolo.FatalCheck(err)
+			err = writeFeature(encFeature)
+			if err != nil {
+				return err
+			}
 		}
-		delete(g.cacheRawEncodedRelations, cell)
+		g.removeCachedFeatures(objectType, cell)
 	default:
 		return errors.Errorf("Unsupported object type %v to add IDs to", objectType)
 	}
 
+	if splitCell {
+		err = g.writeSplitCell(cell, objectType, featuresToSplit)
+		if err != nil {
+			return err
+		}
+	}
+
+	if numberOfWrittenFeatures == 0 {
+		// No cell file has been written, so there's no need for a key bitmap.
+		return nil
+	}
+
+	if g.keyStatistics != nil {
+		g.keyStatistics.Add(objectType, cell, numberOfWrittenFeatures, keyCounts)
+	}
+
+	err = g.writeCellKeyBitmap(cell, objectType, keyBitmap)
+	if err != nil {
+		return err
+	}
+
+	if objectType == ownOsm.OsmObjNode {
+		return g.writeCellNodeIdFilter(cell, NewNodeIdFilter(nodeIds))
+	}
+
 	return nil
 }
 
+func (g *GridIndexWriter) getNumberOfCachedFeatures(objectType ownOsm.OsmObjectType, cell common.CellIndex) int {
+	g.cacheRawEncodedMutex.RLock()
+	defer g.cacheRawEncodedMutex.RUnlock()
+
+	switch objectType {
+	case ownOsm.OsmObjNode:
+		return len(g.cacheRawEncodedNodes[cell])
+	case ownOsm.OsmObjWay:
+		return len(g.cacheRawEncodedWays[cell])
+	case ownOsm.OsmObjRelation:
+		return len(g.cacheRawEncodedRelations[cell])
+	}
+	return 0
+}
+
+func (g *GridIndexWriter) removeCachedFeatures(objectType ownOsm.OsmObjectType, cell common.CellIndex) {
+	g.cacheRawEncodedMutex.Lock()
+	defer g.cacheRawEncodedMutex.Unlock()
+
+	switch objectType {
+	case ownOsm.OsmObjNode:
+		delete(g.cacheRawEncodedNodes, cell)
+	case ownOsm.OsmObjWay:
+		delete(g.cacheRawEncodedWays, cell)
+	case ownOsm.OsmObjRelation:
+		delete(g.cacheRawEncodedRelations, cell)
+	}
+}
+
+// drainFeatureChannel reads all remaining features from the channel.
+func drainFeatureChannel(featureChannel chan feature.Feature) {
+	for range featureChannel {
+	}
+}
+
+// countKeys increases the count of each of the given keys by one.
+func countKeys(keyCounts map[int]int, keys []int) {
+	for _, key := range keys {
+		keyCounts[key]++
+	}
+}
+
 func (g *GridIndexWriter) writeOsmObjectToCell(cellX int, cellY int, encodedFeature feature.Feature) error {
 	switch featureObj := encodedFeature.(type) {
 	case feature.NodeFeature:
@@ -454,6 +721,9 @@ func (g *GridIndexWriter) writeOsmObjectToCell(cellX int, cellY int, encodedFeat
 }
 
 func (g *GridIndexWriter) writeOsmObjectToCellCache(cell common.CellIndex, encodedFeature feature.Feature) error {
+	g.cacheRawEncodedMutex.Lock()
+	defer g.cacheRawEncodedMutex.Unlock()
+
 	switch featureObj := encodedFeature.(type) {
 	case feature.NodeFeature:
 		g.cacheRawEncodedNodes[cell] = append(g.cacheRawEncodedNodes[cell], featureObj)
@@ -467,16 +737,18 @@ func (g *GridIndexWriter) writeOsmObjectToCellCache(cell common.CellIndex, encod
 }
 
 func (g *GridIndexWriter) getCellFile(cellX int, cellY int, objectType ownOsm.OsmObjectType) (io.Writer, error) {
-	g.cacheFileMutex.Lock()
-
 	cellPositionKey := g.getMapKeyForCell(cellX, cellY)
-	writers, hasWriterForCell := g.cacheFileWriters[cellPositionKey]
+	shard := g.getCellFileShard(cellPositionKey)
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	writers, hasWriterForCell := shard.writers[cellPositionKey]
 	writersIndex := g.getWriterIndex(objectType)
 	if hasWriterForCell {
 		writer := writers[writersIndex]
 		if writer != nil {
 			// We have a writer for this cell and this type of object -> return it
-			g.cacheFileMutex.Unlock()
 			return writer, nil
 		}
 	}
@@ -498,7 +770,8 @@ func (g *GridIndexWriter) getCellFile(cellX int, cellY int, objectType ownOsm.Os
 	} else if errors.Is(err, os.ErrNotExist) {
 		// Cell file does NOT exist -> create its folder (if needed) and the file itself
 
-		// Ensure the folder exists
+		// Ensure the folder exists. Cells of the same column might be in different shards, but MkdirAll handles
+		// concurrent creation of the same folder.
 		if _, err = os.Stat(cellFolderName); os.IsNotExist(err) {
 			sigolo.Tracef("Cell folder %s doesn't exist, I'll create it", cellFolderName)
 			err = os.MkdirAll(cellFolderName, os.ModePerm)
@@ -513,24 +786,34 @@ func (g *GridIndexWriter) getCellFile(cellX int, cellY int, objectType ownOsm.Os
 		if err != nil {
 			return nil, errors.Wrapf(err, "Unable to create new cell file %s", cellFileName)
 		}
+
+		if g.durable {
+			g.addFolderWithNewFiles(cellFolderName)
+		}
 	} else {
 		return nil, errors.Wrapf(err, "Unable to get existance status of cell file %s", cellFileName)
 	}
 
 	if !hasWriterForCell {
-		g.cacheFileWriters[cellPositionKey] = &[3]*bufio.Writer{}
+		writers = &[3]*cellFileWriter{}
+		shard.writers[cellPositionKey] = writers
 	}
 
-	writer := bufio.NewWriter(file)
-	g.cacheFileWriters[cellPositionKey][writersIndex] = writer
-	g.cacheFileWriterFiles[writer] = file
-	g.cacheFileMutexes[writer] = &sync.Mutex{}
-
-	g.cacheFileMutex.Unlock()
+	writer := &cellFileWriter{
+		writer: bufio.NewWriter(file),
+		file:   file,
+		mutex:  &sync.Mutex{},
+	}
+	writers[writersIndex] = writer
 
 	return writer, nil
 }
 
+func (g *GridIndexWriter) getCellFileShard(cellPositionKey int64) *cellFileShard {
+	// Neighbouring cells are spread across the shards, since they're often written at the same time.
+	return g.cellFileShards[uint64(mixNodeId(uint64(cellPositionKey)))%cellFileShardCount]
+}
+
 func (g *GridIndexWriter) getMapKeyForCell(cellX int, cellY int) int64 {
 	return int64(cellX)<<32 | int64(cellY)
 }
@@ -548,250 +831,114 @@ func (g *GridIndexWriter) getWriterIndex(objectType ownOsm.OsmObjectType) int {
 }
 
 func (g *GridIndexWriter) writeNodeData(encodedFeature feature.NodeFeature, f io.Writer) error {
-	/*
-		Entry format:
-
-		Names: | osmId | lon | lat | num. tags | num. ways | num. rels |          encodedTags          |     way IDs     |   relation IDs  |
-		Bytes: |   8   |  4  |  4  |     2     |     2     |     2     | key (32 bit) | value (32 bit) | <num. ways> * 8 | <num. rels> * 8 |
-
-		Tags are stored as a list of "num. tags" many key-value-pairs.
-	*/
-
-	keys := encodedFeature.GetKeys()
-	values := encodedFeature.GetValues()
-	if len(keys) != len(values) {
-		return errors.Errorf("Number of keys and values for node %d different: keys %d, values %d", encodedFeature.GetID(), len(keys), len(values))
+	// See the encoding package for format details.
+	record := &encoding.Node{
+		ID:          encodedFeature.GetID(),
+		Lon:         encodedFeature.GetLon(),
+		Lat:         encodedFeature.GetLat(),
+		Keys:        encodedFeature.GetKeys(),
+		Values:      encodedFeature.GetValues(),
+		WayIds:      encodedFeature.GetWayIds(),
+		RelationIds: encodedFeature.GetRelationIds(),
+
+		CoordinatePrecision: g.coordinatePrecision,
 	}
-	numberOfTags := len(keys)
-
-	wayIdBytes := len(encodedFeature.GetWayIds()) * 8           // IDs are all 64-bit integers
-	relationIdBytes := len(encodedFeature.GetRelationIds()) * 8 // IDs are all 64-bit integers
-
-	headerBytesCount := 8 + 4 + 4 + 2 + 2 + 2 // = 20
-	byteCount := headerBytesCount
-	byteCount += numberOfTags * 4
-	byteCount += numberOfTags * 4
-	byteCount += wayIdBytes
-	byteCount += relationIdBytes
-
-	ensureDataSliceSize(byteCount)
-
-	binary.LittleEndian.PutUint64(data[0:], encodedFeature.GetID())
-	binary.LittleEndian.PutUint32(data[8:], math.Float32bits(float32(encodedFeature.GetLon())))
-	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(float32(encodedFeature.GetLat())))
-	binary.LittleEndian.PutUint16(data[16:], uint16(numberOfTags))
-	binary.LittleEndian.PutUint16(data[18:], uint16(len(encodedFeature.GetWayIds())))
-	binary.LittleEndian.PutUint16(data[20:], uint16(len(encodedFeature.GetRelationIds())))
+	record.Changeset, record.User, record.HasMetadata = getMetadata(encodedFeature)
+	record.ValidFrom, record.ValidTo, record.HasValidity = getValidity(encodedFeature)
 
-	pos := headerBytesCount
-
-	/*
-		Write tags
-	*/
-	for i := 0; i < numberOfTags; i++ {
-		binary.LittleEndian.PutUint32(data[pos:], uint32(keys[i]))
-		pos += 4
-		binary.LittleEndian.PutUint32(data[pos:], uint32(values[i]))
-		pos += 4
-	}
-
-	/*
-		Write way-IDs
-	*/
-	for _, wayId := range encodedFeature.GetWayIds() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(wayId))
-		pos += 8
+	record.Elevation, record.HasElevation = encodedFeature.GetElevation()
+	if !record.HasElevation && g.elevations != nil {
+		record.Elevation, record.HasElevation = g.elevations.getElevation(record.Keys, record.Values)
 	}
 
-	/*
-		Write relation-IDs
-	*/
-	for _, relationId := range encodedFeature.GetRelationIds() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(relationId))
-		pos += 8
-	}
-
-	return g.writeData(encodedFeature, data[0:byteCount], f)
+	return g.writeRecord(encodedFeature, record, f)
 }
 
 func (g *GridIndexWriter) writeWayData(encodedFeature feature.WayFeature, f io.Writer) error {
-	/*
-		Entry format:
-
-		Names: | osmId | num. keys | num. values | num. rels |          encodedTags          |       nodes       |       rels      |
-		Bytes: |   8   |     2     |      2      |     2     | key (32 bit) | value (32 bit) | <num. nodes> * 16 | <num. rels> * 8 |
-
-		Tags are stored as a list of "num. tags" many key-value-pairs.
-
-		The nodes section contains all nodes, not only the ones within this cell. This enables geometric checks, even
-		in cases where no way-node is within this cell. The nodes are stores in the following way:
-		<id (64-bit)><lon (32-bit)><lat (23-bit)>
-	*/
-
-	keys := encodedFeature.GetKeys()
-	values := encodedFeature.GetValues()
-	if len(keys) != len(values) {
-		return errors.Errorf("Number of keys and values for node %d different: keys %d, values %d", encodedFeature.GetID(), len(keys), len(values))
+	// See the encoding package for format details.
+	record := &encoding.Way{
+		ID:          encodedFeature.GetID(),
+		Keys:        encodedFeature.GetKeys(),
+		Values:      encodedFeature.GetValues(),
+		Nodes:       encodedFeature.GetNodes(),
+		RelationIds: encodedFeature.GetRelationIds(),
 	}
-	numberOfTags := len(keys)
-
-	nodeIdBytes := len(encodedFeature.GetNodes()) * 16          // Each ID is a 64-bit int + 2*4 bytes for lat/lon
-	relationIdBytes := len(encodedFeature.GetRelationIds()) * 8 // Each ID is a 64-bit int
-
-	headerByteCount := 8 + 2 + 2 + 2 // = 14
-	byteCount := headerByteCount
-	byteCount += numberOfTags * 4
-	byteCount += numberOfTags * 4
-	byteCount += nodeIdBytes
-	byteCount += relationIdBytes
-
-	ensureDataSliceSize(byteCount)
-
-	/*
-		Write header
-	*/
-	binary.LittleEndian.PutUint64(data[0:], encodedFeature.GetID())
-	binary.LittleEndian.PutUint16(data[8:], uint16(numberOfTags))
-	binary.LittleEndian.PutUint16(data[10:], uint16(len(encodedFeature.GetNodes())))
-	binary.LittleEndian.PutUint16(data[12:], uint16(len(encodedFeature.GetRelationIds())))
+	record.Changeset, record.User, record.HasMetadata = getMetadata(encodedFeature)
+	record.ValidFrom, record.ValidTo, record.HasValidity = getValidity(encodedFeature)
 
-	pos := headerByteCount
-
-	/*
-		Write tags
-	*/
-	for i := 0; i < numberOfTags; i++ {
-		binary.LittleEndian.PutUint32(data[pos:], uint32(keys[i]))
-		pos += 4
-		binary.LittleEndian.PutUint32(data[pos:], uint32(values[i]))
-		pos += 4
-	}
-
-	/*
-		Write nodes
-	*/
-	for _, node := range encodedFeature.GetNodes() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(node.ID))
-		binary.LittleEndian.PutUint32(data[pos+8:], math.Float32bits(float32(node.Lon)))
-		binary.LittleEndian.PutUint32(data[pos+12:], math.Float32bits(float32(node.Lat)))
-		pos += 16
-	}
-
-	/*
-		Write relation-IDs
-	*/
-	for _, relationId := range encodedFeature.GetRelationIds() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(relationId))
-		pos += 8
-	}
-
-	return g.writeData(encodedFeature, data[0:byteCount], f)
+	return g.writeRecord(encodedFeature, record, f)
 }
 
 func (g *GridIndexWriter) writeRelationData(encodedFeature feature.RelationFeature, f io.Writer) error {
-	/*
-		Entry format:
-
-		Names: | osmId | bbox | num. keys | num. nodes | num. ways | num. child rels | num. parent rels |          encodedTags          |     node IDs     |     way IDs     |    child rel. IDs     |    parent rel. IDs     |
-		Bytes: |   8   |  16  |     2     |      2     |     2     |        2        |         2        | key (32 bit) | value (32 bit) | <num. nodes> * 8 | <num. ways> * 8 | <num. child rels> * 8 | <num. parent rels> * 8 |
-
-		Tags are stored as a list of "num. tags" many key-value-pairs.
-
-		The "bbox" field are 4 32-bit floats for the min-lon, min-lat, max-lon and max-lat values.
-
-		// TODO store real geometry. Including geometry of sub-relations?
-	*/
-
-	keys := encodedFeature.GetKeys()
-	values := encodedFeature.GetValues()
-	if len(keys) != len(values) {
-		return errors.Errorf("Number of keys and values for node %d different: keys %d, values %d", encodedFeature.GetID(), len(keys), len(values))
+	// See the encoding package for format details.
+	// TODO store real geometry. Including geometry of sub-relations?
+	record := &encoding.Relation{
+		ID:                 encodedFeature.GetID(),
+		Bbox:               encodedFeature.GetGeometry().Bound(),
+		Keys:               encodedFeature.GetKeys(),
+		Values:             encodedFeature.GetValues(),
+		NodeIds:            encodedFeature.GetNodeIds(),
+		WayIds:             encodedFeature.GetWayIds(),
+		ChildRelationIds:   encodedFeature.GetChildRelationIds(),
+		ParentRelationIds:  encodedFeature.GetParentRelationIds(),
+		NodeRoles:          encodedFeature.GetNodeRoles(),
+		WayRoles:           encodedFeature.GetWayRoles(),
+		ChildRelationRoles: encodedFeature.GetChildRelationRoles(),
+		MemberTypes:        getMemberTypes(encodedFeature),
 	}
-	numberOfTags := len(keys)
-
-	nodeIdBytes := len(encodedFeature.GetNodeIds()) * 8                     // IDs are all 64-bit integers
-	wayIdBytes := len(encodedFeature.GetWayIds()) * 8                       // IDs are all 64-bit integers
-	childRelationIdBytes := len(encodedFeature.GetChildRelationIds()) * 8   // IDs are all 64-bit integers
-	parentRelationIdBytes := len(encodedFeature.GetParentRelationIds()) * 8 // IDs are all 64-bit integers
+	record.Changeset, record.User, record.HasMetadata = getMetadata(encodedFeature)
+	record.ValidFrom, record.ValidTo, record.HasValidity = getValidity(encodedFeature)
 
-	headerBytesCount := 8 + 16 + 2 + 2 + 2 + 2 + 2 // = 34
-	byteCount := headerBytesCount
-	byteCount += numberOfTags * 4
-	byteCount += numberOfTags * 4
-	byteCount += nodeIdBytes
-	byteCount += wayIdBytes
-	byteCount += childRelationIdBytes
-	byteCount += parentRelationIdBytes
-
-	ensureDataSliceSize(byteCount)
-
-	bbox := encodedFeature.GetGeometry().Bound()
-
-	binary.LittleEndian.PutUint64(data[0:], encodedFeature.GetID())
-	binary.LittleEndian.PutUint32(data[8:], math.Float32bits(float32(bbox.Min.Lon())))
-	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(float32(bbox.Min.Lat())))
-	binary.LittleEndian.PutUint32(data[16:], math.Float32bits(float32(bbox.Max.Lon())))
-	binary.LittleEndian.PutUint32(data[20:], math.Float32bits(float32(bbox.Max.Lat())))
-	binary.LittleEndian.PutUint16(data[24:], uint16(numberOfTags))
-	binary.LittleEndian.PutUint16(data[16:], uint16(len(encodedFeature.GetNodeIds())))
-	binary.LittleEndian.PutUint16(data[28:], uint16(len(encodedFeature.GetWayIds())))
-	binary.LittleEndian.PutUint16(data[30:], uint16(len(encodedFeature.GetChildRelationIds())))
-	binary.LittleEndian.PutUint16(data[32:], uint16(len(encodedFeature.GetParentRelationIds())))
-
-	pos := headerBytesCount
+	return g.writeRecord(encodedFeature, record, f)
+}
 
-	/*
-		Write tags
-	*/
-	for i := 0; i < numberOfTags; i++ {
-		binary.LittleEndian.PutUint32(data[pos:], uint32(keys[i]))
-		pos += 4
-		binary.LittleEndian.PutUint32(data[pos:], uint32(values[i]))
-		pos += 4
+// getMetadata returns the changeset and user of the feature. The third return value is false when the feature has no
+// metadata.
+func getMetadata(encodedFeature feature.Feature) (uint64, int, bool) {
+	metadata := encodedFeature.GetMetadata()
+	if metadata == nil {
+		return 0, 0, false
 	}
+	return metadata.Changeset, metadata.User, true
+}
 
-	/*
-		Write node-IDs
-	*/
-	for _, nodeId := range encodedFeature.GetNodeIds() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(nodeId))
-		pos += 8
+// getValidity returns the validity interval of the feature. The third return value is false when the feature has no
+// validity.
+func getValidity(encodedFeature feature.Feature) (int64, int64, bool) {
+	validity := encodedFeature.GetValidity()
+	if validity == nil {
+		return 0, 0, false
 	}
+	return validity.From, validity.To, true
+}
 
-	/*
-		Write way-IDs
-	*/
-	for _, wayId := range encodedFeature.GetWayIds() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(wayId))
-		pos += 8
+func getMemberTypes(relation feature.RelationFeature) []ownOsm.OsmObjectType {
+	var memberTypes []ownOsm.OsmObjectType
+	for _, member := range relation.GetMembers() {
+		memberTypes = append(memberTypes, member.Type)
 	}
+	return memberTypes
+}
 
-	/*
-		Write child relation-IDs
-	*/
-	for _, relationId := range encodedFeature.GetChildRelationIds() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(relationId))
-		pos += 8
-	}
+// writeRecord encodes the record of the given feature into a buffer of the pool and writes it with one call to the
+// writer.
+func (g *GridIndexWriter) writeRecord(encodedFeature feature.Feature, record encodableRecord, f io.Writer) error {
+	buffer := encodeBufferPool.Get().(*[]byte)
+	defer encodeBufferPool.Put(buffer)
 
-	/*
-		Write parent relation-IDs
-	*/
-	for _, relationId := range encodedFeature.GetParentRelationIds() {
-		binary.LittleEndian.PutUint64(data[pos:], uint64(relationId))
-		pos += 8
+	byteCount := record.Size()
+	if cap(*buffer) < byteCount {
+		sigolo.Debugf("Resize encode buffer from %d to %d", cap(*buffer), byteCount)
+		*buffer = make([]byte, byteCount)
 	}
+	data := (*buffer)[:byteCount]
 
-	return g.writeData(encodedFeature, data[0:byteCount], f)
-}
+	err := record.Encode(data)
+	if err != nil {
+		return err
+	}
 
-func (g *GridIndexWriter) writeData(encodedFeature feature.Feature, data []byte, f io.Writer) error {
-	g.cacheFileMutex.Lock()
-	m := g.cacheFileMutexes[f]
-	g.cacheFileMutex.Unlock()
-	m.Lock()
-	_, err := f.Write(data)
-	m.Unlock()
+	_, err = f.Write(data)
 	if err != nil {
 		return errors.Wrapf(err, "Unable to write %s %d to cell file", reflect.TypeOf(encodedFeature).Name(), encodedFeature.GetID())
 	}
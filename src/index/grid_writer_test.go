@@ -0,0 +1,128 @@
+package index
+
+import (
+	"bufio"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"soq/common"
+	ownOsm "soq/osm"
+	"sync"
+	"testing"
+)
+
+func TestGridIndexWriter_concurrentWritesIntoCells(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	gridIndexWriter := NewGridIndexWriter(&common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, baseFolder)
+	cells := []common.CellIndex{{0, 0}, {0, 1}, {1, 0}}
+	numberOfGoroutines := 8
+	nodesPerGoroutine := 200
+
+	// Act
+	var wg sync.WaitGroup
+	for i := 0; i < numberOfGoroutines; i++ {
+		wg.Add(1)
+		go func(goroutine int) {
+			defer wg.Done()
+			for j := 0; j < nodesPerGoroutine; j++ {
+				cell := cells[j%len(cells)]
+				node := &EncodedNodeFeature{
+					AbstractEncodedFeature: AbstractEncodedFeature{
+						ID:       uint64(goroutine*nodesPerGoroutine + j + 1),
+						Geometry: &orb.Point{float64(cell.X()) + 0.5, float64(cell.Y()) + 0.5},
+						Keys:     []int{j % 5},
+						Values:   []int{goroutine},
+					},
+				}
+				common.AssertNil(t, gridIndexWriter.writeOsmObjectToCell(cell.X(), cell.Y(), node))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, cell := range cells {
+		common.AssertNil(t, gridIndexWriter.closeCellFiles(cell))
+	}
+
+	// Assert
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: gridIndexWriter.BaseGridIndex,
+		cellCache:     newLruCache(10),
+		metadata:      &IndexMetadata{},
+	}
+	ids := map[uint64]bool{}
+	for _, cell := range cells {
+		features, err := gridIndexReader.readFeaturesFromCellFile(cell.X(), cell.Y(), ownOsm.OsmObjNode, nil, nil)
+		common.AssertNil(t, err)
+		for _, f := range features {
+			if f != nil {
+				ids[f.GetID()] = true
+			}
+		}
+	}
+	common.AssertEqual(t, numberOfGoroutines*nodesPerGoroutine, len(ids))
+}
+
+func TestGridIndexWriter_sortFeaturesById(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	cell := common.CellIndex{0, 0}
+	gridIndexWriter := NewGridIndexWriter(&common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, baseFolder)
+	gridIndexWriter.sortFeaturesById = true
+	for _, id := range []uint64{5, 2, 9, 1} {
+		gridIndexWriter.cacheRawEncodedNodes[cell] = append(gridIndexWriter.cacheRawEncodedNodes[cell], &EncodedNodeFeature{
+			AbstractEncodedFeature: AbstractEncodedFeature{ID: id, Geometry: &orb.Point{0.5, 0.5}, Keys: []int{}, Values: []int{}},
+		})
+	}
+
+	// Act
+	err := gridIndexWriter.addAdditionalIdsToObjectsInCells([]common.CellIndex{cell})
+
+	// Assert
+	common.AssertNil(t, err)
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: gridIndexWriter.BaseGridIndex,
+		cellCache:     newLruCache(10),
+		metadata:      &IndexMetadata{},
+	}
+	features, err := gridIndexReader.readFeaturesFromCellFile(cell.X(), cell.Y(), ownOsm.OsmObjNode, nil, nil)
+	common.AssertNil(t, err)
+	var ids []uint64
+	for _, f := range features {
+		if f != nil {
+			ids = append(ids, f.GetID())
+		}
+	}
+	common.AssertEqual(t, []uint64{1, 2, 5, 9}, ids)
+}
+
+func TestGridIndexWriter_closeCellFiles_flushErrorReturned(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	cell := common.CellIndex{0, 0}
+	gridIndexWriter := NewGridIndexWriter(&common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, baseFolder)
+	gridIndexWriter.durable = true
+	node := &EncodedNodeFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: &orb.Point{0.5, 0.5}, Keys: []int{}, Values: []int{}},
+	}
+	common.AssertNil(t, gridIndexWriter.writeOsmObjectToCell(cell.X(), cell.Y(), node))
+
+	// The buffered data can't be written, but the file itself is still valid and could be synced.
+	cellPositionKey := gridIndexWriter.getMapKeyForCell(cell.X(), cell.Y())
+	writer := gridIndexWriter.getCellFileShard(cellPositionKey).writers[cellPositionKey][ownOsm.OsmObjNode]
+	writer.writer = bufio.NewWriter(failingWriter{})
+	_, err := writer.writer.Write([]byte{1, 2, 3})
+	common.AssertNil(t, err)
+
+	// Act
+	err = gridIndexWriter.closeCellFiles(cell)
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+type failingWriter struct{}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
@@ -1,6 +1,8 @@
 package index
 
 import (
+	"bufio"
+	"encoding/json"
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/orb/geojson"
 	"github.com/pkg/errors"
@@ -10,61 +12,303 @@ import (
 	"time"
 )
 
-func WriteFeaturesAsGeoJsonFile(encodedFeatures []feature.Feature, tagIndex *TagIndex) error {
-	file, err := os.Create("output.geojson")
+const (
+	// OutputFormatGeoJson writes all features as one GeoJSON FeatureCollection.
+	OutputFormatGeoJson = "geojson"
+	// OutputFormatGeoJsonSeq writes one GeoJSON Feature per line, which allows piping the output into tools like jq or
+	// tippecanoe.
+	OutputFormatGeoJsonSeq = "geojsonseq"
+
+	// StdoutFilename is the output filename to write to stdout instead of a file.
+	StdoutFilename = "-"
+)
+
+// OutputOptions contains optional information added to the written features.
+type OutputOptions struct {
+	// When set, the member geometries of each relation are added to its "@members" property. This property is an object
+	// with the roles as keys and lists of GeoJSON geometries as values.
+	RelationMembers RelationMemberGeometries
+
+	// When set, the member ways of each relation are written as separate features directly after the relation. They
+	// have the additional properties "@relation_id" and "@role".
+	RelationMemberWays RelationMemberWays
+
+	// When true, polygonal features get the properties "@area_m2", "@perimeter_m" and "@centroid" (as [lon, lat]). See
+	// GetGeometryMetrics for which geometries are considered polygonal.
+	GeometryMetrics bool
+
+	// Closed ways matching this table are written as polygons instead of line strings. Nil means DefaultAreaTagTable,
+	// an empty table writes all ways as line strings.
+	AreaTags AreaTagTable
+
+	// When true, features get the property "@timestamp" with the time of their version in RFC 3339 format. Only indices
+	// of full-history imports know this time, features of other indices don't get this property.
+	Timestamp bool
+
+	// Prefix of all tag keys, e.g. "tag:", so that tags can't collide with the "@" properties. Empty means no prefix.
+	TagKeyPrefix string
+
+	// Columns of the CSV output format (s. csvFeatureWriter). Empty means DefaultCsvColumns.
+	Columns []string
+
+	// Called after all features have been written. The returned warnings (e.g. about corrupt cells skipped by the query)
+	// are added as "warnings" member to GeoJSON feature collections. Nil means there are no warnings.
+	Warnings func() []string
+}
+
+func (o OutputOptions) getWarnings() []string {
+	if o.Warnings == nil {
+		return nil
+	}
+	return o.Warnings()
+}
+
+// FeatureSet contains features together with the tag-index of the index they come from, which is needed to resolve
+// their tags. This allows writing the results of multiple indices into one output.
+type FeatureSet struct {
+	Features []feature.Feature
+	TagIndex *TagIndex
+}
+
+// WriteFeaturesToFile writes the features in the given format into the given file. The filename "-" writes the features
+// to stdout.
+func WriteFeaturesToFile(encodedFeatures []feature.Feature, tagIndex *TagIndex, filename string, format string, options OutputOptions) error {
+	return WriteFeatureSetsToFile([]FeatureSet{{Features: encodedFeatures, TagIndex: tagIndex}}, filename, format, options)
+}
+
+// WriteFeatureSetsToFile writes the features of all sets in the given format into the given file. The filename "-"
+// writes the features to stdout.
+func WriteFeatureSetsToFile(featureSets []FeatureSet, filename string, format string, options OutputOptions) error {
+	return writeToFile(filename, func(writer io.Writer) error {
+		return WriteFeatureSets(featureSets, format, options, writer)
+	})
+}
+
+// WriteFeatureIteratorToFile is like WriteFeaturesToFile but writes each feature as soon as the iterator provides it.
+func WriteFeatureIteratorToFile(iterator feature.FeatureIterator, tagIndex *TagIndex, filename string, format string, options OutputOptions) error {
+	return writeToFile(filename, func(writer io.Writer) error {
+		return WriteFeatureIterator(iterator, tagIndex, format, options, writer)
+	})
+}
+
+// WriteJsonToFile writes the value as indented JSON into the given file, e.g. for aggregated query results that aren't
+// features. The filename "-" writes to stdout.
+func WriteJsonToFile(value any, filename string) error {
+	return writeToFile(filename, func(writer io.Writer) error {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	})
+}
+
+// writeToFile calls the given write function with the opened file or stdout for the filename "-".
+func writeToFile(filename string, write func(writer io.Writer) error) (err error) {
+	if filename == StdoutFilename {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(filename)
 	if err != nil {
-		return err
+		return errors.Wrapf(err, "Unable to create output file %s", filename)
 	}
 
 	defer func() {
-		err = file.Close()
-		sigolo.FatalCheck(errors.Wrapf(err, "Unable to close file handle for GeoJSON file %s", file.Name()))
+		closeErr := file.Close()
+		if err == nil && closeErr != nil {
+			err = errors.Wrapf(closeErr, "Unable to close file handle for output file %s", file.Name())
+		}
 	}()
 
-	return WriteFeaturesAsGeoJson(encodedFeatures, tagIndex, file)
+	return write(file)
 }
 
-func WriteFeaturesAsGeoJson(encodedFeatures []feature.Feature, tagIndex *TagIndex, writer io.Writer) error {
+func WriteFeatures(encodedFeatures []feature.Feature, tagIndex *TagIndex, format string, options OutputOptions, writer io.Writer) error {
+	return WriteFeatureSets([]FeatureSet{{Features: encodedFeatures, TagIndex: tagIndex}}, format, options, writer)
+}
+
+func WriteFeatureSets(featureSets []FeatureSet, format string, options OutputOptions, writer io.Writer) error {
+	switch format {
+	case OutputFormatGeoJson:
+		return writeFeatureSetsAsGeoJson(featureSets, options, writer)
+	case OutputFormatGeoJsonSeq:
+		return writeFeatureSetsAsGeoJsonSeq(featureSets, options, writer)
+	case OutputFormatCsv:
+		return writeFeatureSetsAsCsv(featureSets, options, writer)
+	}
+	return errors.Errorf("Unknown output format '%s'", format)
+}
+
+// WriteFeatureIterator writes all features of the iterator in the given format. The features are written as soon as
+// they're provided, so only the current feature is held in memory. An error of the iterator stops the writing and is
+// returned, in which case the written output is incomplete.
+func WriteFeatureIterator(iterator feature.FeatureIterator, tagIndex *TagIndex, format string, options OutputOptions, writer io.Writer) error {
+	switch format {
+	case OutputFormatGeoJson:
+		return WriteFeatureIteratorAsGeoJson(iterator, tagIndex, options, writer)
+	case OutputFormatGeoJsonSeq:
+		return WriteFeatureIteratorAsGeoJsonSeq(iterator, tagIndex, options, writer)
+	case OutputFormatCsv:
+		return writeFeatureIteratorAsCsv(iterator, tagIndex, options, writer)
+	}
+	return errors.Errorf("Unknown output format '%s'", format)
+}
+
+func WriteFeaturesAsGeoJson(encodedFeatures []feature.Feature, tagIndex *TagIndex, options OutputOptions, writer io.Writer) error {
+	return writeFeatureSetsAsGeoJson([]FeatureSet{{Features: encodedFeatures, TagIndex: tagIndex}}, options, writer)
+}
+
+func writeFeatureSetsAsGeoJson(featureSets []FeatureSet, options OutputOptions, writer io.Writer) error {
 	sigolo.Info("Write features to GeoJSON")
 	writeStartTime := time.Now()
 
 	featureCollection := geojson.NewFeatureCollection()
-	for _, encodedFeature := range encodedFeatures {
-		geoJsonFeature := geojson.NewFeature(encodedFeature.GetGeometry())
-
-		geoJsonFeature.Properties["@osm_id"] = encodedFeature.GetID()
-
-		switch encodedFeature.(type) {
-		case feature.NodeFeature:
-			geoJsonFeature.Properties["@osm_type"] = "node"
-		case feature.WayFeature:
-			geoJsonFeature.Properties["@osm_type"] = "way"
-		case feature.RelationFeature:
-			geoJsonFeature.Properties["@osm_type"] = "relation"
+	for _, featureSet := range featureSets {
+		for _, encodedFeature := range featureSet.Features {
+			featureCollection.Features = append(featureCollection.Features, toGeoJsonFeatures(encodedFeature, featureSet.TagIndex, options)...)
 		}
+	}
 
-		for keyIndex := 0; keyIndex < len(encodedFeature.GetKeys())*8; keyIndex++ {
-			if !encodedFeature.HasKey(keyIndex) {
-				continue
-			}
+	if warnings := options.getWarnings(); len(warnings) > 0 {
+		featureCollection.ExtraMembers = geojson.Properties{"warnings": warnings}
+	}
+
+	geojsonBytes, err := featureCollection.MarshalJSON()
+	if err != nil {
+		return err
+	}
 
-			valueIndex := encodedFeature.GetValueIndex(keyIndex)
+	_, err = writer.Write(geojsonBytes)
+	if err != nil {
+		return err
+	}
+
+	queryDuration := time.Since(writeStartTime)
+	sigolo.Infof("Finished writing in %s", queryDuration)
 
-			keyString := tagIndex.GetKeyFromIndex(keyIndex)
-			valueString := tagIndex.GetValueForKey(keyIndex, valueIndex)
+	return nil
+}
+
+// WriteFeatureIteratorAsGeoJson writes the features of the iterator as GeoJSON FeatureCollection. Unlike
+// WriteFeaturesAsGeoJson, the collection is not created in memory but written feature by feature. The output is the
+// same.
+func WriteFeatureIteratorAsGeoJson(iterator feature.FeatureIterator, tagIndex *TagIndex, options OutputOptions, writer io.Writer) error {
+	sigolo.Info("Write features to GeoJSON")
+	writeStartTime := time.Now()
+
+	bufferedWriter := bufio.NewWriter(writer)
+	_, err := bufferedWriter.WriteString(`{"features":[`)
+	if err != nil {
+		return err
+	}
+
+	numberOfFeatures := 0
+	numberOfWrittenFeatures := 0
+	for iterator.Next() {
+		encodedFeature := iterator.Feature()
+		for _, geoJsonFeature := range toGeoJsonFeatures(encodedFeature, tagIndex, options) {
+			geojsonBytes, err := geoJsonFeature.MarshalJSON()
+			if err != nil {
+				return errors.Wrapf(err, "Unable to marshal feature %d", encodedFeature.GetID())
+			}
+
+			if numberOfWrittenFeatures > 0 {
+				err = bufferedWriter.WriteByte(',')
+				if err != nil {
+					return err
+				}
+			}
+			_, err = bufferedWriter.Write(geojsonBytes)
+			if err != nil {
+				return err
+			}
+			numberOfWrittenFeatures++
+		}
+		numberOfFeatures++
+	}
+	if iterator.Err() != nil {
+		return iterator.Err()
+	}
 
-			geoJsonFeature.Properties[keyString] = valueString
+	_, err = bufferedWriter.WriteString(`],"type":"FeatureCollection"`)
+	if err != nil {
+		return err
+	}
+	if warnings := options.getWarnings(); len(warnings) > 0 {
+		warningsBytes, err := json.Marshal(warnings)
+		if err != nil {
+			return err
 		}
+		_, err = bufferedWriter.WriteString(`,"warnings":` + string(warningsBytes))
+		if err != nil {
+			return err
+		}
+	}
+	err = bufferedWriter.WriteByte('}')
+	if err != nil {
+		return err
+	}
 
-		featureCollection.Features = append(featureCollection.Features, geoJsonFeature)
+	err = bufferedWriter.Flush()
+	if err != nil {
+		return err
 	}
 
-	geojsonBytes, err := featureCollection.MarshalJSON()
+	queryDuration := time.Since(writeStartTime)
+	sigolo.Infof("Finished writing %d features in %s", numberOfFeatures, queryDuration)
+
+	return nil
+}
+
+// WriteFeatureIteratorAsGeoJsonSeq is like WriteFeaturesAsGeoJsonSeq but for the features of the iterator.
+func WriteFeatureIteratorAsGeoJsonSeq(iterator feature.FeatureIterator, tagIndex *TagIndex, options OutputOptions, writer io.Writer) error {
+	sigolo.Info("Write features as GeoJSON sequence")
+	writeStartTime := time.Now()
+
+	bufferedWriter := bufio.NewWriter(writer)
+	numberOfFeatures := 0
+	for iterator.Next() {
+		err := writeGeoJsonSeqFeature(iterator.Feature(), tagIndex, options, bufferedWriter)
+		if err != nil {
+			return err
+		}
+		numberOfFeatures++
+	}
+	if iterator.Err() != nil {
+		return iterator.Err()
+	}
+
+	err := bufferedWriter.Flush()
 	if err != nil {
 		return err
 	}
 
-	_, err = writer.Write(geojsonBytes)
+	queryDuration := time.Since(writeStartTime)
+	sigolo.Infof("Finished writing %d features in %s", numberOfFeatures, queryDuration)
+
+	return nil
+}
+
+// WriteFeaturesAsGeoJsonSeq writes each feature as GeoJSON Feature on its own line (newline-delimited GeoJSON). Unlike
+// WriteFeaturesAsGeoJson, no feature collection is created in memory, each feature is written as soon as it's encoded.
+func WriteFeaturesAsGeoJsonSeq(encodedFeatures []feature.Feature, tagIndex *TagIndex, options OutputOptions, writer io.Writer) error {
+	return writeFeatureSetsAsGeoJsonSeq([]FeatureSet{{Features: encodedFeatures, TagIndex: tagIndex}}, options, writer)
+}
+
+func writeFeatureSetsAsGeoJsonSeq(featureSets []FeatureSet, options OutputOptions, writer io.Writer) error {
+	sigolo.Info("Write features as GeoJSON sequence")
+	writeStartTime := time.Now()
+
+	bufferedWriter := bufio.NewWriter(writer)
+	for _, featureSet := range featureSets {
+		for _, encodedFeature := range featureSet.Features {
+			err := writeGeoJsonSeqFeature(encodedFeature, featureSet.TagIndex, options, bufferedWriter)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := bufferedWriter.Flush()
 	if err != nil {
 		return err
 	}
@@ -74,3 +318,97 @@ func WriteFeaturesAsGeoJson(encodedFeatures []feature.Feature, tagIndex *TagInde
 
 	return nil
 }
+
+// writeGeoJsonSeqFeature writes the feature (and its resolved member ways, if any) as GeoJSON Features, each followed by
+// a line break.
+func writeGeoJsonSeqFeature(encodedFeature feature.Feature, tagIndex *TagIndex, options OutputOptions, writer *bufio.Writer) error {
+	for _, geoJsonFeature := range toGeoJsonFeatures(encodedFeature, tagIndex, options) {
+		geojsonBytes, err := geoJsonFeature.MarshalJSON()
+		if err != nil {
+			return errors.Wrapf(err, "Unable to marshal feature %d", encodedFeature.GetID())
+		}
+
+		_, err = writer.Write(geojsonBytes)
+		if err != nil {
+			return err
+		}
+		err = writer.WriteByte('\n')
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toGeoJsonFeatures converts the feature into a GeoJSON Feature followed by the features of its member ways, when they
+// have been resolved (s. OutputOptions.RelationMemberWays).
+func toGeoJsonFeatures(encodedFeature feature.Feature, tagIndex *TagIndex, options OutputOptions) []*geojson.Feature {
+	geoJsonFeatures := []*geojson.Feature{toGeoJsonFeature(encodedFeature, tagIndex, options)}
+
+	if _, isRelation := encodedFeature.(feature.RelationFeature); !isRelation {
+		return geoJsonFeatures
+	}
+
+	for _, memberWay := range options.RelationMemberWays[encodedFeature.GetID()] {
+		memberFeature := toGeoJsonFeature(memberWay.Way, tagIndex, options)
+		memberFeature.Properties["@relation_id"] = encodedFeature.GetID()
+		memberFeature.Properties["@role"] = memberWay.Role
+		geoJsonFeatures = append(geoJsonFeatures, memberFeature)
+	}
+
+	return geoJsonFeatures
+}
+
+func toGeoJsonFeature(encodedFeature feature.Feature, tagIndex *TagIndex, options OutputOptions) *geojson.Feature {
+	areaTags := options.AreaTags
+	if areaTags == nil {
+		areaTags = DefaultAreaTagTable
+	}
+	geometry := areaTags.toAreaGeometry(encodedFeature, tagIndex)
+
+	geoJsonFeature := geojson.NewFeature(geometry)
+
+	geoJsonFeature.Properties["@id"] = encodedFeature.GetID()
+
+	switch encodedFeature.(type) {
+	case feature.NodeFeature:
+		geoJsonFeature.Properties["@type"] = "node"
+	case feature.WayFeature:
+		geoJsonFeature.Properties["@type"] = "way"
+	case feature.RelationFeature:
+		geoJsonFeature.Properties["@type"] = "relation"
+
+		if membersByRole, ok := options.RelationMembers[encodedFeature.GetID()]; ok {
+			memberProperty := map[string][]*geojson.Geometry{}
+			for role, geometries := range membersByRole {
+				for _, geometry := range geometries {
+					memberProperty[role] = append(memberProperty[role], geojson.NewGeometry(geometry))
+				}
+			}
+			geoJsonFeature.Properties["@members"] = memberProperty
+		}
+	}
+
+	if options.GeometryMetrics {
+		if metrics, ok := GetGeometryMetrics(geometry); ok {
+			geoJsonFeature.Properties["@area_m2"] = metrics.AreaM2
+			geoJsonFeature.Properties["@perimeter_m"] = metrics.PerimeterM
+			geoJsonFeature.Properties["@centroid"] = []float64{metrics.Centroid.Lon(), metrics.Centroid.Lat()}
+		}
+	}
+
+	if validity := encodedFeature.GetValidity(); options.Timestamp && validity != nil {
+		geoJsonFeature.Properties["@timestamp"] = time.Unix(validity.From, 0).UTC().Format(time.RFC3339)
+	}
+
+	for i, keyIndex := range encodedFeature.GetKeys() {
+		valueIndex := encodedFeature.GetValues()[i]
+
+		keyString := tagIndex.GetKeyFromIndex(keyIndex)
+		valueString := tagIndex.GetValueForKey(keyIndex, valueIndex)
+
+		geoJsonFeature.Properties[options.TagKeyPrefix+keyString] = valueString
+	}
+
+	return geoJsonFeature
+}
@@ -0,0 +1,147 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"strings"
+	"testing"
+)
+
+type sliceFeatureIterator struct {
+	features []feature.Feature
+	index    int
+}
+
+func (i *sliceFeatureIterator) Next() bool {
+	i.index++
+	return i.index < len(i.features)
+}
+
+func (i *sliceFeatureIterator) Feature() feature.Feature {
+	return i.features[i.index]
+}
+
+func (i *sliceFeatureIterator) Err() error {
+	return nil
+}
+
+func TestWriteFeatureIterator_sameOutputAsWriteFeatures(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"bench", "cafe"}})
+	features := []feature.Feature{
+		&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: &orb.Point{1, 2}, Keys: []int{0}, Values: []int{0}}},
+		&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 2, Geometry: &orb.Point{3, 4}, Keys: []int{0}, Values: []int{1}}},
+	}
+
+	for _, format := range []string{OutputFormatGeoJson, OutputFormatGeoJsonSeq} {
+		for _, inputFeatures := range [][]feature.Feature{features, nil} {
+			expectedOutput := &bytes.Buffer{}
+			err := WriteFeatures(inputFeatures, tagIndex, format, OutputOptions{}, expectedOutput)
+			common.AssertNil(t, err)
+
+			// Act
+			output := &bytes.Buffer{}
+			err = WriteFeatureIterator(&sliceFeatureIterator{features: inputFeatures, index: -1}, tagIndex, format, OutputOptions{}, output)
+
+			// Assert
+			common.AssertNil(t, err)
+			common.AssertEqual(t, expectedOutput.String(), output.String())
+		}
+	}
+}
+
+func TestWriteFeatureIterator_warnings(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+	features := []feature.Feature{
+		&EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: &orb.Point{1, 2}, Keys: []int{0}, Values: []int{0}}},
+	}
+	options := OutputOptions{Warnings: func() []string {
+		return []string{"Corrupt node cell file 1/2.cell"}
+	}}
+
+	expectedOutput := &bytes.Buffer{}
+	err := WriteFeatures(features, tagIndex, OutputFormatGeoJson, options, expectedOutput)
+	common.AssertNil(t, err)
+
+	// Act
+	output := &bytes.Buffer{}
+	err = WriteFeatureIterator(&sliceFeatureIterator{features: features, index: -1}, tagIndex, OutputFormatGeoJson, options, output)
+
+	// Assert
+	common.AssertNil(t, err)
+	for _, geoJson := range []string{expectedOutput.String(), output.String()} {
+		var featureCollection map[string]interface{}
+		common.AssertNil(t, json.Unmarshal([]byte(geoJson), &featureCollection))
+		common.AssertEqual(t, []interface{}{"Corrupt node cell file 1/2.cell"}, featureCollection["warnings"])
+		common.AssertEqual(t, 1, len(featureCollection["features"].([]interface{})))
+	}
+}
+
+func TestWriteFeatures_relationMemberWays(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"highway", "type"}, [][]string{{"primary"}, {"route"}})
+	relation := &EncodedRelationFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{2, 0}}.ToPolygon(), Keys: []int{1}, Values: []int{0}}}
+	way := &EncodedWayFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 2, Geometry: orb.LineString{{0, 0}, {2, 0}}, Keys: []int{0}, Values: []int{0}}}
+	options := OutputOptions{RelationMemberWays: RelationMemberWays{1: {{Role: "forward", Way: way}}}}
+
+	// Act
+	output := &bytes.Buffer{}
+	err := WriteFeatures([]feature.Feature{relation}, tagIndex, OutputFormatGeoJsonSeq, options, output)
+
+	// Assert
+	common.AssertNil(t, err)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	common.AssertEqual(t, 2, len(lines))
+
+	var relationProperties, wayProperties struct {
+		Properties map[string]any `json:"properties"`
+	}
+	common.AssertNil(t, json.Unmarshal([]byte(lines[0]), &relationProperties))
+	common.AssertNil(t, json.Unmarshal([]byte(lines[1]), &wayProperties))
+	common.AssertEqual(t, "relation", relationProperties.Properties["@type"])
+	common.AssertEqual(t, map[string]any{
+		"@id":          float64(2),
+		"@type":        "way",
+		"@relation_id": float64(1),
+		"@role":        "forward",
+		"highway":      "primary",
+	}, wayProperties.Properties)
+}
+
+func TestWriteFeatures_timestampAndTagKeyPrefix(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+	nodeWithValidity := &EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: orb.Point{1, 2}, Keys: []int{0}, Values: []int{0}, Validity: &feature.Validity{From: 1577836800, To: feature.ValidForever}}}
+	nodeWithoutValidity := &EncodedNodeFeature{AbstractEncodedFeature: AbstractEncodedFeature{ID: 2, Geometry: orb.Point{1, 2}, Keys: []int{0}, Values: []int{0}}}
+	options := OutputOptions{Timestamp: true, TagKeyPrefix: "tag:"}
+
+	// Act
+	output := &bytes.Buffer{}
+	err := WriteFeatures([]feature.Feature{nodeWithValidity, nodeWithoutValidity}, tagIndex, OutputFormatGeoJsonSeq, options, output)
+
+	// Assert
+	common.AssertNil(t, err)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	common.AssertEqual(t, 2, len(lines))
+
+	var firstProperties, secondProperties struct {
+		Properties map[string]any `json:"properties"`
+	}
+	common.AssertNil(t, json.Unmarshal([]byte(lines[0]), &firstProperties))
+	common.AssertNil(t, json.Unmarshal([]byte(lines[1]), &secondProperties))
+	common.AssertEqual(t, map[string]any{
+		"@id":         float64(1),
+		"@type":       "node",
+		"@timestamp":  "2020-01-01T00:00:00Z",
+		"tag:amenity": "bench",
+	}, firstProperties.Properties)
+	common.AssertEqual(t, map[string]any{
+		"@id":         float64(2),
+		"@type":       "node",
+		"tag:amenity": "bench",
+	}, secondProperties.Properties)
+}
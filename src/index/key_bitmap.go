@@ -0,0 +1,87 @@
+package index
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/common"
+	ownOsm "soq/osm"
+	"strconv"
+)
+
+const CellKeyBitmapFileExtension = ".keys"
+
+// KeyBitmap stores which keys occur in a cell. A 1 at bit position i means "The i-th key is set on at least one feature
+// of the cell". The bitmap is stored next to the cell file and allows skipping cells without reading them.
+type KeyBitmap []byte
+
+// WithKeys returns the bitmap with the given keys set. The bitmap grows when needed, so the returned bitmap must be
+// used instead of the original one.
+func (b KeyBitmap) WithKeys(keys []int) KeyBitmap {
+	for _, key := range keys {
+		byteIndex := key / 8
+		for len(b) <= byteIndex {
+			b = append(b, 0)
+		}
+		b[byteIndex] |= 1 << (key % 8)
+	}
+	return b
+}
+
+// HasKey returns true when the given key is set in this bitmap.
+func (b KeyBitmap) HasKey(key int) bool {
+	if key < 0 || key/8 >= len(b) {
+		return false
+	}
+	return b[key/8]&(1<<(key%8)) != 0
+}
+
+func getCellKeyBitmapFileName(baseFolder string, cellX int, cellY int, objectType ownOsm.OsmObjectType) string {
+	return path.Join(baseFolder, objectType.String(), strconv.Itoa(cellX), strconv.Itoa(cellY)+CellKeyBitmapFileExtension)
+}
+
+// writeCellKeyBitmap writes the key bitmap of the given cell next to its cell file. The cell file must already exist,
+// so that its folder exists as well.
+func (g *GridIndexWriter) writeCellKeyBitmap(cell common.CellIndex, objectType ownOsm.OsmObjectType, bitmap KeyBitmap) error {
+	bitmapFileName := getCellKeyBitmapFileName(g.BaseFolder, cell.X(), cell.Y(), objectType)
+	sigolo.Tracef("Write key bitmap with %d bytes to %s", len(bitmap), bitmapFileName)
+
+	file, err := os.Create(bitmapFileName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create key bitmap file %s", bitmapFileName)
+	}
+
+	_, err = file.Write(bitmap)
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "Unable to write key bitmap file %s", bitmapFileName)
+	}
+
+	if g.durable {
+		err = file.Sync()
+		if err != nil {
+			file.Close()
+			return errors.Wrapf(err, "Unable to sync key bitmap file %s", bitmapFileName)
+		}
+		g.addFolderWithNewFiles(path.Dir(bitmapFileName))
+	}
+
+	return file.Close()
+}
+
+// readCellKeyBitmap reads the key bitmap of the given cell. Cells without a bitmap file contain no features, so an
+// empty bitmap is returned for them.
+func (g *GridIndexReader) readCellKeyBitmap(cellX int, cellY int, objectType ownOsm.OsmObjectType) (KeyBitmap, error) {
+	bitmapFileName := getCellKeyBitmapFileName(g.BaseFolder, cellX, cellY, objectType)
+
+	bitmap, err := readIndexFile(bitmapFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		sigolo.Tracef("Key bitmap file %s does not exist, I'll use an empty bitmap", bitmapFileName)
+		return KeyBitmap{}, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read key bitmap file %s", bitmapFileName)
+	}
+
+	return bitmap, nil
+}
@@ -0,0 +1,21 @@
+package index
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestKeyBitmap_withKeys(t *testing.T) {
+	// Act
+	bitmap := KeyBitmap{}.WithKeys([]int{0, 9, 17})
+
+	// Assert
+	common.AssertEqual(t, 3, len(bitmap))
+	common.AssertTrue(t, bitmap.HasKey(0))
+	common.AssertTrue(t, bitmap.HasKey(9))
+	common.AssertTrue(t, bitmap.HasKey(17))
+	common.AssertFalse(t, bitmap.HasKey(1))
+	common.AssertFalse(t, bitmap.HasKey(18))
+	common.AssertFalse(t, bitmap.HasKey(100))
+	common.AssertFalse(t, bitmap.HasKey(NotFound))
+}
@@ -0,0 +1,164 @@
+package index
+
+import (
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/common"
+	ownOsm "soq/osm"
+	"sort"
+	"sync"
+)
+
+const KeyStatisticsFilename = "key-statistics.json"
+
+// KeyStatisticsTopK is the number of most frequent keys per cell and object type that are stored in the key statistics.
+const KeyStatisticsTopK = 16
+
+// CellKeyStatistics contains the number of features of one object type within a cell and how many of them have the
+// most frequent keys.
+type CellKeyStatistics struct {
+	X        int `json:"x"`
+	Y        int `json:"y"`
+	Features int `json:"features"`
+	// Number of features per key index. Only the KeyStatisticsTopK most frequent keys are stored, all other keys are at
+	// most as frequent as the least frequent key of this map.
+	KeyCounts map[int]int `json:"keys"`
+}
+
+// keyCount returns the number of features having the given key. The number is an upper bound for keys that are not
+// among the most frequent keys of the cell.
+func (c *CellKeyStatistics) keyCount(key int) int {
+	if count, ok := c.KeyCounts[key]; ok {
+		return count
+	}
+	if len(c.KeyCounts) < KeyStatisticsTopK {
+		// All keys of the cell are stored, so the key doesn't exist in this cell.
+		return 0
+	}
+
+	minCount := c.Features
+	for _, count := range c.KeyCounts {
+		minCount = min(minCount, count)
+	}
+	return minCount
+}
+
+// KeyStatistics contains the key counts of all cells per object type. They're recorded during the import and used by
+// queries to estimate how selective a filter is.
+type KeyStatistics struct {
+	// Statistics of all cells per object type name, e.g. "way".
+	Cells map[string][]*CellKeyStatistics `json:"cells"`
+
+	mutex       *sync.Mutex
+	cellsByType map[ownOsm.OsmObjectType]map[common.CellIndex]*CellKeyStatistics
+}
+
+func NewKeyStatistics() *KeyStatistics {
+	return &KeyStatistics{
+		Cells:       map[string][]*CellKeyStatistics{},
+		mutex:       &sync.Mutex{},
+		cellsByType: map[ownOsm.OsmObjectType]map[common.CellIndex]*CellKeyStatistics{},
+	}
+}
+
+// Add records the number of features and key counts of the given cell. Only the most frequent keys are kept.
+func (s *KeyStatistics) Add(objectType ownOsm.OsmObjectType, cell common.CellIndex, numberOfFeatures int, keyCounts map[int]int) {
+	keys := make([]int, 0, len(keyCounts))
+	for key := range keyCounts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keyCounts[keys[i]] == keyCounts[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return keyCounts[keys[i]] > keyCounts[keys[j]]
+	})
+
+	cellStatistics := &CellKeyStatistics{
+		X:         cell.X(),
+		Y:         cell.Y(),
+		Features:  numberOfFeatures,
+		KeyCounts: map[int]int{},
+	}
+	for _, key := range keys[:min(len(keys), KeyStatisticsTopK)] {
+		cellStatistics.KeyCounts[key] = keyCounts[key]
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Cells[objectType.String()] = append(s.Cells[objectType.String()], cellStatistics)
+	if s.cellsByType[objectType] == nil {
+		s.cellsByType[objectType] = map[common.CellIndex]*CellKeyStatistics{}
+	}
+	s.cellsByType[objectType][cell] = cellStatistics
+}
+
+// EstimateKeyShare returns the estimated share (between 0 and 1) of the features of the given type within the given
+// cell extent that have the given key. A nil extent means all cells of the index. The second return value is false when
+// there are no features in these cells and therefore no estimation is possible.
+func (s *KeyStatistics) EstimateKeyShare(objectType ownOsm.OsmObjectType, cellExtent *common.CellExtent, key int) (float64, bool) {
+	numberOfFeatures := 0
+	numberOfFeaturesWithKey := 0
+	for cell, cellStatistics := range s.cellsByType[objectType] {
+		if cellExtent != nil && !cellExtent.Contains(cell) {
+			continue
+		}
+		numberOfFeatures += cellStatistics.Features
+		numberOfFeaturesWithKey += cellStatistics.keyCount(key)
+	}
+
+	if numberOfFeatures == 0 {
+		return 0, false
+	}
+	return float64(numberOfFeaturesWithKey) / float64(numberOfFeatures), true
+}
+
+func (s *KeyStatistics) SaveToFile(indexBaseFolder string) error {
+	statisticsFilename := path.Join(indexBaseFolder, KeyStatisticsFilename)
+
+	statisticsBytes, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to marshal key statistics")
+	}
+
+	sigolo.Debugf("Write key statistics to %s", statisticsFilename)
+	err = os.WriteFile(statisticsFilename, statisticsBytes, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write key statistics file %s", statisticsFilename)
+	}
+
+	return nil
+}
+
+// LoadKeyStatistics reads the key statistics file from the given index folder. Indices created before key statistics
+// existed have no such file, in which case nil is returned.
+func LoadKeyStatistics(indexBaseFolder string) (*KeyStatistics, error) {
+	statisticsFilename := path.Join(indexBaseFolder, KeyStatisticsFilename)
+
+	statisticsBytes, err := readIndexFile(statisticsFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		sigolo.Debugf("Key statistics file %s does not exist, filters won't be reordered", statisticsFilename)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read key statistics file %s", statisticsFilename)
+	}
+
+	statistics := NewKeyStatistics()
+	err = json.Unmarshal(statisticsBytes, statistics)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse key statistics file %s", statisticsFilename)
+	}
+
+	for _, objectType := range []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjRelation} {
+		statistics.cellsByType[objectType] = map[common.CellIndex]*CellKeyStatistics{}
+		for _, cellStatistics := range statistics.Cells[objectType.String()] {
+			statistics.cellsByType[objectType][common.CellIndex{cellStatistics.X, cellStatistics.Y}] = cellStatistics
+		}
+	}
+
+	return statistics, nil
+}
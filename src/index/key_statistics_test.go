@@ -0,0 +1,77 @@
+package index
+
+import (
+	"soq/common"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func TestKeyStatistics_addKeepsTopKeys(t *testing.T) {
+	// Arrange
+	statistics := NewKeyStatistics()
+	keyCounts := map[int]int{}
+	for key := 0; key < KeyStatisticsTopK+2; key++ {
+		keyCounts[key] = key + 1
+	}
+
+	// Act
+	statistics.Add(ownOsm.OsmObjWay, common.CellIndex{1, 2}, 100, keyCounts)
+
+	// Assert
+	cellStatistics := statistics.Cells["way"][0]
+	common.AssertEqual(t, KeyStatisticsTopK, len(cellStatistics.KeyCounts))
+	common.AssertEqual(t, KeyStatisticsTopK+2, cellStatistics.keyCount(KeyStatisticsTopK+1))
+	// Key 0 and 1 are not stored, so the count of the least frequent stored key is the upper bound.
+	common.AssertEqual(t, 3, cellStatistics.keyCount(0))
+}
+
+func TestKeyStatistics_estimateKeyShare(t *testing.T) {
+	// Arrange
+	statistics := NewKeyStatistics()
+	statistics.Add(ownOsm.OsmObjWay, common.CellIndex{0, 0}, 10, map[int]int{1: 10, 2: 5})
+	statistics.Add(ownOsm.OsmObjWay, common.CellIndex{5, 5}, 30, map[int]int{1: 3})
+
+	// Act & Assert
+	share, ok := statistics.EstimateKeyShare(ownOsm.OsmObjWay, nil, 1)
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, 13.0/40.0, share)
+
+	share, ok = statistics.EstimateKeyShare(ownOsm.OsmObjWay, &common.CellExtent{{0, 0}, {1, 1}}, 2)
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, 0.5, share)
+
+	share, ok = statistics.EstimateKeyShare(ownOsm.OsmObjWay, &common.CellExtent{{0, 0}, {1, 1}}, 3)
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, 0.0, share)
+
+	_, ok = statistics.EstimateKeyShare(ownOsm.OsmObjNode, nil, 1)
+	common.AssertFalse(t, ok)
+}
+
+func TestKeyStatistics_saveAndLoad(t *testing.T) {
+	// Arrange
+	indexBaseFolder := t.TempDir()
+	statistics := NewKeyStatistics()
+	statistics.Add(ownOsm.OsmObjNode, common.CellIndex{3, 4}, 10, map[int]int{7: 2})
+
+	// Act
+	err := statistics.SaveToFile(indexBaseFolder)
+	common.AssertNil(t, err)
+	loadedStatistics, err := LoadKeyStatistics(indexBaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, statistics.Cells, loadedStatistics.Cells)
+	share, ok := loadedStatistics.EstimateKeyShare(ownOsm.OsmObjNode, nil, 7)
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, 0.2, share)
+}
+
+func TestKeyStatistics_loadMissingFile(t *testing.T) {
+	// Act
+	statistics, err := LoadKeyStatistics(t.TempDir())
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertNil(t, statistics)
+}
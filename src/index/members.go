@@ -0,0 +1,155 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"soq/feature"
+	ownOsm "soq/osm"
+)
+
+// RelationMemberGeometries contains the geometries of relation members grouped by their role. The key of the outer map
+// is the ID of the relation.
+type RelationMemberGeometries map[uint64]map[string][]orb.Geometry
+
+// RelationMemberWays contains the way members of relations in the order of the members. The key is the ID of the
+// relation.
+type RelationMemberWays map[uint64][]RelationMemberWay
+
+type RelationMemberWay struct {
+	Role string
+	Way  feature.Feature
+}
+
+// GetRelationMemberGeometriesByRole fetches the node and way members of all relations within the given features and
+// groups their geometries by role, keeping the order of the members. Members outside the imported data are missing.
+// Child relations are not included, since their geometry is only a bbox.
+func GetRelationMemberGeometriesByRole(geometryIndex GeometryIndex, features []feature.Feature) (RelationMemberGeometries, error) {
+	result := RelationMemberGeometries{}
+
+	for _, f := range features {
+		relation, ok := f.(feature.RelationFeature)
+		if !ok {
+			continue
+		}
+
+		// Members are within the bbox of the relation, since the bbox has been determined using the members.
+		bbox := relation.GetGeometry().Bound()
+		members := relation.GetMembers()
+
+		var nodeIds []uint64
+		var wayIds []uint64
+		for _, member := range members {
+			switch member.Type {
+			case ownOsm.OsmObjNode:
+				nodeIds = append(nodeIds, member.ID)
+			case ownOsm.OsmObjWay:
+				wayIds = append(wayIds, member.ID)
+			}
+		}
+
+		nodeFeatures, err := getMemberFeatures(geometryIndex, &bbox, ownOsm.OsmObjNode, nodeIds)
+		if err != nil {
+			return nil, err
+		}
+		wayFeatures, err := getMemberFeatures(geometryIndex, &bbox, ownOsm.OsmObjWay, wayIds)
+		if err != nil {
+			return nil, err
+		}
+
+		// The geometries of each role are in the order of the members, e.g. the stops of a route relation.
+		membersByRole := map[string][]orb.Geometry{}
+		for _, member := range members {
+			var memberFeature feature.Feature
+			var ok bool
+			switch member.Type {
+			case ownOsm.OsmObjNode:
+				memberFeature, ok = nodeFeatures[member.ID]
+			case ownOsm.OsmObjWay:
+				memberFeature, ok = wayFeatures[member.ID]
+			}
+			if ok {
+				membersByRole[member.Role] = append(membersByRole[member.Role], memberFeature.GetGeometry())
+			}
+		}
+
+		result[relation.GetID()] = membersByRole
+	}
+
+	return result, nil
+}
+
+// GetRelationMemberWays fetches the way members of all relations within the given features, keeping the order of the
+// members. This makes relations visible whose geometry is only a bbox, e.g. route relations. Members outside the
+// imported data are missing.
+func GetRelationMemberWays(geometryIndex GeometryIndex, features []feature.Feature) (RelationMemberWays, error) {
+	result := RelationMemberWays{}
+
+	for _, f := range features {
+		relation, ok := f.(feature.RelationFeature)
+		if !ok {
+			continue
+		}
+
+		// Members are within the bbox of the relation, since the bbox has been determined using the members.
+		bbox := relation.GetGeometry().Bound()
+		members := relation.GetMembers()
+
+		var wayIds []uint64
+		for _, member := range members {
+			if member.Type == ownOsm.OsmObjWay {
+				wayIds = append(wayIds, member.ID)
+			}
+		}
+
+		wayFeatures, err := getMemberFeatures(geometryIndex, &bbox, ownOsm.OsmObjWay, wayIds)
+		if err != nil {
+			return nil, err
+		}
+
+		var memberWays []RelationMemberWay
+		for _, member := range members {
+			if wayFeature, ok := wayFeatures[member.ID]; ok && member.Type == ownOsm.OsmObjWay {
+				memberWays = append(memberWays, RelationMemberWay{Role: member.Role, Way: wayFeature})
+			}
+		}
+
+		result[relation.GetID()] = memberWays
+	}
+
+	return result, nil
+}
+
+func getMemberFeatures(geometryIndex GeometryIndex, bbox *orb.Bound, objectType ownOsm.OsmObjectType, ids []uint64) (map[uint64]feature.Feature, error) {
+	memberFeatures := map[uint64]feature.Feature{}
+	if len(ids) == 0 {
+		return memberFeatures, nil
+	}
+
+	idSet := map[uint64]bool{}
+	for _, id := range ids {
+		idSet[id] = true
+	}
+
+	featuresChannel, err := geometryIndex.Get(bbox, objectType, func(id uint64) bool {
+		return idSet[id]
+	}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ways might be returned multiple times since they're stored in each cell they cover. The map removes duplicates. The
+	// channel is read completely, even after an error, so that the index can finish its goroutines.
+	var readErr error
+	for getFeaturesResult := range featuresChannel {
+		if getFeaturesResult.Err != nil && readErr == nil {
+			readErr = getFeaturesResult.Err
+		}
+		for _, memberFeature := range getFeaturesResult.Features {
+			memberFeatures[memberFeature.GetID()] = memberFeature
+		}
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return memberFeatures, nil
+}
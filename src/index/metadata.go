@@ -0,0 +1,104 @@
+package index
+
+import (
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/encoding"
+	"time"
+)
+
+const MetadataFilename = "metadata.json"
+
+// FormatVersion is the version of the binary format of the cell files, s. encoding.FormatVersion.
+const FormatVersion = encoding.FormatVersion
+
+// IndexMetadata contains information about how an index was created. It's stored next to the tag-index and grid-index.
+type IndexMetadata struct {
+	// Version of the binary cell format, s. FormatVersion.
+	FormatVersion int `json:"formatVersion"`
+
+	// True when untagged nodes have not been stored as standalone features. They're only part of the ways.
+	UntaggedNodesSkipped bool `json:"untaggedNodesSkipped"`
+
+	// True when the changeset and user of each OSM object are stored. The user names are stored next to the tag-index.
+	MetadataStored bool `json:"metadataStored,omitempty"`
+
+	// True when the index has been imported from a full-history file. Each version of an OSM object is stored with its
+	// validity interval and queries only see the versions valid at the query time.
+	History bool `json:"history,omitempty"`
+
+	// True when each cell file has a key bitmap next to it, s. KeyBitmap. This is false for indices created before key
+	// bitmaps existed, in which case all cells are read.
+	CellKeyBitmaps bool `json:"cellKeyBitmaps"`
+
+	// The area covered by the imported data. This is nil for indices created before this field existed.
+	Extent *orb.Bound `json:"extent,omitempty"`
+
+	// Name of the cell scheme used for the import, s. common.NewCellScheme. This is empty for indices created before
+	// other schemes than the lat/lon scheme existed.
+	CellScheme string `json:"cellScheme,omitempty"`
+
+	// Precision of the node coordinates, s. encoding.CoordinatePrecision. This is empty for indices created before other
+	// precisions than 32-bit floats existed.
+	CoordinatePrecision encoding.CoordinatePrecision `json:"coordinatePrecision,omitempty"`
+
+	// Cells with more features of one object type than this have been split into sub-cells during the import. 0 means
+	// that no cell has been split.
+	CellSplitThreshold int `json:"cellSplitThreshold,omitempty"`
+
+	// Time the import finished. A changed value means a new index, which is used by the server to reload it. This is
+	// the zero time for indices created before this field existed.
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// LoadIndexMetadata reads the metadata file from the given index folder. Indices created before the metadata file
+// existed have no such file, in which case default metadata is returned.
+func LoadIndexMetadata(indexBaseFolder string) (*IndexMetadata, error) {
+	metadataFilename := path.Join(indexBaseFolder, MetadataFilename)
+
+	metadataBytes, err := readIndexFile(metadataFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		sigolo.Debugf("Metadata file %s does not exist, I'll use default metadata", metadataFilename)
+		return &IndexMetadata{}, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read metadata file %s", metadataFilename)
+	}
+
+	metadata := &IndexMetadata{}
+	err = json.Unmarshal(metadataBytes, metadata)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse metadata file %s", metadataFilename)
+	}
+
+	return metadata, nil
+}
+
+// CheckFormatVersion returns an error when the index has been created with a different cell format than the one this
+// version of soq reads and writes.
+func (m *IndexMetadata) CheckFormatVersion() error {
+	if m.FormatVersion != FormatVersion {
+		return errors.Errorf("Index has format version %d but version %d is required, please re-import the data", m.FormatVersion, FormatVersion)
+	}
+	return nil
+}
+
+func (m *IndexMetadata) SaveToFile(indexBaseFolder string) error {
+	metadataFilename := path.Join(indexBaseFolder, MetadataFilename)
+
+	metadataBytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Unable to marshal index metadata")
+	}
+
+	sigolo.Debugf("Write index metadata to %s", metadataFilename)
+	err = os.WriteFile(metadataFilename, metadataBytes, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write metadata file %s", metadataFilename)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package index
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestIndexMetadata_saveAndLoad(t *testing.T) {
+	// Arrange
+	indexBaseFolder := t.TempDir()
+	metadata := &IndexMetadata{UntaggedNodesSkipped: true}
+
+	// Act
+	err := metadata.SaveToFile(indexBaseFolder)
+	common.AssertNil(t, err)
+	loadedMetadata, err := LoadIndexMetadata(indexBaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, metadata, loadedMetadata)
+}
+
+func TestIndexMetadata_loadMissingFile(t *testing.T) {
+	// Act
+	metadata, err := LoadIndexMetadata(t.TempDir())
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, &IndexMetadata{}, metadata)
+}
+
+func TestIndexMetadata_checkFormatVersion(t *testing.T) {
+	// Act & Assert
+	common.AssertNil(t, (&IndexMetadata{FormatVersion: FormatVersion}).CheckFormatVersion())
+	common.AssertNotNil(t, (&IndexMetadata{}).CheckFormatVersion())
+}
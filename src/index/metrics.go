@@ -0,0 +1,56 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/planar"
+)
+
+// GeometryMetrics contains measures of polygonal geometries, which are added to the output on request.
+type GeometryMetrics struct {
+	AreaM2     float64
+	PerimeterM float64
+	Centroid   orb.Point
+}
+
+// DereferenceGeometry returns the value of pointer geometries as stored in the features. Many functions of orb can't
+// handle pointer geometries. Other geometries are returned unchanged.
+func DereferenceGeometry(geometry orb.Geometry) orb.Geometry {
+	switch typedGeometry := geometry.(type) {
+	case *orb.Point:
+		return *typedGeometry
+	case *orb.LineString:
+		return *typedGeometry
+	case *orb.Polygon:
+		return *typedGeometry
+	case *orb.MultiPolygon:
+		return *typedGeometry
+	}
+	return geometry
+}
+
+// GetGeometryMetrics calculates the geodesic area and perimeter as well as the centroid of polygonal geometries. These
+// are polygons, multipolygons and closed line strings (e.g. closed ways like buildings). False is returned for all
+// other geometries.
+func GetGeometryMetrics(geometry orb.Geometry) (*GeometryMetrics, bool) {
+	geometry = DereferenceGeometry(geometry)
+
+	if lineString, ok := geometry.(orb.LineString); ok {
+		if len(lineString) < 4 || !orb.Ring(lineString).Closed() {
+			return nil, false
+		}
+		geometry = orb.Polygon{orb.Ring(lineString)}
+	}
+
+	switch geometry.(type) {
+	case orb.Polygon, orb.MultiPolygon:
+		centroid, _ := planar.CentroidArea(geometry)
+		return &GeometryMetrics{
+			AreaM2:     geo.Area(geometry),
+			PerimeterM: geo.Length(geometry),
+			Centroid:   centroid,
+		}, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,35 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+	"soq/common"
+	"testing"
+)
+
+func TestGetGeometryMetrics_closedLineString(t *testing.T) {
+	// Arrange
+	// Roughly 111.3 m x 111.3 m at the equator
+	lineString := &orb.LineString{{0, 0}, {0.001, 0}, {0.001, 0.001}, {0, 0.001}, {0, 0}}
+
+	// Act
+	metrics, ok := GetGeometryMetrics(lineString)
+
+	// Assert
+	common.AssertTrue(t, ok)
+	common.AssertTrue(t, math.Abs(metrics.AreaM2-12392) < 1)
+	common.AssertTrue(t, math.Abs(metrics.PerimeterM-445.3) < 0.1)
+	common.AssertTrue(t, metrics.Centroid.Equal(orb.Point{0.0005, 0.0005}))
+}
+
+func TestGetGeometryMetrics_notPolygonal(t *testing.T) {
+	// Act & Assert
+	_, ok := GetGeometryMetrics(&orb.Point{1, 2})
+	common.AssertFalse(t, ok)
+
+	_, ok = GetGeometryMetrics(&orb.LineString{{0, 0}, {1, 0}, {1, 1}})
+	common.AssertFalse(t, ok)
+
+	_, ok = GetGeometryMetrics(nil)
+	common.AssertFalse(t, ok)
+}
@@ -0,0 +1,134 @@
+package index
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/common"
+	ownOsm "soq/osm"
+	"strconv"
+)
+
+const CellNodeIdFilterFileExtension = ".ids"
+
+// Number of bits per node ID and number of bits set per node ID. This results in a false positive rate of about 1%.
+const nodeIdFilterBitsPerId = 10
+const nodeIdFilterHashes = 4
+
+// NodeIdFilter is a bloom filter of the IDs of all nodes in a cell. It's stored next to the node cell file and allows
+// skipping cells that definitely don't contain certain nodes without reading them.
+type NodeIdFilter []byte
+
+func NewNodeIdFilter(ids []uint64) NodeIdFilter {
+	filter := make(NodeIdFilter, max(1, (len(ids)*nodeIdFilterBitsPerId+7)/8))
+	for _, id := range ids {
+		filter.forEachBit(id, func(byteIndex int, bitMask byte) bool {
+			filter[byteIndex] |= bitMask
+			return true
+		})
+	}
+	return filter
+}
+
+// MightContain returns false when the node is definitely not part of the filter. An empty filter (e.g. for cells
+// without filter file) might contain all nodes.
+func (f NodeIdFilter) MightContain(id uint64) bool {
+	if len(f) == 0 {
+		return true
+	}
+	return f.forEachBit(id, func(byteIndex int, bitMask byte) bool {
+		return f[byteIndex]&bitMask != 0
+	})
+}
+
+// MightContainAny returns true when at least one of the nodes might be part of the filter.
+func (f NodeIdFilter) MightContainAny(ids []uint64) bool {
+	for _, id := range ids {
+		if f.MightContain(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachBit calls the given function for each bit of the ID (using double hashing) until it returns false. The
+// returned value is false when the function returned false.
+func (f NodeIdFilter) forEachBit(id uint64, handleBit func(byteIndex int, bitMask byte) bool) bool {
+	numberOfBits := uint64(len(f)) * 8
+	hashA := mixNodeId(id)
+	hashB := mixNodeId(hashA) | 1
+	for i := uint64(0); i < nodeIdFilterHashes; i++ {
+		bit := (hashA + i*hashB) % numberOfBits
+		if !handleBit(int(bit/8), 1<<(bit%8)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mixNodeId scrambles the bits of the ID (s. the finalizer of SplitMix64), since consecutive IDs are very common.
+func mixNodeId(id uint64) uint64 {
+	id = (id ^ (id >> 30)) * 0xbf58476d1ce4e5b9
+	id = (id ^ (id >> 27)) * 0x94d049bb133111eb
+	return id ^ (id >> 31)
+}
+
+func getCellNodeIdFilterFileName(baseFolder string, cellX int, cellY int) string {
+	return path.Join(baseFolder, ownOsm.OsmObjNode.String(), strconv.Itoa(cellX), strconv.Itoa(cellY)+CellNodeIdFilterFileExtension)
+}
+
+// writeCellNodeIdFilter writes the node ID filter of the given cell next to its cell file. The cell file must already
+// exist, so that its folder exists as well.
+func (g *GridIndexWriter) writeCellNodeIdFilter(cell common.CellIndex, filter NodeIdFilter) error {
+	filterFileName := getCellNodeIdFilterFileName(g.BaseFolder, cell.X(), cell.Y())
+	sigolo.Tracef("Write node ID filter with %d bytes to %s", len(filter), filterFileName)
+
+	file, err := os.Create(filterFileName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create node ID filter file %s", filterFileName)
+	}
+
+	_, err = file.Write(filter)
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "Unable to write node ID filter file %s", filterFileName)
+	}
+
+	if g.durable {
+		err = file.Sync()
+		if err != nil {
+			file.Close()
+			return errors.Wrapf(err, "Unable to sync node ID filter file %s", filterFileName)
+		}
+		g.addFolderWithNewFiles(path.Dir(filterFileName))
+	}
+
+	return file.Close()
+}
+
+// readCellNodeIdFilter reads the node ID filter of the given cell. Cells without a filter file either contain no nodes
+// or have been created before node ID filters existed, so an empty filter (which might contain all nodes) is returned
+// for them.
+func (g *GridIndexReader) readCellNodeIdFilter(cellX int, cellY int) (NodeIdFilter, error) {
+	filterFileName := getCellNodeIdFilterFileName(g.BaseFolder, cellX, cellY)
+
+	filter, err := readIndexFile(filterFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		sigolo.Tracef("Node ID filter file %s does not exist, I'll use an empty filter", filterFileName)
+		return NodeIdFilter{}, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read node ID filter file %s", filterFileName)
+	}
+
+	return filter, nil
+}
+
+// MightContainNodes returns false when the given cell definitely contains none of the given nodes.
+func (g *GridIndexReader) MightContainNodes(cell common.CellIndex, nodeIds []uint64) (bool, error) {
+	filter, err := g.readCellNodeIdFilter(cell.X(), cell.Y())
+	if err != nil {
+		return false, err
+	}
+	return filter.MightContainAny(nodeIds), nil
+}
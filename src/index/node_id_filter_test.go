@@ -0,0 +1,62 @@
+package index
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestNodeIdFilter_mightContain(t *testing.T) {
+	// Arrange
+	var ids []uint64
+	for id := uint64(1000); id < 2000; id++ {
+		ids = append(ids, id)
+	}
+
+	// Act
+	filter := NewNodeIdFilter(ids)
+
+	// Assert
+	common.AssertEqual(t, 1250, len(filter))
+	for _, id := range ids {
+		common.AssertTrue(t, filter.MightContain(id))
+	}
+	falsePositives := 0
+	for id := uint64(5000); id < 15000; id++ {
+		if filter.MightContain(id) {
+			falsePositives++
+		}
+	}
+	common.AssertTrue(t, falsePositives < 300)
+	common.AssertTrue(t, filter.MightContainAny([]uint64{1, 2, 1500}))
+}
+
+func TestNodeIdFilter_emptyFilterMightContainAllNodes(t *testing.T) {
+	// Act & Assert
+	common.AssertTrue(t, NodeIdFilter{}.MightContain(1))
+	common.AssertFalse(t, NodeIdFilter{}.MightContainAny(nil))
+}
+
+func TestGridIndexReader_MightContainNodes(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	gridIndexWriter := NewGridIndexWriter(&common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, baseFolder)
+	cell := common.CellIndex{0, 0}
+	gridIndexWriter.cacheRawEncodedNodes[cell] = append(gridIndexWriter.cacheRawEncodedNodes[cell], newTestSubCellNode(1, 0.1, 0.1), newTestSubCellNode(2, 0.2, 0.2))
+	err := gridIndexWriter.addAdditionalIdsToObjectsInCells([]common.CellIndex{cell})
+	common.AssertNil(t, err)
+
+	gridIndexReader := &GridIndexReader{BaseGridIndex: gridIndexWriter.BaseGridIndex}
+
+	// Act
+	containsNode, containsErr := gridIndexReader.MightContainNodes(cell, []uint64{3, 2})
+	containsOtherNode, otherErr := gridIndexReader.MightContainNodes(cell, []uint64{3})
+	containsNodeInOtherCell, otherCellErr := gridIndexReader.MightContainNodes(common.CellIndex{1, 0}, []uint64{3})
+
+	// Assert
+	common.AssertNil(t, containsErr)
+	common.AssertTrue(t, containsNode)
+	common.AssertNil(t, otherErr)
+	common.AssertFalse(t, containsOtherNode)
+	common.AssertNil(t, otherCellErr)
+	common.AssertTrue(t, containsNodeInOtherCell)
+}
@@ -0,0 +1,337 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PackFileExtension is the usual extension of packed index files, e.g. "hamburg.soq".
+const PackFileExtension = ".soq"
+
+const packMagic = "SOQPACK\x00"
+const packVersion = 1
+
+// Size of the header: magic | version (uint32) | number of files (uint32)
+const packHeaderBytes = len(packMagic) + 4 + 4
+
+// Size of an entry of the offset table without the name: name length (uint16) | offset (uint64) | size (uint64)
+const packEntryBytes = 2 + 8 + 8
+
+// packedFile is the position of a file of the index within the pack.
+type packedFile struct {
+	offset uint64
+	size   uint64
+}
+
+// packedIndex is a mounted pack file, either a local one (s. MountPackedIndex) or a remote one (s.
+// MountRemotePackedIndex).
+type packedIndex struct {
+	files map[string]packedFile // Path relative to the index folder -> position in the pack
+	// readFile returns the content of the given file of the pack. The returned data must not be modified.
+	readFile func(name string, file packedFile) ([]byte, error)
+}
+
+var mountedPacksMutex sync.RWMutex
+var mountedPacks = map[string]*packedIndex{} // Cleaned path of the pack file -> mounted pack
+
+// PackIndex bundles all files of the given index folder (tag-index, grid-index, metadata, ...) into one read-only pack
+// file. The pack starts with an offset table of all files followed by their contents, so that it can be memory-mapped
+// and each file is a slice of the pack. Quarantined cells are not packed.
+//
+// Format: magic ("SOQPACK\0") | version (uint32) | number of files (uint32) | offset table | file contents
+// Entry of the offset table: name length (uint16) | name | offset from the start of the pack (uint64) | size (uint64)
+func PackIndex(indexBaseFolder string, packFile string) error {
+	// The folder walk doesn't follow the symlink of a versioned index folder.
+	indexBaseFolder, err := ResolveIndexFolder(indexBaseFolder)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := LoadIndexMetadata(indexBaseFolder)
+	if err != nil {
+		return err
+	}
+	err = metadata.CheckFormatVersion()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	var sizes []uint64
+	quarantineFolder := path.Join(indexBaseFolder, QuarantineFolder)
+	err = filepath.WalkDir(indexBaseFolder, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if filePath == quarantineFolder {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(indexBaseFolder, filePath)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		sizes = append(sizes, uint64(info.Size()))
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Unable to collect files of index folder %s", indexBaseFolder)
+	}
+
+	header := make([]byte, packHeaderBytes)
+	copy(header, packMagic)
+	binary.LittleEndian.PutUint32(header[len(packMagic):], packVersion)
+	binary.LittleEndian.PutUint32(header[len(packMagic)+4:], uint32(len(names)))
+
+	offset := uint64(packHeaderBytes)
+	for _, name := range names {
+		offset += uint64(packEntryBytes + len(name))
+	}
+	var offsetTable []byte
+	for i, name := range names {
+		entry := make([]byte, packEntryBytes+len(name))
+		binary.LittleEndian.PutUint16(entry[0:], uint16(len(name)))
+		copy(entry[2:], name)
+		binary.LittleEndian.PutUint64(entry[2+len(name):], offset)
+		binary.LittleEndian.PutUint64(entry[2+len(name)+8:], sizes[i])
+		offsetTable = append(offsetTable, entry...)
+		offset += sizes[i]
+	}
+
+	file, err := os.Create(packFile)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create pack file %s", packFile)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	_, err = writer.Write(append(header, offsetTable...))
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write offset table to pack file %s", packFile)
+	}
+
+	for i, name := range names {
+		err = appendFileToPack(writer, path.Join(indexBaseFolder, name), sizes[i])
+		if err != nil {
+			return errors.Wrapf(err, "Unable to write file %s to pack file %s", name, packFile)
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write pack file %s", packFile)
+	}
+
+	sigolo.Infof("Packed %d files with %d bytes into %s", len(names), offset, packFile)
+	return file.Close()
+}
+
+// appendFileToPack writes the content of the given file. The file must still have the size of the offset table.
+func appendFileToPack(writer io.Writer, filename string, size uint64) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	written, err := io.Copy(writer, file)
+	if err != nil {
+		return err
+	}
+	if uint64(written) != size {
+		return errors.Errorf("File size changed from %d to %d bytes while packing", size, written)
+	}
+	return nil
+}
+
+// MountPackedIndex memory-maps the given pack file (s. PackIndex) and makes its files readable as if the pack was the
+// index folder. Afterward, the path of the pack file can be used like an index folder, e.g. in LoadTagIndex and
+// LoadGridIndex. Mounting the same pack again has no effect. Packs are read-only and stay mounted until the process
+// ends.
+func MountPackedIndex(packFile string) error {
+	packFile = path.Clean(packFile)
+
+	mountedPacksMutex.Lock()
+	defer mountedPacksMutex.Unlock()
+
+	if _, ok := mountedPacks[packFile]; ok {
+		return nil
+	}
+
+	data, err := mapFile(packFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(ErrIndexMissing, "No pack file %s", packFile)
+	} else if err != nil {
+		return errors.Wrapf(err, "Unable to map pack file %s", packFile)
+	}
+
+	files, err := readPackOffsetTable(data, uint64(len(data)))
+	if err != nil {
+		return errors.Wrapf(err, "Invalid pack file %s", packFile)
+	}
+
+	mountedPacks[packFile] = &packedIndex{
+		files: files,
+		readFile: func(name string, file packedFile) ([]byte, error) {
+			// The capacity is limited, so that appending to the data copies it instead of overwriting the next file.
+			return data[file.offset : file.offset+file.size : file.offset+file.size], nil
+		},
+	}
+	sigolo.Debugf("Mounted pack file %s with %d files", packFile, len(files))
+	return nil
+}
+
+// IsMountedPack returns true when the given index folder is a mounted pack file, s. MountPackedIndex and
+// MountRemotePackedIndex.
+func IsMountedPack(indexBaseFolder string) bool {
+	mountedPacksMutex.RLock()
+	defer mountedPacksMutex.RUnlock()
+	_, ok := mountedPacks[path.Clean(indexBaseFolder)]
+	return ok
+}
+
+// readPackOffsetTable reads the offset table of a pack with the given size. The data must contain at least the header
+// and the offset table, the file contents are not needed.
+func readPackOffsetTable(data []byte, packSize uint64) (map[string]packedFile, error) {
+	if len(data) < packHeaderBytes || string(data[:len(packMagic)]) != packMagic {
+		return nil, errors.New("The file is no soq pack file")
+	}
+	version := binary.LittleEndian.Uint32(data[len(packMagic):])
+	if version != packVersion {
+		return nil, errors.Errorf("Unsupported pack version %d, expected %d", version, packVersion)
+	}
+	numberOfFiles := int(binary.LittleEndian.Uint32(data[len(packMagic)+4:]))
+
+	files := make(map[string]packedFile, numberOfFiles)
+
+	position := packHeaderBytes
+	for i := 0; i < numberOfFiles; i++ {
+		if position+2 > len(data) {
+			return nil, errors.Errorf("Offset table ends unexpectedly at entry %d", i)
+		}
+		nameLength := int(binary.LittleEndian.Uint16(data[position:]))
+		if position+packEntryBytes+nameLength > len(data) {
+			return nil, errors.Errorf("Offset table ends unexpectedly at entry %d", i)
+		}
+		name := string(data[position+2 : position+2+nameLength])
+		file := packedFile{
+			offset: binary.LittleEndian.Uint64(data[position+2+nameLength:]),
+			size:   binary.LittleEndian.Uint64(data[position+2+nameLength+8:]),
+		}
+		if file.offset+file.size > packSize {
+			return nil, errors.Errorf("File %s at offset %d with %d bytes exceeds the pack", name, file.offset, file.size)
+		}
+
+		files[name] = file
+		position += packEntryBytes + nameLength
+	}
+
+	return files, nil
+}
+
+// getPackOffsetTableEnd returns the size of the header and offset table of a pack. The offset table ends where the
+// first file starts, so the data must contain at least the header and the first entry of the offset table.
+func getPackOffsetTableEnd(data []byte) (uint64, error) {
+	if len(data) < packHeaderBytes || string(data[:len(packMagic)]) != packMagic {
+		return 0, errors.New("The file is no soq pack file")
+	}
+	if binary.LittleEndian.Uint32(data[len(packMagic)+4:]) == 0 {
+		return uint64(packHeaderBytes), nil
+	}
+	if len(data) < packHeaderBytes+2 {
+		return 0, errors.New("Offset table ends unexpectedly at entry 0")
+	}
+
+	nameLength := int(binary.LittleEndian.Uint16(data[packHeaderBytes:]))
+	if len(data) < packHeaderBytes+packEntryBytes+nameLength {
+		return 0, errors.New("Offset table ends unexpectedly at entry 0")
+	}
+	return binary.LittleEndian.Uint64(data[packHeaderBytes+2+nameLength:]), nil
+}
+
+// getMountedPack returns the mounted pack containing the given path and the path relative to the pack. Nil is returned
+// when the path is not within a mounted pack.
+func getMountedPack(filename string) (*packedIndex, string) {
+	mountedPacksMutex.RLock()
+	defer mountedPacksMutex.RUnlock()
+
+	if len(mountedPacks) == 0 {
+		return nil, ""
+	}
+
+	filename = path.Clean(filename)
+	for packFile, pack := range mountedPacks {
+		if strings.HasPrefix(filename, packFile+"/") {
+			return pack, strings.TrimPrefix(filename, packFile+"/")
+		}
+	}
+	return nil, ""
+}
+
+// readIndexFile reads a file of an index, which is either a normal file or a file within a mounted pack (s.
+// MountPackedIndex). Like os.ReadFile, an error matching os.ErrNotExist is returned for files not existing in the pack.
+// Files of packs must not be modified.
+func readIndexFile(filename string) ([]byte, error) {
+	pack, name := getMountedPack(filename)
+	if pack == nil {
+		return os.ReadFile(filename)
+	}
+
+	file, ok := pack.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+	}
+	return pack.readFile(name, file)
+}
+
+// indexFileExists returns whether the given file of an index exists, s. readIndexFile.
+func indexFileExists(filename string) (bool, error) {
+	pack, name := getMountedPack(filename)
+	if pack != nil {
+		_, ok := pack.files[name]
+		return ok, nil
+	}
+
+	_, err := os.Stat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// listPackedIndexFiles returns the sorted files within the given folder when this folder is within a mounted pack. The
+// returned bool is false for normal folders.
+func listPackedIndexFiles(folder string) ([]string, bool) {
+	pack, name := getMountedPack(folder)
+	if pack == nil {
+		return nil, false
+	}
+
+	folder = path.Clean(folder)
+	var files []string
+	for packedName := range pack.files {
+		if strings.HasPrefix(packedName, name+"/") {
+			files = append(files, path.Join(folder, strings.TrimPrefix(packedName, name+"/")))
+		}
+	}
+	sort.Strings(files)
+	return files, true
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package index
+
+import "os"
+
+// mapFile reads the whole given file into memory on systems without memory-mapped files.
+func mapFile(filename string) ([]byte, error) {
+	return os.ReadFile(filename)
+}
@@ -0,0 +1,65 @@
+package index
+
+import (
+	"os"
+	"path"
+	"soq/common"
+	"testing"
+)
+
+func TestPackIndex_mountAndRead(t *testing.T) {
+	// Arrange
+	indexBaseFolder := t.TempDir()
+	common.AssertNil(t, (&IndexMetadata{FormatVersion: FormatVersion}).SaveToFile(indexBaseFolder))
+	common.AssertNil(t, os.MkdirAll(path.Join(indexBaseFolder, GridIndexFolder, "node", "3"), 0755))
+	common.AssertNil(t, os.WriteFile(path.Join(indexBaseFolder, GridIndexFolder, "node", "3", "4.cell"), []byte{1, 2, 3}, 0644))
+	common.AssertNil(t, os.WriteFile(path.Join(indexBaseFolder, GridIndexFolder, "node", "3", "5.cell"), []byte{}, 0644))
+	common.AssertNil(t, os.MkdirAll(path.Join(indexBaseFolder, QuarantineFolder), 0755))
+	common.AssertNil(t, os.WriteFile(path.Join(indexBaseFolder, QuarantineFolder, "corrupt.cell"), []byte{9}, 0644))
+	packFile := path.Join(t.TempDir(), "test"+PackFileExtension)
+
+	// Act
+	err := PackIndex(indexBaseFolder, packFile)
+	common.AssertNil(t, err)
+	err = MountPackedIndex(packFile)
+	common.AssertNil(t, err)
+
+	// Assert
+	cellData, err := readIndexFile(path.Join(packFile, GridIndexFolder, "node", "3", "4.cell"))
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []byte{1, 2, 3}, cellData)
+
+	emptyCellData, err := readIndexFile(path.Join(packFile, GridIndexFolder, "node", "3", "5.cell"))
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(emptyCellData))
+
+	_, err = readIndexFile(path.Join(packFile, QuarantineFolder, "corrupt.cell"))
+	common.AssertTrue(t, os.IsNotExist(err))
+
+	exists, err := indexFileExists(path.Join(packFile, GridIndexFolder, "node", "3", "4.cell"))
+	common.AssertNil(t, err)
+	common.AssertTrue(t, exists)
+	exists, err = indexFileExists(path.Join(packFile, GridIndexFolder, "node", "3", "6.cell"))
+	common.AssertNil(t, err)
+	common.AssertFalse(t, exists)
+
+	files, isPacked := listPackedIndexFiles(path.Join(packFile, GridIndexFolder))
+	common.AssertTrue(t, isPacked)
+	common.AssertEqual(t, []string{path.Join(packFile, GridIndexFolder, "node", "3", "4.cell"), path.Join(packFile, GridIndexFolder, "node", "3", "5.cell")}, files)
+
+	metadata, err := LoadIndexMetadata(packFile)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, FormatVersion, metadata.FormatVersion)
+}
+
+func TestMountPackedIndex_invalidFile(t *testing.T) {
+	// Arrange
+	packFile := path.Join(t.TempDir(), "invalid"+PackFileExtension)
+	common.AssertNil(t, os.WriteFile(packFile, []byte("no pack file"), 0644))
+
+	// Act
+	err := MountPackedIndex(packFile)
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
@@ -0,0 +1,143 @@
+package index
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type PrefixSearchResult struct {
+	Value string
+	Count int // Number of OSM objects with this key or tag. Always 0 when the tag-index has no counts.
+}
+
+// prefixIndex is a list of strings sorted by their lower case representation. All strings with a certain prefix are
+// therefore next to each other and can be found with a binary search.
+type prefixIndex struct {
+	lowerValues []string
+	indices     []int // Index of the string in the key- or value-map of the tag-index.
+}
+
+func newPrefixIndex(values []string) *prefixIndex {
+	indices := make([]int, len(values))
+	lowerValues := make([]string, len(values))
+	for i, value := range values {
+		indices[i] = i
+		lowerValues[i] = strings.ToLower(value)
+	}
+
+	sort.Sort(&prefixIndexSorter{lowerValues: lowerValues, indices: indices})
+
+	return &prefixIndex{
+		lowerValues: lowerValues,
+		indices:     indices,
+	}
+}
+
+// find returns the indices of all strings starting with the given prefix (case-insensitive).
+func (p *prefixIndex) find(prefix string) []int {
+	prefix = strings.ToLower(prefix)
+	start := sort.SearchStrings(p.lowerValues, prefix)
+
+	var result []int
+	for i := start; i < len(p.lowerValues) && strings.HasPrefix(p.lowerValues[i], prefix); i++ {
+		result = append(result, p.indices[i])
+	}
+	return result
+}
+
+type prefixIndexSorter struct {
+	lowerValues []string
+	indices     []int
+}
+
+func (s *prefixIndexSorter) Len() int {
+	return len(s.lowerValues)
+}
+
+func (s *prefixIndexSorter) Less(a, b int) bool {
+	return s.lowerValues[a] < s.lowerValues[b]
+}
+
+func (s *prefixIndexSorter) Swap(a, b int) {
+	s.lowerValues[a], s.lowerValues[b] = s.lowerValues[b], s.lowerValues[a]
+	s.indices[a], s.indices[b] = s.indices[b], s.indices[a]
+}
+
+// prefixIndices contains the prefix indices of a tag-index. They're only created on first use, since most tag-indices
+// are never searched and the value lists can be huge.
+type prefixIndices struct {
+	mutex  sync.Mutex
+	keys   *prefixIndex
+	values map[int]*prefixIndex // Key index -> prefix index of the values of that key
+}
+
+// SearchKeysByPrefix returns all keys starting with the given prefix (case-insensitive), e.g. "ame" finds "amenity".
+// The keys are sorted by their number of occurrences. At most maxResults results are returned.
+func (i *TagIndex) SearchKeysByPrefix(prefix string, maxResults int) []PrefixSearchResult {
+	i.prefixIndices.mutex.Lock()
+	if i.prefixIndices.keys == nil {
+		i.prefixIndices.keys = newPrefixIndex(i.keyMap)
+	}
+	keyPrefixIndex := i.prefixIndices.keys
+	i.prefixIndices.mutex.Unlock()
+
+	var results []PrefixSearchResult
+	for _, keyIndex := range keyPrefixIndex.find(prefix) {
+		results = append(results, PrefixSearchResult{Value: i.keyMap[keyIndex], Count: i.getKeyCount(keyIndex)})
+	}
+
+	return sortAndLimitPrefixSearchResults(results, maxResults)
+}
+
+// SearchValuesByPrefix returns all values of the given key starting with the given prefix (case-insensitive), e.g.
+// "rest" finds "restaurant" for the key "amenity". The values are sorted by their number of occurrences. At most
+// maxResults results are returned.
+func (i *TagIndex) SearchValuesByPrefix(key string, prefix string, maxResults int) ([]PrefixSearchResult, error) {
+	keyIndex := i.GetKeyIndexFromKeyString(key)
+	if keyIndex == NotFound {
+		return nil, errors.Wrapf(ErrUnknownKey, "Key '%s' does not exist in the tag-index", key)
+	}
+
+	i.prefixIndices.mutex.Lock()
+	if i.prefixIndices.values == nil {
+		i.prefixIndices.values = map[int]*prefixIndex{}
+	}
+	valuePrefixIndex, ok := i.prefixIndices.values[keyIndex]
+	if !ok {
+		valuePrefixIndex = newPrefixIndex(i.valueMap[keyIndex])
+		i.prefixIndices.values[keyIndex] = valuePrefixIndex
+	}
+	i.prefixIndices.mutex.Unlock()
+
+	var results []PrefixSearchResult
+	for _, valueIndex := range valuePrefixIndex.find(prefix) {
+		results = append(results, PrefixSearchResult{
+			Value: i.valueMap[keyIndex][valueIndex],
+			Count: i.GetValueCount(keyIndex, valueIndex),
+		})
+	}
+
+	return sortAndLimitPrefixSearchResults(results, maxResults), nil
+}
+
+// sortAndLimitPrefixSearchResults sorts the results by their count and then alphabetically. Shorter strings come first
+// for the same count, since they're more likely to be the one the user is looking for.
+func sortAndLimitPrefixSearchResults(results []PrefixSearchResult, maxResults int) []PrefixSearchResult {
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Count != results[b].Count {
+			return results[a].Count > results[b].Count
+		}
+		if len(results[a].Value) != len(results[b].Value) {
+			return len(results[a].Value) < len(results[b].Value)
+		}
+		return results[a].Value < results[b].Value
+	})
+
+	if len(results) > maxResults {
+		results = results[:maxResults]
+	}
+
+	return results
+}
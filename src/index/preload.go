@@ -0,0 +1,122 @@
+package index
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"soq/common"
+	ownOsm "soq/osm"
+	"sync"
+	"time"
+)
+
+type PreloadStats struct {
+	PreloadedCells int  `json:"preloadedCells"`
+	TotalCells     int  `json:"totalCells"`
+	Features       int  `json:"features"`
+	Done           bool `json:"done"`
+}
+
+// CellPreloader reads all cells within a bbox into the cell cache of the index and pins them there, so that queries
+// within this area don't need to read the cell files from disk. The pinned cells stay in memory as long as the index
+// is used, so the bbox should only cover the area most queries are about.
+type CellPreloader struct {
+	geometryIndex *GridIndexReader
+	bbox          orb.Bound
+
+	statsMutex sync.Mutex
+	stats      PreloadStats
+}
+
+func NewCellPreloader(geometryIndex *GridIndexReader, bbox orb.Bound) *CellPreloader {
+	return &CellPreloader{
+		geometryIndex: geometryIndex,
+		bbox:          bbox,
+	}
+}
+
+func (p *CellPreloader) Stats() PreloadStats {
+	p.statsMutex.Lock()
+	defer p.statsMutex.Unlock()
+	return p.stats
+}
+
+// Run reads all cells within the bbox. It returns when all cells are cached or when the stop channel is closed.
+func (p *CellPreloader) Run(stop <-chan struct{}) error {
+	minCell := p.geometryIndex.GetCellIndexForCoordinate(p.bbox.Min.Lon(), p.bbox.Min.Lat())
+	maxCell := p.geometryIndex.GetCellIndexForCoordinate(p.bbox.Max.Lon(), p.bbox.Max.Lat())
+	cells := common.CellExtent{minCell, maxCell}.GetCellIndices()
+	p.updateStats(func(stats *PreloadStats) { stats.TotalCells = len(cells) })
+
+	sigolo.Infof("Start preloading %d cells", len(cells))
+	startTime := time.Now()
+
+	for _, cell := range cells {
+		select {
+		case <-stop:
+			sigolo.Infof("Stopped preloading cells after %s", time.Since(startTime))
+			return nil
+		default:
+		}
+
+		for _, objectType := range []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjRelation} {
+			numberOfFeatures, err := p.preloadCell(cell, objectType)
+			if err != nil {
+				return err
+			}
+			p.updateStats(func(stats *PreloadStats) { stats.Features += numberOfFeatures })
+		}
+
+		p.updateStats(func(stats *PreloadStats) { stats.PreloadedCells++ })
+		if stats := p.Stats(); stats.PreloadedCells%max(stats.TotalCells/10, 1) == 0 {
+			sigolo.Infof("Preloaded %d of %d cells with %d features", stats.PreloadedCells, stats.TotalCells, stats.Features)
+		}
+	}
+
+	p.updateStats(func(stats *PreloadStats) { stats.Done = true })
+	stats := p.Stats()
+	sigolo.Infof("Preloaded %d cells with %d features in %s", stats.PreloadedCells, stats.Features, time.Since(startTime))
+
+	return nil
+}
+
+// preloadCell reads all (sub-)cell files of the given cell into the cache and pins them. Returns the number of read
+// features.
+func (p *CellPreloader) preloadCell(cell common.CellIndex, objectType ownOsm.OsmObjectType) (int, error) {
+	cellFileNames, err := p.geometryIndex.getCellFileNames(cell.X(), cell.Y(), objectType, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	numberOfFeatures := 0
+	for _, cellFileName := range cellFileNames {
+		// The entry might be evicted by concurrent queries before it's pinned, so it's read again in this case.
+		for pinned := false; !pinned; {
+			features, err := p.geometryIndex.readFeaturesFromFile(cellFileName, nil, objectType, nil, nil)
+			if err != nil {
+				return 0, err
+			}
+			if len(features) == 0 {
+				// Empty or missing files are not cached.
+				break
+			}
+
+			pinned = p.geometryIndex.cellCache.pin(cellFileName)
+			if !pinned {
+				continue
+			}
+			for _, f := range features {
+				if f != nil {
+					numberOfFeatures++
+				}
+			}
+		}
+	}
+
+	return numberOfFeatures, nil
+}
+
+func (p *CellPreloader) updateStats(update func(stats *PreloadStats)) {
+	p.statsMutex.Lock()
+	update(&p.stats)
+	p.statsMutex.Unlock()
+}
@@ -0,0 +1,67 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func TestLruFeatureCache_pinnedEntriesAreNotEvicted(t *testing.T) {
+	// Arrange
+	cache := newLruCache(1)
+	common.AssertNil(t, cache.insert("a", []feature.Feature{}))
+
+	// Act
+	pinned := cache.pin("a")
+	common.AssertNil(t, cache.insert("b", []feature.Feature{}))
+	common.AssertNil(t, cache.insert("c", []feature.Feature{}))
+
+	// Assert
+	common.AssertTrue(t, pinned)
+	common.AssertFalse(t, cache.pin("not-existing"))
+	common.AssertTrue(t, cache.has("a"))
+	common.AssertFalse(t, cache.has("b"))
+	common.AssertTrue(t, cache.has("c"))
+}
+
+func TestCellPreloader_Run(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	cellScheme := &common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}
+	gridIndexWriter := NewGridIndexWriter(cellScheme, baseFolder)
+	cells := []common.CellIndex{{0, 0}, {0, 1}, {1, 0}}
+	for i, cell := range cells {
+		node := &EncodedNodeFeature{
+			AbstractEncodedFeature: AbstractEncodedFeature{
+				ID:       uint64(i + 1),
+				Geometry: &orb.Point{float64(cell.X()) + 0.5, float64(cell.Y()) + 0.5},
+				Keys:     []int{},
+				Values:   []int{},
+			},
+		}
+		common.AssertNil(t, gridIndexWriter.writeOsmObjectToCell(cell.X(), cell.Y(), node))
+		common.AssertNil(t, gridIndexWriter.closeCellFiles(cell))
+	}
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: gridIndexWriter.BaseGridIndex,
+		cellCache:     newLruCache(1),
+		metadata:      &IndexMetadata{},
+	}
+	preloader := NewCellPreloader(gridIndexReader, orb.Bound{Min: orb.Point{0.5, 0.5}, Max: orb.Point{1.5, 1.5}})
+
+	// Act
+	err := preloader.Run(nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, PreloadStats{PreloadedCells: 4, TotalCells: 4, Features: 3, Done: true}, preloader.Stats())
+	for _, cell := range cells {
+		cellFileNames, err := gridIndexReader.getCellFileNames(cell.X(), cell.Y(), ownOsm.OsmObjNode, nil)
+		common.AssertNil(t, err)
+		common.AssertEqual(t, 1, len(cellFileNames))
+		common.AssertTrue(t, gridIndexReader.cellCache.has(cellFileNames[0]))
+	}
+}
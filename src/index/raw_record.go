@@ -0,0 +1,134 @@
+package index
+
+import (
+	"encoding/binary"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"os"
+	"soq/common"
+	"soq/encoding"
+	"soq/feature"
+	ownOsm "soq/osm"
+)
+
+// RawRecord is the encoded record of a feature exactly as it's stored in a cell file. Features spanning several cells
+// (like ways) have one record per cell.
+type RawRecord struct {
+	ObjectType ownOsm.OsmObjectType
+	Cell       common.CellIndex
+	// File containing the record. Cells split during the import have one file per sub-cell.
+	Filename string
+	// Byte offset of the record within the cell file.
+	Offset int
+	Data   []byte
+}
+
+// Decode decodes the raw record into a feature. See DecodeRawRecord for details.
+func (r RawRecord) Decode() (feature.Feature, error) {
+	return DecodeRawRecord(r.ObjectType, r.Data)
+}
+
+// GetRawRecords returns all records of the given feature from the cell files. Only cells within the given bbox are
+// searched, when the bbox is nil, all existing cells of the object type are searched, which might take a while on large
+// indices. The cell files are read directly, so the cache and relation geometries are not used.
+func (g *GridIndexReader) GetRawRecords(objectType ownOsm.OsmObjectType, id uint64, bbox *orb.Bound) ([]RawRecord, error) {
+	var cells []common.CellIndex
+	var err error
+	if bbox == nil {
+		cells, err = g.getExistingCells(objectType)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		minCell := g.GetCellIndexForCoordinate(bbox.Min.Lon(), bbox.Min.Lat())
+		maxCell := g.GetCellIndexForCoordinate(bbox.Max.Lon(), bbox.Max.Lat())
+		for cellX := minCell.X(); cellX <= maxCell.X(); cellX++ {
+			for cellY := minCell.Y(); cellY <= maxCell.Y(); cellY++ {
+				cells = append(cells, common.CellIndex{cellX, cellY})
+			}
+		}
+	}
+
+	sigolo.Debugf("Search raw records of %s %d in %d cells", objectType.String(), id, len(cells))
+
+	var records []RawRecord
+	for _, cell := range cells {
+		cellRecords, err := g.getRawRecordsFromCell(cell, objectType, id)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, cellRecords...)
+	}
+
+	return records, nil
+}
+
+func (g *GridIndexReader) getRawRecordsFromCell(cell common.CellIndex, objectType ownOsm.OsmObjectType, id uint64) ([]RawRecord, error) {
+	cellFileNames, err := g.getCellFileNames(cell.X(), cell.Y(), objectType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []RawRecord
+	for _, cellFileName := range cellFileNames {
+		data, err := readIndexFile(cellFileName)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read cell file %s", cellFileName)
+		}
+
+		// Incomplete records would lead to wrong offsets of all following records.
+		err = verifyCellDataStructure(data, objectType)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read records of cell file %s", cellFileName)
+		}
+
+		for pos := 0; pos < len(data); {
+			recordSize := getRecordSize(data[pos:], objectType)
+			if binary.LittleEndian.Uint64(data[pos:]) == id {
+				records = append(records, RawRecord{
+					ObjectType: objectType,
+					Cell:       cell,
+					Filename:   cellFileName,
+					Offset:     pos,
+					Data:       data[pos : pos+recordSize],
+				})
+			}
+			pos += recordSize
+		}
+	}
+
+	return records, nil
+}
+
+// DecodeRawRecord decodes a single record of a cell file of the given object type. The data must contain exactly one
+// complete record.
+func DecodeRawRecord(objectType ownOsm.OsmObjectType, data []byte) (feature.Feature, error) {
+	err := verifyCellDataStructure(data, objectType)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || getRecordSize(data, objectType) != len(data) {
+		return nil, errors.Errorf("Data of %d bytes does not contain exactly one %s record", len(data), objectType.String())
+	}
+
+	// The reader only writes features into its output buffer, so a reader without a loaded index is sufficient.
+	reader := &GridIndexReader{}
+	return reader.readFeaturesFromCellData(data, objectType, nil, nil, nil)[0], nil
+}
+
+// getRecordSize returns the size of the record at the beginning of the data. The data must at least contain the
+// complete header of the record.
+func getRecordSize(data []byte, objectType ownOsm.OsmObjectType) int {
+	switch objectType {
+	case ownOsm.OsmObjNode:
+		return encoding.NodeRecord(data).Size()
+	case ownOsm.OsmObjWay:
+		return encoding.WayRecord(data).Size()
+	case ownOsm.OsmObjRelation:
+		return encoding.RelationRecord(data).Size()
+	}
+	panic("Unsupported object type to read: " + objectType.String())
+}
@@ -0,0 +1,67 @@
+package index
+
+import (
+	"bytes"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"os"
+	"path"
+	"soq/common"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func TestGridIndexReader_getRawRecords(t *testing.T) {
+	// Arrange
+	gridIndexWriter := &GridIndexWriter{}
+	f := bytes.NewBuffer([]byte{})
+
+	for _, id := range []uint64{1, 2, 3} {
+		err := gridIndexWriter.writeNodeData(&EncodedNodeFeature{
+			AbstractEncodedFeature: AbstractEncodedFeature{
+				ID:       id,
+				Geometry: &orb.Point{0.5, 0.5},
+				Keys:     []int{int(id)},
+				Values:   []int{0},
+			},
+			WayIds: []osm.WayID{osm.WayID(id * 10)},
+		}, f)
+		common.AssertNil(t, err)
+	}
+
+	baseFolder := t.TempDir()
+	cellFolder := path.Join(baseFolder, ownOsm.OsmObjNode.String(), "0")
+	common.AssertNil(t, os.MkdirAll(cellFolder, os.ModePerm))
+	common.AssertNil(t, os.WriteFile(path.Join(cellFolder, "0.cell"), f.Bytes(), 0644))
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: BaseGridIndex{CellScheme: &common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, BaseFolder: baseFolder},
+	}
+
+	// Act
+	records, err := gridIndexReader.GetRawRecords(ownOsm.OsmObjNode, 2, nil)
+	bboxRecords, bboxErr := gridIndexReader.GetRawRecords(ownOsm.OsmObjNode, 2, &orb.Bound{Min: orb.Point{5, 5}, Max: orb.Point{6, 6}})
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 1, len(records))
+	common.AssertEqual(t, common.CellIndex{0, 0}, records[0].Cell)
+	common.AssertEqual(t, len(f.Bytes())/3, records[0].Offset)
+	common.AssertEqual(t, f.Bytes()[records[0].Offset:2*records[0].Offset], records[0].Data)
+
+	decodedFeature, err := records[0].Decode()
+	common.AssertNil(t, err)
+	common.AssertEqual(t, uint64(2), decodedFeature.GetID())
+	common.AssertEqual(t, []osm.WayID{20}, decodedFeature.(*EncodedNodeFeature).WayIds)
+
+	common.AssertNil(t, bboxErr)
+	common.AssertEqual(t, 0, len(bboxRecords))
+}
+
+func TestDecodeRawRecord_incompleteRecord(t *testing.T) {
+	// Act
+	_, err := DecodeRawRecord(ownOsm.OsmObjWay, []byte{1, 2, 3})
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
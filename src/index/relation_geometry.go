@@ -0,0 +1,270 @@
+package index
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/planar"
+	"github.com/pkg/errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"soq/feature"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const RelationGeometryFolder = "relation-geometry"
+const relationGeometryFileExtension = ".wkb"
+
+// Number of sub-folders the geometry files are distributed into, to not have millions of files in one folder.
+const relationGeometrySubFolders = 1000
+
+// RelationGeometryStore contains the real geometries of relations. The cells only contain the bbox of relations, since
+// assembling their geometries is expensive. The RelationGeometryBuilder assembles them after the import and stores them
+// here. Relations without a geometry in this store keep their bbox geometry.
+type RelationGeometryStore struct {
+	baseFolder string
+	mutex      sync.RWMutex
+	ids        map[uint64]bool
+}
+
+// LoadRelationGeometryStore collects the IDs of all relations with a stored geometry. The geometries themselves are
+// read when needed.
+func LoadRelationGeometryStore(indexBaseFolder string) (*RelationGeometryStore, error) {
+	store := &RelationGeometryStore{
+		baseFolder: path.Join(indexBaseFolder, RelationGeometryFolder),
+		ids:        map[uint64]bool{},
+	}
+
+	addFile := func(filePath string) {
+		filename := path.Base(filePath)
+		if !strings.HasSuffix(filename, relationGeometryFileExtension) {
+			return
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(filename, relationGeometryFileExtension), 10, 64)
+		if err != nil {
+			sigolo.Debugf("Ignore file %s in relation geometry folder", filePath)
+			return
+		}
+		store.ids[id] = true
+	}
+
+	if packedFiles, isPacked := listPackedIndexFiles(store.baseFolder); isPacked {
+		for _, filePath := range packedFiles {
+			addFile(filePath)
+		}
+		sigolo.Debugf("Found %d stored relation geometries", len(store.ids))
+		return store, nil
+	}
+
+	err := filepath.WalkDir(store.baseFolder, func(filePath string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return fs.SkipAll
+		} else if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			addFile(filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read relation geometry folder %s", store.baseFolder)
+	}
+
+	sigolo.Debugf("Found %d stored relation geometries", len(store.ids))
+	return store, nil
+}
+
+func (s *RelationGeometryStore) Has(id uint64) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.ids[id]
+}
+
+func (s *RelationGeometryStore) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.ids)
+}
+
+func (s *RelationGeometryStore) Get(id uint64) (*orb.MultiPolygon, error) {
+	filename := s.getFilename(id)
+
+	data, err := readIndexFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read geometry of relation %d", id)
+	}
+
+	geometry, err := wkb.Unmarshal(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to decode geometry of relation %d from %s", id, filename)
+	}
+
+	multiPolygon, ok := geometry.(orb.MultiPolygon)
+	if !ok {
+		return nil, errors.Errorf("Geometry of relation %d is a %s but a multipolygon is expected", id, geometry.GeoJSONType())
+	}
+
+	return &multiPolygon, nil
+}
+
+// Save writes the geometry of the given relation. The file is written under a temporary name and renamed afterward,
+// so that concurrent readers never see half-written geometries.
+func (s *RelationGeometryStore) Save(id uint64, geometry *orb.MultiPolygon) error {
+	filename := s.getFilename(id)
+
+	data, err := wkb.Marshal(*geometry)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to encode geometry of relation %d", id)
+	}
+
+	err = os.MkdirAll(path.Dir(filename), os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create folder for geometry of relation %d", id)
+	}
+
+	tempFilename := filename + ".tmp"
+	err = os.WriteFile(tempFilename, data, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write geometry of relation %d to %s", id, tempFilename)
+	}
+
+	err = os.Rename(tempFilename, filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to rename %s to %s", tempFilename, filename)
+	}
+
+	s.mutex.Lock()
+	s.ids[id] = true
+	s.mutex.Unlock()
+
+	return nil
+}
+
+func (s *RelationGeometryStore) getFilename(id uint64) string {
+	subFolder := strconv.FormatUint(id%relationGeometrySubFolders, 10)
+	return path.Join(s.baseFolder, subFolder, strconv.FormatUint(id, 10)+relationGeometryFileExtension)
+}
+
+// withRelationGeometry returns a copy of the given relation with its stored geometry. Features without stored
+// geometry are returned unchanged.
+func (g *GridIndexReader) withRelationGeometry(f feature.Feature) feature.Feature {
+	relation, ok := f.(*EncodedRelationFeature)
+	if !ok || g.relationGeometries == nil || !g.relationGeometries.Has(relation.ID) {
+		return f
+	}
+
+	geometry, err := g.relationGeometries.Get(relation.ID)
+	if err != nil {
+		sigolo.Errorf("Unable to get stored geometry of relation %d, I'll use its bbox: %+v", relation.ID, err)
+		return f
+	}
+
+	relationWithGeometry := *relation
+	relationWithGeometry.Geometry = geometry
+	return &relationWithGeometry
+}
+
+// withRelationGeometries is like withRelationGeometry for all given features. The given slice stays unchanged, since
+// it might be shared with the cell cache.
+func (g *GridIndexReader) withRelationGeometries(features []feature.Feature) []feature.Feature {
+	if g.relationGeometries == nil || g.relationGeometries.Count() == 0 {
+		return features
+	}
+
+	result := make([]feature.Feature, len(features))
+	for i, f := range features {
+		if f != nil {
+			result[i] = g.withRelationGeometry(f)
+		}
+	}
+	return result
+}
+
+// assembleMultiPolygon creates a multipolygon from the given outer and inner ways. Ways not being closed themselves are
+// joined at their ends to form closed rings. False is returned when this is not possible, e.g. because members are
+// missing.
+func assembleMultiPolygon(outerWays []orb.LineString, innerWays []orb.LineString) (*orb.MultiPolygon, bool) {
+	outerRings, ok := assembleRings(outerWays)
+	if !ok || len(outerRings) == 0 {
+		return nil, false
+	}
+	innerRings, ok := assembleRings(innerWays)
+	if !ok {
+		return nil, false
+	}
+
+	multiPolygon := make(orb.MultiPolygon, len(outerRings))
+	for i, outerRing := range outerRings {
+		multiPolygon[i] = orb.Polygon{outerRing}
+	}
+
+	for _, innerRing := range innerRings {
+		for i, outerRing := range outerRings {
+			if planar.RingContains(outerRing, innerRing[0]) {
+				multiPolygon[i] = append(multiPolygon[i], innerRing)
+				break
+			}
+		}
+	}
+
+	return &multiPolygon, true
+}
+
+// assembleRings joins the given line strings at their ends until each of them forms a closed ring. False is returned
+// when a line string can't be closed.
+func assembleRings(lineStrings []orb.LineString) ([]orb.Ring, bool) {
+	var rings []orb.Ring
+	var openLineStrings []orb.LineString
+
+	for _, lineString := range lineStrings {
+		if len(lineString) < 2 {
+			continue
+		}
+		if len(lineString) >= 4 && orb.Ring(lineString).Closed() {
+			rings = append(rings, orb.Ring(lineString.Clone()))
+		} else {
+			openLineStrings = append(openLineStrings, lineString)
+		}
+	}
+
+	for len(openLineStrings) > 0 {
+		current := openLineStrings[0].Clone()
+		openLineStrings = openLineStrings[1:]
+
+		for !orb.Ring(current).Closed() {
+			joined := false
+			for i, lineString := range openLineStrings {
+				if lineString[0] == current[len(current)-1] {
+					current = append(current, lineString[1:]...)
+				} else if lineString[len(lineString)-1] == current[len(current)-1] {
+					reversed := lineString.Clone()
+					reversed.Reverse()
+					current = append(current, reversed[1:]...)
+				} else {
+					continue
+				}
+
+				openLineStrings = append(openLineStrings[:i], openLineStrings[i+1:]...)
+				joined = true
+				break
+			}
+
+			if !joined {
+				return nil, false
+			}
+		}
+
+		if len(current) < 4 {
+			return nil, false
+		}
+		rings = append(rings, orb.Ring(current))
+	}
+
+	return rings, true
+}
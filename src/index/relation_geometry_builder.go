@@ -0,0 +1,221 @@
+package index
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"sync"
+	"time"
+)
+
+// Maximum number of relations waiting to be built with priority. Further relations are not prioritized but built
+// during the normal pass over all cells.
+const maxPrioritizedRelations = 10_000
+
+type RelationGeometryStats struct {
+	ProcessedCells int  `json:"processedCells"`
+	TotalCells     int  `json:"totalCells"`
+	Built          int  `json:"built"`
+	Skipped        int  `json:"skipped"`
+	Failed         int  `json:"failed"`
+	Prioritized    int  `json:"prioritized"`
+	Done           bool `json:"done"`
+}
+
+// RelationGeometryBuilder upgrades the geometry of multipolygon and boundary relations from their bbox to real
+// multipolygons by assembling the geometries of their outer and inner ways. It goes through all cells of the index and
+// waits the given delay after each relation, so that it can run in the background without slowing down queries too much.
+// Relations passed to Prioritize are built before all others.
+type RelationGeometryBuilder struct {
+	geometryIndex *GridIndexReader
+	delay         time.Duration
+
+	prioritizedRelations chan feature.RelationFeature
+	handledRelations     map[uint64]bool
+
+	statsMutex sync.Mutex
+	stats      RelationGeometryStats
+}
+
+func NewRelationGeometryBuilder(geometryIndex *GridIndexReader, delay time.Duration) *RelationGeometryBuilder {
+	return &RelationGeometryBuilder{
+		geometryIndex:        geometryIndex,
+		delay:                delay,
+		prioritizedRelations: make(chan feature.RelationFeature, maxPrioritizedRelations),
+		handledRelations:     map[uint64]bool{},
+	}
+}
+
+// Prioritize queues all relations within the given features, which still have their bbox geometry, to be built next.
+// This doesn't block, relations are not prioritized when the queue is full or the builder is done.
+func (b *RelationGeometryBuilder) Prioritize(features []feature.Feature) {
+	if b.Stats().Done {
+		return
+	}
+
+	for _, f := range features {
+		relation, ok := f.(feature.RelationFeature)
+		if !ok || b.geometryIndex.relationGeometries.Has(relation.GetID()) {
+			continue
+		}
+
+		select {
+		case b.prioritizedRelations <- relation:
+			b.updateStats(func(stats *RelationGeometryStats) { stats.Prioritized++ })
+		default:
+			return
+		}
+	}
+}
+
+func (b *RelationGeometryBuilder) Stats() RelationGeometryStats {
+	b.statsMutex.Lock()
+	defer b.statsMutex.Unlock()
+	return b.stats
+}
+
+// Run builds the geometries of all relations within the extent of the index. It returns when all relations have been
+// handled or when the stop channel is closed.
+func (b *RelationGeometryBuilder) Run(stop <-chan struct{}) error {
+	metadata := b.geometryIndex.GetMetadata()
+	if metadata.Extent == nil {
+		return errors.New("The index contains no information about the extent of the imported data, please re-import the data")
+	}
+
+	minCell := b.geometryIndex.GetCellIndexForCoordinate(metadata.Extent.Min.Lon(), metadata.Extent.Min.Lat())
+	maxCell := b.geometryIndex.GetCellIndexForCoordinate(metadata.Extent.Max.Lon(), metadata.Extent.Max.Lat())
+	cells := common.CellExtent{minCell, maxCell}.GetCellIndices()
+	b.updateStats(func(stats *RelationGeometryStats) { stats.TotalCells = len(cells) })
+
+	sigolo.Infof("Start building relation geometries in %d cells", len(cells))
+	startTime := time.Now()
+
+	for _, cell := range cells {
+		relations, err := b.geometryIndex.readFeaturesFromCellFile(cell.X(), cell.Y(), ownOsm.OsmObjRelation, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, relation := range relations {
+			if relation == nil {
+				continue
+			}
+
+			// Prioritized relations first, so that queries benefit as early as possible.
+			for prioritized := true; prioritized; {
+				select {
+				case prioritizedRelation := <-b.prioritizedRelations:
+					b.updateStats(func(stats *RelationGeometryStats) { stats.Prioritized-- })
+					b.handleRelation(prioritizedRelation)
+				default:
+					prioritized = false
+				}
+			}
+
+			b.handleRelation(relation)
+
+			select {
+			case <-stop:
+				sigolo.Infof("Stopped building relation geometries after %s", time.Since(startTime))
+				return nil
+			case <-time.After(b.delay):
+			}
+		}
+
+		b.updateStats(func(stats *RelationGeometryStats) { stats.ProcessedCells++ })
+		if stats := b.Stats(); stats.ProcessedCells%max(stats.TotalCells/10, 1) == 0 {
+			sigolo.Infof("Processed %d of %d cells: %d relation geometries built, %d skipped, %d failed", stats.ProcessedCells, stats.TotalCells, stats.Built, stats.Skipped, stats.Failed)
+		}
+	}
+
+	b.updateStats(func(stats *RelationGeometryStats) { stats.Done = true })
+	stats := b.Stats()
+	sigolo.Infof("Built %d relation geometries (%d skipped, %d failed) in %s", stats.Built, stats.Skipped, stats.Failed, time.Since(startTime))
+
+	return nil
+}
+
+// handleRelation builds and stores the geometry of the given relation, unless this already happened before.
+func (b *RelationGeometryBuilder) handleRelation(relation feature.Feature) {
+	id := relation.GetID()
+	if b.handledRelations[id] {
+		return
+	}
+	b.handledRelations[id] = true
+
+	if b.geometryIndex.relationGeometries.Has(id) {
+		b.updateStats(func(stats *RelationGeometryStats) { stats.Built++ })
+		return
+	}
+
+	geometry, err := b.geometryIndex.buildRelationGeometry(relation)
+	if err != nil {
+		sigolo.Errorf("Unable to build geometry of relation %d: %+v", id, err)
+		b.updateStats(func(stats *RelationGeometryStats) { stats.Failed++ })
+		return
+	}
+	if geometry == nil {
+		sigolo.Tracef("Relation %d has no polygonal geometry, I'll keep its bbox", id)
+		b.updateStats(func(stats *RelationGeometryStats) { stats.Skipped++ })
+		return
+	}
+
+	err = b.geometryIndex.relationGeometries.Save(id, geometry)
+	if err != nil {
+		sigolo.Errorf("Unable to store geometry of relation %d: %+v", id, err)
+		b.updateStats(func(stats *RelationGeometryStats) { stats.Failed++ })
+		return
+	}
+
+	b.updateStats(func(stats *RelationGeometryStats) { stats.Built++ })
+}
+
+func (b *RelationGeometryBuilder) updateStats(update func(stats *RelationGeometryStats)) {
+	b.statsMutex.Lock()
+	update(&b.stats)
+	b.statsMutex.Unlock()
+}
+
+func (g *GridIndexReader) buildRelationGeometry(relation feature.Feature) (*orb.MultiPolygon, error) {
+	return BuildRelationGeometry(g, g.TagIndex, relation)
+}
+
+// BuildRelationGeometry assembles the multipolygon of the given multipolygon or boundary relation from its outer and
+// inner ways. Nil is returned for other relations and when the ways don't form closed rings, e.g. because some of them
+// are outside the imported data.
+func BuildRelationGeometry(geometryIndex GeometryIndex, tagIndex *TagIndex, relation feature.Feature) (*orb.MultiPolygon, error) {
+	typeKey, multipolygonValue := tagIndex.GetIndicesFromKeyValueStrings("type", "multipolygon")
+	_, boundaryValue := tagIndex.GetIndicesFromKeyValueStrings("type", "boundary")
+	if !relation.HasTag(typeKey, multipolygonValue) && !relation.HasTag(typeKey, boundaryValue) {
+		return nil, nil
+	}
+
+	membersByRelation, err := GetRelationMemberGeometriesByRole(geometryIndex, []feature.Feature{relation})
+	if err != nil {
+		return nil, err
+	}
+	membersByRole := membersByRelation[relation.GetID()]
+
+	// Ways without role are treated as outer ways, as many renderers do.
+	outerWays := getLineStrings(append(membersByRole["outer"], membersByRole[""]...))
+	innerWays := getLineStrings(membersByRole["inner"])
+
+	multiPolygon, ok := assembleMultiPolygon(outerWays, innerWays)
+	if !ok {
+		return nil, nil
+	}
+	return multiPolygon, nil
+}
+
+func getLineStrings(geometries []orb.Geometry) []orb.LineString {
+	var lineStrings []orb.LineString
+	for _, geometry := range geometries {
+		if lineString, ok := DereferenceGeometry(geometry).(orb.LineString); ok {
+			lineStrings = append(lineStrings, lineString)
+		}
+	}
+	return lineStrings
+}
@@ -0,0 +1,90 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"testing"
+)
+
+func TestAssembleRings_joinOpenLineStrings(t *testing.T) {
+	// Arrange
+	lineStrings := []orb.LineString{
+		{{0, 0}, {1, 0}},
+		{{1, 1}, {1, 0}}, // reversed
+		{{1, 1}, {0, 1}, {0, 0}},
+	}
+
+	// Act
+	rings, ok := assembleRings(lineStrings)
+
+	// Assert
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, []orb.Ring{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}}, rings)
+}
+
+func TestAssembleRings_notClosable(t *testing.T) {
+	// Arrange
+	lineStrings := []orb.LineString{
+		{{0, 0}, {1, 0}},
+		{{1, 0}, {1, 1}},
+	}
+
+	// Act
+	_, ok := assembleRings(lineStrings)
+
+	// Assert
+	common.AssertFalse(t, ok)
+}
+
+func TestAssembleMultiPolygon_withInnerRing(t *testing.T) {
+	// Arrange
+	outerWays := []orb.LineString{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+		{{20, 0}, {30, 0}, {30, 10}, {20, 10}, {20, 0}},
+	}
+	innerWays := []orb.LineString{
+		{{22, 2}, {24, 2}, {24, 4}},
+		{{24, 4}, {22, 2}},
+	}
+
+	// Act
+	multiPolygon, ok := assembleMultiPolygon(outerWays, innerWays)
+
+	// Assert
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, 2, len(*multiPolygon))
+	common.AssertEqual(t, 1, len((*multiPolygon)[0]))
+	common.AssertEqual(t, 2, len((*multiPolygon)[1]))
+	common.AssertEqual(t, orb.Ring{{22, 2}, {24, 2}, {24, 4}, {22, 2}}, (*multiPolygon)[1][1])
+}
+
+func TestAssembleMultiPolygon_withoutOuterWays(t *testing.T) {
+	// Act
+	_, ok := assembleMultiPolygon(nil, []orb.LineString{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}})
+
+	// Assert
+	common.AssertFalse(t, ok)
+}
+
+func TestRelationGeometryStore_saveAndLoad(t *testing.T) {
+	// Arrange
+	indexBaseFolder := t.TempDir()
+	store, err := LoadRelationGeometryStore(indexBaseFolder)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, store.Count())
+
+	geometry := &orb.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}}
+
+	// Act
+	err = store.Save(1234, geometry)
+	common.AssertNil(t, err)
+	reloadedStore, err := LoadRelationGeometryStore(indexBaseFolder)
+	common.AssertNil(t, err)
+
+	// Assert
+	common.AssertTrue(t, reloadedStore.Has(1234))
+	common.AssertFalse(t, reloadedStore.Has(234))
+	loadedGeometry, err := reloadedStore.Get(1234)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, geometry, loadedGeometry)
+}
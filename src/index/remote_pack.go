@@ -0,0 +1,202 @@
+package index
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of bytes read from the start of a remote pack when mounting it. This contains the header and at least the
+// first entry of the offset table, so that the size of the whole offset table is known afterward.
+const remotePackInitialRangeBytes = packHeaderBytes + packEntryBytes + 65535
+
+// The cached files of a remote pack are removed when this file in the cache folder doesn't match the pack anymore.
+const remotePackIdentityFilename = "pack-identity"
+
+var remotePackClient = &http.Client{Timeout: time.Minute}
+
+// remotePack reads the files of a pack via HTTP range requests, e.g. from S3 or GCS.
+type remotePack struct {
+	url string
+	// Read files are stored in this folder, so that they're only requested once. Empty disables the cache.
+	cacheFolder string
+}
+
+// MountRemotePackedIndex makes the files of the pack file (s. PackIndex) at the given HTTP(S) URL readable as if the
+// URL was the index folder, e.g. for LoadTagIndex and LoadGridIndex. This way, stateless query nodes can use a large
+// shared index in an object storage (e.g. a public or presigned S3 URL) without copying it. Only the offset table is
+// read when mounting, each file of the index is read with an HTTP range request when it's needed. Read files are
+// stored in the cache folder, which is cleared when the pack at the URL changes. An empty cache folder disables this
+// cache, the cells are then only cached in memory like for local indices.
+func MountRemotePackedIndex(packUrl string, cacheFolder string) error {
+	mountPath := path.Clean(packUrl)
+
+	mountedPacksMutex.Lock()
+	defer mountedPacksMutex.Unlock()
+
+	if _, ok := mountedPacks[mountPath]; ok {
+		return nil
+	}
+
+	pack := &remotePack{
+		url:         packUrl,
+		cacheFolder: cacheFolder,
+	}
+
+	data, packSize, identity, err := pack.readRange(0, uint64(remotePackInitialRangeBytes))
+	if err != nil {
+		return err
+	}
+	offsetTableEnd, err := getPackOffsetTableEnd(data)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid pack file %s", packUrl)
+	}
+	if offsetTableEnd > uint64(len(data)) {
+		data, _, _, err = pack.readRange(0, offsetTableEnd)
+		if err != nil {
+			return err
+		}
+	}
+
+	files, err := readPackOffsetTable(data, packSize)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid pack file %s", packUrl)
+	}
+
+	if cacheFolder != "" {
+		err = pack.prepareCacheFolder(identity)
+		if err != nil {
+			return err
+		}
+	}
+
+	mountedPacks[mountPath] = &packedIndex{
+		files:    files,
+		readFile: pack.readFile,
+	}
+	sigolo.Infof("Mounted remote pack file %s with %d files", packUrl, len(files))
+	return nil
+}
+
+// readRange requests the given bytes of the pack. The number of bytes might be less than requested at the end of the
+// pack. The size of the whole pack and a string identifying its version (ETag and modification time) are returned as
+// well.
+func (p *remotePack) readRange(offset uint64, size uint64) ([]byte, uint64, string, error) {
+	if size == 0 {
+		return []byte{}, 0, "", nil
+	}
+
+	request, err := http.NewRequest(http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, 0, "", errors.Wrapf(err, "Unable to create request for %s", p.url)
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+
+	response, err := remotePackClient.Do(request)
+	if err != nil {
+		return nil, 0, "", errors.Wrapf(err, "Request to %s failed", p.url)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusPartialContent {
+		return nil, 0, "", errors.Errorf("Range request to %s failed with status %s, the server must support range requests", p.url, response.Status)
+	}
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, "", errors.Wrapf(err, "Unable to read bytes %d to %d of %s", offset, offset+size-1, p.url)
+	}
+
+	// Example: "bytes 0-65535/123456"
+	contentRange := response.Header.Get("Content-Range")
+	packSize, err := strconv.ParseUint(contentRange[strings.LastIndex(contentRange, "/")+1:], 10, 64)
+	if err != nil {
+		return nil, 0, "", errors.Wrapf(err, "Invalid Content-Range header '%s' of %s", contentRange, p.url)
+	}
+
+	identity := fmt.Sprintf("%d %s %s", packSize, response.Header.Get("ETag"), response.Header.Get("Last-Modified"))
+	return data, packSize, identity, nil
+}
+
+// prepareCacheFolder removes all cached files when they belong to another version of the pack.
+func (p *remotePack) prepareCacheFolder(identity string) error {
+	identityFilename := path.Join(p.cacheFolder, remotePackIdentityFilename)
+	cachedIdentity, err := os.ReadFile(identityFilename)
+	if err == nil && string(cachedIdentity) == identity {
+		return nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "Unable to read identity of cached pack %s", identityFilename)
+	}
+
+	sigolo.Debugf("Clear cache folder %s of remote pack %s", p.cacheFolder, p.url)
+	err = os.RemoveAll(p.cacheFolder)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to clear cache folder %s", p.cacheFolder)
+	}
+	err = os.MkdirAll(p.cacheFolder, os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create cache folder %s", p.cacheFolder)
+	}
+	return os.WriteFile(identityFilename, []byte(identity), 0644)
+}
+
+// readFile returns the given file from the cache folder or requests it from the remote pack.
+func (p *remotePack) readFile(name string, file packedFile) ([]byte, error) {
+	cacheFilename := path.Join(p.cacheFolder, filepath.FromSlash(name))
+	if p.cacheFolder != "" {
+		data, err := os.ReadFile(cacheFilename)
+		if err == nil && uint64(len(data)) == file.size {
+			return data, nil
+		}
+	}
+
+	data, _, _, err := p.readRange(file.offset, file.size)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read file %s of remote pack", name)
+	}
+	if uint64(len(data)) != file.size {
+		return nil, errors.Errorf("Read %d instead of %d bytes of file %s of remote pack %s", len(data), file.size, name, p.url)
+	}
+
+	if p.cacheFolder != "" {
+		err = writeCacheFile(cacheFilename, data)
+		if err != nil {
+			// The data is still valid, it's just requested again next time.
+			sigolo.Warnf("Unable to cache file %s of remote pack: %+v", name, err)
+		}
+	}
+
+	return data, nil
+}
+
+// writeCacheFile writes the data into a temporary file first, so that concurrent readers never see incomplete files.
+func writeCacheFile(filename string, data []byte) error {
+	err := os.MkdirAll(path.Dir(filename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(path.Dir(filename), path.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(data)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), filename)
+}
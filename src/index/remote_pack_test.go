@@ -0,0 +1,73 @@
+package index
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"soq/common"
+	"testing"
+)
+
+func TestMountRemotePackedIndex_readAndCache(t *testing.T) {
+	// Arrange
+	indexBaseFolder := t.TempDir()
+	common.AssertNil(t, (&IndexMetadata{FormatVersion: FormatVersion}).SaveToFile(indexBaseFolder))
+	common.AssertNil(t, os.MkdirAll(path.Join(indexBaseFolder, GridIndexFolder, "node", "3"), 0755))
+	common.AssertNil(t, os.WriteFile(path.Join(indexBaseFolder, GridIndexFolder, "node", "3", "4.cell"), []byte{1, 2, 3}, 0644))
+	packFile := path.Join(t.TempDir(), "test"+PackFileExtension)
+	common.AssertNil(t, PackIndex(indexBaseFolder, packFile))
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		http.ServeFile(writer, request, packFile)
+	}))
+	defer server.Close()
+	packUrl := server.URL + "/test" + PackFileExtension
+	cacheFolder := path.Join(t.TempDir(), "cache")
+
+	// Act
+	err := MountRemotePackedIndex(packUrl, cacheFolder)
+	common.AssertNil(t, err)
+
+	// Assert
+	common.AssertTrue(t, IsMountedPack(packUrl))
+	common.AssertEqual(t, 1, requests)
+
+	cellFile := path.Join(packUrl, GridIndexFolder, "node", "3", "4.cell")
+	cellData, err := readIndexFile(cellFile)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []byte{1, 2, 3}, cellData)
+	common.AssertEqual(t, 2, requests)
+
+	cellData, err = readIndexFile(cellFile)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []byte{1, 2, 3}, cellData)
+	common.AssertEqual(t, 2, requests)
+
+	cachedData, err := os.ReadFile(path.Join(cacheFolder, GridIndexFolder, "node", "3", "4.cell"))
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []byte{1, 2, 3}, cachedData)
+
+	_, err = readIndexFile(path.Join(packUrl, GridIndexFolder, "node", "3", "5.cell"))
+	common.AssertTrue(t, os.IsNotExist(err))
+
+	metadata, err := LoadIndexMetadata(packUrl)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, FormatVersion, metadata.FormatVersion)
+}
+
+func TestMountRemotePackedIndex_rangeRequestsNotSupported(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(packMagic))
+	}))
+	defer server.Close()
+
+	// Act
+	err := MountRemotePackedIndex(server.URL+"/test"+PackFileExtension, t.TempDir())
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
@@ -0,0 +1,79 @@
+package index
+
+import (
+	"github.com/pkg/errors"
+	"soq/common"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// minTrigramSimilarity is the similarity at which a value is considered as match, even when its Levenshtein distance
+// is too large. This finds values with a different word order or additional words, like "fast food" for "fast_food".
+const minTrigramSimilarity = 0.4
+
+type ValueSearchResult struct {
+	Value    string
+	Count    int // Number of OSM objects with this tag. Always 0 when the tag-index has no counts.
+	Distance int // Levenshtein distance between the search term and the value (case-insensitive).
+}
+
+// SearchValues finds values of the given key similar to the search term. This helps finding the correct value when
+// the exact spelling is not known, e.g. "caffe" finds "cafe". The results are sorted by their distance to the search
+// term and by their number of occurrences. At most maxResults results are returned.
+func (i *TagIndex) SearchValues(key string, searchTerm string, maxResults int) ([]ValueSearchResult, error) {
+	keyIndex := i.GetKeyIndexFromKeyString(key)
+	if keyIndex == NotFound {
+		return nil, errors.Wrapf(ErrUnknownKey, "Key '%s' does not exist in the tag-index", key)
+	}
+
+	return searchSimilar(searchTerm, i.GetValuesForKey(keyIndex), func(valueIndex int) int {
+		return i.GetValueCount(keyIndex, valueIndex)
+	}, maxResults), nil
+}
+
+// SearchKeys finds keys similar to the search term like SearchValues does for values, e.g. "hihgway" finds "highway".
+// The Value of the results is the found key.
+func (i *TagIndex) SearchKeys(searchTerm string, maxResults int) []ValueSearchResult {
+	return searchSimilar(searchTerm, i.keyMap, i.getKeyCount, maxResults)
+}
+
+// searchSimilar returns the given strings similar to the search term, s. SearchValues. The count function returns the
+// number of OSM objects for the index of a string.
+func searchSimilar(searchTerm string, values []string, count func(index int) int, maxResults int) []ValueSearchResult {
+	searchTerm = strings.ToLower(searchTerm)
+	// Allow roughly one typo per three characters but at least one.
+	maxDistance := max(utf8.RuneCountInString(searchTerm)/3, 1)
+
+	var results []ValueSearchResult
+	for index, value := range values {
+		lowerValue := strings.ToLower(value)
+		distance := common.LevenshteinDistance(searchTerm, lowerValue)
+
+		isMatch := distance <= maxDistance ||
+			strings.Contains(lowerValue, searchTerm) ||
+			common.TrigramSimilarity(searchTerm, lowerValue) >= minTrigramSimilarity
+		if !isMatch {
+			continue
+		}
+
+		results = append(results, ValueSearchResult{
+			Value:    value,
+			Count:    count(index),
+			Distance: distance,
+		})
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Distance != results[b].Distance {
+			return results[a].Distance < results[b].Distance
+		}
+		return results[a].Count > results[b].Count
+	})
+
+	if len(results) > maxResults {
+		results = results[:maxResults]
+	}
+
+	return results
+}
@@ -0,0 +1,240 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/common"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"sort"
+	"strconv"
+)
+
+const CellSplitFileExtension = ".split"
+
+// DefaultCellSplitThreshold is the number of features of one object type a cell may contain before it's split into
+// sub-cells during the import.
+const DefaultCellSplitThreshold = 100000
+
+// Maximum number of times a cell is split. Features covering the whole cell (e.g. long ways) are part of every
+// quadrant, so the number of features can't be reduced arbitrarily.
+const maxCellSplitDepth = 4
+
+// subCell is a part of a cell that has been split during the import. Its path contains one digit per split level for
+// the quadrant of the (sub-)cell: 0 = lower-left, 1 = lower-right, 2 = upper-left, 3 = upper-right. For example "30"
+// is the lower-left quadrant of the upper-right quadrant of the cell.
+type subCell struct {
+	Path string `json:"path"`
+	// Bound of all features in this sub-cell, which might exceed the area of the sub-cell.
+	Bound orb.Bound `json:"bound"`
+}
+
+func getCellFileName(baseFolder string, cellX int, cellY int, objectType ownOsm.OsmObjectType) string {
+	return path.Join(baseFolder, objectType.String(), strconv.Itoa(cellX), strconv.Itoa(cellY)+".cell")
+}
+
+func getSubCellFileName(baseFolder string, cellX int, cellY int, objectType ownOsm.OsmObjectType, subCellPath string) string {
+	return path.Join(baseFolder, objectType.String(), strconv.Itoa(cellX), strconv.Itoa(cellY)+"-"+subCellPath+".cell")
+}
+
+func getCellSplitFileName(baseFolder string, cellX int, cellY int, objectType ownOsm.OsmObjectType) string {
+	return path.Join(baseFolder, objectType.String(), strconv.Itoa(cellX), strconv.Itoa(cellY)+CellSplitFileExtension)
+}
+
+// splitIntoSubCells recursively divides the given features into the quadrants of the bound until each sub-cell contains
+// at most threshold features or the maximum depth is reached. The non-empty sub-cells are added to the result.
+func splitIntoSubCells(bound orb.Bound, subCellPath string, features []feature.Feature, threshold int, result map[string][]feature.Feature) {
+	if len(features) == 0 {
+		return
+	}
+	if len(features) <= threshold || len(subCellPath) == maxCellSplitDepth {
+		result[subCellPath] = features
+		return
+	}
+
+	var quadrantFeatures [4][]feature.Feature
+	center := bound.Center()
+	for _, f := range features {
+		for _, quadrant := range getQuadrants(center, f) {
+			quadrantFeatures[quadrant] = append(quadrantFeatures[quadrant], f)
+		}
+	}
+
+	for quadrant, featuresInQuadrant := range quadrantFeatures {
+		quadrantBound := orb.Bound{Min: bound.Min, Max: center}
+		if quadrant%2 == 1 {
+			quadrantBound.Min[0], quadrantBound.Max[0] = center.X(), bound.Max.X()
+		}
+		if quadrant/2 == 1 {
+			quadrantBound.Min[1], quadrantBound.Max[1] = center.Y(), bound.Max.Y()
+		}
+		splitIntoSubCells(quadrantBound, subCellPath+strconv.Itoa(quadrant), featuresInQuadrant, threshold, result)
+	}
+}
+
+// getQuadrants returns the quadrants around the given center whose area intersects the bbox of the feature. The lower
+// and left quadrants don't contain their upper and right border, so nodes always belong to exactly one quadrant.
+func getQuadrants(center orb.Point, f feature.Feature) []int {
+	bound := f.GetGeometry().Bound()
+
+	var quadrants []int
+	for _, quadrant := range []int{0, 1, 2, 3} {
+		isRight := quadrant%2 == 1
+		isUpper := quadrant/2 == 1
+		if isRight && bound.Max.X() < center.X() || !isRight && bound.Min.X() >= center.X() {
+			continue
+		}
+		if isUpper && bound.Max.Y() < center.Y() || !isUpper && bound.Min.Y() >= center.Y() {
+			continue
+		}
+		quadrants = append(quadrants, quadrant)
+	}
+	return quadrants
+}
+
+// writeSplitCell writes the given features of a cell into sub-cell files and lists them in the split file of the cell.
+func (g *GridIndexWriter) writeSplitCell(cell common.CellIndex, objectType ownOsm.OsmObjectType, features []feature.Feature) error {
+	subCells := map[string][]feature.Feature{}
+	splitIntoSubCells(g.CellScheme.GetCellBound(cell), "", features, g.cellSplitThreshold, subCells)
+	sigolo.Debugf("Split %s cell %v with %d features into %d sub-cells", objectType.String(), cell, len(features), len(subCells))
+
+	var subCellInfos []subCell
+	for subCellPath, subCellFeatures := range subCells {
+		bound := subCellFeatures[0].GetGeometry().Bound()
+		for _, f := range subCellFeatures[1:] {
+			bound = bound.Union(f.GetGeometry().Bound())
+		}
+		subCellInfos = append(subCellInfos, subCell{Path: subCellPath, Bound: bound})
+
+		err := g.writeSubCellFile(getSubCellFileName(g.BaseFolder, cell.X(), cell.Y(), objectType, subCellPath), subCellFeatures)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The order of the map iteration is random, but the split file should be identical for identical input data.
+	sort.Slice(subCellInfos, func(i, j int) bool { return subCellInfos[i].Path < subCellInfos[j].Path })
+
+	splitFileName := getCellSplitFileName(g.BaseFolder, cell.X(), cell.Y(), objectType)
+	splitBytes, err := json.Marshal(subCellInfos)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to marshal sub-cells of %s cell %v", objectType.String(), cell)
+	}
+	err = os.WriteFile(splitFileName, splitBytes, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write split file %s", splitFileName)
+	}
+
+	if g.durable {
+		err = common.SyncFile(splitFileName)
+		if err != nil {
+			return err
+		}
+		g.addFolderWithNewFiles(path.Dir(splitFileName))
+	}
+
+	return nil
+}
+
+func (g *GridIndexWriter) writeSubCellFile(subCellFileName string, features []feature.Feature) error {
+	err := os.MkdirAll(path.Dir(subCellFileName), os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create cell folder for sub-cell file %s", subCellFileName)
+	}
+
+	file, err := os.Create(subCellFileName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create sub-cell file %s", subCellFileName)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+
+	for _, f := range features {
+		switch typedFeature := f.(type) {
+		case feature.NodeFeature:
+			err = g.writeNodeData(typedFeature, writer)
+		case feature.WayFeature:
+			err = g.writeWayData(typedFeature, writer)
+		case feature.RelationFeature:
+			err = g.writeRelationData(typedFeature, writer)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Unable to write feature %d to sub-cell file %s", f.GetID(), subCellFileName)
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to flush sub-cell file %s", subCellFileName)
+	}
+
+	if g.durable {
+		err = file.Sync()
+		if err != nil {
+			return errors.Wrapf(err, "Unable to sync sub-cell file %s", subCellFileName)
+		}
+	}
+
+	return nil
+}
+
+// getSubCells returns the sub-cells of the given cell or nil when the cell hasn't been split. The sub-cells of each cell
+// are only read once from disk.
+func (g *GridIndexReader) getSubCells(cellX int, cellY int, objectType ownOsm.OsmObjectType) ([]subCell, error) {
+	splitFileName := getCellSplitFileName(g.BaseFolder, cellX, cellY, objectType)
+	if subCells, ok := g.splitCells.Load(splitFileName); ok {
+		return subCells.([]subCell), nil
+	}
+
+	var subCells []subCell
+	splitBytes, err := readIndexFile(splitFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read split file %s", splitFileName)
+	}
+
+	err = json.Unmarshal(splitBytes, &subCells)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse split file %s", splitFileName)
+	}
+
+	g.splitCells.Store(splitFileName, subCells)
+	return subCells, nil
+}
+
+// getCellFileNames returns the cell file of the given cell or, when it has been split, the files of all sub-cells with
+// features within the given bbox (nil means all sub-cells). Nothing is returned for cells without features.
+func (g *GridIndexReader) getCellFileNames(cellX int, cellY int, objectType ownOsm.OsmObjectType, bbox *orb.Bound) ([]string, error) {
+	cellFileName := getCellFileName(g.BaseFolder, cellX, cellY, objectType)
+	if exists, err := indexFileExists(cellFileName); err != nil {
+		return nil, errors.Wrapf(err, "Unable to get existance status of cell file %s", cellFileName)
+	} else if exists {
+		return []string{cellFileName}, nil
+	}
+
+	subCells, err := g.getSubCells(cellX, cellY, objectType)
+	if err != nil {
+		return nil, err
+	}
+	if subCells == nil {
+		return nil, nil
+	}
+
+	var fileNames []string
+	for _, sc := range subCells {
+		// Stored coordinates are less precise than the ones used to determine the bound.
+		bound := sc.Bound.Pad(nodeCellTolerance)
+		if bbox != nil && !bbox.Intersects(bound) {
+			continue
+		}
+		fileNames = append(fileNames, getSubCellFileName(g.BaseFolder, cellX, cellY, objectType, sc.Path))
+	}
+	return fileNames, nil
+}
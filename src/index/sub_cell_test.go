@@ -0,0 +1,103 @@
+package index
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"soq/common"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"sort"
+	"testing"
+)
+
+func newTestSubCellNode(id uint64, lon float64, lat float64) *EncodedNodeFeature {
+	return &EncodedNodeFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{
+			ID:       id,
+			Geometry: &orb.Point{lon, lat},
+			Keys:     []int{},
+			Values:   []int{},
+		},
+	}
+}
+
+func TestSplitIntoSubCells(t *testing.T) {
+	// Arrange
+	way := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{ID: 10, Geometry: &orb.LineString{{0.1, 0.1}, {0.9, 0.1}}},
+	}
+	features := []feature.Feature{
+		newTestSubCellNode(1, 0.1, 0.1),
+		newTestSubCellNode(2, 0.2, 0.2),
+		newTestSubCellNode(3, 0.3, 0.1),
+		newTestSubCellNode(4, 0.5, 0.5),
+		way,
+	}
+	result := map[string][]feature.Feature{}
+
+	// Act
+	splitIntoSubCells(orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}, "", features, 3, result)
+
+	// Assert
+	var subCellPaths []string
+	for subCellPath := range result {
+		subCellPaths = append(subCellPaths, subCellPath)
+	}
+	sort.Strings(subCellPaths)
+	common.AssertEqual(t, []string{"00", "01", "1", "3"}, subCellPaths)
+	common.AssertEqual(t, []feature.Feature{features[0], features[1], way}, result["00"])
+	common.AssertEqual(t, []feature.Feature{features[2], way}, result["01"])
+	common.AssertEqual(t, []feature.Feature{way}, result["1"])
+	common.AssertEqual(t, []feature.Feature{features[3]}, result["3"])
+}
+
+func TestGridIndexWriter_splitCellIsReadBySubCells(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	cell := common.CellIndex{0, 0}
+	gridIndexWriter := NewGridIndexWriter(&common.LatLonCellScheme{CellWidth: 1, CellHeight: 1}, baseFolder)
+	gridIndexWriter.cellSplitThreshold = 2
+	for i, point := range []orb.Point{{0.1, 0.1}, {0.2, 0.2}, {0.7, 0.2}, {0.8, 0.8}, {0.9, 0.9}} {
+		gridIndexWriter.cacheRawEncodedNodes[cell] = append(gridIndexWriter.cacheRawEncodedNodes[cell], newTestSubCellNode(uint64(i+1), point.Lon(), point.Lat()))
+	}
+	way := &EncodedWayFeature{
+		AbstractEncodedFeature: AbstractEncodedFeature{ID: 1, Geometry: &orb.LineString{{0.1, 0.1}, {0.9, 0.9}}, Keys: []int{}, Values: []int{}},
+		Nodes:                  osm.WayNodes{{ID: 1, Lon: 0.1, Lat: 0.1}, {ID: 5, Lon: 0.9, Lat: 0.9}},
+	}
+	gridIndexWriter.cacheRawEncodedWays[cell] = []feature.WayFeature{way, way, way}
+
+	err := gridIndexWriter.addAdditionalIdsToObjectsInCells([]common.CellIndex{cell})
+	common.AssertNil(t, err)
+
+	gridIndexReader := &GridIndexReader{
+		BaseGridIndex: gridIndexWriter.BaseGridIndex,
+		cellCache:     newLruCache(10),
+		metadata:      &IndexMetadata{},
+	}
+	getIds := func(bbox orb.Bound, objectType ownOsm.OsmObjectType) []uint64 {
+		resultChannel, err := gridIndexReader.Get(&bbox, objectType, nil, nil, nil)
+		common.AssertNil(t, err)
+		var ids []uint64
+		for result := range resultChannel {
+			for _, f := range result.Features {
+				ids = append(ids, f.GetID())
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+
+	// Act
+	lowerLeftNodeIds := getIds(orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.3, 0.3}}, ownOsm.OsmObjNode)
+	allNodes, allNodesErr := gridIndexReader.readFeaturesFromCellFile(0, 0, ownOsm.OsmObjNode, nil, nil)
+	wayIds := getIds(orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}, ownOsm.OsmObjWay)
+	subCellFileNames, subCellErr := gridIndexReader.getCellFileNames(0, 0, ownOsm.OsmObjNode, &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.3, 0.3}})
+
+	// Assert
+	common.AssertEqual(t, []uint64{1, 2}, lowerLeftNodeIds)
+	common.AssertNil(t, allNodesErr)
+	common.AssertEqual(t, 5, len(allNodes))
+	common.AssertEqual(t, []uint64{1}, wayIds)
+	common.AssertNil(t, subCellErr)
+	common.AssertEqual(t, []string{getSubCellFileName(baseFolder, 0, 0, ownOsm.OsmObjNode, "0")}, subCellFileNames)
+}
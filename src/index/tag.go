@@ -1,7 +1,6 @@
 package index
 
 import (
-	"bufio"
 	"bytes"
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/osm"
@@ -9,11 +8,16 @@ import (
 	"io"
 	"os"
 	"path"
+	"slices"
 	"soq/common"
+	"soq/feature"
+	"strconv"
 	"strings"
 )
 
 const TagIndexFilename = "tag-index"
+const TagIndexCountsFilename = "tag-index-counts"
+const TagIndexUsersFilename = "tag-index-users"
 const NotFound = -1
 
 type TagIndexCreator struct {
@@ -21,15 +25,24 @@ type TagIndexCreator struct {
 	keyReverseMap   map[string]int   // Helper map: key-string -> key-index
 	valueMap        [][]string       // [key-index][value-index] -> value-string
 	valueReverseMap []map[string]int // Helper array from keyIndex to a map from value-string to value-index (the index in the valueMap[key-index]-array)
+	valueCounts     []map[string]int // [key-index][value-string] -> number of OSM objects with this tag
+	users           map[string]bool  // Names of all users who last modified an OSM object. Nil when users are not collected.
 }
 
-func NewTagIndexCreator() *TagIndexCreator {
-	return &TagIndexCreator{
+// NewTagIndexCreator creates a handler collecting all tags of the data. When collectUsers is true, the user names are
+// collected as well, which is needed to store the metadata of the OSM objects.
+func NewTagIndexCreator(collectUsers bool) *TagIndexCreator {
+	creator := &TagIndexCreator{
 		keyMap:          []string{},
 		keyReverseMap:   map[string]int{},
 		valueMap:        [][]string{},
 		valueReverseMap: []map[string]int{},
+		valueCounts:     []map[string]int{},
 	}
+	if collectUsers {
+		creator.users = map[string]bool{}
+	}
+	return creator
 }
 
 func (w *TagIndexCreator) Name() string {
@@ -42,19 +55,28 @@ func (t *TagIndexCreator) Init() error {
 
 func (t *TagIndexCreator) HandleNode(node *osm.Node) error {
 	t.addTagsToIndex(node.Tags)
+	t.addUser(node.User)
 	return nil
 }
 
 func (t *TagIndexCreator) HandleWay(way *osm.Way) error {
 	t.addTagsToIndex(way.Tags)
+	t.addUser(way.User)
 	return nil
 }
 
 func (t *TagIndexCreator) HandleRelation(relation *osm.Relation) error {
 	t.addTagsToIndex(relation.Tags)
+	t.addUser(relation.User)
 	return nil
 }
 
+func (t *TagIndexCreator) addUser(user string) {
+	if t.users != nil {
+		t.users[user] = true
+	}
+}
+
 func (t *TagIndexCreator) Done() error {
 	// Make sure the values are sorted so that comparison operators work. We can change the order as we want, because
 	// OSM objects are not yet stored, this happens in a separate index.
@@ -67,7 +89,26 @@ func (t *TagIndexCreator) Done() error {
 }
 
 func (t *TagIndexCreator) CreateTagIndex() *TagIndex {
-	return NewTagIndex(t.keyMap, t.valueMap)
+	tagIndex := NewTagIndex(t.keyMap, t.valueMap)
+
+	// The values have been sorted, so the counts are stored in the order of the sorted values.
+	tagIndex.valueCounts = make([][]int, len(t.valueMap))
+	for keyIndex, values := range t.valueMap {
+		tagIndex.valueCounts[keyIndex] = make([]int, len(values))
+		for valueIndex, value := range values {
+			tagIndex.valueCounts[keyIndex][valueIndex] = t.valueCounts[keyIndex][value]
+		}
+	}
+
+	if t.users != nil {
+		userMap := make([]string, 0, len(t.users))
+		for user := range t.users {
+			userMap = append(userMap, user)
+		}
+		tagIndex.SetUsers(userMap)
+	}
+
+	return tagIndex
 }
 
 func (t *TagIndexCreator) addTagsToIndex(tags osm.Tags) {
@@ -84,6 +125,7 @@ func (t *TagIndexCreator) addTagsToIndex(tags osm.Tags) {
 				t.valueMap[keyIndex] = append(t.valueMap[keyIndex], tag.Value)
 				t.valueReverseMap[keyIndex][tag.Value] = len(t.valueMap) - 1
 			}
+			t.valueCounts[keyIndex][tag.Value]++
 		} else {
 			// Key appeared for the first time -> Create maps and add entry
 			t.keyMap = append(t.keyMap, tag.Key)
@@ -93,6 +135,8 @@ func (t *TagIndexCreator) addTagsToIndex(tags osm.Tags) {
 			t.valueMap = append(t.valueMap, []string{tag.Value})
 			t.valueReverseMap = append(t.valueReverseMap, map[string]int{})
 			t.valueReverseMap[keyIndex][tag.Value] = 0
+
+			t.valueCounts = append(t.valueCounts, map[string]int{tag.Value: 1})
 		}
 	}
 }
@@ -102,71 +146,114 @@ type TagIndex struct {
 	keyMap     []string   // The index value of a key is the position in this array.
 	valueMap   [][]string // Array index is here the key index. I.e. valueMap[key] contains the list of value strings.
 
+	// Number of OSM objects for each tag: valueCounts[key][value]. This is nil for indices created before the counts
+	// existed.
+	valueCounts [][]int
+
+	// Sorted names of the users who last modified the OSM objects. The index of a name in this list is the user stored
+	// in the metadata of the features. This is nil when the index contains no metadata.
+	userMap []string
+
 	// Only used during import. These are not persisted and will be nil during query phase (i.e. after reading the tag-
 	// index from disk).
 	keyReverseMap   map[string]int   // Helper map: key-string -> key-index
 	valueReverseMap []map[string]int // Helper map: value-string -> value-index in value[key-index]-array
+
+	// Used for the prefix search, s. SearchKeysByPrefix and SearchValuesByPrefix.
+	prefixIndices prefixIndices
 }
 
+// LoadTagIndex reads the tag-index from the given index folder. Both the binary and the (older) text format are
+// supported, s. readTagIndex.
 func LoadTagIndex(baseFolder string) (*TagIndex, error) {
-	tagIndexFile, err := os.Open(path.Join(baseFolder, TagIndexFilename))
-	sigolo.FatalCheck(err)
+	tagIndexFilename := path.Join(baseFolder, TagIndexFilename)
+	data, err := readIndexFile(tagIndexFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Wrapf(ErrIndexMissing, "No tag-index file in %s", baseFolder)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read tag-index file in %s", baseFolder)
+	}
 
-	defer func() {
-		err = tagIndexFile.Close()
-		sigolo.FatalCheck(errors.Wrapf(err, "Unable to close file handle for tag-index store %s", baseFolder))
-	}()
+	keyMap, valueMap, err := readTagIndex(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse tag-index file %s", tagIndexFilename)
+	}
 
-	var keyMap []string
-	var valueMap [][]string
+	index := &TagIndex{
+		BaseFolder: path.Base(baseFolder),
+		keyMap:     keyMap,
+		valueMap:   valueMap,
+	}
 
-	reader := bufio.NewReader(tagIndexFile)
-	lineCounter := 0
-	nextLinePartBytes, isPrefix, err := reader.ReadLine()
-	for err == nil {
-		lineBytes := make([]byte, len(nextLinePartBytes))
-		copy(lineBytes, nextLinePartBytes)
+	index.valueCounts, err = loadValueCounts(baseFolder, valueMap)
+	if err != nil {
+		return nil, err
+	}
 
-		// The line might be very long and only the first part is returned. Therefore, we need to collect the rest of the line.
-		for isPrefix && err == nil {
-			nextLinePartBytes, isPrefix, err = reader.ReadLine()
-			lineBytes = append(lineBytes, nextLinePartBytes...)
-		}
-		line := string(lineBytes)
+	index.userMap, err = loadUsers(baseFolder)
+	if err != nil {
+		return nil, err
+	}
 
-		splitLine := strings.SplitN(line, "=", 2)
-		if len(splitLine) != 2 {
-			lineStart := line
-			if len(lineStart) > 100 {
-				lineStart = lineStart[0:100]
-			}
-			return nil, errors.Errorf("Wrong format of line %d: '=' expected separating key and value list. Start of line was: %s", lineCounter, lineStart)
-		}
+	return index, nil
+}
 
-		key := splitLine[0]
-		values := splitLine[1]
-		values = strings.ReplaceAll(values, "$$NEWLINE$$", "\n")
-		values = strings.ReplaceAll(values, "$$EQUAL$$", "=")
-		valueEntries := strings.Split(values, "|")
-		for j, value := range valueEntries {
-			valueEntries[j] = strings.ReplaceAll(value, "$$PIPE$$", "|")
-		}
-		sigolo.Tracef("Found key=%s with %d values", key, len(valueEntries))
+// loadUsers reads the users file, s. readUsers. Nil is returned, when the file doesn't exist.
+func loadUsers(baseFolder string) ([]string, error) {
+	usersFilename := path.Join(baseFolder, TagIndexUsersFilename)
+	usersBytes, err := readIndexFile(usersFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		sigolo.Debugf("Users file %s does not exist, the index contains no metadata", usersFilename)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read users file %s", usersFilename)
+	}
 
-		keyMap = append(keyMap, key)
-		valueMap = append(valueMap, valueEntries)
+	userMap, err := readUsers(usersBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse users file %s", usersFilename)
+	}
 
-		lineCounter++
-		nextLinePartBytes, isPrefix, err = reader.ReadLine()
+	return userMap, nil
+}
+
+// loadValueCounts reads the counts file, which contains one line per key with the "|"-separated counts of its values.
+// Nil is returned, when the file doesn't exist.
+func loadValueCounts(baseFolder string, valueMap [][]string) ([][]int, error) {
+	countsFilename := path.Join(baseFolder, TagIndexCountsFilename)
+	countsBytes, err := readIndexFile(countsFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		sigolo.Debugf("Tag counts file %s does not exist, tag counts are not available", countsFilename)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read tag counts file %s", countsFilename)
 	}
 
-	index := &TagIndex{
-		BaseFolder: path.Base(baseFolder),
-		keyMap:     keyMap,
-		valueMap:   valueMap,
+	var lines []string
+	if len(countsBytes) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(countsBytes), "\n"), "\n")
+	}
+	if len(lines) != len(valueMap) {
+		return nil, errors.Errorf("Tag counts file %s contains %d keys but the tag-index contains %d keys", countsFilename, len(lines), len(valueMap))
 	}
 
-	return index, nil
+	valueCounts := make([][]int, len(lines))
+	for keyIndex, line := range lines {
+		countStrings := strings.Split(line, "|")
+		if len(countStrings) != len(valueMap[keyIndex]) {
+			return nil, errors.Errorf("Tag counts file %s contains %d counts for key %d but the tag-index contains %d values", countsFilename, len(countStrings), keyIndex, len(valueMap[keyIndex]))
+		}
+
+		valueCounts[keyIndex] = make([]int, len(countStrings))
+		for valueIndex, countString := range countStrings {
+			valueCounts[keyIndex][valueIndex], err = strconv.Atoi(countString)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid count in line %d of tag counts file %s", keyIndex, countsFilename)
+			}
+		}
+	}
+
+	return valueCounts, nil
 }
 
 func NewTagIndex(keyMap []string, valueMap [][]string) *TagIndex {
@@ -194,6 +281,58 @@ func (i *TagIndex) GetKeyIndexFromKeyString(key string) int {
 	return NotFound
 }
 
+// GetKeyIndicesByPrefix returns the ascending indices of all keys starting with the given prefix (case-sensitive), e.g.
+// the indices of "addr:city" and "addr:street" for "addr:".
+func (i *TagIndex) GetKeyIndicesByPrefix(prefix string) []int {
+	var keyIndices []int
+	for idx, k := range i.keyMap {
+		if strings.HasPrefix(k, prefix) {
+			keyIndices = append(keyIndices, idx)
+		}
+	}
+	return keyIndices
+}
+
+// GetValueIndicesByPattern returns the ascending indices of all values of the given key matching the glob pattern, in
+// which "*" stands for any sequence of characters (e.g. "Super*" matches "Supermarket" and "Super"). The matching is
+// case-sensitive.
+func (i *TagIndex) GetValueIndicesByPattern(key int, pattern string) []int {
+	if key < 0 || key >= len(i.valueMap) {
+		return nil
+	}
+
+	var valueIndices []int
+	for idx, v := range i.valueMap[key] {
+		if matchesGlob(pattern, v) {
+			valueIndices = append(valueIndices, idx)
+		}
+	}
+	return valueIndices
+}
+
+// matchesGlob returns true when the value matches the pattern, in which "*" stands for any sequence of characters.
+func matchesGlob(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	// The first part must be a prefix and the last one a suffix, all others must occur in between in the given order.
+	first, last := parts[0], parts[len(parts)-1]
+	if len(value) < len(first)+len(last) || !strings.HasPrefix(value, first) || !strings.HasSuffix(value, last) {
+		return false
+	}
+	value = value[len(first) : len(value)-len(last)]
+	for _, part := range parts[1 : len(parts)-1] {
+		partIndex := strings.Index(value, part)
+		if partIndex == -1 {
+			return false
+		}
+		value = value[partIndex+len(part):]
+	}
+	return true
+}
+
 func (i *TagIndex) GetIndicesFromKeyValueStrings(key string, value string) (int, int) {
 	keyIndex := i.GetKeyIndexFromKeyString(key)
 	if keyIndex == NotFound {
@@ -211,10 +350,10 @@ func (i *TagIndex) GetIndicesFromKeyValueStrings(key string, value string) (int,
 // GetNextLowerValueIndexForKey returns the next smaller value for the given key-index and value. A return value of -1
 // means, that the given value is lower than the lowest value for the given key. The boolean is set to "false" when a
 // smaller value has been found. If the exact value exists, then the exact value will be returned with the boolean set
-// to "true".
+// to "true". Numbers in a different notation (e.g. "2.0" for the existing value "2") count as exact value.
 func (i *TagIndex) GetNextLowerValueIndexForKey(key int, value string) (int, bool) {
 	for idx, v := range i.valueMap[key] {
-		if v == value {
+		if v == value || common.IsNumericallyEqual(v, value) {
 			return idx, true
 		}
 		if common.IsLessThan(value, v) {
@@ -229,6 +368,33 @@ func (i *TagIndex) GetNextLowerValueIndexForKey(key int, value string) (int, boo
 	return len(i.valueMap[key]) - 1, false
 }
 
+// GetValuesForKey returns all value strings of the given key index.
+func (i *TagIndex) GetValuesForKey(key int) []string {
+	return i.valueMap[key]
+}
+
+// HasValueCounts returns false for indices created before the number of objects per tag has been stored.
+func (i *TagIndex) HasValueCounts() bool {
+	return i.valueCounts != nil
+}
+
+// GetValueCount returns the number of OSM objects having the given tag. This is always 0 when HasValueCounts is false.
+func (i *TagIndex) GetValueCount(key int, value int) int {
+	if key >= len(i.valueCounts) || value >= len(i.valueCounts[key]) {
+		return 0
+	}
+	return i.valueCounts[key][value]
+}
+
+// getKeyCount returns the number of OSM objects with the given key. Always 0 when the tag-index has no counts.
+func (i *TagIndex) getKeyCount(key int) int {
+	count := 0
+	for value := range i.valueMap[key] {
+		count += i.GetValueCount(key, value)
+	}
+	return count
+}
+
 // GetKeyFromIndex returns the string representation of the given key index.
 func (i *TagIndex) GetKeyFromIndex(key int) string {
 	return i.keyMap[key]
@@ -246,6 +412,43 @@ func (i *TagIndex) GetValueForKey(key int, value int) string {
 	return valueMap[value]
 }
 
+// HasUsers returns false when the index contains no metadata and therefore no users.
+func (i *TagIndex) HasUsers() bool {
+	return i != nil && i.userMap != nil
+}
+
+// GetUserIndex returns the numerical representation of the given user name and "NotFound" if the user doesn't exist.
+func (i *TagIndex) GetUserIndex(user string) int {
+	userIndex, found := slices.BinarySearch(i.userMap, user)
+	if !found {
+		return NotFound
+	}
+	return userIndex
+}
+
+// GetUserFromIndex returns the name of the given user index and "" if the user doesn't exist.
+func (i *TagIndex) GetUserFromIndex(user int) string {
+	if user < 0 || user >= len(i.userMap) {
+		return ""
+	}
+	return i.userMap[user]
+}
+
+// EncodeMetadata returns the metadata with the given changeset and user name or nil when the index contains no
+// metadata.
+func (i *TagIndex) EncodeMetadata(changeset osm.ChangesetID, user string) *feature.Metadata {
+	if !i.HasUsers() {
+		return nil
+	}
+	return &feature.Metadata{Changeset: uint64(changeset), User: i.GetUserIndex(user)}
+}
+
+// SetUsers sets the user dictionary, which is sorted by this function.
+func (i *TagIndex) SetUsers(userMap []string) {
+	slices.Sort(userMap)
+	i.userMap = userMap
+}
+
 // NewTempEncodedValueArray creates a new int array, which is used as temporary storage during the EncodeTags function.
 // Creating this array manually is a performance enhancement, since it can be reused.
 func (i *TagIndex) NewTempEncodedValueArray() []int {
@@ -273,8 +476,8 @@ func (i *TagIndex) EncodeTags(tags osm.Tags) ([]int, []int) {
 	return encodedKeys, encodedValues
 }
 
-func (i *TagIndex) SaveToFile(filename string) error {
-	err := os.RemoveAll(i.BaseFolder)
+func (i *TagIndex) SaveToFile(filename string) (err error) {
+	err = os.RemoveAll(i.BaseFolder)
 	if err != nil {
 		return errors.Wrapf(err, "Unable to remove tag-index base folder %s", i.BaseFolder)
 	}
@@ -286,24 +489,89 @@ func (i *TagIndex) SaveToFile(filename string) error {
 
 	filepath := path.Join(i.BaseFolder, filename)
 	f, err := os.Create(filepath)
-	sigolo.FatalCheck(err)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create tag-index store %s", filepath)
+	}
 
 	defer func() {
 		sigolo.Tracef("Flush tag-index file %s to disk", filepath)
-		err = f.Close()
-		sigolo.FatalCheck(errors.Wrapf(err, "Unable to close file handle for tag-index store %s", filepath))
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			err = errors.Wrapf(closeErr, "Unable to close file handle for tag-index store %s", filepath)
+		}
 	}()
 
 	sigolo.Debugf("Write tag-index to %s", filepath)
-	return i.WriteAsString(f)
+	err = writeTagIndexBinary(f, i.keyMap, i.valueMap)
+	if err != nil {
+		return err
+	}
+
+	err = i.saveValueCounts()
+	if err != nil {
+		return err
+	}
+
+	return i.saveUsers()
+}
+
+func (i *TagIndex) saveValueCounts() error {
+	if i.valueCounts == nil {
+		return nil
+	}
+
+	countsFilename := path.Join(i.BaseFolder, TagIndexCountsFilename)
+	sigolo.Debugf("Write tag counts to %s", countsFilename)
+
+	buffer := bytes.NewBuffer([]byte{})
+	for _, counts := range i.valueCounts {
+		for valueIndex, count := range counts {
+			if valueIndex > 0 {
+				buffer.WriteString("|")
+			}
+			buffer.WriteString(strconv.Itoa(count))
+		}
+		buffer.WriteString("\n")
+	}
+
+	err := os.WriteFile(countsFilename, buffer.Bytes(), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write tag counts file %s", countsFilename)
+	}
+
+	return nil
+}
+
+func (i *TagIndex) saveUsers() error {
+	if i.userMap == nil {
+		return nil
+	}
+
+	usersFilename := path.Join(i.BaseFolder, TagIndexUsersFilename)
+	sigolo.Debugf("Write %d users to %s", len(i.userMap), usersFilename)
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := writeUsersBinary(buffer, i.userMap)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(usersFilename, buffer.Bytes(), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write users file %s", usersFilename)
+	}
+
+	return nil
 }
 
+// WriteAsString writes the tag-index in the human-readable text format, s. readTagIndexText.
 func (i *TagIndex) WriteAsString(f io.Writer) error {
 	for keyIndex, values := range i.valueMap {
+		escapedValues := make([]string, len(values))
 		for j, value := range values {
-			values[j] = strings.ReplaceAll(value, "|", "$$PIPE$$")
+			escapedValues[j] = strings.ReplaceAll(value, "|", "$$PIPE$$")
 		}
-		valueString := strings.Join(values, "|")
+		valueString := strings.Join(escapedValues, "|")
 		valueString = strings.ReplaceAll(valueString, "\n", "$$NEWLINE$$")
 		valueString = strings.ReplaceAll(valueString, "=", "$$EQUAL$$")
 
@@ -0,0 +1,244 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// Start of binary tag-index files. Text files (the format used before) start with the first key, which never contains a
+// zero byte, so both formats can be distinguished by the first bytes.
+const tagIndexBinaryMagic = "\x00soq-tags\x01"
+
+// Start of binary users files, s. writeUsersBinary. Users files without it contain one user name per line.
+const usersBinaryMagic = "\x00soq-users\x01"
+
+// writeTagIndexBinary writes the keys and values in the binary format: The magic bytes are followed by the number of
+// keys and then, for each key, the length-prefixed key, the number of values and the length-prefixed values. All
+// numbers are unsigned varints. Keys and values are stored as they are, so no escaping is needed.
+func writeTagIndexBinary(w io.Writer, keyMap []string, valueMap [][]string) error {
+	writer := newBinaryWriter(w)
+
+	writer.writer.WriteString(tagIndexBinaryMagic)
+	writer.writeNumber(len(keyMap))
+	for keyIndex, key := range keyMap {
+		writer.writeString(key)
+		writer.writeNumber(len(valueMap[keyIndex]))
+		for _, value := range valueMap[keyIndex] {
+			writer.writeString(value)
+		}
+	}
+
+	// Errors of the buffered writer are sticky, so checking the flush is sufficient.
+	err := writer.writer.Flush()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write to tag-index store %s", TagIndexFilename)
+	}
+	return nil
+}
+
+// writeUsersBinary writes the user names like the keys of the tag-index: The magic bytes are followed by the number of
+// users and the length-prefixed user names. User names are arbitrary strings, so they're not escaped.
+func writeUsersBinary(w io.Writer, users []string) error {
+	writer := newBinaryWriter(w)
+
+	writer.writer.WriteString(usersBinaryMagic)
+	writer.writeNumber(len(users))
+	for _, user := range users {
+		writer.writeString(user)
+	}
+
+	err := writer.writer.Flush()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write to users file %s", TagIndexUsersFilename)
+	}
+	return nil
+}
+
+// readTagIndex parses the content of a tag-index file in the binary or (for indices created before the binary format
+// existed) the text format.
+func readTagIndex(data []byte) ([]string, [][]string, error) {
+	if bytes.HasPrefix(data, []byte(tagIndexBinaryMagic)) {
+		return readTagIndexBinary(data[len(tagIndexBinaryMagic):])
+	}
+	sigolo.Debug("Tag-index is stored in the text format")
+	return readTagIndexText(data)
+}
+
+func readTagIndexBinary(data []byte) ([]string, [][]string, error) {
+	reader := &binaryReader{data: data, offset: len(tagIndexBinaryMagic), name: "tag-index"}
+
+	numberOfKeys, err := reader.readNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyMap := make([]string, numberOfKeys)
+	valueMap := make([][]string, numberOfKeys)
+	for keyIndex := range keyMap {
+		keyMap[keyIndex], err = reader.readString()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		numberOfValues, err := reader.readNumber()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		valueMap[keyIndex] = make([]string, numberOfValues)
+		for valueIndex := range valueMap[keyIndex] {
+			valueMap[keyIndex][valueIndex], err = reader.readString()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		sigolo.Tracef("Found key=%s with %d values", keyMap[keyIndex], numberOfValues)
+	}
+
+	if reader.pos != len(data) {
+		return nil, nil, errors.Errorf("Unexpected %d bytes after the last key of the tag-index", len(data)-reader.pos)
+	}
+
+	return keyMap, valueMap, nil
+}
+
+// readUsers parses the content of a users file in the binary format (s. writeUsersBinary) or the older text format
+// with one user name per line.
+func readUsers(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(data, []byte(usersBinaryMagic)) {
+		sigolo.Debug("Users are stored in the text format")
+		users := []string{}
+		if len(data) > 0 {
+			users = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		}
+		for i, user := range users {
+			users[i] = strings.ReplaceAll(user, "$$NEWLINE$$", "\n")
+		}
+		return users, nil
+	}
+
+	reader := &binaryReader{data: data[len(usersBinaryMagic):], offset: len(usersBinaryMagic), name: "users file"}
+	numberOfUsers, err := reader.readNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]string, numberOfUsers)
+	for i := range users {
+		users[i], err = reader.readString()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if reader.pos != len(reader.data) {
+		return nil, errors.Errorf("Unexpected %d bytes after the last user of the users file", len(reader.data)-reader.pos)
+	}
+
+	return users, nil
+}
+
+// binaryWriter writes the unsigned varints and length-prefixed strings of the binary tag-index and users files.
+type binaryWriter struct {
+	writer       *bufio.Writer
+	numberBuffer []byte
+}
+
+func newBinaryWriter(w io.Writer) *binaryWriter {
+	return &binaryWriter{writer: bufio.NewWriter(w)}
+}
+
+func (w *binaryWriter) writeNumber(number int) {
+	w.numberBuffer = binary.AppendUvarint(w.numberBuffer[:0], uint64(number))
+	w.writer.Write(w.numberBuffer)
+}
+
+func (w *binaryWriter) writeString(s string) {
+	w.writeNumber(len(s))
+	w.writer.WriteString(s)
+}
+
+// binaryReader reads the data written by a binaryWriter. The offset (e.g. the length of the magic bytes before the data)
+// and the name are only used in error messages.
+type binaryReader struct {
+	data   []byte
+	pos    int
+	offset int
+	name   string
+}
+
+func (r *binaryReader) readNumber() (int, error) {
+	number, bytesRead := binary.Uvarint(r.data[r.pos:])
+	if bytesRead <= 0 {
+		return 0, errors.Errorf("Invalid number at byte %d of %s", r.pos+r.offset, r.name)
+	}
+	r.pos += bytesRead
+	return int(number), nil
+}
+
+func (r *binaryReader) readString() (string, error) {
+	length, err := r.readNumber()
+	if err != nil {
+		return "", err
+	}
+	if r.pos+length > len(r.data) {
+		return "", errors.Errorf("Incomplete string of %d bytes at byte %d of %s", length, r.pos+r.offset, r.name)
+	}
+	s := string(r.data[r.pos : r.pos+length])
+	r.pos += length
+	return s, nil
+}
+
+// readTagIndexText parses the text format, which has one line per key of the form "key=value1|value2|...". Newlines,
+// "=" and "|" within the values are replaced by placeholders.
+func readTagIndexText(data []byte) ([]string, [][]string, error) {
+	var keyMap []string
+	var valueMap [][]string
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	lineCounter := 0
+	nextLinePartBytes, isPrefix, err := reader.ReadLine()
+	for err == nil {
+		lineBytes := make([]byte, len(nextLinePartBytes))
+		copy(lineBytes, nextLinePartBytes)
+
+		// The line might be very long and only the first part is returned. Therefore, we need to collect the rest of the line.
+		for isPrefix && err == nil {
+			nextLinePartBytes, isPrefix, err = reader.ReadLine()
+			lineBytes = append(lineBytes, nextLinePartBytes...)
+		}
+		line := string(lineBytes)
+
+		splitLine := strings.SplitN(line, "=", 2)
+		if len(splitLine) != 2 {
+			lineStart := line
+			if len(lineStart) > 100 {
+				lineStart = lineStart[0:100]
+			}
+			return nil, nil, errors.Errorf("Wrong format of line %d: '=' expected separating key and value list. Start of line was: %s", lineCounter, lineStart)
+		}
+
+		key := splitLine[0]
+		values := splitLine[1]
+		values = strings.ReplaceAll(values, "$$NEWLINE$$", "\n")
+		values = strings.ReplaceAll(values, "$$EQUAL$$", "=")
+		valueEntries := strings.Split(values, "|")
+		for j, value := range valueEntries {
+			valueEntries[j] = strings.ReplaceAll(value, "$$PIPE$$", "|")
+		}
+		sigolo.Tracef("Found key=%s with %d values", key, len(valueEntries))
+
+		keyMap = append(keyMap, key)
+		valueMap = append(valueMap, valueEntries)
+
+		lineCounter++
+		nextLinePartBytes, isPrefix, err = reader.ReadLine()
+	}
+
+	return keyMap, valueMap, nil
+}
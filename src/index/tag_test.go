@@ -1,7 +1,13 @@
 package index
 
 import (
+	"bytes"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"os"
+	"path"
 	"soq/common"
+	"soq/feature"
 	"testing"
 )
 
@@ -84,3 +90,322 @@ func TestTag_GetNextLowerValueIndexForKey_mixedNumbersAndStrings(t *testing.T) {
 	common.AssertEqual(t, 3, valueIndex)
 	common.AssertFalse(t, foundExactValue)
 }
+
+func TestTag_SearchValues(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"bar", "cafe", "fast_food", "internet_cafe", "parking"}})
+	tagIndex.valueCounts = [][]int{{10, 50, 30, 2, 100}}
+
+	// Act
+	typoResults, err := tagIndex.SearchValues("amenity", "Caffe", 10)
+	common.AssertNil(t, err)
+	substringResults, err := tagIndex.SearchValues("amenity", "cafe", 10)
+	common.AssertNil(t, err)
+
+	// Assert
+	common.AssertEqual(t, []ValueSearchResult{
+		{Value: "cafe", Count: 50, Distance: 1},
+	}, typoResults)
+	common.AssertEqual(t, []ValueSearchResult{
+		{Value: "cafe", Count: 50, Distance: 0},
+		{Value: "internet_cafe", Count: 2, Distance: 9},
+	}, substringResults)
+}
+
+func TestTag_SearchValues_sortByCountAndLimit(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"cafe", "cake", "care"}})
+	tagIndex.valueCounts = [][]int{{1, 9, 5}}
+
+	// Act
+	results, err := tagIndex.SearchValues("amenity", "cave", 2)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []ValueSearchResult{
+		{Value: "cake", Count: 9, Distance: 1},
+		{Value: "care", Count: 5, Distance: 1},
+	}, results)
+}
+
+func TestTag_SearchValues_unknownKey(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"highway"}, [][]string{{"primary"}})
+
+	// Act
+	results, err := tagIndex.SearchValues("amenity", "cafe", 10)
+
+	// Assert
+	common.AssertTrue(t, errors.Is(err, ErrUnknownKey))
+	common.AssertNil(t, results)
+}
+
+func TestTag_SearchKeys(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity", "highway", "name"}, [][]string{{"cafe"}, {"primary", "service"}, {"Foo"}})
+	tagIndex.valueCounts = [][]int{{5}, {10, 20}, {7}}
+
+	// Act
+	results := tagIndex.SearchKeys("hihgway", 10)
+
+	// Assert
+	common.AssertEqual(t, []ValueSearchResult{
+		{Value: "highway", Count: 30, Distance: 2},
+	}, results)
+}
+
+func TestTag_LoadTagIndex_missingIndex(t *testing.T) {
+	// Act
+	tagIndex, err := LoadTagIndex(path.Join(t.TempDir(), "foo"))
+
+	// Assert
+	common.AssertTrue(t, errors.Is(err, ErrIndexMissing))
+	common.AssertNil(t, tagIndex)
+}
+
+func TestTag_saveAndLoadValueCounts(t *testing.T) {
+	// Arrange
+	tagIndexCreator := NewTagIndexCreator(false)
+	tagIndexCreator.addTagsToIndex(osm.Tags{{Key: "amenity", Value: "cafe"}, {Key: "name", Value: "Foo"}})
+	tagIndexCreator.addTagsToIndex(osm.Tags{{Key: "amenity", Value: "bar"}})
+	tagIndexCreator.addTagsToIndex(osm.Tags{{Key: "amenity", Value: "cafe"}})
+	err := tagIndexCreator.Done()
+	common.AssertNil(t, err)
+
+	tagIndex := tagIndexCreator.CreateTagIndex()
+	tagIndex.BaseFolder = t.TempDir()
+
+	// Act
+	err = tagIndex.SaveToFile(TagIndexFilename)
+	common.AssertNil(t, err)
+	loadedTagIndex, err := LoadTagIndex(tagIndex.BaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertTrue(t, loadedTagIndex.HasValueCounts())
+	keyIndex, valueIndex := loadedTagIndex.GetIndicesFromKeyValueStrings("amenity", "cafe")
+	common.AssertEqual(t, 2, loadedTagIndex.GetValueCount(keyIndex, valueIndex))
+	keyIndex, valueIndex = loadedTagIndex.GetIndicesFromKeyValueStrings("amenity", "bar")
+	common.AssertEqual(t, 1, loadedTagIndex.GetValueCount(keyIndex, valueIndex))
+	keyIndex, valueIndex = loadedTagIndex.GetIndicesFromKeyValueStrings("name", "Foo")
+	common.AssertEqual(t, 1, loadedTagIndex.GetValueCount(keyIndex, valueIndex))
+}
+
+func TestTag_saveAndLoadSpecialCharacters(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"name", "a=b|c"}, [][]string{{"", "a|b", "x=y", "line\nbreak", "$$PIPE$$"}, {"yes"}})
+	tagIndex.BaseFolder = t.TempDir()
+
+	// Act
+	err := tagIndex.SaveToFile(TagIndexFilename)
+	common.AssertNil(t, err)
+	loadedTagIndex, err := LoadTagIndex(tagIndex.BaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, tagIndex.keyMap, loadedTagIndex.keyMap)
+	common.AssertEqual(t, tagIndex.valueMap, loadedTagIndex.valueMap)
+}
+
+func TestTag_loadTextFormat(t *testing.T) {
+	// Arrange
+	baseFolder := t.TempDir()
+	err := os.WriteFile(path.Join(baseFolder, TagIndexFilename), []byte("amenity=bar|cafe\nname=a$$PIPE$$b|x$$EQUAL$$y|line$$NEWLINE$$break\n"), 0644)
+	common.AssertNil(t, err)
+
+	// Act
+	tagIndex, err := LoadTagIndex(baseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{"amenity", "name"}, tagIndex.keyMap)
+	common.AssertEqual(t, [][]string{{"bar", "cafe"}, {"a|b", "x=y", "line\nbreak"}}, tagIndex.valueMap)
+}
+
+func TestTag_loadTruncatedBinaryFormat(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"bar", "cafe"}})
+	buffer := bytes.NewBuffer([]byte{})
+	err := writeTagIndexBinary(buffer, tagIndex.keyMap, tagIndex.valueMap)
+	common.AssertNil(t, err)
+
+	// Act
+	_, _, err = readTagIndex(buffer.Bytes()[:buffer.Len()-2])
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestTag_GetKeyIndicesByPrefix(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"addr:city", "name", "addr:street", "Addr:foo"}, [][]string{{"Foo"}, {"Bar"}, {"Baz"}, {"x"}})
+
+	// Act
+	keyIndices := tagIndex.GetKeyIndicesByPrefix("addr:")
+	noKeyIndices := tagIndex.GetKeyIndicesByPrefix("foo")
+
+	// Assert
+	common.AssertEqual(t, []int{0, 2}, keyIndices)
+	common.AssertEqual(t, 0, len(noKeyIndices))
+}
+
+func TestTag_GetValueIndicesByPattern(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"name"}, [][]string{{"Bakery", "Super", "Supermarket", "super", "Tiny Supermarket"}})
+
+	for pattern, expectedIndices := range map[string][]int{
+		"Super*":       {1, 2},
+		"*market":      {2, 4},
+		"*Super*":      {1, 2, 4},
+		"S*p*r*t":      {2},
+		"Super":        {1},
+		"*":            {0, 1, 2, 3, 4},
+		"Supermarket*": {2},
+		"Foo*":         nil,
+	} {
+		// Act
+		valueIndices := tagIndex.GetValueIndicesByPattern(0, pattern)
+
+		// Assert
+		common.AssertEqual(t, expectedIndices, valueIndices)
+	}
+
+	common.AssertEqual(t, 0, len(tagIndex.GetValueIndicesByPattern(NotFound, "Super*")))
+}
+
+func TestTag_SearchKeysByPrefix(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"name", "amenity", "Area", "highway"}, [][]string{{"Foo", "Bar"}, {"cafe", "bench"}, {"yes"}, {"primary"}})
+	tagIndex.valueCounts = [][]int{{1, 2}, {5, 10}, {3}, {100}}
+
+	// Act
+	results := tagIndex.SearchKeysByPrefix("A", 10)
+	limitedResults := tagIndex.SearchKeysByPrefix("a", 1)
+	noResults := tagIndex.SearchKeysByPrefix("foo", 10)
+
+	// Assert
+	common.AssertEqual(t, []PrefixSearchResult{
+		{Value: "amenity", Count: 15},
+		{Value: "Area", Count: 3},
+	}, results)
+	common.AssertEqual(t, []PrefixSearchResult{
+		{Value: "amenity", Count: 15},
+	}, limitedResults)
+	common.AssertEqual(t, 0, len(noResults))
+}
+
+func TestTag_SearchValuesByPrefix(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"amenity"}, [][]string{{"bar", "restaurant", "Rescue_station", "fast_food", "rest_area"}})
+	tagIndex.valueCounts = [][]int{{10, 50, 2, 30, 50}}
+
+	// Act
+	results, err := tagIndex.SearchValuesByPrefix("amenity", "rest", 10)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []PrefixSearchResult{
+		{Value: "rest_area", Count: 50},
+		{Value: "restaurant", Count: 50},
+	}, results)
+}
+
+func TestTag_SearchValuesByPrefix_unknownKey(t *testing.T) {
+	// Arrange
+	tagIndex := NewTagIndex([]string{"highway"}, [][]string{{"primary"}})
+
+	// Act
+	_, err := tagIndex.SearchValuesByPrefix("amenity", "rest", 10)
+
+	// Assert
+	common.AssertTrue(t, errors.Is(err, ErrUnknownKey))
+}
+
+func TestTag_saveAndLoadUsers(t *testing.T) {
+	// Arrange
+	tagIndexCreator := NewTagIndexCreator(true)
+	common.AssertNil(t, tagIndexCreator.HandleNode(&osm.Node{ID: 1, User: "Zoe"}))
+	common.AssertNil(t, tagIndexCreator.HandleWay(&osm.Way{ID: 2, User: "Alice"}))
+	common.AssertNil(t, tagIndexCreator.HandleRelation(&osm.Relation{ID: 3, User: "Zoe"}))
+	common.AssertNil(t, tagIndexCreator.Done())
+
+	tagIndex := tagIndexCreator.CreateTagIndex()
+	tagIndex.BaseFolder = t.TempDir()
+
+	// Act
+	err := tagIndex.SaveToFile(TagIndexFilename)
+	common.AssertNil(t, err)
+	loadedTagIndex, err := LoadTagIndex(tagIndex.BaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertTrue(t, loadedTagIndex.HasUsers())
+	common.AssertEqual(t, 0, loadedTagIndex.GetUserIndex("Alice"))
+	common.AssertEqual(t, 1, loadedTagIndex.GetUserIndex("Zoe"))
+	common.AssertEqual(t, NotFound, loadedTagIndex.GetUserIndex("Bob"))
+	common.AssertEqual(t, "Zoe", loadedTagIndex.GetUserFromIndex(1))
+	common.AssertEqual(t, &feature.Metadata{Changeset: 42, User: 1}, loadedTagIndex.EncodeMetadata(42, "Zoe"))
+}
+
+func TestTag_saveAndLoadUsersWithSpecialCharacters(t *testing.T) {
+	// Arrange
+	tagIndexCreator := NewTagIndexCreator(true)
+	common.AssertNil(t, tagIndexCreator.HandleNode(&osm.Node{ID: 1, User: "multi\nline"}))
+	common.AssertNil(t, tagIndexCreator.HandleWay(&osm.Way{ID: 2, User: "$$NEWLINE$$"}))
+	common.AssertNil(t, tagIndexCreator.HandleRelation(&osm.Relation{ID: 3, User: ""}))
+	common.AssertNil(t, tagIndexCreator.Done())
+
+	tagIndex := tagIndexCreator.CreateTagIndex()
+	tagIndex.BaseFolder = t.TempDir()
+
+	// Act
+	err := tagIndex.SaveToFile(TagIndexFilename)
+	common.AssertNil(t, err)
+	loadedTagIndex, err := LoadTagIndex(tagIndex.BaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, tagIndex.userMap, loadedTagIndex.userMap)
+	common.AssertEqual(t, "multi\nline", loadedTagIndex.GetUserFromIndex(loadedTagIndex.GetUserIndex("multi\nline")))
+	common.AssertEqual(t, "$$NEWLINE$$", loadedTagIndex.GetUserFromIndex(loadedTagIndex.GetUserIndex("$$NEWLINE$$")))
+}
+
+func TestTag_readUsers_textFormat(t *testing.T) {
+	// Act
+	users, err := readUsers([]byte("Alice\nmulti$$NEWLINE$$line\n"))
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{"Alice", "multi\nline"}, users)
+}
+
+func TestTag_readUsers_incompleteBinaryFormat(t *testing.T) {
+	// Arrange
+	buffer := bytes.NewBuffer([]byte{})
+	common.AssertNil(t, writeUsersBinary(buffer, []string{"Alice", "Zoe"}))
+	data := buffer.Bytes()
+
+	// Act
+	_, err := readUsers(data[:len(data)-1])
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestTag_withoutUsers(t *testing.T) {
+	// Arrange
+	tagIndexCreator := NewTagIndexCreator(false)
+	common.AssertNil(t, tagIndexCreator.HandleNode(&osm.Node{ID: 1, User: "Zoe"}))
+	tagIndex := tagIndexCreator.CreateTagIndex()
+	tagIndex.BaseFolder = t.TempDir()
+
+	// Act
+	err := tagIndex.SaveToFile(TagIndexFilename)
+	common.AssertNil(t, err)
+	loadedTagIndex, err := LoadTagIndex(tagIndex.BaseFolder)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertFalse(t, loadedTagIndex.HasUsers())
+	common.AssertNil(t, loadedTagIndex.EncodeMetadata(42, "Zoe"))
+}
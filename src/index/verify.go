@@ -0,0 +1,222 @@
+package index
+
+import (
+	"encoding/binary"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/common"
+	"soq/encoding"
+	ownOsm "soq/osm"
+	"strconv"
+	"strings"
+)
+
+const QuarantineFolder = "quarantine"
+
+// CellVerificationResult contains the result of the verification of one cell file.
+type CellVerificationResult struct {
+	ObjectType       ownOsm.OsmObjectType
+	Cell             common.CellIndex
+	Filename         string
+	NumberOfFeatures int
+	Error            error // nil when the cell is valid
+}
+
+// VerificationReport summarizes the verification of the whole grid index.
+type VerificationReport struct {
+	CheckedCells    int
+	CheckedFeatures int
+	CorruptCells    []CellVerificationResult
+}
+
+// Verify checks every cell file of the grid index. The structure of each cell file is checked (i.e. whether all
+// records are complete) and each feature is validated against the tag index. Corrupt cells are collected in the
+// returned report. When quarantine is true, corrupt cell files are moved into the quarantine folder next to the grid
+// index so that they're not read by queries anymore.
+func (g *GridIndexReader) Verify(quarantine bool) (*VerificationReport, error) {
+	report := &VerificationReport{}
+
+	for _, objectType := range []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjRelation} {
+		cells, err := g.getExistingCells(objectType)
+		if err != nil {
+			return nil, err
+		}
+
+		sigolo.Infof("Verify %d %s cells", len(cells), objectType.String())
+
+		for _, cell := range cells {
+			result := g.verifyCell(cell, objectType)
+			report.CheckedCells++
+			report.CheckedFeatures += result.NumberOfFeatures
+
+			if result.Error == nil {
+				continue
+			}
+
+			sigolo.Errorf("Corrupt %s cell %v: %s", objectType.String(), cell, result.Error.Error())
+			report.CorruptCells = append(report.CorruptCells, result)
+
+			if quarantine {
+				err = g.quarantineCell(result.Filename, cell, objectType)
+				if err != nil {
+					return report, err
+				}
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// getExistingCells returns the indices of all cell files of the given object type that exist on disk.
+func (g *GridIndexReader) getExistingCells(objectType ownOsm.OsmObjectType) ([]common.CellIndex, error) {
+	objectTypeFolder := path.Join(g.BaseFolder, objectType.String())
+
+	columnEntries, err := os.ReadDir(objectTypeFolder)
+	if errors.Is(err, os.ErrNotExist) {
+		sigolo.Debugf("Folder %s does not exist, there are no %s cells", objectTypeFolder, objectType.String())
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read folder %s", objectTypeFolder)
+	}
+
+	var cells []common.CellIndex
+	for _, columnEntry := range columnEntries {
+		cellX, err := strconv.Atoi(columnEntry.Name())
+		if !columnEntry.IsDir() || err != nil {
+			sigolo.Warnf("Unexpected entry %s in folder %s", columnEntry.Name(), objectTypeFolder)
+			continue
+		}
+
+		columnFolder := path.Join(objectTypeFolder, columnEntry.Name())
+		cellEntries, err := os.ReadDir(columnFolder)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read folder %s", columnFolder)
+		}
+
+		for _, cellEntry := range cellEntries {
+			if strings.HasSuffix(cellEntry.Name(), ".cell") && strings.Contains(strings.TrimPrefix(cellEntry.Name(), "-"), "-") {
+				// Sub-cell files belong to the cell of the split file next to them.
+				continue
+			}
+
+			cellY, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(cellEntry.Name(), ".cell"), CellSplitFileExtension))
+			if cellEntry.IsDir() || !strings.HasSuffix(cellEntry.Name(), ".cell") && !strings.HasSuffix(cellEntry.Name(), CellSplitFileExtension) || err != nil {
+				sigolo.Warnf("Unexpected entry %s in folder %s", cellEntry.Name(), columnFolder)
+				continue
+			}
+			cells = append(cells, common.CellIndex{cellX, cellY})
+		}
+	}
+
+	return cells, nil
+}
+
+func (g *GridIndexReader) verifyCell(cell common.CellIndex, objectType ownOsm.OsmObjectType) CellVerificationResult {
+	result := CellVerificationResult{
+		ObjectType: objectType,
+		Cell:       cell,
+		Filename:   getCellFileName(g.BaseFolder, cell.X(), cell.Y(), objectType),
+	}
+
+	cellFileNames, err := g.getCellFileNames(cell.X(), cell.Y(), objectType, nil)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	// Split cells consist of multiple sub-cell files, the first corrupt one is reported.
+	for _, cellFileName := range cellFileNames {
+		result.Filename = cellFileName
+
+		sigolo.Debugf("Verify cell file %s", cellFileName)
+		data, err := os.ReadFile(cellFileName)
+		if err != nil {
+			result.Error = errors.Wrapf(err, "Unable to read cell file %s", cellFileName)
+			return result
+		}
+
+		// The structure must be checked before decoding the features, since the decoding functions assume complete records.
+		err = verifyCellDataStructure(data, objectType)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		for _, encodedFeature := range g.readFeaturesFromCellData(data, objectType, nil, nil, nil) {
+			if encodedFeature == nil {
+				continue
+			}
+
+			result.NumberOfFeatures++
+
+			err = g.validateFeature(encodedFeature)
+			if err != nil {
+				result.Error = err
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// verifyCellDataStructure walks through all records of the given cell data and checks whether each record is
+// complete. See the encoding package for the format of each object type.
+func verifyCellDataStructure(data []byte, objectType ownOsm.OsmObjectType) error {
+	for pos := 0; pos < len(data); {
+		var headerBytesCount int
+		var recordSize func() int
+
+		switch objectType {
+		case ownOsm.OsmObjNode:
+			headerBytesCount = encoding.NodeHeaderBytes
+			recordSize = encoding.NodeRecord(data[pos:]).Size
+		case ownOsm.OsmObjWay:
+			headerBytesCount = encoding.WayHeaderBytes
+			recordSize = encoding.WayRecord(data[pos:]).Size
+		case ownOsm.OsmObjRelation:
+			headerBytesCount = encoding.RelationHeaderBytes
+			recordSize = encoding.RelationRecord(data[pos:]).Size
+		default:
+			return errors.Errorf("Unsupported object type %s to verify", objectType.String())
+		}
+
+		if pos+headerBytesCount > len(data) {
+			return errors.Errorf("Incomplete %s header at byte %d of %d", objectType.String(), pos, len(data))
+		}
+
+		recordBytesCount := recordSize()
+		if pos+recordBytesCount > len(data) {
+			osmId := binary.LittleEndian.Uint64(data[pos:])
+			return errors.Errorf("Incomplete %s record %d at byte %d: Expected %d bytes but only %d are left", objectType.String(), osmId, pos, recordBytesCount, len(data)-pos)
+		}
+
+		pos += recordBytesCount
+	}
+
+	return nil
+}
+
+// quarantineCell moves the given (sub-)cell file into the quarantine folder, which is located next to the grid index
+// folder.
+func (g *GridIndexReader) quarantineCell(cellFileName string, cell common.CellIndex, objectType ownOsm.OsmObjectType) error {
+	quarantineCellFolder := path.Join(path.Dir(g.BaseFolder), QuarantineFolder, objectType.String(), strconv.Itoa(cell.X()))
+	quarantineCellFileName := path.Join(quarantineCellFolder, path.Base(cellFileName))
+
+	err := os.MkdirAll(quarantineCellFolder, os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create quarantine folder %s", quarantineCellFolder)
+	}
+
+	err = os.Rename(cellFileName, quarantineCellFileName)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to move cell file %s into quarantine folder %s", cellFileName, quarantineCellFolder)
+	}
+
+	sigolo.Infof("Moved corrupt cell file %s to %s", cellFileName, quarantineCellFileName)
+
+	return nil
+}
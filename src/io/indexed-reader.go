@@ -29,11 +29,16 @@ func NewIndexReader(file *os.File) *IndexedReader {
 }
 
 func (r *IndexedReader) read(at int64, length int) ([]byte, error) {
-	// TODO handle length > buffer size
 	// TODO handle other overlap situations (i.e. at+length < buffer start etc.)
 	bufferEnd := r.offsetInFile + r.bufferLength
 	// If requested data is (partially) outside buffer -> refetch data
 	if at+int64(length) >= bufferEnd || at > bufferEnd {
+		// Grow buffer when the requested data wouldn't fit into it, e.g. for very large records
+		if length > len(r.buffer) {
+			sigolo.Debugf("Resize reader buffer from %d to %d", len(r.buffer), length)
+			r.buffer = make([]byte, length)
+		}
+
 		// Reset buffer to not contain outdated data
 		for i := 0; i < len(r.buffer); i++ {
 			r.buffer[i] = 0
@@ -60,10 +65,10 @@ func (r *IndexedReader) read(at int64, length int) ([]byte, error) {
 	return r.buffer[at-r.offsetInFile : at+int64(length)-r.offsetInFile], nil
 }
 
-func (r *IndexedReader) Read(at int64, length int) []byte {
-	data, err := r.read(at, length)
-	sigolo.FatalCheck(err)
-	return data
+// Read returns the given number of bytes starting at the given position. The returned slice is only valid until the
+// next read.
+func (r *IndexedReader) Read(at int64, length int) ([]byte, error) {
+	return r.read(at, length)
 }
 
 func (r *IndexedReader) Has(at int64) bool {
@@ -71,44 +76,55 @@ func (r *IndexedReader) Has(at int64) bool {
 	return err == nil && at < r.offsetInFile+r.bufferLength
 }
 
-func (r *IndexedReader) Uint64(at int64) uint64 {
+func (r *IndexedReader) Uint64(at int64) (uint64, error) {
 	data, err := r.read(at, 8)
-	sigolo.FatalCheck(err)
-	return binary.LittleEndian.Uint64(data)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(data), nil
 }
 
-func (r *IndexedReader) Uint32(at int64) uint32 {
+func (r *IndexedReader) Uint32(at int64) (uint32, error) {
 	data, err := r.read(at, 4)
-	sigolo.FatalCheck(err)
-	return binary.LittleEndian.Uint32(data)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(data), nil
 }
 
-func (r *IndexedReader) Uint16(at int64) uint16 {
+func (r *IndexedReader) Uint16(at int64) (uint16, error) {
 	data, err := r.read(at, 2)
-	sigolo.FatalCheck(err)
-	return binary.LittleEndian.Uint16(data)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(data), nil
 }
 
 // IntFromUint32 returns a 32-bit long integer from a uint32 value. It's basically a type cast on most systems.
-func (r *IndexedReader) IntFromUint32(at int64) int {
-	return int(r.Uint32(at))
+func (r *IndexedReader) IntFromUint32(at int64) (int, error) {
+	value, err := r.Uint32(at)
+	return int(value), err
 }
 
 // IntFromUint24 returns a 32-bit long integer from a 24-bit long part of the reader.
-func (r *IndexedReader) IntFromUint24(at int64) int {
+func (r *IndexedReader) IntFromUint24(at int64) (int, error) {
 	// Remove first byte since in little endian reading, this byte belongs to the next value of the reader and should therefore be skipped.
-	return int(r.Uint32(at)) & 0x00FFFFFF
+	value, err := r.Uint32(at)
+	return int(value) & 0x00FFFFFF, err
 }
 
 // IntFromUint16 returns a 32-bit long integer from a uint16 value. It means, this methods reads 2 bytes and then casts it to a normal int value.
-func (r *IndexedReader) IntFromUint16(at int64) int {
-	return int(r.Uint16(at))
+func (r *IndexedReader) IntFromUint16(at int64) (int, error) {
+	value, err := r.Uint16(at)
+	return int(value), err
 }
 
-func (r *IndexedReader) Int64(at int64) int64 {
-	return int64(r.Uint64(at))
+func (r *IndexedReader) Int64(at int64) (int64, error) {
+	value, err := r.Uint64(at)
+	return int64(value), err
 }
 
-func (r *IndexedReader) Float32(at int64) float32 {
-	return math.Float32frombits(r.Uint32(at))
+func (r *IndexedReader) Float32(at int64) (float32, error) {
+	value, err := r.Uint32(at)
+	return math.Float32frombits(value), err
 }
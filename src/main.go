@@ -1,41 +1,144 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
 	"github.com/alecthomas/kong"
 	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"io"
 	"os"
+	"path"
 	"runtime"
 	"runtime/pprof"
+	"runtime/trace"
+	"soq/common"
+	"soq/encoding"
+	"soq/feature"
+	"soq/federation"
 	"soq/importing"
 	"soq/index"
+	ownOsm "soq/osm"
 	"soq/parser"
+	"soq/query"
 	"soq/web"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const VERSION = "v0.1.0"
 
 var cli struct {
-	Logging              string      `help:"Logging verbosity." enum:"info,debug,trace" short:"l" default:"info"`
-	Version              VersionFlag `help:"Print version information and quit" name:"version" short:"v"`
-	DiagnosticsProfiling bool        `help:"Enable profiling and write results to ./profiling.prof."`
-	Import               struct {
-		Input string `help:"The input file. Either .osm or .osm.pbf." placeholder:"<input-file>" arg:"" type:"existingfile"`
+	Logging                string      `help:"Logging verbosity." enum:"info,debug,trace" short:"l" default:"info"`
+	Version                VersionFlag `help:"Print version information and quit" name:"version" short:"v"`
+	DiagnosticsProfiling   bool        `help:"Enable profiling and write results to ./profiling.prof."`
+	DiagnosticsHeapProfile string      `help:"Write a heap profile with all allocations of the command into this file once the command finished." placeholder:"<file>"`
+	DiagnosticsTrace       string      `help:"Write an execution trace of the command (goroutines, GC, blocking) into this file, s. 'go tool trace'." placeholder:"<file>"`
+	ReaderThreads          int         `help:"Number of goroutines reading cells of the index in parallel during queries." env:"SOQ_READER_THREADS" default:"${readerThreads}"`
+	ImportWorkers          int         `help:"Number of goroutines decoding the OSM input file during the import." env:"SOQ_IMPORT_WORKERS" default:"${importWorkers}"`
+	FilterWorkers          int         `help:"Number of goroutines filtering the read cells in parallel during queries." env:"SOQ_FILTER_WORKERS" default:"${filterWorkers}"`
+	CellCacheSize          int         `help:"Maximum number of cell files kept in memory per loaded index. Preloaded cells (s. 'server --preload') are not counted. The memory of the cached cells is limited by --cache-memory-limit as well." env:"SOQ_CELL_CACHE_SIZE" default:"${cellCacheSize}"`
+	CacheMemoryLimit       int64       `help:"Approximate maximum amount of memory in MB all caches (cell cache and sub-statement caches) may use together. Cache entries are evicted when it's exceeded. 0 means unlimited." env:"SOQ_CACHE_MEMORY_LIMIT" default:"0"`
+	Import                 struct {
+		Input       string `help:"The input file or HTTP(S) URL. Either .osm or .osm.pbf. URLs not ending with .pbf (e.g. of the Overpass API) must return OSM XML." placeholder:"<input-file>" arg:""`
+		DryRun      bool   `help:"Only read the input once and report the number of objects, distinct keys and values, cells and the estimated index size. Nothing is written."`
+		importFlags `embed:""`
 	} `cmd:"" help:"Imports the given OSM file to use it in queries."`
 	Query struct {
-		Query                string `help:"The query string." placeholder:"<query>" arg:""`
-		CheckFeatureValidity bool   `help:"Check the technical validity of each feature. Decreases performance noticeably!"`
+		Query                string            `help:"The query string. Not needed when --query-file is given." placeholder:"<query>" arg:"" optional:""`
+		QueryFile            string            `help:"Read the query from this file instead of the argument. Use '-' to read from stdin." placeholder:"<file>"`
+		Var                  map[string]string `help:"Value of a placeholder of the query, e.g. '--var bbox=9.9,53.5,10.1,53.6' for '{{bbox}}'. Can be given multiple times." placeholder:"<name>=<value>" mapsep:"none"`
+		CheckFeatureValidity bool              `help:"Check the technical validity of each feature. Decreases performance noticeably!"`
+		Strict               bool              `help:"Fail when the query contains keys or values not existing in the index (e.g. typos) instead of only warning about them."`
+		MemoryLimit          int64             `help:"Approximate maximum amount of memory in MB a query may use before it gets aborted. 0 means unlimited." default:"0"`
+		Output               string            `help:"The output file. Use '-' to write to stdout." short:"o" default:"output.geojson"`
+		Format               string            `help:"The output format. 'geojsonseq' writes one GeoJSON feature per line, 'csv' one row per feature with the columns of --columns." enum:"geojson,geojsonseq,csv" default:"geojson"`
+		Columns              []string          `help:"Columns of the CSV output: Tag keys, properties like '@id' and 'geom_wkt' for the geometry as WKT. Defaults to '@type,@id,geom_wkt'." placeholder:"<column>,..."`
+		MemberRoles          bool              `help:"Add the geometries of the node and way members to each relation, grouped by their role."`
+		ResolveMembers       bool              `help:"Write the member ways of each relation as separate features after the relation, with the properties '@relation_id' and '@role'. Makes e.g. route relations visible on a map."`
+		GeometryMetrics      bool              `help:"Add the area in m², the perimeter in m and the centroid to polygonal features."`
+		Timestamp            bool              `help:"Add the time of the version of each feature as '@timestamp' property. Only indices of full-history imports (--history) know this time."`
+		TagKeyPrefix         string            `help:"Prefix of all tag keys in the output, e.g. 'tag:', so that tags can't collide with properties like '@id' and '@type'." placeholder:"<prefix>"`
+		TraceExecution       string            `help:"Write a JSON report with the timings of each statement into this file: Cells enumerated and read, time for decoding and filtering and matched features per cell. Use '-' for stdout." placeholder:"<file>"`
+		AreaTags             string            `help:"JSON file with the tags of closed ways that are written as polygons, e.g. '{\"building\": {}, \"natural\": {\"excludedValues\": [\"coastline\"]}}'. Replaces the built-in table." placeholder:"<json-file>" type:"existingfile"`
+		Batch                string            `help:"Execute all queries of this file (one query per line, lines starting with '//' are ignored) against the same loaded index. Requires --output-dir." placeholder:"<file>" type:"existingfile"`
+		OutputDir            string            `help:"The folder into which the results of the batch queries are written, one file per query (e.g. 'query-001.geojson')." placeholder:"<folder>"`
+		Index                string            `help:"Query this packed index file (s. 'pack') instead of the index folder. HTTP(S) URLs (e.g. of S3 or GCS) are read with range requests." placeholder:"<pack-file>"`
+		IndexCache           string            `help:"Folder in which the files read from a remote --index are cached. Empty disables this cache." default:"index-cache" placeholder:"<folder>"`
 	} `cmd:"" help:"Returns the OSM data for the given query."`
+	Diff struct {
+		IndexA      string `help:"Folder of the old index." placeholder:"<folder>" required:"" type:"existingdir"`
+		IndexB      string `help:"Folder of the new index." placeholder:"<folder>" required:"" type:"existingdir"`
+		Query       string `help:"The query executed on both indices." placeholder:"<query>" required:""`
+		MemoryLimit int64  `help:"Approximate maximum amount of memory in MB the query may use on each index before it gets aborted. 0 means unlimited." default:"0"`
+		Output      string `help:"The JSON file for the report of added, removed and changed objects. Use '-' to write to stdout." short:"o" default:"-"`
+	} `cmd:"" help:"Executes a query on two indices (e.g. of two weekly extracts) and reports the added, removed and changed (by their tags) objects."`
+	SearchValues struct {
+		Key   string `help:"The key whose values should be searched." placeholder:"<key>" arg:""`
+		Value string `help:"The (possibly misspelled) value to search for." placeholder:"<value>" arg:""`
+		Limit int    `help:"Maximum number of values to show." default:"10"`
+	} `cmd:"" help:"Finds values of a key similar to the given value to discover the right tag for a query."`
+	Verify struct {
+		Quarantine bool `help:"Move corrupt cell files into the quarantine folder of the index so that queries don't read them anymore."`
+	} `cmd:"" help:"Checks all cells of the index for technically invalid data."`
+	Pack struct {
+		Output string `help:"The pack file to create, e.g. 'hamburg.soq'." placeholder:"<pack-file>" arg:""`
+	} `cmd:"" help:"Bundles the whole index into one read-only file, which can be queried with 'query --index <pack-file>'."`
+	Inspect struct {
+		ObjectType string    `help:"The type of the feature." enum:"node,way,relation" placeholder:"<object-type>" arg:""`
+		Id         uint64    `help:"The OSM ID of the feature." placeholder:"<id>" arg:""`
+		Bbox       []float64 `help:"Only search the cells within this bbox (min-lon,min-lat,max-lon,max-lat) instead of all cells." placeholder:"<bbox>"`
+	} `cmd:"" help:"Prints the raw encoded records of a feature as hex dump and their decoded content."`
+	BuildRelationGeometries struct {
+		Delay time.Duration `help:"Time to wait after each relation to reduce the load on the machine." default:"0s"`
+	} `cmd:"" help:"Assembles the multipolygons of multipolygon and boundary relations, which only have their bbox as geometry after the import."`
 	Server struct {
-		Port                 string `help:"The port this server should listen to." short:"p"`
-		SslCertFile          string `help:"The certificate file for SSL."`
-		SslKeyFile           string `help:"The key file for SSL."`
-		CheckFeatureValidity bool   `help:"Check the technical validity of each feature. Decreases performance noticeably!"`
+		Port                    string        `help:"The port this server should listen to." short:"p"`
+		SslCertFile             string        `help:"The certificate file for SSL."`
+		SslKeyFile              string        `help:"The key file for SSL."`
+		CheckFeatureValidity    bool          `help:"Check the technical validity of each feature. Decreases performance noticeably!"`
+		MemoryLimit             int64         `help:"Approximate maximum amount of memory in MB a single query may use before it gets aborted. 0 means unlimited." default:"0"`
+		MaxQueryDuration        time.Duration `help:"Maximum execution time of a single query before it gets aborted. 0 means unlimited." default:"0s"`
+		MaxQueryCells           int64         `help:"Maximum number of cells a single query may read (including sub-statements) before it gets aborted. 0 means unlimited." default:"0"`
+		MaxResultFeatures       int64         `help:"Maximum number of features in the result of a single query before it gets aborted. 0 means unlimited." default:"0"`
+		MaxQueryArea            int64         `help:"Maximum number of cells covered by the location of a single query. Larger queries are rejected before reading any cell. 0 means unlimited." default:"0"`
+		QueriesFolder           string        `help:"Folder with stored queries (one query per .soq file), which can be executed by their name." default:"queries"`
+		AllowStoreQueries       bool          `help:"Allow storing queries in the queries folder with PUT requests to /api/queries/<name>. Anyone reaching the server can then store queries that others execute, so only enable this on servers that aren't publicly reachable."`
+		ReloadInterval          time.Duration `help:"Interval in which the server checks for a new index created by an import and changed stored queries and loads them. 0 disables the check." default:"10s"`
+		BuildRelationGeometries bool          `help:"Assemble the multipolygons of relations in the background. Relations returned by queries are built first. The progress is shown at /api/stats."`
+		RelationGeometryDelay   time.Duration `help:"Time to wait after each relation when building relation geometries in the background." default:"10ms"`
+		Preload                 []float64     `help:"Read all cells within this bbox (min-lon,min-lat,max-lon,max-lat) into memory after loading the index, so that queries in this area don't read from disk. The progress is shown at /api/stats." placeholder:"<bbox>"`
+		AccessLog               string        `help:"Write a JSON line for each request (query, duration, result features, cells read, client IP, status) to this file. Use '-' for stdout." placeholder:"<file>"`
+		AccessLogMaxSize        int64         `help:"Size in MB at which the access log file is rotated. 0 disables the rotation." default:"100"`
+		AccessLogMaxBackups     int           `help:"Number of rotated access log files to keep." default:"5"`
+		ReloadEndpoint          bool          `help:"Serve POST /api/reload, which loads the index from disk right away. Anyone reaching the server can trigger a reload, so only enable this on servers that aren't publicly reachable."`
+		ShutdownGracePeriod     time.Duration `help:"Time running requests get to finish when the server receives SIGTERM or SIGINT. Queries still running afterward are cancelled." default:"20s"`
+		Pprof                   bool          `help:"Serve the profiles of the Go profiler (CPU, heap, goroutines, execution trace) at /debug/pprof/. Don't enable this on publicly reachable servers."`
+		Index                   string        `help:"Serve this packed index file (s. 'pack') instead of the index folder. HTTP(S) URLs (e.g. of S3 or GCS) are read with range requests, so stateless servers can share one large index." placeholder:"<pack-file>"`
+		IndexCache              string        `help:"Folder in which the files read from a remote --index are cached. Empty disables this cache." default:"index-cache" placeholder:"<folder>"`
 	} `cmd:"" help:"Returns the OSM data for the given query."`
 }
 
+// importFlags are the options of the import command.
+type importFlags struct {
+	SkipUntaggedNodes   bool   `help:"Do not store untagged nodes as standalone features. They're still part of ways and relations. This reduces the index size but queries can't find untagged nodes anymore."`
+	Name                string `help:"Import into the named index with this name instead of the default index. Named indices can be queried together with 'USING <name>, ...'." placeholder:"<name>"`
+	Durable             bool   `help:"Sync all index files and folders to the storage device (fsync) after each import step. Slower, but a finished import survives crashes and power losses."`
+	Reproducible        bool   `help:"Sort the features of each cell by ID and use the modification time of the input file as creation time, so that identical input files result in byte-identical indices. Slightly slower."`
+	Keep                string `help:"Filter expression (like in queries) of the objects to import, e.g. 'highway=* OR railway=*'. Other objects are not imported, except members of imported relations." placeholder:"<expression>"`
+	ImportClip          string `help:"GeoJSON file with (multi)polygons. Only objects within these polygons are imported, ways and relations crossing the boundary are imported completely." placeholder:"<geojson-file>" type:"existingfile"`
+	DerivedTags         string `help:"JSON file with rules computing additional tags during the import, e.g. '[{\"key\": \"building:levels\", \"derivedKey\": \"levels_numeric\", \"transform\": \"number\"}]'. Transforms: copy, lowercase, number, meters." placeholder:"<json-file>" type:"existingfile"`
+	CellSplitThreshold  int    `help:"Cells with more features of one type are split into quadrants (recursively, up to four times) to read less data in dense areas like city centers. 0 disables splitting." default:"${cellSplitThreshold}"`
+	CellScheme          string `help:"How coordinates are mapped to the cells of the index. 'equal-area' cells cover the same area everywhere, which avoids tiny cells on polar or large-extent data." enum:"latlon,equal-area" default:"latlon"`
+	CoordinatePrecision string `help:"How the coordinates of nodes are stored. 'fixed' (7 decimal places like OSM) has the same size as 'float32' but is more precise, 'float64' needs twice the space." enum:"float32,fixed,float64" default:"float32"`
+	StoreMetadata       bool   `help:"Store the changeset and user of each object, which enables filters like 'user=\"SomeMapper\"' and 'changeset=123'. Increases the index size by 12 bytes per object."`
+	History             bool   `help:"The input is a full-history file (e.g. from planet.openstreetmap.org or osmium). All versions of the objects are stored, which enables queries at a point in time like 'at(\"2020-01-01\") bbox(...)...'."`
+}
+
 var indexBaseFolder = "soq-index"
+var importDownloadFolder = "import-download"
 var defaultCellSize = 0.1
 
 type VersionFlag string
@@ -49,12 +152,29 @@ func (v VersionFlag) BeforeApply(app *kong.Kong, vars kong.Vars) error {
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// errFailureLogged is returned by commands, which already logged why they failed (e.g. failed assertions). Only the exit
+// code is set for it, the error itself is not logged.
+var errFailureLogged = errors.New("Command failed")
+
+// run executes the command given via the CLI arguments and returns the exit code of the process. The diagnostics (CPU
+// and heap profile, execution trace) are written by deferred functions, so nothing in here must call os.Exit or
+// sigolo.Fatal.
+func run() (exitCode int) {
+	defaultSettings := common.DefaultSettings()
 	ctx := kong.Parse(
 		&cli,
 		kong.Name("Simple OSM queries"),
 		kong.Description("A simple tool to query OSM data."),
 		kong.Vars{
-			"version": VERSION,
+			"version":            VERSION,
+			"readerThreads":      strconv.Itoa(defaultSettings.ReaderThreads),
+			"importWorkers":      strconv.Itoa(defaultSettings.ImportWorkers),
+			"filterWorkers":      strconv.Itoa(defaultSettings.FilterWorkers),
+			"cellCacheSize":      strconv.Itoa(defaultSettings.CellCacheSize),
+			"cellSplitThreshold": strconv.Itoa(index.DefaultCellSplitThreshold),
 		},
 	)
 
@@ -67,58 +187,829 @@ func main() {
 		sigolo.SetDefaultFormatFunctionAll(sigolo.LogPlain)
 	} else {
 		sigolo.SetDefaultFormatFunctionAll(sigolo.LogPlain)
-		sigolo.Fatalf("Unknown logging level '%s'", cli.Logging)
+		sigolo.Errorf("Unknown logging level '%s'", cli.Logging)
+		return 1
+	}
+
+	isQueryCommand := ctx.Command() == "query" || ctx.Command() == "query <query>"
+	writesToStdout := (isQueryCommand && (cli.Query.Output == index.StdoutFilename || cli.Query.TraceExecution == index.StdoutFilename)) || (ctx.Command() == "diff" && cli.Diff.Output == index.StdoutFilename)
+	if writesToStdout {
+		// Stdout is reserved for the result (or the trace), so all log messages go to stderr.
+		for _, level := range []sigolo.Level{sigolo.LOG_PLAIN, sigolo.LOG_TRACE, sigolo.LOG_DEBUG, sigolo.LOG_INFO, sigolo.LOG_WARN} {
+			sigolo.SetDefaultLevelString(level, os.Stderr)
+		}
 	}
 
 	if cli.DiagnosticsProfiling {
 		sigolo.Info("Activate CPU profiling")
 
 		f, err := os.Create("profiling.prof")
-		sigolo.FatalCheck(err)
+		if err != nil {
+			sigolo.Stack(err)
+			return 1
+		}
 
 		runtime.SetCPUProfileRate(1000)
 		err = pprof.StartCPUProfile(f)
-		sigolo.FatalCheck(err)
+		if err != nil {
+			sigolo.Stack(err)
+			return 1
+		}
 		defer pprof.StopCPUProfile()
 	}
 
-	switch ctx.Command() {
+	if cli.DiagnosticsTrace != "" {
+		sigolo.Infof("Activate execution trace, write it to %s", cli.DiagnosticsTrace)
+		stopTrace, err := startExecutionTrace(cli.DiagnosticsTrace)
+		if err != nil {
+			sigolo.Stack(err)
+			return 1
+		}
+		defer func() {
+			err := stopTrace()
+			if err != nil {
+				sigolo.Stack(err)
+				exitCode = 1
+			}
+		}()
+	}
+
+	if cli.DiagnosticsHeapProfile != "" {
+		sigolo.Infof("Activate heap profiling, write profile to %s", cli.DiagnosticsHeapProfile)
+		defer func() {
+			err := writeHeapProfile(cli.DiagnosticsHeapProfile)
+			if err != nil {
+				sigolo.Stack(err)
+				exitCode = 1
+			}
+		}()
+	}
+
+	settings := common.Settings{
+		ReaderThreads:    cli.ReaderThreads,
+		ImportWorkers:    cli.ImportWorkers,
+		FilterWorkers:    cli.FilterWorkers,
+		CellCacheSize:    cli.CellCacheSize,
+		MemoryAccountant: common.NewMemoryAccountant(cli.CacheMemoryLimit * 1024 * 1024),
+	}
+	err := settings.Validate()
+	if err == nil {
+		err = runCommand(ctx.Command(), settings)
+	}
+	if err == errFailureLogged {
+		return 1
+	}
+	if err != nil {
+		sigolo.Stack(err)
+		return 1
+	}
+
+	return 0
+}
+
+// runCommand executes the given command of the CLI.
+func runCommand(command string, settings common.Settings) error {
+	var err error
+	switch command {
 	case "import <input>":
-		err := importing.Import(cli.Import.Input, defaultCellSize, defaultCellSize, indexBaseFolder)
-		sigolo.FatalCheck(err)
-	case "query <query>":
+		inputFile := cli.Import.Input
+		if importing.IsUrl(inputFile) {
+			inputFile, err = importing.DownloadInputFile(inputFile, importDownloadFolder)
+			if err != nil {
+				return err
+			}
+		}
+
+		if cli.Import.DryRun {
+			err = estimateImport(inputFile, cli.Import.importFlags, settings)
+		} else {
+			err = importInputFile(inputFile, cli.Import.importFlags, settings)
+		}
+		if err != nil {
+			return err
+		}
+
+		if inputFile != cli.Import.Input {
+			// Downloaded files are only kept after failed imports, so that the next attempt doesn't need to download them again.
+			err = os.Remove(inputFile)
+			if err != nil {
+				return err
+			}
+		}
+	case "query", "query <query>":
+		if cli.Query.Index != "" {
+			err = mountPackedIndex(cli.Query.Index, cli.Query.IndexCache)
+			if err != nil {
+				return err
+			}
+		}
+
+		if cli.Query.Batch != "" {
+			return executeBatchQueries(settings)
+		}
+
+		queryString, err := readQueryString(cli.Query.Query, cli.Query.QueryFile)
+		if err != nil {
+			return err
+		}
+
+		queryString, err = substituteQueryVariables(queryString, cli.Query.Var)
+		if err != nil {
+			return err
+		}
+
+		indexNames, queryString, err := parser.ParseUsingClause(queryString)
+		if err != nil {
+			return err
+		}
+		if len(indexNames) > 0 {
+			return executeFederatedQuery(indexNames, queryString, settings)
+		}
+
+		tagIndex, geometryIndex, err := loadIndex(cli.Query.CheckFeatureValidity, settings)
+		if err != nil {
+			return err
+		}
+
+		q, err := parseQueryString(queryString, tagIndex, geometryIndex)
+		if err != nil {
+			return err
+		}
+		q.SetTracing(cli.Query.TraceExecution != "")
+
+		outputOptions, err := getQueryOutputOptions()
+		if err != nil {
+			return err
+		}
+
+		err = executeQuery(q, geometryIndex, tagIndex, outputOptions, cli.Query.Output, settings)
+		if err != nil {
+			return err
+		}
+
+		if cli.Query.TraceExecution != "" {
+			err = index.WriteJsonToFile(q.GetExecutionTrace(), cli.Query.TraceExecution)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(q.GetFailedAssertions()) > 0 {
+			sigolo.Errorf("%d assertion(s) failed", len(q.GetFailedAssertions()))
+			return errFailureLogged
+		}
+	case "diff":
+		indexA, err := federation.LoadIndex(cli.Diff.IndexA, cli.Diff.IndexA, defaultCellSize, false, settings)
+		if err != nil {
+			return err
+		}
+		indexB, err := federation.LoadIndex(cli.Diff.IndexB, cli.Diff.IndexB, defaultCellSize, false, settings)
+		if err != nil {
+			return err
+		}
+
+		report, err := federation.Diff(cli.Diff.Query, indexA, indexB, cli.Diff.MemoryLimit*1024*1024, settings)
+		if err != nil {
+			return err
+		}
+
+		err = index.WriteJsonToFile(report, cli.Diff.Output)
+		if err != nil {
+			return err
+		}
+	case "search-values <key> <value>":
 		tagIndex, err := index.LoadTagIndex(indexBaseFolder)
-		sigolo.FatalCheck(err)
+		if err != nil {
+			return err
+		}
 
-		geometryIndex := index.LoadGridIndex(indexBaseFolder, defaultCellSize, defaultCellSize, cli.Query.CheckFeatureValidity, tagIndex)
+		results, err := tagIndex.SearchValues(cli.SearchValues.Key, cli.SearchValues.Value, cli.SearchValues.Limit)
+		if err != nil {
+			return err
+		}
 
-		q, err := parser.ParseQueryString(`
-//bbox(9.99549,53.55688,9.99569,53.55701)
-//bbox(9.9713,53.5354,10.01711,53.58268)
-bbox(9.9713,53.5354,10.0160,53.5608)
-.nodes{
-	amenity=*
-	// AND seats=3
-}
-`, tagIndex, geometryIndex)
-		sigolo.FatalCheck(err)
+		if len(results) == 0 {
+			sigolo.Infof("No values similar to '%s' found for key '%s'", cli.SearchValues.Value, cli.SearchValues.Key)
+		}
+		for _, result := range results {
+			if tagIndex.HasValueCounts() {
+				sigolo.Infof("%s=%s (%d objects)", cli.SearchValues.Key, result.Value, result.Count)
+			} else {
+				sigolo.Infof("%s=%s", cli.SearchValues.Key, result.Value)
+			}
+		}
+	case "verify":
+		_, geometryIndex, err := loadIndex(false, settings)
+		if err != nil {
+			return err
+		}
 
-		features, err := q.Execute(geometryIndex)
-		sigolo.FatalCheck(err)
+		report, err := geometryIndex.Verify(cli.Verify.Quarantine)
+		if err != nil {
+			return err
+		}
 
-		sigolo.Infof("Found %d features", len(features))
+		sigolo.Infof("Verified %d features in %d cells", report.CheckedFeatures, report.CheckedCells)
+		if len(report.CorruptCells) > 0 {
+			sigolo.Errorf("Found %d corrupt cells", len(report.CorruptCells))
+			return errFailureLogged
+		}
+		sigolo.Info("No corrupt cells found")
+	case "pack <output>":
+		err = index.PackIndex(indexBaseFolder, cli.Pack.Output)
+		if err != nil {
+			return err
+		}
+	case "inspect <object-type> <id>":
+		return inspectRawRecords(settings)
+	case "build-relation-geometries":
+		_, geometryIndex, err := loadIndex(false, settings)
+		if err != nil {
+			return err
+		}
 
-		err = index.WriteFeaturesAsGeoJsonFile(features, tagIndex)
-		sigolo.FatalCheck(err)
+		err = index.NewRelationGeometryBuilder(geometryIndex, cli.BuildRelationGeometries.Delay).Run(nil)
+		if err != nil {
+			return err
+		}
 	case "server":
 		sigolo.SetDefaultFormatFunctionAll(sigolo.LogDefaultStatic)
 		sigolo.Info("Starting server ...")
-		if cli.Server.SslCertFile != "" && cli.Server.SslKeyFile != "" {
-			web.StartServerTls(cli.Server.Port, cli.Server.SslCertFile, cli.Server.SslKeyFile, indexBaseFolder, defaultCellSize, cli.Server.CheckFeatureValidity)
-		} else {
-			web.StartServer(cli.Server.Port, indexBaseFolder, defaultCellSize, cli.Server.CheckFeatureValidity)
+		if cli.Server.Index != "" {
+			err = mountPackedIndex(cli.Server.Index, cli.Server.IndexCache)
+			if err != nil {
+				return err
+			}
+		}
+		queryLimits := query.Limits{
+			MaxDuration:       cli.Server.MaxQueryDuration,
+			MaxCells:          cli.Server.MaxQueryCells,
+			MaxResultFeatures: cli.Server.MaxResultFeatures,
+			MaxAreaCells:      cli.Server.MaxQueryArea,
+		}
+		preloadBbox, err := getBboxArgument(cli.Server.Preload)
+		if err != nil {
+			return err
 		}
+		web.StartServer(web.ServerOptions{
+			Port:                    cli.Server.Port,
+			CertFile:                cli.Server.SslCertFile,
+			KeyFile:                 cli.Server.SslKeyFile,
+			IndexBaseFolder:         indexBaseFolder,
+			CellSize:                defaultCellSize,
+			CheckFeatureValidity:    cli.Server.CheckFeatureValidity,
+			QueryMemoryLimit:        cli.Server.MemoryLimit * 1024 * 1024,
+			QueryLimits:             queryLimits,
+			QueriesFolder:           cli.Server.QueriesFolder,
+			ReloadInterval:          cli.Server.ReloadInterval,
+			BuildRelationGeometries: cli.Server.BuildRelationGeometries,
+			RelationGeometryDelay:   cli.Server.RelationGeometryDelay,
+			PreloadBbox:             preloadBbox,
+			AccessLog: web.AccessLogOptions{
+				Filename:       cli.Server.AccessLog,
+				MaxSizeInBytes: cli.Server.AccessLogMaxSize * 1024 * 1024,
+				MaxBackups:     cli.Server.AccessLogMaxBackups,
+			},
+			ShutdownGracePeriod: cli.Server.ShutdownGracePeriod,
+			ReloadEndpoint:      cli.Server.ReloadEndpoint,
+			StoreQueries:        cli.Server.AllowStoreQueries,
+			Pprof:               cli.Server.Pprof,
+		}, settings)
 	default:
-		sigolo.Errorf("Unknown command '%s'", ctx.Command())
+		return errors.Errorf("Unknown command '%s'", command)
+	}
+
+	return nil
+}
+
+// loadIndex loads the tag-index and grid-index from the index folder. Both are loaded from the same version of the
+// index, even when an import activates a new version in the meantime.
+func loadIndex(checkFeatureValidity bool, settings common.Settings) (*index.TagIndex, *index.GridIndexReader, error) {
+	indexFolder, err := index.ResolveIndexFolder(indexBaseFolder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tagIndex, err := index.LoadTagIndex(indexFolder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	geometryIndex, err := index.LoadGridIndex(indexFolder, defaultCellSize, defaultCellSize, checkFeatureValidity, tagIndex, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tagIndex, geometryIndex, nil
+}
+
+// mountPackedIndex mounts the given local or remote pack file and uses it as index folder.
+func mountPackedIndex(packFile string, cacheFolder string) error {
+	var err error
+	if importing.IsUrl(packFile) {
+		err = index.MountRemotePackedIndex(packFile, cacheFolder)
+	} else {
+		err = index.MountPackedIndex(packFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	indexBaseFolder = packFile
+	return nil
+}
+
+// importInputFile imports the given local OSM file with the given import options.
+func importInputFile(inputFile string, flags importFlags, settings common.Settings) error {
+	var err error
+	importFolder := indexBaseFolder
+	if flags.Name != "" {
+		importFolder, err = federation.GetNamedIndexFolder(federation.NamedIndicesFolder, flags.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	var clipPolygon orb.MultiPolygon
+	if flags.ImportClip != "" {
+		clipPolygon, err = importing.LoadClipPolygon(flags.ImportClip)
+		if err != nil {
+			return err
+		}
+	}
+
+	var derivedTags importing.DerivedTags
+	if flags.DerivedTags != "" {
+		derivedTags, err = importing.LoadDerivedTags(flags.DerivedTags)
+		if err != nil {
+			return err
+		}
+	}
+
+	cellScheme, err := common.NewCellScheme(flags.CellScheme, defaultCellSize, defaultCellSize)
+	if err != nil {
+		return err
+	}
+	coordinatePrecision, err := encoding.ParseCoordinatePrecision(flags.CoordinatePrecision)
+	if err != nil {
+		return err
+	}
+
+	importOptions := importing.ImportOptions{
+		CellScheme:          cellScheme,
+		CellSplitThreshold:  flags.CellSplitThreshold,
+		CoordinatePrecision: coordinatePrecision,
+		SkipUntaggedNodes:   flags.SkipUntaggedNodes,
+		StoreMetadata:       flags.StoreMetadata,
+		History:             flags.History,
+		Durable:             flags.Durable,
+		Reproducible:        flags.Reproducible,
+		ClipPolygon:         clipPolygon,
+		KeepExpression:      flags.Keep,
+		DerivedTags:         derivedTags,
+	}
+	return importing.Import(inputFile, importFolder, importOptions, settings)
+}
+
+// estimateImport prints the estimated size of the index an import of the given local OSM file would create.
+func estimateImport(inputFile string, flags importFlags, settings common.Settings) error {
+	if flags.Keep != "" || flags.ImportClip != "" || flags.DerivedTags != "" || flags.History {
+		return errors.New("The dry-run reads the input only once and therefore doesn't support --keep, --import-clip, --derived-tags and --history")
+	}
+
+	cellScheme, err := common.NewCellScheme(flags.CellScheme, defaultCellSize, defaultCellSize)
+	if err != nil {
+		return err
+	}
+	coordinatePrecision, err := encoding.ParseCoordinatePrecision(flags.CoordinatePrecision)
+	if err != nil {
+		return err
+	}
+
+	estimate, err := importing.EstimateImport(inputFile, cellScheme, flags.CellSplitThreshold, coordinatePrecision, flags.SkipUntaggedNodes, flags.StoreMetadata, settings)
+	if err != nil {
+		return err
+	}
+
+	sigolo.Infof("Objects: %d nodes (%d tagged), %d ways, %d relations", estimate.Nodes, estimate.TaggedNodes, estimate.Ways, estimate.Relations)
+	sigolo.Infof("Tags: %d distinct keys, %d distinct values", estimate.DistinctKeys, estimate.DistinctValues)
+	sigolo.Infof("Cells: %d cells, at most %d nodes and ways per cell, %d cells above the split threshold", estimate.Cells, estimate.MaxFeaturesPerCell, estimate.CellsAboveSplitThreshold)
+	sigolo.Infof("Estimated index size: %.1f MB (cells: %.1f MB, tag-index: %.1f MB)", float64(estimate.EstimatedIndexBytes)/1024/1024, float64(estimate.EstimatedCellBytes)/1024/1024, float64(estimate.EstimatedTagIndexBytes)/1024/1024)
+	return nil
+}
+
+// readQueryString returns the query of the argument or, when a query file is given, the content of that file. The file
+// "-" stands for stdin.
+func readQueryString(queryArgument string, queryFile string) (string, error) {
+	if queryFile == "" {
+		if queryArgument == "" {
+			return "", errors.New("No query given, either pass it as argument or use --query-file")
+		}
+		return queryArgument, nil
+	}
+	if queryArgument != "" {
+		return "", errors.New("Either pass the query as argument or use --query-file, not both")
+	}
+
+	var queryBytes []byte
+	var err error
+	if queryFile == "-" {
+		queryBytes, err = io.ReadAll(os.Stdin)
+	} else {
+		queryBytes, err = os.ReadFile(queryFile)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to read query file %s", queryFile)
+	}
+
+	return string(queryBytes), nil
+}
+
+// substituteQueryVariables replaces the placeholders of the query by the given variables. Variables without placeholder
+// are an error as well, since they're most likely a typo.
+func substituteQueryVariables(queryString string, variables map[string]string) (string, error) {
+	placeholders, err := parser.GetPlaceholders(queryString)
+	if err != nil {
+		return "", err
+	}
+
+	for name := range variables {
+		if !common.Contains(placeholders, name) {
+			return "", errors.Errorf("Variable '%s' is not used by the query, it contains no placeholder '{{%s}}'", name, name)
+		}
+	}
+
+	return parser.SubstitutePlaceholders(queryString, variables)
+}
+
+// parseQueryString parses the query of the query command, which fails on unknown keys and values with --strict.
+func parseQueryString(queryString string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex) (*query.Query, error) {
+	if cli.Query.Strict {
+		return parser.ParseQueryStringStrict(queryString, tagIndex, geometryIndex)
+	}
+	return parser.ParseQueryString(queryString, tagIndex, geometryIndex)
+}
+
+// executeQuery executes the parsed query and writes its result into the output file. Queries with value statistics or
+// listing keys or values write them as JSON instead of the features.
+func executeQuery(q *query.Query, geometryIndex *index.GridIndexReader, tagIndex *index.TagIndex, outputOptions index.OutputOptions, outputFile string, settings common.Settings) error {
+	q.SetMemoryLimit(cli.Query.MemoryLimit * 1024 * 1024)
+	q.SetFilterWorkers(settings.FilterWorkers)
+	q.SetMemoryAccountant(settings.MemoryAccountant)
+	outputOptions.Warnings = q.GetWarnings
+
+	// Only the warnings of the parser exist before the execution, e.g. about unknown keys.
+	for _, warning := range q.GetWarnings() {
+		sigolo.Warnf("%s", warning)
+	}
+
+	if q.HasStatistics() {
+		_, err := q.Execute(geometryIndex)
+		if err != nil {
+			return err
+		}
+
+		return index.WriteJsonToFile(q.GetStatistics(tagIndex), outputFile)
+	}
+
+	if q.IsIntrospection() {
+		result, err := q.ExecuteIntrospection(tagIndex, geometryIndex)
+		if err != nil {
+			return err
+		}
+
+		return index.WriteJsonToFile(result, outputFile)
+	}
+
+	if cli.Query.MemberRoles || cli.Query.ResolveMembers {
+		// The members are determined for all features at once, so the whole result is needed.
+		features, err := q.Execute(geometryIndex)
+		if err != nil {
+			return err
+		}
+
+		sigolo.Infof("Found %d features", len(features))
+
+		err = addRelationMembersToOutputOptions(&outputOptions, geometryIndex, features)
+		if err != nil {
+			return err
+		}
+
+		return index.WriteFeaturesToFile(features, tagIndex, outputFile, cli.Query.Format, outputOptions)
+	}
+
+	features, err := q.Stream(geometryIndex, query.DefaultResultBufferSize)
+	if err != nil {
+		return err
+	}
+	defer features.Close()
+
+	return index.WriteFeatureIteratorToFile(features, tagIndex, outputFile, cli.Query.Format, outputOptions)
+}
+
+// executeBatchQueries executes all queries of the batch file given via the CLI arguments. The tag index and grid-index
+// are only loaded once, so the cell cache is shared by all queries. A failing query doesn't stop the batch, but the
+// process exits with an error code at the end.
+func executeBatchQueries(settings common.Settings) error {
+	if cli.Query.OutputDir == "" {
+		return errors.New("The --output-dir is required in batch mode")
+	}
+	if cli.Query.Query != "" || cli.Query.QueryFile != "" {
+		return errors.New("Either pass a query, use --query-file or use --batch, not several of them")
+	}
+
+	queryStrings, err := readBatchQueries(cli.Query.Batch)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(cli.Query.OutputDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tagIndex, geometryIndex, err := loadIndex(cli.Query.CheckFeatureValidity, settings)
+	if err != nil {
+		return err
+	}
+
+	outputOptions, err := getQueryOutputOptions()
+	if err != nil {
+		return err
+	}
+
+	failedQueries := 0
+	for i, queryString := range queryStrings {
+		err = executeBatchQuery(i, queryString, geometryIndex, tagIndex, outputOptions, settings)
+		if err != nil {
+			sigolo.Errorf("Query %d failed: %s", i+1, err)
+			failedQueries++
+		}
+	}
+
+	sigolo.Infof("Executed %d queries, %d failed", len(queryStrings), failedQueries)
+	if failedQueries > 0 {
+		return errFailureLogged
+	}
+	return nil
+}
+
+// executeBatchQuery executes the i-th query of a batch and writes its result into the output folder. Failed assertions
+// count as error.
+func executeBatchQuery(i int, queryString string, geometryIndex *index.GridIndexReader, tagIndex *index.TagIndex, outputOptions index.OutputOptions, settings common.Settings) error {
+	queryString, err := substituteQueryVariables(queryString, cli.Query.Var)
+	if err != nil {
+		return err
+	}
+
+	indexNames, queryString, err := parser.ParseUsingClause(queryString)
+	if err != nil {
+		return err
+	}
+	if len(indexNames) > 0 {
+		return errors.New("The USING clause is not supported in batch mode")
+	}
+
+	q, err := parseQueryString(queryString, tagIndex, geometryIndex)
+	if err != nil {
+		return err
+	}
+
+	outputFile := getBatchOutputFilename(cli.Query.OutputDir, i, cli.Query.Format, q.HasStatistics() || q.IsIntrospection())
+	sigolo.Infof("Execute query %d and write result to %s", i+1, outputFile)
+
+	err = executeQuery(q, geometryIndex, tagIndex, outputOptions, outputFile, settings)
+	if err != nil {
+		return err
+	}
+
+	if len(q.GetFailedAssertions()) > 0 {
+		return errors.Errorf("%d assertion(s) failed", len(q.GetFailedAssertions()))
+	}
+	return nil
+}
+
+// readBatchQueries returns the queries of the batch file, which contains one query per line. Empty lines and lines
+// starting with "//" are ignored.
+func readBatchQueries(batchFile string) ([]string, error) {
+	batchBytes, err := os.ReadFile(batchFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read batch file %s", batchFile)
+	}
+
+	var queryStrings []string
+	for _, line := range strings.Split(string(batchBytes), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		queryStrings = append(queryStrings, line)
+	}
+
+	if len(queryStrings) == 0 {
+		return nil, errors.Errorf("Batch file %s contains no queries", batchFile)
+	}
+
+	return queryStrings, nil
+}
+
+// getBatchOutputFilename returns the output file of the i-th (0-based) query of a batch. The file extension depends on
+// the output format, statistics are always written as JSON.
+func getBatchOutputFilename(outputDir string, i int, format string, isStatistics bool) string {
+	extension := format
+	if isStatistics {
+		extension = "json"
+	}
+	return path.Join(outputDir, fmt.Sprintf("query-%03d.%s", i+1, extension))
+}
+
+// getQueryOutputOptions returns the output options given to the query command.
+func getQueryOutputOptions() (index.OutputOptions, error) {
+	outputOptions := index.OutputOptions{
+		GeometryMetrics: cli.Query.GeometryMetrics,
+		Timestamp:       cli.Query.Timestamp,
+		TagKeyPrefix:    cli.Query.TagKeyPrefix,
+		Columns:         cli.Query.Columns,
+	}
+	if cli.Query.AreaTags != "" {
+		areaTags, err := index.LoadAreaTagTable(cli.Query.AreaTags)
+		if err != nil {
+			return index.OutputOptions{}, err
+		}
+		outputOptions.AreaTags = areaTags
+	}
+	return outputOptions, nil
+}
+
+// addRelationMembersToOutputOptions adds the members of the relations within the given features to the output options,
+// when requested by --member-roles or --resolve-members. Existing members in the options are kept, so this can be
+// called for the results of multiple indices.
+func addRelationMembersToOutputOptions(outputOptions *index.OutputOptions, geometryIndex index.GeometryIndex, features []feature.Feature) error {
+	if cli.Query.MemberRoles {
+		relationMembers, err := index.GetRelationMemberGeometriesByRole(geometryIndex, features)
+		if err != nil {
+			return err
+		}
+		if outputOptions.RelationMembers == nil {
+			outputOptions.RelationMembers = index.RelationMemberGeometries{}
+		}
+		for relationId, membersByRole := range relationMembers {
+			outputOptions.RelationMembers[relationId] = membersByRole
+		}
+	}
+
+	if cli.Query.ResolveMembers {
+		relationMemberWays, err := index.GetRelationMemberWays(geometryIndex, features)
+		if err != nil {
+			return err
+		}
+		if outputOptions.RelationMemberWays == nil {
+			outputOptions.RelationMemberWays = index.RelationMemberWays{}
+		}
+		for relationId, memberWays := range relationMemberWays {
+			outputOptions.RelationMemberWays[relationId] = memberWays
+		}
+	}
+
+	return nil
+}
+
+// executeFederatedQuery executes the query on all given named indices and writes the merged result.
+func executeFederatedQuery(indexNames []string, queryString string, settings common.Settings) error {
+	namedIndices, err := federation.LoadNamedIndices(federation.NamedIndicesFolder, indexNames, defaultCellSize, cli.Query.CheckFeatureValidity, settings)
+	if err != nil {
+		return err
+	}
+
+	result, err := federation.Execute(queryString, namedIndices, cli.Query.MemoryLimit*1024*1024, settings)
+	if err != nil {
+		return err
+	}
+
+	outputOptions, err := getQueryOutputOptions()
+	if err != nil {
+		return err
+	}
+
+	for i, featureSet := range result.FeatureSets {
+		err = addRelationMembersToOutputOptions(&outputOptions, namedIndices[i].GeometryIndex, featureSet.Features)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = index.WriteFeatureSetsToFile(result.FeatureSets, cli.Query.Output, cli.Query.Format, outputOptions)
+	if err != nil {
+		return err
+	}
+
+	if len(result.FailedAssertions) > 0 {
+		sigolo.Errorf("%d assertion(s) failed", len(result.FailedAssertions))
+		return errFailureLogged
+	}
+	return nil
+}
+
+// getBboxArgument converts the numbers of a bbox argument (min-lon,min-lat,max-lon,max-lat) into a bound. Nil is
+// returned when no bbox is given.
+func getBboxArgument(numbers []float64) (*orb.Bound, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	if len(numbers) != 4 {
+		return nil, errors.Errorf("The bbox must consist of four numbers but has %d", len(numbers))
+	}
+	return &orb.Bound{
+		Min: orb.Point{numbers[0], numbers[1]},
+		Max: orb.Point{numbers[2], numbers[3]},
+	}, nil
+}
+
+// inspectRawRecords prints the raw records of the feature given via the CLI arguments as hex dump followed by the
+// decoded feature as GeoJSON.
+func inspectRawRecords(settings common.Settings) error {
+	objectType := map[string]ownOsm.OsmObjectType{
+		"node":     ownOsm.OsmObjNode,
+		"way":      ownOsm.OsmObjWay,
+		"relation": ownOsm.OsmObjRelation,
+	}[cli.Inspect.ObjectType]
+
+	bbox, err := getBboxArgument(cli.Inspect.Bbox)
+	if err != nil {
+		return err
+	}
+
+	tagIndex, geometryIndex, err := loadIndex(false, settings)
+	if err != nil {
+		return err
+	}
+
+	records, err := geometryIndex.GetRawRecords(objectType, cli.Inspect.Id, bbox)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return errors.Errorf("No records found for %s %d", cli.Inspect.ObjectType, cli.Inspect.Id)
+	}
+
+	for _, record := range records {
+		sigolo.Infof("Record in cell %v at byte %d of %s (%d bytes):", record.Cell, record.Offset, record.Filename, len(record.Data))
+		fmt.Print(hex.Dump(record.Data))
+
+		decodedFeature, err := record.Decode()
+		if err != nil {
+			return err
+		}
+
+		err = index.WriteFeatures([]feature.Feature{decodedFeature}, tagIndex, "geojsonseq", index.OutputOptions{}, os.Stdout)
+		if err != nil {
+			return err
+		}
 	}
+
+	return nil
+}
+
+// startExecutionTrace writes the execution trace of the runtime into the given file until the returned function is
+// called.
+func startExecutionTrace(filename string) (func() error, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to create trace file %s", filename)
+	}
+
+	err = trace.Start(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "Unable to start execution trace")
+	}
+
+	return func() error {
+		trace.Stop()
+		err := file.Close()
+		if err != nil {
+			return errors.Wrapf(err, "Unable to close trace file %s", filename)
+		}
+		return nil
+	}, nil
+}
+
+// writeHeapProfile writes the allocations since the start of the process into the given file. Use e.g.
+// "go tool pprof -sample_index=alloc_space <file>" to see where the memory has been allocated.
+func writeHeapProfile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create heap profile file %s", filename)
+	}
+	defer file.Close()
+
+	// Up-to-date statistics of the memory in use require a garbage collection.
+	runtime.GC()
+
+	err = pprof.WriteHeapProfile(file)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write heap profile to %s", filename)
+	}
+	return nil
 }
@@ -1,10 +1,105 @@
 package main
 
 import (
+	"os"
+	"path"
+	"soq/common"
+	"soq/encoding"
 	"soq/importing"
+	"soq/index"
 	"testing"
 )
 
 func TestMainImport(t *testing.T) {
-	importing.Import("../test.osm.pbf", defaultCellSize, defaultCellSize, indexBaseFolder)
+	importOptions := importing.ImportOptions{
+		CellScheme:          &common.LatLonCellScheme{CellWidth: defaultCellSize, CellHeight: defaultCellSize},
+		CellSplitThreshold:  index.DefaultCellSplitThreshold,
+		CoordinatePrecision: encoding.CoordinatePrecisionFloat32,
+	}
+	importing.Import("../test.osm.pbf", indexBaseFolder, importOptions, common.DefaultSettings())
+}
+
+func TestSubstituteQueryVariables(t *testing.T) {
+	// Act
+	queryString, err := substituteQueryVariables("bbox({{bbox}}).nodes{ amenity=bench }", map[string]string{"bbox": "9.9,53.5,10.1,53.6"})
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, "bbox(9.9,53.5,10.1,53.6).nodes{ amenity=bench }", queryString)
+}
+
+func TestSubstituteQueryVariables_unusedVariable(t *testing.T) {
+	// Act
+	_, err := substituteQueryVariables("bbox({{bbox}}).nodes{ amenity=bench }", map[string]string{"bbox": "1,2,3,4", "box": "1,2,3,4"})
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestSubstituteQueryVariables_missingVariable(t *testing.T) {
+	// Act
+	_, err := substituteQueryVariables("bbox({{bbox}}).nodes{ amenity=bench }", nil)
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestReadQueryString(t *testing.T) {
+	// Arrange
+	queryFile := path.Join(t.TempDir(), "query.soq")
+	err := os.WriteFile(queryFile, []byte("// Benches\nall.nodes{ amenity=bench }"), 0644)
+	common.AssertNil(t, err)
+
+	// Act
+	queryFromArgument, err := readQueryString("all.nodes{ amenity=bench }", "")
+	common.AssertNil(t, err)
+	queryFromFile, err := readQueryString("", queryFile)
+	common.AssertNil(t, err)
+
+	// Assert
+	common.AssertEqual(t, "all.nodes{ amenity=bench }", queryFromArgument)
+	common.AssertEqual(t, "// Benches\nall.nodes{ amenity=bench }", queryFromFile)
+}
+
+func TestReadQueryString_invalid(t *testing.T) {
+	for _, arguments := range [][]string{{"", ""}, {"all.nodes{ amenity=bench }", "query.soq"}, {"", "not-existing.soq"}} {
+		// Act
+		_, err := readQueryString(arguments[0], arguments[1])
+
+		// Assert
+		common.AssertNotNil(t, err)
+	}
+}
+
+func TestReadBatchQueries(t *testing.T) {
+	// Arrange
+	batchFile := path.Join(t.TempDir(), "queries.txt")
+	err := os.WriteFile(batchFile, []byte("// Benches\nall.nodes{ amenity=bench }\n\n  all.ways{ highway=primary }  \n"), 0644)
+	common.AssertNil(t, err)
+
+	// Act
+	queryStrings, err := readBatchQueries(batchFile)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{"all.nodes{ amenity=bench }", "all.ways{ highway=primary }"}, queryStrings)
+}
+
+func TestReadBatchQueries_withoutQueries(t *testing.T) {
+	// Arrange
+	batchFile := path.Join(t.TempDir(), "queries.txt")
+	err := os.WriteFile(batchFile, []byte("// Nothing to do\n\n"), 0644)
+	common.AssertNil(t, err)
+
+	// Act
+	_, err = readBatchQueries(batchFile)
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestGetBatchOutputFilename(t *testing.T) {
+	common.AssertEqual(t, "out/query-001.geojson", getBatchOutputFilename("out", 0, "geojson", false))
+	common.AssertEqual(t, "out/query-012.geojsonseq", getBatchOutputFilename("out", 11, "geojsonseq", false))
+	common.AssertEqual(t, "out/query-003.json", getBatchOutputFilename("out", 2, "geojson", true))
 }
@@ -10,14 +10,12 @@ import (
 type OsmDensityAggregator struct {
 	CellToNodeCount     map[common.CellIndex]int
 	InputDataCellExtent *common.CellExtent
-	cellWidth           float64
-	cellHeight          float64
+	cellScheme          common.CellScheme
 }
 
-func NewOsmDensityAggregator(cellWidth float64, cellHeight float64) *OsmDensityAggregator {
+func NewOsmDensityAggregator(cellScheme common.CellScheme) *OsmDensityAggregator {
 	return &OsmDensityAggregator{
-		cellWidth:       cellWidth,
-		cellHeight:      cellHeight,
+		cellScheme:      cellScheme,
 		CellToNodeCount: map[common.CellIndex]int{},
 	}
 }
@@ -31,7 +29,7 @@ func (a *OsmDensityAggregator) Init() error {
 }
 
 func (a *OsmDensityAggregator) HandleNode(node *osm.Node) error {
-	cell := common.GetCellIndexForCoordinate(node.Lon, node.Lat, a.cellWidth, a.cellHeight)
+	cell := a.cellScheme.GetCellIndexForCoordinate(node.Lon, node.Lat)
 	if _, ok := a.CellToNodeCount[cell]; !ok {
 		a.CellToNodeCount[cell] = 1
 	} else {
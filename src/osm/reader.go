@@ -5,8 +5,10 @@ import (
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/osm"
 	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmxml"
 	"github.com/pkg/errors"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -22,18 +24,21 @@ type OsmDataHandler interface {
 	Done() error
 }
 
-// OsmReader reads a given OSM PBF file and calls all given OsmDataHandler on the data.
+// OsmReader reads a given OSM PBF or XML file and calls all given OsmDataHandler on the data.
 type OsmReader struct {
 	firstNodeHasBeenProcessed     bool
 	firstWayHasBeenProcessed      bool
 	firstRelationHasBeenProcessed bool
+	numWorkers                    int
 }
 
-func NewOsmReader() *OsmReader {
+// NewOsmReader creates a new reader decoding the input file with the given number of goroutines.
+func NewOsmReader(numWorkers int) *OsmReader {
 	return &OsmReader{
 		firstNodeHasBeenProcessed:     false,
 		firstWayHasBeenProcessed:      false,
 		firstRelationHasBeenProcessed: false,
+		numWorkers:                    numWorkers,
 	}
 }
 
@@ -43,7 +48,13 @@ func (r *OsmReader) Read(filename string, handlers ...OsmDataHandler) error {
 		return errors.Wrapf(err, "Unable to open OSM input file file %s", filename)
 	}
 
-	scanner := osmpbf.New(context.Background(), reader, 1)
+	var scanner osm.Scanner
+	if strings.HasSuffix(filename, ".pbf") {
+		scanner = osmpbf.New(context.Background(), reader, max(r.numWorkers, 1))
+	} else {
+		// XML files (e.g. from the Overpass API) are decoded in a single goroutine.
+		scanner = osmxml.New(context.Background(), reader)
+	}
 
 	sigolo.Debugf("Start processing OSM data file %s", filename)
 	importStartTime := time.Now()
@@ -92,6 +103,11 @@ func (r *OsmReader) Read(filename string, handlers ...OsmDataHandler) error {
 		}
 	}
 
+	err = scanner.Err()
+	if err != nil {
+		return errors.Wrapf(err, "Error reading OSM input file %s", filename)
+	}
+
 	sigolo.Infof("Finished Processing data, start post-processing")
 	for _, handler := range handlers {
 		err = handler.Done()
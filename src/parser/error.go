@@ -1,11 +1,17 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
+	"soq/index"
 	"strings"
 )
 
+// ErrSyntax is matched (s. errors.Is) by all lexing and parsing errors of this package, which occur at a certain
+// position within the query.
+var ErrSyntax = errors.New("Syntax error")
+
 type stack *[]uintptr
 
 // getCurrentStack creates a new stack without the last three frames, because they are from the internal calls (e.g. to
@@ -30,10 +36,37 @@ func getPrintableStackTrace(stack stack) string {
 	return sb.String()
 }
 
+// positionedError is implemented by all errors occurring at a certain position within the query. The line and column
+// are determined by the lexer after the error occurred, s. Lexer.addLineAndColumn.
+type positionedError interface {
+	error
+	getPosition() int
+	getLineAndColumn() (int, int)
+	setLineAndColumn(line int, column int)
+}
+
+// formatLocation returns the location for error messages. The line is 0 as long as line and column are not known.
+func formatLocation(position int, line int, column int) string {
+	if line == 0 {
+		return fmt.Sprintf("position %d", position)
+	}
+	return fmt.Sprintf("line %d, column %d (position %d)", line, column, position)
+}
+
+// formatLocationSuffix returns the suffix with line and column for error messages that already contain the position.
+func formatLocationSuffix(line int, column int) string {
+	if line == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (line %d, column %d)", line, column)
+}
+
 // ParsingExpectedButFoundError models a typical "Expected foo but found bar" kind of error.
 type ParsingExpectedButFoundError struct {
 	Message         string    `json:"message"`
 	Position        int       `json:"position"`
+	Line            int       `json:"line,omitempty"`
+	Column          int       `json:"column,omitempty"`
 	CurrentLexeme   string    `json:"currentLexeme"`
 	CurrentKind     TokenKind `json:"currentKind"`
 	ExpectedMessage string    `json:"expectedMessage"`
@@ -41,14 +74,33 @@ type ParsingExpectedButFoundError struct {
 }
 
 func ParsingErrorExpectedButFound(expectedMessage string, position int, currentLexeme string, currentKind TokenKind) *ParsingExpectedButFoundError {
-	return &ParsingExpectedButFoundError{
-		Message:         fmt.Sprintf("Parsing error: Expected %s at position %d but found '%s' of kind %s.", expectedMessage, position, currentLexeme, currentKind.String()),
+	err := &ParsingExpectedButFoundError{
 		Position:        position,
 		CurrentLexeme:   currentLexeme,
 		CurrentKind:     currentKind,
 		ExpectedMessage: expectedMessage,
 		stack:           getCurrentStack(),
 	}
+	err.updateMessage()
+	return err
+}
+
+func (e *ParsingExpectedButFoundError) updateMessage() {
+	e.Message = fmt.Sprintf("Parsing error: Expected %s at %s but found '%s' of kind %s.", e.ExpectedMessage, formatLocation(e.Position, e.Line, e.Column), e.CurrentLexeme, e.CurrentKind.String())
+}
+
+func (e *ParsingExpectedButFoundError) getPosition() int {
+	return e.Position
+}
+
+func (e *ParsingExpectedButFoundError) getLineAndColumn() (int, int) {
+	return e.Line, e.Column
+}
+
+func (e *ParsingExpectedButFoundError) setLineAndColumn(line int, column int) {
+	e.Line = line
+	e.Column = column
+	e.updateMessage()
 }
 
 func (e *ParsingExpectedButFoundError) Format(s fmt.State, verb rune) {
@@ -64,10 +116,16 @@ func (e *ParsingExpectedButFoundError) Error() string {
 	return e.Message
 }
 
+func (e *ParsingExpectedButFoundError) Is(target error) bool {
+	return target == ErrSyntax
+}
+
 // ParsingExpectedTokenKindError models a typical "Expected '(' but found ..." kind of error for a specific wanted token kind.
 type ParsingExpectedTokenKindError struct {
 	Message       string    `json:"message"`
 	Position      int       `json:"position"`
+	Line          int       `json:"line,omitempty"`
+	Column        int       `json:"column,omitempty"`
 	CurrentLexeme string    `json:"currentLexeme"`
 	CurrentKind   TokenKind `json:"currentKind"`
 	ExpectedKind  TokenKind `json:"expectedKind"`
@@ -75,14 +133,33 @@ type ParsingExpectedTokenKindError struct {
 }
 
 func ParsingErrorExpectedTokenKind(position int, currentLexeme string, currentKind TokenKind, expectedKind TokenKind) *ParsingExpectedTokenKindError {
-	return &ParsingExpectedTokenKindError{
-		Message:       fmt.Sprintf("Parsing error: Expected '%s' (%s) at position %d but found '%s' of kind %s.", expectedKind.Lexeme(), expectedKind.String(), position, currentLexeme, currentKind.String()),
+	err := &ParsingExpectedTokenKindError{
 		Position:      position,
 		CurrentLexeme: currentLexeme,
 		CurrentKind:   currentKind,
 		ExpectedKind:  expectedKind,
 		stack:         getCurrentStack(),
 	}
+	err.updateMessage()
+	return err
+}
+
+func (e *ParsingExpectedTokenKindError) updateMessage() {
+	e.Message = fmt.Sprintf("Parsing error: Expected '%s' (%s) at %s but found '%s' of kind %s.", e.ExpectedKind.Lexeme(), e.ExpectedKind.String(), formatLocation(e.Position, e.Line, e.Column), e.CurrentLexeme, e.CurrentKind.String())
+}
+
+func (e *ParsingExpectedTokenKindError) getPosition() int {
+	return e.Position
+}
+
+func (e *ParsingExpectedTokenKindError) getLineAndColumn() (int, int) {
+	return e.Line, e.Column
+}
+
+func (e *ParsingExpectedTokenKindError) setLineAndColumn(line int, column int) {
+	e.Line = line
+	e.Column = column
+	e.updateMessage()
 }
 
 func (e *ParsingExpectedTokenKindError) Format(s fmt.State, verb rune) {
@@ -98,10 +175,16 @@ func (e *ParsingExpectedTokenKindError) Error() string {
 	return e.Message
 }
 
+func (e *ParsingExpectedTokenKindError) Is(target error) bool {
+	return target == ErrSyntax
+}
+
 // ParsingTokenStreamEndedError models a typical "Expected foo but found bar" kind of error.
 type ParsingTokenStreamEndedError struct {
 	Message         string `json:"message"`
 	Position        int    `json:"position"`
+	Line            int    `json:"line,omitempty"`
+	Column          int    `json:"column,omitempty"`
 	ExpectedMessage string `json:"expectedMessage"`
 	stack           stack
 }
@@ -116,14 +199,209 @@ func (e *ParsingTokenStreamEndedError) Format(s fmt.State, verb rune) {
 }
 
 func ParsingTokenStreamEndAtPosition(position int, expectedMessage string) *ParsingTokenStreamEndedError {
-	return &ParsingTokenStreamEndedError{
-		Message:         fmt.Sprintf("Parsing error: Token stream ended at position %d, expected %s.", position, expectedMessage),
+	err := &ParsingTokenStreamEndedError{
 		Position:        position,
 		ExpectedMessage: expectedMessage,
 		stack:           getCurrentStack(),
 	}
+	err.updateMessage()
+	return err
+}
+
+func (e *ParsingTokenStreamEndedError) updateMessage() {
+	e.Message = fmt.Sprintf("Parsing error: Token stream ended at %s, expected %s.", formatLocation(e.Position, e.Line, e.Column), e.ExpectedMessage)
+}
+
+func (e *ParsingTokenStreamEndedError) getPosition() int {
+	return e.Position
+}
+
+func (e *ParsingTokenStreamEndedError) getLineAndColumn() (int, int) {
+	return e.Line, e.Column
+}
+
+func (e *ParsingTokenStreamEndedError) setLineAndColumn(line int, column int) {
+	e.Line = line
+	e.Column = column
+	e.updateMessage()
 }
 
 func (e *ParsingTokenStreamEndedError) Error() string {
 	return e.Message
 }
+
+func (e *ParsingTokenStreamEndedError) Is(target error) bool {
+	return target == ErrSyntax
+}
+
+// LexingError models errors of the lexer, e.g. unexpected characters or unterminated strings.
+type LexingError struct {
+	Message     string `json:"message"`
+	Position    int    `json:"position"`
+	Line        int    `json:"line,omitempty"`
+	Column      int    `json:"column,omitempty"`
+	baseMessage string // Message without line and column
+	stack       stack
+}
+
+func LexingErrorAtPosition(position int, message string) *LexingError {
+	return &LexingError{
+		Message:     message,
+		Position:    position,
+		baseMessage: message,
+		stack:       getCurrentStack(),
+	}
+}
+
+func (e *LexingError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		fmt.Fprintf(s, "%s\n%s", e.Error(), getPrintableStackTrace(e.stack))
+	case 's':
+		fmt.Fprintf(s, "%s", e.Error())
+	}
+}
+
+func (e *LexingError) Error() string {
+	return e.Message
+}
+
+func (e *LexingError) Is(target error) bool {
+	return target == ErrSyntax
+}
+
+func (e *LexingError) getPosition() int {
+	return e.Position
+}
+
+func (e *LexingError) getLineAndColumn() (int, int) {
+	return e.Line, e.Column
+}
+
+func (e *LexingError) setLineAndColumn(line int, column int) {
+	e.Line = line
+	e.Column = column
+	e.Message = e.baseMessage + formatLocationSuffix(line, column)
+}
+
+// ParsingError models all other errors of the parser occurring at a certain position, e.g. keywords that are not
+// allowed at this place.
+type ParsingError struct {
+	Message     string `json:"message"`
+	Position    int    `json:"position"`
+	Line        int    `json:"line,omitempty"`
+	Column      int    `json:"column,omitempty"`
+	baseMessage string // Message without line and column
+	stack       stack
+}
+
+func ParsingErrorAtPosition(position int, format string, args ...any) *ParsingError {
+	message := fmt.Sprintf(format, args...)
+	return &ParsingError{
+		Message:     message,
+		Position:    position,
+		baseMessage: message,
+		stack:       getCurrentStack(),
+	}
+}
+
+func (e *ParsingError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		fmt.Fprintf(s, "%s\n%s", e.Error(), getPrintableStackTrace(e.stack))
+	case 's':
+		fmt.Fprintf(s, "%s", e.Error())
+	}
+}
+
+func (e *ParsingError) Error() string {
+	return e.Message
+}
+
+func (e *ParsingError) Is(target error) bool {
+	return target == ErrSyntax
+}
+
+func (e *ParsingError) getPosition() int {
+	return e.Position
+}
+
+func (e *ParsingError) getLineAndColumn() (int, int) {
+	return e.Line, e.Column
+}
+
+func (e *ParsingError) setLineAndColumn(line int, column int) {
+	e.Line = line
+	e.Column = column
+	e.Message = e.baseMessage + formatLocationSuffix(line, column)
+}
+
+// UnknownTagsError is returned in strict mode (s. ParseQueryStringStrict) when the query contains keys or values not
+// existing in the tag-index. The message lists all of them, the position is the one of the first unknown key or value.
+type UnknownTagsError struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	stack    stack
+}
+
+func newUnknownTagsError(position int, messages []string) *UnknownTagsError {
+	return &UnknownTagsError{
+		Message:  "Unknown keys or values: " + strings.Join(messages, "; "),
+		Position: position,
+		stack:    getCurrentStack(),
+	}
+}
+
+func (e *UnknownTagsError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		fmt.Fprintf(s, "%s\n%s", e.Error(), getPrintableStackTrace(e.stack))
+	case 's':
+		fmt.Fprintf(s, "%s", e.Error())
+	}
+}
+
+func (e *UnknownTagsError) Error() string {
+	return e.Message
+}
+
+func (e *UnknownTagsError) Is(target error) bool {
+	return target == index.ErrUnknownKey
+}
+
+func (e *UnknownTagsError) getPosition() int {
+	return e.Position
+}
+
+func (e *UnknownTagsError) getLineAndColumn() (int, int) {
+	return e.Line, e.Column
+}
+
+// setLineAndColumn doesn't change the message, since it already contains the location of each unknown key and value.
+func (e *UnknownTagsError) setLineAndColumn(line int, column int) {
+	e.Line = line
+	e.Column = column
+}
+
+// GetErrorPosition returns the position within the query string at which the given lexing or parsing error occurred.
+// False is returned for errors without a position, e.g. when resolving a place failed.
+func GetErrorPosition(err error) (int, bool) {
+	var positioned positionedError
+	if !errors.As(err, &positioned) {
+		return 0, false
+	}
+	return positioned.getPosition(), true
+}
+
+// GetErrorLineAndColumn returns the line and column (both starting at 1) within the query string at which the given
+// lexing or parsing error occurred. False is returned for errors without a position.
+func GetErrorLineAndColumn(err error) (int, int, bool) {
+	var positioned positionedError
+	if !errors.As(err, &positioned) {
+		return 0, 0, false
+	}
+	line, column := positioned.getLineAndColumn()
+	return line, column, line != 0
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"soq/index"
+	"testing"
+)
+
+// FuzzParseQueryString ensures that the parser never panics, no matter how broken the input is. Run it with
+// "go test ./parser -fuzz FuzzParseQueryString".
+func FuzzParseQueryString(f *testing.F) {
+	seeds := []string{
+		"bbox(1,2,3,4).nodes{ amenity=bench }",
+		"bbox(1,2,3,4).nodes{ amenity=bench AND seats>=2.5 AND this.ways{ amenity=* } }",
+		"bbox(1,2,3,4).ways{ !(highway=primary OR highway=secondary) AND id in (1, 2, 3) }",
+		"bbox(1,2,3,4).nodes{ amenity=cafe }.select(name, opening_hours) ASSERT count > 0",
+		"bbox(1,2,3,4).nodes{ amenity=bench } within bbox(1,2,3,4).ways{ landuse=park }",
+		"bbox(1,2,3,4).nodes{ amenity=bench } near(50) bbox(1,2,3,4).ways{ highway=* }",
+		"all.relations{ type=boundary }.centroid()",
+		"coverage().ways{ name=\"Foo \\\" Bar\" }",
+		"place(\"Hamburg\").nodes{ amenity=* }",
+		"USING foo bbox(1,2,3,4).nodes{ amenity=* }",
+		"// comment\nbbox(1,2,3,4).relations{ this.child_relations{ amenity=* } }",
+		"bbox(1,2,3,4).ways{ NOT highway=primary AND NOT (amenity=bench OR NOT NOT name=*) }",
+		"bbox(1,2,3,4).nwr{ amenity=bench AND type()!=relation }.select(name)",
+		"bbox(1,2,3,4).ways{ amenity=bench AND this.nwr{ name=* } }",
+		"DISTINCT bbox(1,2,3,4).nodes{ amenity=bench } bbox(1,2,3,4).nwr{ amenity=* }",
+		"at(\"2020-01-01\") all.nodes{ amenity=bench }",
+		"DISTINCT at(\"2020-01-01T12:30:00Z\") all.nodes{ amenity=bench } all.ways{ amenity=* }",
+		"keys()",
+		"keys(",
+		"NOT",
+		"DISTINCT",
+		"at(\"",
+		"bbox(",
+		"bbox(1,2,3,4).nodes{",
+		"\"",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	tagIndex := index.NewTagIndex([]string{"amenity", "highway", "landuse", "name", "opening_hours", "seats", "type"}, [][]string{{"bench", "cafe"}, {"primary", "secondary"}, {"park"}, {"Foo \" Bar"}, {"24/7"}, {"2", "3"}, {"boundary"}})
+
+	f.Fuzz(func(t *testing.T, queryString string) {
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+		if err == nil && q == nil {
+			t.Errorf("Neither query nor error returned for %q", queryString)
+		}
+	})
+}
@@ -5,12 +5,16 @@ import (
 	"github.com/hauke96/sigolo/v2"
 	"github.com/pkg/errors"
 	"soq/common"
+	"sort"
 	"unicode"
 )
 
 type Lexer struct {
 	input []rune
 	index int // Position in input.
+
+	// Positions of the first character of each line. Determined on first use by getLineAndColumn.
+	lineStartPositions []int
 }
 
 var (
@@ -18,7 +22,7 @@ var (
 		'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o', 'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z',
 		'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O', 'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z',
 		'_', ':', '@'}
-	numberChars = []rune{'1', '2', '3', '4', '5', '6', '7', '8', '9', '0', '.'}
+	numberChars = []rune{'1', '2', '3', '4', '5', '6', '7', '8', '9', '0', '.', '^'}
 )
 
 // char returns the rune at the current location or the rune '-1' if there is no next char.
@@ -45,7 +49,8 @@ func (l *Lexer) read() ([]*Token, error) {
 			return nil, err
 		}
 		if token != nil {
-			l.tracef("Found token kind=%d, pos=%d, lexeme=\"%s\"", token.kind, token.startPosition, token.lexeme)
+			token.line, token.column = l.getLineAndColumn(token.startPosition)
+			l.tracef("Found token kind=%d, pos=%d (%d:%d), lexeme=\"%s\"", token.kind, token.startPosition, token.line, token.column, token.lexeme)
 			tokens = append(tokens, token)
 		} else {
 			l.tracef("Did not found a next token. This happens when a comment is at the end of the text. If this is not the case, than this might indicate a bug.")
@@ -97,6 +102,11 @@ func (l *Lexer) nextToken() (*Token, error) {
 			return l.currentSingleCharToken(TokenKindWildcard), nil
 		}
 
+		// String literals in double quotes, e.g. for values with spaces
+		if char == '"' {
+			return l.currentString()
+		}
+
 		// Keywords and identifier (i.e. token consisting of multi-char words)
 		if common.Contains(keywordChars, char) {
 			return l.currentKeyword(), nil
@@ -131,7 +141,7 @@ func (l *Lexer) nextToken() (*Token, error) {
 			return l.currentSingleCharToken(TokenKindOperator), nil
 		}
 
-		return nil, errors.Errorf("Unexpected character '%c' at index %d", char, l.index)
+		return nil, LexingErrorAtPosition(l.index, fmt.Sprintf("Unexpected character '%c' at index %d", char, l.index))
 	}
 
 	return nil, errors.New("No token found")
@@ -143,7 +153,7 @@ func (l *Lexer) skipComment() error {
 	if l.index >= len(l.input) || l.char() != '/' {
 		// Text ended or next rune is not '/'
 		l.index--
-		return errors.Errorf("Unexpected '%c' at index %d", l.char(), l.index)
+		return LexingErrorAtPosition(l.index, fmt.Sprintf("Unexpected '%c' at index %d", l.char(), l.index))
 	}
 	l.tracef("Found comment start")
 
@@ -195,6 +205,37 @@ func (l *Lexer) currentKeyword() *Token {
 	}
 }
 
+// currentString returns the string literal starting at the current index, which must be the opening double quote. The
+// lexeme of the token is the content without quotes. Double quotes and backslashes within the string can be escaped
+// with a backslash.
+func (l *Lexer) currentString() (*Token, error) {
+	lexeme := ""
+	startIndex := l.index
+
+	// Skip opening quote
+	l.index++
+
+	for ; l.index < len(l.input); l.index++ {
+		char := l.char()
+		if char == '"' {
+			l.index++
+			return &Token{
+				kind:          TokenKindString,
+				lexeme:        lexeme,
+				startPosition: startIndex,
+			}, nil
+		}
+
+		if char == '\\' && (l.nextChar() == '"' || l.nextChar() == '\\') {
+			l.index++
+			char = l.char()
+		}
+		lexeme += string(char)
+	}
+
+	return nil, LexingErrorAtPosition(startIndex, fmt.Sprintf("Unterminated string starting at index %d", startIndex))
+}
+
 func (l *Lexer) currentNumber() *Token {
 	lexeme := ""
 	startIndex := l.index
@@ -211,6 +252,32 @@ func (l *Lexer) currentNumber() *Token {
 	}
 }
 
+// getLineAndColumn returns the line and column (both starting at 1) of the given position within the input.
+func (l *Lexer) getLineAndColumn(position int) (int, int) {
+	if l.lineStartPositions == nil {
+		l.lineStartPositions = []int{0}
+		for i, char := range l.input {
+			if char == '\n' {
+				l.lineStartPositions = append(l.lineStartPositions, i+1)
+			}
+		}
+	}
+
+	// Index of the first line starting after the position, which is the line number since lines start at 1.
+	line := sort.SearchInts(l.lineStartPositions, position+1)
+	return line, position - l.lineStartPositions[line-1] + 1
+}
+
+// addLineAndColumn sets the line and column of the given error, when it's a lexing or parsing error with a position
+// within the input of this lexer. The error is returned for convenience.
+func (l *Lexer) addLineAndColumn(err error) error {
+	var positioned positionedError
+	if errors.As(err, &positioned) {
+		positioned.setLineAndColumn(l.getLineAndColumn(positioned.getPosition()))
+	}
+	return err
+}
+
 func (l *Lexer) tracef(format string, args ...any) {
 	formattedMessage := format
 	if args != nil && len(args) > 0 {
@@ -101,6 +101,41 @@ func TestLexer_currentNumber(t *testing.T) {
 	common.AssertEqual(t, 3, l.index)
 }
 
+func TestLexer_currentString(t *testing.T) {
+	// Arrange
+	sigolo.SetDefaultLogLevel(sigolo.LOG_TRACE)
+	l := &Lexer{
+		input: []rune(`"St. \"Pauli\" \\ 1" abc`),
+		index: 0,
+	}
+
+	// Act
+	token, err := l.currentString()
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, TokenKindString, token.kind)
+	common.AssertEqual(t, `St. "Pauli" \ 1`, token.lexeme)
+	common.AssertEqual(t, 0, token.startPosition)
+	common.AssertEqual(t, 20, l.index)
+}
+
+func TestLexer_currentString_unterminated(t *testing.T) {
+	// Arrange
+	sigolo.SetDefaultLogLevel(sigolo.LOG_TRACE)
+	l := &Lexer{
+		input: []rune(`"abc`),
+		index: 0,
+	}
+
+	// Act
+	token, err := l.currentString()
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, token)
+}
+
 func TestLexer_nextToken(t *testing.T) {
 	// Arrange
 	sigolo.SetDefaultLogLevel(sigolo.LOG_TRACE)
@@ -301,13 +336,13 @@ func TestLexer_read_simple(t *testing.T) {
 	common.AssertNotNil(t, tokens)
 	common.AssertEqual(t, 7, len(tokens))
 
-	common.AssertEqual(t, &Token{kind: TokenKindKeyword, lexeme: "bbox", startPosition: 12}, tokens[0])
-	common.AssertEqual(t, &Token{kind: TokenKindOpeningParenthesis, lexeme: "(", startPosition: 16}, tokens[1])
-	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "1", startPosition: 17}, tokens[2])
-	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "2", startPosition: 19}, tokens[3])
-	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "3", startPosition: 21}, tokens[4])
-	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "4.56", startPosition: 23}, tokens[5])
-	common.AssertEqual(t, &Token{kind: TokenKindClosingParenthesis, lexeme: ")", startPosition: 27}, tokens[6])
+	common.AssertEqual(t, &Token{kind: TokenKindKeyword, lexeme: "bbox", startPosition: 12, line: 2, column: 1}, tokens[0])
+	common.AssertEqual(t, &Token{kind: TokenKindOpeningParenthesis, lexeme: "(", startPosition: 16, line: 2, column: 5}, tokens[1])
+	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "1", startPosition: 17, line: 2, column: 6}, tokens[2])
+	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "2", startPosition: 19, line: 2, column: 8}, tokens[3])
+	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "3", startPosition: 21, line: 2, column: 10}, tokens[4])
+	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "4.56", startPosition: 23, line: 2, column: 12}, tokens[5])
+	common.AssertEqual(t, &Token{kind: TokenKindClosingParenthesis, lexeme: ")", startPosition: 27, line: 2, column: 16}, tokens[6])
 }
 
 func TestLexer_read_commentAfterToken(t *testing.T) {
@@ -326,8 +361,8 @@ func TestLexer_read_commentAfterToken(t *testing.T) {
 	common.AssertNotNil(t, tokens)
 	common.AssertEqual(t, 2, len(tokens))
 
-	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "123", startPosition: 0}, tokens[0])
-	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "234", startPosition: 17}, tokens[1])
+	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "123", startPosition: 0, line: 1, column: 1}, tokens[0])
+	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "234", startPosition: 17, line: 2, column: 1}, tokens[1])
 }
 
 func TestLexer_read_commentAfterClosingBlock(t *testing.T) {
@@ -346,7 +381,32 @@ func TestLexer_read_commentAfterClosingBlock(t *testing.T) {
 	common.AssertNotNil(t, tokens)
 	common.AssertEqual(t, 3, len(tokens))
 
-	common.AssertEqual(t, &Token{kind: TokenKindOpeningBraces, lexeme: "{", startPosition: 0}, tokens[0])
-	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "123", startPosition: 2}, tokens[1])
-	common.AssertEqual(t, &Token{kind: TokenKindClosingBraces, lexeme: "}", startPosition: 6}, tokens[2])
+	common.AssertEqual(t, &Token{kind: TokenKindOpeningBraces, lexeme: "{", startPosition: 0, line: 1, column: 1}, tokens[0])
+	common.AssertEqual(t, &Token{kind: TokenKindNumber, lexeme: "123", startPosition: 2, line: 1, column: 3}, tokens[1])
+	common.AssertEqual(t, &Token{kind: TokenKindClosingBraces, lexeme: "}", startPosition: 6, line: 1, column: 7}, tokens[2])
+}
+
+func TestLexer_getLineAndColumn(t *testing.T) {
+	// Arrange
+	l := &Lexer{
+		input: []rune("ab\n\ncd\r\nä"),
+		index: 0,
+	}
+
+	for position, expected := range map[int][2]int{
+		0:  {1, 1},
+		2:  {1, 3},
+		3:  {2, 1},
+		4:  {3, 1},
+		6:  {3, 3},
+		8:  {4, 1},
+		9:  {4, 2},
+		10: {4, 3},
+	} {
+		// Act
+		line, column := l.getLineAndColumn(position)
+
+		// Assert
+		common.AssertEqual(t, expected, [2]int{line, column})
+	}
 }
@@ -5,23 +5,72 @@ import (
 	"github.com/hauke96/sigolo/v2"
 	"github.com/paulmach/orb"
 	"github.com/pkg/errors"
+	"math"
 	"soq/common"
 	"soq/index"
 	"soq/osm"
 	"soq/query"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	bboxLocationExpression         = "bbox"
+	allLocationExpression          = "all"
+	coverageLocationExpression     = "coverage"
+	placeLocationExpression        = "place"
+	areaByNameLocationExpression   = "areaByName"
+	alongLocationExpression        = "along"
 	contextAwareLocationExpression = "this"
-	locationExpressions            = []string{bboxLocationExpression}
+	locationExpressions            = []string{bboxLocationExpression, allLocationExpression, coverageLocationExpression, placeLocationExpression, areaByNameLocationExpression, alongLocationExpression}
+
+	adminLevelArgument = "admin_level"
+	wayIdPrefix        = "way:"
+
+	assertExpression      = "ASSERT"
+	assertCountExpression = "count"
+
+	selectExpression = "select"
+	statsExpression  = "stats"
+	// Introspection statements listing the keys and values of the data, e.g. "keys()" or "bbox(...).values(highway)".
+	keysExpression   = "keys"
+	valuesExpression = "values"
+	// Output transforms. The "bbox" transform shares its keyword with the bbox location expression.
+	centroidExpression = "centroid"
+
+	spatialJoinWithinExpression     = "within"
+	spatialJoinContainsExpression   = "contains"
+	spatialJoinIntersectsExpression = "intersects"
+	spatialJoinNearExpression       = "near"
+
+	idExpression     = "id"
+	idListExpression = "in"
+
+	// Metadata filters, which need an index with stored metadata.
+	changesetExpression = "changeset"
+	userExpression      = "user"
+
+	isClosedExpression = "is_closed"
+	isAreaExpression   = "is_area"
+
+	// Filter function for the object type, e.g. "type()=node". Without "(", "type" is a normal key.
+	typeExpression = "type"
+
+	andExpression = "AND"
+	orExpression  = "OR"
+	// Alternative to "!" that can be used before any expression, e.g. "NOT highway=primary".
+	notExpression = "NOT"
+
+	// Returns features matching multiple top-level statements only once, e.g. "DISTINCT bbox(...).nodes{...} ...".
+	distinctExpression = "DISTINCT"
 
 	objectTypeNodeExpression           = "nodes"
 	objectTypeWaysExpression           = "ways"
 	objectTypeRelationsExpression      = "relations"
 	objectTypeChildRelationsExpression = "child_relations"
+	// All three object types, which is a shortcut for one statement per type with the same location and filter.
+	objectTypeNwrExpression = "nwr"
 )
 
 type Parser struct {
@@ -29,10 +78,46 @@ type Parser struct {
 	index         int
 	tagIndex      *index.TagIndex
 	geometryIndex index.GeometryIndex
+
+	// Object types of the statements currently being parsed, the innermost statement is the last one. This is the
+	// context of a "this.<type>" statement.
+	contextObjectTypes []osm.OsmObjectType
+
+	// True when context-aware statements like "this.ways{...}" are not allowed, e.g. because there's no index yet.
+	subStatementsNotAllowed bool
+
+	// Object type used for the "nwr" of the statement currently being parsed, s. parseNwrStatement. Nil otherwise.
+	nwrQueryType *osm.OsmQueryType
+
+	// Resolved location expressions by the index of their first token. Statements on "nwr" are parsed several times,
+	// but locations like places should only be resolved once.
+	parsedLocations map[int]parsedLocation
+
+	// Keys and values of the query not existing in the tag-index, s. checkKey and checkValue.
+	unknownTags []unknownTag
+}
+
+type parsedLocation struct {
+	expression query.LocationExpression
+	endIndex   int
 }
 
+// ParseQueryString parses the given query. Keys and values not existing in the tag-index don't cause an error but a
+// warning of the returned query (s. query.Query.GetWarnings), since expressions with them are valid but match nothing.
 func ParseQueryString(queryString string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex) (*query.Query, error) {
-	runes := []rune(strings.Trim(queryString, "\n\r\t "))
+	return parseQueryString(queryString, tagIndex, geometryIndex, false)
+}
+
+// ParseQueryStringStrict is like ParseQueryString but returns an UnknownTagsError for keys and values not existing in
+// the tag-index, which are usually typos.
+func ParseQueryStringStrict(queryString string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex) (*query.Query, error) {
+	return parseQueryString(queryString, tagIndex, geometryIndex, true)
+}
+
+func parseQueryString(queryString string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex, strict bool) (*query.Query, error) {
+	// Leading whitespace is skipped by the lexer and kept here, so that the positions, lines and columns of errors refer
+	// to the original query string.
+	runes := []rune(strings.TrimRight(queryString, "\n\r\t "))
 	lexer := Lexer{
 		input: runes,
 		index: 0,
@@ -40,7 +125,7 @@ func ParseQueryString(queryString string, tagIndex *index.TagIndex, geometryInde
 
 	token, err := lexer.read()
 	if err != nil {
-		return nil, err
+		return nil, lexer.addLineAndColumn(err)
 	}
 
 	sigolo.Tracef("Found %d token", len(token))
@@ -54,7 +139,62 @@ func ParseQueryString(queryString string, tagIndex *index.TagIndex, geometryInde
 		tagIndex:      tagIndex,
 		geometryIndex: geometryIndex,
 	}
-	return parser.parse()
+	q, err := parser.parse()
+	if err != nil {
+		return nil, lexer.addLineAndColumn(err)
+	}
+
+	if len(parser.unknownTags) > 0 {
+		messages := getUnknownTagMessages(parser.unknownTags, tagIndex, &lexer)
+		if strict {
+			return nil, lexer.addLineAndColumn(newUnknownTagsError(parser.unknownTags[0].position, messages))
+		}
+		q.SetParsingWarnings(messages)
+	}
+
+	return q, nil
+}
+
+// ParseFilterExpression parses a single filter expression like "highway=* OR railway=*" without the location and
+// braces of a statement. Context-aware statements (e.g. "this.ways{...}") are not supported, since such expressions
+// are evaluated on single objects without an index, e.g. during the import.
+func ParseFilterExpression(expressionString string, tagIndex *index.TagIndex) (query.FilterExpression, error) {
+	runes := []rune(strings.TrimRight(expressionString, "\n\r\t "))
+	lexer := Lexer{
+		input: runes,
+		index: 0,
+	}
+
+	token, err := lexer.read()
+	if err != nil {
+		return nil, lexer.addLineAndColumn(err)
+	}
+	if len(token) == 0 {
+		return nil, ParsingTokenStreamEndAtPosition(0, "Expected filter expression")
+	}
+
+	// The expression is parsed like the content of a statement, so it's surrounded by artificial braces.
+	openingBraces := &Token{kind: TokenKindOpeningBraces, lexeme: "", startPosition: 0}
+	closingBraces := &Token{kind: TokenKindClosingBraces, lexeme: "", startPosition: len(runes)}
+	token = append(append([]*Token{openingBraces}, token...), closingBraces)
+
+	parser := Parser{
+		token:                   token,
+		index:                   0,
+		tagIndex:                tagIndex,
+		subStatementsNotAllowed: true,
+	}
+	expression, err := parser.parseNextFilterExpressions()
+	if err != nil {
+		return nil, lexer.addLineAndColumn(err)
+	}
+
+	nextToken := parser.peekNextToken()
+	if nextToken != nil && nextToken != closingBraces {
+		return nil, lexer.addLineAndColumn(ParsingErrorExpectedButFound("end of expression", nextToken.startPosition, nextToken.lexeme, nextToken.kind))
+	}
+
+	return expression, nil
 }
 
 func (p *Parser) moveToNextToken() *Token {
@@ -94,16 +234,163 @@ func (p *Parser) currentToken() *Token {
 func (p *Parser) parse() (*query.Query, error) {
 	var topLevelStatements []query.Statement
 
+	token := p.currentToken()
+	if token != nil && token.kind == TokenKindKeyword && token.lexeme == usingExpression {
+		return nil, errors.Errorf("Selecting indices with '%s' is not supported here, only the query command supports it", usingExpression)
+	}
+
+	// Optional "DISTINCT" keyword, so that features returned by multiple statements are only returned once
+	distinct := false
+	if token != nil && token.kind == TokenKindKeyword && token.lexeme == distinctExpression {
+		distinct = true
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected statement after '"+distinctExpression+"'")
+		}
+		token = p.moveToNextToken()
+	}
+
+	// Optional point in time of the whole query, e.g. 'at("2020-01-01")'
+	var queryTime *time.Time
+	if token != nil && token.kind == TokenKindKeyword && token.lexeme == atExpression {
+		var err error
+		queryTime, err = p.parseAtClause()
+		if err != nil {
+			return nil, err
+		}
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected statement after '"+atExpression+"' clause")
+		}
+		p.moveToNextToken()
+	}
+
+	if p.isIntrospection() {
+		if distinct {
+			return nil, errors.Errorf("'%s' can't be combined with '%s' and '%s'", distinctExpression, keysExpression, valuesExpression)
+		}
+		introspection, err := p.parseIntrospection()
+		if err != nil {
+			return nil, err
+		}
+		if p.hasNextToken() {
+			token := p.moveToNextToken()
+			return nil, ParsingErrorAtPosition(token.startPosition, "'%s' and '%s' can't be combined with other statements, but found '%s' at position %d", keysExpression, valuesExpression, token.lexeme, token.startPosition)
+		}
+
+		q := query.NewIntrospectionQuery(introspection)
+		q.SetTime(queryTime)
+		return q, nil
+	}
+
 	for p.peekNextToken() != nil {
-		statement, err := p.parseStatement()
+		var statements []*query.Statement
+		if p.isNwrStatement() {
+			nwrStatements, err := p.parseNwrStatement()
+			if err != nil {
+				return nil, err
+			}
+			statements = nwrStatements
+		} else {
+			statement, err := p.parseTopLevelStatement()
+			if err != nil {
+				return nil, err
+			}
+			statements = []*query.Statement{statement}
+		}
+
+		for _, statement := range statements {
+			topLevelStatements = append(topLevelStatements, *statement)
+		}
+
+		if p.hasNextToken() {
+			// Move to the first token of the next statement
+			p.moveToNextToken()
+		}
+	}
+
+	for _, statement := range topLevelStatements {
+		if statement.HasStatistics() != topLevelStatements[0].HasStatistics() {
+			return nil, errors.Errorf("Statements with '%s' can't be combined with statements returning features", statsExpression)
+		}
+	}
+
+	q := query.NewQuery(topLevelStatements)
+	q.SetTime(queryTime)
+	q.SetDistinct(distinct)
+	return q, nil
+}
+
+// parseTopLevelStatement parses a statement with its optional spatial join, output modifiers and assertion.
+func (p *Parser) parseTopLevelStatement() (*query.Statement, error) {
+	statement, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	// Optional spatial join with another statement, e.g. "within bbox(...).ways{ landuse=park }"
+	nextToken := p.peekNextToken()
+	if nextToken != nil && nextToken.kind == TokenKindKeyword && getSpatialOperator(nextToken.lexeme) != nil {
+		p.moveToNextToken()
+		spatialJoin, err := p.parseSpatialJoin()
+		if err != nil {
+			return nil, err
+		}
+		statement.SetSpatialJoin(spatialJoin)
+	}
+
+	// Optional output modifiers, e.g. ".select(name, amenity)"
+	for p.peekNextToken() != nil && p.peekNextToken().kind == TokenKindExpressionSeparator {
+		p.moveToNextToken()
+		err = p.parseOutputModifier(statement)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Optional assertion on the result of the statement, e.g. "ASSERT count >= 100"
+	nextToken = p.peekNextToken()
+	if nextToken != nil && nextToken.kind == TokenKindKeyword && nextToken.lexeme == assertExpression {
+		p.moveToNextToken()
+		assertion, err := p.parseAssertion()
+		if err != nil {
+			return nil, err
+		}
+		statement.SetAssertion(assertion)
+	}
+
+	return statement, nil
+}
+
+// isNwrStatement returns true when the statement starting at the current token queries all object types, e.g.
+// "bbox(...).nwr{ amenity=* }". Only the tokens are checked, so that the location isn't resolved twice.
+func (p *Parser) isNwrStatement() bool {
+	i, hasLocation := p.skipLocationTokens(p.index)
+	return hasLocation && i < len(p.token) && p.token[i].kind == TokenKindKeyword && p.token[i].lexeme == objectTypeNwrExpression
+}
+
+// parseNwrStatement parses a statement on all object types like "bbox(...).nwr{ amenity=* }" into one statement per
+// object type. The statement is parsed once for each object type, since filters with sub-statements depend on the
+// object type of their statement.
+func (p *Parser) parseNwrStatement() ([]*query.Statement, error) {
+	startIndex := p.index
+	nwrToken := p.token[p.index]
+
+	var statements []*query.Statement
+	for _, queryType := range []osm.OsmQueryType{osm.OsmQueryNode, osm.OsmQueryWay, osm.OsmQueryRelation} {
+		p.index = startIndex
+		p.nwrQueryType = &queryType
+		statement, err := p.parseTopLevelStatement()
+		p.nwrQueryType = nil
 		if err != nil {
 			return nil, err
 		}
 
-		topLevelStatements = append(topLevelStatements, *statement)
+		if statement.HasStatistics() || statement.GetAssertion() != nil {
+			return nil, ParsingErrorAtPosition(nwrToken.startPosition, "'%s' and '%s' are not supported in statements on '%s', use separate statements for nodes, ways and relations instead", statsExpression, assertExpression, objectTypeNwrExpression)
+		}
+		statements = append(statements, statement)
 	}
 
-	return query.NewQuery(topLevelStatements), nil
+	return statements, nil
 }
 
 func (p *Parser) parseStatement() (*query.Statement, error) {
@@ -136,12 +423,32 @@ func (p *Parser) parseStatement() (*query.Statement, error) {
 	}
 
 	// Then object type (e.g. "nodes")
-	p.moveToNextToken()
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected OSM object type")
+	}
+	queryTypeToken := p.moveToNextToken()
 	queryType, err := p.parseOsmQueryType(isContextAwareStatement)
 	if err != nil {
 		return nil, err
 	}
 
+	if isContextAwareStatement && len(p.contextObjectTypes) > 0 {
+		contextType := p.contextObjectTypes[len(p.contextObjectTypes)-1]
+		if !query.IsContextAccessSupported(contextType, queryType) {
+			return nil, ParsingErrorAtPosition(queryTypeToken.startPosition, "Context-aware statement 'this.%s' at position %d is not supported within a statement on %ss", queryType.String(), queryTypeToken.startPosition, contextType.String())
+		}
+	}
+
+	// Then an optional aggregation like ".stats(surface)"
+	var statisticsKeyToken *Token
+	if p.peekNextToken() != nil && p.peekNextToken().kind == TokenKindExpressionSeparator {
+		p.moveToNextToken()
+		statisticsKeyToken, err = p.parseStatsExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Then "{"
 	if !p.hasNextToken() {
 		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '{'")
@@ -151,8 +458,10 @@ func (p *Parser) parseStatement() (*query.Statement, error) {
 		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningBraces)
 	}
 
-	// Then a filter expression
+	// Then a filter expression, which is in the context of this statement
+	p.contextObjectTypes = append(p.contextObjectTypes, queryType.GetObjectType())
 	filterExpression, err := p.parseNextFilterExpressions()
+	p.contextObjectTypes = p.contextObjectTypes[:len(p.contextObjectTypes)-1]
 	if err != nil {
 		return nil, err
 	}
@@ -166,180 +475,753 @@ func (p *Parser) parseStatement() (*query.Statement, error) {
 		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingBraces)
 	}
 
-	return query.NewStatement(locationExpression, queryType, filterExpression), nil
-}
-
-func (p *Parser) parseLocationExpression() (query.LocationExpression, error) {
-	if !p.hasNextToken() {
-		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected keyword for location expression")
-	}
-	token := p.currentToken()
-	if token.kind != TokenKindKeyword || !common.Contains(locationExpressions, token.lexeme) && token.lexeme != contextAwareLocationExpression {
-		return nil, ParsingErrorExpectedButFound("location expression", token.startPosition, token.lexeme, token.kind)
+	statement := query.NewStatement(locationExpression, queryType, filterExpression)
+	if statisticsKeyToken != nil {
+		statement.SetStatisticsKey(statisticsKeyToken.lexeme, p.tagIndex.GetKeyIndexFromKeyString(statisticsKeyToken.lexeme))
 	}
 
-	var locationExpression query.LocationExpression
-	var err error
+	return statement, nil
+}
 
-	switch token.lexeme {
-	case bboxLocationExpression:
-		locationExpression, err = p.parseBboxLocationExpression()
-	case contextAwareLocationExpression:
-		locationExpression, err = query.NewContextAwareLocationExpression(), nil
-	default:
-		return nil, ParsingErrorExpectedButFound(fmt.Sprintf("location expression (one of: %s)", strings.Join(locationExpressions, ", ")), token.startPosition, token.lexeme, token.kind)
+// parseStatsExpression parses "stats(key)" and returns the token of the key. Only top-level statements can be
+// aggregated. The current token must be the "." before "stats".
+func (p *Parser) parseStatsExpression() (*Token, error) {
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '"+statsExpression+"'")
 	}
-
-	if err != nil {
-		return nil, err
+	token := p.moveToNextToken()
+	if token.kind != TokenKindKeyword || token.lexeme != statsExpression {
+		return nil, ParsingErrorExpectedButFound("'"+statsExpression+"' or '{'", token.startPosition, token.lexeme, token.kind)
 	}
-
-	return locationExpression, nil
-}
-
-func (p *Parser) parseBboxLocationExpression() (*query.BboxLocationExpression, error) {
-	token := p.currentToken()
-	if token.kind != TokenKindKeyword && token.lexeme != "bbox" {
-		return nil, ParsingErrorExpectedButFound("start of BBOX-Expression with 'bbox' keyword", token.startPosition, token.lexeme, token.kind)
+	if len(p.contextObjectTypes) > 0 {
+		return nil, ParsingErrorAtPosition(token.startPosition, "'%s' at position %d is only allowed in top-level statements", statsExpression, token.startPosition)
 	}
 
-	// Then a "(" is expected
 	if !p.hasNextToken() {
 		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
 	}
-	parenthesisToken := p.moveToNextToken()
-	if parenthesisToken.kind != TokenKindOpeningParenthesis {
+	token = p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
 		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
 	}
 
-	// Expect four numbers for the BBOX
-	var coordinates = [4]float64{}
-	for i := 0; i < 4; i++ {
-		token = p.moveToNextToken()
-		value, err := strconv.ParseFloat(token.lexeme, 64)
-		if token.kind != TokenKindNumber || err != nil {
-			return nil, ParsingErrorExpectedButFound("number as argument in BBOX-expression", token.startPosition, token.lexeme, token.kind)
-		}
-		coordinates[i] = value
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected key")
+	}
+	keyToken := p.moveToNextToken()
+	if keyToken.kind != TokenKindKeyword {
+		return nil, ParsingErrorExpectedButFound("key", keyToken.startPosition, keyToken.lexeme, keyToken.kind)
 	}
 
-	// Then a "(" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
 	token = p.moveToNextToken()
 	if token.kind != TokenKindClosingParenthesis {
 		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
 	}
 
-	return query.NewBboxLocationExpression(&orb.Bound{
-		Min: orb.Point{coordinates[0], coordinates[1]},
-		Max: orb.Point{coordinates[2], coordinates[3]},
-	}), nil
+	return keyToken, nil
 }
 
-func (p *Parser) parseOsmQueryType(isContextAwareStatement bool) (osm.OsmQueryType, error) {
-	token := p.currentToken()
-	if token.kind != TokenKindKeyword {
-		return -1, ParsingErrorExpectedButFound(fmt.Sprintf("OSM object type (%s, %s or %s)", objectTypeNodeExpression, objectTypeWaysExpression, objectTypeRelationsExpression), token.startPosition, token.lexeme, token.kind)
+// isIntrospection returns true when the statement starting at the current token is an introspection like "keys()" or
+// "bbox(...).values(highway)". Only the tokens are checked, so that the location isn't resolved twice.
+func (p *Parser) isIntrospection() bool {
+	i, _ := p.skipLocationTokens(p.index)
+	return i+1 < len(p.token) &&
+		p.token[i].kind == TokenKindKeyword &&
+		(p.token[i].lexeme == keysExpression || p.token[i].lexeme == valuesExpression) &&
+		p.token[i+1].kind == TokenKindOpeningParenthesis
+}
+
+// skipLocationTokens returns the index of the token after the location expression (including its arguments) and the
+// following "." when the token at the given index starts a location expression. Otherwise, the given index is returned
+// unchanged and the boolean is false.
+func (p *Parser) skipLocationTokens(i int) (int, bool) {
+	if i >= len(p.token) || p.token[i].kind != TokenKindKeyword || !common.Contains(locationExpressions, p.token[i].lexeme) {
+		return i, false
 	}
 
-	switch token.lexeme {
-	case objectTypeNodeExpression:
-		return osm.OsmQueryNode, nil
-	case objectTypeWaysExpression:
-		return osm.OsmQueryWay, nil
-	case objectTypeRelationsExpression:
-		return osm.OsmQueryRelation, nil
-	case objectTypeChildRelationsExpression:
-		if !isContextAwareStatement {
-			return -1, ParsingErrorExpectedButFound(fmt.Sprintf("OSM object type (%s, %s or %s)", objectTypeNodeExpression, objectTypeWaysExpression, objectTypeRelationsExpression), token.startPosition, token.lexeme, token.kind)
+	end := i + 1
+	if end < len(p.token) && p.token[end].kind == TokenKindOpeningParenthesis {
+		// Skip the arguments of the location
+		for end < len(p.token) && p.token[end].kind != TokenKindClosingParenthesis {
+			end++
 		}
-		return osm.OsmQueryChildRelation, nil
+		end++
 	}
-
-	return -1, ParsingErrorExpectedButFound(fmt.Sprintf("OSM object type (%s, %s or %s)", objectTypeNodeExpression, objectTypeWaysExpression, objectTypeRelationsExpression), token.startPosition, token.lexeme, token.kind)
+	if end >= len(p.token) || p.token[end].kind != TokenKindExpressionSeparator {
+		return i, false
+	}
+	return end + 1, true
 }
 
-func (p *Parser) parseNextFilterExpressions() (query.FilterExpression, error) {
-	expression, err := p.parseNextExpression()
-	if err != nil {
-		return nil, err
+// parseIntrospection parses "keys()" or "values(key)" with an optional location before it, e.g. "bbox(...).keys()".
+func (p *Parser) parseIntrospection() (*query.Introspection, error) {
+	var location query.LocationExpression
+	token := p.currentToken()
+	if token.lexeme != keysExpression && token.lexeme != valuesExpression {
+		var err error
+		location, err = p.parseLocationExpression()
+		if err != nil {
+			return nil, err
+		}
+		// Skip the "." after the location, which has been checked by isIntrospection
+		p.moveToNextToken()
+		token = p.moveToNextToken()
 	}
 
-	for {
+	// The "(" has been checked by isIntrospection
+	p.moveToNextToken()
+
+	var keyToken *Token
+	if token.lexeme == valuesExpression {
 		if !p.hasNextToken() {
-			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected filter expression or '}'")
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected key")
 		}
-
-		// Closing parentheses and braces are handles by calling functions
-		token := p.peekNextToken()
-		if token.kind == TokenKindClosingBraces {
-			break
-		} else if token.kind == TokenKindClosingParenthesis {
-			break
+		keyToken = p.moveToNextToken()
+		if keyToken.kind != TokenKindKeyword {
+			return nil, ParsingErrorExpectedButFound("key", keyToken.startPosition, keyToken.lexeme, keyToken.kind)
 		}
+	}
 
-		// nil check happened already above.
-		token = p.moveToNextToken()
-
-		// Expect AND, OR or '}' after expression
-		if token.kind == TokenKindKeyword {
-			// Handle conjunction/disjunction
-			switch token.lexeme {
-			case "AND":
-				// Exit recursion to create correct hierarchy of AND/OR operators
-				var secondExpression query.FilterExpression
-				secondExpression, err = p.parseNextExpression()
-				if err != nil {
-					return nil, err
-				}
-
-				expression = query.NewLogicalFilterExpression(expression, secondExpression, query.LogicOpAnd)
-			case "OR":
-				// Enter recursion to create correct hierarchy of AND/OR operators
-				var secondExpression query.FilterExpression
-				secondExpression, err = p.parseNextFilterExpressions()
-				if err != nil {
-					return nil, err
-				}
-
-				expression = query.NewLogicalFilterExpression(expression, secondExpression, query.LogicOpOr)
-			default:
-				return nil, ParsingErrorExpectedButFound("'AND' or 'OR'", token.startPosition, token.lexeme, token.kind)
-			}
-		} else {
-			return nil, ParsingErrorExpectedButFound("'}', ')', 'AND' or 'OR'", token.startPosition, token.lexeme, token.kind)
-		}
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	closingToken := p.moveToNextToken()
+	if closingToken.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(closingToken.startPosition, closingToken.lexeme, closingToken.kind, TokenKindClosingParenthesis)
 	}
 
-	return expression, nil
+	if keyToken == nil {
+		return query.NewKeysIntrospection(location), nil
+	}
+	return query.NewValuesIntrospection(location, keyToken.lexeme, p.tagIndex.GetKeyIndexFromKeyString(keyToken.lexeme)), nil
 }
 
-func (p *Parser) parseNextExpression() (query.FilterExpression, error) {
-	var expression query.FilterExpression
-	var err error
-	token := p.moveToNextToken()
-	switch token.kind {
-	case TokenKindOpeningParenthesis:
-		expression, err = p.parseNextFilterExpressions()
+// parseSpatialJoin parses the operator and the other statement of a spatial join like "within bbox(...).ways{...}" or
+// "near(50) bbox(...).ways{...}". The current token must be the operator keyword.
+func (p *Parser) parseSpatialJoin() (*query.SpatialJoin, error) {
+	operatorToken := p.currentToken()
+	operator := getSpatialOperator(operatorToken.lexeme)
+
+	var distance float64
+	if *operator == query.SpatialOpNear {
+		var err error
+		distance, err = p.parseNearDistance()
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		// Then a ")" is expected
-		token = p.moveToNextToken()
-		if token.kind != TokenKindClosingParenthesis {
-			return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
-		}
-	case TokenKindOperator:
-		if token.lexeme != "!" {
-			return nil, ParsingErrorExpectedButFound("'!' to start a new expression", token.startPosition, token.lexeme, token.kind)
-		}
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected statement after '"+operatorToken.lexeme+"'")
+	}
+	token := p.moveToNextToken()
+	if token.kind == TokenKindKeyword && token.lexeme == contextAwareLocationExpression {
+		return nil, ParsingErrorAtPosition(token.startPosition, "Context-aware statement at position %d not allowed in spatial join", token.startPosition)
+	}
 
-		expression, err = p.parseNegatedExpression(token, expression, err)
-		if err != nil {
-			return nil, err
-		}
-	case TokenKindKeyword:
+	statement, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if statement.HasStatistics() {
+		return nil, ParsingErrorAtPosition(token.startPosition, "'%s' not allowed in the statement of the spatial join at position %d", statsExpression, token.startPosition)
+	}
+
+	if *operator == query.SpatialOpNear {
+		return query.NewNearSpatialJoin(distance, statement), nil
+	}
+	return query.NewSpatialJoin(*operator, statement), nil
+}
+
+// parseNearDistance parses the distance in meters of "near(50)". The current token must be the "near" keyword.
+func (p *Parser) parseNearDistance() (float64, error) {
+	if !p.hasNextToken() {
+		return 0, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return 0, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	if !p.hasNextToken() {
+		return 0, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected distance in meters")
+	}
+	token = p.moveToNextToken()
+	distance, err := strconv.ParseFloat(token.lexeme, 64)
+	if token.kind != TokenKindNumber || err != nil || distance <= 0 {
+		return 0, ParsingErrorExpectedButFound("positive number as distance in meters", token.startPosition, token.lexeme, token.kind)
+	}
+
+	if !p.hasNextToken() {
+		return 0, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return 0, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	return distance, nil
+}
+
+func getSpatialOperator(keyword string) *query.SpatialOperator {
+	var operator query.SpatialOperator
+	switch keyword {
+	case spatialJoinWithinExpression:
+		operator = query.SpatialOpWithin
+	case spatialJoinContainsExpression:
+		operator = query.SpatialOpContains
+	case spatialJoinIntersectsExpression:
+		operator = query.SpatialOpIntersects
+	case spatialJoinNearExpression:
+		operator = query.SpatialOpNear
+	default:
+		return nil
+	}
+	return &operator
+}
+
+// parseOutputModifier parses a modifier of the result of a top-level statement like "select(...)". The current token
+// must be the "." before the modifier.
+func (p *Parser) parseOutputModifier(statement *query.Statement) error {
+	if !p.hasNextToken() {
+		return ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected output modifier like '"+selectExpression+"'")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindKeyword {
+		return ParsingErrorExpectedButFound("output modifier keyword", token.startPosition, token.lexeme, token.kind)
+	}
+
+	switch token.lexeme {
+	case selectExpression:
+		selectedKeys, err := p.parseSelectExpression()
+		if err != nil {
+			return err
+		}
+		statement.SetSelectedKeys(selectedKeys)
+	case centroidExpression:
+		return p.parseGeometryTransform(statement, query.GeometryTransformCentroid)
+	case bboxLocationExpression:
+		return p.parseGeometryTransform(statement, query.GeometryTransformBbox)
+	default:
+		return ParsingErrorAtPosition(token.startPosition, "Unknown output modifier '%s' at position %d", token.lexeme, token.startPosition)
+	}
+
+	return nil
+}
+
+// parseGeometryTransform parses the empty parentheses of transforms like "centroid()" and sets the transform on the
+// statement. Only one transform per statement is allowed. The current token must be the keyword of the transform.
+func (p *Parser) parseGeometryTransform(statement *query.Statement, transform query.GeometryTransform) error {
+	keywordToken := p.currentToken()
+	if statement.GetGeometryTransform() != query.GeometryTransformNone {
+		return ParsingErrorAtPosition(keywordToken.startPosition, "Geometry transform '%s' at position %d not allowed, the statement already has the transform '%s'", keywordToken.lexeme, keywordToken.startPosition, statement.GetGeometryTransform().String())
+	}
+
+	if !p.hasNextToken() {
+		return ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	if !p.hasNextToken() {
+		return ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	statement.SetGeometryTransform(transform)
+	return nil
+}
+
+// parseSelectExpression parses the key list of "select(name, amenity)" and returns the key indices. Keys not existing
+// in the tag-index are ignored, since no feature can have them anyway. The current token must be the "select" keyword.
+func (p *Parser) parseSelectExpression() ([]int, error) {
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	selectedKeys := []int{}
+	numberOfKeys := 0
+	for {
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected key or ')'")
+		}
+		token = p.moveToNextToken()
+		if token.kind == TokenKindClosingParenthesis {
+			break
+		}
+		if token.kind != TokenKindKeyword {
+			return nil, ParsingErrorExpectedButFound("key", token.startPosition, token.lexeme, token.kind)
+		}
+
+		numberOfKeys++
+		keyIndex := p.tagIndex.GetKeyIndexFromKeyString(token.lexeme)
+		if keyIndex == index.NotFound {
+			sigolo.Debugf("Selected key '%s' does not exist in the tag-index and is ignored", token.lexeme)
+			continue
+		}
+		selectedKeys = append(selectedKeys, keyIndex)
+	}
+
+	if numberOfKeys == 0 {
+		return nil, ParsingErrorAtPosition(token.startPosition, "Expected at least one key in '%s' at position %d", selectExpression, token.startPosition)
+	}
+
+	return selectedKeys, nil
+}
+
+// parseAssertion parses an assertion like "ASSERT count >= 100". The current token must be the "ASSERT" keyword.
+func (p *Parser) parseAssertion() (*query.Assertion, error) {
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '"+assertCountExpression+"' after '"+assertExpression+"'")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindKeyword || token.lexeme != assertCountExpression {
+		return nil, ParsingErrorExpectedButFound("'"+assertCountExpression+"' after '"+assertExpression+"'", token.startPosition, token.lexeme, token.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator")
+	}
+	p.moveToNextToken()
+	binaryOperator, err := p.parseBinaryOperator(token.lexeme, token.startPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected number as expected count")
+	}
+	token = p.moveToNextToken()
+	expectedCount, err := strconv.Atoi(token.lexeme)
+	if token.kind != TokenKindNumber || err != nil || expectedCount < 0 {
+		return nil, ParsingErrorExpectedButFound("positive integer as expected count", token.startPosition, token.lexeme, token.kind)
+	}
+
+	return query.NewCountAssertion(binaryOperator, expectedCount), nil
+}
+
+func (p *Parser) parseLocationExpression() (query.LocationExpression, error) {
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected keyword for location expression")
+	}
+	token := p.currentToken()
+	if token.kind != TokenKindKeyword || !common.Contains(locationExpressions, token.lexeme) && token.lexeme != contextAwareLocationExpression {
+		return nil, ParsingErrorExpectedButFound("location expression", token.startPosition, token.lexeme, token.kind)
+	}
+
+	if parsed, ok := p.parsedLocations[p.index]; ok {
+		p.index = parsed.endIndex
+		return parsed.expression, nil
+	}
+	startIndex := p.index
+
+	var locationExpression query.LocationExpression
+	var err error
+
+	switch token.lexeme {
+	case bboxLocationExpression:
+		locationExpression, err = p.parseBboxLocationExpression()
+	case allLocationExpression:
+		locationExpression, err = query.NewCoverageLocationExpression(), nil
+	case coverageLocationExpression:
+		locationExpression, err = p.parseCoverageLocationExpression()
+	case placeLocationExpression:
+		locationExpression, err = p.parsePlaceLocationExpression()
+	case areaByNameLocationExpression:
+		locationExpression, err = p.parseAreaByNameLocationExpression()
+	case alongLocationExpression:
+		locationExpression, err = p.parseAlongLocationExpression()
+	case contextAwareLocationExpression:
+		locationExpression, err = query.NewContextAwareLocationExpression(), nil
+	default:
+		return nil, ParsingErrorExpectedButFound(fmt.Sprintf("location expression (one of: %s)", strings.Join(locationExpressions, ", ")), token.startPosition, token.lexeme, token.kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.parsedLocations == nil {
+		p.parsedLocations = map[int]parsedLocation{}
+	}
+	p.parsedLocations[startIndex] = parsedLocation{expression: locationExpression, endIndex: p.index}
+
+	return locationExpression, nil
+}
+
+func (p *Parser) parseBboxLocationExpression() (*query.BboxLocationExpression, error) {
+	token := p.currentToken()
+	if token.kind != TokenKindKeyword && token.lexeme != "bbox" {
+		return nil, ParsingErrorExpectedButFound("start of BBOX-Expression with 'bbox' keyword", token.startPosition, token.lexeme, token.kind)
+	}
+
+	// Then a "(" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	parenthesisToken := p.moveToNextToken()
+	if parenthesisToken.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	// Expect four numbers for the BBOX
+	var coordinates = [4]float64{}
+	for i := 0; i < 4; i++ {
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected number as argument in BBOX-expression")
+		}
+		token = p.moveToNextToken()
+		value, err := strconv.ParseFloat(token.lexeme, 64)
+		if token.kind != TokenKindNumber || err != nil {
+			return nil, ParsingErrorExpectedButFound("number as argument in BBOX-expression", token.startPosition, token.lexeme, token.kind)
+		}
+		coordinates[i] = value
+	}
+
+	// Then a ")" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	return query.NewBboxLocationExpression(&orb.Bound{
+		Min: orb.Point{coordinates[0], coordinates[1]},
+		Max: orb.Point{coordinates[2], coordinates[3]},
+	}), nil
+}
+
+// parseCoverageLocationExpression parses the "coverage()" expression. The current token must be the "coverage" keyword.
+func (p *Parser) parseCoverageLocationExpression() (*query.CoverageLocationExpression, error) {
+	// Then "()" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	return query.NewCoverageLocationExpression(), nil
+}
+
+// parsePlaceLocationExpression parses the "place(<name>)" expression and resolves the name to the bbox of the place
+// using the index. The current token must be the "place" keyword.
+func (p *Parser) parsePlaceLocationExpression() (*query.BboxLocationExpression, error) {
+	// Then a "(" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	// Then the name of the place is expected, quotes are only needed for names with spaces and special characters
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected name of place")
+	}
+	nameToken := p.moveToNextToken()
+	if nameToken.kind != TokenKindString && nameToken.kind != TokenKindKeyword {
+		return nil, ParsingErrorExpectedButFound("name of place", nameToken.startPosition, nameToken.lexeme, nameToken.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	bbox, err := query.ResolvePlace(nameToken.lexeme, p.tagIndex, p.geometryIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to resolve place at position %d", nameToken.startPosition)
+	}
+
+	return query.NewBboxLocationExpression(bbox), nil
+}
+
+// parseAreaByNameLocationExpression parses the "areaByName(<name>)" and "areaByName(<name>, admin_level=<level>)"
+// expressions and resolves the name to the polygon of the administrative boundary using the index. The current token
+// must be the "areaByName" keyword.
+func (p *Parser) parseAreaByNameLocationExpression() (*query.AreaLocationExpression, error) {
+	// Then a "(" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	// Then the name of the area is expected, quotes are only needed for names with spaces and special characters
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected name of area")
+	}
+	nameToken := p.moveToNextToken()
+	if nameToken.kind != TokenKindString && nameToken.kind != TokenKindKeyword {
+		return nil, ParsingErrorExpectedButFound("name of area", nameToken.startPosition, nameToken.lexeme, nameToken.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')' or admin_level")
+	}
+	token = p.moveToNextToken()
+
+	// Optionally the admin level can be given as "admin_level=<level>"
+	adminLevel := ""
+	if token.kind == TokenKindKeyword && token.lexeme == adminLevelArgument {
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '='")
+		}
+		token = p.moveToNextToken()
+		if token.kind != TokenKindOperator || token.lexeme != "=" {
+			return nil, ParsingErrorExpectedButFound("'='", token.startPosition, token.lexeme, token.kind)
+		}
+
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected admin level")
+		}
+		token = p.moveToNextToken()
+		if token.kind != TokenKindNumber && token.kind != TokenKindKeyword && token.kind != TokenKindString {
+			return nil, ParsingErrorExpectedButFound("admin level", token.startPosition, token.lexeme, token.kind)
+		}
+		adminLevel = token.lexeme
+
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+		}
+		token = p.moveToNextToken()
+	}
+
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	area, err := query.ResolveArea(nameToken.lexeme, adminLevel, p.tagIndex, p.geometryIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to resolve area at position %d", nameToken.startPosition)
+	}
+
+	return query.NewAreaLocationExpression(nameToken.lexeme, area), nil
+}
+
+// parseAlongLocationExpression parses the "along(way:<id>, <distance>)" expression and resolves the way ID to the
+// geometry of the way using the index. The current token must be the "along" keyword.
+func (p *Parser) parseAlongLocationExpression() (*query.AlongLocationExpression, error) {
+	// Then a "(" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	// Then "way:<id>" is expected, which the lexer splits into the keyword "way:" and the number
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected 'way:<id>'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindKeyword || token.lexeme != wayIdPrefix {
+		return nil, ParsingErrorExpectedButFound("'way:<id>'", token.startPosition, token.lexeme, token.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected way ID")
+	}
+	wayIdToken := p.moveToNextToken()
+	wayId, err := strconv.ParseUint(wayIdToken.lexeme, 10, 64)
+	if wayIdToken.kind != TokenKindNumber || err != nil {
+		return nil, ParsingErrorExpectedButFound("way ID", wayIdToken.startPosition, wayIdToken.lexeme, wayIdToken.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected distance in meters")
+	}
+	token = p.moveToNextToken()
+	distance, err := strconv.ParseFloat(token.lexeme, 64)
+	if token.kind != TokenKindNumber || err != nil || distance <= 0 {
+		return nil, ParsingErrorExpectedButFound("positive number as distance in meters", token.startPosition, token.lexeme, token.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	way, err := query.ResolveWayGeometry(wayId, p.geometryIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to resolve way at position %d", wayIdToken.startPosition)
+	}
+
+	return query.NewAlongLocationExpression(wayId, way, distance), nil
+}
+
+func (p *Parser) parseOsmQueryType(isContextAwareStatement bool) (osm.OsmQueryType, error) {
+	token := p.currentToken()
+	if token.kind != TokenKindKeyword {
+		return -1, ParsingErrorExpectedButFound(fmt.Sprintf("OSM object type (%s, %s or %s)", objectTypeNodeExpression, objectTypeWaysExpression, objectTypeRelationsExpression), token.startPosition, token.lexeme, token.kind)
+	}
+
+	if token.lexeme == objectTypeNwrExpression && p.nwrQueryType != nil && !isContextAwareStatement {
+		// Only the object type of the top-level statement is replaced, "nwr" in its spatial join is not supported
+		queryType := *p.nwrQueryType
+		p.nwrQueryType = nil
+		return queryType, nil
+	}
+
+	switch token.lexeme {
+	case objectTypeNodeExpression:
+		return osm.OsmQueryNode, nil
+	case objectTypeWaysExpression:
+		return osm.OsmQueryWay, nil
+	case objectTypeRelationsExpression:
+		return osm.OsmQueryRelation, nil
+	case objectTypeChildRelationsExpression:
+		if !isContextAwareStatement {
+			return -1, ParsingErrorExpectedButFound(fmt.Sprintf("OSM object type (%s, %s or %s)", objectTypeNodeExpression, objectTypeWaysExpression, objectTypeRelationsExpression), token.startPosition, token.lexeme, token.kind)
+		}
+		return osm.OsmQueryChildRelation, nil
+	}
+
+	return -1, ParsingErrorExpectedButFound(fmt.Sprintf("OSM object type (%s, %s or %s)", objectTypeNodeExpression, objectTypeWaysExpression, objectTypeRelationsExpression), token.startPosition, token.lexeme, token.kind)
+}
+
+// parseNextFilterExpressions parses the filter expressions until the next closing brace or parenthesis and normalizes
+// the resulting expression tree.
+func (p *Parser) parseNextFilterExpressions() (query.FilterExpression, error) {
+	expression, err := p.parseLogicalExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.NormalizeFilterExpression(expression)
+}
+
+// parseLogicalExpression parses expressions combined by logical operators using precedence climbing. Only operators
+// with at least the given precedence are consumed, the others are left for the calling function. Operators with the
+// same precedence are left-associative, e.g. "a OR b OR c" is parsed as "(a OR b) OR c".
+func (p *Parser) parseLogicalExpression(minPrecedence int) (query.FilterExpression, error) {
+	expression, err := p.parseNextExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected filter expression or '}'")
+		}
+
+		// Closing parentheses and braces are handles by calling functions
+		token := p.peekNextToken()
+		if token.kind == TokenKindClosingBraces || token.kind == TokenKindClosingParenthesis {
+			break
+		}
+
+		// Expect AND, OR or '}' after expression
+		if token.kind != TokenKindKeyword {
+			return nil, ParsingErrorExpectedButFound("'}', ')', 'AND' or 'OR'", token.startPosition, token.lexeme, token.kind)
+		}
+		operator, precedence, ok := getLogicalOperator(token.lexeme)
+		if !ok {
+			return nil, ParsingErrorExpectedButFound("'AND' or 'OR'", token.startPosition, token.lexeme, token.kind)
+		}
+		if precedence < minPrecedence {
+			// Operator binds weaker than the one of the calling function, which therefore handles it.
+			break
+		}
+		p.moveToNextToken()
+
+		// The second operand only contains operators that bind stronger, which makes the operators left-associative.
+		var secondExpression query.FilterExpression
+		secondExpression, err = p.parseLogicalExpression(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		expression = query.NewLogicalFilterExpression(expression, secondExpression, operator)
+	}
+
+	return expression, nil
+}
+
+// getLogicalOperator returns the operator of the given lexeme and its precedence. Operators with a higher precedence
+// bind stronger, which means AND is evaluated before OR.
+func getLogicalOperator(lexeme string) (query.LogicalOperator, int, bool) {
+	switch lexeme {
+	case andExpression:
+		return query.LogicOpAnd, 2, true
+	case orExpression:
+		return query.LogicOpOr, 1, true
+	}
+	return -1, 0, false
+}
+
+func (p *Parser) parseNextExpression() (query.FilterExpression, error) {
+	var expression query.FilterExpression
+	var err error
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected filter expression")
+	}
+	token := p.moveToNextToken()
+	switch token.kind {
+	case TokenKindOpeningParenthesis:
+		// Parentheses only group the expressions, the whole tree is normalized afterward.
+		expression, err = p.parseLogicalExpression(0)
+		if err != nil {
+			return nil, err
+		}
+
+		// Then a ")" is expected
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+		}
+		token = p.moveToNextToken()
+		if token.kind != TokenKindClosingParenthesis {
+			return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+		}
+	case TokenKindOperator:
+		if token.lexeme != "!" {
+			return nil, ParsingErrorExpectedButFound("'!' to start a new expression", token.startPosition, token.lexeme, token.kind)
+		}
+
+		expression, err = p.parseNegatedExpression(token, expression, err)
+		if err != nil {
+			return nil, err
+		}
+	case TokenKindKeyword:
 		if token.lexeme == contextAwareLocationExpression {
+			if p.subStatementsNotAllowed {
+				return nil, ParsingErrorAtPosition(token.startPosition, "Context-aware statement at position %d is not supported here", token.startPosition)
+			}
+
 			// Some function call like "this.foo()" -> new statement starts
 			var statement *query.Statement
 			statement, err = p.parseStatement()
@@ -347,6 +1229,36 @@ func (p *Parser) parseNextExpression() (query.FilterExpression, error) {
 				return nil, err
 			}
 			return query.NewSubStatementFilterExpression(statement), err
+		} else if isNotKeyword(token, p.peekNextToken()) {
+			// Negation of the next expression, such as "NOT highway=primary"
+			expression, err = p.parseNotExpression()
+			if err != nil {
+				return nil, err
+			}
+		} else if isGeometryFunction(token, p.peekNextToken()) {
+			// Filter function without parameters, such as "is_area()"
+			expression, err = p.parseGeometryFunctionExpression(token)
+			if err != nil {
+				return nil, err
+			}
+		} else if isTypeFunction(token, p.peekNextToken()) {
+			// Filter by object type, such as "type()=node"
+			expression, err = p.parseTypeFunctionExpression(token)
+			if err != nil {
+				return nil, err
+			}
+		} else if token.lexeme == idExpression {
+			// Filter by OSM-ID, such as "id=123" or "id in (1, 2, 3)"
+			expression, err = p.parseIdExpression(token)
+			if err != nil {
+				return nil, err
+			}
+		} else if token.lexeme == changesetExpression || token.lexeme == userExpression {
+			// Filter by metadata, such as "changeset=123" or "user=SomeMapper"
+			expression, err = p.parseMetadataExpression(token)
+			if err != nil {
+				return nil, err
+			}
 		} else {
 			// General keyword, meaning a new expression starts, such as "highway=primary".
 
@@ -355,6 +1267,8 @@ func (p *Parser) parseNextExpression() (query.FilterExpression, error) {
 				return nil, err
 			}
 		}
+	default:
+		return nil, ParsingErrorExpectedButFound("filter expression", token.startPosition, token.lexeme, token.kind)
 	}
 
 	return expression, nil
@@ -366,7 +1280,7 @@ func (p *Parser) parseNegatedExpression(token *Token, expression query.FilterExp
 	}
 
 	token = p.peekNextToken()
-	if token.kind != TokenKindOpeningParenthesis && !(token.kind == TokenKindKeyword && token.lexeme == contextAwareLocationExpression) {
+	if token.kind != TokenKindOpeningParenthesis && !(token.kind == TokenKindKeyword && (token.lexeme == contextAwareLocationExpression || token.lexeme == isClosedExpression || token.lexeme == isAreaExpression)) {
 		// TODO Add "this" keyword here, which is another possible token after "!"
 		return nil, ParsingErrorExpectedButFound("'(' after '!'", token.startPosition, token.lexeme, token.kind)
 	}
@@ -379,13 +1293,44 @@ func (p *Parser) parseNegatedExpression(token *Token, expression query.FilterExp
 	return query.NewNegatedFilterExpression(expression), nil
 }
 
+// isNotKeyword returns true when the token is the "NOT" keyword negating the next expression. Keys with the same name
+// (e.g. "NOT=yes") are still possible.
+func isNotKeyword(token *Token, nextToken *Token) bool {
+	return token.lexeme == notExpression && nextToken != nil && (nextToken.kind != TokenKindOperator || nextToken.lexeme == "!")
+}
+
+// parseNotExpression parses the expression after the "NOT" keyword, which must be the current token. Like "!", the
+// keyword only negates the next expression and therefore binds stronger than AND and OR.
+func (p *Parser) parseNotExpression() (query.FilterExpression, error) {
+	token := p.peekNextToken()
+	if token.kind != TokenKindOpeningParenthesis && token.kind != TokenKindKeyword && token.kind != TokenKindOperator {
+		return nil, ParsingErrorExpectedButFound("expression after 'NOT'", token.startPosition, token.lexeme, token.kind)
+	}
+
+	expression, err := p.parseNextExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return query.NewNegatedFilterExpression(expression), nil
+}
+
 func (p *Parser) parseNormalExpression(token *Token) (query.FilterExpression, error) {
 	// We're on the key (e.g. "highway" in "highway=primary")
 	key := token.lexeme
 	keyPos := token.startPosition
-	keyIndex := p.tagIndex.GetKeyIndexFromKeyString(key)
+
+	// A "*" directly after the key (e.g. "addr:*=*") makes it a key prefix
+	nextToken := p.peekNextToken()
+	if nextToken != nil && nextToken.kind == TokenKindWildcard && nextToken.startPosition == keyPos+len(key) {
+		p.moveToNextToken()
+		return p.parseKeyPrefixExpression(key, keyPos)
+	}
 
 	// Parse operator (e.g. "=" in "highway=primary")
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator after key "+key)
+	}
 	p.moveToNextToken()
 	binaryOperator, err := p.parseBinaryOperator(key, keyPos)
 	if err != nil {
@@ -402,56 +1347,303 @@ func (p *Parser) parseNormalExpression(token *Token) (query.FilterExpression, er
 		return nil, ParsingErrorExpectedButFound("value after key "+key+binaryOperatorToken.lexeme, valueToken.startPosition, valueToken.lexeme, valueToken.kind)
 	}
 
-	if valueToken.kind == TokenKindWildcard {
+	if valueToken.kind == TokenKindWildcard && binaryOperator != query.BinOpEqual && binaryOperator != query.BinOpNotEqual {
+		return nil, ParsingErrorExpectedButFound("'=' or '!=' operator when using wildcard", token.startPosition, token.lexeme, token.kind)
+	}
+
+	keyExists := p.checkKey(key, keyPos)
+
+	if pattern, isPattern := p.parseValuePattern(valueToken); isPattern {
 		if binaryOperator != query.BinOpEqual && binaryOperator != query.BinOpNotEqual {
-			return nil, ParsingErrorExpectedButFound("'=' or '!=' operator when using wildcard", token.startPosition, token.lexeme, token.kind)
-		}
-
-		return query.NewKeyFilterExpression(keyIndex, binaryOperator == query.BinOpEqual), nil
-	} else {
-		_, valueIndex := p.tagIndex.GetIndicesFromKeyValueStrings(key, valueToken.lexeme)
-
-		if valueIndex == index.NotFound && binaryOperator.IsComparisonOperator() {
-			// Search for next smaller value and adjust binary operator. It can happen that we search for e.g.
-			// "width>=2.5" but the exact value "2.5" doesn't exist. Then we have to adjust the expression to
-			// "width>2" in case "2" is the next lower existing value for "2.5".
-			valueIndex, _ = p.tagIndex.GetNextLowerValueIndexForKey(keyIndex, valueToken.lexeme)
-
-			if valueIndex == index.NotFound {
-				// There is no lower value, the valueToken already contains a value lower than the lowest value
-				// in the tag index.
-				valueIndex = 0
-				if binaryOperator == query.BinOpGreater {
-					// Example: "width>-1"  ->  "width>=0"
-					binaryOperator = query.BinOpGreaterEqual
-				} else if binaryOperator == query.BinOpLowerEqual {
-					// Example: "width<=-1"  ->  "width<0"
-					binaryOperator = query.BinOpLower
-				}
-				// All other operators are ok, they do not distort/falsify the result of the expression.
-			} else {
-				// We found the next lower value for the given valueToken. We now might have to adjust the
-				// binary operator so that the meaning of the expression is still correct.
-				if binaryOperator == query.BinOpGreaterEqual {
-					// Example: "width>=2.5"  ->  "width>2"
-					binaryOperator = query.BinOpGreater
-				} else if binaryOperator == query.BinOpLower {
-					// Example: "width<2.5"  ->  "width<=2"
-					binaryOperator = query.BinOpLowerEqual
-				}
-				// All other operators are ok, they do not distort/falsify the result of the expression.
-			}
+			return nil, ParsingErrorExpectedButFound("'=' or '!=' operator when using value pattern", binaryOperatorToken.startPosition, binaryOperatorToken.lexeme, binaryOperatorToken.kind)
 		}
+		return query.NewValuePatternFilterExpression(p.tagIndex, key, pattern, binaryOperator), nil
+	}
 
-		return query.NewTagFilterExpression(keyIndex, valueIndex, binaryOperator), nil
+	// Comparisons work with values not existing in the tag-index, s. query.NewTagFilterExpressionFromStrings.
+	if keyExists && valueToken.kind != TokenKindWildcard && !binaryOperator.IsComparisonOperator() {
+		p.checkValue(key, valueToken.lexeme, valueToken.startPosition)
 	}
+
+	return query.NewTagFilterExpressionFromStrings(p.tagIndex, key, valueToken.lexeme, valueToken.kind == TokenKindWildcard, binaryOperator), nil
 }
 
-func (p *Parser) parseBinaryOperator(previousLexeme string, previousLexemePos int) (query.BinaryOperator, error) {
+// parseValuePattern collects the tokens directly following the given value token (without whitespace in between) into a
+// glob pattern, e.g. "Super*" or "*market". The boolean is false when the value is no pattern, i.e. a plain value or
+// the single wildcard "*". Quoted values are never patterns, which allows to match values containing a "*" literally.
+func (p *Parser) parseValuePattern(valueToken *Token) (string, bool) {
+	if !isValuePatternToken(valueToken) {
+		return "", false
+	}
+
+	pattern := valueToken.lexeme
+	patternEnd := valueToken.startPosition + len(valueToken.lexeme)
+	for nextToken := p.peekNextToken(); nextToken != nil && nextToken.startPosition == patternEnd && isValuePatternToken(nextToken); nextToken = p.peekNextToken() {
+		p.moveToNextToken()
+		pattern += nextToken.lexeme
+		patternEnd += len(nextToken.lexeme)
+	}
+
+	return pattern, pattern != TokenKindWildcard.Lexeme() && strings.Contains(pattern, TokenKindWildcard.Lexeme())
+}
+
+func isValuePatternToken(token *Token) bool {
+	return token.kind == TokenKindKeyword || token.kind == TokenKindNumber || token.kind == TokenKindWildcard
+}
+
+// parseKeyPrefixExpression parses expressions like "addr:*=*" or "addr:*!=*". The current token must be the wildcard
+// after the key prefix. Only the wildcard values are supported, since the values of different keys can't be compared.
+func (p *Parser) parseKeyPrefixExpression(prefix string, prefixPos int) (query.FilterExpression, error) {
 	if !p.hasNextToken() {
-		return query.BinOpInvalid, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator")
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator after key prefix "+prefix+"*")
+	}
+	p.moveToNextToken()
+	binaryOperator, err := p.parseBinaryOperator(prefix+"*", prefixPos)
+	if err != nil {
+		return nil, err
+	}
+	binaryOperatorToken := p.currentToken()
+	if binaryOperator != query.BinOpEqual && binaryOperator != query.BinOpNotEqual {
+		return nil, ParsingErrorExpectedButFound("'=' or '!=' operator after key prefix "+prefix+"*", binaryOperatorToken.startPosition, binaryOperatorToken.lexeme, binaryOperatorToken.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '*' after key prefix "+prefix+"*"+binaryOperatorToken.lexeme)
+	}
+	valueToken := p.moveToNextToken()
+	if valueToken.kind != TokenKindWildcard {
+		return nil, ParsingErrorExpectedTokenKind(valueToken.startPosition, valueToken.lexeme, valueToken.kind, TokenKindWildcard)
+	}
+
+	return query.NewKeyPrefixFilterExpression(p.tagIndex, prefix, binaryOperator == query.BinOpEqual), nil
+}
+
+// isGeometryFunction returns true when the token is the name of a geometry filter function followed by "(". Keys with the
+// same name (e.g. "is_area=yes") are still possible.
+func isGeometryFunction(token *Token, nextToken *Token) bool {
+	isFunctionName := token.lexeme == isClosedExpression || token.lexeme == isAreaExpression
+	return isFunctionName && nextToken != nil && nextToken.kind == TokenKindOpeningParenthesis
+}
+
+// parseGeometryFunctionExpression parses filter functions like "is_closed()". The current token must be the function
+// name.
+func (p *Parser) parseGeometryFunctionExpression(token *Token) (query.FilterExpression, error) {
+	functionName := token.lexeme
+
+	// The "(" has already been checked by isGeometryFunction
+	p.moveToNextToken()
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	if functionName == isAreaExpression {
+		return query.NewAreaFilterExpression(p.tagIndex), nil
+	}
+	return query.NewClosedFilterExpression(), nil
+}
+
+// isTypeFunction returns true when the token is the "type" keyword followed by "(". The tag key "type" (e.g.
+// "type=multipolygon") is still possible.
+func isTypeFunction(token *Token, nextToken *Token) bool {
+	return token.lexeme == typeExpression && nextToken != nil && nextToken.kind == TokenKindOpeningParenthesis
+}
+
+// parseTypeFunctionExpression parses expressions like "type()=node" or "type()!=relation". The current token must be
+// the "type" keyword.
+func (p *Parser) parseTypeFunctionExpression(token *Token) (query.FilterExpression, error) {
+	functionPos := token.startPosition
+
+	// The "(" has already been checked by isTypeFunction
+	p.moveToNextToken()
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator after '"+typeExpression+"()'")
+	}
+	p.moveToNextToken()
+	binaryOperator, err := p.parseBinaryOperator(typeExpression+"()", functionPos)
+	if err != nil {
+		return nil, err
+	}
+	binaryOperatorToken := p.currentToken()
+	if binaryOperator != query.BinOpEqual && binaryOperator != query.BinOpNotEqual {
+		return nil, ParsingErrorExpectedButFound("'=' or '!=' operator after '"+typeExpression+"()'", binaryOperatorToken.startPosition, binaryOperatorToken.lexeme, binaryOperatorToken.kind)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected object type after '"+typeExpression+"()"+binaryOperatorToken.lexeme+"'")
+	}
+	valueToken := p.moveToNextToken()
+	var objectType osm.OsmObjectType
+	switch valueToken.lexeme {
+	case osm.OsmObjNode.String():
+		objectType = osm.OsmObjNode
+	case osm.OsmObjWay.String():
+		objectType = osm.OsmObjWay
+	case osm.OsmObjRelation.String():
+		objectType = osm.OsmObjRelation
+	default:
+		return nil, ParsingErrorExpectedButFound("object type 'node', 'way' or 'relation'", valueToken.startPosition, valueToken.lexeme, valueToken.kind)
+	}
+
+	return query.NewTypeFilterExpression(objectType, binaryOperator == query.BinOpEqual), nil
+}
+
+func (p *Parser) parseIdExpression(token *Token) (query.FilterExpression, error) {
+	// We're on the "id" keyword
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator or '"+idListExpression+"' after '"+idExpression+"'")
+	}
+
+	token = p.moveToNextToken()
+	if token.kind == TokenKindKeyword && token.lexeme == idListExpression {
+		return p.parseIdListExpression()
+	}
+
+	// Parse operator (e.g. ">" in "id>123")
+	binaryOperator, err := p.parseBinaryOperator(idExpression, token.startPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ID after "+idExpression+token.lexeme)
+	}
+	id, err := p.parseId(p.moveToNextToken())
+	if err != nil {
+		return nil, err
+	}
+
+	return query.NewIdFilterExpression(id, binaryOperator), nil
+}
+
+// parseMetadataExpression parses a "changeset=123" or "user=SomeMapper" expression. The current token must be the
+// "changeset" or "user" keyword. Unknown users are valid, since they just don't match any feature.
+func (p *Parser) parseMetadataExpression(token *Token) (query.FilterExpression, error) {
+	keywordToken := token
+	if !p.tagIndex.HasUsers() {
+		return nil, ParsingErrorAtPosition(keywordToken.startPosition, "Filter '%s' at position %d needs the metadata of the OSM objects, which the index doesn't contain. Import the data with metadata (--store-metadata) to use it.", keywordToken.lexeme, keywordToken.startPosition)
 	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator after '"+keywordToken.lexeme+"'")
+	}
+	token = p.moveToNextToken()
+	binaryOperator, err := p.parseBinaryOperator(keywordToken.lexeme, keywordToken.startPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected value after "+keywordToken.lexeme+token.lexeme)
+	}
+	valueToken := p.moveToNextToken()
+
+	if keywordToken.lexeme == changesetExpression {
+		changeset, err := p.parseId(valueToken)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewChangesetFilterExpression(changeset, binaryOperator), nil
+	}
+
+	if binaryOperator != query.BinOpEqual && binaryOperator != query.BinOpNotEqual {
+		return nil, ParsingErrorExpectedButFound("'=' or '!=' operator after '"+userExpression+"'", token.startPosition, token.lexeme, token.kind)
+	}
+	if valueToken.kind != TokenKindKeyword && valueToken.kind != TokenKindNumber && valueToken.kind != TokenKindString {
+		return nil, ParsingErrorExpectedButFound("user name", valueToken.startPosition, valueToken.lexeme, valueToken.kind)
+	}
+	return query.NewUserFilterExpression(p.tagIndex.GetUserIndex(valueToken.lexeme), binaryOperator), nil
+}
+
+// parseIdListExpression parses the list of IDs of an "id in (1, 2, 3)" expression. The current token must be the "in"
+// keyword.
+func (p *Parser) parseIdListExpression() (query.FilterExpression, error) {
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	var ids []uint64
+	for {
+		if !p.hasNextToken() {
+			return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ID or ')'")
+		}
+
+		token = p.moveToNextToken()
+		if token.kind == TokenKindClosingParenthesis {
+			break
+		}
+
+		id, err := p.parseId(token)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, ParsingErrorExpectedButFound("at least one ID in ID list", token.startPosition, token.lexeme, token.kind)
+	}
+
+	return query.NewIdListFilterExpression(ids), nil
+}
+
+// parseId parses the given number token as OSM-ID. Besides normal integers, powers like "10^9" are supported.
+func (p *Parser) parseId(token *Token) (uint64, error) {
+	if token.kind != TokenKindNumber {
+		return 0, ParsingErrorExpectedButFound("ID as number", token.startPosition, token.lexeme, token.kind)
+	}
+
+	baseAndExponent := strings.Split(token.lexeme, "^")
+	if len(baseAndExponent) > 2 {
+		return 0, ParsingErrorExpectedButFound("ID as integer or power (e.g. 10^9)", token.startPosition, token.lexeme, token.kind)
+	}
+
+	id, err := strconv.ParseUint(baseAndExponent[0], 10, 64)
+	if err != nil {
+		return 0, ParsingErrorExpectedButFound("ID as integer", token.startPosition, token.lexeme, token.kind)
+	}
+
+	if len(baseAndExponent) == 2 {
+		exponent, err := strconv.ParseUint(baseAndExponent[1], 10, 64)
+		if err != nil {
+			return 0, ParsingErrorExpectedButFound("integer as exponent of ID", token.startPosition, token.lexeme, token.kind)
+		}
+
+		base := id
+		id = 1
+		for i := uint64(0); i < exponent; i++ {
+			if id > math.MaxUint64/max(base, 1) {
+				return 0, ParsingErrorExpectedButFound("ID within the 64-bit integer range", token.startPosition, token.lexeme, token.kind)
+			}
+			id *= base
+		}
+	}
+
+	return id, nil
+}
+
+func (p *Parser) parseBinaryOperator(previousLexeme string, previousLexemePos int) (query.BinaryOperator, error) {
 	token := p.currentToken()
+	if token == nil {
+		return query.BinOpInvalid, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected binary operator")
+	}
 	if token.kind != TokenKindOperator {
 		return query.BinOpInvalid, ParsingErrorExpectedButFound("Expected binary operator", token.startPosition, token.lexeme, token.kind)
 	}
@@ -470,6 +1662,6 @@ func (p *Parser) parseBinaryOperator(previousLexeme string, previousLexemePos in
 	case "<=":
 		return query.BinOpLowerEqual, nil
 	default:
-		return query.BinOpInvalid, errors.Errorf("Expected binary operator (e.g. '>=') after '%s' (position %d) but found kind=%d with lexeme=%s", previousLexeme, previousLexemePos, token.kind, token.lexeme)
+		return query.BinOpInvalid, ParsingErrorAtPosition(previousLexemePos, "Expected binary operator (e.g. '>=') after '%s' (position %d) but found kind=%d with lexeme=%s", previousLexeme, previousLexemePos, token.kind, token.lexeme)
 	}
 }
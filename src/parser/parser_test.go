@@ -1,12 +1,15 @@
 package parser
 
 import (
+	"fmt"
 	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
 	"soq/common"
-	"soq/feature"
 	"soq/index"
+	"soq/osm"
 	"soq/query"
 	"testing"
+	"time"
 )
 
 func TestParser_currentAndNextToken(t *testing.T) {
@@ -161,7 +164,7 @@ func TestParser_parseOsmObjectType(t *testing.T) {
 
 	// Assert
 	common.AssertNil(t, err)
-	common.AssertEqual(t, feature.OsmQueryNode, queryType)
+	common.AssertEqual(t, osm.OsmQueryNode, queryType)
 	common.AssertEqual(t, 0, parser.index)
 }
 
@@ -180,7 +183,7 @@ func TestParser_parseOsmObjectType_butNotChildRelationsOnNormalExpression(t *tes
 
 	// Assert
 	common.AssertNotNil(t, err)
-	common.AssertEqual(t, feature.OsmQueryType(-1), queryType)
+	common.AssertEqual(t, osm.OsmQueryType(-1), queryType)
 }
 
 func TestParser_parseOsmObjectType_childRelations(t *testing.T) {
@@ -198,7 +201,7 @@ func TestParser_parseOsmObjectType_childRelations(t *testing.T) {
 
 	// Assert
 	common.AssertNil(t, err)
-	common.AssertEqual(t, feature.OsmQueryChildRelation, queryType)
+	common.AssertEqual(t, osm.OsmQueryChildRelation, queryType)
 	common.AssertEqual(t, 0, parser.index)
 }
 
@@ -273,6 +276,27 @@ func TestParser_parseNextExpression_simpleTagFilter(t *testing.T) {
 	common.AssertEqual(t, query.BinOpEqual, operator)
 }
 
+func TestParser_parseNextExpression_elevationComparison(t *testing.T) {
+	// Arrange
+	parser := &Parser{
+		token: []*Token{
+			{kind: TokenKindKeyword, lexeme: "ele", startPosition: 0},
+			{kind: TokenKindOperator, lexeme: ">", startPosition: 3},
+			{kind: TokenKindKeyword, lexeme: "1000", startPosition: 4},
+		},
+		index:    -1, // Because of "moveToNextToken()" call in parser function
+		tagIndex: index.NewTagIndex([]string{"ele"}, [][]string{{"500", "1200"}}),
+	}
+
+	// Act
+	expression, err := parser.parseNextExpression()
+
+	// Assert
+	common.AssertNil(t, err)
+	_, isElevationFilterExpression := expression.(*query.ElevationFilterExpression)
+	common.AssertTrue(t, isElevationFilterExpression)
+}
+
 func TestParser_parseNextExpression_simpleInnerStatement(t *testing.T) {
 	// Arrange
 	parser := &Parser{
@@ -579,3 +603,1191 @@ func TestParser_parseBinaryOperator_invalidAndNotExistingToken(t *testing.T) {
 	common.AssertNotNil(t, err)
 	common.AssertEqual(t, query.BinOpInvalid, operator)
 }
+
+func TestParser_parseNextExpression_idFilter(t *testing.T) {
+	// Arrange
+	parser := &Parser{
+		token: []*Token{
+			{kind: TokenKindKeyword, lexeme: "id", startPosition: 0},
+			{kind: TokenKindOperator, lexeme: ">", startPosition: 2},
+			{kind: TokenKindNumber, lexeme: "10^9", startPosition: 3},
+		},
+		index: -1, // Because of "moveToNextToken()" call in parser function
+	}
+
+	// Act
+	expression, err := parser.parseNextExpression()
+
+	// Assert
+	common.AssertNil(t, err)
+	idFilterExpression, isIdFilterExpression := expression.(*query.IdFilterExpression)
+	common.AssertTrue(t, isIdFilterExpression)
+	common.AssertFalse(t, idFilterExpression.AppliesToId(1_000_000_000))
+	common.AssertTrue(t, idFilterExpression.AppliesToId(1_000_000_001))
+}
+
+func TestParser_parseNextExpression_idListFilter(t *testing.T) {
+	// Arrange
+	parser := &Parser{
+		token: []*Token{
+			{kind: TokenKindKeyword, lexeme: "id", startPosition: 0},
+			{kind: TokenKindKeyword, lexeme: "in", startPosition: 3},
+			{kind: TokenKindOpeningParenthesis, lexeme: "(", startPosition: 6},
+			{kind: TokenKindNumber, lexeme: "1", startPosition: 7},
+			{kind: TokenKindNumber, lexeme: "23", startPosition: 10},
+			{kind: TokenKindClosingParenthesis, lexeme: ")", startPosition: 12},
+		},
+		index: -1, // Because of "moveToNextToken()" call in parser function
+	}
+
+	// Act
+	expression, err := parser.parseNextExpression()
+
+	// Assert
+	common.AssertNil(t, err)
+	idFilterExpression, isIdFilterExpression := expression.(*query.IdFilterExpression)
+	common.AssertTrue(t, isIdFilterExpression)
+	common.AssertTrue(t, idFilterExpression.AppliesToId(1))
+	common.AssertTrue(t, idFilterExpression.AppliesToId(23))
+	common.AssertFalse(t, idFilterExpression.AppliesToId(2))
+}
+
+func TestParser_parseNextExpression_invalidId(t *testing.T) {
+	// Arrange
+	parser := &Parser{
+		token: []*Token{
+			{kind: TokenKindKeyword, lexeme: "id", startPosition: 0},
+			{kind: TokenKindOperator, lexeme: "=", startPosition: 2},
+			{kind: TokenKindNumber, lexeme: "1.5", startPosition: 3},
+		},
+		index: -1, // Because of "moveToNextToken()" call in parser function
+	}
+
+	// Act
+	expression, err := parser.parseNextExpression()
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, expression)
+}
+
+func TestParser_parseAssertion(t *testing.T) {
+	// Arrange
+	queryString := "bbox(1,2,3,4).nodes{ id=1 } ASSERT count >= 100"
+
+	// Act
+	q, err := ParseQueryString(queryString, nil, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertNotNil(t, q)
+	common.AssertEqual(t, query.NewCountAssertion(query.BinOpGreaterEqual, 100), q.GetTopLevelStatements()[0].GetAssertion())
+}
+
+func TestParser_parseAssertion_multipleStatements(t *testing.T) {
+	// Arrange
+	queryString := "bbox(1,2,3,4).nodes{ id=1 } ASSERT count = 1 bbox(1,2,3,4).ways{ id=2 }"
+
+	// Act
+	q, err := ParseQueryString(queryString, nil, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 2, len(q.GetTopLevelStatements()))
+	common.AssertNotNil(t, q.GetTopLevelStatements()[0].GetAssertion())
+	common.AssertNil(t, q.GetTopLevelStatements()[1].GetAssertion())
+}
+
+func TestParser_parseAssertion_invalidCount(t *testing.T) {
+	// Arrange
+	queryString := "bbox(1,2,3,4).nodes{ id=1 } ASSERT count >= foo"
+
+	// Act
+	q, err := ParseQueryString(queryString, nil, nil)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, q)
+}
+
+func TestParser_parseLocationExpression_coverage(t *testing.T) {
+	for _, queryString := range []string{"all.nodes{ id=1 }", "coverage().nodes{ id=1 }"} {
+		// Act
+		q, err := ParseQueryString(queryString, nil, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		_, isCoverageLocationExpression := q.GetTopLevelStatements()[0].GetLocationExpression().(*query.CoverageLocationExpression)
+		common.AssertTrue(t, isCoverageLocationExpression)
+	}
+}
+
+func TestParser_sameQueryAsBuilder(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "seats"}, [][]string{{"bench", "toilets"}, {"2", "3"}})
+
+	// Act
+	parsedQuery, err := ParseQueryString("bbox(1,2,3,4).nodes{ amenity=bench AND seats>=2.5 AND this.ways{ amenity=* } }", tagIndex, nil)
+	common.AssertNil(t, err)
+	builtQuery, err := query.Builder().
+		Bbox(1, 2, 3, 4).Nodes().
+		Where(query.Tag("amenity", "bench")).
+		And(query.TagWithOperator("seats", query.BinOpGreaterEqual, "2.5")).
+		And(query.This().Ways().Where(query.Tag("amenity", "*"))).
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, parsedQuery, builtQuery)
+}
+
+func TestParser_parseSelect(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "name", "opening_hours"}, [][]string{{"cafe"}, {"Foo"}, {"24/7"}})
+	queryString := "bbox(1,2,3,4).nodes{ amenity=cafe }.select(name, opening_hours, foo) ASSERT count > 0 bbox(1,2,3,4).ways{ amenity=cafe }"
+
+	// Act
+	q, err := ParseQueryString(queryString, tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 2, len(q.GetTopLevelStatements()))
+	common.AssertEqual(t, []int{1, 2}, q.GetTopLevelStatements()[0].GetSelectedKeys())
+	common.AssertNotNil(t, q.GetTopLevelStatements()[0].GetAssertion())
+	common.AssertNil(t, q.GetTopLevelStatements()[1].GetSelectedKeys())
+}
+
+func TestParser_parseSelect_onlyUnknownKeys(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"cafe"}})
+
+	// Act
+	q, err := ParseQueryString("bbox(1,2,3,4).nodes{ amenity=cafe }.select(foo)", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []int{}, q.GetTopLevelStatements()[0].GetSelectedKeys())
+}
+
+func TestParser_parseSelect_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"cafe"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nodes{ amenity=cafe }.select()",
+		"bbox(1,2,3,4).nodes{ amenity=cafe }.select(amenity",
+		"bbox(1,2,3,4).nodes{ amenity=cafe }.select amenity",
+		"bbox(1,2,3,4).nodes{ amenity=cafe }.foo(amenity)",
+		"bbox(1,2,3,4).nodes{ amenity=cafe }.",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_sameSelectAsBuilder(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "name"}, [][]string{{"cafe"}, {"Foo"}})
+
+	// Act
+	parsedQuery, err := ParseQueryString("bbox(1,2,3,4).nodes{ amenity=cafe }.select(name, foo)", tagIndex, nil)
+	common.AssertNil(t, err)
+	builtQuery, err := query.Builder().
+		Bbox(1, 2, 3, 4).Nodes().
+		Where(query.Tag("amenity", "cafe")).
+		Select("name", "foo").
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, parsedQuery, builtQuery)
+}
+
+func TestParser_parseGeometryTransform(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "name"}, [][]string{{"cafe"}, {"Foo"}})
+	queryString := "bbox(1,2,3,4).ways{ amenity=cafe }.select(name).centroid() bbox(1,2,3,4).relations{ amenity=cafe }.bbox() bbox(1,2,3,4).ways{ amenity=cafe }"
+
+	// Act
+	q, err := ParseQueryString(queryString, tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 3, len(q.GetTopLevelStatements()))
+	common.AssertEqual(t, query.GeometryTransformCentroid, q.GetTopLevelStatements()[0].GetGeometryTransform())
+	common.AssertEqual(t, []int{1}, q.GetTopLevelStatements()[0].GetSelectedKeys())
+	common.AssertEqual(t, query.GeometryTransformBbox, q.GetTopLevelStatements()[1].GetGeometryTransform())
+	common.AssertEqual(t, query.GeometryTransformNone, q.GetTopLevelStatements()[2].GetGeometryTransform())
+}
+
+func TestParser_parseGeometryTransform_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"cafe"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).ways{ amenity=cafe }.centroid(",
+		"bbox(1,2,3,4).ways{ amenity=cafe }.centroid(amenity)",
+		"bbox(1,2,3,4).ways{ amenity=cafe }.centroid",
+		"bbox(1,2,3,4).ways{ amenity=cafe }.bbox(1,2,3,4)",
+		"bbox(1,2,3,4).ways{ amenity=cafe }.centroid().bbox()",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_sameGeometryTransformAsBuilder(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"cafe"}})
+
+	// Act
+	parsedQuery, err := ParseQueryString("bbox(1,2,3,4).ways{ amenity=cafe }.bbox()", tagIndex, nil)
+	common.AssertNil(t, err)
+	builtQuery, err := query.Builder().
+		Bbox(1, 2, 3, 4).Ways().
+		Where(query.Tag("amenity", "cafe")).
+		AsBbox().
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, parsedQuery, builtQuery)
+}
+
+func TestParser_parseStats(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway", "surface"}, [][]string{{"primary"}, {"asphalt"}})
+	queryString := "bbox(1,2,3,4).ways.stats(surface){ highway=* } ASSERT count > 0 bbox(1,2,3,4).nodes.stats(foo){ highway=primary }"
+
+	// Act
+	q, err := ParseQueryString(queryString, tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertTrue(t, q.HasStatistics())
+	common.AssertTrue(t, q.GetTopLevelStatements()[0].HasStatistics())
+	common.AssertNotNil(t, q.GetTopLevelStatements()[0].GetAssertion())
+	common.AssertTrue(t, q.GetTopLevelStatements()[1].HasStatistics())
+}
+
+func TestParser_parseStats_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"highway", "surface"}, [][]string{{"primary"}, {"asphalt"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).ways.stats(){ highway=* }",
+		"bbox(1,2,3,4).ways.stats(surface, highway){ highway=* }",
+		"bbox(1,2,3,4).ways.stats(surface{ highway=* }",
+		"bbox(1,2,3,4).ways.select(surface){ highway=* }",
+		"bbox(1,2,3,4).ways.stats(surface){ highway=* } bbox(1,2,3,4).ways{ highway=* }",
+		"bbox(1,2,3,4).ways{ highway=* AND this.nodes.stats(surface){ highway=* } }",
+		"bbox(1,2,3,4).ways{ highway=* } within bbox(1,2,3,4).ways.stats(surface){ highway=* }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseNwr(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "name"}, [][]string{{"bench"}, {"Foo"}})
+
+	// Act
+	nwrQuery, err := ParseQueryString("bbox(1,2,3,4).nwr{ amenity=bench }.select(name) bbox(1,2,3,4).ways{ name=Foo }", tagIndex, nil)
+	common.AssertNil(t, err)
+	expectedQuery, err := ParseQueryString("bbox(1,2,3,4).nodes{ amenity=bench }.select(name) bbox(1,2,3,4).ways{ amenity=bench }.select(name) bbox(1,2,3,4).relations{ amenity=bench }.select(name) bbox(1,2,3,4).ways{ name=Foo }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, expectedQuery, nwrQuery)
+}
+
+func TestParser_parseNwr_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"amenity", "name"}, [][]string{{"bench"}, {"Foo"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nwr.stats(name){ amenity=bench }",
+		"bbox(1,2,3,4).nwr{ amenity=bench } ASSERT count > 0",
+		"bbox(1,2,3,4).nwr{ amenity=bench } within bbox(1,2,3,4).nwr{ name=Foo }",
+		"bbox(1,2,3,4).ways{ amenity=bench AND this.nwr{ name=Foo } }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseIntrospection(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway", "surface"}, [][]string{{"primary"}, {"asphalt"}})
+
+	// Act
+	keysQuery, keysErr := ParseQueryString("keys()", tagIndex, nil)
+	valuesQuery, valuesErr := ParseQueryString("bbox(1,2,3,4).values(surface)", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, keysErr)
+	common.AssertEqual(t, query.NewIntrospectionQuery(query.NewKeysIntrospection(nil)), keysQuery)
+	common.AssertNil(t, valuesErr)
+	expectedLocation := query.NewBboxLocationExpression(&orb.Bound{Min: orb.Point{1, 2}, Max: orb.Point{3, 4}})
+	common.AssertEqual(t, query.NewIntrospectionQuery(query.NewValuesIntrospection(expectedLocation, "surface", 1)), valuesQuery)
+}
+
+func TestParser_parseIntrospection_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"highway", "surface"}, [][]string{{"primary"}, {"asphalt"}})
+	for _, queryString := range []string{
+		"keys(highway)",
+		"values()",
+		"values(surface",
+		"keys() bbox(1,2,3,4).ways{ highway=* }",
+		"bbox(1,2,3,4).ways{ highway=* } keys()",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_sameStatsAsBuilder(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway", "surface"}, [][]string{{"primary"}, {"asphalt"}})
+
+	// Act
+	parsedQuery, err := ParseQueryString("bbox(1,2,3,4).ways.stats(surface){ highway=primary }", tagIndex, nil)
+	common.AssertNil(t, err)
+	builtQuery, err := query.Builder().
+		Bbox(1, 2, 3, 4).Ways().
+		Stats("surface").
+		Where(query.Tag("highway", "primary")).
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, parsedQuery, builtQuery)
+}
+
+func TestParser_parseSpatialJoin(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "landuse", "name"}, [][]string{{"bench"}, {"park"}, {"Foo"}})
+	queryString := "bbox(1,2,3,4).nodes{ amenity=bench } within bbox(1,2,3,4).ways{ landuse=park }.select(name) ASSERT count > 0 bbox(1,2,3,4).ways{ landuse=park } intersects bbox(1,2,3,4).relations{ landuse=park }"
+
+	// Act
+	q, err := ParseQueryString(queryString, tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 2, len(q.GetTopLevelStatements()))
+
+	firstStatement := q.GetTopLevelStatements()[0]
+	common.AssertNotNil(t, firstStatement.GetSpatialJoin())
+	common.AssertEqual(t, query.SpatialOpWithin, firstStatement.GetSpatialJoin().GetOperator())
+	common.AssertEqual(t, "ways", firstStatement.GetSpatialJoin().GetStatement().GetQueryType().String())
+	common.AssertEqual(t, []int{2}, firstStatement.GetSelectedKeys())
+	common.AssertNotNil(t, firstStatement.GetAssertion())
+
+	secondStatement := q.GetTopLevelStatements()[1]
+	common.AssertEqual(t, query.SpatialOpIntersects, secondStatement.GetSpatialJoin().GetOperator())
+}
+
+func TestParser_parseSpatialJoin_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"amenity", "landuse"}, [][]string{{"bench"}, {"park"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nodes{ amenity=bench } within",
+		"bbox(1,2,3,4).nodes{ amenity=bench } within this.ways{ landuse=park }",
+		"bbox(1,2,3,4).nodes{ amenity=bench } within bbox(1,2,3,4).ways{ landuse=park",
+		"bbox(1,2,3,4).nodes{ amenity=bench } within within bbox(1,2,3,4).ways{ landuse=park }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseUsingClause(t *testing.T) {
+	// Act
+	names, queryString, err := ParseUsingClause("USING germany, france_north\nbbox(1,2,3,4).nodes{ amenity=bench }")
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{"germany", "france_north"}, names)
+	common.AssertEqual(t, "bbox(1,2,3,4).nodes{ amenity=bench }", queryString)
+}
+
+func TestParser_parseUsingClause_withoutClause(t *testing.T) {
+	// Act
+	names, queryString, err := ParseUsingClause("all.nodes{ amenity=bench }")
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertNil(t, names)
+	common.AssertEqual(t, "all.nodes{ amenity=bench }", queryString)
+}
+
+func TestParser_parseUsingClause_invalid(t *testing.T) {
+	for _, queryString := range []string{
+		"USING",
+		"USING bbox(1,2,3,4).nodes{ amenity=bench }",
+		"USING germany",
+		"USING germany germany all.nodes{ amenity=bench }",
+		"USING ger:many all.nodes{ amenity=bench }",
+	} {
+		// Act
+		names, _, err := ParseUsingClause(queryString)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, names)
+	}
+}
+
+func TestParser_parseUsingClause_notAllowedInQuery(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	// Act
+	q, err := ParseQueryString("USING germany all.nodes{ amenity=bench }", tagIndex, nil)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, q)
+}
+
+func TestParseFilterExpression(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway", "railway"}, [][]string{{"primary"}, {"rail"}})
+
+	// Act
+	expression, err := ParseFilterExpression(" highway=* OR (railway=rail AND !(highway=primary)) ", tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	builtQuery, err := query.Builder().All().Nodes().
+		Where(query.Tag("highway", "*")).
+		Or(query.And(query.Tag("railway", "rail"), query.Not(query.Tag("highway", "primary")))).
+		Build(tagIndex)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, builtQuery.GetTopLevelStatements()[0].GetFilterExpression(), expression)
+}
+
+func TestParseFilterExpression_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"highway"}, [][]string{{"primary"}})
+	for _, expressionString := range []string{
+		"",
+		"highway",
+		"highway=* OR",
+		"highway=* }",
+		"highway=* ) OR highway=primary",
+		"(highway=*",
+		"this.ways{ highway=* }",
+	} {
+		// Act
+		expression, err := ParseFilterExpression(expressionString, tagIndex)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, expression)
+	}
+}
+
+func TestGetPlaceholders(t *testing.T) {
+	// Act
+	names, err := GetPlaceholders("bbox({{bbox}}).nodes{ amenity={{ value }} } bbox({{bbox}}).ways{ amenity={{value}} }")
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{"bbox", "value"}, names)
+}
+
+func TestGetPlaceholders_invalid(t *testing.T) {
+	// Act
+	names, err := GetPlaceholders("bbox({{bbox}}).nodes{ amenity={{foo bar}} }")
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, names)
+}
+
+func TestSubstitutePlaceholders(t *testing.T) {
+	// Act
+	queryString, err := SubstitutePlaceholders("bbox({{bbox}}).nodes{ amenity={{ amenity }} AND name={{name}} }", map[string]string{
+		"bbox":    "9.9,53.5,10.1,53.6",
+		"amenity": " bench ",
+		"name":    "\"Foo Bar\"",
+		"unused":  "foo",
+	})
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, "bbox(9.9,53.5,10.1,53.6).nodes{ amenity=bench AND name=\"Foo Bar\" }", queryString)
+}
+
+func TestSubstitutePlaceholders_invalidValues(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"bench }",
+		"bench OR amenity",
+		"1,2 // comment",
+		"1,2,foo",
+		"\"foo",
+		"*",
+	} {
+		// Act
+		queryString, err := SubstitutePlaceholders("all.nodes{ amenity={{value}} }", map[string]string{"value": value})
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertEqual(t, "", queryString)
+	}
+}
+
+func TestSubstitutePlaceholders_missingValue(t *testing.T) {
+	// Act
+	queryString, err := SubstitutePlaceholders("bbox({{bbox}}).nodes{ amenity=bench }", map[string]string{})
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertEqual(t, "", queryString)
+}
+
+func TestParser_parseSpatialJoin_near(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "highway"}, [][]string{{"bench"}, {"cycleway"}})
+	queryString := "bbox(1,2,3,4).nodes{ amenity=bench } near(12.5) bbox(1,2,3,4).ways{ highway=cycleway }"
+
+	// Act
+	q, err := ParseQueryString(queryString, tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	spatialJoin := q.GetTopLevelStatements()[0].GetSpatialJoin()
+	common.AssertEqual(t, query.SpatialOpNear, spatialJoin.GetOperator())
+	common.AssertEqual(t, 12.5, spatialJoin.GetDistance())
+}
+
+func TestParser_parseSpatialJoin_nearInvalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"amenity", "highway"}, [][]string{{"bench"}, {"cycleway"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nodes{ amenity=bench } near bbox(1,2,3,4).ways{ highway=cycleway }",
+		"bbox(1,2,3,4).nodes{ amenity=bench } near() bbox(1,2,3,4).ways{ highway=cycleway }",
+		"bbox(1,2,3,4).nodes{ amenity=bench } near(0) bbox(1,2,3,4).ways{ highway=cycleway }",
+		"bbox(1,2,3,4).nodes{ amenity=bench } near(50 bbox(1,2,3,4).ways{ highway=cycleway }",
+		"bbox(1,2,3,4).nodes{ amenity=bench } near(50)",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseLocationExpression_placeWithoutIndex(t *testing.T) {
+	// Arrange
+	queryString := `place("St. Pauli").nodes{ id=1 }`
+
+	// Act
+	q, err := ParseQueryString(queryString, nil, nil)
+
+	// Assert
+	common.AssertNil(t, q)
+	common.AssertMatch(t, "Unable to resolve place at position 6.*St. Pauli", err.Error())
+}
+
+func TestParser_parseLocationExpression_areaByNameWithoutIndex(t *testing.T) {
+	// Arrange
+	queryString := `areaByName("Hamburg", admin_level=4).nodes{ id=1 }`
+
+	// Act
+	q, err := ParseQueryString(queryString, nil, nil)
+
+	// Assert
+	common.AssertNil(t, q)
+	common.AssertMatch(t, "Unable to resolve area at position 11.*Hamburg", err.Error())
+}
+
+func TestParser_parseLocationExpression_areaByNameInvalidAdminLevel(t *testing.T) {
+	// Arrange
+	queryString := `areaByName("Hamburg", admin_level 4).nodes{ id=1 }`
+
+	// Act
+	q, err := ParseQueryString(queryString, nil, nil)
+
+	// Assert
+	common.AssertNil(t, q)
+	common.AssertNotNil(t, err)
+}
+
+func TestParser_parseLocationExpression_alongWithoutIndex(t *testing.T) {
+	// Arrange
+	queryString := `along(way:12345, 100).nodes{ amenity=cafe }`
+
+	// Act
+	q, err := ParseQueryString(queryString, nil, nil)
+
+	// Assert
+	common.AssertNil(t, q)
+	common.AssertMatch(t, "Unable to resolve way at position 10.*12345", err.Error())
+}
+
+func TestParser_parseLocationExpression_alongInvalidArguments(t *testing.T) {
+	for _, queryString := range []string{
+		`along(12345, 100).nodes{ amenity=cafe }`,
+		`along(node:12345, 100).nodes{ amenity=cafe }`,
+		`along(way:12345).nodes{ amenity=cafe }`,
+		`along(way:12345, 0).nodes{ amenity=cafe }`,
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, nil, nil)
+
+		// Assert
+		common.AssertNil(t, q)
+		common.AssertNotNil(t, err)
+	}
+}
+
+func TestParser_parseContextAwareStatement_unsupportedContext(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nodes{ this.nodes{ amenity=* } }",
+		"bbox(1,2,3,4).ways{ this.ways{ amenity=* } }",
+		"bbox(1,2,3,4).ways{ this.nodes{ this.child_relations{ amenity=* } } }",
+	} {
+		// Act
+		_, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+	}
+}
+
+func TestParser_parseContextAwareStatement_supportedContext(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nodes{ this.ways{ amenity=* } AND this.relations{ amenity=* } }",
+		"bbox(1,2,3,4).ways{ this.nodes{ amenity=* } AND this.relations{ amenity=* } }",
+		"bbox(1,2,3,4).relations{ this.nodes{ amenity=* } AND this.ways{ amenity=* } AND this.relations{ amenity=* } AND this.child_relations{ amenity=* } }",
+		"bbox(1,2,3,4).ways{ this.nodes{ this.ways{ amenity=* } } AND this.relations{ this.child_relations{ amenity=* } } }",
+	} {
+		// Act
+		_, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+	}
+}
+
+func TestGetErrorPosition(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"cafe"}})
+	for queryString, expectedPosition := range map[string]int{
+		"bbox(1,2,3,4).nodes{ amenity=cafe } $": 36,
+		"bbox(1,2,3,4).nodes{ amenity=\"cafe }": 29,
+		"bbox(1,2,3,4).foo{ amenity=cafe }":     14,
+		"bbox(1,2,3,4).nodes{ amenity=cafe":     33,
+	} {
+		// Act
+		_, err := ParseQueryString(queryString, tagIndex, nil)
+		position, ok := GetErrorPosition(err)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertTrue(t, ok)
+		common.AssertEqual(t, expectedPosition, position)
+		common.AssertTrue(t, errors.Is(err, ErrSyntax))
+	}
+}
+
+func TestGetErrorLineAndColumn(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"cafe"}})
+	for queryString, expected := range map[string][3]int{
+		"bbox(1,2,3,4).nodes{\n  amenity=cafe\n} $":         {38, 3, 3},
+		"\n\nbbox(1,2,3,4).foo{ amenity=cafe }":             {16, 3, 15},
+		"bbox(1,2,3,4).nodes{\n  amenity=cafe AND\n}":       {40, 3, 1},
+		"bbox(1,2,3,4).nodes{ amenity=cafe }.ways{ a=b }.x": {36, 1, 37},
+		"bbox(1,2,3,4).nodes{\n\tamenity=cafe\n}\n.foo":     {38, 4, 2},
+	} {
+		// Act
+		_, err := ParseQueryString(queryString, tagIndex, nil)
+		line, column, ok := GetErrorLineAndColumn(err)
+		position, _ := GetErrorPosition(err)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertTrue(t, ok)
+		common.AssertEqual(t, expected, [3]int{position, line, column})
+		common.AssertMatch(t, fmt.Sprintf("line %d, column %d", line, column), err.Error())
+	}
+}
+
+func TestGetErrorLineAndColumn_errorWithoutPosition(t *testing.T) {
+	// Act
+	_, _, ok := GetErrorLineAndColumn(errors.New("foo"))
+
+	// Assert
+	common.AssertFalse(t, ok)
+}
+
+func TestGetErrorPosition_errorWithoutPosition(t *testing.T) {
+	// Act
+	err := errors.New("foo")
+	_, ok := GetErrorPosition(err)
+
+	// Assert
+	common.AssertFalse(t, ok)
+	common.AssertFalse(t, errors.Is(err, ErrSyntax))
+}
+
+func TestParser_parseGeometryFunctions(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"area", "building", "is_area"}, [][]string{{"no", "yes"}, {"yes"}, {"yes"}})
+
+	// Act
+	closedQuery, closedErr := ParseQueryString("bbox(1,2,3,4).ways{ building=* AND is_closed() }", tagIndex, nil)
+	areaQuery, areaErr := ParseQueryString("bbox(1,2,3,4).ways{ !is_area() }", tagIndex, nil)
+	keyQuery, keyErr := ParseQueryString("bbox(1,2,3,4).ways{ is_area=yes }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, closedErr)
+	common.AssertEqual(t, query.NewLogicalFilterExpression(query.NewKeyFilterExpression(1, true), query.NewClosedFilterExpression(), query.LogicOpAnd), closedQuery.GetTopLevelStatements()[0].GetFilterExpression())
+	common.AssertNil(t, areaErr)
+	common.AssertEqual(t, query.NewNegatedFilterExpression(query.NewAreaFilterExpression(tagIndex)), areaQuery.GetTopLevelStatements()[0].GetFilterExpression())
+	common.AssertNil(t, keyErr)
+	common.AssertEqual(t, query.NewTagFilterExpression(2, 0, query.BinOpEqual), keyQuery.GetTopLevelStatements()[0].GetFilterExpression())
+}
+
+func TestParser_parseGeometryFunctions_invalid(t *testing.T) {
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).ways{ is_closed( }",
+		"bbox(1,2,3,4).ways{ is_area(building) }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, index.NewTagIndex([]string{}, [][]string{}), nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseTypeFunction(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"type"}, [][]string{{"multipolygon", "route"}})
+
+	// Act
+	nodeQuery, nodeErr := ParseQueryString("bbox(1,2,3,4).relations{ this.nodes{ type()=node } }", tagIndex, nil)
+	notRelationQuery, notRelationErr := ParseQueryString("bbox(1,2,3,4).nwr{ type()!=relation }", tagIndex, nil)
+	keyQuery, keyErr := ParseQueryString("bbox(1,2,3,4).relations{ type=route }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, nodeErr)
+	subStatement := nodeQuery.GetTopLevelStatements()[0].GetFilterExpression().(*query.SubStatementFilterExpression)
+	common.AssertEqual(t, query.NewTypeFilterExpression(osm.OsmObjNode, true), subStatement.GetStatement().GetFilterExpression())
+	common.AssertNil(t, notRelationErr)
+	common.AssertEqual(t, query.NewTypeFilterExpression(osm.OsmObjRelation, false), notRelationQuery.GetTopLevelStatements()[0].GetFilterExpression())
+	common.AssertNil(t, keyErr)
+	common.AssertEqual(t, query.NewTagFilterExpression(0, 1, query.BinOpEqual), keyQuery.GetTopLevelStatements()[0].GetFilterExpression())
+}
+
+func TestParser_parseTypeFunction_invalid(t *testing.T) {
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nwr{ type( }",
+		"bbox(1,2,3,4).nwr{ type() }",
+		"bbox(1,2,3,4).nwr{ type()>node }",
+		"bbox(1,2,3,4).nwr{ type()=nodes }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, index.NewTagIndex([]string{}, [][]string{}), nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseKeyPrefixFilter(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"addr:city", "addr:street", "name"}, [][]string{{"Foo"}, {"Bar"}, {"Baz"}})
+
+	// Act
+	setQuery, setErr := ParseQueryString("bbox(1,2,3,4).nodes{ addr:*=* }", tagIndex, nil)
+	notSetQuery, notSetErr := ParseQueryString("bbox(1,2,3,4).nodes{ name=* AND addr:*!=* }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, setErr)
+	common.AssertEqual(t, query.NewKeyPrefixFilterExpression(tagIndex, "addr:", true), setQuery.GetTopLevelStatements()[0].GetFilterExpression())
+	common.AssertNil(t, notSetErr)
+	expectedExpression := query.NewLogicalFilterExpression(query.NewKeyFilterExpression(2, true), query.NewKeyPrefixFilterExpression(tagIndex, "addr:", false), query.LogicOpAnd)
+	common.AssertEqual(t, expectedExpression, notSetQuery.GetTopLevelStatements()[0].GetFilterExpression())
+}
+
+func TestParser_parseKeyPrefixFilter_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"addr:city"}, [][]string{{"Foo"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nodes{ addr:*=Foo }",
+		"bbox(1,2,3,4).nodes{ addr:*>* }",
+		"bbox(1,2,3,4).nodes{ addr:* }",
+		"bbox(1,2,3,4).nodes{ addr:*= }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseValuePattern(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"name"}, [][]string{{"Super*", "Supermarket", "Tiny Supermarket"}})
+
+	// Act
+	prefixQuery, prefixErr := ParseQueryString("bbox(1,2,3,4).nodes{ name=Super* }", tagIndex, nil)
+	infixQuery, infixErr := ParseQueryString("bbox(1,2,3,4).nodes{ name!=*per*et }", tagIndex, nil)
+	quotedQuery, quotedErr := ParseQueryString("bbox(1,2,3,4).nodes{ name=\"Super*\" }", tagIndex, nil)
+	wildcardQuery, wildcardErr := ParseQueryString("bbox(1,2,3,4).nodes{ name=* }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, prefixErr)
+	common.AssertEqual(t, query.NewValuePatternFilterExpression(tagIndex, "name", "Super*", query.BinOpEqual), prefixQuery.GetTopLevelStatements()[0].GetFilterExpression())
+	common.AssertNil(t, infixErr)
+	common.AssertEqual(t, query.NewValuePatternFilterExpression(tagIndex, "name", "*per*et", query.BinOpNotEqual), infixQuery.GetTopLevelStatements()[0].GetFilterExpression())
+	common.AssertNil(t, quotedErr)
+	common.AssertEqual(t, query.NewTagFilterExpression(0, 0, query.BinOpEqual), quotedQuery.GetTopLevelStatements()[0].GetFilterExpression())
+	common.AssertNil(t, wildcardErr)
+	common.AssertEqual(t, query.NewKeyFilterExpression(0, true), wildcardQuery.GetTopLevelStatements()[0].GetFilterExpression())
+}
+
+func TestParser_parseValuePattern_invalid(t *testing.T) {
+	tagIndex := index.NewTagIndex([]string{"name"}, [][]string{{"Supermarket"}})
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).nodes{ name>Super* }",
+		"bbox(1,2,3,4).nodes{ name<=*market }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseNotKeyword(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"NOT", "highway", "name"}, [][]string{{"yes"}, {"primary", "secondary"}, {"foo"}})
+	highwayPrimary := query.NewTagFilterExpression(1, 0, query.BinOpEqual)
+	highwaySecondary := query.NewTagFilterExpression(1, 1, query.BinOpEqual)
+	name := query.NewKeyFilterExpression(2, true)
+
+	for _, testCase := range []struct {
+		queryString string
+		expected    query.FilterExpression
+	}{
+		{"NOT highway=primary", query.NewNegatedFilterExpression(highwayPrimary)},
+		{"NOT highway=primary AND name=*", query.NewLogicalFilterExpression(query.NewNegatedFilterExpression(highwayPrimary), name, query.LogicOpAnd)},
+		{"name=* OR NOT highway=primary AND highway=secondary", query.NewLogicalFilterExpression(name, query.NewLogicalFilterExpression(query.NewNegatedFilterExpression(highwayPrimary), highwaySecondary, query.LogicOpAnd), query.LogicOpOr)},
+		{"NOT (highway=primary OR name=*)", query.NewNegatedFilterExpression(query.NewLogicalFilterExpression(highwayPrimary, name, query.LogicOpOr))},
+		{"NOT NOT highway=primary", query.NewNegatedFilterExpression(query.NewNegatedFilterExpression(highwayPrimary))},
+		{"NOT !(highway=primary)", query.NewNegatedFilterExpression(query.NewNegatedFilterExpression(highwayPrimary))},
+		{"NOT=yes", query.NewTagFilterExpression(0, 0, query.BinOpEqual)},
+	} {
+		// Act
+		q, err := ParseQueryString("bbox(1,2,3,4).ways{ "+testCase.queryString+" }", tagIndex, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expected, q.GetTopLevelStatements()[0].GetFilterExpression())
+	}
+}
+
+func TestParser_parseNotKeyword_invalid(t *testing.T) {
+	for _, queryString := range []string{
+		"bbox(1,2,3,4).ways{ NOT }",
+		"bbox(1,2,3,4).ways{ NOT highway }",
+		"bbox(1,2,3,4).ways{ highway=primary NOT name=* }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, index.NewTagIndex([]string{"highway", "name"}, [][]string{{"primary"}, {}}), nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseLogicalOperatorPrecedence(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"a", "b", "c", "d"}, [][]string{{}, {}, {}, {}})
+	a := query.NewKeyFilterExpression(0, true)
+	b := query.NewKeyFilterExpression(1, true)
+	c := query.NewKeyFilterExpression(2, true)
+	d := query.NewKeyFilterExpression(3, true)
+	and := func(x query.FilterExpression, y query.FilterExpression) query.FilterExpression {
+		return query.NewLogicalFilterExpression(x, y, query.LogicOpAnd)
+	}
+	or := func(x query.FilterExpression, y query.FilterExpression) query.FilterExpression {
+		return query.NewLogicalFilterExpression(x, y, query.LogicOpOr)
+	}
+
+	for _, testCase := range []struct {
+		expression string
+		expected   query.FilterExpression
+	}{
+		{"a=* AND b=* AND c=*", and(and(a, b), c)},
+		{"a=* OR b=* OR c=*", or(or(a, b), c)},
+		{"a=* OR b=* AND c=*", or(a, and(b, c))},
+		{"a=* AND b=* OR c=*", or(and(a, b), c)},
+		{"a=* OR b=* AND c=* OR d=*", or(or(a, and(b, c)), d)},
+		{"a=* AND b=* OR c=* AND d=*", or(and(a, b), and(c, d))},
+		{"(a=* OR b=*) AND c=*", and(or(a, b), c)},
+		{"a=* AND (b=* OR c=*) AND d=*", and(and(a, or(b, c)), d)},
+		{"a=* AND (b=* AND (c=* AND d=*))", and(and(and(a, b), c), d)},
+		{"((a=*)) OR (b=* OR c=*)", or(or(a, b), c)},
+		{"!(a=* OR b=*) OR c=*", or(query.NewNegatedFilterExpression(or(a, b)), c)},
+	} {
+		// Act
+		q, err := ParseQueryString("bbox(1,2,3,4).ways{ "+testCase.expression+" }", tagIndex, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expected, q.GetTopLevelStatements()[0].GetFilterExpression())
+	}
+}
+
+func TestParser_parseLogicalOperatorPrecedence_invalid(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"a=* AND",
+		"a=* OR OR b=*",
+		"AND a=*",
+		"()",
+		"(a=* OR b=*",
+		"a=* OR b=*)",
+		"a=* XOR b=*",
+	} {
+		// Act
+		q, err := ParseQueryString("bbox(1,2,3,4).ways{ "+expression+" }", index.NewTagIndex([]string{"a", "b"}, [][]string{{}, {}}), nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseMetadataExpressions(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway"}, [][]string{{"primary"}})
+	tagIndex.SetUsers([]string{"SomeMapper", "Another Mapper"})
+
+	for _, testCase := range []struct {
+		queryString        string
+		expectedExpression query.FilterExpression
+	}{
+		{"bbox(1,2,3,4).nodes{ changeset=123 }", query.NewChangesetFilterExpression(123, query.BinOpEqual)},
+		{"bbox(1,2,3,4).nodes{ changeset>=123 }", query.NewChangesetFilterExpression(123, query.BinOpGreaterEqual)},
+		{"bbox(1,2,3,4).nodes{ user=SomeMapper }", query.NewUserFilterExpression(1, query.BinOpEqual)},
+		{"bbox(1,2,3,4).nodes{ user!=\"Another Mapper\" }", query.NewUserFilterExpression(0, query.BinOpNotEqual)},
+		{"bbox(1,2,3,4).nodes{ user=unknown }", query.NewUserFilterExpression(index.NotFound, query.BinOpEqual)},
+	} {
+		// Act
+		q, err := ParseQueryString(testCase.queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expectedExpression, q.GetTopLevelStatements()[0].GetFilterExpression())
+	}
+}
+
+func TestParser_parseMetadataExpressions_invalid(t *testing.T) {
+	tagIndexWithUsers := index.NewTagIndex([]string{}, [][]string{})
+	tagIndexWithUsers.SetUsers([]string{"SomeMapper"})
+
+	for _, testCase := range []struct {
+		queryString string
+		tagIndex    *index.TagIndex
+	}{
+		{"bbox(1,2,3,4).nodes{ user=SomeMapper }", index.NewTagIndex([]string{}, [][]string{})},
+		{"bbox(1,2,3,4).nodes{ changeset=123 }", index.NewTagIndex([]string{}, [][]string{})},
+		{"bbox(1,2,3,4).nodes{ user>SomeMapper }", tagIndexWithUsers},
+		{"bbox(1,2,3,4).nodes{ changeset=foo }", tagIndexWithUsers},
+		{"bbox(1,2,3,4).nodes{ user= }", tagIndexWithUsers},
+	} {
+		// Act
+		q, err := ParseQueryString(testCase.queryString, testCase.tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseAtClause(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	for _, testCase := range []struct {
+		queryString  string
+		expectedTime time.Time
+	}{
+		{"at(\"2020-01-01\") all.nodes{ amenity=bench }", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"at(\"2020-01-01T12:30:00Z\")\nall.nodes{ amenity=bench }\nall.ways{ amenity=bench }", time.Date(2020, 1, 1, 12, 30, 0, 0, time.UTC)},
+	} {
+		// Act
+		q, err := ParseQueryString(testCase.queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertTrue(t, testCase.expectedTime.Equal(*q.GetTime()))
+	}
+}
+
+func TestParser_parseAtClause_withoutClause(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	// Act
+	q, err := ParseQueryString("all.nodes{ amenity=bench }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertNil(t, q.GetTime())
+}
+
+func TestParser_parseAtClause_invalid(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	for _, queryString := range []string{
+		"at(\"2020-01-01\")",
+		"at(2020) all.nodes{ amenity=bench }",
+		"at(\"2020-13-01\") all.nodes{ amenity=bench }",
+		"at(\"2020-01-01\" all.nodes{ amenity=bench }",
+		"at all.nodes{ amenity=bench }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseUsingClause_withAtClause(t *testing.T) {
+	// Act
+	names, queryString, err := ParseUsingClause("USING germany at(\"2020-01-01\") all.nodes{ amenity=bench }")
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{"germany"}, names)
+	common.AssertEqual(t, "at(\"2020-01-01\") all.nodes{ amenity=bench }", queryString)
+}
+
+func TestParser_parseDistinct(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	// Act
+	distinctQuery, distinctErr := ParseQueryString("DISTINCT at(\"2020-01-01\") all.nodes{ amenity=bench } all.nodes{ amenity=* }", tagIndex, nil)
+	normalQuery, normalErr := ParseQueryString("all.nodes{ amenity=bench } all.nodes{ amenity=* }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, distinctErr)
+	common.AssertTrue(t, distinctQuery.IsDistinct())
+	common.AssertNotNil(t, distinctQuery.GetTime())
+	common.AssertEqual(t, 2, len(distinctQuery.GetTopLevelStatements()))
+	common.AssertNil(t, normalErr)
+	common.AssertFalse(t, normalQuery.IsDistinct())
+}
+
+func TestParser_parseDistinct_invalid(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity"}, [][]string{{"bench"}})
+
+	for _, queryString := range []string{
+		"DISTINCT",
+		"DISTINCT keys(all)",
+		"at(\"2020-01-01\") DISTINCT all.nodes{ amenity=bench }",
+	} {
+		// Act
+		q, err := ParseQueryString(queryString, tagIndex, nil)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, q)
+	}
+}
+
+func TestParser_parseUsingClause_withDistinct(t *testing.T) {
+	// Act
+	names, queryString, err := ParseUsingClause("USING germany DISTINCT all.nodes{ amenity=bench }")
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{"germany"}, names)
+	common.AssertEqual(t, "DISTINCT all.nodes{ amenity=bench }", queryString)
+	common.AssertFalse(t, IsValidIndexName("DISTINCT"))
+}
+
+func TestParser_unknownTagsAreWarnings(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway", "surface"}, [][]string{{"primary", "secondary"}, {"asphalt"}})
+
+	// Act
+	q, err := ParseQueryString("bbox(1,2,3,4).nwr{ hihgway=primary AND highway=primery AND surface=* }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []string{
+		"Key 'hihgway' at line 1, column 20 (position 19) does not exist in the tag-index, similar keys: 'highway'",
+		"Value 'primery' of key 'highway' at line 1, column 48 (position 47) does not exist in the tag-index, similar values: 'primary'",
+	}, q.GetWarnings())
+}
+
+func TestParser_unknownTagsStrict(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway"}, [][]string{{"primary"}})
+
+	// Act
+	q, err := ParseQueryStringStrict("bbox(1,2,3,4).ways{ highway=primary OR foo=bar }", tagIndex, nil)
+	position, ok := GetErrorPosition(err)
+
+	// Assert
+	common.AssertNil(t, q)
+	common.AssertNotNil(t, err)
+	common.AssertTrue(t, errors.Is(err, index.ErrUnknownKey))
+	common.AssertFalse(t, errors.Is(err, ErrSyntax))
+	common.AssertTrue(t, ok)
+	common.AssertEqual(t, 39, position)
+}
+
+func TestParser_unknownTagsStrict_knownTags(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway", "width"}, [][]string{{"primary"}, {"2"}})
+
+	// Act
+	q, err := ParseQueryStringStrict("bbox(1,2,3,4).ways{ highway=primary AND width>=3 AND highway!=* }", tagIndex, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(q.GetWarnings()))
+}
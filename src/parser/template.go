@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"soq/common"
+	"strings"
+)
+
+// placeholderRegex matches placeholders like "{{bbox}}" in query templates. Whitespace around the name is allowed.
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+
+// GetPlaceholders returns the names of all placeholders of the query template in the order of their first occurrence.
+// An error is returned for malformed placeholders like "{{foo bar}}".
+func GetPlaceholders(queryString string) ([]string, error) {
+	if strings.Contains(placeholderRegex.ReplaceAllString(queryString, ""), "{{") {
+		return nil, errors.New("Invalid placeholder, placeholders must look like '{{name}}' with a name of letters, digits and '_'")
+	}
+
+	var names []string
+	for _, match := range placeholderRegex.FindAllStringSubmatch(queryString, -1) {
+		if !common.Contains(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	return names, nil
+}
+
+// SubstitutePlaceholders replaces all placeholders of the query template by the given values. Values are checked
+// before the substitution, so that they can't change the structure of the query. Allowed values are a list of numbers
+// (e.g. "9.9,53.5,10.1,53.6" for a bbox) or a single keyword, number or string (e.g. "bench" or "\"Foo Bar\"").
+func SubstitutePlaceholders(queryString string, values map[string]string) (string, error) {
+	names, err := GetPlaceholders(queryString)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range names {
+		value, ok := values[name]
+		if !ok {
+			return "", errors.Errorf("No value given for placeholder '{{%s}}'", name)
+		}
+
+		err := validatePlaceholderValue(value)
+		if err != nil {
+			return "", errors.Wrapf(err, "Invalid value for placeholder '{{%s}}'", name)
+		}
+	}
+
+	return placeholderRegex.ReplaceAllStringFunc(queryString, func(placeholder string) string {
+		name := placeholderRegex.FindStringSubmatch(placeholder)[1]
+		return strings.TrimSpace(values[name])
+	}), nil
+}
+
+func validatePlaceholderValue(value string) error {
+	lexer := Lexer{
+		input: []rune(strings.TrimSpace(value)),
+		index: 0,
+	}
+	if len(lexer.input) == 0 {
+		return errors.New("Value is empty")
+	}
+
+	var tokens []*Token
+	for lexer.index < len(lexer.input) {
+		token, err := lexer.nextToken()
+		if err != nil {
+			return err
+		}
+		if token == nil {
+			// A comment would hide the rest of the line of the query.
+			return errors.New("Value must not contain comments")
+		}
+		tokens = append(tokens, token)
+	}
+
+	if len(tokens) == 1 && (tokens[0].kind == TokenKindKeyword || tokens[0].kind == TokenKindString) {
+		return nil
+	}
+	for _, token := range tokens {
+		if token.kind != TokenKindNumber {
+			return errors.Errorf("Expected a number list or a single keyword or string but found %s '%s' at position %d", token.kind.Lexeme(), token.lexeme, token.startPosition)
+		}
+	}
+
+	return nil
+}
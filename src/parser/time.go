@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"time"
+)
+
+const atExpression = "at"
+
+// Supported formats of the date in the "at" clause. Dates without time refer to midnight UTC.
+var atTimeFormats = []string{"2006-01-02", time.RFC3339}
+
+// parseAtClause parses the "at(<date>)" clause at the beginning of a query, which selects the point in time the query
+// is evaluated at. The current token must be the "at" keyword.
+func (p *Parser) parseAtClause() (*time.Time, error) {
+	// Then a "(" is expected
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected '('")
+	}
+	token := p.moveToNextToken()
+	if token.kind != TokenKindOpeningParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindOpeningParenthesis)
+	}
+
+	// Then the quoted date is expected, e.g. "2020-01-01" or "2020-01-01T12:00:00Z"
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected date")
+	}
+	dateToken := p.moveToNextToken()
+	if dateToken.kind != TokenKindString {
+		return nil, ParsingErrorExpectedButFound("quoted date", dateToken.startPosition, dateToken.lexeme, dateToken.kind)
+	}
+	queryTime, err := parseAtTime(dateToken.lexeme)
+	if err != nil {
+		return nil, ParsingErrorAtPosition(dateToken.startPosition, "Invalid date '%s' at position %d, expected format YYYY-MM-DD or YYYY-MM-DDThh:mm:ssZ", dateToken.lexeme, dateToken.startPosition)
+	}
+
+	if !p.hasNextToken() {
+		return nil, ParsingTokenStreamEndAtPosition(p.getNextTokenStartPosition(), "Expected ')'")
+	}
+	token = p.moveToNextToken()
+	if token.kind != TokenKindClosingParenthesis {
+		return nil, ParsingErrorExpectedTokenKind(token.startPosition, token.lexeme, token.kind, TokenKindClosingParenthesis)
+	}
+
+	return queryTime, nil
+}
+
+func parseAtTime(value string) (*time.Time, error) {
+	var err error
+	for _, format := range atTimeFormats {
+		var parsedTime time.Time
+		parsedTime, err = time.Parse(format, value)
+		if err == nil {
+			return &parsedTime, nil
+		}
+	}
+	return nil, err
+}
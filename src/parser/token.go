@@ -83,5 +83,7 @@ func (k TokenKind) Lexeme() string {
 type Token struct {
 	kind          TokenKind
 	lexeme        string
-	startPosition int // TODO remove if not needed
+	startPosition int // Index of the first character within the input
+	line          int // Line of the first character, starting at 1. Set by the lexer, 0 for artificial tokens.
+	column        int // Column of the first character, starting at 1. Set by the lexer, 0 for artificial tokens.
 }
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"fmt"
+	"soq/index"
+	"strings"
+)
+
+// Maximum number of similar keys or values suggested for an unknown key or value.
+const maxSimilarTags = 3
+
+// unknownTag is a key or value of the query that doesn't exist in the tag-index. Expressions with such keys or values
+// match no feature (or every feature when negated), which is usually caused by a typo.
+type unknownTag struct {
+	key      string
+	value    string // Empty for unknown keys
+	position int
+}
+
+// checkKey remembers the key at the given position when it doesn't exist in the tag-index and returns whether it
+// exists.
+func (p *Parser) checkKey(key string, position int) bool {
+	if p.tagIndex.GetKeyIndexFromKeyString(key) != index.NotFound {
+		return true
+	}
+	p.addUnknownTag(unknownTag{key: key, position: position})
+	return false
+}
+
+// checkValue remembers the value of the existing key at the given position when it doesn't exist in the tag-index.
+func (p *Parser) checkValue(key string, value string, position int) {
+	_, valueIndex := p.tagIndex.GetIndicesFromKeyValueStrings(key, value)
+	if valueIndex == index.NotFound {
+		p.addUnknownTag(unknownTag{key: key, value: value, position: position})
+	}
+}
+
+func (p *Parser) addUnknownTag(tag unknownTag) {
+	// Statements on "nwr" are parsed once per object type, so the same key or value might be checked several times.
+	for _, existingTag := range p.unknownTags {
+		if existingTag.position == tag.position {
+			return
+		}
+	}
+	p.unknownTags = append(p.unknownTags, tag)
+}
+
+// getUnknownTagMessages returns a message for each unknown key or value including similar keys or values of the
+// tag-index, e.g. "highway" for the unknown key "hihgway".
+func getUnknownTagMessages(tags []unknownTag, tagIndex *index.TagIndex, lexer *Lexer) []string {
+	var messages []string
+	for _, tag := range tags {
+		line, column := lexer.getLineAndColumn(tag.position)
+		location := formatLocation(tag.position, line, column)
+
+		if tag.value == "" {
+			similarKeys := tagIndex.SearchKeys(tag.key, maxSimilarTags)
+			messages = append(messages, fmt.Sprintf("Key '%s' at %s does not exist in the tag-index%s", tag.key, location, getSimilarTagsMessage("keys", similarKeys)))
+			continue
+		}
+
+		// Only values of existing keys are checked, so there's no error.
+		similarValues, _ := tagIndex.SearchValues(tag.key, tag.value, maxSimilarTags)
+		messages = append(messages, fmt.Sprintf("Value '%s' of key '%s' at %s does not exist in the tag-index%s", tag.value, tag.key, location, getSimilarTagsMessage("values", similarValues)))
+	}
+	return messages
+}
+
+func getSimilarTagsMessage(kind string, results []index.ValueSearchResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+
+	var similarTags []string
+	for _, result := range results {
+		similarTags = append(similarTags, fmt.Sprintf("'%s'", result.Value))
+	}
+	return fmt.Sprintf(", similar %s: %s", kind, strings.Join(similarTags, ", "))
+}
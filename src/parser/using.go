@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"soq/common"
+	"strings"
+)
+
+const usingExpression = "USING"
+
+// ParseUsingClause splits the optional "USING <name>, <name>, ..." clause at the beginning of a query from the actual
+// query. The names of the selected indices and the remaining query string are returned. Without such clause, no names
+// and the unchanged query string are returned.
+func ParseUsingClause(queryString string) ([]string, string, error) {
+	runes := []rune(strings.Trim(queryString, "\n\r\t "))
+	lexer := Lexer{
+		input: runes,
+		index: 0,
+	}
+
+	token, err := lexer.read()
+	if err != nil {
+		return nil, "", lexer.addLineAndColumn(err)
+	}
+
+	if len(token) == 0 || token[0].kind != TokenKindKeyword || token[0].lexeme != usingExpression {
+		return nil, queryString, nil
+	}
+
+	var names []string
+	i := 1
+	for ; i < len(token) && token[i].kind == TokenKindKeyword && !common.Contains(locationExpressions, token[i].lexeme) && token[i].lexeme != atExpression && token[i].lexeme != distinctExpression; i++ {
+		if !IsValidIndexName(token[i].lexeme) {
+			return nil, "", lexer.addLineAndColumn(ParsingErrorAtPosition(token[i].startPosition, "Invalid index name '%s' at position %d", token[i].lexeme, token[i].startPosition))
+		}
+		if common.Contains(names, token[i].lexeme) {
+			return nil, "", lexer.addLineAndColumn(ParsingErrorAtPosition(token[i].startPosition, "Index '%s' at position %d selected multiple times", token[i].lexeme, token[i].startPosition))
+		}
+		names = append(names, token[i].lexeme)
+	}
+
+	if len(names) == 0 {
+		return nil, "", lexer.addLineAndColumn(ParsingTokenStreamEndAtPosition(len(token[0].lexeme), "Expected at least one index name after '"+usingExpression+"'"))
+	}
+	if i >= len(token) {
+		return nil, "", lexer.addLineAndColumn(ParsingTokenStreamEndAtPosition(len(runes), "Expected query after index names"))
+	}
+
+	return names, string(runes[token[i].startPosition:]), nil
+}
+
+// IsValidIndexName returns true when the name can be used in a "USING" clause. Such names consist of letters and
+// underscores and must not be a keyword of a location expression like "bbox", of the "at" clause or "DISTINCT".
+func IsValidIndexName(name string) bool {
+	if name == "" || common.Contains(locationExpressions, name) || name == usingExpression || name == atExpression || name == distinctExpression {
+		return false
+	}
+
+	for _, char := range name {
+		if char != '_' && !common.Contains(keywordChars, char) || char == ':' || char == '@' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,146 @@
+package soq
+
+import (
+	"context"
+	"github.com/paulmach/orb"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"soq/query"
+)
+
+// ObjectType is the OSM type of a feature, which is "node", "way" or "relation".
+type ObjectType string
+
+const (
+	Node     ObjectType = "node"
+	Way      ObjectType = "way"
+	Relation ObjectType = "relation"
+)
+
+// Member is a single member of a relation feature.
+type Member struct {
+	Type ObjectType
+	ID   uint64
+	Role string
+}
+
+// Feature is a decoded OSM object of a query result. Unlike the internal encoded features, the tags are plain strings
+// and the feature doesn't reference the index anymore.
+type Feature struct {
+	Type     ObjectType
+	ID       uint64
+	Geometry orb.Geometry
+	Tags     map[string]string
+	// NodeIDs contains the IDs of the nodes of a way feature in their order.
+	NodeIDs []uint64
+	// Members contains the members of a relation feature in their order.
+	Members []Member
+}
+
+// Features iterates over the features of a query result:
+//
+//	for features.Next() {
+//		f := features.Feature()
+//	}
+//	if err := features.Err(); err != nil { ... }
+type Features struct {
+	ctx      context.Context
+	tagIndex *index.TagIndex
+	query    *query.Query
+	features *query.ResultIterator
+	current  *Feature
+	err      error
+}
+
+// Next moves to the next feature and returns false when there are no more features or when the context has been
+// cancelled. In the latter case, Err returns the error of the context.
+func (f *Features) Next() bool {
+	if f.err != nil {
+		return false
+	}
+
+	f.err = f.ctx.Err()
+	if f.err != nil {
+		f.Close()
+		return false
+	}
+
+	if !f.features.Next() {
+		f.err = f.features.Err()
+		f.current = nil
+		return false
+	}
+
+	f.current = decodeFeature(f.features.Feature(), f.tagIndex)
+	return true
+}
+
+// Feature returns the current feature. Only valid after Next returned true.
+func (f *Features) Feature() *Feature {
+	return f.current
+}
+
+// Err returns the error that stopped the iteration or nil if all features have been read.
+func (f *Features) Err() error {
+	return f.err
+}
+
+// Close stops the query execution. Calling Close is only necessary when the iteration is stopped early.
+func (f *Features) Close() {
+	f.features.Close()
+	f.current = nil
+}
+
+// FailedAssertions returns the assertions of the query (e.g. "assert count >= 1") that didn't hold. Only complete after
+// all features have been read.
+func (f *Features) FailedAssertions() []error {
+	return f.query.GetFailedAssertions()
+}
+
+// Warnings returns problems that occurred during the execution, e.g. corrupt cells of the index that have been
+// skipped. The result is incomplete when there are warnings. Only complete after all features have been read.
+func (f *Features) Warnings() []string {
+	return f.query.GetWarnings()
+}
+
+func decodeFeature(encodedFeature feature.Feature, tagIndex *index.TagIndex) *Feature {
+	result := &Feature{
+		ID:       encodedFeature.GetID(),
+		Geometry: encodedFeature.GetGeometry(),
+		Tags:     map[string]string{},
+	}
+
+	switch f := encodedFeature.(type) {
+	case feature.NodeFeature:
+		result.Type = Node
+		if point, ok := result.Geometry.(*orb.Point); ok {
+			result.Geometry = *point
+		}
+	case feature.WayFeature:
+		result.Type = Way
+		for _, node := range f.GetNodes() {
+			result.NodeIDs = append(result.NodeIDs, uint64(node.ID))
+		}
+	case feature.RelationFeature:
+		result.Type = Relation
+		for _, member := range f.GetMembers() {
+			result.Members = append(result.Members, Member{
+				Type: objectTypeOf(member.Type),
+				ID:   member.ID,
+				Role: member.Role,
+			})
+		}
+	}
+
+	for i, keyIndex := range encodedFeature.GetKeys() {
+		valueIndex := encodedFeature.GetValues()[i]
+		result.Tags[tagIndex.GetKeyFromIndex(keyIndex)] = tagIndex.GetValueForKey(keyIndex, valueIndex)
+	}
+
+	return result
+}
+
+func objectTypeOf(objectType ownOsm.OsmObjectType) ObjectType {
+	return ObjectType(objectType.String())
+}
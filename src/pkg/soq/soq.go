@@ -0,0 +1,267 @@
+// Package soq is the entry point for Go programs using simple-osm-queries as library. It hides the internal index,
+// parser and query packages behind a small API:
+//
+//	db, err := soq.Open("soq-index", nil)
+//	features, err := db.Query(ctx, "bbox(9.9,53.5,10.1,53.6).nodes{ amenity=bench }")
+//	for features.Next() {
+//		f := features.Feature()
+//		fmt.Println(f.Type, f.ID, f.Tags["amenity"])
+//	}
+//	err = features.Err()
+package soq
+
+import (
+	"context"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/encoding"
+	"soq/importing"
+	"soq/index"
+	ownOsm "soq/osm"
+	"soq/parser"
+	"soq/query"
+)
+
+const defaultCellSize = 0.1
+
+// Errors returned by this package can be compared to these errors with errors.Is, e.g. to tell invalid queries apart
+// from problems of the index. Errors of the context given to Query are returned unchanged.
+var (
+	// ErrSyntax is matched by errors of invalid queries, s. DB.Validate.
+	ErrSyntax = parser.ErrSyntax
+	// ErrUnknownKey is matched by errors caused by a key not existing in the index.
+	ErrUnknownKey = index.ErrUnknownKey
+	// ErrIndexMissing is matched by errors caused by a missing index, e.g. when opening a folder without index.
+	ErrIndexMissing = index.ErrIndexMissing
+)
+
+// Options configure how an index is opened or created. The zero value of each field means "use the default".
+type Options struct {
+	// Width and height of the cells of the grid-index in degrees. Must be the same for the import and all queries.
+	// Default: 0.1
+	CellSize float64
+	// Number of goroutines reading and filtering cells in parallel during queries or decoding the input data during
+	// imports.
+	// Default: GOMAXPROCS
+	Threads int
+	// Maximum number of cell files kept in memory by an opened DB.
+	// Default: 10
+	CellCacheSize int
+	// Approximate maximum amount of memory in bytes a single query may use before it gets aborted. Default: unlimited
+	MemoryLimit int64
+	// Check the technical validity of each read feature. Decreases performance noticeably!
+	CheckFeatureValidity bool
+	// Queries with keys or values not existing in the index (e.g. typos) fail with an error matching ErrUnknownKey.
+	// Otherwise, they're only reported as warnings of the features.
+	Strict bool
+}
+
+func (o *Options) withDefaults() Options {
+	result := Options{}
+	if o != nil {
+		result = *o
+	}
+	if result.CellSize <= 0 {
+		result.CellSize = defaultCellSize
+	}
+	if result.Threads <= 0 {
+		result.Threads = common.DefaultSettings().ReaderThreads
+	}
+	if result.CellCacheSize <= 0 {
+		result.CellCacheSize = common.DefaultCellCacheSize
+	}
+	return result
+}
+
+func (o Options) settings() common.Settings {
+	return common.Settings{
+		ReaderThreads: o.Threads,
+		ImportWorkers: o.Threads,
+		FilterWorkers: o.Threads,
+		CellCacheSize: o.CellCacheSize,
+	}
+}
+
+// ImportOptions configure the import in addition to the general options.
+type ImportOptions struct {
+	Options
+	// Do not store untagged nodes as standalone features. They're still part of ways and relations.
+	SkipUntaggedNodes bool
+	// Sync all index files and folders to the storage device after each import step.
+	Durable bool
+	// Sort the features of each cell by ID, so that identical input files result in byte-identical indices.
+	Reproducible bool
+	// Filter expression of the objects to import, e.g. "highway=* OR railway=*". Empty means all objects.
+	Keep string
+	// How coordinates are mapped to cells, either "latlon" or "equal-area". The scheme is stored in the index, so
+	// queries use it automatically.
+	// Default: "latlon"
+	CellScheme string
+	// Cells with more features of one type are split into quadrants to read less data in dense areas. Negative values
+	// disable splitting.
+	// Default: 100000
+	CellSplitThreshold int
+	// How the coordinates of nodes are stored, either "float32", "fixed" (7 decimal places like OSM data) or "float64".
+	// Default: "float32"
+	CoordinatePrecision string
+	// Store the changeset and user of each object, which enables the "changeset" and "user" filters.
+	StoreMetadata bool
+	// The input is a full-history file. All versions of the objects are stored, which enables queries at a point in
+	// time with the "at" clause.
+	History bool
+	// JSON file with rules computing additional tags during the import, e.g. the cleaned number "levels_numeric" from
+	// "building:levels", s. importing.LoadDerivedTags. Empty means no derived tags.
+	DerivedTags string
+	// Custom handlers getting all imported objects, e.g. to collect statistics or to write an additional index. They
+	// run during the same pass over the input file as the tag-index creation.
+	Handlers []ImportHandler
+}
+
+// ImportHandler receives the OSM objects during an import. The functions are called in order: First Init, then
+// HandleNode for all nodes, HandleWay for all ways, HandleRelation for all relations and finally Done. An error aborts
+// the import. Handlers only get the imported objects, e.g. only the ones matching the keep expression, and must not
+// change them.
+type ImportHandler interface {
+	// Name is used in error messages.
+	Name() string
+	Init() error
+	HandleNode(node *osm.Node) error
+	HandleWay(way *osm.Way) error
+	HandleRelation(relation *osm.Relation) error
+	Done() error
+}
+
+// Import imports the given OSM file (.osm or .osm.pbf with locations on ways) into a new index in the given folder.
+// An existing index in this folder is replaced.
+func Import(inputFile string, indexDir string, options *ImportOptions) error {
+	importOptions := ImportOptions{}
+	if options != nil {
+		importOptions = *options
+	}
+	generalOptions := importOptions.Options.withDefaults()
+
+	cellScheme, err := common.NewCellScheme(importOptions.CellScheme, generalOptions.CellSize, generalOptions.CellSize)
+	if err != nil {
+		return err
+	}
+
+	coordinatePrecision, err := encoding.ParseCoordinatePrecision(importOptions.CoordinatePrecision)
+	if err != nil {
+		return err
+	}
+
+	cellSplitThreshold := importOptions.CellSplitThreshold
+	if cellSplitThreshold == 0 {
+		cellSplitThreshold = index.DefaultCellSplitThreshold
+	} else if cellSplitThreshold < 0 {
+		cellSplitThreshold = 0
+	}
+
+	var derivedTags importing.DerivedTags
+	if importOptions.DerivedTags != "" {
+		derivedTags, err = importing.LoadDerivedTags(importOptions.DerivedTags)
+		if err != nil {
+			return err
+		}
+	}
+
+	var handlers []ownOsm.OsmDataHandler
+	for _, handler := range importOptions.Handlers {
+		handlers = append(handlers, handler)
+	}
+
+	internalOptions := importing.ImportOptions{
+		CellScheme:          cellScheme,
+		CellSplitThreshold:  cellSplitThreshold,
+		CoordinatePrecision: coordinatePrecision,
+		SkipUntaggedNodes:   importOptions.SkipUntaggedNodes,
+		StoreMetadata:       importOptions.StoreMetadata,
+		History:             importOptions.History,
+		Durable:             importOptions.Durable,
+		Reproducible:        importOptions.Reproducible,
+		KeepExpression:      importOptions.Keep,
+		DerivedTags:         derivedTags,
+		Handlers:            handlers,
+	}
+	return importing.Import(inputFile, indexDir, internalOptions, generalOptions.settings())
+}
+
+// DB is an opened index, which can be queried.
+type DB struct {
+	options       Options
+	tagIndex      *index.TagIndex
+	geometryIndex *index.GridIndexReader
+}
+
+// Open loads the index in the given folder, which has been created by an import. The options may be nil to use the
+// defaults. Imports don't remove the files of an opened index until the DB is closed.
+func Open(indexDir string, options *Options) (*DB, error) {
+	db := &DB{options: options.withDefaults()}
+
+	// All parts of the index are loaded from the same version, even when an import activates a new one meanwhile.
+	indexVersionDir, err := index.ResolveIndexFolder(indexDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open index in %s", indexDir)
+	}
+
+	db.tagIndex, err = index.LoadTagIndex(indexVersionDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open index in %s", indexDir)
+	}
+
+	db.geometryIndex, err = index.LoadGridIndex(indexVersionDir, db.options.CellSize, db.options.CellSize, db.options.CheckFeatureValidity, db.tagIndex, db.options.settings())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open index in %s", indexDir)
+	}
+
+	return db, nil
+}
+
+// Close releases the caches and the files of the index. The DB must not be used afterwards.
+func (db *DB) Close() {
+	db.geometryIndex.Close()
+}
+
+// Validate parses the query without executing it. The returned error contains the position of syntax errors, which can
+// be determined with parser.GetErrorPosition.
+func (db *DB) Validate(queryString string) error {
+	_, err := db.parseQueryString(queryString)
+	return err
+}
+
+func (db *DB) parseQueryString(queryString string) (*query.Query, error) {
+	if db.options.Strict {
+		return parser.ParseQueryStringStrict(queryString, db.tagIndex, db.geometryIndex)
+	}
+	return parser.ParseQueryString(queryString, db.tagIndex, db.geometryIndex)
+}
+
+// Query parses the given query and executes it in the background. The features of the result are returned in the order
+// of the statements of the query while the execution is still running. The context is checked before the execution and
+// while iterating over the features. The returned features must be read completely or closed.
+func (db *DB) Query(ctx context.Context, queryString string) (*Features, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := db.parseQueryString(queryString)
+	if err != nil {
+		return nil, err
+	}
+	q.SetMemoryLimit(db.options.MemoryLimit)
+	q.SetFilterWorkers(db.options.Threads)
+
+	features, err := q.Stream(db.geometryIndex, query.DefaultResultBufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Features{
+		ctx:      ctx,
+		tagIndex: db.tagIndex,
+		query:    q,
+		features: features,
+	}, nil
+}
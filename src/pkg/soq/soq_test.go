@@ -0,0 +1,165 @@
+package soq
+
+import (
+	"context"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"soq/common"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *DB {
+	indexDir := t.TempDir()
+	err := Import("../../../test-small.osm", indexDir, nil)
+	common.AssertNil(t, err)
+
+	db, err := Open(indexDir, nil)
+	common.AssertNil(t, err)
+	return db
+}
+
+func TestDB_Query(t *testing.T) {
+	// Arrange
+	db := openTestDB(t)
+
+	// Act
+	features, err := db.Query(context.Background(), "bbox(9.9,53.5,10.0,53.6).nodes{ amenity=bench AND backrest=yes }")
+	common.AssertNil(t, err)
+
+	var result []*Feature
+	for features.Next() {
+		result = append(result, features.Feature())
+	}
+
+	// Assert
+	common.AssertNil(t, features.Err())
+	common.AssertEqual(t, 1, len(result))
+	common.AssertEqual(t, Node, result[0].Type)
+	common.AssertEqual(t, uint64(3), result[0].ID)
+	common.AssertEqual(t, orb.Point{float64(float32(9.9332)), float64(float32(53.587))}, result[0].Geometry)
+	common.AssertEqual(t, map[string]string{"amenity": "bench", "backrest": "yes", "material": "wood"}, result[0].Tags)
+}
+
+func TestDB_Query_equalAreaCellScheme(t *testing.T) {
+	// Arrange
+	indexDir := t.TempDir()
+	err := Import("../../../test-small.osm", indexDir, &ImportOptions{CellScheme: common.CellSchemeEqualArea})
+	common.AssertNil(t, err)
+	db, err := Open(indexDir, nil)
+	common.AssertNil(t, err)
+
+	// Act
+	features, err := db.Query(context.Background(), "bbox(9.9,53.5,10.0,53.6).nodes{ amenity=bench AND backrest=yes }")
+	common.AssertNil(t, err)
+
+	var result []*Feature
+	for features.Next() {
+		result = append(result, features.Feature())
+	}
+
+	// Assert
+	common.AssertNil(t, features.Err())
+	common.AssertEqual(t, 1, len(result))
+	common.AssertEqual(t, uint64(3), result[0].ID)
+	common.AssertEqual(t, common.CellSchemeEqualArea, db.geometryIndex.GetMetadata().CellScheme)
+}
+
+func TestDB_Query_cancelledContext(t *testing.T) {
+	// Arrange
+	db := openTestDB(t)
+	features, err := db.Query(context.Background(), "bbox(9.9,53.5,10.0,53.6).nodes{ amenity=bench }")
+	common.AssertNil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	features.ctx = ctx
+
+	// Act
+	common.AssertTrue(t, features.Next())
+	cancel()
+	hasNext := features.Next()
+
+	// Assert
+	common.AssertFalse(t, hasNext)
+	common.AssertEqual(t, context.Canceled, features.Err())
+}
+
+func TestDB_Query_invalidQuery(t *testing.T) {
+	// Arrange
+	db := openTestDB(t)
+
+	// Act
+	features, err := db.Query(context.Background(), "bbox(9.9,53.5,10.0,53.6).nodes{ amenity=bench")
+
+	// Assert
+	common.AssertTrue(t, errors.Is(err, ErrSyntax))
+	common.AssertNil(t, features)
+	common.AssertTrue(t, errors.Is(db.Validate("bbox(9.9,53.5,10.0,53.6).nodes{ amenity=bench"), ErrSyntax))
+}
+
+func TestDB_Validate_strict(t *testing.T) {
+	// Arrange
+	db := openTestDB(t)
+	queryString := "bbox(9.9,53.5,10.0,53.6).nodes{ amenty=bench }"
+
+	// Act
+	err := db.Validate(queryString)
+	db.options.Strict = true
+	strictErr := db.Validate(queryString)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertTrue(t, errors.Is(strictErr, ErrUnknownKey))
+}
+
+func TestOpen_missingIndex(t *testing.T) {
+	// Act
+	db, err := Open(t.TempDir(), nil)
+
+	// Assert
+	common.AssertTrue(t, errors.Is(err, ErrIndexMissing))
+	common.AssertNil(t, db)
+}
+
+type testImportHandler struct {
+	nodeIds []osm.NodeID
+	done    bool
+	err     error
+}
+
+func (h *testImportHandler) Name() string { return "testImportHandler" }
+func (h *testImportHandler) Init() error  { return nil }
+func (h *testImportHandler) HandleNode(node *osm.Node) error {
+	h.nodeIds = append(h.nodeIds, node.ID)
+	return h.err
+}
+func (h *testImportHandler) HandleWay(way *osm.Way) error                { return h.err }
+func (h *testImportHandler) HandleRelation(relation *osm.Relation) error { return h.err }
+func (h *testImportHandler) Done() error {
+	h.done = true
+	return nil
+}
+
+func TestImport_handlers(t *testing.T) {
+	// Arrange
+	handler := &testImportHandler{}
+
+	// Act
+	err := Import("../../../test-small.osm", t.TempDir(), &ImportOptions{Keep: "amenity=bench", Handlers: []ImportHandler{handler}})
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []osm.NodeID{2, 3}, handler.nodeIds)
+	common.AssertTrue(t, handler.done)
+}
+
+func TestImport_handlerError(t *testing.T) {
+	// Arrange
+	handler := &testImportHandler{err: errors.New("test error")}
+
+	// Act
+	err := Import("../../../test-small.osm", t.TempDir(), &ImportOptions{Handlers: []ImportHandler{handler}})
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertFalse(t, handler.done)
+}
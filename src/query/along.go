@@ -0,0 +1,115 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+)
+
+// AlongLocationExpression covers the corridor of the given width in meters around the geometry of a way, e.g. along a
+// street or hiking route. The features are read from the cells within the bbox of the corridor and only the ones with
+// a distance of at most the width to the way are returned.
+type AlongLocationExpression struct {
+	wayId    uint64
+	way      orb.Geometry
+	distance float64 // Maximum distance in meters to the way.
+	bbox     *orb.Bound
+}
+
+func NewAlongLocationExpression(wayId uint64, way orb.Geometry, distance float64) *AlongLocationExpression {
+	bbox := extendBound(way.Bound(), distance)
+	return &AlongLocationExpression{
+		wayId:    wayId,
+		way:      way,
+		distance: distance,
+		bbox:     &bbox,
+	}
+}
+
+func (a *AlongLocationExpression) GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType, idFilter index.IdFilter, keyFilter index.KeyFilter, tagFilter index.TagFilter) (chan *index.GetFeaturesResult, error) {
+	featuresChannel, err := geometryIndex.Get(a.bbox, objectType, idFilter, keyFilter, tagFilter)
+	if err != nil {
+		return nil, err
+	}
+	return filterResultFeatures(featuresChannel, a.isNearWay), nil
+}
+
+func (a *AlongLocationExpression) GetFeaturesForCells(geometryIndex index.GeometryIndex, cells []common.CellIndex, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error) {
+	return filterResultFeatures(geometryIndex.GetFeaturesForCells(cells, objectType), a.isNearWay), nil
+}
+
+func (a *AlongLocationExpression) GetCells(geometryIndex index.GeometryIndex) ([]common.CellIndex, error) {
+	return NewBboxLocationExpression(a.bbox).GetCells(geometryIndex)
+}
+
+func (a *AlongLocationExpression) IsWithin(feature feature.Feature, context feature.Feature) (bool, error) {
+	geometry := index.DereferenceGeometry(feature.GetGeometry())
+	return geometry != nil && a.isNearWay(geometry), nil
+}
+
+func (a *AlongLocationExpression) Print(indent int) {
+	sigolo.Debugf("%slocation: along(way:%d, %gm)", spacing(indent), a.wayId, a.distance)
+}
+
+func (a *AlongLocationExpression) GetWayId() uint64 {
+	return a.wayId
+}
+
+func (a *AlongLocationExpression) GetDistance() float64 {
+	return a.distance
+}
+
+func (a *AlongLocationExpression) GetBbox() *orb.Bound {
+	return a.bbox
+}
+
+func (a *AlongLocationExpression) isNearWay(geometry orb.Geometry) bool {
+	return geometry.Bound().Intersects(*a.bbox) && distanceInMeters(geometry, a.way) <= a.distance
+}
+
+// ResolveWayGeometry returns the geometry of the way with the given ID. The whole extent of the index is searched, which
+// might take a while on large indices.
+func ResolveWayGeometry(wayId uint64, geometryIndex index.GeometryIndex) (orb.Geometry, error) {
+	if geometryIndex == nil {
+		return nil, errors.Errorf("Unable to resolve way %d without an index", wayId)
+	}
+
+	metadata := geometryIndex.GetMetadata()
+	if metadata == nil || metadata.Extent == nil {
+		return nil, errors.New("The index contains no information about the extent of the imported data, which is needed to find ways. Import the data again or use a bbox location instead.")
+	}
+
+	idFilter := func(id uint64) bool {
+		return id == wayId
+	}
+	resultChannel, err := geometryIndex.Get(metadata.Extent, ownOsm.OsmObjWay, idFilter, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The channel is read completely, even after the way has been found, so that the index can finish its goroutines.
+	var wayGeometry orb.Geometry
+	var readErr error
+	for result := range resultChannel {
+		if result.Err != nil && readErr == nil {
+			readErr = result.Err
+		}
+		for _, f := range result.Features {
+			if wayGeometry == nil && f != nil && f.GetID() == wayId {
+				wayGeometry = index.DereferenceGeometry(f.GetGeometry())
+			}
+		}
+	}
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	if wayGeometry == nil {
+		return nil, errors.Errorf("Way %d not found in the index", wayId)
+	}
+	return wayGeometry, nil
+}
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func newAlongTestIndex() *testGeometryIndex {
+	street := orb.LineString{{0.1, 0.5}, {0.9, 0.5}}
+	extent := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.5, 0.9}}
+	return &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {
+				&index.EncodedWayFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 10, Geometry: &street}},
+				newTestNode(1, 0.5, 0.5005),
+				newTestNode(2, 0.5, 0.502),
+				newTestNode(3, 0.9005, 0.5),
+			},
+		},
+		metadata: index.IndexMetadata{Extent: &extent},
+	}
+}
+
+func TestResolveWayGeometry(t *testing.T) {
+	// Arrange
+	geomIndex := newAlongTestIndex()
+
+	// Act
+	way, err := ResolveWayGeometry(10, geomIndex)
+	_, unknownErr := ResolveWayGeometry(11, geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, orb.LineString{{0.1, 0.5}, {0.9, 0.5}}, way)
+	common.AssertNotNil(t, unknownErr)
+}
+
+func TestAlongLocationExpression_GetFeatures(t *testing.T) {
+	// Arrange
+	geomIndex := newAlongTestIndex()
+	way, err := ResolveWayGeometry(10, geomIndex)
+	common.AssertNil(t, err)
+	location := NewAlongLocationExpression(10, way, 100)
+
+	// Act
+	resultChannel, err := location.GetFeatures(geomIndex, nil, ownOsm.OsmObjNode, nil, nil, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	var ids []uint64
+	for result := range resultChannel {
+		for _, f := range result.Features {
+			ids = append(ids, f.GetID())
+		}
+	}
+	// Node 2 is about 220 m away from the way.
+	common.AssertEqual(t, []uint64{1, 3}, ids)
+}
+
+func TestAlongLocationExpression_IsWithin(t *testing.T) {
+	// Arrange
+	location := NewAlongLocationExpression(10, orb.LineString{{0.1, 0.5}, {0.9, 0.5}}, 100)
+
+	// Act
+	near, nearErr := location.IsWithin(newTestNode(1, 0.5, 0.4995), nil)
+	far, farErr := location.IsWithin(newTestNode(2, 0.95, 0.5), nil)
+
+	// Assert
+	common.AssertNil(t, nearErr)
+	common.AssertTrue(t, near)
+	common.AssertNil(t, farErr)
+	common.AssertFalse(t, far)
+}
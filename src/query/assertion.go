@@ -0,0 +1,57 @@
+package query
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+// Assertion checks the result of a statement, e.g. "ASSERT count >= 100". A failed assertion doesn't abort the query,
+// it's only collected by the query so that callers (e.g. the CLI) can react on it.
+type Assertion struct {
+	operator      BinaryOperator
+	expectedCount int
+}
+
+func NewCountAssertion(operator BinaryOperator, expectedCount int) *Assertion {
+	return &Assertion{
+		operator:      operator,
+		expectedCount: expectedCount,
+	}
+}
+
+// Check returns an error when the given number of result features doesn't fulfill this assertion.
+func (a Assertion) Check(count int) error {
+	var fulfilled bool
+
+	switch a.operator {
+	case BinOpEqual:
+		fulfilled = count == a.expectedCount
+	case BinOpNotEqual:
+		fulfilled = count != a.expectedCount
+	case BinOpGreater:
+		fulfilled = count > a.expectedCount
+	case BinOpGreaterEqual:
+		fulfilled = count >= a.expectedCount
+	case BinOpLower:
+		fulfilled = count < a.expectedCount
+	case BinOpLowerEqual:
+		fulfilled = count <= a.expectedCount
+	default:
+		return errors.Errorf("Operator %d not supported in assertion", a.operator)
+	}
+
+	if !fulfilled {
+		return errors.Errorf("Assertion 'count %s %d' failed: Statement returned %d features", a.operator.string(), a.expectedCount, count)
+	}
+
+	return nil
+}
+
+func (a Assertion) Print(indent int) {
+	sigolo.Debugf("%sassert: %s", spacing(indent), a.String())
+}
+
+func (a Assertion) String() string {
+	return fmt.Sprintf("count %s %d", a.operator.string(), a.expectedCount)
+}
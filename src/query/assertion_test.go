@@ -0,0 +1,16 @@
+package query
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestAssertion_Check(t *testing.T) {
+	// Arrange
+	assertion := NewCountAssertion(BinOpGreaterEqual, 100)
+
+	// Act & Assert
+	common.AssertNil(t, assertion.Check(100))
+	common.AssertNil(t, assertion.Check(101))
+	common.AssertError(t, "Assertion 'count >= 100' failed: Statement returned 99 features", assertion.Check(99))
+}
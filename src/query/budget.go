@@ -0,0 +1,84 @@
+package query
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBudget tracks the approximate amount of memory a single query uses for buffered features, sub-statement caches
+// and the accumulated result. A budget with a limit of 0 or less is unlimited and only tracks the usage. The budget can
+// be used in concurrent goroutines.
+//
+// Since the budget is passed to all parts of an execution, it also enforces the other Limits of the query (s. limits.go).
+type MemoryBudget struct {
+	limitInBytes int64
+	usedInBytes  int64
+	peakInBytes  int64
+	mutex        *sync.Mutex
+
+	limits         Limits
+	context        context.Context // Cancels the execution when done. Nil means the execution can't be cancelled.
+	startTime      time.Time
+	readCells      int64
+	resultFeatures int64
+	warnings       []string // Corrupt cells skipped during the execution, s. addCellWarning
+}
+
+func NewMemoryBudget(limitInBytes int64) *MemoryBudget {
+	return &MemoryBudget{
+		limitInBytes: limitInBytes,
+		mutex:        &sync.Mutex{},
+	}
+}
+
+// reserve adds the given amount of bytes to the used memory. An error is returned and nothing is reserved, when this
+// would exceed the limit of the budget.
+func (b *MemoryBudget) reserve(bytes int64) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.limitInBytes > 0 && b.usedInBytes+bytes > b.limitInBytes {
+		return newLimitExceededError(LimitMemory, b.limitInBytes, "Memory budget of %d MB exceeded: Query already uses ~%d MB and requested %d KB more. Use a smaller area or more specific filters.", b.limitInBytes/1024/1024, b.usedInBytes/1024/1024, bytes/1024)
+	}
+
+	b.usedInBytes += bytes
+	if b.usedInBytes > b.peakInBytes {
+		b.peakInBytes = b.usedInBytes
+	}
+
+	return nil
+}
+
+// release frees the given amount of bytes, which must have been reserved before.
+func (b *MemoryBudget) release(bytes int64) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.usedInBytes -= bytes
+	if b.usedInBytes < 0 {
+		b.usedInBytes = 0
+	}
+}
+
+// GetUsedBytes returns the amount of currently reserved bytes.
+func (b *MemoryBudget) GetUsedBytes() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.usedInBytes
+}
+
+// GetPeakBytes returns the highest amount of bytes that were reserved at the same time.
+func (b *MemoryBudget) GetPeakBytes() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.peakInBytes
+}
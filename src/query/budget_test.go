@@ -0,0 +1,41 @@
+package query
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestMemoryBudget_reserveAndRelease(t *testing.T) {
+	// Arrange
+	budget := NewMemoryBudget(100)
+
+	// Act & Assert
+	common.AssertNil(t, budget.reserve(60))
+	common.AssertEqual(t, int64(60), budget.GetUsedBytes())
+
+	common.AssertNotNil(t, budget.reserve(50))
+	common.AssertEqual(t, int64(60), budget.GetUsedBytes())
+
+	budget.release(20)
+	common.AssertNil(t, budget.reserve(50))
+	common.AssertEqual(t, int64(90), budget.GetUsedBytes())
+	common.AssertEqual(t, int64(90), budget.GetPeakBytes())
+}
+
+func TestMemoryBudget_unlimited(t *testing.T) {
+	// Arrange
+	budget := NewMemoryBudget(0)
+
+	// Act & Assert
+	common.AssertNil(t, budget.reserve(1_000_000_000))
+	common.AssertEqual(t, int64(1_000_000_000), budget.GetUsedBytes())
+}
+
+func TestMemoryBudget_nilBudgetDoesNotTrack(t *testing.T) {
+	// Arrange
+	var budget *MemoryBudget
+
+	// Act & Assert
+	common.AssertNil(t, budget.reserve(123))
+	budget.release(123)
+}
@@ -0,0 +1,421 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"soq/index"
+	"soq/osm"
+)
+
+// Condition is a filter condition of the QueryBuilder. Conditions are turned into filter expressions when the query is
+// built, since tags can only be resolved using the tag index.
+type Condition interface {
+	build(tagIndex *index.TagIndex) (FilterExpression, error)
+}
+
+// QueryBuilder creates queries programmatically without writing and parsing a query string. The resulting query is the
+// same as the parser would create for the equivalent query string. Example:
+//
+//	q, err := query.Builder().
+//		Bbox(9.9, 53.5, 10.0, 53.6).Nodes().Where(query.Tag("amenity", "bench")).And(query.Tag("seats", "*")).
+//		Build(tagIndex)
+type QueryBuilder struct {
+	statements []*StatementBuilder
+}
+
+func Builder() *QueryBuilder {
+	return &QueryBuilder{}
+}
+
+// Bbox starts a new top-level statement searching within the given bbox.
+func (b *QueryBuilder) Bbox(minLon float64, minLat float64, maxLon float64, maxLat float64) *StatementBuilder {
+	return b.newStatement(NewBboxLocationExpression(&orb.Bound{
+		Min: orb.Point{minLon, minLat},
+		Max: orb.Point{maxLon, maxLat},
+	}))
+}
+
+// All starts a new top-level statement searching within the whole extent of the imported data.
+func (b *QueryBuilder) All() *StatementBuilder {
+	return b.newStatement(NewCoverageLocationExpression())
+}
+
+func (b *QueryBuilder) newStatement(location LocationExpression) *StatementBuilder {
+	statement := &StatementBuilder{
+		queryBuilder: b,
+		location:     location,
+		queryType:    -1,
+	}
+	b.statements = append(b.statements, statement)
+	return statement
+}
+
+// Build creates the query from all statements of this builder.
+func (b *QueryBuilder) Build(tagIndex *index.TagIndex) (*Query, error) {
+	if len(b.statements) == 0 {
+		return nil, errors.New("Query builder contains no statements")
+	}
+
+	var topLevelStatements []Statement
+	for _, statementBuilder := range b.statements {
+		statement, err := statementBuilder.buildStatement(tagIndex)
+		if err != nil {
+			return nil, err
+		}
+		if statement.HasStatistics() != (b.statements[0].statsKey != "") {
+			return nil, errors.New("Statements with value statistics can't be combined with statements returning features")
+		}
+		topLevelStatements = append(topLevelStatements, *statement)
+	}
+
+	return NewQuery(topLevelStatements), nil
+}
+
+// StatementBuilder builds a single statement. Top-level statements are created by the QueryBuilder, sub-statements by
+// the This function. Sub-statements are conditions and can therefore be used in Where, And and Or.
+type StatementBuilder struct {
+	queryBuilder *QueryBuilder // nil for sub-statements
+	location     LocationExpression
+	queryType    osm.OsmQueryType
+	condition    Condition
+	assertion    *Assertion
+	selectedKeys []string // Nil means all tags are selected
+	transform    GeometryTransform
+	statsKey     string // Empty means the features are returned
+	err          error  // First error that occurred while building this statement
+}
+
+// This starts a new context-aware sub-statement like "this.ways{...}".
+func This() *StatementBuilder {
+	return &StatementBuilder{
+		location:  NewContextAwareLocationExpression(),
+		queryType: -1,
+	}
+}
+
+func (s *StatementBuilder) Nodes() *StatementBuilder {
+	return s.setQueryType(osm.OsmQueryNode)
+}
+
+func (s *StatementBuilder) Ways() *StatementBuilder {
+	return s.setQueryType(osm.OsmQueryWay)
+}
+
+func (s *StatementBuilder) Relations() *StatementBuilder {
+	return s.setQueryType(osm.OsmQueryRelation)
+}
+
+// ChildRelations is only allowed in sub-statements.
+func (s *StatementBuilder) ChildRelations() *StatementBuilder {
+	if s.queryBuilder != nil {
+		s.setError(errors.New("Child relations can only be used in sub-statements"))
+	}
+	return s.setQueryType(osm.OsmQueryChildRelation)
+}
+
+func (s *StatementBuilder) setQueryType(queryType osm.OsmQueryType) *StatementBuilder {
+	if s.queryType != -1 {
+		s.setError(errors.Errorf("Object type of statement already set to %s", s.queryType.String()))
+	}
+	s.queryType = queryType
+	return s
+}
+
+// Where sets the filter condition of this statement.
+func (s *StatementBuilder) Where(condition Condition) *StatementBuilder {
+	if s.condition != nil {
+		s.setError(errors.New("Condition of statement already set, use And or Or to add further conditions"))
+	}
+	s.condition = condition
+	return s
+}
+
+// And combines the current condition and the given one with a logical AND. Conditions are combined from left to right.
+func (s *StatementBuilder) And(condition Condition) *StatementBuilder {
+	return s.combineCondition(condition, LogicOpAnd)
+}
+
+// Or combines the current condition and the given one with a logical OR. Conditions are combined from left to right.
+func (s *StatementBuilder) Or(condition Condition) *StatementBuilder {
+	return s.combineCondition(condition, LogicOpOr)
+}
+
+func (s *StatementBuilder) combineCondition(condition Condition, operator LogicalOperator) *StatementBuilder {
+	if s.condition == nil {
+		s.setError(errors.Errorf("No condition to combine with using %s, use Where first", operator.string()))
+		return s
+	}
+	s.condition = &logicalCondition{a: s.condition, b: condition, operator: operator}
+	return s
+}
+
+// AssertCount adds an assertion on the number of features of this statement, like "ASSERT count >= 100".
+func (s *StatementBuilder) AssertCount(operator BinaryOperator, expectedCount int) *StatementBuilder {
+	if s.queryBuilder == nil {
+		s.setError(errors.New("Assertions can only be used on top-level statements"))
+	}
+	s.assertion = NewCountAssertion(operator, expectedCount)
+	return s
+}
+
+// Select restricts the tags of the result features to the given keys, like "select(name, amenity)".
+func (s *StatementBuilder) Select(keys ...string) *StatementBuilder {
+	if s.queryBuilder == nil {
+		s.setError(errors.New("Tag selections can only be used on top-level statements"))
+	}
+	if len(keys) == 0 {
+		s.setError(errors.New("At least one key is needed for a tag selection"))
+	}
+	s.selectedKeys = keys
+	return s
+}
+
+// Stats counts the values of the given key among the features instead of returning them, like "stats(surface)".
+func (s *StatementBuilder) Stats(key string) *StatementBuilder {
+	if s.queryBuilder == nil {
+		s.setError(errors.New("Value statistics can only be used on top-level statements"))
+	}
+	if key == "" {
+		s.setError(errors.New("A key is needed for value statistics"))
+	}
+	s.statsKey = key
+	return s
+}
+
+// Centroid turns the ways and relations of the result into their centroid points, like "centroid()".
+func (s *StatementBuilder) Centroid() *StatementBuilder {
+	return s.setGeometryTransform(GeometryTransformCentroid)
+}
+
+// AsBbox turns the ways and relations of the result into their bounding box rectangles, like "bbox()". It's not called
+// "Bbox", since Bbox starts a new statement.
+func (s *StatementBuilder) AsBbox() *StatementBuilder {
+	return s.setGeometryTransform(GeometryTransformBbox)
+}
+
+func (s *StatementBuilder) setGeometryTransform(transform GeometryTransform) *StatementBuilder {
+	if s.queryBuilder == nil {
+		s.setError(errors.New("Geometry transforms can only be used on top-level statements"))
+	}
+	if s.transform != GeometryTransformNone {
+		s.setError(errors.Errorf("Geometry transform of statement already set to %s", s.transform.String()))
+	}
+	s.transform = transform
+	return s
+}
+
+// Bbox finishes this statement and starts a new top-level statement. See QueryBuilder.Bbox.
+func (s *StatementBuilder) Bbox(minLon float64, minLat float64, maxLon float64, maxLat float64) *StatementBuilder {
+	return s.getQueryBuilder().Bbox(minLon, minLat, maxLon, maxLat)
+}
+
+// All finishes this statement and starts a new top-level statement. See QueryBuilder.All.
+func (s *StatementBuilder) All() *StatementBuilder {
+	return s.getQueryBuilder().All()
+}
+
+// Build creates the whole query this statement belongs to. See QueryBuilder.Build.
+func (s *StatementBuilder) Build(tagIndex *index.TagIndex) (*Query, error) {
+	if s.queryBuilder == nil {
+		return nil, errors.New("Sub-statements cannot be built as query")
+	}
+	return s.queryBuilder.Build(tagIndex)
+}
+
+func (s *StatementBuilder) getQueryBuilder() *QueryBuilder {
+	if s.queryBuilder == nil {
+		s.setError(errors.New("Sub-statements cannot start new top-level statements"))
+		// Return a detached builder so that the chain doesn't panic. The error is reported when building this statement.
+		return Builder()
+	}
+	return s.queryBuilder
+}
+
+func (s *StatementBuilder) setError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *StatementBuilder) buildStatement(tagIndex *index.TagIndex) (*Statement, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.queryType == -1 {
+		return nil, errors.New("Object type of statement not set, use e.g. Nodes()")
+	}
+	if s.condition == nil {
+		return nil, errors.New("Condition of statement not set, use Where()")
+	}
+
+	filterExpression, err := s.condition.build(tagIndex)
+	if err != nil {
+		return nil, err
+	}
+	filterExpression, err = NormalizeFilterExpression(filterExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := NewStatement(s.location, s.queryType, filterExpression)
+	statement.SetAssertion(s.assertion)
+	statement.SetGeometryTransform(s.transform)
+
+	if s.selectedKeys != nil {
+		selectedKeyIndices := []int{}
+		for _, key := range s.selectedKeys {
+			keyIndex := tagIndex.GetKeyIndexFromKeyString(key)
+			if keyIndex != index.NotFound {
+				selectedKeyIndices = append(selectedKeyIndices, keyIndex)
+			}
+		}
+		statement.SetSelectedKeys(selectedKeyIndices)
+	}
+
+	if s.statsKey != "" {
+		statement.SetStatisticsKey(s.statsKey, tagIndex.GetKeyIndexFromKeyString(s.statsKey))
+	}
+
+	return statement, nil
+}
+
+func (s *StatementBuilder) build(tagIndex *index.TagIndex) (FilterExpression, error) {
+	if s.queryBuilder != nil {
+		return nil, errors.New("Only sub-statements created with This() can be used as condition")
+	}
+
+	statement, err := s.buildStatement(tagIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSubStatementFilterExpression(statement), nil
+}
+
+type tagCondition struct {
+	key      string
+	value    string
+	operator BinaryOperator
+}
+
+// Tag creates a condition like "key=value". The value "*" is a wildcard for any value.
+func Tag(key string, value string) Condition {
+	return TagWithOperator(key, BinOpEqual, value)
+}
+
+// TagWithOperator creates a condition like "key>=value". Wildcard values ("*") only support the = and != operator.
+func TagWithOperator(key string, operator BinaryOperator, value string) Condition {
+	return &tagCondition{key: key, value: value, operator: operator}
+}
+
+func (c *tagCondition) build(tagIndex *index.TagIndex) (FilterExpression, error) {
+	isWildcard := c.value == "*"
+	if isWildcard && c.operator != BinOpEqual && c.operator != BinOpNotEqual {
+		return nil, errors.Errorf("Only '=' or '!=' operators are allowed when using wildcard for key %s", c.key)
+	}
+	return NewTagFilterExpressionFromStrings(tagIndex, c.key, c.value, isWildcard, c.operator), nil
+}
+
+type idCondition struct {
+	ids      []uint64
+	operator BinaryOperator
+}
+
+// Id creates a condition like "id>123".
+func Id(operator BinaryOperator, id uint64) Condition {
+	return &idCondition{ids: []uint64{id}, operator: operator}
+}
+
+// IdIn creates a condition like "id in (1, 2, 3)".
+func IdIn(ids ...uint64) Condition {
+	return &idCondition{ids: ids, operator: BinOpInvalid}
+}
+
+func (c *idCondition) build(tagIndex *index.TagIndex) (FilterExpression, error) {
+	if c.operator == BinOpInvalid {
+		if len(c.ids) == 0 {
+			return nil, errors.New("At least one ID is needed in an ID list condition")
+		}
+		return NewIdListFilterExpression(c.ids), nil
+	}
+	return NewIdFilterExpression(c.ids[0], c.operator), nil
+}
+
+type geometryCondition struct {
+	isArea bool
+}
+
+// IsClosed creates a condition like "is_closed()".
+func IsClosed() Condition {
+	return &geometryCondition{isArea: false}
+}
+
+// IsArea creates a condition like "is_area()".
+func IsArea() Condition {
+	return &geometryCondition{isArea: true}
+}
+
+func (c *geometryCondition) build(tagIndex *index.TagIndex) (FilterExpression, error) {
+	if c.isArea {
+		return NewAreaFilterExpression(tagIndex), nil
+	}
+	return NewClosedFilterExpression(), nil
+}
+
+type typeCondition struct {
+	objectType osm.OsmObjectType
+}
+
+// IsType creates a condition like "type()=node".
+func IsType(objectType osm.OsmObjectType) Condition {
+	return &typeCondition{objectType: objectType}
+}
+
+func (c *typeCondition) build(tagIndex *index.TagIndex) (FilterExpression, error) {
+	return NewTypeFilterExpression(c.objectType, true), nil
+}
+
+type negatedCondition struct {
+	condition Condition
+}
+
+// Not negates the given condition like "!(...)" does.
+func Not(condition Condition) Condition {
+	return &negatedCondition{condition: condition}
+}
+
+func (c *negatedCondition) build(tagIndex *index.TagIndex) (FilterExpression, error) {
+	expression, err := c.condition.build(tagIndex)
+	if err != nil {
+		return nil, err
+	}
+	return NewNegatedFilterExpression(expression), nil
+}
+
+type logicalCondition struct {
+	a        Condition
+	b        Condition
+	operator LogicalOperator
+}
+
+// And combines the given conditions with a logical AND, which is useful for nested conditions like "a AND (b OR c)".
+func And(a Condition, b Condition) Condition {
+	return &logicalCondition{a: a, b: b, operator: LogicOpAnd}
+}
+
+// Or combines the given conditions with a logical OR, which is useful for nested conditions like "a OR (b AND c)".
+func Or(a Condition, b Condition) Condition {
+	return &logicalCondition{a: a, b: b, operator: LogicOpOr}
+}
+
+func (c *logicalCondition) build(tagIndex *index.TagIndex) (FilterExpression, error) {
+	expressionA, err := c.a.build(tagIndex)
+	if err != nil {
+		return nil, err
+	}
+	expressionB, err := c.b.build(tagIndex)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogicalFilterExpression(expressionA, expressionB, c.operator), nil
+}
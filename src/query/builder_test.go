@@ -0,0 +1,105 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/index"
+	"soq/osm"
+	"testing"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "seats"}, [][]string{{"bench", "toilets"}, {"2", "3"}})
+
+	// Act
+	q, err := Builder().
+		Bbox(1, 2, 3, 4).Nodes().Where(Tag("amenity", "bench")).And(Not(Tag("seats", "*"))).
+		AssertCount(BinOpGreaterEqual, 10).
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	expectedStatement := NewStatement(
+		NewBboxLocationExpression(&orb.Bound{Min: orb.Point{1, 2}, Max: orb.Point{3, 4}}),
+		osm.OsmQueryNode,
+		NewLogicalFilterExpression(NewTagFilterExpression(0, 0, BinOpEqual), NewNegatedFilterExpression(NewKeyFilterExpression(1, true)), LogicOpAnd),
+	)
+	expectedStatement.SetAssertion(NewCountAssertion(BinOpGreaterEqual, 10))
+	common.AssertEqual(t, []Statement{*expectedStatement}, q.GetTopLevelStatements())
+}
+
+func TestBuilder_Build_subStatementAndMultipleStatements(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"building"}, [][]string{{"yes"}})
+
+	// Act
+	q, err := Builder().
+		All().Nodes().Where(This().Ways().Where(Tag("building", "yes"))).
+		Bbox(1, 2, 3, 4).Ways().Where(IdIn(1, 2)).
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 2, len(q.GetTopLevelStatements()))
+	subStatementExpression, isSubStatementExpression := q.GetTopLevelStatements()[0].GetFilterExpression().(*SubStatementFilterExpression)
+	common.AssertTrue(t, isSubStatementExpression)
+	common.AssertEqual(t, osm.OsmQueryWay, subStatementExpression.GetStatement().queryType)
+	common.AssertEqual(t, NewIdListFilterExpression([]uint64{1, 2}), q.GetTopLevelStatements()[1].GetFilterExpression())
+}
+
+func TestBuilder_Build_geometryConditions(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"area"}, [][]string{{"no", "yes"}})
+
+	// Act
+	q, err := Builder().
+		All().Ways().Where(IsArea()).Or(IsClosed()).
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, NewLogicalFilterExpression(NewAreaFilterExpression(tagIndex), NewClosedFilterExpression(), LogicOpOr), q.GetTopLevelStatements()[0].GetFilterExpression())
+}
+
+func TestBuilder_Build_typeCondition(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"a"}, [][]string{{"b"}})
+
+	// Act
+	q, err := Builder().
+		All().Relations().Where(Tag("a", "b")).And(Not(IsType(osm.OsmObjRelation))).
+		Build(tagIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	expectedExpression := NewLogicalFilterExpression(NewTagFilterExpression(0, 0, BinOpEqual), NewNegatedFilterExpression(NewTypeFilterExpression(osm.OsmObjRelation, true)), LogicOpAnd)
+	common.AssertEqual(t, expectedExpression, q.GetTopLevelStatements()[0].GetFilterExpression())
+}
+
+func TestBuilder_Build_invalidStatements(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"a"}, [][]string{{"b"}})
+
+	// Act & Assert
+	_, err := Builder().Build(tagIndex)
+	common.AssertNotNil(t, err)
+
+	_, err = Builder().Bbox(1, 2, 3, 4).Where(Tag("a", "b")).Build(tagIndex)
+	common.AssertNotNil(t, err)
+
+	_, err = Builder().Bbox(1, 2, 3, 4).Nodes().Build(tagIndex)
+	common.AssertNotNil(t, err)
+
+	_, err = Builder().Bbox(1, 2, 3, 4).Nodes().Where(Tag("a", "b")).Where(Tag("a", "b")).Build(tagIndex)
+	common.AssertNotNil(t, err)
+
+	_, err = Builder().Bbox(1, 2, 3, 4).Nodes().Where(TagWithOperator("a", BinOpGreater, "*")).Build(tagIndex)
+	common.AssertNotNil(t, err)
+
+	_, err = Builder().Bbox(1, 2, 3, 4).ChildRelations().Where(Tag("a", "b")).Build(tagIndex)
+	common.AssertNotNil(t, err)
+
+	_, err = Builder().Bbox(1, 2, 3, 4).Ways().Where(Tag("a", "b")).Centroid().AsBbox().Build(tagIndex)
+	common.AssertNotNil(t, err)
+}
@@ -0,0 +1,108 @@
+package query
+
+import (
+	"github.com/pkg/errors"
+	"reflect"
+	"soq/feature"
+	"soq/osm"
+)
+
+// contextAccessors defines for each object type of a context feature which "this.<type>" accessors are supported and
+// how the IDs of the related objects are determined. All of them use data stored in the index: The reverse IDs (the
+// ways and relations of a node, the relations of a way), the nodes of a way and the member lists of a relation. This is
+// the single source of truth for context-aware statements, the parser uses it to reject unsupported combinations.
+//
+//	context  | nodes        | ways          | relations          | child_relations
+//	---------|--------------|---------------|--------------------|-----------------
+//	node     | -            | ways of node  | relations of node  | -
+//	way      | nodes of way | -             | relations of way   | -
+//	relation | node members | way members   | parent relations   | child relation members
+var contextAccessors = map[osm.OsmObjectType]map[osm.OsmQueryType]func(context feature.Feature) []uint64{
+	osm.OsmObjNode: {
+		osm.OsmQueryWay: func(context feature.Feature) []uint64 {
+			return toUint64(context.(feature.NodeFeature).GetWayIds())
+		},
+		osm.OsmQueryRelation: func(context feature.Feature) []uint64 {
+			return toUint64(context.(feature.NodeFeature).GetRelationIds())
+		},
+	},
+	osm.OsmObjWay: {
+		osm.OsmQueryNode: func(context feature.Feature) []uint64 {
+			var ids []uint64
+			for _, node := range context.(feature.WayFeature).GetNodes() {
+				ids = append(ids, uint64(node.ID))
+			}
+			return ids
+		},
+		osm.OsmQueryRelation: func(context feature.Feature) []uint64 {
+			return toUint64(context.(feature.WayFeature).GetRelationIds())
+		},
+	},
+	osm.OsmObjRelation: {
+		osm.OsmQueryNode: func(context feature.Feature) []uint64 {
+			return getMemberIds(context.(feature.RelationFeature), osm.OsmObjNode)
+		},
+		osm.OsmQueryWay: func(context feature.Feature) []uint64 {
+			return getMemberIds(context.(feature.RelationFeature), osm.OsmObjWay)
+		},
+		osm.OsmQueryRelation: func(context feature.Feature) []uint64 {
+			return toUint64(context.(feature.RelationFeature).GetParentRelationIds())
+		},
+		osm.OsmQueryChildRelation: func(context feature.Feature) []uint64 {
+			return getMemberIds(context.(feature.RelationFeature), osm.OsmObjRelation)
+		},
+	},
+}
+
+// IsContextAccessSupported returns true when a context-aware statement of the given query type (like "this.ways") can
+// be used within a statement of the given object type.
+func IsContextAccessSupported(contextType osm.OsmObjectType, queryType osm.OsmQueryType) bool {
+	_, ok := contextAccessors[contextType][queryType]
+	return ok
+}
+
+// GetContextRelatedIds returns the IDs of all objects of the given query type related to the given context feature,
+// e.g. the IDs of all ways a node is part of.
+func GetContextRelatedIds(context feature.Feature, queryType osm.OsmQueryType) ([]uint64, error) {
+	contextType, ok := getObjectType(context)
+	if !ok {
+		return nil, errors.Errorf("Unsupported object type %s for sub-statement expression", reflect.TypeOf(context).String())
+	}
+
+	accessor, ok := contextAccessors[contextType][queryType]
+	if !ok {
+		return nil, errors.Errorf("this.%s is not supported on %ss", queryType.String(), contextType.String())
+	}
+
+	return accessor(context), nil
+}
+
+func getObjectType(f feature.Feature) (osm.OsmObjectType, bool) {
+	switch f.(type) {
+	case feature.NodeFeature:
+		return osm.OsmObjNode, true
+	case feature.WayFeature:
+		return osm.OsmObjWay, true
+	case feature.RelationFeature:
+		return osm.OsmObjRelation, true
+	}
+	return -1, false
+}
+
+func getMemberIds(relation feature.RelationFeature, memberType osm.OsmObjectType) []uint64 {
+	var ids []uint64
+	for _, member := range relation.GetMembers() {
+		if member.Type == memberType {
+			ids = append(ids, member.ID)
+		}
+	}
+	return ids
+}
+
+func toUint64[T ~int64](ids []T) []uint64 {
+	result := make([]uint64, len(ids))
+	for i, id := range ids {
+		result[i] = uint64(id)
+	}
+	return result
+}
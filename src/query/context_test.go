@@ -0,0 +1,185 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	paulmachOsm "github.com/paulmach/osm"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	"soq/osm"
+	"testing"
+)
+
+func TestGetContextRelatedIds_node(t *testing.T) {
+	// Arrange
+	node := newTestNode(1, 0.5, 0.5)
+	node.WayIds = []paulmachOsm.WayID{2, 3}
+	node.RelationIds = []paulmachOsm.RelationID{4}
+
+	// Act
+	wayIds, wayErr := GetContextRelatedIds(node, osm.OsmQueryWay)
+	relationIds, relationErr := GetContextRelatedIds(node, osm.OsmQueryRelation)
+	_, nodeErr := GetContextRelatedIds(node, osm.OsmQueryNode)
+	_, childRelationErr := GetContextRelatedIds(node, osm.OsmQueryChildRelation)
+
+	// Assert
+	common.AssertNil(t, wayErr)
+	common.AssertEqual(t, []uint64{2, 3}, wayIds)
+	common.AssertNil(t, relationErr)
+	common.AssertEqual(t, []uint64{4}, relationIds)
+	common.AssertNotNil(t, nodeErr)
+	common.AssertNotNil(t, childRelationErr)
+}
+
+func TestGetContextRelatedIds_way(t *testing.T) {
+	// Arrange
+	way := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Geometry: &orb.LineString{{0, 0}, {1, 1}}},
+		Nodes:                  paulmachOsm.WayNodes{{ID: 2}, {ID: 3}},
+		RelationIds:            []paulmachOsm.RelationID{4},
+	}
+
+	// Act
+	nodeIds, nodeErr := GetContextRelatedIds(way, osm.OsmQueryNode)
+	relationIds, relationErr := GetContextRelatedIds(way, osm.OsmQueryRelation)
+	_, wayErr := GetContextRelatedIds(way, osm.OsmQueryWay)
+
+	// Assert
+	common.AssertNil(t, nodeErr)
+	common.AssertEqual(t, []uint64{2, 3}, nodeIds)
+	common.AssertNil(t, relationErr)
+	common.AssertEqual(t, []uint64{4}, relationIds)
+	common.AssertNotNil(t, wayErr)
+}
+
+func TestGetContextRelatedIds_relation(t *testing.T) {
+	// Arrange
+	relation := &index.EncodedRelationFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1},
+		NodeIds:                []paulmachOsm.NodeID{2},
+		WayIds:                 []paulmachOsm.WayID{3, 4},
+		ChildRelationIds:       []paulmachOsm.RelationID{5},
+		ParentRelationIds:      []paulmachOsm.RelationID{6},
+	}
+
+	// Act
+	nodeIds, nodeErr := GetContextRelatedIds(relation, osm.OsmQueryNode)
+	wayIds, wayErr := GetContextRelatedIds(relation, osm.OsmQueryWay)
+	parentIds, parentErr := GetContextRelatedIds(relation, osm.OsmQueryRelation)
+	childIds, childErr := GetContextRelatedIds(relation, osm.OsmQueryChildRelation)
+
+	// Assert
+	common.AssertNil(t, nodeErr)
+	common.AssertEqual(t, []uint64{2}, nodeIds)
+	common.AssertNil(t, wayErr)
+	common.AssertEqual(t, []uint64{3, 4}, wayIds)
+	common.AssertNil(t, parentErr)
+	common.AssertEqual(t, []uint64{6}, parentIds)
+	common.AssertNil(t, childErr)
+	common.AssertEqual(t, []uint64{5}, childIds)
+}
+
+func TestSubStatementFilterExpression_unsupportedContextAccess(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{}
+	expression := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(0, false)))
+	expression.statement.geometryIndex = geomIndex
+
+	// Act
+	applies, err := expression.Applies(newTestNode(1, 0.5, 0.5), nil)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertFalse(t, applies)
+}
+
+func TestSubStatementFilterExpression_cachesNegativeResults(t *testing.T) {
+	// Arrange
+	taggedNode := newTestNode(2, 0.5, 0.5)
+	taggedNode.Keys = []int{0}
+	taggedNode.Values = []int{0}
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{
+		{0, 0}: {taggedNode, newTestNode(3, 0.6, 0.6)},
+		{2, 0}: {newTestNode(4, 2.5, 0.5)},
+	}}
+	expression := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(0, true)))
+	expression.statement.geometryIndex = geomIndex
+	newWay := func(id uint64, nodes paulmachOsm.WayNodes) *index.EncodedWayFeature {
+		return &index.EncodedWayFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: id}, Nodes: nodes}
+	}
+
+	// Act
+	appliesToTaggedWay, taggedErr := expression.Applies(newWay(1, paulmachOsm.WayNodes{{ID: 2, Lon: 0.5, Lat: 0.5}, {ID: 3, Lon: 0.6, Lat: 0.6}}), nil)
+	appliesToUntaggedWay, untaggedErr := expression.Applies(newWay(5, paulmachOsm.WayNodes{{ID: 3, Lon: 0.6, Lat: 0.6}}), nil)
+	appliesToWayInOtherCell, otherCellErr := expression.Applies(newWay(6, paulmachOsm.WayNodes{{ID: 4, Lon: 2.5, Lat: 0.5}}), nil)
+
+	// Assert
+	common.AssertNil(t, taggedErr)
+	common.AssertTrue(t, appliesToTaggedWay)
+	common.AssertNil(t, untaggedErr)
+	common.AssertFalse(t, appliesToUntaggedWay)
+	common.AssertNil(t, otherCellErr)
+	common.AssertFalse(t, appliesToWayInOtherCell)
+	common.AssertEqual(t, map[common.CellIndex]bool{{0, 0}: true, {2, 0}: false}, expression.cachedCells)
+	common.AssertEqual(t, map[uint64]bool{5: true, 6: true}, expression.negativeContextCache)
+}
+
+func TestSubStatementFilterExpression_skipsCellsWithoutRelatedNodes(t *testing.T) {
+	// Arrange
+	memberNode := newTestNode(2, 0.5, 0.5)
+	memberNode.Keys = []int{0}
+	memberNode.Values = []int{0}
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{
+		{0, 0}: {memberNode},
+		{1, 0}: {newTestNode(3, 1.5, 0.5)},
+	}}
+	expression := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(0, true)))
+	expression.statement.geometryIndex = geomIndex
+	relationGeometry := orb.Bound{Min: orb.Point{0.5, 0.5}, Max: orb.Point{1.5, 0.5}}.ToPolygon()
+	newRelation := func(id uint64, nodeIds []paulmachOsm.NodeID) *index.EncodedRelationFeature {
+		return &index.EncodedRelationFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: id, Geometry: &relationGeometry}, NodeIds: nodeIds}
+	}
+
+	// Act
+	appliesToRelation, err := expression.Applies(newRelation(1, []paulmachOsm.NodeID{2}), nil)
+	appliesToRelationWithoutNodesInIndex, otherErr := expression.Applies(newRelation(4, []paulmachOsm.NodeID{5}), nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertTrue(t, appliesToRelation)
+	common.AssertNil(t, otherErr)
+	common.AssertFalse(t, appliesToRelationWithoutNodesInIndex)
+	common.AssertEqual(t, map[common.CellIndex]bool{{0, 0}: true}, expression.cachedCells)
+	common.AssertEqual(t, map[uint64]bool{4: true}, expression.negativeContextCache)
+}
+
+func TestSubStatementFilterExpression_clearsCachesOnEviction(t *testing.T) {
+	// Arrange
+	taggedNode := newTestNode(2, 0.5, 0.5)
+	taggedNode.Keys = []int{0}
+	taggedNode.Values = []int{0}
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{
+		{0, 0}: {taggedNode, newTestNode(3, 0.6, 0.6)},
+	}}
+	expression := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(0, true)))
+	expression.statement.geometryIndex = geomIndex
+	accountant := common.NewMemoryAccountant(0)
+	expression.registerAt(accountant)
+	newWay := func(id uint64, nodes paulmachOsm.WayNodes) *index.EncodedWayFeature {
+		return &index.EncodedWayFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: id}, Nodes: nodes}
+	}
+	_, err := expression.Applies(newWay(1, paulmachOsm.WayNodes{{ID: 3, Lon: 0.6, Lat: 0.6}}), nil)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, int64(2*idCacheEntrySizeInBytes), accountant.GetUsedBytes())
+
+	// Act
+	expression.EvictMemory(1)
+	applies, err := expression.Applies(newWay(5, paulmachOsm.WayNodes{{ID: 2, Lon: 0.5, Lat: 0.5}}), nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertTrue(t, applies)
+	common.AssertEqual(t, map[uint64]uint64{2: 2}, expression.idCache)
+	common.AssertEqual(t, map[uint64]bool{}, expression.negativeContextCache)
+	common.AssertEqual(t, int64(idCacheEntrySizeInBytes), accountant.GetUsedBytes())
+}
@@ -0,0 +1,52 @@
+package query
+
+import (
+	"soq/feature"
+	"soq/osm"
+)
+
+// Approximate size of one entry of the map of returned features (key and map overhead).
+const distinctEntryBytes = 48
+
+type distinctKey struct {
+	objectType osm.OsmObjectType
+	id         uint64
+}
+
+// distinctFilter remembers the type and ID of all features returned so far to skip features that an earlier top-level
+// statement already returned. The remembered features are part of the memory budget.
+type distinctFilter struct {
+	returnedFeatures map[distinctKey]struct{}
+	budget           *MemoryBudget
+	reservedBytes    int64
+}
+
+func newDistinctFilter(budget *MemoryBudget) *distinctFilter {
+	return &distinctFilter{
+		returnedFeatures: map[distinctKey]struct{}{},
+		budget:           budget,
+	}
+}
+
+// isDuplicate returns true when a feature with the same type and ID has already been passed to this function.
+func (d *distinctFilter) isDuplicate(f feature.Feature) (bool, error) {
+	objectType, _ := getObjectType(f)
+	key := distinctKey{objectType: objectType, id: f.GetID()}
+	if _, ok := d.returnedFeatures[key]; ok {
+		return true, nil
+	}
+
+	err := d.budget.reserve(distinctEntryBytes)
+	if err != nil {
+		return false, err
+	}
+	d.reservedBytes += distinctEntryBytes
+	d.returnedFeatures[key] = struct{}{}
+	return false, nil
+}
+
+// release frees the memory of the remembered features.
+func (d *distinctFilter) release() {
+	d.budget.release(d.reservedBytes)
+	d.reservedBytes = 0
+}
@@ -0,0 +1,59 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"soq/feature"
+)
+
+// ElevationFilterExpression compares the elevation of features numerically, e.g. "ele>1000". Nodes store their "ele"
+// tag as numerical elevation in meters, which is used for the comparison. Nodes without a valid elevation, e.g. with
+// "ele=unknown", never match. For ways and relations, the comparison of the tag values is used as fallback.
+type ElevationFilterExpression struct {
+	key       int
+	elevation float64
+	operator  BinaryOperator
+	fallback  FilterExpression
+}
+
+func NewElevationFilterExpression(key int, elevation float64, operator BinaryOperator, fallback FilterExpression) *ElevationFilterExpression {
+	return &ElevationFilterExpression{
+		key:       key,
+		elevation: elevation,
+		operator:  operator,
+		fallback:  fallback,
+	}
+}
+
+func (f ElevationFilterExpression) Applies(featureToCheck feature.Feature, context feature.Feature) (bool, error) {
+	if sigolo.ShouldLogTrace() {
+		sigolo.Tracef("ElevationFilterExpression: %s%f", f.operator.string(), f.elevation)
+	}
+
+	nodeFeature, isNode := featureToCheck.(feature.NodeFeature)
+	if !isNode {
+		return f.fallback.Applies(featureToCheck, context)
+	}
+
+	elevation, hasElevation := nodeFeature.GetElevation()
+	if !hasElevation {
+		return false, nil
+	}
+
+	switch f.operator {
+	case BinOpGreater:
+		return elevation > f.elevation, nil
+	case BinOpGreaterEqual:
+		return elevation >= f.elevation, nil
+	case BinOpLower:
+		return elevation < f.elevation, nil
+	case BinOpLowerEqual:
+		return elevation <= f.elevation, nil
+	default:
+		return false, errors.Errorf("Operator %d not supported in ElevationFilterExpression", f.operator)
+	}
+}
+
+func (f ElevationFilterExpression) Print(indent int) {
+	sigolo.Debugf("%s%s: %d%s%f", spacing(indent), "ElevationFilterExpression", f.key, f.operator.string(), f.elevation)
+}
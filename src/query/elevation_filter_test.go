@@ -0,0 +1,73 @@
+package query
+
+import (
+	"github.com/paulmach/osm"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	"testing"
+)
+
+func TestElevationFilterExpression_Applies(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"ele"}, [][]string{{"500", "1200 m", "unknown"}})
+	expression := NewTagFilterExpressionFromStrings(tagIndex, "ele", "1000", false, BinOpGreater)
+
+	nodeWithElevation := func(value int, elevation float64) feature.Feature {
+		node := newTestNode(1, 0, 0)
+		node.Keys = []int{0}
+		node.Values = []int{value}
+		node.Elevation = elevation
+		node.HasElevation = true
+		return node
+	}
+	nodeWithoutElevation := newTestNode(2, 0, 0)
+	nodeWithoutElevation.Keys = []int{0}
+	nodeWithoutElevation.Values = []int{2}
+	wayWithElevation := func(value int) feature.Feature {
+		return &index.EncodedWayFeature{
+			AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 3, Keys: []int{0}, Values: []int{value}},
+			Nodes:                  osm.WayNodes{{ID: 1, Lon: 0, Lat: 0}, {ID: 2, Lon: 1, Lat: 1}},
+		}
+	}
+
+	for _, testCase := range []struct {
+		feature  feature.Feature
+		expected bool
+	}{
+		{nodeWithElevation(1, 1200), true},
+		{nodeWithElevation(0, 500), false},
+		{nodeWithElevation(1, 1000.5), true},
+		{nodeWithoutElevation, false},
+		{newTestNode(4, 0, 0), false},
+		{wayWithElevation(0), false},
+		{wayWithElevation(1), true},
+	} {
+		// Act
+		applies, err := expression.Applies(testCase.feature, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expected, applies)
+	}
+}
+
+func TestNewTagFilterExpressionFromStrings_elevation(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"ele"}, [][]string{{"500", "1200"}})
+
+	// Act
+	comparison := NewTagFilterExpressionFromStrings(tagIndex, "ele", "1000 m", false, BinOpLowerEqual)
+	equality := NewTagFilterExpressionFromStrings(tagIndex, "ele", "500", false, BinOpEqual)
+	text := NewTagFilterExpressionFromStrings(tagIndex, "ele", "foo", false, BinOpGreater)
+
+	// Assert
+	elevationExpression, isElevationExpression := comparison.(*ElevationFilterExpression)
+	common.AssertTrue(t, isElevationExpression)
+	common.AssertEqual(t, 1000.0, elevationExpression.elevation)
+	common.AssertEqual(t, BinOpLowerEqual, elevationExpression.operator)
+	_, isTagExpression := equality.(*TagFilterExpression)
+	common.AssertTrue(t, isTagExpression)
+	_, isTagExpression = text.(*TagFilterExpression)
+	common.AssertTrue(t, isTagExpression)
+}
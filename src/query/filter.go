@@ -9,6 +9,7 @@ import (
 	"soq/index"
 	"soq/osm"
 	"strings"
+	"sync/atomic"
 )
 
 type FilterExpression interface {
@@ -65,6 +66,10 @@ func (f LogicalFilterExpression) Applies(feature feature.Feature, context featur
 			// Error or early exit for "and" expressions where statementA doesn't apply
 			return false, err
 		}
+		if f.operator == LogicOpOr && aApplies {
+			// Early exit for "or" expressions where statementA applies
+			return true, nil
+		}
 		bApplies, err := f.statementB.Applies(feature, context)
 		if err != nil {
 			return false, err
@@ -82,7 +87,7 @@ func (f LogicalFilterExpression) Applies(feature feature.Feature, context featur
 func (f LogicalFilterExpression) Print(indent int) {
 	sigolo.Debugf("%sLogicalFilter:", spacing(indent))
 	f.statementA.Print(indent + 2)
-	sigolo.Debugf("%sAND", spacing(indent))
+	sigolo.Debugf("%s%s", spacing(indent), f.operator.string())
 	f.statementB.Print(indent + 2)
 }
 
@@ -100,6 +105,73 @@ func NewTagFilterExpression(key int, value int, operator BinaryOperator) *TagFil
 	}
 }
 
+// NewTagFilterExpressionFromStrings creates a filter expression for the given key and value strings by looking up their
+// indices in the tag index. For wildcard values, a KeyFilterExpression is returned. When the value doesn't exist in
+// the tag index and a comparison operator is used, the next lower existing value is used and the operator is adjusted
+// accordingly so that the meaning of the expression stays the same. Comparisons of the elevation key with a numerical
+// value result in an ElevationFilterExpression.
+func NewTagFilterExpressionFromStrings(tagIndex *index.TagIndex, key string, value string, isWildcard bool, binaryOperator BinaryOperator) FilterExpression {
+	keyIndex := tagIndex.GetKeyIndexFromKeyString(key)
+
+	if isWildcard {
+		return NewKeyFilterExpression(keyIndex, binaryOperator == BinOpEqual)
+	}
+
+	if key == index.ElevationKey && binaryOperator.IsComparisonOperator() {
+		if elevation, ok := common.ParseElevation(value); ok {
+			fallback := newTagFilterExpressionFromValueString(tagIndex, keyIndex, key, value, binaryOperator)
+			return NewElevationFilterExpression(keyIndex, elevation, binaryOperator, fallback)
+		}
+	}
+
+	return newTagFilterExpressionFromValueString(tagIndex, keyIndex, key, value, binaryOperator)
+}
+
+func newTagFilterExpressionFromValueString(tagIndex *index.TagIndex, keyIndex int, key string, value string, binaryOperator BinaryOperator) *TagFilterExpression {
+	_, valueIndex := tagIndex.GetIndicesFromKeyValueStrings(key, value)
+
+	// Without the key, no feature can match, so there's no need to search for a lower value.
+	if keyIndex != index.NotFound && valueIndex == index.NotFound && binaryOperator.IsComparisonOperator() {
+		// Search for next smaller value and adjust binary operator. It can happen that we search for e.g.
+		// "width>=2.5" but the exact value "2.5" doesn't exist. Then we have to adjust the expression to
+		// "width>2" in case "2" is the next lower existing value for "2.5".
+		var foundEqualNumber bool
+		valueIndex, foundEqualNumber = tagIndex.GetNextLowerValueIndexForKey(keyIndex, value)
+
+		if foundEqualNumber {
+			// The same number exists in a different notation, e.g. "width>=2.0" for the existing value "2". The
+			// expression already has the correct meaning.
+			return NewTagFilterExpression(keyIndex, valueIndex, binaryOperator)
+		}
+
+		if valueIndex == index.NotFound {
+			// There is no lower value, the value is already lower than the lowest value in the tag index.
+			valueIndex = 0
+			if binaryOperator == BinOpGreater {
+				// Example: "width>-1"  ->  "width>=0"
+				binaryOperator = BinOpGreaterEqual
+			} else if binaryOperator == BinOpLowerEqual {
+				// Example: "width<=-1"  ->  "width<0"
+				binaryOperator = BinOpLower
+			}
+			// All other operators are ok, they do not distort/falsify the result of the expression.
+		} else {
+			// We found the next lower value for the given value. We now might have to adjust the binary operator so
+			// that the meaning of the expression is still correct.
+			if binaryOperator == BinOpGreaterEqual {
+				// Example: "width>=2.5"  ->  "width>2"
+				binaryOperator = BinOpGreater
+			} else if binaryOperator == BinOpLower {
+				// Example: "width<2.5"  ->  "width<=2"
+				binaryOperator = BinOpLowerEqual
+			}
+			// All other operators are ok, they do not distort/falsify the result of the expression.
+		}
+	}
+
+	return NewTagFilterExpression(keyIndex, valueIndex, binaryOperator)
+}
+
 func (f TagFilterExpression) Applies(feature feature.Feature, context feature.Feature) (bool, error) {
 	if sigolo.ShouldLogTrace() {
 		sigolo.Tracef("TagFilterExpression: %d%s%d", f.key, f.operator.string(), f.value)
@@ -163,19 +235,264 @@ func (f KeyFilterExpression) GetParameter() (int, bool) {
 	return f.key, f.shouldBeSet
 }
 
+type IdFilterExpression struct {
+	id       uint64
+	operator BinaryOperator
+	ids      map[uint64]bool // Only set for list expressions like "id in (1, 2, 3)", the id and operator are unused then.
+}
+
+func NewIdFilterExpression(id uint64, operator BinaryOperator) *IdFilterExpression {
+	return &IdFilterExpression{
+		id:       id,
+		operator: operator,
+	}
+}
+
+func NewIdListFilterExpression(ids []uint64) *IdFilterExpression {
+	idMap := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		idMap[id] = true
+	}
+
+	return &IdFilterExpression{
+		ids: idMap,
+	}
+}
+
+func (f IdFilterExpression) Applies(feature feature.Feature, context feature.Feature) (bool, error) {
+	if sigolo.ShouldLogTrace() {
+		sigolo.Tracef("IdFilterExpression: Check ID %d", feature.GetID())
+	}
+
+	return f.AppliesToId(feature.GetID()), nil
+}
+
+// AppliesToId checks whether the given OSM ID fulfills this expression. This is used by the geometry index to skip
+// features before decoding them.
+func (f IdFilterExpression) AppliesToId(id uint64) bool {
+	if f.ids != nil {
+		return f.ids[id]
+	}
+
+	switch f.operator {
+	case BinOpEqual:
+		return id == f.id
+	case BinOpNotEqual:
+		return id != f.id
+	case BinOpGreater:
+		return id > f.id
+	case BinOpGreaterEqual:
+		return id >= f.id
+	case BinOpLower:
+		return id < f.id
+	case BinOpLowerEqual:
+		return id <= f.id
+	}
+
+	return false
+}
+
+func (f IdFilterExpression) Print(indent int) {
+	if f.ids != nil {
+		sigolo.Debugf("%s%s: in %d IDs", spacing(indent), "IdFilterExpression", len(f.ids))
+	} else {
+		sigolo.Debugf("%s%s: id%s%d", spacing(indent), "IdFilterExpression", f.operator.string(), f.id)
+	}
+}
+
+// getIdFilter returns a function to filter features by their ID based on the ID expressions within the given filter
+// expression. This is used to skip features early when reading them from the geometry index. The returned filter is nil
+// when the filter expression doesn't restrict the IDs, e.g. when an ID expression is part of an OR-expression with a
+// non-ID expression.
+func getIdFilter(expression FilterExpression) index.IdFilter {
+	switch typedExpression := expression.(type) {
+	case *IdFilterExpression:
+		return typedExpression.AppliesToId
+	case *LogicalFilterExpression:
+		idFilterA := getIdFilter(typedExpression.statementA)
+		idFilterB := getIdFilter(typedExpression.statementB)
+
+		switch typedExpression.operator {
+		case LogicOpAnd:
+			if idFilterA == nil {
+				return idFilterB
+			} else if idFilterB == nil {
+				return idFilterA
+			}
+			return func(id uint64) bool {
+				return idFilterA(id) && idFilterB(id)
+			}
+		case LogicOpOr:
+			if idFilterA == nil || idFilterB == nil {
+				return nil
+			}
+			return func(id uint64) bool {
+				return idFilterA(id) || idFilterB(id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getKeyFilter returns a function to filter cells by the keys occurring in them based on the tag and key expressions
+// within the given filter expression. This is used to skip whole cells when reading features from the geometry index.
+// The returned filter is nil when the filter expression doesn't require any keys, e.g. for negated expressions or when
+// a tag expression is part of an OR-expression with an expression not requiring keys.
+func getKeyFilter(expression FilterExpression) index.KeyFilter {
+	switch typedExpression := expression.(type) {
+	case *TagFilterExpression:
+		// Every tag expression, even one with the "!=" operator, only applies to features having the key.
+		return func(hasKey func(key int) bool) bool {
+			return hasKey(typedExpression.key)
+		}
+	case *ElevationFilterExpression:
+		// Only features with the elevation key have an elevation.
+		return func(hasKey func(key int) bool) bool {
+			return hasKey(typedExpression.key)
+		}
+	case *ValuePatternFilterExpression:
+		return func(hasKey func(key int) bool) bool {
+			return hasKey(typedExpression.key)
+		}
+	case *KeyFilterExpression:
+		if !typedExpression.shouldBeSet {
+			return nil
+		}
+		return func(hasKey func(key int) bool) bool {
+			return hasKey(typedExpression.key)
+		}
+	case *KeyPrefixFilterExpression:
+		if !typedExpression.shouldBeSet {
+			return nil
+		}
+		return func(hasKey func(key int) bool) bool {
+			for _, key := range typedExpression.keys {
+				if hasKey(key) {
+					return true
+				}
+			}
+			return false
+		}
+	case *LogicalFilterExpression:
+		keyFilterA := getKeyFilter(typedExpression.statementA)
+		keyFilterB := getKeyFilter(typedExpression.statementB)
+
+		switch typedExpression.operator {
+		case LogicOpAnd:
+			if keyFilterA == nil {
+				return keyFilterB
+			} else if keyFilterB == nil {
+				return keyFilterA
+			}
+			return func(hasKey func(key int) bool) bool {
+				return keyFilterA(hasKey) && keyFilterB(hasKey)
+			}
+		case LogicOpOr:
+			if keyFilterA == nil || keyFilterB == nil {
+				return nil
+			}
+			return func(hasKey func(key int) bool) bool {
+				return keyFilterA(hasKey) || keyFilterB(hasKey)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getTagFilter returns a function to filter features by their encoded tags based on the tag and key expressions within
+// the given filter expression. This is used to skip features before decoding their geometry when reading them from the
+// geometry index. The returned filter is nil when the filter expression doesn't restrict the tags, e.g. when a tag
+// expression is part of an OR-expression with an ID expression.
+func getTagFilter(expression FilterExpression) index.TagFilter {
+	if isTagOnlyExpression(expression) {
+		return func(keys []int, values []int) bool {
+			tagFeature := &index.EncodedNodeFeature{
+				AbstractEncodedFeature: index.AbstractEncodedFeature{
+					Keys:   keys,
+					Values: values,
+				},
+			}
+			// Tag-only expressions neither use the geometry nor the context and therefore don't return errors.
+			applies, _ := expression.Applies(tagFeature, nil)
+			return applies
+		}
+	}
+
+	logicalExpression, isLogicalExpression := expression.(*LogicalFilterExpression)
+	if !isLogicalExpression {
+		return nil
+	}
+
+	tagFilterA := getTagFilter(logicalExpression.statementA)
+	tagFilterB := getTagFilter(logicalExpression.statementB)
+
+	switch logicalExpression.operator {
+	case LogicOpAnd:
+		if tagFilterA == nil {
+			return tagFilterB
+		} else if tagFilterB == nil {
+			return tagFilterA
+		}
+		return func(keys []int, values []int) bool {
+			return tagFilterA(keys, values) && tagFilterB(keys, values)
+		}
+	case LogicOpOr:
+		if tagFilterA == nil || tagFilterB == nil {
+			return nil
+		}
+		return func(keys []int, values []int) bool {
+			return tagFilterA(keys, values) || tagFilterB(keys, values)
+		}
+	}
+
+	return nil
+}
+
+// isTagOnlyExpression returns true when the result of the given expression only depends on the tags of a feature.
+func isTagOnlyExpression(expression FilterExpression) bool {
+	switch typedExpression := expression.(type) {
+	case *TagFilterExpression, *KeyFilterExpression, *KeyPrefixFilterExpression, *ValuePatternFilterExpression:
+		return true
+	case *NegatedFilterExpression:
+		return isTagOnlyExpression(typedExpression.baseExpression)
+	case *LogicalFilterExpression:
+		return isTagOnlyExpression(typedExpression.statementA) && isTagOnlyExpression(typedExpression.statementB)
+	}
+	return false
+}
+
+// Approximate size of an entry in the ID cache of the SubStatementFilterExpression (key, value and map overhead).
+const idCacheEntrySizeInBytes = 32
+
 type SubStatementFilterExpression struct {
-	statement   *Statement
-	cachedCells []common.CellIndex // TODO Add LRU-Cache or similar?
+	statement *Statement
+	// Cells that have already been read. The value is true when the cell contains at least one feature fulfilling the
+	// statement. TODO Add LRU-Cache or similar?
+	cachedCells map[common.CellIndex]bool
 	idCache     map[uint64]uint64
+	// IDs of context features for which this expression doesn't apply. The context features are all of the same type,
+	// since they come from the statement containing this expression.
+	negativeContextCache map[uint64]bool
+	memoryBudget         *MemoryBudget // Set by the query before execution. Might be nil, which means no tracking at all.
+
+	// Account of the caches above at the memory accountant. Only set during an execution and might be nil.
+	account *common.MemoryAccount
+	// Set by the memory accountant when the caches should be cleared. This happens on the next call of Applies, since
+	// the caches are not safe for concurrent use.
+	evictionRequested *atomic.Bool
 }
 
 func NewSubStatementFilterExpression(statement *Statement) *SubStatementFilterExpression {
 	return &SubStatementFilterExpression{
 		statement:   statement,
-		cachedCells: []common.CellIndex{},
+		cachedCells: map[common.CellIndex]bool{},
 		// This cache is used as generic cache for all sorts of objects. However, we only request the features of the
 		// statements queryType, so this cache only contains features of one kind. This means the IDs are unique.
-		idCache: make(map[uint64]uint64),
+		idCache:              make(map[uint64]uint64),
+		negativeContextCache: map[uint64]bool{},
+		evictionRequested:    &atomic.Bool{},
 	}
 }
 
@@ -189,17 +506,30 @@ func (f *SubStatementFilterExpression) Applies(featureToCheck feature.Feature, c
 	// would need the correct context to work.
 	context = featureToCheck
 
+	if f.evictionRequested.Swap(false) {
+		f.clearCaches()
+	}
+
+	if f.negativeContextCache[context.GetID()] {
+		return false, nil
+	}
+
+	// Fail before fetching any data when the context feature doesn't support the requested object type.
+	if contextType, ok := getObjectType(context); ok && !IsContextAccessSupported(contextType, f.statement.queryType) {
+		return false, errors.Errorf("this.%s is not supported on %ss", f.statement.queryType.String(), contextType.String())
+	}
+
 	var err error
 	var featuresChannel chan *index.GetFeaturesResult
 	cells := map[common.CellIndex]common.CellIndex{} // Map instead of array to have quick lookups
 
 	switch contextFeature := context.(type) {
 	case feature.NodeFeature:
-		cell := geometryIndex.GetCellIndexForCoordinate(contextFeature.GetLon(), contextFeature.GetLat())
+		cell := f.statement.geometryIndex.GetCellIndexForCoordinate(contextFeature.GetLon(), contextFeature.GetLat())
 		cells[cell] = cell
 	case feature.WayFeature:
 		for _, node := range contextFeature.GetNodes() {
-			cell := geometryIndex.GetCellIndexForCoordinate(node.Lon, node.Lat)
+			cell := f.statement.geometryIndex.GetCellIndexForCoordinate(node.Lon, node.Lat)
 			if _, ok := cells[cell]; !ok {
 				cells[cell] = cell
 			}
@@ -208,8 +538,8 @@ func (f *SubStatementFilterExpression) Applies(featureToCheck feature.Feature, c
 		// TODO Use actual coordinates in geometry to determine the minimum amount of cells needed for this relation
 		bbox := contextFeature.GetGeometry().Bound()
 
-		minCell := geometryIndex.GetCellIndexForCoordinate(bbox.Min.Lon(), bbox.Min.Lat())
-		maxCell := geometryIndex.GetCellIndexForCoordinate(bbox.Max.Lon(), bbox.Max.Lat())
+		minCell := f.statement.geometryIndex.GetCellIndexForCoordinate(bbox.Min.Lon(), bbox.Min.Lat())
+		maxCell := f.statement.geometryIndex.GetCellIndexForCoordinate(bbox.Max.Lon(), bbox.Max.Lat())
 
 		for cellX := minCell.X(); cellX <= maxCell.X(); cellX++ {
 			for cellY := minCell.Y(); cellY <= maxCell.Y(); cellY++ {
@@ -224,24 +554,68 @@ func (f *SubStatementFilterExpression) Applies(featureToCheck feature.Feature, c
 		return false, errors.Errorf("No cells found for context feature %d", context.GetID())
 	}
 
+	relatedIds, err := GetContextRelatedIds(context, f.statement.queryType)
+	if err != nil {
+		return false, err
+	}
+
+	if f.statement.queryType.GetObjectType() == osm.OsmObjNode {
+		// Cells not containing any related node can't contribute to the result, so there's no need to read them.
+		for cell := range cells {
+			if _, ok := f.cachedCells[cell]; ok {
+				continue
+			}
+			mightContainNodes, err := f.statement.geometryIndex.MightContainNodes(cell, relatedIds)
+			if err != nil {
+				return false, err
+			}
+			if !mightContainNodes {
+				delete(cells, cell)
+			}
+		}
+		if len(cells) == 0 {
+			return false, f.cacheNegativeContext(context)
+		}
+	}
+
 	// Get those cells that are not in the cache
 	var cellsToFetch []common.CellIndex
 	for _, cell := range cells {
-		if !common.Contains(f.cachedCells, cell) {
+		if _, ok := f.cachedCells[cell]; !ok {
 			cellsToFetch = append(cellsToFetch, cell)
 		}
 	}
 
 	// Fetch data only of those cells needed
 	if len(cellsToFetch) != 0 {
-		featuresChannel, err = f.statement.location.GetFeaturesForCells(geometryIndex, cellsToFetch, f.statement.queryType.GetObjectType())
+		featuresChannel, err = f.statement.location.GetFeaturesForCells(f.statement.geometryIndex, cellsToFetch, f.statement.queryType.GetObjectType())
 		if err != nil {
 			return false, err
 		}
 
+		cellsWithMatches := map[common.CellIndex]bool{}
 		for getFeatureResult := range featuresChannel {
 			sigolo.Tracef("Received %d features from cell %v", len(getFeatureResult.Features), getFeatureResult.Cell)
 
+			if getFeatureResult.Err != nil {
+				go drainChannel(featuresChannel)
+				return false, getFeatureResult.Err
+			}
+
+			err = f.memoryBudget.readCell()
+			if err != nil {
+				go drainChannel(featuresChannel)
+				return false, err
+			}
+			f.memoryBudget.addCellWarning(getFeatureResult)
+
+			bufferedBytes := feature.EstimateSizes(getFeatureResult.Features)
+			err = f.memoryBudget.reserve(bufferedBytes)
+			if err != nil {
+				go drainChannel(featuresChannel)
+				return false, err
+			}
+
 			for _, foundFeature := range getFeatureResult.Features {
 				sigolo.Trace("----- next feature -----")
 				if foundFeature != nil {
@@ -251,89 +625,97 @@ func (f *SubStatementFilterExpression) Applies(featureToCheck feature.Feature, c
 					if err != nil {
 						return false, err
 					}
-
 					if applies {
+						cellsWithMatches[getFeatureResult.Cell] = true
+					}
+
+					if _, alreadyCached := f.idCache[foundFeature.GetID()]; applies && !alreadyCached {
+						err = f.memoryBudget.reserve(idCacheEntrySizeInBytes)
+						if err != nil {
+							go drainChannel(featuresChannel)
+							return false, err
+						}
 						f.idCache[foundFeature.GetID()] = foundFeature.GetID()
+						f.account.Add(idCacheEntrySizeInBytes)
 					}
 				}
 			}
+
+			f.memoryBudget.release(bufferedBytes)
 		}
 
-		f.cachedCells = append(f.cachedCells, cellsToFetch...)
+		for _, cell := range cellsToFetch {
+			f.cachedCells[cell] = cellsWithMatches[cell]
+		}
 	}
 
-	// Check whether at least one sub-feature of the context is within the list of IDs that fulfill the sub-statement.
-	switch contextFeature := context.(type) {
-	case feature.NodeFeature:
-		switch f.statement.queryType {
-		case osm.OsmQueryNode:
-			return false, errors.Errorf("Invalid query type %s requested for node in sub-statement expression. This is a bug!", f.statement.queryType)
-		case osm.OsmQueryWay:
-			for _, wayId := range contextFeature.GetWayIds() {
-				if _, ok := f.idCache[uint64(wayId)]; ok {
-					return true, nil
-				}
-			}
-		case osm.OsmQueryRelation:
-			for _, relationId := range contextFeature.GetRelationIds() {
-				if _, ok := f.idCache[uint64(relationId)]; ok {
-					return true, nil
-				}
-			}
-		case osm.OsmQueryChildRelation:
-			return false, errors.Errorf("Invalid query type %s requested for node in sub-statement expression. This is a bug!", f.statement.queryType)
-		}
-	case feature.WayFeature:
-		switch f.statement.queryType {
-		case osm.OsmQueryNode:
-			for _, node := range contextFeature.GetNodes() {
-				if _, ok := f.idCache[uint64(node.ID)]; ok {
-					return true, nil
-				}
-			}
-		case osm.OsmQueryWay:
-			return false, errors.Errorf("Invalid query type %s requested for way in sub-statement expression. This is a bug!", f.statement.queryType)
-		case osm.OsmQueryRelation:
-			for _, relationId := range contextFeature.GetRelationIds() {
-				if _, ok := f.idCache[uint64(relationId)]; ok {
-					return true, nil
-				}
-			}
-		case osm.OsmQueryChildRelation:
-			return false, errors.Errorf("Invalid query type %s requested for way in sub-statement expression. This is a bug!", f.statement.queryType)
+	// The features related to the context are stored in the cells of the context. Without any matching feature in
+	// these cells, there's no need to determine the related IDs.
+	hasCellWithMatches := false
+	for cell := range cells {
+		if f.cachedCells[cell] {
+			hasCellWithMatches = true
+			break
 		}
-	case feature.RelationFeature:
-		switch f.statement.queryType {
-		case osm.OsmQueryNode:
-			for _, nodeId := range contextFeature.GetNodeIds() {
-				if _, ok := f.idCache[uint64(nodeId)]; ok {
-					return true, nil
-				}
-			}
-		case osm.OsmQueryWay:
-			for _, wayId := range contextFeature.GetWayIds() {
-				if _, ok := f.idCache[uint64(wayId)]; ok {
-					return true, nil
-				}
-			}
-		case osm.OsmQueryRelation:
-			for _, parentRelationId := range contextFeature.GetParentRelationIds() {
-				if _, ok := f.idCache[uint64(parentRelationId)]; ok {
-					return true, nil
-				}
-			}
-		case osm.OsmQueryChildRelation:
-			for _, childRelationId := range contextFeature.GetChildRelationIds() {
-				if _, ok := f.idCache[uint64(childRelationId)]; ok {
-					return true, nil
-				}
-			}
+	}
+	if !hasCellWithMatches {
+		return false, f.cacheNegativeContext(context)
+	}
+
+	// Check whether at least one sub-feature of the context is within the list of IDs that fulfill the sub-statement.
+	for _, id := range relatedIds {
+		if _, ok := f.idCache[id]; ok {
+			return true, nil
 		}
-	default:
-		return false, errors.Errorf("Unsupported object type %s for sub-statement expression", reflect.TypeOf(context).String())
 	}
 
-	return false, nil
+	return false, f.cacheNegativeContext(context)
+}
+
+// cacheNegativeContext remembers that this expression doesn't apply to the given context feature.
+func (f *SubStatementFilterExpression) cacheNegativeContext(context feature.Feature) error {
+	err := f.memoryBudget.reserve(idCacheEntrySizeInBytes)
+	if err != nil {
+		return err
+	}
+	f.negativeContextCache[context.GetID()] = true
+	f.account.Add(idCacheEntrySizeInBytes)
+	return nil
+}
+
+// registerAt registers the caches of this expression at the given accountant, which might be nil.
+func (f *SubStatementFilterExpression) registerAt(accountant *common.MemoryAccountant) {
+	f.account = accountant.Register("sub-statement cache", f)
+	f.account.Add(f.getCacheSizeInBytes())
+}
+
+func (f *SubStatementFilterExpression) unregister() {
+	f.account.Unregister()
+	f.account = nil
+}
+
+// EvictMemory requests clearing all caches of this expression. Since they're not safe for concurrent use, they're
+// cleared on the next call of Applies.
+func (f *SubStatementFilterExpression) EvictMemory(_ int64) {
+	f.evictionRequested.Store(true)
+}
+
+// clearCaches removes all cached cells and IDs and frees their memory.
+func (f *SubStatementFilterExpression) clearCaches() {
+	sigolo.Debugf("Clear caches of sub-statement with %d cached IDs", len(f.idCache)+len(f.negativeContextCache))
+
+	cacheSizeInBytes := f.getCacheSizeInBytes()
+	f.memoryBudget.release(cacheSizeInBytes)
+	f.account.Remove(cacheSizeInBytes)
+
+	// The cached cells must be cleared as well, otherwise their features would be missing in the ID cache.
+	f.cachedCells = map[common.CellIndex]bool{}
+	f.idCache = make(map[uint64]uint64)
+	f.negativeContextCache = map[uint64]bool{}
+}
+
+func (f *SubStatementFilterExpression) getCacheSizeInBytes() int64 {
+	return int64(len(f.idCache)+len(f.negativeContextCache)) * idCacheEntrySizeInBytes
 }
 
 func (f *SubStatementFilterExpression) Print(indent int) {
@@ -0,0 +1,166 @@
+package query
+
+import (
+	"slices"
+	"soq/common"
+	"soq/index"
+	"testing"
+)
+
+func TestGetIdFilter_andExpression(t *testing.T) {
+	// Arrange
+	expression := NewLogicalFilterExpression(
+		NewIdFilterExpression(10, BinOpGreater),
+		NewLogicalFilterExpression(NewKeyFilterExpression(0, true), NewIdFilterExpression(20, BinOpLower), LogicOpAnd),
+		LogicOpAnd,
+	)
+
+	// Act
+	idFilter := getIdFilter(expression)
+
+	// Assert
+	common.AssertNotNil(t, idFilter)
+	common.AssertFalse(t, idFilter(10))
+	common.AssertTrue(t, idFilter(15))
+	common.AssertFalse(t, idFilter(20))
+}
+
+func TestGetIdFilter_orExpressionWithNonIdExpression(t *testing.T) {
+	// Arrange
+	expression := NewLogicalFilterExpression(NewIdListFilterExpression([]uint64{1, 2}), NewKeyFilterExpression(0, true), LogicOpOr)
+
+	// Act
+	idFilter := getIdFilter(expression)
+
+	// Assert
+	common.AssertNil(t, idFilter)
+}
+
+func TestGetKeyFilter_andExpression(t *testing.T) {
+	// Arrange
+	expression := NewLogicalFilterExpression(
+		NewTagFilterExpression(1, 0, BinOpNotEqual),
+		NewLogicalFilterExpression(NewKeyFilterExpression(2, true), NewIdFilterExpression(20, BinOpLower), LogicOpAnd),
+		LogicOpAnd,
+	)
+
+	// Act
+	keyFilter := getKeyFilter(expression)
+
+	// Assert
+	common.AssertNotNil(t, keyFilter)
+	common.AssertTrue(t, keyFilter(hasKeys(1, 2)))
+	common.AssertTrue(t, keyFilter(hasKeys(0, 1, 2, 3)))
+	common.AssertFalse(t, keyFilter(hasKeys(1)))
+	common.AssertFalse(t, keyFilter(hasKeys(2)))
+}
+
+func TestGetKeyFilter_orExpression(t *testing.T) {
+	// Arrange
+	expression := NewLogicalFilterExpression(NewTagFilterExpression(1, 0, BinOpEqual), NewKeyFilterExpression(2, true), LogicOpOr)
+
+	// Act
+	keyFilter := getKeyFilter(expression)
+
+	// Assert
+	common.AssertNotNil(t, keyFilter)
+	common.AssertTrue(t, keyFilter(hasKeys(1)))
+	common.AssertTrue(t, keyFilter(hasKeys(2)))
+	common.AssertFalse(t, keyFilter(hasKeys(0, 3)))
+}
+
+func TestGetKeyFilter_expressionsNotRequiringKeys(t *testing.T) {
+	expressions := []FilterExpression{
+		NewKeyFilterExpression(1, false),
+		NewNegatedFilterExpression(NewTagFilterExpression(1, 0, BinOpEqual)),
+		NewIdFilterExpression(10, BinOpEqual),
+		NewLogicalFilterExpression(NewTagFilterExpression(1, 0, BinOpEqual), NewKeyFilterExpression(2, false), LogicOpOr),
+	}
+
+	for _, expression := range expressions {
+		// Act
+		keyFilter := getKeyFilter(expression)
+
+		// Assert
+		common.AssertNil(t, keyFilter)
+	}
+}
+
+func hasKeys(keys ...int) func(key int) bool {
+	return func(key int) bool {
+		return slices.Contains(keys, key)
+	}
+}
+
+func TestGetTagFilter_tagOnlyExpression(t *testing.T) {
+	// Arrange
+	expression := NewLogicalFilterExpression(
+		NewTagFilterExpression(1, 2, BinOpGreaterEqual),
+		NewNegatedFilterExpression(NewKeyFilterExpression(3, true)),
+		LogicOpAnd,
+	)
+
+	// Act
+	tagFilter := getTagFilter(expression)
+
+	// Assert
+	common.AssertNotNil(t, tagFilter)
+	common.AssertTrue(t, tagFilter([]int{1}, []int{2}))
+	common.AssertFalse(t, tagFilter([]int{1}, []int{1}))
+	common.AssertFalse(t, tagFilter([]int{1, 3}, []int{2, 0}))
+	common.AssertFalse(t, tagFilter([]int{}, []int{}))
+}
+
+func TestGetTagFilter_andExpressionWithNonTagExpression(t *testing.T) {
+	// Arrange
+	expression := NewLogicalFilterExpression(NewIdFilterExpression(10, BinOpGreater), NewTagFilterExpression(1, 2, BinOpEqual), LogicOpAnd)
+
+	// Act
+	tagFilter := getTagFilter(expression)
+
+	// Assert
+	common.AssertNotNil(t, tagFilter)
+	common.AssertTrue(t, tagFilter([]int{1}, []int{2}))
+	common.AssertFalse(t, tagFilter([]int{1}, []int{3}))
+}
+
+func TestGetTagFilter_orExpressionWithNonTagExpression(t *testing.T) {
+	// Arrange
+	expression := NewLogicalFilterExpression(NewIdFilterExpression(10, BinOpGreater), NewTagFilterExpression(1, 2, BinOpEqual), LogicOpOr)
+
+	// Act
+	tagFilter := getTagFilter(expression)
+
+	// Assert
+	common.AssertNil(t, tagFilter)
+}
+
+func TestGetTagFilter_negatedNonTagExpression(t *testing.T) {
+	// Arrange
+	expression := NewNegatedFilterExpression(NewLogicalFilterExpression(NewIdFilterExpression(10, BinOpGreater), NewTagFilterExpression(1, 2, BinOpEqual), LogicOpAnd))
+
+	// Act
+	tagFilter := getTagFilter(expression)
+
+	// Assert
+	common.AssertNil(t, tagFilter)
+}
+
+func TestNewTagFilterExpressionFromStrings_comparisonWithUnknownKey(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"width"}, [][]string{{"1", "2"}})
+	f := &index.EncodedNodeFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			Keys:   []int{0},
+			Values: []int{1},
+		},
+	}
+
+	// Act
+	expression := NewTagFilterExpressionFromStrings(tagIndex, "height", "2", false, BinOpGreaterEqual)
+	applies, err := expression.Applies(f, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertFalse(t, applies)
+}
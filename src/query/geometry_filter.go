@@ -0,0 +1,115 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"soq/feature"
+	"soq/index"
+)
+
+// Keys of linear features that stay linear when their way is closed, e.g. a roundabout or a fence around a garden.
+// Closed ways with one of these keys are only areas when they're explicitly tagged with "area=yes".
+var linearFeatureKeys = []string{"highway", "barrier", "railway", "waterway", "aerialway"}
+
+// Values of the "type" key of relations that describe areas.
+var areaRelationTypes = []string{"multipolygon", "boundary"}
+
+// ClosedFilterExpression applies to closed ways, i.e. ways whose first and last node are the same. Nodes and relations
+// are never closed. This is the "is_closed()" filter function.
+type ClosedFilterExpression struct {
+}
+
+func NewClosedFilterExpression() *ClosedFilterExpression {
+	return &ClosedFilterExpression{}
+}
+
+func (f ClosedFilterExpression) Applies(featureToCheck feature.Feature, context feature.Feature) (bool, error) {
+	sigolo.Tracef("ClosedFilterExpression")
+	wayFeature, isWay := featureToCheck.(feature.WayFeature)
+	return isWay && isClosedWay(wayFeature), nil
+}
+
+func (f ClosedFilterExpression) Print(indent int) {
+	sigolo.Debugf("%sClosedFilterExpression", spacing(indent))
+}
+
+// isClosedWay returns true when the first and last node of the way are the same. At least three different nodes are
+// needed to enclose an area, so shorter ways are not closed.
+func isClosedWay(way feature.WayFeature) bool {
+	nodes := way.GetNodes()
+	return len(nodes) >= 4 && nodes[0].ID == nodes[len(nodes)-1].ID
+}
+
+// AreaFilterExpression applies to features describing an area. This is the "is_area()" filter function:
+//   - Closed ways are areas unless they're tagged with "area=no" or are linear features (s. linearFeatureKeys) without
+//     an "area=yes" tag.
+//   - Relations are areas when they're multipolygons or boundaries.
+//   - Nodes and open ways are never areas.
+type AreaFilterExpression struct {
+	areaKey                int
+	areaYesValue           int
+	areaNoValue            int
+	linearFeatureKeys      []int
+	typeKey                int
+	areaRelationTypeValues []int
+}
+
+// NewAreaFilterExpression looks up the tags relevant for the area detection in the tag index. Tags not existing in the
+// tag index are ignored, since no feature can have them.
+func NewAreaFilterExpression(tagIndex *index.TagIndex) *AreaFilterExpression {
+	areaKey, areaYesValue := tagIndex.GetIndicesFromKeyValueStrings("area", "yes")
+	_, areaNoValue := tagIndex.GetIndicesFromKeyValueStrings("area", "no")
+
+	expression := &AreaFilterExpression{
+		areaKey:      areaKey,
+		areaYesValue: areaYesValue,
+		areaNoValue:  areaNoValue,
+		typeKey:      tagIndex.GetKeyIndexFromKeyString("type"),
+	}
+
+	for _, key := range linearFeatureKeys {
+		keyIndex := tagIndex.GetKeyIndexFromKeyString(key)
+		if keyIndex != index.NotFound {
+			expression.linearFeatureKeys = append(expression.linearFeatureKeys, keyIndex)
+		}
+	}
+	for _, relationType := range areaRelationTypes {
+		_, valueIndex := tagIndex.GetIndicesFromKeyValueStrings("type", relationType)
+		if valueIndex != index.NotFound {
+			expression.areaRelationTypeValues = append(expression.areaRelationTypeValues, valueIndex)
+		}
+	}
+
+	return expression
+}
+
+func (f AreaFilterExpression) Applies(featureToCheck feature.Feature, context feature.Feature) (bool, error) {
+	sigolo.Tracef("AreaFilterExpression")
+
+	switch typedFeature := featureToCheck.(type) {
+	case feature.WayFeature:
+		if !isClosedWay(typedFeature) || typedFeature.HasTag(f.areaKey, f.areaNoValue) {
+			return false, nil
+		}
+		if typedFeature.HasTag(f.areaKey, f.areaYesValue) {
+			return true, nil
+		}
+		for _, key := range f.linearFeatureKeys {
+			if typedFeature.HasKey(key) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case feature.RelationFeature:
+		for _, value := range f.areaRelationTypeValues {
+			if typedFeature.HasTag(f.typeKey, value) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (f AreaFilterExpression) Print(indent int) {
+	sigolo.Debugf("%sAreaFilterExpression", spacing(indent))
+}
@@ -0,0 +1,85 @@
+package query
+
+import (
+	"github.com/paulmach/osm"
+	"soq/common"
+	"soq/index"
+	"testing"
+)
+
+func newTestWayWithNodes(keys []int, values []int, nodeIds ...osm.NodeID) *index.EncodedWayFeature {
+	way := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Keys: keys, Values: values},
+	}
+	for _, nodeId := range nodeIds {
+		way.Nodes = append(way.Nodes, osm.WayNode{ID: nodeId})
+	}
+	return way
+}
+
+func TestClosedFilterExpression_Applies(t *testing.T) {
+	// Arrange
+	expression := NewClosedFilterExpression()
+
+	// Act
+	closedWayApplies, err := expression.Applies(newTestWayWithNodes(nil, nil, 1, 2, 3, 1), nil)
+	common.AssertNil(t, err)
+	openWayApplies, err := expression.Applies(newTestWayWithNodes(nil, nil, 1, 2, 3), nil)
+	common.AssertNil(t, err)
+	degeneratedWayApplies, err := expression.Applies(newTestWayWithNodes(nil, nil, 1, 2, 1), nil)
+	common.AssertNil(t, err)
+	nodeApplies, err := expression.Applies(newTestNode(1, 0, 0), nil)
+	common.AssertNil(t, err)
+
+	// Assert
+	common.AssertTrue(t, closedWayApplies)
+	common.AssertFalse(t, openWayApplies)
+	common.AssertFalse(t, degeneratedWayApplies)
+	common.AssertFalse(t, nodeApplies)
+}
+
+func TestAreaFilterExpression_Applies(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"area", "building", "highway", "type"}, [][]string{{"no", "yes"}, {"yes"}, {"pedestrian"}, {"multipolygon", "route"}})
+	expression := NewAreaFilterExpression(tagIndex)
+	area, building, highway := 0, 1, 2
+	areaNo, areaYes := 0, 1
+
+	for _, testCase := range []struct {
+		way      *index.EncodedWayFeature
+		expected bool
+	}{
+		{newTestWayWithNodes([]int{building}, []int{0}, 1, 2, 3, 1), true},
+		{newTestWayWithNodes([]int{building}, []int{0}, 1, 2, 3), false},
+		{newTestWayWithNodes([]int{area, building}, []int{areaNo, 0}, 1, 2, 3, 1), false},
+		{newTestWayWithNodes([]int{highway}, []int{0}, 1, 2, 3, 1), false},
+		{newTestWayWithNodes([]int{area, highway}, []int{areaYes, 0}, 1, 2, 3, 1), true},
+	} {
+		// Act
+		applies, err := expression.Applies(testCase.way, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expected, applies)
+	}
+}
+
+func TestAreaFilterExpression_Applies_relations(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"type"}, [][]string{{"multipolygon", "route"}})
+	expression := NewAreaFilterExpression(tagIndex)
+
+	// Act
+	multipolygonApplies, multipolygonErr := expression.Applies(&index.EncodedRelationFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Keys: []int{0}, Values: []int{0}},
+	}, nil)
+	routeApplies, routeErr := expression.Applies(&index.EncodedRelationFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 2, Keys: []int{0}, Values: []int{1}},
+	}, nil)
+
+	// Assert
+	common.AssertNil(t, multipolygonErr)
+	common.AssertNil(t, routeErr)
+	common.AssertTrue(t, multipolygonApplies)
+	common.AssertFalse(t, routeApplies)
+}
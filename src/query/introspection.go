@@ -0,0 +1,196 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"math"
+	"soq/index"
+	ownOsm "soq/osm"
+	"sort"
+)
+
+// Introspection lists the keys of the data ("keys()") or the values of a key ("values(highway)") instead of returning
+// features. Without location, the tag-index is listed. With location (e.g. "bbox(...).keys()"), all nodes, ways and
+// relations within the location are read and only their keys or values are listed.
+type Introspection struct {
+	// Key whose values are listed. Empty when the keys are listed.
+	key      string
+	keyIndex int
+	// Might be nil, which means the whole tag-index is listed.
+	location LocationExpression
+}
+
+// NewKeysIntrospection lists all keys within the given location, which might be nil.
+func NewKeysIntrospection(location LocationExpression) *Introspection {
+	return &Introspection{keyIndex: index.NotFound, location: location}
+}
+
+// NewValuesIntrospection lists all values of the given key within the given location, which might be nil. The key index
+// might be index.NotFound for keys not existing in the data.
+func NewValuesIntrospection(location LocationExpression, key string, keyIndex int) *Introspection {
+	return &Introspection{key: key, keyIndex: keyIndex, location: location}
+}
+
+// IntrospectionResult contains the listed keys or values sorted by their count and then alphabetically.
+type IntrospectionResult struct {
+	// Key of the listed values. Empty when the keys are listed.
+	Key     string               `json:"key,omitempty"`
+	Entries []IntrospectionEntry `json:"entries"`
+}
+
+type IntrospectionEntry struct {
+	// The key or value.
+	Value string `json:"value"`
+	// Number of OSM objects with this key or tag. Without location, this is always 0 when the tag-index has no counts.
+	Count int `json:"count"`
+}
+
+// NewIntrospectionQuery creates a query listing keys or values instead of returning features.
+func NewIntrospectionQuery(introspection *Introspection) *Query {
+	q := NewQuery([]Statement{})
+	q.introspection = introspection
+	return q
+}
+
+// IsIntrospection returns true when this query lists keys or values instead of returning features, s.
+// ExecuteIntrospection.
+func (q *Query) IsIntrospection() bool {
+	return q.introspection != nil
+}
+
+// ExecuteIntrospection lists the keys or values of the introspection of this query. Introspections with location are
+// subject to the limits and the memory budget of the query like any other query.
+func (q *Query) ExecuteIntrospection(tagIndex *index.TagIndex, geomIndex index.GeometryIndex) (*IntrospectionResult, error) {
+	if q.introspection == nil {
+		return nil, errors.New("The query is no introspection like keys() or values(key)")
+	}
+	introspection := q.introspection
+
+	if introspection.location == nil {
+		return introspection.listTagIndex(tagIndex)
+	}
+
+	geomIndex = q.atQueryTime(geomIndex)
+	err := q.checkIndexCompatibility(geomIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	q.memoryBudget.startExecution(q.limits, q.context)
+	err = q.checkLocationArea(introspection.location, geomIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return introspection.scanLocation(tagIndex, geomIndex, q.memoryBudget)
+}
+
+func (i *Introspection) listTagIndex(tagIndex *index.TagIndex) (*IntrospectionResult, error) {
+	var searchResults []index.PrefixSearchResult
+	if i.key == "" {
+		searchResults = tagIndex.SearchKeysByPrefix("", math.MaxInt)
+	} else {
+		var err error
+		searchResults, err = tagIndex.SearchValuesByPrefix(i.key, "", math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &IntrospectionResult{Key: i.key, Entries: []IntrospectionEntry{}}
+	for _, searchResult := range searchResults {
+		result.Entries = append(result.Entries, IntrospectionEntry{Value: searchResult.Value, Count: searchResult.Count})
+	}
+	return result, nil
+}
+
+// scanLocation reads all features within the location and counts their keys or their values of the key. Each read cell
+// and the remembered IDs and counts are part of the given budget.
+func (i *Introspection) scanLocation(tagIndex *index.TagIndex, geomIndex index.GeometryIndex, budget *MemoryBudget) (*IntrospectionResult, error) {
+	result := &IntrospectionResult{Key: i.key, Entries: []IntrospectionEntry{}}
+	if i.key != "" && i.keyIndex == index.NotFound {
+		return result, nil
+	}
+
+	var keyFilter index.KeyFilter
+	if i.key != "" {
+		keyFilter = func(hasKey func(key int) bool) bool {
+			return hasKey(i.keyIndex)
+		}
+	}
+
+	var reservedBytes int64
+	defer func() { budget.release(reservedBytes) }()
+
+	// Key index or value index -> number of features
+	counts := map[int]int{}
+	for _, objectType := range []ownOsm.OsmObjectType{ownOsm.OsmObjNode, ownOsm.OsmObjWay, ownOsm.OsmObjRelation} {
+		resultChannel, err := i.location.GetFeatures(geomIndex, nil, objectType, nil, keyFilter, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Ways and relations can be in several cells, so duplicates are removed.
+		seenIds := map[uint64]bool{}
+		for getFeaturesResult := range resultChannel {
+			if getFeaturesResult.Err != nil {
+				go drainChannel(resultChannel)
+				return nil, getFeaturesResult.Err
+			}
+
+			err = budget.readCell()
+			if err != nil {
+				go drainChannel(resultChannel)
+				return nil, err
+			}
+			budget.addCellWarning(getFeaturesResult)
+
+			numberOfEntries := len(seenIds) + len(counts)
+			for _, f := range getFeaturesResult.Features {
+				if f == nil || seenIds[f.GetID()] {
+					continue
+				}
+				seenIds[f.GetID()] = true
+
+				if i.key == "" {
+					for _, key := range f.GetKeys() {
+						counts[key]++
+					}
+				} else if f.HasKey(i.keyIndex) {
+					counts[f.GetValueIndex(i.keyIndex)]++
+				}
+			}
+
+			newEntriesBytes := int64(len(seenIds)+len(counts)-numberOfEntries) * idCacheEntrySizeInBytes
+			err = budget.reserve(newEntriesBytes)
+			if err != nil {
+				go drainChannel(resultChannel)
+				return nil, err
+			}
+			reservedBytes += newEntriesBytes
+		}
+
+		budget.release(int64(len(seenIds)) * idCacheEntrySizeInBytes)
+		reservedBytes -= int64(len(seenIds)) * idCacheEntrySizeInBytes
+	}
+
+	for keyOrValue, count := range counts {
+		var value string
+		if i.key == "" {
+			value = tagIndex.GetKeyFromIndex(keyOrValue)
+		} else {
+			value = tagIndex.GetValueForKey(i.keyIndex, keyOrValue)
+		}
+		result.Entries = append(result.Entries, IntrospectionEntry{Value: value, Count: count})
+	}
+
+	sort.Slice(result.Entries, func(a, b int) bool {
+		if result.Entries[a].Count != result.Entries[b].Count {
+			return result.Entries[a].Count > result.Entries[b].Count
+		}
+		return result.Entries[a].Value < result.Entries[b].Value
+	})
+
+	sigolo.Debugf("Found %d different keys or values within the location", len(result.Entries))
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	"testing"
+)
+
+func newIntrospectionTestIndices() (*index.TagIndex, *testGeometryIndex) {
+	tagIndex := index.NewTagIndex([]string{"amenity", "name", "shop"}, [][]string{{"bench", "cafe"}, {"Foo"}, {"bakery"}})
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{
+		{0, 0}: {
+			newTaggedTestNode(1, 0.5, 0.5, []int{0, 1}, []int{1, 0}),
+			newTaggedTestNode(2, 0.6, 0.6, []int{0}, []int{0}),
+			newTaggedTestNode(3, 0.7, 0.7, []int{0}, []int{0}),
+		},
+		{5, 5}: {newTaggedTestNode(4, 5.5, 5.5, []int{2}, []int{0})},
+	}}
+	return tagIndex, geomIndex
+}
+
+func TestQuery_ExecuteIntrospection_keysOfTagIndex(t *testing.T) {
+	// Arrange
+	tagIndex, geomIndex := newIntrospectionTestIndices()
+	q := NewIntrospectionQuery(NewKeysIntrospection(nil))
+
+	// Act
+	result, err := q.ExecuteIntrospection(tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, "", result.Key)
+	common.AssertEqual(t, []IntrospectionEntry{{Value: "name"}, {Value: "shop"}, {Value: "amenity"}}, result.Entries)
+}
+
+func TestQuery_ExecuteIntrospection_valuesWithinLocation(t *testing.T) {
+	// Arrange
+	tagIndex, geomIndex := newIntrospectionTestIndices()
+	location := NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}})
+	q := NewIntrospectionQuery(NewValuesIntrospection(location, "amenity", 0))
+
+	// Act
+	result, err := q.ExecuteIntrospection(tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, "amenity", result.Key)
+	common.AssertEqual(t, []IntrospectionEntry{{Value: "bench", Count: 2}, {Value: "cafe", Count: 1}}, result.Entries)
+}
+
+func TestQuery_ExecuteIntrospection_keysWithinLocation(t *testing.T) {
+	// Arrange
+	tagIndex, geomIndex := newIntrospectionTestIndices()
+	location := NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}})
+	q := NewIntrospectionQuery(NewKeysIntrospection(location))
+
+	// Act
+	result, err := q.ExecuteIntrospection(tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []IntrospectionEntry{{Value: "amenity", Count: 3}, {Value: "name", Count: 1}}, result.Entries)
+}
+
+func TestQuery_Execute_introspectionReturnsNoFeatures(t *testing.T) {
+	// Arrange
+	_, geomIndex := newIntrospectionTestIndices()
+	q := NewIntrospectionQuery(NewKeysIntrospection(nil))
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, features)
+}
+
+func TestQuery_ExecuteIntrospection_limits(t *testing.T) {
+	for _, testCase := range []struct {
+		limits        Limits
+		expectedLimit string
+	}{
+		{Limits{MaxCells: 5}, LimitCells},
+		{Limits{MaxAreaCells: 2}, LimitArea},
+	} {
+		// Arrange
+		tagIndex, geomIndex := newIntrospectionTestIndices()
+		location := NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}})
+		q := NewIntrospectionQuery(NewKeysIntrospection(location))
+		q.SetLimits(testCase.limits)
+
+		// Act
+		result, err := q.ExecuteIntrospection(tagIndex, geomIndex)
+
+		// Assert
+		var limitErr *LimitExceededError
+		common.AssertTrue(t, errors.As(err, &limitErr))
+		common.AssertEqual(t, testCase.expectedLimit, limitErr.Limit)
+		common.AssertNil(t, result)
+	}
+}
+
+func TestQuery_ExecuteIntrospection_memoryReleased(t *testing.T) {
+	// Arrange
+	tagIndex, geomIndex := newIntrospectionTestIndices()
+	location := NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}})
+	q := NewIntrospectionQuery(NewKeysIntrospection(location))
+
+	// Act
+	_, err := q.ExecuteIntrospection(tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, int64(12), q.GetMemoryBudget().GetReadCells()) // 4 cells for each object type
+	common.AssertEqual(t, int64(0), q.GetMemoryBudget().GetUsedBytes())
+	common.AssertTrue(t, q.GetMemoryBudget().GetPeakBytes() > 0)
+}
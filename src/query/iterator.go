@@ -0,0 +1,92 @@
+package query
+
+import (
+	"github.com/pkg/errors"
+	"soq/feature"
+	"soq/index"
+	"sync"
+)
+
+// DefaultResultBufferSize is the number of features buffered by a ResultIterator before the query execution waits for
+// the consumer.
+const DefaultResultBufferSize = 1000
+
+var errIterationClosed = errors.New("Result iteration has been closed")
+
+// ResultIterator streams the features of a query execution. The query is executed in the background and at most the
+// buffer size of features are held before the execution waits for them to be consumed. This keeps the memory usage
+// constant regardless of the result size, as long as the consumer also doesn't collect all features.
+type ResultIterator struct {
+	features  chan feature.Feature
+	done      chan struct{}
+	closeOnce sync.Once
+	current   feature.Feature
+	err       error // Only written by the execution before the features channel is closed.
+}
+
+// Stream executes the query in the background and returns an iterator over the result features. Unlike Execute, the
+// result features are not tracked by the memory budget, since they're not accumulated. The iterator must be read until
+// Next returns false or be closed, otherwise the execution never finishes. Only one execution of a query may be running
+// at a time.
+func (q *Query) Stream(geomIndex index.GeometryIndex, bufferSize int) (*ResultIterator, error) {
+	err := q.prepareExecution(geomIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	if bufferSize <= 0 {
+		bufferSize = DefaultResultBufferSize
+	}
+
+	iterator := &ResultIterator{
+		features: make(chan feature.Feature, bufferSize),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(iterator.features)
+		iterator.err = q.executeStatements(func(f feature.Feature) error {
+			select {
+			case iterator.features <- f:
+				return nil
+			case <-iterator.done:
+				return errIterationClosed
+			}
+		})
+	}()
+
+	return iterator, nil
+}
+
+func (i *ResultIterator) Next() bool {
+	f, ok := <-i.features
+	if !ok {
+		i.current = nil
+		return false
+	}
+	i.current = f
+	return true
+}
+
+func (i *ResultIterator) Feature() feature.Feature {
+	return i.current
+}
+
+// Err returns the error of the query execution. It must only be called after Next returned false. Stopping the
+// execution with Close is not considered an error.
+func (i *ResultIterator) Err() error {
+	if errors.Is(i.err, errIterationClosed) {
+		return nil
+	}
+	return i.err
+}
+
+// Close stops the query execution and waits until it's finished. Closing an already finished iterator has no effect.
+func (i *ResultIterator) Close() {
+	i.closeOnce.Do(func() {
+		close(i.done)
+	})
+	for range i.features {
+	}
+	i.current = nil
+}
@@ -0,0 +1,101 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"soq/osm"
+	"testing"
+)
+
+func newIteratorTestIndex(numberOfNodes int) *testGeometryIndex {
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{}}
+	for i := 0; i < numberOfNodes; i++ {
+		node := newTestNode(uint64(i+1), 0.5, 0.5)
+		node.Keys = []int{0}
+		node.Values = []int{0}
+		geomIndex.cells[common.CellIndex{0, 0}] = append(geomIndex.cells[common.CellIndex{0, 0}], node)
+	}
+	return geomIndex
+}
+
+func TestQuery_Stream(t *testing.T) {
+	// Arrange
+	geomIndex := newIteratorTestIndex(5)
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	statement.SetAssertion(NewCountAssertion(BinOpGreaterEqual, 10))
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	iterator, err := q.Stream(geomIndex, 2)
+	common.AssertNil(t, err)
+
+	var ids []uint64
+	for iterator.Next() {
+		ids = append(ids, iterator.Feature().GetID())
+	}
+
+	// Assert
+	common.AssertNil(t, iterator.Err())
+	common.AssertEqual(t, []uint64{1, 2, 3, 4, 5}, ids)
+	common.AssertEqual(t, 1, len(q.GetFailedAssertions()))
+}
+
+func TestQuery_Stream_close(t *testing.T) {
+	// Arrange
+	geomIndex := newIteratorTestIndex(100)
+	q := NewQuery([]Statement{*NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))})
+	iterator, err := q.Stream(geomIndex, 1)
+	common.AssertNil(t, err)
+
+	// Act
+	common.AssertTrue(t, iterator.Next())
+	iterator.Close()
+
+	// Assert
+	common.AssertFalse(t, iterator.Next())
+	common.AssertNil(t, iterator.Feature())
+	common.AssertNil(t, iterator.Err())
+}
+
+func TestQuery_Stream_incompatibleIndex(t *testing.T) {
+	// Arrange
+	geomIndex := newIteratorTestIndex(1)
+	geomIndex.metadata.UntaggedNodesSkipped = true
+	q := NewQuery([]Statement{*NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, false))})
+
+	// Act
+	iterator, err := q.Stream(geomIndex, 1)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, iterator)
+}
+
+func TestQuery_Stream_indexOfOtherQueryNotUsed(t *testing.T) {
+	// Arrange
+	newStatement := func() Statement {
+		return *NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	}
+	q := NewQuery([]Statement{newStatement(), newStatement()})
+	otherQuery := NewQuery([]Statement{newStatement()})
+
+	// The buffer is smaller than the result of the first statement, so the second one is executed after the other query.
+	iterator, err := q.Stream(newIteratorTestIndex(3), 1)
+	common.AssertNil(t, err)
+	common.AssertTrue(t, iterator.Next())
+
+	// Act
+	otherFeatures, otherErr := otherQuery.Execute(newIteratorTestIndex(1))
+
+	ids := []uint64{iterator.Feature().GetID()}
+	for iterator.Next() {
+		ids = append(ids, iterator.Feature().GetID())
+	}
+
+	// Assert
+	common.AssertNil(t, otherErr)
+	common.AssertEqual(t, 1, len(otherFeatures))
+	common.AssertNil(t, iterator.Err())
+	common.AssertEqual(t, []uint64{1, 2, 3, 1, 2, 3}, ids)
+}
@@ -0,0 +1,46 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"slices"
+	"soq/feature"
+	"soq/index"
+)
+
+// KeyPrefixFilterExpression checks whether features have any key starting with a certain prefix, e.g. "addr:*=*" for
+// features with at least one address key or "addr:*!=*" for features without any. The keys with this prefix are looked
+// up in the tag index once, so that each feature only needs a check of its own keys.
+type KeyPrefixFilterExpression struct {
+	prefix      string
+	keys        []int // Ascending indices of all keys with the prefix
+	shouldBeSet bool
+}
+
+func NewKeyPrefixFilterExpression(tagIndex *index.TagIndex, prefix string, shouldBeSet bool) *KeyPrefixFilterExpression {
+	return &KeyPrefixFilterExpression{
+		prefix:      prefix,
+		keys:        tagIndex.GetKeyIndicesByPrefix(prefix),
+		shouldBeSet: shouldBeSet,
+	}
+}
+
+func (f KeyPrefixFilterExpression) Applies(feature feature.Feature, context feature.Feature) (bool, error) {
+	if sigolo.ShouldLogTrace() {
+		sigolo.Tracef("KeyPrefixFilterExpression: HasKeyWithPrefix(%s)=%v?", f.prefix, f.shouldBeSet)
+	}
+
+	return f.hasAnyKey(feature.GetKeys()) == f.shouldBeSet, nil
+}
+
+func (f KeyPrefixFilterExpression) hasAnyKey(keys []int) bool {
+	for _, key := range keys {
+		if _, found := slices.BinarySearch(f.keys, key); found {
+			return true
+		}
+	}
+	return false
+}
+
+func (f KeyPrefixFilterExpression) Print(indent int) {
+	sigolo.Debugf("%s%s: %s* (%d keys, shouldBeSet=%v)", spacing(indent), "KeyPrefixFilterExpression", f.prefix, len(f.keys), f.shouldBeSet)
+}
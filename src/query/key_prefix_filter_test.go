@@ -0,0 +1,54 @@
+package query
+
+import (
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	"testing"
+)
+
+func TestKeyPrefixFilterExpression_Applies(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"addr:city", "addr:street", "name"}, [][]string{{"Foo"}, {"Bar"}, {"Baz"}})
+	setExpression := NewKeyPrefixFilterExpression(tagIndex, "addr:", true)
+	notSetExpression := NewKeyPrefixFilterExpression(tagIndex, "addr:", false)
+
+	for _, testCase := range []struct {
+		feature  feature.Feature
+		expected bool
+	}{
+		{newTaggedTestNode(1, 0, 0, []int{0}, []int{0}), true},
+		{newTaggedTestNode(2, 0, 0, []int{1, 2}, []int{0, 0}), true},
+		{newTaggedTestNode(3, 0, 0, []int{2}, []int{0}), false},
+		{newTestNode(4, 0, 0), false},
+	} {
+		// Act
+		setApplies, setErr := setExpression.Applies(testCase.feature, nil)
+		notSetApplies, notSetErr := notSetExpression.Applies(testCase.feature, nil)
+
+		// Assert
+		common.AssertNil(t, setErr)
+		common.AssertNil(t, notSetErr)
+		common.AssertEqual(t, testCase.expected, setApplies)
+		common.AssertEqual(t, !testCase.expected, notSetApplies)
+	}
+}
+
+func TestKeyPrefixFilterExpression_keyFilter(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"addr:city", "addr:street", "name"}, [][]string{{"Foo"}, {"Bar"}, {"Baz"}})
+	cellKeys := map[int]bool{1: true}
+	hasKey := func(key int) bool {
+		return cellKeys[key]
+	}
+
+	// Act
+	setKeyFilter := getKeyFilter(NewKeyPrefixFilterExpression(tagIndex, "addr:", true))
+	notSetKeyFilter := getKeyFilter(NewKeyPrefixFilterExpression(tagIndex, "addr:", false))
+	unknownPrefixKeyFilter := getKeyFilter(NewKeyPrefixFilterExpression(tagIndex, "foo:", true))
+
+	// Assert
+	common.AssertTrue(t, setKeyFilter(hasKey))
+	common.AssertNil(t, notSetKeyFilter)
+	common.AssertFalse(t, unknownPrefixKeyFilter(hasKey))
+}
@@ -0,0 +1,224 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"slices"
+	"soq/index"
+	"time"
+)
+
+const (
+	LimitMemory         = "memory"
+	LimitDuration       = "duration"
+	LimitCells          = "cells"
+	LimitResultFeatures = "result_features"
+	LimitArea           = "area"
+)
+
+// Limits restrict the resources a single execution of a query may use. A value of 0 or less means unlimited. The memory
+// limit is set separately via SetMemoryLimit.
+type Limits struct {
+	// Maximum time the execution may take.
+	MaxDuration time.Duration
+	// Maximum number of cells read from the index, including the cells read by sub-statements and spatial joins.
+	MaxCells int64
+	// Maximum number of features in the result of the whole query.
+	MaxResultFeatures int64
+	// Maximum number of cells covered by the location of a top-level statement. This is checked before the execution,
+	// so that queries on huge areas fail right away instead of reading cells until another limit is exceeded.
+	MaxAreaCells int64
+}
+
+// ErrTimeout is matched (s. errors.Is) by errors of executions that took too long, i.e. that exceeded the maximum
+// duration (s. Limits) or whose context reached its deadline.
+var ErrTimeout = errors.New("Execution timed out")
+
+// LimitExceededError is returned when the execution of a query exceeds one of its limits and has therefore been aborted.
+type LimitExceededError struct {
+	// Name of the exceeded limit, one of the Limit... constants.
+	Limit string
+	// The maximum value of the limit in bytes, milliseconds, cells or features.
+	Maximum int64
+	message string
+}
+
+func newLimitExceededError(limit string, maximum int64, format string, args ...any) *LimitExceededError {
+	return &LimitExceededError{
+		Limit:   limit,
+		Maximum: maximum,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *LimitExceededError) Error() string {
+	return e.message
+}
+
+func (e *LimitExceededError) Is(target error) bool {
+	return target == ErrTimeout && e.Limit == LimitDuration
+}
+
+// ExecutionCancelledError is returned when the context of a query has been cancelled during its execution, e.g. because
+// the client disconnected or the server shuts down.
+type ExecutionCancelledError struct {
+	cause error
+}
+
+func (e *ExecutionCancelledError) Error() string {
+	return fmt.Sprintf("Execution cancelled: %s", e.cause.Error())
+}
+
+func (e *ExecutionCancelledError) Unwrap() error {
+	return e.cause
+}
+
+func (e *ExecutionCancelledError) Is(target error) bool {
+	return target == ErrTimeout && errors.Is(e.cause, context.DeadlineExceeded)
+}
+
+// startExecution sets the limits and context of the next execution and resets the counters of the previous execution.
+func (b *MemoryBudget) startExecution(limits Limits, ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.limits = limits
+	b.context = ctx
+	b.startTime = time.Now()
+	b.readCells = 0
+	b.resultFeatures = 0
+	b.warnings = nil
+}
+
+// readCell counts a cell read from the index and returns an error when this exceeds the cell limit, when the maximum
+// duration of the execution is over or when the execution has been cancelled.
+func (b *MemoryBudget) readCell() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.readCells++
+	if b.limits.MaxCells > 0 && b.readCells > b.limits.MaxCells {
+		return newLimitExceededError(LimitCells, b.limits.MaxCells, "Limit of %d cells exceeded. Use a smaller area or fewer sub-statements.", b.limits.MaxCells)
+	}
+
+	return b.checkDurationAndCancellation()
+}
+
+// addResultFeature counts a feature of the query result and returns an error when this exceeds the result feature limit,
+// when the maximum duration of the execution is over or when the execution has been cancelled.
+func (b *MemoryBudget) addResultFeature() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.resultFeatures++
+	if b.limits.MaxResultFeatures > 0 && b.resultFeatures > b.limits.MaxResultFeatures {
+		return newLimitExceededError(LimitResultFeatures, b.limits.MaxResultFeatures, "Limit of %d result features exceeded. Use a smaller area or more specific filters.", b.limits.MaxResultFeatures)
+	}
+
+	return b.checkDurationAndCancellation()
+}
+
+// GetReadCells returns the number of cells read during the current or last execution, including the cells read by
+// sub-statements and spatial joins.
+func (b *MemoryBudget) GetReadCells() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.readCells
+}
+
+// addCellWarning remembers a warning when the given cell has been skipped by the index because it's corrupt. Cells read
+// multiple times (e.g. by sub-statements) are only reported once.
+func (b *MemoryBudget) addCellWarning(result *index.GetFeaturesResult) {
+	if b == nil || result.CorruptCell == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	warning := result.CorruptCell.Error()
+	if !slices.Contains(b.warnings, warning) {
+		b.warnings = append(b.warnings, warning)
+	}
+}
+
+// GetWarnings returns the warnings of the current or last execution, e.g. about corrupt cells that have been skipped.
+// The result of an execution with warnings might be incomplete.
+func (b *MemoryBudget) GetWarnings() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return slices.Clone(b.warnings)
+}
+
+// checkDurationAndCancellation must be called with the locked mutex.
+func (b *MemoryBudget) checkDurationAndCancellation() error {
+	if b.context != nil && b.context.Err() != nil {
+		return &ExecutionCancelledError{cause: b.context.Err()}
+	}
+	if b.limits.MaxDuration > 0 && time.Since(b.startTime) > b.limits.MaxDuration {
+		return newLimitExceededError(LimitDuration, b.limits.MaxDuration.Milliseconds(), "Maximum execution time of %s exceeded. Use a smaller area or more specific filters.", b.limits.MaxDuration)
+	}
+	return nil
+}
+
+// checkArea returns an error when the location of a top-level statement covers more cells than allowed. Locations
+// depending on a context have no area on their own and are not checked.
+func (q *Query) checkArea(geomIndex index.GeometryIndex) error {
+	if q.limits.MaxAreaCells <= 0 {
+		return nil
+	}
+
+	for _, statement := range q.topLevelStatements {
+		err := q.checkLocationArea(statement.location, geomIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkLocationArea returns an error when the given location covers more cells than allowed.
+func (q *Query) checkLocationArea(location LocationExpression, geomIndex index.GeometryIndex) error {
+	if q.limits.MaxAreaCells <= 0 {
+		return nil
+	}
+
+	var bbox *orb.Bound
+	switch typedLocation := location.(type) {
+	case *CoverageLocationExpression:
+		extent, err := typedLocation.getExtent(geomIndex)
+		if err != nil {
+			return err
+		}
+		bbox = extent
+	case interface{ GetBbox() *orb.Bound }:
+		bbox = typedLocation.GetBbox()
+	default:
+		return nil
+	}
+
+	// Counting the cells instead of listing them, since the list might be huge for the areas this check is about.
+	minCell := geomIndex.GetCellIndexForCoordinate(bbox.Min.Lon(), bbox.Min.Lat())
+	maxCell := geomIndex.GetCellIndexForCoordinate(bbox.Max.Lon(), bbox.Max.Lat())
+	numberOfCells := int64(maxCell.X()-minCell.X()+1) * int64(maxCell.Y()-minCell.Y()+1)
+	if numberOfCells > q.limits.MaxAreaCells {
+		return newLimitExceededError(LimitArea, q.limits.MaxAreaCells, "Query area of %d cells exceeds the maximum of %d cells. Zoom in to a smaller area or use a more specific location, e.g. a place or areaByName instead of a large bbox.", numberOfCells, q.limits.MaxAreaCells)
+	}
+
+	return nil
+}
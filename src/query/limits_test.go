@@ -0,0 +1,146 @@
+package query
+
+import (
+	"context"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/feature"
+	"soq/osm"
+	"testing"
+	"time"
+)
+
+func newLimitsTestQuery() (*Query, *testGeometryIndex) {
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{}}
+	for i := 0; i < 3; i++ {
+		node := newTestNode(uint64(i+1), float64(i)+0.5, 0.5)
+		node.Keys = []int{0}
+		node.Values = []int{0}
+		geomIndex.cells[common.CellIndex{i, 0}] = []feature.Feature{node}
+	}
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{2.5, 0.5}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	return NewQuery([]Statement{*statement}), geomIndex
+}
+
+func TestQuery_Execute_limits(t *testing.T) {
+	for _, testCase := range []struct {
+		limits        Limits
+		expectedLimit string
+	}{
+		{Limits{MaxCells: 2}, LimitCells},
+		{Limits{MaxResultFeatures: 2}, LimitResultFeatures},
+		{Limits{MaxDuration: time.Nanosecond}, LimitDuration},
+		{Limits{MaxAreaCells: 2}, LimitArea},
+	} {
+		// Arrange
+		q, geomIndex := newLimitsTestQuery()
+		q.SetLimits(testCase.limits)
+
+		// Act
+		features, err := q.Execute(geomIndex)
+
+		// Assert
+		var limitErr *LimitExceededError
+		common.AssertTrue(t, errors.As(err, &limitErr))
+		common.AssertEqual(t, testCase.expectedLimit, limitErr.Limit)
+		common.AssertEqual(t, testCase.expectedLimit == LimitDuration, errors.Is(err, ErrTimeout))
+		common.AssertNil(t, features)
+	}
+}
+
+func TestQuery_Execute_withinLimits(t *testing.T) {
+	// Arrange
+	q, geomIndex := newLimitsTestQuery()
+	q.SetLimits(Limits{MaxCells: 3, MaxResultFeatures: 3, MaxDuration: time.Minute, MaxAreaCells: 3})
+
+	// Act
+	features, err := q.Execute(geomIndex)
+	common.AssertNil(t, err)
+	// The counters are reset for each execution
+	features, err = q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 3, len(features))
+}
+
+func TestQuery_Execute_areaLimitCheckedBeforeReadingCells(t *testing.T) {
+	// Arrange
+	q, geomIndex := newLimitsTestQuery()
+	q.SetLimits(Limits{MaxAreaCells: 2})
+
+	// Act
+	_, err := q.Execute(geomIndex)
+
+	// Assert
+	var limitErr *LimitExceededError
+	common.AssertTrue(t, errors.As(err, &limitErr))
+	common.AssertEqual(t, int64(2), limitErr.Maximum)
+	common.AssertEqual(t, int64(0), q.GetMemoryBudget().GetReadCells())
+}
+
+func TestQuery_ExecutePage_areaLimit(t *testing.T) {
+	// Arrange
+	q, geomIndex := newLimitsTestQuery()
+	q.SetLimits(Limits{MaxAreaCells: 2})
+
+	// Act
+	features, cursor, err := q.ExecutePage(geomIndex, nil, 10)
+
+	// Assert
+	var limitErr *LimitExceededError
+	common.AssertTrue(t, errors.As(err, &limitErr))
+	common.AssertEqual(t, LimitArea, limitErr.Limit)
+	common.AssertEqual(t, int64(0), q.GetMemoryBudget().GetReadCells())
+	common.AssertNil(t, features)
+	common.AssertNil(t, cursor)
+}
+
+func TestQuery_Execute_cancelled(t *testing.T) {
+	// Arrange
+	q, geomIndex := newLimitsTestQuery()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.SetContext(ctx)
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	var cancelledErr *ExecutionCancelledError
+	common.AssertTrue(t, errors.As(err, &cancelledErr))
+	common.AssertTrue(t, errors.Is(err, context.Canceled))
+	common.AssertFalse(t, errors.Is(err, ErrTimeout))
+	common.AssertNil(t, features)
+}
+
+func TestQuery_Execute_deadlineExceeded(t *testing.T) {
+	// Arrange
+	q, geomIndex := newLimitsTestQuery()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	q.SetContext(ctx)
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertTrue(t, errors.Is(err, ErrTimeout))
+	common.AssertTrue(t, errors.Is(err, context.DeadlineExceeded))
+	common.AssertNil(t, features)
+}
+
+func TestMemoryBudget_reserve_limitExceededError(t *testing.T) {
+	// Arrange
+	budget := NewMemoryBudget(100)
+
+	// Act
+	err := budget.reserve(101)
+
+	// Assert
+	var limitErr *LimitExceededError
+	common.AssertTrue(t, errors.As(err, &limitErr))
+	common.AssertEqual(t, LimitMemory, limitErr.Limit)
+	common.AssertEqual(t, int64(100), limitErr.Maximum)
+}
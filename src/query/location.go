@@ -12,8 +12,10 @@ import (
 )
 
 type LocationExpression interface {
-	GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error)
+	GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType, idFilter index.IdFilter, keyFilter index.KeyFilter, tagFilter index.TagFilter) (chan *index.GetFeaturesResult, error)
 	GetFeaturesForCells(geometryIndex index.GeometryIndex, cells []common.CellIndex, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error)
+	// GetCells returns all cells covered by this location in a deterministic order (column by column).
+	GetCells(geometryIndex index.GeometryIndex) ([]common.CellIndex, error)
 	IsWithin(feature feature.Feature, context feature.Feature) (bool, error)
 	Print(indent int)
 }
@@ -26,14 +28,20 @@ func NewBboxLocationExpression(bbox *orb.Bound) *BboxLocationExpression {
 	return &BboxLocationExpression{bbox: bbox}
 }
 
-func (b *BboxLocationExpression) GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error) {
-	return geometryIndex.Get(b.bbox, objectType)
+func (b *BboxLocationExpression) GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType, idFilter index.IdFilter, keyFilter index.KeyFilter, tagFilter index.TagFilter) (chan *index.GetFeaturesResult, error) {
+	return geometryIndex.Get(b.bbox, objectType, idFilter, keyFilter, tagFilter)
 }
 
 func (b *BboxLocationExpression) GetFeaturesForCells(geometryIndex index.GeometryIndex, cells []common.CellIndex, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error) {
 	return geometryIndex.GetFeaturesForCells(cells, objectType), nil
 }
 
+func (b *BboxLocationExpression) GetCells(geometryIndex index.GeometryIndex) ([]common.CellIndex, error) {
+	minCell := geometryIndex.GetCellIndexForCoordinate(b.bbox.Min.Lon(), b.bbox.Min.Lat())
+	maxCell := geometryIndex.GetCellIndexForCoordinate(b.bbox.Max.Lon(), b.bbox.Max.Lat())
+	return common.CellExtent{minCell, maxCell}.GetCellIndices(), nil
+}
+
 func (b *BboxLocationExpression) IsWithin(feature feature.Feature, context feature.Feature) (bool, error) {
 	if sigolo.ShouldLogTrace() {
 		sigolo.Tracef("BboxLocationExpression: IsWithin((%s), %v)", b.string(), feature.GetGeometry())
@@ -44,6 +52,10 @@ func (b *BboxLocationExpression) IsWithin(feature feature.Feature, context featu
 		return b.bbox.Contains(*geometry), nil
 	case *orb.LineString:
 		return b.bbox.Intersects(geometry.Bound()), nil // TODO Use a more accurate check?
+	case *orb.Polygon:
+		return b.bbox.Intersects(geometry.Bound()), nil // TODO Use a more accurate check?
+	case *orb.MultiPolygon:
+		return b.bbox.Intersects(geometry.Bound()), nil // TODO Use a more accurate check?
 	}
 
 	return false, errors.Errorf("Unknown or unsupported geometry type %s", feature.GetGeometry().GeoJSONType())
@@ -61,6 +73,139 @@ func (b *BboxLocationExpression) string() string {
 	return fmt.Sprintf("%f, %f, %f, %f", b.bbox.Min.Lon(), b.bbox.Min.Lat(), b.bbox.Max.Lon(), b.bbox.Max.Lat())
 }
 
+// CoverageLocationExpression covers the whole extent of the imported data. The extent is taken from the metadata of
+// the index when the features are requested.
+type CoverageLocationExpression struct {
+}
+
+func NewCoverageLocationExpression() *CoverageLocationExpression {
+	return &CoverageLocationExpression{}
+}
+
+func (c *CoverageLocationExpression) GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType, idFilter index.IdFilter, keyFilter index.KeyFilter, tagFilter index.TagFilter) (chan *index.GetFeaturesResult, error) {
+	extent, err := c.getExtent(geometryIndex)
+	if err != nil {
+		return nil, err
+	}
+	return geometryIndex.Get(extent, objectType, idFilter, keyFilter, tagFilter)
+}
+
+func (c *CoverageLocationExpression) GetFeaturesForCells(geometryIndex index.GeometryIndex, cells []common.CellIndex, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error) {
+	return geometryIndex.GetFeaturesForCells(cells, objectType), nil
+}
+
+func (c *CoverageLocationExpression) GetCells(geometryIndex index.GeometryIndex) ([]common.CellIndex, error) {
+	extent, err := c.getExtent(geometryIndex)
+	if err != nil {
+		return nil, err
+	}
+	return NewBboxLocationExpression(extent).GetCells(geometryIndex)
+}
+
+func (c *CoverageLocationExpression) IsWithin(feature feature.Feature, context feature.Feature) (bool, error) {
+	// Every feature of the index is within the extent of the imported data.
+	return true, nil
+}
+
+func (c *CoverageLocationExpression) Print(indent int) {
+	sigolo.Debugf("%slocation: coverage()", spacing(indent))
+}
+
+func (c *CoverageLocationExpression) getExtent(geometryIndex index.GeometryIndex) (*orb.Bound, error) {
+	metadata := geometryIndex.GetMetadata()
+	if metadata == nil || metadata.Extent == nil {
+		return nil, errors.New("The index contains no information about the extent of the imported data. Import the data again or use a bbox location instead.")
+	}
+	return metadata.Extent, nil
+}
+
+// AreaLocationExpression covers the area of a (multi)polygon, e.g. of an administrative boundary. The features are read
+// from the cells within the bbox of the area and only the ones intersecting the area are returned.
+type AreaLocationExpression struct {
+	name string // Name of the area for debug output, e.g. of the boundary relation.
+	area orb.MultiPolygon
+	bbox *orb.Bound
+}
+
+func NewAreaLocationExpression(name string, area orb.MultiPolygon) *AreaLocationExpression {
+	bbox := area.Bound()
+	return &AreaLocationExpression{
+		name: name,
+		area: area,
+		bbox: &bbox,
+	}
+}
+
+func (a *AreaLocationExpression) GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType, idFilter index.IdFilter, keyFilter index.KeyFilter, tagFilter index.TagFilter) (chan *index.GetFeaturesResult, error) {
+	featuresChannel, err := geometryIndex.Get(a.bbox, objectType, idFilter, keyFilter, tagFilter)
+	if err != nil {
+		return nil, err
+	}
+	return a.filterFeatures(featuresChannel), nil
+}
+
+func (a *AreaLocationExpression) GetFeaturesForCells(geometryIndex index.GeometryIndex, cells []common.CellIndex, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error) {
+	return a.filterFeatures(geometryIndex.GetFeaturesForCells(cells, objectType)), nil
+}
+
+func (a *AreaLocationExpression) GetCells(geometryIndex index.GeometryIndex) ([]common.CellIndex, error) {
+	return NewBboxLocationExpression(a.bbox).GetCells(geometryIndex)
+}
+
+func (a *AreaLocationExpression) IsWithin(feature feature.Feature, context feature.Feature) (bool, error) {
+	return intersects(index.DereferenceGeometry(feature.GetGeometry()), a.area), nil
+}
+
+func (a *AreaLocationExpression) Print(indent int) {
+	sigolo.Debugf("%slocation: area(%s)", spacing(indent), a.name)
+}
+
+func (a *AreaLocationExpression) GetName() string {
+	return a.name
+}
+
+func (a *AreaLocationExpression) GetArea() orb.MultiPolygon {
+	return a.area
+}
+
+func (a *AreaLocationExpression) GetBbox() *orb.Bound {
+	return a.bbox
+}
+
+// filterFeatures passes the results of the given channel on with only the features intersecting the area.
+func (a *AreaLocationExpression) filterFeatures(featuresChannel chan *index.GetFeaturesResult) chan *index.GetFeaturesResult {
+	return filterResultFeatures(featuresChannel, func(geometry orb.Geometry) bool {
+		return intersects(geometry, a.area)
+	})
+}
+
+// filterResultFeatures passes the results of the given channel on with only the features whose (dereferenced) geometry
+// fulfills the given predicate. The given channel is read completely, even when the returned channel isn't, since the
+// returned channel is closed afterward.
+func filterResultFeatures(featuresChannel chan *index.GetFeaturesResult, predicate func(geometry orb.Geometry) bool) chan *index.GetFeaturesResult {
+	filteredChannel := make(chan *index.GetFeaturesResult)
+
+	go func() {
+		defer close(filteredChannel)
+		for result := range featuresChannel {
+			filteredResult := *result
+			filteredResult.Features = nil
+			for _, f := range result.Features {
+				if f == nil {
+					continue
+				}
+				geometry := index.DereferenceGeometry(f.GetGeometry())
+				if geometry != nil && predicate(geometry) {
+					filteredResult.Features = append(filteredResult.Features, f)
+				}
+			}
+			filteredChannel <- &filteredResult
+		}
+	}()
+
+	return filteredChannel
+}
+
 type ContextAwareLocationExpression struct {
 }
 
@@ -68,7 +213,7 @@ func NewContextAwareLocationExpression() *ContextAwareLocationExpression {
 	return &ContextAwareLocationExpression{}
 }
 
-func (e *ContextAwareLocationExpression) GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType) (chan *index.GetFeaturesResult, error) {
+func (e *ContextAwareLocationExpression) GetFeatures(geometryIndex index.GeometryIndex, context feature.Feature, objectType ownOsm.OsmObjectType, idFilter index.IdFilter, keyFilter index.KeyFilter, tagFilter index.TagFilter) (chan *index.GetFeaturesResult, error) {
 	// Should never been called since the SubStatementFilterExpression itself queries the features and does some caching.
 	panic("THe GetFeatures function of a ContextAwareLocationExpression should never been called. This is a bug.")
 }
@@ -77,6 +222,10 @@ func (e *ContextAwareLocationExpression) GetFeaturesForCells(geometryIndex index
 	return geometryIndex.GetFeaturesForCells(cells, objectType), nil
 }
 
+func (e *ContextAwareLocationExpression) GetCells(geometryIndex index.GeometryIndex) ([]common.CellIndex, error) {
+	return nil, errors.New("The cells of a ContextAwareLocationExpression depend on the context and cannot be determined upfront")
+}
+
 func (e *ContextAwareLocationExpression) IsWithin(feature feature.Feature, context feature.Feature) (bool, error) {
 	return context.GetGeometry().Bound().Intersects(feature.GetGeometry().Bound()), nil
 }
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func TestCoverageLocationExpression_GetCells(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{}
+	geomIndex.metadata.Extent = &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.5, 0.5}}
+
+	// Act
+	cells, err := NewCoverageLocationExpression().GetCells(geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []common.CellIndex{{0, 0}, {1, 0}}, cells)
+}
+
+func TestCoverageLocationExpression_GetCells_noExtentInMetadata(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{}
+
+	// Act
+	cells, err := NewCoverageLocationExpression().GetCells(geomIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, cells)
+}
+
+func TestAreaLocationExpression_GetFeatures(t *testing.T) {
+	// Arrange
+	triangle := orb.MultiPolygon{{{{0, 0}, {2, 0}, {0, 2}, {0, 0}}}}
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{
+		{0, 0}: {newTestNode(1, 0.5, 0.5)},
+		{1, 1}: {newTestNode(2, 1.5, 1.5)},
+		{1, 0}: {newTestNode(3, 1.2, 0.5)},
+	}}
+	location := NewAreaLocationExpression("triangle", triangle)
+
+	// Act
+	resultChannel, err := location.GetFeatures(geomIndex, nil, ownOsm.OsmObjNode, nil, nil, nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	var ids []uint64
+	cellCount := 0
+	for result := range resultChannel {
+		cellCount++
+		for _, f := range result.Features {
+			ids = append(ids, f.GetID())
+		}
+	}
+	common.AssertEqual(t, 9, cellCount)
+	common.AssertEqual(t, []uint64{1, 3}, ids)
+}
+
+func TestAreaLocationExpression_IsWithin(t *testing.T) {
+	// Arrange
+	triangle := orb.MultiPolygon{{{{0, 0}, {2, 0}, {0, 2}, {0, 0}}}}
+	location := NewAreaLocationExpression("triangle", triangle)
+
+	// Act
+	inside, insideErr := location.IsWithin(newTestNode(1, 0.5, 0.5), nil)
+	outside, outsideErr := location.IsWithin(newTestNode(2, 1.5, 1.5), nil)
+
+	// Assert
+	common.AssertNil(t, insideErr)
+	common.AssertTrue(t, inside)
+	common.AssertNil(t, outsideErr)
+	common.AssertFalse(t, outside)
+}
@@ -0,0 +1,74 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"soq/feature"
+)
+
+// ChangesetFilterExpression compares the changeset of the last modification of features, e.g. "changeset=123" or
+// "changeset>=123". The operators are the same as for IDs. Features without metadata never match.
+type ChangesetFilterExpression struct {
+	changesets *IdFilterExpression
+}
+
+func NewChangesetFilterExpression(changeset uint64, operator BinaryOperator) *ChangesetFilterExpression {
+	return &ChangesetFilterExpression{
+		changesets: NewIdFilterExpression(changeset, operator),
+	}
+}
+
+func (f ChangesetFilterExpression) Applies(featureToCheck feature.Feature, context feature.Feature) (bool, error) {
+	metadata := featureToCheck.GetMetadata()
+	if metadata == nil {
+		return false, nil
+	}
+
+	if sigolo.ShouldLogTrace() {
+		sigolo.Tracef("ChangesetFilterExpression: Check changeset %d", metadata.Changeset)
+	}
+
+	return f.changesets.AppliesToId(metadata.Changeset), nil
+}
+
+func (f ChangesetFilterExpression) Print(indent int) {
+	sigolo.Debugf("%s%s: changeset%s%d", spacing(indent), "ChangesetFilterExpression", f.changesets.operator.string(), f.changesets.id)
+}
+
+// UserFilterExpression checks the user of the last modification of features, e.g. "user=SomeMapper". Only the "=" and
+// "!=" operators are supported. Features without metadata never match.
+type UserFilterExpression struct {
+	user     int // Index of the user in the user dictionary of the tag-index. index.NotFound for unknown users.
+	operator BinaryOperator
+}
+
+func NewUserFilterExpression(user int, operator BinaryOperator) *UserFilterExpression {
+	return &UserFilterExpression{
+		user:     user,
+		operator: operator,
+	}
+}
+
+func (f UserFilterExpression) Applies(featureToCheck feature.Feature, context feature.Feature) (bool, error) {
+	metadata := featureToCheck.GetMetadata()
+	if metadata == nil {
+		return false, nil
+	}
+
+	if sigolo.ShouldLogTrace() {
+		sigolo.Tracef("UserFilterExpression: Check user %d", metadata.User)
+	}
+
+	switch f.operator {
+	case BinOpEqual:
+		return metadata.User == f.user, nil
+	case BinOpNotEqual:
+		return metadata.User != f.user, nil
+	default:
+		return false, errors.Errorf("Operator %d not supported in UserFilterExpression", f.operator)
+	}
+}
+
+func (f UserFilterExpression) Print(indent int) {
+	sigolo.Debugf("%s%s: user%s%d", spacing(indent), "UserFilterExpression", f.operator.string(), f.user)
+}
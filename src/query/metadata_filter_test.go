@@ -0,0 +1,52 @@
+package query
+
+import (
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	"testing"
+)
+
+func TestMetadataFilterExpressions_Applies(t *testing.T) {
+	nodeWithMetadata := func(changeset uint64, user int) feature.Feature {
+		node := newTestNode(1, 0, 0)
+		node.Metadata = &feature.Metadata{Changeset: changeset, User: user}
+		return node
+	}
+
+	for _, testCase := range []struct {
+		expression FilterExpression
+		feature    feature.Feature
+		expected   bool
+	}{
+		{NewChangesetFilterExpression(123, BinOpEqual), nodeWithMetadata(123, 0), true},
+		{NewChangesetFilterExpression(123, BinOpEqual), nodeWithMetadata(124, 0), false},
+		{NewChangesetFilterExpression(123, BinOpGreater), nodeWithMetadata(124, 0), true},
+		{NewChangesetFilterExpression(123, BinOpNotEqual), newTestNode(1, 0, 0), false},
+		{NewUserFilterExpression(2, BinOpEqual), nodeWithMetadata(1, 2), true},
+		{NewUserFilterExpression(2, BinOpEqual), nodeWithMetadata(1, 3), false},
+		{NewUserFilterExpression(2, BinOpNotEqual), nodeWithMetadata(1, 3), true},
+		{NewUserFilterExpression(index.NotFound, BinOpEqual), nodeWithMetadata(1, 0), false},
+		{NewUserFilterExpression(index.NotFound, BinOpNotEqual), nodeWithMetadata(1, 0), true},
+		{NewUserFilterExpression(2, BinOpNotEqual), newTestNode(1, 0, 0), false},
+	} {
+		// Act
+		applies, err := testCase.expression.Applies(testCase.feature, nil)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expected, applies)
+	}
+}
+
+func TestUserFilterExpression_Applies_unsupportedOperator(t *testing.T) {
+	// Arrange
+	node := newTestNode(1, 0, 0)
+	node.Metadata = &feature.Metadata{Changeset: 1, User: 2}
+
+	// Act
+	_, err := NewUserFilterExpression(2, BinOpGreater).Applies(node, nil)
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
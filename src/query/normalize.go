@@ -0,0 +1,65 @@
+package query
+
+import (
+	"github.com/pkg/errors"
+)
+
+// NormalizeFilterExpression validates the given expression tree and brings it into a canonical form: Nested AND and OR
+// expressions with the same operator are flattened into one left-associative chain, e.g. "a AND (b AND c)" becomes
+// "(a AND b) AND c". This doesn't change the result of the expression, but parentheses don't affect its structure
+// anymore. Filters of sub-statements are not normalized, since they're normalized when their statement is created.
+//
+// An error is returned when an operand is missing or an operator isn't supported.
+func NormalizeFilterExpression(expression FilterExpression) (FilterExpression, error) {
+	switch typedExpression := expression.(type) {
+	case nil:
+		return nil, errors.New("Missing filter expression")
+	case *NegatedFilterExpression:
+		baseExpression, err := NormalizeFilterExpression(typedExpression.baseExpression)
+		if err != nil {
+			return nil, err
+		}
+		return NewNegatedFilterExpression(baseExpression), nil
+	case *LogicalFilterExpression:
+		if typedExpression.operator != LogicOpAnd && typedExpression.operator != LogicOpOr {
+			return nil, errors.Errorf("Operator %s not supported in logical filter expression", typedExpression.operator.string())
+		}
+
+		operands, err := flattenLogicalOperands(typedExpression, typedExpression.operator)
+		if err != nil {
+			return nil, err
+		}
+
+		normalizedExpression := operands[0]
+		for _, operand := range operands[1:] {
+			normalizedExpression = NewLogicalFilterExpression(normalizedExpression, operand, typedExpression.operator)
+		}
+		return normalizedExpression, nil
+	}
+
+	return expression, nil
+}
+
+// flattenLogicalOperands returns the normalized operands of all nested logical expressions with the given operator in
+// their original order.
+func flattenLogicalOperands(expression FilterExpression, operator LogicalOperator) ([]FilterExpression, error) {
+	logicalExpression, isLogicalExpression := expression.(*LogicalFilterExpression)
+	if !isLogicalExpression || logicalExpression.operator != operator {
+		normalizedExpression, err := NormalizeFilterExpression(expression)
+		if err != nil {
+			return nil, err
+		}
+		return []FilterExpression{normalizedExpression}, nil
+	}
+
+	operandsA, err := flattenLogicalOperands(logicalExpression.statementA, operator)
+	if err != nil {
+		return nil, err
+	}
+	operandsB, err := flattenLogicalOperands(logicalExpression.statementB, operator)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(operandsA, operandsB...), nil
+}
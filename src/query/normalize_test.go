@@ -0,0 +1,69 @@
+package query
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestNormalizeFilterExpression(t *testing.T) {
+	a := NewKeyFilterExpression(0, true)
+	b := NewKeyFilterExpression(1, true)
+	c := NewKeyFilterExpression(2, true)
+	d := NewKeyFilterExpression(3, true)
+
+	for _, testCase := range []struct {
+		expression FilterExpression
+		expected   FilterExpression
+	}{
+		{
+			expression: a,
+			expected:   a,
+		},
+		{
+			expression: NewLogicalFilterExpression(a, NewLogicalFilterExpression(b, c, LogicOpAnd), LogicOpAnd),
+			expected:   NewLogicalFilterExpression(NewLogicalFilterExpression(a, b, LogicOpAnd), c, LogicOpAnd),
+		},
+		{
+			expression: NewLogicalFilterExpression(NewLogicalFilterExpression(a, b, LogicOpOr), NewLogicalFilterExpression(c, d, LogicOpOr), LogicOpOr),
+			expected:   NewLogicalFilterExpression(NewLogicalFilterExpression(NewLogicalFilterExpression(a, b, LogicOpOr), c, LogicOpOr), d, LogicOpOr),
+		},
+		{
+			expression: NewLogicalFilterExpression(a, NewLogicalFilterExpression(b, NewLogicalFilterExpression(c, d, LogicOpAnd), LogicOpOr), LogicOpAnd),
+			expected:   NewLogicalFilterExpression(a, NewLogicalFilterExpression(b, NewLogicalFilterExpression(c, d, LogicOpAnd), LogicOpOr), LogicOpAnd),
+		},
+		{
+			expression: NewNegatedFilterExpression(NewLogicalFilterExpression(a, NewLogicalFilterExpression(b, c, LogicOpOr), LogicOpOr)),
+			expected:   NewNegatedFilterExpression(NewLogicalFilterExpression(NewLogicalFilterExpression(a, b, LogicOpOr), c, LogicOpOr)),
+		},
+		{
+			expression: NewLogicalFilterExpression(a, NewNegatedFilterExpression(NewLogicalFilterExpression(b, c, LogicOpAnd)), LogicOpAnd),
+			expected:   NewLogicalFilterExpression(a, NewNegatedFilterExpression(NewLogicalFilterExpression(b, c, LogicOpAnd)), LogicOpAnd),
+		},
+	} {
+		// Act
+		expression, err := NormalizeFilterExpression(testCase.expression)
+
+		// Assert
+		common.AssertNil(t, err)
+		common.AssertEqual(t, testCase.expected, expression)
+	}
+}
+
+func TestNormalizeFilterExpression_invalid(t *testing.T) {
+	a := NewKeyFilterExpression(0, true)
+
+	for _, expression := range []FilterExpression{
+		nil,
+		NewNegatedFilterExpression(nil),
+		NewLogicalFilterExpression(a, nil, LogicOpAnd),
+		NewLogicalFilterExpression(a, NewLogicalFilterExpression(nil, a, LogicOpOr), LogicOpAnd),
+		NewLogicalFilterExpression(a, a, LogicOpNot),
+	} {
+		// Act
+		normalizedExpression, err := NormalizeFilterExpression(expression)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, normalizedExpression)
+	}
+}
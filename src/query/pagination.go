@@ -0,0 +1,354 @@
+package query
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"time"
+)
+
+// Cursor describes the position after the last feature of a result page. It contains everything needed to continue the
+// query at this position, so the server doesn't need to hold any state between two pages. The cell offset refers to
+// the position within the list of all features of that cell, which has a stable order for an unchanged index.
+type Cursor struct {
+	StatementIndex int
+	Cell           common.CellIndex
+	Offset         int
+}
+
+// EncodeCursor returns an URL-safe string representation of the given cursor.
+func EncodeCursor(cursor *Cursor) string {
+	rawCursor := fmt.Sprintf("%d:%d:%d:%d", cursor.StatementIndex, cursor.Cell.X(), cursor.Cell.Y(), cursor.Offset)
+	return base64.RawURLEncoding.EncodeToString([]byte(rawCursor))
+}
+
+// DecodeCursor parses the given string, which must have been created by EncodeCursor.
+func DecodeCursor(encodedCursor string) (*Cursor, error) {
+	rawCursor, err := base64.RawURLEncoding.DecodeString(encodedCursor)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid cursor '%s'", encodedCursor)
+	}
+
+	cursor := &Cursor{}
+	var cellX, cellY int
+	_, err = fmt.Sscanf(string(rawCursor), "%d:%d:%d:%d", &cursor.StatementIndex, &cellX, &cellY, &cursor.Offset)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid cursor '%s'", encodedCursor)
+	}
+	if cursor.StatementIndex < 0 || cursor.Offset < 0 {
+		return nil, errors.Errorf("Invalid cursor '%s': Negative statement index or offset", encodedCursor)
+	}
+	cursor.Cell = common.CellIndex{cellX, cellY}
+
+	return cursor, nil
+}
+
+// ExecutePage executes the query like Execute but only returns up to pageSize features starting at the given cursor.
+// The cursor might be nil to get the first page. The returned cursor points to the position after the last returned
+// feature and is nil when there are no more features. The cells are processed one after another in a fixed order, which
+// makes this slower than Execute but allows continuing the query at any cell.
+func (q *Query) ExecutePage(geomIndex index.GeometryIndex, cursor *Cursor, pageSize int) ([]feature.Feature, *Cursor, error) {
+	geomIndex = q.atQueryTime(geomIndex)
+
+	if pageSize <= 0 {
+		return nil, nil, errors.Errorf("Invalid page size %d, it must be greater than 0", pageSize)
+	}
+	if q.HasStatistics() {
+		return nil, nil, errors.New("Queries with value statistics don't return features and can't be executed page by page")
+	}
+	if q.IsIntrospection() {
+		return nil, nil, errors.New("Queries listing keys or values don't return features and can't be executed page by page")
+	}
+	if q.distinct {
+		// The cursor doesn't contain the features of previous pages, so duplicates can't be detected.
+		return nil, nil, errors.New("Distinct queries can't be executed page by page")
+	}
+	isFirstPage := cursor == nil
+	if isFirstPage {
+		cursor = &Cursor{}
+	}
+	if cursor.StatementIndex >= len(q.topLevelStatements) {
+		return nil, nil, errors.Errorf("Invalid cursor: Statement %d does not exist, query only has %d statements", cursor.StatementIndex, len(q.topLevelStatements))
+	}
+
+	err := q.checkIndexCompatibility(geomIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sigolo.Infof("Start query page with cursor %+v and page size %d", *cursor, pageSize)
+	queryStartTime := time.Now()
+
+	q.memoryBudget.startExecution(q.limits, q.context)
+
+	err = q.checkArea(geomIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, statement := range q.topLevelStatements {
+		setGeometryIndexOnStatement(&q.topLevelStatements[i], geomIndex)
+		setMemoryBudgetOnStatement(statement, q.memoryBudget)
+	}
+	unregisterCaches := q.registerSubStatementCaches()
+	defer unregisterCaches()
+
+	var result []feature.Feature
+	var nextCursor *Cursor
+
+	for statementIndex := cursor.StatementIndex; statementIndex < len(q.topLevelStatements); statementIndex++ {
+		var startCell *common.CellIndex
+		startOffset := 0
+		// The first page starts at the first cell, which might be before the zero cell of an empty cursor.
+		if statementIndex == cursor.StatementIndex && !isFirstPage {
+			startCell = &cursor.Cell
+			startOffset = cursor.Offset
+		}
+
+		statement := q.topLevelStatements[statementIndex]
+		statementResult, statementCursor, err := statement.executePage(startCell, startOffset, pageSize-len(result), q.memoryBudget)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, statement.applyOutputModifiers(statementResult)...)
+
+		if statementCursor != nil {
+			statementCursor.StatementIndex = statementIndex
+			nextCursor = statementCursor
+			break
+		}
+	}
+
+	queryDuration := time.Since(queryStartTime)
+	sigolo.Infof("Executed query page in %s", queryDuration)
+
+	return result, nextCursor, nil
+}
+
+// executePage returns up to maxFeatures features fulfilling this statement. It starts at the given offset within the
+// given cell or at the first cell, when startCell is nil. The returned cursor is nil when all cells have been
+// processed.
+func (s Statement) executePage(startCell *common.CellIndex, startOffset int, maxFeatures int, budget *MemoryBudget) ([]feature.Feature, *Cursor, error) {
+	cells, err := s.location.GetCells(s.geometryIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.spatialJoin != nil {
+		err = s.spatialJoin.prepare(budget)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var result []feature.Feature
+	earlierCells := newEarlierCellLookup(s.geometryIndex, cells, s.queryType.GetObjectType(), budget)
+	defer earlierCells.release()
+
+	for _, cell := range cells {
+		offset := 0
+		if startCell != nil {
+			if isBeforeCell(cell, *startCell) {
+				continue
+			}
+			if cell == *startCell {
+				offset = startOffset
+			}
+		}
+
+		err = budget.readCell()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		featuresChannel, err := s.location.GetFeaturesForCells(s.geometryIndex, []common.CellIndex{cell}, s.queryType.GetObjectType())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var cellFeatures []feature.Feature
+		for getFeatureResult := range featuresChannel {
+			if getFeatureResult.Err != nil {
+				go drainChannel(featuresChannel)
+				return nil, nil, getFeatureResult.Err
+			}
+			budget.addCellWarning(getFeatureResult)
+			cellFeatures = append(cellFeatures, getFeatureResult.Features...)
+		}
+
+		bufferedBytes := feature.EstimateSizes(cellFeatures)
+		err = budget.reserve(bufferedBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i := offset; i < len(cellFeatures); i++ {
+			if cellFeatures[i] == nil {
+				continue
+			}
+
+			isWithin, err := s.location.IsWithin(cellFeatures[i], nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !isWithin {
+				continue
+			}
+
+			applies, err := s.Applies(cellFeatures[i], nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !applies {
+				continue
+			}
+
+			isInEarlierCell, err := earlierCells.contains(cellFeatures[i], cell)
+			if err != nil {
+				return nil, nil, err
+			}
+			if isInEarlierCell {
+				continue
+			}
+
+			err = budget.reserve(feature.EstimateSize(cellFeatures[i]))
+			if err != nil {
+				return nil, nil, err
+			}
+			err = budget.addResultFeature()
+			if err != nil {
+				return nil, nil, err
+			}
+			result = append(result, cellFeatures[i])
+
+			if len(result) == maxFeatures {
+				budget.release(bufferedBytes)
+				return result, &Cursor{Cell: cell, Offset: i + 1}, nil
+			}
+		}
+
+		budget.release(bufferedBytes)
+	}
+
+	return result, nil, nil
+}
+
+// isBeforeCell returns true when the cell comes before the other cell in the column-by-column order of the cells.
+func isBeforeCell(cell common.CellIndex, other common.CellIndex) bool {
+	return cell.X() < other.X() || cell.X() == other.X() && cell.Y() < other.Y()
+}
+
+// earlierCellLookup determines whether a way or relation is also stored in one of the cells of a statement coming
+// before a given cell. Such features are only returned in the first of their cells, so that each feature appears on
+// only one page without storing the returned IDs in the cursor. The candidate cells are derived from the geometry of
+// the feature and then checked by reading them, so that a wrong candidate can only result in a duplicate. The
+// remembered IDs are part of the memory budget.
+type earlierCellLookup struct {
+	geometryIndex index.GeometryIndex
+	objectType    ownOsm.OsmObjectType
+	cells         map[common.CellIndex]bool
+	cellIds       map[common.CellIndex]map[uint64]bool // IDs of the features of the cells read so far
+	budget        *MemoryBudget
+	reservedBytes int64
+}
+
+func newEarlierCellLookup(geometryIndex index.GeometryIndex, cells []common.CellIndex, objectType ownOsm.OsmObjectType, budget *MemoryBudget) *earlierCellLookup {
+	lookup := &earlierCellLookup{
+		geometryIndex: geometryIndex,
+		objectType:    objectType,
+		cells:         map[common.CellIndex]bool{},
+		cellIds:       map[common.CellIndex]map[uint64]bool{},
+		budget:        budget,
+	}
+	for _, cell := range cells {
+		lookup.cells[cell] = true
+	}
+	return lookup
+}
+
+// contains returns true when the feature of the given cell is also stored in a cell of the statement before this cell.
+// Nodes are only stored in one cell.
+func (l *earlierCellLookup) contains(f feature.Feature, cell common.CellIndex) (bool, error) {
+	var candidateCells []common.CellIndex
+	switch typedFeature := f.(type) {
+	case feature.NodeFeature:
+		return false, nil
+	case feature.WayFeature:
+		// Ways are stored in the cells of their nodes.
+		for _, node := range typedFeature.GetNodes() {
+			candidateCells = append(candidateCells, l.geometryIndex.GetCellIndexForCoordinate(node.Lon, node.Lat))
+		}
+	default:
+		// Relations are stored in the cells of their members, which are within their bbox.
+		if f.GetGeometry() == nil {
+			return false, nil
+		}
+		bound := f.GetGeometry().Bound()
+		minCell := l.geometryIndex.GetCellIndexForCoordinate(bound.Min.Lon(), bound.Min.Lat())
+		maxCell := l.geometryIndex.GetCellIndexForCoordinate(bound.Max.Lon(), bound.Max.Lat())
+		for x := minCell.X(); x <= maxCell.X(); x++ {
+			for y := minCell.Y(); y <= maxCell.Y(); y++ {
+				candidateCells = append(candidateCells, common.CellIndex{x, y})
+			}
+		}
+	}
+
+	for _, candidateCell := range candidateCells {
+		if !l.cells[candidateCell] || !isBeforeCell(candidateCell, cell) {
+			continue
+		}
+
+		ids, err := l.getIds(candidateCell)
+		if err != nil {
+			return false, err
+		}
+		if ids[f.GetID()] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getIds returns the IDs of all features of the given cell. Corrupt cells have no IDs, since their features are
+// skipped anyway.
+func (l *earlierCellLookup) getIds(cell common.CellIndex) (map[uint64]bool, error) {
+	if ids, ok := l.cellIds[cell]; ok {
+		return ids, nil
+	}
+
+	ids := map[uint64]bool{}
+	featuresChannel := l.geometryIndex.GetFeaturesForCells([]common.CellIndex{cell}, l.objectType)
+	for getFeatureResult := range featuresChannel {
+		if getFeatureResult.Err != nil {
+			go drainChannel(featuresChannel)
+			return nil, getFeatureResult.Err
+		}
+		for _, cellFeature := range getFeatureResult.Features {
+			if cellFeature != nil {
+				ids[cellFeature.GetID()] = true
+			}
+		}
+	}
+
+	bytes := int64(len(ids)) * idCacheEntrySizeInBytes
+	err := l.budget.reserve(bytes)
+	if err != nil {
+		return nil, err
+	}
+	l.reservedBytes += bytes
+
+	l.cellIds[cell] = ids
+	return ids, nil
+}
+
+// release frees the memory of the remembered IDs.
+func (l *earlierCellLookup) release() {
+	l.budget.release(l.reservedBytes)
+	l.reservedBytes = 0
+}
@@ -0,0 +1,248 @@
+package query
+
+import (
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"slices"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"testing"
+	"time"
+)
+
+// testGeometryIndex is a simple in-memory geometry index with cells of size 1x1. Features of all types are stored in
+// the same cells and filtered by their type when requested.
+type testGeometryIndex struct {
+	cells         map[common.CellIndex][]feature.Feature
+	metadata      index.IndexMetadata
+	keyStatistics *index.KeyStatistics
+	validAt       *time.Time
+	corruptCells  map[common.CellIndex]bool // These cells are returned without features as corrupt cells
+	failingCells  map[common.CellIndex]bool // These cells are returned without features but with a read error
+}
+
+func (g *testGeometryIndex) Get(bbox *orb.Bound, objectType ownOsm.OsmObjectType, idFilter index.IdFilter, keyFilter index.KeyFilter, tagFilter index.TagFilter) (chan *index.GetFeaturesResult, error) {
+	minCell := g.GetCellIndexForCoordinate(bbox.Min.Lon(), bbox.Min.Lat())
+	maxCell := g.GetCellIndexForCoordinate(bbox.Max.Lon(), bbox.Max.Lat())
+	return g.GetFeaturesForCells(common.CellExtent{minCell, maxCell}.GetCellIndices(), objectType), nil
+}
+
+func (g *testGeometryIndex) GetFeaturesForCells(cells []common.CellIndex, objectType ownOsm.OsmObjectType) chan *index.GetFeaturesResult {
+	resultChannel := make(chan *index.GetFeaturesResult, len(cells))
+	for _, cell := range cells {
+		if g.corruptCells[cell] {
+			corruptCell := index.NewCorruptCellError(fmt.Sprintf("%d/%d.cell", cell.X(), cell.Y()), objectType, errors.New("Incomplete record"))
+			resultChannel <- &index.GetFeaturesResult{Cell: cell, CorruptCell: corruptCell}
+			continue
+		}
+		if g.failingCells[cell] {
+			resultChannel <- &index.GetFeaturesResult{Cell: cell, Err: errors.New("Unable to read cell")}
+			continue
+		}
+
+		var features []feature.Feature
+		for _, f := range g.cells[cell] {
+			if f != nil && g.validAt != nil && !f.GetValidity().IsValidAt(*g.validAt) {
+				continue
+			}
+			if f == nil || hasObjectType(f, objectType) {
+				features = append(features, f)
+			}
+		}
+		resultChannel <- &index.GetFeaturesResult{Cell: cell, Features: features}
+	}
+	close(resultChannel)
+	return resultChannel
+}
+
+func hasObjectType(f feature.Feature, objectType ownOsm.OsmObjectType) bool {
+	switch f.(type) {
+	case feature.NodeFeature:
+		return objectType == ownOsm.OsmObjNode
+	case feature.WayFeature:
+		return objectType == ownOsm.OsmObjWay
+	case feature.RelationFeature:
+		return objectType == ownOsm.OsmObjRelation
+	}
+	return false
+}
+
+func (g *testGeometryIndex) GetNodes(nodes osm.WayNodes) (*index.WayNodesResult, error) {
+	panic("not implemented")
+}
+
+func (g *testGeometryIndex) MightContainNodes(cell common.CellIndex, nodeIds []uint64) (bool, error) {
+	for _, f := range g.cells[cell] {
+		if _, ok := f.(feature.NodeFeature); ok && slices.Contains(nodeIds, f.GetID()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g *testGeometryIndex) GetCellIndexForCoordinate(x float64, y float64) common.CellIndex {
+	return common.GetCellIndexForCoordinate(x, y, 1, 1)
+}
+
+func (g *testGeometryIndex) GetMetadata() *index.IndexMetadata {
+	return &g.metadata
+}
+
+func (g *testGeometryIndex) GetKeyStatistics() *index.KeyStatistics {
+	return g.keyStatistics
+}
+
+func (g *testGeometryIndex) At(t time.Time) index.GeometryIndex {
+	return &testGeometryIndex{cells: g.cells, metadata: g.metadata, keyStatistics: g.keyStatistics, validAt: &t}
+}
+
+func newTestNode(id uint64, lon float64, lat float64) *index.EncodedNodeFeature {
+	return &index.EncodedNodeFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       id,
+			Geometry: &orb.Point{lon, lat},
+		},
+	}
+}
+
+func TestCursor_encodeAndDecode(t *testing.T) {
+	// Arrange
+	cursor := &Cursor{StatementIndex: 1, Cell: common.CellIndex{-2, 3}, Offset: 42}
+
+	// Act
+	decodedCursor, err := DecodeCursor(EncodeCursor(cursor))
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, cursor, decodedCursor)
+}
+
+func TestCursor_decodeInvalidCursor(t *testing.T) {
+	// Act
+	cursor, err := DecodeCursor("foobar")
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, cursor)
+}
+
+func TestQuery_ExecutePage(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {newTestNode(1, 0.5, 0.5), nil, newTestNode(2, 0.5, 0.5), newTestNode(100, 0.5, 0.5)},
+			{0, 1}: {newTestNode(3, 0.5, 1.5)},
+			{1, 0}: {newTestNode(4, 1.5, 0.5), newTestNode(5, 1.9, 0.9)}, // Node 5 is outside the bbox
+		},
+	}
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.5, 1.5}}), ownOsm.OsmQueryNode, NewIdFilterExpression(10, BinOpLower))
+	q := NewQuery([]Statement{*statement})
+
+	// Act & Assert
+	features, cursor, err := q.ExecutePage(geomIndex, nil, 2)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []uint64{1, 2}, getIds(features))
+	common.AssertEqual(t, &Cursor{Cell: common.CellIndex{0, 0}, Offset: 3}, cursor)
+
+	features, cursor, err = q.ExecutePage(geomIndex, cursor, 2)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []uint64{3, 4}, getIds(features))
+	common.AssertEqual(t, &Cursor{Cell: common.CellIndex{1, 0}, Offset: 1}, cursor)
+
+	features, cursor, err = q.ExecutePage(geomIndex, cursor, 2)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(features))
+	common.AssertNil(t, cursor)
+}
+
+func getIds(features []feature.Feature) []uint64 {
+	var ids []uint64
+	for _, f := range features {
+		ids = append(ids, f.GetID())
+	}
+	return ids
+}
+
+func TestQuery_ExecutePage_negativeCells(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{-1, -1}: {newTestNode(1, -1.5, -1.5)},
+			{0, 0}:   {newTestNode(2, 0.5, 0.5)},
+		},
+	}
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{-1.9, -1.9}, Max: orb.Point{0.9, 0.9}}), ownOsm.OsmQueryNode, NewIdFilterExpression(10, BinOpLower))
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	features, cursor, err := q.ExecutePage(geomIndex, nil, 10)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []uint64{1, 2}, getIds(features))
+	common.AssertNil(t, cursor)
+}
+
+func TestQuery_ExecutePage_waysInSeveralCellsReturnedOnce(t *testing.T) {
+	// Arrange
+	lineString := orb.LineString{{0.5, 0.5}, {1.5, 0.5}}
+	way := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Geometry: &lineString},
+		Nodes:                  osm.WayNodes{{ID: 10, Lon: 0.5, Lat: 0.5}, {ID: 11, Lon: 1.5, Lat: 0.5}},
+	}
+	otherLineString := orb.LineString{{1.2, 0.2}, {1.8, 0.2}}
+	otherWay := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 2, Geometry: &otherLineString},
+		Nodes:                  osm.WayNodes{{ID: 12, Lon: 1.2, Lat: 0.2}, {ID: 13, Lon: 1.8, Lat: 0.2}},
+	}
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {way},
+			{1, 0}: {way, otherWay},
+		},
+	}
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.9, 0.9}}), ownOsm.OsmQueryWay, NewIdFilterExpression(10, BinOpLower))
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	firstPage, cursor, err := q.ExecutePage(geomIndex, nil, 1)
+	common.AssertNil(t, err)
+	secondPage, cursor, err := q.ExecutePage(geomIndex, cursor, 1)
+	common.AssertNil(t, err)
+
+	// Assert
+	common.AssertEqual(t, []uint64{1}, getIds(firstPage))
+	common.AssertEqual(t, []uint64{2}, getIds(secondPage))
+	common.AssertEqual(t, &Cursor{Cell: common.CellIndex{1, 0}, Offset: 2}, cursor)
+}
+
+func TestQuery_ExecutePage_earlierCellIdsInMemoryBudget(t *testing.T) {
+	// Arrange
+	lineString := orb.LineString{{0.5, 0.5}, {1.5, 0.5}}
+	way := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1, Geometry: &lineString},
+		Nodes:                  osm.WayNodes{{ID: 10, Lon: 0.5, Lat: 0.5}, {ID: 11, Lon: 1.5, Lat: 0.5}},
+	}
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {way},
+			{1, 0}: {way},
+		},
+	}
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.9, 0.9}}), ownOsm.OsmQueryWay, NewIdFilterExpression(10, BinOpLower))
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	features, _, err := q.ExecutePage(geomIndex, nil, 10)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []uint64{1}, getIds(features))
+	// The result stays reserved, the IDs of the earlier cell are released after the page
+	common.AssertEqual(t, feature.EstimateSize(way), q.GetMemoryBudget().GetUsedBytes())
+	common.AssertTrue(t, q.GetMemoryBudget().GetPeakBytes() >= feature.EstimateSize(way)+idCacheEntrySizeInBytes)
+}
@@ -0,0 +1,153 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"soq/feature"
+	"soq/index"
+	"sync"
+	"time"
+)
+
+// streamParallel is like the loop in Stream but lets the given number of workers filter the cells in parallel. The
+// calling goroutine merges the matching features of all workers, removes duplicates and passes them to the given
+// function. The order of the features within a cell is kept but cells are handled in no particular order.
+func (s Statement) streamParallel(featuresChannel chan *index.GetFeaturesResult, context feature.Feature, budget *MemoryBudget, workers int, handleFeature func(feature.Feature) error) error {
+	sigolo.Debugf("Filter cells with %d workers", workers)
+
+	matchingFeatureBatches := make(chan []feature.Feature, workers)
+	stop := make(chan struct{})
+	stopOnce := &sync.Once{}
+	var firstErr error
+	fail := func(err error) {
+		stopOnce.Do(func() {
+			firstErr = err
+			close(stop)
+		})
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case getFeatureResult, ok := <-featuresChannel:
+					if !ok {
+						return
+					}
+
+					matchingFeatures, err := s.filterCell(getFeatureResult, context, budget)
+					if err != nil {
+						fail(err)
+						return
+					}
+
+					select {
+					case matchingFeatureBatches <- matchingFeatures:
+					case <-stop:
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(matchingFeatureBatches)
+	}()
+
+	// Ways and relations are part of every cell they cover. The index usually returns them only once, but this isn't
+	// guaranteed for every index implementation.
+	seenIds := map[uint64]bool{}
+	stopped := false
+	for matchingFeatures := range matchingFeatureBatches {
+		if stopped {
+			// Keep reading so that the workers are able to finish.
+			continue
+		}
+
+		for _, f := range matchingFeatures {
+			if seenIds[f.GetID()] {
+				continue
+			}
+			seenIds[f.GetID()] = true
+
+			err := handleFeature(f)
+			if err != nil {
+				fail(err)
+				stopped = true
+				break
+			}
+		}
+	}
+
+	// All workers are finished at this point, so the error isn't written concurrently anymore.
+	if firstErr != nil {
+		go drainChannel(featuresChannel)
+	}
+	return firstErr
+}
+
+// filterCell returns all features of the given cell fulfilling this statement and adds the cell to the trace of this
+// statement.
+func (s Statement) filterCell(getFeatureResult *index.GetFeaturesResult, context feature.Feature, budget *MemoryBudget) ([]feature.Feature, error) {
+	sigolo.Tracef("Received %d features from cell %v", len(getFeatureResult.Features), getFeatureResult.Cell)
+
+	if getFeatureResult.Err != nil {
+		return nil, getFeatureResult.Err
+	}
+
+	err := budget.readCell()
+	if err != nil {
+		return nil, err
+	}
+	budget.addCellWarning(getFeatureResult)
+
+	bufferedBytes := feature.EstimateSizes(getFeatureResult.Features)
+	err = budget.reserve(bufferedBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer budget.release(bufferedBytes)
+
+	startTime := time.Now()
+
+	var matchingFeatures []feature.Feature
+	for _, f := range getFeatureResult.Features {
+		if f == nil {
+			continue
+		}
+		sigolo.Trace("----- next feature -----")
+		f.Print()
+
+		applies, err := s.Applies(f, context)
+		if err != nil {
+			return nil, err
+		}
+		if applies {
+			matchingFeatures = append(matchingFeatures, f)
+		}
+	}
+
+	s.trace.addCell(getFeatureResult, time.Since(startTime), len(matchingFeatures))
+
+	return matchingFeatures, nil
+}
+
+// hasSubStatements returns true when the expression contains sub-statements. Their caches aren't safe for concurrent
+// use, so such statements are always filtered sequentially.
+func hasSubStatements(expression FilterExpression) bool {
+	switch typedExpression := expression.(type) {
+	case *SubStatementFilterExpression:
+		return true
+	case *NegatedFilterExpression:
+		return hasSubStatements(typedExpression.baseExpression)
+	case *LogicalFilterExpression:
+		return hasSubStatements(typedExpression.statementA) || hasSubStatements(typedExpression.statementB)
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"slices"
+	"soq/common"
+	"soq/feature"
+	"soq/osm"
+	"testing"
+)
+
+func newPipelineTestIndex() *testGeometryIndex {
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{}}
+	for x := 0; x < 4; x++ {
+		for i := 0; i < 3; i++ {
+			node := newTestNode(uint64(x*10+i), float64(x)+0.5, 0.5)
+			node.Keys = []int{i % 2}
+			node.Values = []int{0}
+			geomIndex.cells[common.CellIndex{x, 0}] = append(geomIndex.cells[common.CellIndex{x, 0}], node)
+		}
+	}
+	// The same feature in two cells, like a way crossing the cell border.
+	geomIndex.cells[common.CellIndex{1, 0}] = append(geomIndex.cells[common.CellIndex{1, 0}], geomIndex.cells[common.CellIndex{0, 0}][0])
+	return geomIndex
+}
+
+func newPipelineTestQuery() *Query {
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{3.9, 0.9}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	return NewQuery([]Statement{*statement})
+}
+
+func TestQuery_Execute_parallelFilter(t *testing.T) {
+	// Arrange
+	geomIndex := newPipelineTestIndex()
+	q := newPipelineTestQuery()
+	q.SetFilterWorkers(3)
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	var ids []uint64
+	for _, f := range features {
+		ids = append(ids, f.GetID())
+	}
+	slices.Sort(ids)
+	common.AssertEqual(t, []uint64{0, 2, 10, 12, 20, 22, 30, 32}, ids)
+}
+
+func TestQuery_Execute_parallelFilterStopsOnError(t *testing.T) {
+	// Arrange
+	geomIndex := newPipelineTestIndex()
+	q := newPipelineTestQuery()
+	q.SetFilterWorkers(3)
+	q.SetLimits(Limits{MaxResultFeatures: 2})
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertEqual(t, LimitResultFeatures, err.(*LimitExceededError).Limit)
+	common.AssertNil(t, features)
+}
+
+func TestHasSubStatements(t *testing.T) {
+	// Arrange
+	subStatement := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(0, true)))
+	expression := NewLogicalFilterExpression(NewKeyFilterExpression(1, true), NewNegatedFilterExpression(subStatement), LogicOpAnd)
+
+	// Act & Assert
+	common.AssertTrue(t, hasSubStatements(expression))
+	common.AssertFalse(t, hasSubStatements(NewKeyFilterExpression(1, true)))
+}
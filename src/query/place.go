@@ -0,0 +1,299 @@
+package query
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"math"
+	"slices"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"strconv"
+	"strings"
+)
+
+// placeNodeTypes contains the values of place=* nodes ordered by their importance. More important places are preferred
+// when several places have the same name.
+var placeNodeTypes = []string{"city", "town", "borough", "suburb", "village", "quarter", "neighbourhood", "hamlet", "isolated_dwelling", "locality"}
+
+// placeNodeRadius is the radius in meters of the bbox around place nodes of a certain type. Nodes don't have an extent,
+// so this is a rough approximation of the usual size of such places.
+var placeNodeRadius = map[string]float64{
+	"city":          10_000,
+	"town":          4_000,
+	"borough":       3_000,
+	"suburb":        2_000,
+	"village":       1_500,
+	"quarter":       1_000,
+	"neighbourhood": 500,
+	"hamlet":        300,
+}
+
+const defaultPlaceNodeRadius = 500
+
+// maxSimilarPlaceNames is the number of similar names listed in the error when no place with the given name exists.
+const maxSimilarPlaceNames = 5
+
+// PlaceCandidate is a place=* node or boundary relation with a certain name.
+type PlaceCandidate struct {
+	ObjectType ownOsm.OsmObjectType
+	ID         uint64
+	// Value of the place=* tag for nodes or of the admin_level=* tag for boundary relations. Might be empty.
+	Kind string
+	Bbox orb.Bound
+
+	rank    int
+	feature feature.Feature
+}
+
+func (c PlaceCandidate) String() string {
+	if c.ObjectType == ownOsm.OsmObjRelation {
+		return fmt.Sprintf("boundary relation %d (admin_level=%s)", c.ID, c.Kind)
+	}
+	return fmt.Sprintf("place node %d (place=%s)", c.ID, c.Kind)
+}
+
+// ResolvePlace returns the bbox of the place with the given name. Boundary relations are preferred over place=* nodes,
+// since they have a real extent. Among the boundaries, the one with the lowest admin_level wins, among the nodes, the
+// one with the most important place type wins. When no place has the given name, the error lists similar names.
+func ResolvePlace(name string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex) (*orb.Bound, error) {
+	if tagIndex == nil || geometryIndex == nil {
+		return nil, errors.Errorf("Unable to resolve place '%s' without an index", name)
+	}
+
+	candidates, err := FindPlaces(name, tagIndex, geometryIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) == 0 {
+		return nil, errors.Errorf("No place named '%s' found%s", name, getSimilarPlaceNamesMessage(name, tagIndex))
+	}
+
+	bestCandidate := candidates[0]
+	if len(candidates) > 1 {
+		var alternatives []string
+		for _, candidate := range candidates[1:] {
+			alternatives = append(alternatives, candidate.String())
+		}
+		sigolo.Infof("Use %s for place '%s', other places with this name: %s", bestCandidate.String(), name, strings.Join(alternatives, ", "))
+	}
+
+	return &bestCandidate.Bbox, nil
+}
+
+// ResolveArea returns the polygon of the administrative boundary relation (boundary=administrative) with the given
+// name. When an admin level is given, only boundaries with this admin_level are considered, otherwise the one with the
+// lowest admin_level wins. Relations whose geometry hasn't been built yet (s. index.RelationGeometryBuilder) are
+// assembled from their outer and inner ways.
+func ResolveArea(name string, adminLevel string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex) (orb.MultiPolygon, error) {
+	if tagIndex == nil || geometryIndex == nil {
+		return nil, errors.Errorf("Unable to resolve area '%s' without an index", name)
+	}
+
+	candidates, err := FindPlaces(name, tagIndex, geometryIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	boundaryKey, administrativeValue := tagIndex.GetIndicesFromKeyValueStrings("boundary", "administrative")
+	var areaCandidates []PlaceCandidate
+	for _, candidate := range candidates {
+		if candidate.ObjectType != ownOsm.OsmObjRelation || !candidate.feature.HasTag(boundaryKey, administrativeValue) {
+			continue
+		}
+		if adminLevel != "" && candidate.Kind != adminLevel {
+			continue
+		}
+		areaCandidates = append(areaCandidates, candidate)
+	}
+
+	if len(areaCandidates) == 0 {
+		adminLevelMessage := ""
+		if adminLevel != "" {
+			adminLevelMessage = fmt.Sprintf(" with admin_level=%s", adminLevel)
+		}
+		return nil, errors.Errorf("No administrative boundary named '%s'%s found%s", name, adminLevelMessage, getSimilarPlaceNamesMessage(name, tagIndex))
+	}
+
+	bestCandidate := areaCandidates[0]
+	if len(areaCandidates) > 1 {
+		var alternatives []string
+		for _, candidate := range areaCandidates[1:] {
+			alternatives = append(alternatives, candidate.String())
+		}
+		sigolo.Infof("Use %s for area '%s', other areas with this name: %s", bestCandidate.String(), name, strings.Join(alternatives, ", "))
+	}
+
+	if multiPolygon, ok := index.DereferenceGeometry(bestCandidate.feature.GetGeometry()).(orb.MultiPolygon); ok {
+		return multiPolygon, nil
+	}
+
+	multiPolygon, err := index.BuildRelationGeometry(geometryIndex, tagIndex, bestCandidate.feature)
+	if err != nil {
+		return nil, err
+	}
+	if multiPolygon == nil {
+		return nil, errors.Errorf("The polygon of %s can't be assembled, e.g. because some of its ways are outside the imported data", bestCandidate.String())
+	}
+	return *multiPolygon, nil
+}
+
+// FindPlaces returns all place=* nodes and boundary relations with the given name, the best match comes first.
+func FindPlaces(name string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex) ([]PlaceCandidate, error) {
+	nameKey, nameValue := tagIndex.GetIndicesFromKeyValueStrings("name", name)
+	if nameKey == index.NotFound || nameValue == index.NotFound {
+		return nil, nil
+	}
+
+	metadata := geometryIndex.GetMetadata()
+	if metadata == nil || metadata.Extent == nil {
+		return nil, errors.New("The index contains no information about the extent of the imported data, which is needed to find places. Import the data again or use a bbox location instead.")
+	}
+
+	placeKey := tagIndex.GetKeyIndexFromKeyString("place")
+	typeKey, boundaryValue := tagIndex.GetIndicesFromKeyValueStrings("type", "boundary")
+	adminLevelKey := tagIndex.GetKeyIndexFromKeyString("admin_level")
+
+	var candidates []PlaceCandidate
+
+	if placeKey != index.NotFound {
+		nodes, err := getPlaceFeatures(geometryIndex, metadata.Extent, ownOsm.OsmObjNode, nameKey, nameValue, placeKey, index.NotFound)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			placeType := tagIndex.GetValueForKey(placeKey, node.GetValueIndex(placeKey))
+
+			radius, ok := placeNodeRadius[placeType]
+			if !ok {
+				radius = defaultPlaceNodeRadius
+			}
+
+			rank := slices.Index(placeNodeTypes, placeType)
+			if rank == -1 {
+				rank = len(placeNodeTypes)
+			}
+
+			candidates = append(candidates, PlaceCandidate{
+				ObjectType: ownOsm.OsmObjNode,
+				ID:         node.GetID(),
+				Kind:       placeType,
+				Bbox:       getBboxAroundPoint(node.GetGeometry().Bound().Center(), radius),
+				rank:       1000 + rank,
+				feature:    node,
+			})
+		}
+	}
+
+	if typeKey != index.NotFound && boundaryValue != index.NotFound {
+		relations, err := getPlaceFeatures(geometryIndex, metadata.Extent, ownOsm.OsmObjRelation, nameKey, nameValue, typeKey, boundaryValue)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, relation := range relations {
+			adminLevel := ""
+			rank := 999
+			if adminLevelKey != index.NotFound && relation.HasKey(adminLevelKey) {
+				adminLevel = tagIndex.GetValueForKey(adminLevelKey, relation.GetValueIndex(adminLevelKey))
+				if parsedAdminLevel, err := strconv.Atoi(adminLevel); err == nil {
+					rank = parsedAdminLevel
+				}
+			}
+
+			candidates = append(candidates, PlaceCandidate{
+				ObjectType: ownOsm.OsmObjRelation,
+				ID:         relation.GetID(),
+				Kind:       adminLevel,
+				Bbox:       relation.GetGeometry().Bound(),
+				rank:       rank,
+				feature:    relation,
+			})
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b PlaceCandidate) int {
+		if a.rank != b.rank {
+			return a.rank - b.rank
+		}
+		if a.ID < b.ID {
+			return -1
+		} else if a.ID > b.ID {
+			return 1
+		}
+		return 0
+	})
+
+	return candidates, nil
+}
+
+// getPlaceFeatures returns all features with the given name that have the given key (and value, when it's not
+// index.NotFound).
+func getPlaceFeatures(geometryIndex index.GeometryIndex, extent *orb.Bound, objectType ownOsm.OsmObjectType, nameKey int, nameValue int, key int, value int) ([]feature.Feature, error) {
+	matches := func(f feature.Feature) bool {
+		if !f.HasTag(nameKey, nameValue) {
+			return false
+		}
+		if value == index.NotFound {
+			return f.HasKey(key)
+		}
+		return f.HasTag(key, value)
+	}
+
+	keyFilter := func(hasKey func(key int) bool) bool {
+		return hasKey(nameKey) && hasKey(key)
+	}
+	tagFilter := func(keys []int, values []int) bool {
+		return matches(&index.EncodedNodeFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{Keys: keys, Values: values}})
+	}
+
+	resultChannel, err := geometryIndex.Get(extent, objectType, nil, keyFilter, tagFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Features of a way or relation can be in several cells, so duplicates are removed.
+	seenIds := map[uint64]bool{}
+	var features []feature.Feature
+	for result := range resultChannel {
+		if result.Err != nil {
+			go drainChannel(resultChannel)
+			return nil, result.Err
+		}
+		for _, f := range result.Features {
+			if f == nil || seenIds[f.GetID()] || !matches(f) {
+				continue
+			}
+			seenIds[f.GetID()] = true
+			features = append(features, f)
+		}
+	}
+
+	return features, nil
+}
+
+func getBboxAroundPoint(point orb.Point, radius float64) orb.Bound {
+	latDistance := radius / metersPerDegree
+	lonDistance := radius / (metersPerDegree * math.Cos(point.Lat()*math.Pi/180))
+	return orb.Bound{
+		Min: orb.Point{point.Lon() - lonDistance, point.Lat() - latDistance},
+		Max: orb.Point{point.Lon() + lonDistance, point.Lat() + latDistance},
+	}
+}
+
+func getSimilarPlaceNamesMessage(name string, tagIndex *index.TagIndex) string {
+	results, err := tagIndex.SearchValues("name", name, maxSimilarPlaceNames)
+	if err != nil || len(results) == 0 {
+		return ""
+	}
+
+	var similarNames []string
+	for _, result := range results {
+		similarNames = append(similarNames, fmt.Sprintf("'%s'", result.Value))
+	}
+	return ", similar names: " + strings.Join(similarNames, ", ")
+}
@@ -0,0 +1,172 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"strings"
+	"testing"
+)
+
+func newPlaceTestIndices(features ...feature.Feature) (*index.TagIndex, *testGeometryIndex) {
+	tagIndex := index.NewTagIndex(
+		[]string{"name", "place", "type", "admin_level", "boundary"},
+		[][]string{{"Altona", "Altona-Nord", "Hamburg"}, {"city", "suburb"}, {"boundary", "multipolygon"}, {"10", "9"}, {"administrative", "postal_code"}},
+	)
+
+	extent := orb.Bound{Min: orb.Point{9, 53}, Max: orb.Point{10.9, 53.9}}
+	geomIndex := &testGeometryIndex{
+		cells:    map[common.CellIndex][]feature.Feature{},
+		metadata: index.IndexMetadata{Extent: &extent},
+	}
+	for _, f := range features {
+		cell := geomIndex.GetCellIndexForCoordinate(f.GetGeometry().Bound().Min.Lon(), f.GetGeometry().Bound().Min.Lat())
+		geomIndex.cells[cell] = append(geomIndex.cells[cell], f)
+	}
+
+	return tagIndex, geomIndex
+}
+
+func newTaggedTestNode(id uint64, lon float64, lat float64, keys []int, values []int) *index.EncodedNodeFeature {
+	node := newTestNode(id, lon, lat)
+	node.Keys = keys
+	node.Values = values
+	return node
+}
+
+func TestResolvePlace_prefersBoundaryRelation(t *testing.T) {
+	// Arrange
+	boundary := orb.Bound{Min: orb.Point{9.8, 53.5}, Max: orb.Point{9.95, 53.6}}.ToPolygon()
+	tagIndex, geomIndex := newPlaceTestIndices(
+		newTaggedTestNode(1, 9.93, 53.55, []int{0, 1}, []int{0, 1}),
+		&index.EncodedRelationFeature{
+			AbstractEncodedFeature: index.AbstractEncodedFeature{
+				ID:       2,
+				Geometry: &boundary,
+				Keys:     []int{0, 2, 3},
+				Values:   []int{0, 0, 1},
+			},
+		},
+		newTaggedTestNode(3, 9.96, 53.56, []int{0, 1}, []int{1, 1}),
+	)
+
+	// Act
+	candidates, err := FindPlaces("Altona", tagIndex, geomIndex)
+	bbox, resolveErr := ResolvePlace("Altona", tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 2, len(candidates))
+	common.AssertEqual(t, ownOsm.OsmObjRelation, candidates[0].ObjectType)
+	common.AssertEqual(t, "9", candidates[0].Kind)
+	common.AssertEqual(t, uint64(1), candidates[1].ID)
+	common.AssertEqual(t, "suburb", candidates[1].Kind)
+
+	common.AssertNil(t, resolveErr)
+	common.AssertEqual(t, boundary.Bound(), *bbox)
+}
+
+func TestResolvePlace_prefersMoreImportantPlaceNode(t *testing.T) {
+	// Arrange
+	tagIndex, geomIndex := newPlaceTestIndices(
+		newTaggedTestNode(1, 9.93, 53.55, []int{0, 1}, []int{2, 1}),
+		newTaggedTestNode(2, 10, 53.55, []int{0, 1}, []int{2, 0}),
+	)
+
+	// Act
+	bbox, err := ResolvePlace("Hamburg", tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertApprox(t, 10, bbox.Center().Lon(), 0.000001)
+	common.AssertApprox(t, 53.55, bbox.Center().Lat(), 0.000001)
+	// Cities have a radius of 10 km, so the bbox is roughly 20 km high.
+	common.AssertApprox(t, 20_000/metersPerDegree, bbox.Max.Lat()-bbox.Min.Lat(), 0.000001)
+}
+
+func TestResolvePlace_unknownNameListsSimilarNames(t *testing.T) {
+	// Arrange
+	tagIndex, geomIndex := newPlaceTestIndices(
+		newTaggedTestNode(1, 9.93, 53.55, []int{0, 1}, []int{0, 1}),
+	)
+
+	// Act
+	_, err := ResolvePlace("Altonaa", tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertTrue(t, strings.Contains(err.Error(), "'Altona'"))
+}
+
+func TestResolvePlace_nameWithoutPlace(t *testing.T) {
+	// Arrange
+	tagIndex, geomIndex := newPlaceTestIndices(
+		newTaggedTestNode(1, 9.93, 53.55, []int{0}, []int{1}),
+	)
+
+	// Act
+	_, err := ResolvePlace("Altona-Nord", tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+}
+
+func TestResolveArea_selectsAdminLevel(t *testing.T) {
+	// Arrange
+	district := orb.MultiPolygon{orb.Bound{Min: orb.Point{9.8, 53.5}, Max: orb.Point{9.95, 53.6}}.ToPolygon()}
+	quarter := orb.MultiPolygon{orb.Bound{Min: orb.Point{9.9, 53.55}, Max: orb.Point{9.95, 53.6}}.ToPolygon()}
+	tagIndex, geomIndex := newPlaceTestIndices(
+		newTaggedTestNode(1, 9.93, 53.55, []int{0, 1}, []int{0, 1}),
+		&index.EncodedRelationFeature{
+			AbstractEncodedFeature: index.AbstractEncodedFeature{
+				ID:       2,
+				Geometry: &district,
+				Keys:     []int{0, 2, 3, 4},
+				Values:   []int{0, 0, 1, 0},
+			},
+		},
+		&index.EncodedRelationFeature{
+			AbstractEncodedFeature: index.AbstractEncodedFeature{
+				ID:       3,
+				Geometry: &quarter,
+				Keys:     []int{0, 2, 3, 4},
+				Values:   []int{0, 0, 0, 0},
+			},
+		},
+	)
+
+	// Act
+	defaultArea, defaultErr := ResolveArea("Altona", "", tagIndex, geomIndex)
+	quarterArea, quarterErr := ResolveArea("Altona", "10", tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNil(t, defaultErr)
+	common.AssertEqual(t, district, defaultArea)
+	common.AssertNil(t, quarterErr)
+	common.AssertEqual(t, quarter, quarterArea)
+}
+
+func TestResolveArea_ignoresNonAdministrativeBoundaries(t *testing.T) {
+	// Arrange
+	boundary := orb.MultiPolygon{orb.Bound{Min: orb.Point{9.8, 53.5}, Max: orb.Point{9.95, 53.6}}.ToPolygon()}
+	tagIndex, geomIndex := newPlaceTestIndices(
+		newTaggedTestNode(1, 9.93, 53.55, []int{0, 1}, []int{0, 1}),
+		&index.EncodedRelationFeature{
+			AbstractEncodedFeature: index.AbstractEncodedFeature{
+				ID:       2,
+				Geometry: &boundary,
+				Keys:     []int{0, 2, 4},
+				Values:   []int{0, 0, 1},
+			},
+		},
+	)
+
+	// Act
+	_, err := ResolveArea("Altona", "", tagIndex, geomIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertTrue(t, strings.Contains(err.Error(), "No administrative boundary named 'Altona'"))
+}
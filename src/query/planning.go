@@ -0,0 +1,147 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/index"
+	ownOsm "soq/osm"
+)
+
+// filterPlanner reorders the branches of AND and OR expressions. Cheap branches are always evaluated before
+// sub-statements, which need to read cells. Among equally expensive branches, the key statistics of the index (if
+// available) decide: The most selective branch comes first for AND expressions (most likely to be false) and the least
+// selective one for OR expressions (most likely to be true), so that the other branch is evaluated as rarely as
+// possible.
+type filterPlanner struct {
+	keyStatistics *index.KeyStatistics // Might be nil, in which case only the costs of the branches are considered.
+	objectType    ownOsm.OsmObjectType
+	cellExtent    *common.CellExtent // Nil means the whole index.
+}
+
+// planStatement reorders the filter of the given statement, its sub-statements and spatial join.
+func planStatement(statement Statement, geomIndex index.GeometryIndex, keyStatistics *index.KeyStatistics) {
+	planner := &filterPlanner{
+		keyStatistics: keyStatistics,
+		objectType:    statement.queryType.GetObjectType(),
+	}
+	var bbox *orb.Bound
+	switch location := statement.location.(type) {
+	case *BboxLocationExpression:
+		bbox = location.GetBbox()
+	case *AreaLocationExpression:
+		bbox = location.GetBbox()
+	case *AlongLocationExpression:
+		bbox = location.GetBbox()
+	}
+	if bbox != nil {
+		planner.cellExtent = &common.CellExtent{
+			geomIndex.GetCellIndexForCoordinate(bbox.Min.Lon(), bbox.Min.Lat()),
+			geomIndex.GetCellIndexForCoordinate(bbox.Max.Lon(), bbox.Max.Lat()),
+		}
+	}
+
+	planner.plan(statement.filter, geomIndex)
+
+	if statement.spatialJoin != nil {
+		planStatement(*statement.spatialJoin.statement, geomIndex, keyStatistics)
+	}
+}
+
+func (p *filterPlanner) plan(expression FilterExpression, geomIndex index.GeometryIndex) {
+	switch typedExpression := expression.(type) {
+	case *NegatedFilterExpression:
+		p.plan(typedExpression.baseExpression, geomIndex)
+	case *LogicalFilterExpression:
+		p.plan(typedExpression.statementA, geomIndex)
+		p.plan(typedExpression.statementB, geomIndex)
+		if p.shouldSwap(typedExpression) {
+			sigolo.Tracef("Swap branches of %s expression", typedExpression.operator.string())
+			typedExpression.statementA, typedExpression.statementB = typedExpression.statementB, typedExpression.statementA
+		}
+	case *SubStatementFilterExpression:
+		planStatement(*typedExpression.statement, geomIndex, p.keyStatistics)
+	}
+}
+
+// shouldSwap returns true when the second branch of the expression should be evaluated first.
+func (p *filterPlanner) shouldSwap(expression *LogicalFilterExpression) bool {
+	costA := filterCost(expression.statementA)
+	costB := filterCost(expression.statementB)
+	if costA != costB {
+		return costB < costA
+	}
+
+	selectivityA := p.estimateSelectivity(expression.statementA)
+	selectivityB := p.estimateSelectivity(expression.statementB)
+	if expression.operator == LogicOpAnd {
+		return selectivityB < selectivityA
+	}
+	return selectivityB > selectivityA
+}
+
+// estimateSelectivity returns the estimated share (between 0 and 1) of features matching the given expression.
+func (p *filterPlanner) estimateSelectivity(expression FilterExpression) float64 {
+	switch typedExpression := expression.(type) {
+	case *KeyFilterExpression:
+		share := p.estimateKeyShare(typedExpression.key)
+		if typedExpression.shouldBeSet {
+			return share
+		}
+		return 1 - share
+	case *KeyPrefixFilterExpression:
+		// Share of features having at least one of the keys, assuming the keys are independent
+		shareWithoutKeys := 1.0
+		for _, key := range typedExpression.keys {
+			shareWithoutKeys *= 1 - p.estimateKeyShare(key)
+		}
+		if typedExpression.shouldBeSet {
+			return 1 - shareWithoutKeys
+		}
+		return shareWithoutKeys
+	case *TagFilterExpression:
+		// Each operator requires the key to be set, the values aren't part of the statistics.
+		return p.estimateKeyShare(typedExpression.key)
+	case *ElevationFilterExpression:
+		return p.estimateKeyShare(typedExpression.key)
+	case *ValuePatternFilterExpression:
+		return p.estimateKeyShare(typedExpression.key)
+	case *IdFilterExpression:
+		return 0
+	case *NegatedFilterExpression:
+		return 1 - p.estimateSelectivity(typedExpression.baseExpression)
+	case *LogicalFilterExpression:
+		selectivityA := p.estimateSelectivity(typedExpression.statementA)
+		selectivityB := p.estimateSelectivity(typedExpression.statementB)
+		if typedExpression.operator == LogicOpAnd {
+			return selectivityA * selectivityB
+		}
+		return selectivityA + selectivityB - selectivityA*selectivityB
+	}
+	return 1
+}
+
+func (p *filterPlanner) estimateKeyShare(key int) float64 {
+	if p.keyStatistics == nil {
+		return 1
+	}
+	share, ok := p.keyStatistics.EstimateKeyShare(p.objectType, p.cellExtent, key)
+	if !ok {
+		return 1
+	}
+	return share
+}
+
+// filterCost returns the number of sub-statements within the expression. Other expressions only check the feature
+// itself and are therefore considered free compared to sub-statements, which need to read cells.
+func filterCost(expression FilterExpression) int {
+	switch typedExpression := expression.(type) {
+	case *SubStatementFilterExpression:
+		return 1 + filterCost(typedExpression.statement.filter)
+	case *NegatedFilterExpression:
+		return filterCost(typedExpression.baseExpression)
+	case *LogicalFilterExpression:
+		return filterCost(typedExpression.statementA) + filterCost(typedExpression.statementB)
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/index"
+	"soq/osm"
+	"testing"
+)
+
+func newPlanningTestIndex() *testGeometryIndex {
+	keyStatistics := index.NewKeyStatistics()
+	// Key 0 is set on almost all ways, key 1 only on a few.
+	keyStatistics.Add(osm.OsmObjWay, common.CellIndex{0, 0}, 100, map[int]int{0: 90, 1: 5})
+	return &testGeometryIndex{keyStatistics: keyStatistics}
+}
+
+func TestPlanStatement_andStartsWithMostSelectiveBranch(t *testing.T) {
+	// Arrange
+	geomIndex := newPlanningTestIndex()
+	commonKey := NewKeyFilterExpression(0, true)
+	rareKey := NewKeyFilterExpression(1, true)
+	filter := NewLogicalFilterExpression(commonKey, rareKey, LogicOpAnd)
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.5, 0.5}}), osm.OsmQueryWay, filter)
+
+	// Act
+	planStatement(*statement, geomIndex, geomIndex.keyStatistics)
+
+	// Assert
+	common.AssertEqual(t, rareKey, filter.statementA)
+	common.AssertEqual(t, commonKey, filter.statementB)
+}
+
+func TestPlanStatement_orStartsWithLeastSelectiveBranch(t *testing.T) {
+	// Arrange
+	geomIndex := newPlanningTestIndex()
+	commonKey := NewKeyFilterExpression(0, true)
+	rareKey := NewKeyFilterExpression(1, true)
+	filter := NewLogicalFilterExpression(rareKey, commonKey, LogicOpOr)
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.5, 0.5}}), osm.OsmQueryWay, filter)
+
+	// Act
+	planStatement(*statement, geomIndex, geomIndex.keyStatistics)
+
+	// Assert
+	common.AssertEqual(t, commonKey, filter.statementA)
+	common.AssertEqual(t, rareKey, filter.statementB)
+}
+
+func TestPlanStatement_subStatementsLast(t *testing.T) {
+	// Arrange
+	geomIndex := newPlanningTestIndex()
+	subStatement := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(1, true)))
+	commonKey := NewKeyFilterExpression(0, true)
+	filter := NewLogicalFilterExpression(subStatement, commonKey, LogicOpAnd)
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.5, 0.5}}), osm.OsmQueryWay, filter)
+
+	// Act
+	planStatement(*statement, geomIndex, geomIndex.keyStatistics)
+
+	// Assert
+	common.AssertEqual(t, commonKey, filter.statementA)
+	common.AssertEqual(t, subStatement, filter.statementB)
+}
+
+func TestPlanStatement_subStatementsLastWithoutKeyStatistics(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{}
+	cheapSubStatement := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(1, true)))
+	nestedSubStatement := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(1, true)))
+	expensiveSubStatement := NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryRelation, nestedSubStatement))
+	tagFilter := NewTagFilterExpression(0, 1, BinOpEqual)
+	subStatements := NewLogicalFilterExpression(expensiveSubStatement, cheapSubStatement, LogicOpOr)
+	filter := NewLogicalFilterExpression(subStatements, tagFilter, LogicOpAnd)
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.5, 0.5}}), osm.OsmQueryWay, filter)
+
+	// Act
+	planStatement(*statement, geomIndex, nil)
+
+	// Assert
+	common.AssertEqual(t, tagFilter, filter.statementA)
+	common.AssertEqual(t, subStatements, filter.statementB)
+	common.AssertEqual(t, cheapSubStatement, subStatements.statementA)
+	common.AssertEqual(t, expensiveSubStatement, subStatements.statementB)
+}
+
+func TestPlanStatement_keepsOrderWithoutKeyStatistics(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{}
+	keyFilterA := NewKeyFilterExpression(0, true)
+	keyFilterB := NewKeyFilterExpression(1, true)
+	filter := NewLogicalFilterExpression(keyFilterA, keyFilterB, LogicOpAnd)
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.5, 0.5}}), osm.OsmQueryWay, filter)
+
+	// Act
+	planStatement(*statement, geomIndex, nil)
+
+	// Assert
+	common.AssertEqual(t, keyFilterA, filter.statementA)
+	common.AssertEqual(t, keyFilterB, filter.statementB)
+}
@@ -1,41 +1,448 @@
 package query
 
 import (
+	"context"
 	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"slices"
+	"soq/common"
 	"soq/feature"
 	"soq/index"
+	"soq/osm"
 	"time"
 )
 
-var geometryIndex index.GeometryIndex
-
 type Query struct {
 	topLevelStatements []Statement
+	memoryBudget       *MemoryBudget
+	memoryAccountant   *common.MemoryAccountant
+	limits             Limits
+	context            context.Context
+	filterWorkers      int
+	failedAssertions   []error
+	statistics         []*ValueStatistics
+	introspection      *Introspection
+	time               *time.Time
+	tracing            bool
+	trace              *ExecutionTrace
+	distinct           bool
+	parsingWarnings    []string
 }
 
 func NewQuery(topLevelStatements []Statement) *Query {
-	return &Query{topLevelStatements: topLevelStatements}
+	return &Query{
+		topLevelStatements: topLevelStatements,
+		memoryBudget:       NewMemoryBudget(0),
+	}
+}
+
+// SetMemoryLimit sets the approximate amount of bytes this query is allowed to use for buffered features, caches and
+// its result. The execution is aborted with an error when this limit is exceeded. A limit of 0 means "unlimited".
+func (q *Query) SetMemoryLimit(limitInBytes int64) {
+	q.memoryBudget = NewMemoryBudget(limitInBytes)
+}
+
+// SetMemoryAccountant sets the process-wide accountant the sub-statement caches register with during an execution. The
+// accountant might clear these caches when the memory limit of the process is exceeded. Nil disables the accounting.
+func (q *Query) SetMemoryAccountant(accountant *common.MemoryAccountant) {
+	q.memoryAccountant = accountant
+}
+
+// SetLimits sets the limits of the execution time, query area, read cells and result features. Exceeding one of them aborts the
+// execution with a LimitExceededError.
+func (q *Query) SetLimits(limits Limits) {
+	q.limits = limits
+}
+
+// SetContext sets the context of the following executions. The execution is aborted with an ExecutionCancelledError
+// when the context is cancelled, e.g. because the client of a request disconnected. Nil means the execution can't be
+// cancelled.
+func (q *Query) SetContext(ctx context.Context) {
+	q.context = ctx
+}
+
+// SetFilterWorkers sets the number of goroutines filtering the cells of each top-level statement in parallel. A value
+// of 1 or less means sequential filtering. Statements with sub-statements are always filtered sequentially.
+func (q *Query) SetFilterWorkers(workers int) {
+	q.filterWorkers = workers
+}
+
+// SetTime sets the point in time this query is evaluated at, e.g. from an "at" clause. Only the feature versions valid
+// at this time are considered, which requires an index with history. Nil means the current state of the data.
+func (q *Query) SetTime(t *time.Time) {
+	q.time = t
+}
+
+// GetTime returns the point in time this query is evaluated at or nil for the current state of the data.
+func (q *Query) GetTime() *time.Time {
+	return q.time
+}
+
+// SetTracing enables or disables the execution trace of the following executions, s. GetExecutionTrace.
+func (q *Query) SetTracing(enabled bool) {
+	q.tracing = enabled
+}
+
+// SetDistinct enables that features returned by multiple top-level statements are only part of the result once. Features
+// are identified by their object type and ID, the first statement returning a feature determines its output (e.g. the
+// selected tags).
+func (q *Query) SetDistinct(distinct bool) {
+	q.distinct = distinct
+}
+
+func (q *Query) IsDistinct() bool {
+	return q.distinct
+}
+
+// SetParsingWarnings sets the warnings found while parsing this query, e.g. about keys not existing in the tag-index.
+// They're returned by GetWarnings in addition to the warnings of each execution.
+func (q *Query) SetParsingWarnings(warnings []string) {
+	q.parsingWarnings = warnings
+}
+
+// GetExecutionTrace returns the timings and cell counts of the statements of the last execution or nil when tracing
+// is disabled. For streamed results, the trace is complete once all features have been read.
+func (q *Query) GetExecutionTrace() *ExecutionTrace {
+	return q.trace
+}
+
+// GetMemoryBudget returns the budget tracking the memory usage of this query.
+func (q *Query) GetMemoryBudget() *MemoryBudget {
+	return q.memoryBudget
+}
+
+func (q *Query) GetTopLevelStatements() []Statement {
+	return q.topLevelStatements
+}
+
+// GetWarnings returns the warnings of parsing (s. SetParsingWarnings) and of the last execution, e.g. about corrupt
+// cells of the index that have been skipped. The result of an execution with warnings might be incomplete.
+func (q *Query) GetWarnings() []string {
+	return append(slices.Clone(q.parsingWarnings), q.memoryBudget.GetWarnings()...)
+}
+
+// GetFailedAssertions returns the errors of all assertions that failed during the last execution of this query.
+func (q *Query) GetFailedAssertions() []error {
+	return q.failedAssertions
 }
 
 func (q *Query) Execute(geomIndex index.GeometryIndex) ([]feature.Feature, error) {
-	// TODO Refactor this, since this is just a quick and dirty way to make sub-statement access the geometry index.
-	geometryIndex = geomIndex
+	err := q.prepareExecution(geomIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []feature.Feature
+	err = q.executeStatements(func(f feature.Feature) error {
+		err := q.memoryBudget.reserve(feature.EstimateSize(f))
+		if err != nil {
+			return err
+		}
+		result = append(result, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// prepareExecution checks the given index and resets the state of a previous execution.
+func (q *Query) prepareExecution(geomIndex index.GeometryIndex) error {
+	geomIndex = q.atQueryTime(geomIndex)
+
+	if q.IsIntrospection() {
+		return errors.New("Queries listing keys or values don't return features, they must be executed as introspection")
+	}
+
+	err := q.checkIndexCompatibility(geomIndex)
+	if err != nil {
+		return err
+	}
+
+	q.failedAssertions = nil
+	q.statistics = nil
+	q.trace = nil
+	if q.tracing {
+		q.trace = &ExecutionTrace{Statements: []*StatementTrace{}}
+	}
+	q.memoryBudget.startExecution(q.limits, q.context)
+
+	err = q.checkArea(geomIndex)
+	if err != nil {
+		return err
+	}
+
+	keyStatistics := geomIndex.GetKeyStatistics()
+
+	for i, statement := range q.topLevelStatements {
+		q.topLevelStatements[i].filterWorkers = q.filterWorkers
+		setGeometryIndexOnStatement(&q.topLevelStatements[i], geomIndex)
+		setMemoryBudgetOnStatement(statement, q.memoryBudget)
+		planStatement(statement, geomIndex, keyStatistics)
+		if statement.spatialJoin != nil {
+			// Use the current data and not the one of a previous execution
+			statement.spatialJoin.reset()
+		}
+	}
+
+	return nil
+}
 
+// executeStatements executes all top-level statements and passes their output features to the given function. The
+// assertions of the statements are checked on the way.
+func (q *Query) executeStatements(handleFeature func(feature.Feature) error) error {
 	sigolo.Info("Start query")
 	queryStartTime := time.Now()
 
-	var result []feature.Feature
+	unregisterCaches := q.registerSubStatementCaches()
+	defer unregisterCaches()
 
-	for _, statement := range q.topLevelStatements {
-		statementResult, err := statement.Execute(nil)
+	var distinct *distinctFilter
+	if q.distinct {
+		distinct = newDistinctFilter(q.memoryBudget)
+		defer distinct.release()
+	}
+
+	for i, statement := range q.topLevelStatements {
+		statementStartTime := time.Now()
+		if q.trace != nil {
+			statement.trace = newStatementTrace(i, statement)
+			q.trace.Statements = append(q.trace.Statements, statement.trace)
+		}
+
+		var statistics *ValueStatistics
+		if statement.statisticsKey != nil {
+			statistics = newValueStatistics(statement.statisticsKey.key, statement.statisticsKey.keyIndex)
+			q.statistics = append(q.statistics, statistics)
+		}
+
+		numberOfFeatures := 0
+		err := statement.Stream(nil, q.memoryBudget, func(f feature.Feature) error {
+			if statistics != nil {
+				// Aggregated features are not part of the result
+				statistics.add(f)
+				numberOfFeatures++
+				return nil
+			}
+
+			// Assertions check the result of the statement itself, which includes features of earlier statements.
+			numberOfFeatures++
+			if distinct != nil {
+				isDuplicate, err := distinct.isDuplicate(f)
+				if err != nil || isDuplicate {
+					return err
+				}
+			}
+
+			err := q.memoryBudget.addResultFeature()
+			if err != nil {
+				return err
+			}
+			return handleFeature(statement.applyOutputModifiersToFeature(f))
+		})
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		if statement.trace != nil {
+			statement.trace.DurationMs = durationToMs(time.Since(statementStartTime))
+		}
+
+		if statement.assertion != nil {
+			err = statement.assertion.Check(numberOfFeatures)
+			if err != nil {
+				sigolo.Errorf("%s", err.Error())
+				q.failedAssertions = append(q.failedAssertions, err)
+			}
 		}
-		result = append(result, statementResult...)
 	}
 
 	queryDuration := time.Since(queryStartTime)
+	if q.trace != nil {
+		q.trace.DurationMs = durationToMs(queryDuration)
+	}
 	sigolo.Infof("Executed query in %s", queryDuration)
+	sigolo.Debugf("Query used ~%d MB memory at peak", q.memoryBudget.GetPeakBytes()/1024/1024)
 
-	return result, nil
+	return nil
+}
+
+// checkIndexCompatibility returns an error when the query needs data that is not part of the given index.
+func (q *Query) checkIndexCompatibility(geomIndex index.GeometryIndex) error {
+	metadata := geomIndex.GetMetadata()
+	if q.time != nil && (metadata == nil || !metadata.History) {
+		return errors.New("The query selects a point in time with 'at', but the index doesn't contain the history of the data. Import a full-history file with the history option (--history) to use such queries.")
+	}
+
+	if metadata == nil || !metadata.UntaggedNodesSkipped {
+		return nil
+	}
+
+	for _, statement := range q.topLevelStatements {
+		if statementMayMatchUntaggedNodes(statement) {
+			return errors.New("The index does not contain untagged nodes (they were skipped during the import), but a nodes-statement of this query might match untagged nodes (e.g. due to '!=*', negations, ID filters or sub-statements). Import the data again without the flag to skip untagged nodes to use such queries.")
+		}
+	}
+
+	return nil
+}
+
+// atQueryTime returns the view of the given index at the time of this query (s. SetTime). Indices with history are
+// viewed at the current time when the query has no time, so that they only return the current version of each object.
+func (q *Query) atQueryTime(geomIndex index.GeometryIndex) index.GeometryIndex {
+	metadata := geomIndex.GetMetadata()
+	if metadata == nil || !metadata.History {
+		return geomIndex
+	}
+	if q.time == nil {
+		return geomIndex.At(time.Now())
+	}
+	return geomIndex.At(*q.time)
+}
+
+// statementMayMatchUntaggedNodes returns true when the given statement or any of its sub-statements might return
+// untagged nodes.
+func statementMayMatchUntaggedNodes(statement Statement) bool {
+	if statement.queryType == osm.OsmQueryNode {
+		mayMatch, _ := matchesUntaggedNodes(statement.filter)
+		if mayMatch {
+			return true
+		}
+	}
+
+	if statement.spatialJoin != nil && statementMayMatchUntaggedNodes(*statement.spatialJoin.statement) {
+		return true
+	}
+
+	return subStatementsMayMatchUntaggedNodes(statement.filter)
+}
+
+func subStatementsMayMatchUntaggedNodes(expression FilterExpression) bool {
+	switch typedExpression := expression.(type) {
+	case *NegatedFilterExpression:
+		return subStatementsMayMatchUntaggedNodes(typedExpression.baseExpression)
+	case *LogicalFilterExpression:
+		return subStatementsMayMatchUntaggedNodes(typedExpression.statementA) || subStatementsMayMatchUntaggedNodes(typedExpression.statementB)
+	case *SubStatementFilterExpression:
+		return statementMayMatchUntaggedNodes(*typedExpression.statement)
+	}
+	return false
+}
+
+// matchesUntaggedNodes determines whether the given expression might apply (first return value) or always applies
+// (second return value) to nodes without tags. ID filters and sub-statements depend on the concrete node, so they might
+// but not always apply.
+func matchesUntaggedNodes(expression FilterExpression) (bool, bool) {
+	switch typedExpression := expression.(type) {
+	case *TagFilterExpression, *ValuePatternFilterExpression, *ElevationFilterExpression, *ClosedFilterExpression, *AreaFilterExpression:
+		return false, false
+	case *KeyFilterExpression:
+		return !typedExpression.shouldBeSet, !typedExpression.shouldBeSet
+	case *KeyPrefixFilterExpression:
+		return !typedExpression.shouldBeSet, !typedExpression.shouldBeSet
+	case *NegatedFilterExpression:
+		mayMatch, alwaysMatches := matchesUntaggedNodes(typedExpression.baseExpression)
+		return !alwaysMatches, !mayMatch
+	case *LogicalFilterExpression:
+		mayMatchA, alwaysMatchesA := matchesUntaggedNodes(typedExpression.statementA)
+		mayMatchB, alwaysMatchesB := matchesUntaggedNodes(typedExpression.statementB)
+		if typedExpression.operator == LogicOpAnd {
+			return mayMatchA && mayMatchB, alwaysMatchesA && alwaysMatchesB
+		}
+		return mayMatchA || mayMatchB, alwaysMatchesA || alwaysMatchesB
+	}
+
+	// ID filters, sub-statements and unknown expressions
+	return true, false
+}
+
+// setGeometryIndexOnStatement lets the given statement, its sub-statements and its spatial join read their features
+// from the given index. Each execution sets the index again, since it might be a different view (s. atQueryTime) or a
+// newly loaded index.
+func setGeometryIndexOnStatement(statement *Statement, geomIndex index.GeometryIndex) {
+	statement.geometryIndex = geomIndex
+	setGeometryIndexOnSubStatements(statement.filter, geomIndex)
+	if statement.spatialJoin != nil {
+		setGeometryIndexOnStatement(statement.spatialJoin.statement, geomIndex)
+	}
+}
+
+// setGeometryIndexOnSubStatements walks through the given expression tree and lets all sub-statements read their
+// features from the given index.
+func setGeometryIndexOnSubStatements(expression FilterExpression, geomIndex index.GeometryIndex) {
+	switch typedExpression := expression.(type) {
+	case *NegatedFilterExpression:
+		setGeometryIndexOnSubStatements(typedExpression.baseExpression, geomIndex)
+	case *LogicalFilterExpression:
+		setGeometryIndexOnSubStatements(typedExpression.statementA, geomIndex)
+		setGeometryIndexOnSubStatements(typedExpression.statementB, geomIndex)
+	case *SubStatementFilterExpression:
+		setGeometryIndexOnStatement(typedExpression.statement, geomIndex)
+	}
+}
+
+// setMemoryBudgetOnStatement lets all sub-statements of the given statement and its spatial join use the given budget.
+func setMemoryBudgetOnStatement(statement Statement, budget *MemoryBudget) {
+	setMemoryBudgetOnSubStatements(statement.filter, budget)
+	if statement.spatialJoin != nil {
+		setMemoryBudgetOnStatement(*statement.spatialJoin.statement, budget)
+	}
+}
+
+// setMemoryBudgetOnSubStatements walks through the given expression tree and lets all sub-statement expressions use the
+// given budget for their caches.
+func setMemoryBudgetOnSubStatements(expression FilterExpression, budget *MemoryBudget) {
+	switch typedExpression := expression.(type) {
+	case *NegatedFilterExpression:
+		setMemoryBudgetOnSubStatements(typedExpression.baseExpression, budget)
+	case *LogicalFilterExpression:
+		setMemoryBudgetOnSubStatements(typedExpression.statementA, budget)
+		setMemoryBudgetOnSubStatements(typedExpression.statementB, budget)
+	case *SubStatementFilterExpression:
+		typedExpression.memoryBudget = budget
+		setMemoryBudgetOnSubStatements(typedExpression.statement.filter, budget)
+	}
+}
+
+// registerSubStatementCaches registers the caches of all sub-statements at the memory accountant of this query. The
+// returned function unregisters them again and must be called after the execution.
+func (q *Query) registerSubStatementCaches() func() {
+	var expressions []*SubStatementFilterExpression
+	for _, statement := range q.topLevelStatements {
+		expressions = append(expressions, getSubStatementExpressionsOfStatement(statement)...)
+	}
+
+	for _, expression := range expressions {
+		expression.registerAt(q.memoryAccountant)
+	}
+
+	return func() {
+		for _, expression := range expressions {
+			expression.unregister()
+		}
+	}
+}
+
+// getSubStatementExpressionsOfStatement returns all sub-statement expressions of the given statement and its spatial
+// join, including nested ones.
+func getSubStatementExpressionsOfStatement(statement Statement) []*SubStatementFilterExpression {
+	expressions := getSubStatementExpressions(statement.filter)
+	if statement.spatialJoin != nil {
+		expressions = append(expressions, getSubStatementExpressionsOfStatement(*statement.spatialJoin.statement)...)
+	}
+	return expressions
+}
+
+func getSubStatementExpressions(expression FilterExpression) []*SubStatementFilterExpression {
+	switch typedExpression := expression.(type) {
+	case *NegatedFilterExpression:
+		return getSubStatementExpressions(typedExpression.baseExpression)
+	case *LogicalFilterExpression:
+		return append(getSubStatementExpressions(typedExpression.statementA), getSubStatementExpressions(typedExpression.statementB)...)
+	case *SubStatementFilterExpression:
+		return append([]*SubStatementFilterExpression{typedExpression}, getSubStatementExpressionsOfStatement(*typedExpression.statement)...)
+	}
+	return nil
 }
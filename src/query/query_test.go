@@ -0,0 +1,180 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"soq/osm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuery_checkIndexCompatibility_untaggedNodesSkipped(t *testing.T) {
+	// Arrange
+	bbox := NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}})
+	geomIndex := &testGeometryIndex{}
+	geomIndex.metadata.UntaggedNodesSkipped = true
+
+	taggedNodesQuery := NewQuery([]Statement{*NewStatement(bbox, osm.OsmQueryNode, NewKeyFilterExpression(0, true))})
+	negatedTaggedNodesQuery := NewQuery([]Statement{*NewStatement(bbox, osm.OsmQueryNode, NewNegatedFilterExpression(NewKeyFilterExpression(0, true)))})
+	idNodesQuery := NewQuery([]Statement{*NewStatement(bbox, osm.OsmQueryNode, NewLogicalFilterExpression(NewKeyFilterExpression(0, true), NewIdFilterExpression(1, BinOpEqual), LogicOpOr))})
+	waysQuery := NewQuery([]Statement{*NewStatement(bbox, osm.OsmQueryWay, NewKeyFilterExpression(0, false))})
+	subStatementQuery := NewQuery([]Statement{*NewStatement(bbox, osm.OsmQueryWay, NewSubStatementFilterExpression(NewStatement(NewContextAwareLocationExpression(), osm.OsmQueryNode, NewKeyFilterExpression(0, false))))})
+
+	// Act & Assert
+	common.AssertNil(t, taggedNodesQuery.checkIndexCompatibility(geomIndex))
+	common.AssertNotNil(t, negatedTaggedNodesQuery.checkIndexCompatibility(geomIndex))
+	common.AssertNotNil(t, idNodesQuery.checkIndexCompatibility(geomIndex))
+	common.AssertNil(t, waysQuery.checkIndexCompatibility(geomIndex))
+	common.AssertNotNil(t, subStatementQuery.checkIndexCompatibility(geomIndex))
+}
+
+func TestQuery_ExecutePage_selectedTags(t *testing.T) {
+	// Arrange
+	node := newTestNode(1, 0.5, 0.5)
+	node.Keys = []int{0, 1, 2}
+	node.Values = []int{3, 4, 5}
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {node},
+		},
+	}
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	statement.SetSelectedKeys([]int{2, 1})
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	features, _, err := q.ExecutePage(geomIndex, nil, 10)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 1, len(features))
+	common.AssertEqual(t, []int{1, 2}, features[0].GetKeys())
+	common.AssertEqual(t, []int{4, 5}, features[0].GetValues())
+	common.AssertEqual(t, []int{0, 1, 2}, node.GetKeys())
+}
+
+func TestQuery_Execute_atTime(t *testing.T) {
+	// Arrange
+	oldVersion := newTestNode(1, 0.5, 0.5)
+	oldVersion.Validity = &feature.Validity{From: 100, To: 200}
+	currentVersion := newTestNode(1, 0.6, 0.6)
+	currentVersion.Validity = &feature.Validity{From: 200, To: feature.ValidForever}
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {oldVersion, currentVersion},
+		},
+	}
+	geomIndex.metadata.History = true
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewIdFilterExpression(1, BinOpEqual))
+	q := NewQuery([]Statement{*statement})
+
+	// Act & Assert
+	features, err := q.Execute(geomIndex)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []feature.Feature{currentVersion}, features)
+
+	queryTime := time.Unix(150, 0)
+	q.SetTime(&queryTime)
+	features, err = q.Execute(geomIndex)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []feature.Feature{oldVersion}, features)
+
+	queryTimeBeforeFirstVersion := time.Unix(50, 0)
+	q.SetTime(&queryTimeBeforeFirstVersion)
+	features, err = q.Execute(geomIndex)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(features))
+}
+
+func TestQuery_checkIndexCompatibility_atTimeWithoutHistory(t *testing.T) {
+	// Arrange
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	q := NewQuery([]Statement{*statement})
+	queryTime := time.Unix(150, 0)
+	q.SetTime(&queryTime)
+
+	// Act & Assert
+	common.AssertNotNil(t, q.checkIndexCompatibility(&testGeometryIndex{}))
+
+	geomIndex := &testGeometryIndex{}
+	geomIndex.metadata.History = true
+	common.AssertNil(t, q.checkIndexCompatibility(geomIndex))
+}
+
+func TestQuery_Execute_distinct(t *testing.T) {
+	// Arrange
+	nodeA := newTaggedTestNode(1, 0.5, 0.5, []int{0}, []int{0})
+	nodeB := newTaggedTestNode(2, 0.6, 0.6, []int{0, 1}, []int{0, 0})
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {nodeA, nodeB},
+		},
+	}
+	bbox := &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}
+	statementA := NewStatement(NewBboxLocationExpression(bbox), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	statementB := NewStatement(NewBboxLocationExpression(bbox), osm.OsmQueryNode, NewKeyFilterExpression(1, true))
+	q := NewQuery([]Statement{*statementA, *statementB})
+
+	// Act & Assert
+	features, err := q.Execute(geomIndex)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []feature.Feature{nodeA, nodeB, nodeB}, features)
+
+	q.SetDistinct(true)
+	features, err = q.Execute(geomIndex)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []feature.Feature{nodeA, nodeB}, features)
+
+	_, _, err = q.ExecutePage(geomIndex, nil, 10)
+	common.AssertNotNil(t, err)
+}
+
+func TestQuery_Execute_corruptCellSkipped(t *testing.T) {
+	// Arrange
+	nodeA := newTaggedTestNode(1, 0.5, 0.5, []int{0}, []int{0})
+	nodeB := newTaggedTestNode(2, 1.5, 0.5, []int{0}, []int{0})
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {nodeA},
+			{1, 0}: {nodeB},
+		},
+		corruptCells: map[common.CellIndex]bool{{1, 0}: true},
+	}
+	bbox := &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.9, 0.9}}
+	statement := NewStatement(NewBboxLocationExpression(bbox), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	q := NewQuery([]Statement{*statement, *statement})
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []feature.Feature{nodeA, nodeA}, features)
+	common.AssertEqual(t, 1, len(q.GetWarnings()))
+	common.AssertTrue(t, strings.Contains(q.GetWarnings()[0], "1/0.cell"))
+}
+
+func TestQuery_Execute_cellReadErrorReturned(t *testing.T) {
+	// Arrange
+	nodeA := newTaggedTestNode(1, 0.5, 0.5, []int{0}, []int{0})
+	nodeB := newTaggedTestNode(2, 1.5, 0.5, []int{0}, []int{0})
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {nodeA},
+			{1, 0}: {nodeB},
+		},
+		failingCells: map[common.CellIndex]bool{{1, 0}: true},
+	}
+	bbox := &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.9, 0.9}}
+	statement := NewStatement(NewBboxLocationExpression(bbox), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertEqual(t, 0, len(features))
+}
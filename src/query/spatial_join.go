@@ -0,0 +1,407 @@
+package query
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/orb/project"
+	"math"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+)
+
+type SpatialOperator int
+
+const (
+	SpatialOpWithin SpatialOperator = iota
+	SpatialOpContains
+	SpatialOpIntersects
+	SpatialOpNear
+)
+
+// metersPerDegree is the approximate length of one degree latitude (and longitude at the equator) in meters.
+const metersPerDegree = 111_320.0
+
+func (o SpatialOperator) String() string {
+	switch o {
+	case SpatialOpWithin:
+		return "within"
+	case SpatialOpContains:
+		return "contains"
+	case SpatialOpIntersects:
+		return "intersects"
+	case SpatialOpNear:
+		return "near"
+	}
+	return "[!UNKNOWN SpatialOperator]"
+}
+
+// SpatialJoin restricts the features of a statement to the ones having a spatial relation to at least one feature of
+// another statement, e.g. "... within bbox(...).ways{ landuse=park }". Only features sharing a cell are compared.
+type SpatialJoin struct {
+	operator  SpatialOperator
+	statement *Statement
+	// Maximum distance in meters for the "near" operator.
+	distance float64
+
+	// Features of the other statement by the cells they cover. For the "near" operator, this includes all cells within
+	// the distance around the feature. This is nil until the join has been prepared.
+	featuresByCell map[common.CellIndex][]feature.Feature
+}
+
+func NewSpatialJoin(operator SpatialOperator, statement *Statement) *SpatialJoin {
+	return &SpatialJoin{
+		operator:  operator,
+		statement: statement,
+	}
+}
+
+// NewNearSpatialJoin creates a join for features having a distance of at most the given meters to at least one feature
+// of the other statement.
+func NewNearSpatialJoin(distance float64, statement *Statement) *SpatialJoin {
+	return &SpatialJoin{
+		operator:  SpatialOpNear,
+		statement: statement,
+		distance:  distance,
+	}
+}
+
+func (j *SpatialJoin) GetOperator() SpatialOperator {
+	return j.operator
+}
+
+func (j *SpatialJoin) GetStatement() *Statement {
+	return j.statement
+}
+
+func (j *SpatialJoin) GetDistance() float64 {
+	return j.distance
+}
+
+// prepare executes the other statement and stores its features by cell. This only happens once, so that pages of a
+// paginated query don't execute the other statement again.
+func (j *SpatialJoin) prepare(budget *MemoryBudget) error {
+	if j.featuresByCell != nil {
+		return nil
+	}
+
+	features, err := j.statement.Execute(nil, budget)
+	if err != nil {
+		return err
+	}
+
+	// Ways and relations are stored in each cell they cover and are therefore part of the result multiple times.
+	seenIds := map[uint64]bool{}
+	j.featuresByCell = map[common.CellIndex][]feature.Feature{}
+	for _, f := range features {
+		if seenIds[f.GetID()] {
+			continue
+		}
+		seenIds[f.GetID()] = true
+
+		for _, cell := range getCoveredCellsWithinDistance(j.statement.geometryIndex, f.GetGeometry(), j.distance) {
+			j.featuresByCell[cell] = append(j.featuresByCell[cell], f)
+		}
+	}
+
+	sigolo.Debugf("Prepared spatial join with %d features in %d cells", len(seenIds), len(j.featuresByCell))
+	return nil
+}
+
+// reset removes the prepared features, so that the next execution uses the current data.
+func (j *SpatialJoin) reset() {
+	j.featuresByCell = nil
+}
+
+// matches returns true when the given feature has the spatial relation of this join to at least one feature of the
+// other statement. The join must have been prepared.
+func (j *SpatialJoin) matches(f feature.Feature) bool {
+	geometry := index.DereferenceGeometry(f.GetGeometry())
+	if geometry == nil {
+		return false
+	}
+
+	for _, cell := range getCoveredCells(j.statement.geometryIndex, geometry) {
+		for _, otherFeature := range j.featuresByCell[cell] {
+			otherGeometry := index.DereferenceGeometry(otherFeature.GetGeometry())
+			if otherGeometry != nil && j.relationApplies(geometry, otherGeometry) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (j *SpatialJoin) relationApplies(a orb.Geometry, b orb.Geometry) bool {
+	if j.operator == SpatialOpNear {
+		return distanceInMeters(a, b) <= j.distance
+	}
+	return spatialRelationApplies(j.operator, a, b)
+}
+
+func (j *SpatialJoin) Print(indent int) {
+	operator := j.operator.String()
+	if j.operator == SpatialOpNear {
+		operator = fmt.Sprintf("%s(%gm)", operator, j.distance)
+	}
+	sigolo.Debugf("%sspatial join: %s", spacing(indent), operator)
+	j.statement.Print(indent + 2)
+}
+
+// getCoveredCells returns the cells of the given index covered by the bbox of the given geometry.
+func getCoveredCells(geomIndex index.GeometryIndex, geometry orb.Geometry) []common.CellIndex {
+	if geometry == nil {
+		return nil
+	}
+	bound := geometry.Bound()
+	minCell := geomIndex.GetCellIndexForCoordinate(bound.Min.Lon(), bound.Min.Lat())
+	maxCell := geomIndex.GetCellIndexForCoordinate(bound.Max.Lon(), bound.Max.Lat())
+	return common.CellExtent{minCell, maxCell}.GetCellIndices()
+}
+
+// getCoveredCellsWithinDistance returns the cells covered by the bbox of the given geometry extended by the given
+// distance in meters. Each feature within this distance around the geometry lies at least partially in these cells.
+func getCoveredCellsWithinDistance(geomIndex index.GeometryIndex, geometry orb.Geometry, distance float64) []common.CellIndex {
+	if geometry == nil || distance <= 0 {
+		return getCoveredCells(geomIndex, geometry)
+	}
+
+	return getCoveredCells(geomIndex, extendBound(geometry.Bound(), distance))
+}
+
+// extendBound returns the given bound extended by the given distance in meters in each direction.
+func extendBound(bound orb.Bound, distance float64) orb.Bound {
+	// Longitudes get closer the further away from the equator, so the latitude closest to a pole is used.
+	maxAbsLat := math.Min(math.Max(math.Abs(bound.Min.Lat()), math.Abs(bound.Max.Lat())), 89)
+	latDistance := distance / metersPerDegree
+	lonDistance := distance / (metersPerDegree * math.Cos(maxAbsLat*math.Pi/180))
+
+	return orb.Bound{
+		Min: orb.Point{bound.Min.Lon() - lonDistance, bound.Min.Lat() - latDistance},
+		Max: orb.Point{bound.Max.Lon() + lonDistance, bound.Max.Lat() + latDistance},
+	}
+}
+
+// spatialRelationApplies checks whether geometry a has the spatial relation to geometry b, e.g. a is within b.
+func spatialRelationApplies(operator SpatialOperator, a orb.Geometry, b orb.Geometry) bool {
+	switch operator {
+	case SpatialOpWithin:
+		return isWithin(a, b)
+	case SpatialOpContains:
+		return isWithin(b, a)
+	case SpatialOpIntersects:
+		return intersects(a, b)
+	}
+	return false
+}
+
+// distanceInMeters returns the approximate shortest distance between the two geometries in meters. Both geometries are
+// projected onto a plane around the latitude of geometry a, which is accurate enough for short distances. The distance
+// is 0 when the geometries intersect.
+func distanceInMeters(a orb.Geometry, b orb.Geometry) float64 {
+	if intersects(a, b) {
+		return 0
+	}
+
+	lonScale := metersPerDegree * math.Cos(a.Bound().Center().Lat()*math.Pi/180)
+	toMeters := func(point orb.Point) orb.Point {
+		return orb.Point{point.Lon() * lonScale, point.Lat() * metersPerDegree}
+	}
+	projectedA := project.Geometry(orb.Clone(a), toMeters)
+	projectedB := project.Geometry(orb.Clone(b), toMeters)
+
+	// Geometries not intersecting each other have their shortest distance between a vertex of one geometry and the
+	// other geometry.
+	distance := math.Inf(1)
+	for _, point := range getVertices(projectedA) {
+		distance = math.Min(distance, planar.DistanceFrom(projectedB, point))
+	}
+	for _, point := range getVertices(projectedB) {
+		distance = math.Min(distance, planar.DistanceFrom(projectedA, point))
+	}
+	return distance
+}
+
+// isWithin returns true when all vertices of geometry a are within the area of geometry b and the boundaries don't
+// cross each other. Geometries without an area (points and non-closed lines) can't contain anything.
+func isWithin(a orb.Geometry, b orb.Geometry) bool {
+	area, isArea := toArea(b)
+	if !isArea || !area.Bound().Contains(a.Bound().Min) || !area.Bound().Contains(a.Bound().Max) {
+		return false
+	}
+
+	for _, point := range getVertices(a) {
+		if !areaContains(area, point) {
+			return false
+		}
+	}
+
+	for _, segmentA := range getSegments(a) {
+		for _, segmentB := range getSegments(area) {
+			if segmentsCross(segmentA, segmentB) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// intersects returns true when the two geometries share at least one point.
+func intersects(a orb.Geometry, b orb.Geometry) bool {
+	if !a.Bound().Intersects(b.Bound()) {
+		return false
+	}
+
+	if areaOfBContainsVertexOfA(a, b) || areaOfBContainsVertexOfA(b, a) {
+		return true
+	}
+
+	for _, segmentA := range getSegments(a) {
+		for _, segmentB := range getSegments(b) {
+			if segmentsIntersect(segmentA, segmentB) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func areaOfBContainsVertexOfA(a orb.Geometry, b orb.Geometry) bool {
+	area, isArea := toArea(b)
+	if !isArea {
+		return false
+	}
+
+	for _, point := range getVertices(a) {
+		if areaContains(area, point) {
+			return true
+		}
+	}
+	return false
+}
+
+// toArea returns the area of polygons, multipolygons and closed line strings (e.g. closed ways like parks).
+func toArea(geometry orb.Geometry) (orb.Geometry, bool) {
+	switch typedGeometry := geometry.(type) {
+	case orb.Polygon, orb.MultiPolygon:
+		return typedGeometry, true
+	case orb.LineString:
+		if len(typedGeometry) >= 4 && orb.Ring(typedGeometry).Closed() {
+			return orb.Polygon{orb.Ring(typedGeometry)}, true
+		}
+	}
+	return nil, false
+}
+
+func areaContains(area orb.Geometry, point orb.Point) bool {
+	switch typedArea := area.(type) {
+	case orb.Polygon:
+		return planar.PolygonContains(typedArea, point)
+	case orb.MultiPolygon:
+		return planar.MultiPolygonContains(typedArea, point)
+	}
+	return false
+}
+
+func getVertices(geometry orb.Geometry) []orb.Point {
+	switch typedGeometry := geometry.(type) {
+	case orb.Point:
+		return []orb.Point{typedGeometry}
+	case orb.LineString:
+		return typedGeometry
+	case orb.Polygon:
+		var points []orb.Point
+		for _, ring := range typedGeometry {
+			points = append(points, ring...)
+		}
+		return points
+	case orb.MultiPolygon:
+		var points []orb.Point
+		for _, polygon := range typedGeometry {
+			points = append(points, getVertices(polygon)...)
+		}
+		return points
+	}
+	return nil
+}
+
+// getSegments returns all line segments of the geometry. A point is a segment with the same start and end point.
+func getSegments(geometry orb.Geometry) [][2]orb.Point {
+	switch typedGeometry := geometry.(type) {
+	case orb.Point:
+		return [][2]orb.Point{{typedGeometry, typedGeometry}}
+	case orb.LineString:
+		return getLineSegments(typedGeometry)
+	case orb.Polygon:
+		var segments [][2]orb.Point
+		for _, ring := range typedGeometry {
+			segments = append(segments, getLineSegments(ring)...)
+		}
+		return segments
+	case orb.MultiPolygon:
+		var segments [][2]orb.Point
+		for _, polygon := range typedGeometry {
+			segments = append(segments, getSegments(polygon)...)
+		}
+		return segments
+	}
+	return nil
+}
+
+func getLineSegments(points []orb.Point) [][2]orb.Point {
+	var segments [][2]orb.Point
+	for i := 1; i < len(points); i++ {
+		segments = append(segments, [2]orb.Point{points[i-1], points[i]})
+	}
+	return segments
+}
+
+// segmentsIntersect returns true when the segments share at least one point, which includes touching segments.
+func segmentsIntersect(a [2]orb.Point, b [2]orb.Point) bool {
+	o1 := orientation(a[0], a[1], b[0])
+	o2 := orientation(a[0], a[1], b[1])
+	o3 := orientation(b[0], b[1], a[0])
+	o4 := orientation(b[0], b[1], a[1])
+
+	if o1 != o2 && o3 != o4 {
+		return true
+	}
+
+	// Collinear cases, in which one end point lies on the other segment
+	return o1 == 0 && isOnSegment(a[0], b[0], a[1]) ||
+		o2 == 0 && isOnSegment(a[0], b[1], a[1]) ||
+		o3 == 0 && isOnSegment(b[0], a[0], b[1]) ||
+		o4 == 0 && isOnSegment(b[0], a[1], b[1])
+}
+
+// segmentsCross returns true when the segments properly cross each other. Touching segments don't cross.
+func segmentsCross(a [2]orb.Point, b [2]orb.Point) bool {
+	o1 := orientation(a[0], a[1], b[0])
+	o2 := orientation(a[0], a[1], b[1])
+	o3 := orientation(b[0], b[1], a[0])
+	o4 := orientation(b[0], b[1], a[1])
+	return o1*o2 < 0 && o3*o4 < 0
+}
+
+// orientation returns 1 for a counter-clockwise turn from p over q to r, -1 for a clockwise turn and 0 when the points
+// are collinear.
+func orientation(p orb.Point, q orb.Point, r orb.Point) int {
+	value := (q.Lon()-p.Lon())*(r.Lat()-p.Lat()) - (q.Lat()-p.Lat())*(r.Lon()-p.Lon())
+	if value > 0 {
+		return 1
+	} else if value < 0 {
+		return -1
+	}
+	return 0
+}
+
+// isOnSegment returns true when the collinear point q lies on the segment from p to r.
+func isOnSegment(p orb.Point, q orb.Point, r orb.Point) bool {
+	return q.Lon() <= max(p.Lon(), r.Lon()) && q.Lon() >= min(p.Lon(), r.Lon()) &&
+		q.Lat() <= max(p.Lat(), r.Lat()) && q.Lat() >= min(p.Lat(), r.Lat())
+}
@@ -0,0 +1,137 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	ownOsm "soq/osm"
+	"testing"
+)
+
+func TestSpatialRelationApplies(t *testing.T) {
+	// Arrange
+	square := orb.Polygon{{{0, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}}
+	closedWay := orb.LineString{{0, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}
+	innerLine := orb.LineString{{0.5, 0.5}, {1.5, 1.5}}
+	crossingLine := orb.LineString{{1, 1}, {3, 1}}
+	outerLine := orb.LineString{{3, 0}, {3, 2}}
+	concavePolygon := orb.Polygon{{{0, 0}, {3, 0}, {3, 3}, {2, 3}, {2, 1}, {1, 1}, {1, 3}, {0, 3}, {0, 0}}}
+	lineThroughConcaveGap := orb.LineString{{0.5, 2}, {2.5, 2}}
+
+	// Act & Assert
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpWithin, orb.Point{1, 1}, square))
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpWithin, orb.Point{1, 1}, closedWay))
+	common.AssertFalse(t, spatialRelationApplies(SpatialOpWithin, orb.Point{3, 1}, square))
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpWithin, innerLine, square))
+	common.AssertFalse(t, spatialRelationApplies(SpatialOpWithin, crossingLine, square))
+	common.AssertFalse(t, spatialRelationApplies(SpatialOpWithin, lineThroughConcaveGap, concavePolygon))
+	common.AssertFalse(t, spatialRelationApplies(SpatialOpWithin, orb.Point{1, 1}, innerLine))
+
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpContains, square, orb.Point{1, 1}))
+	common.AssertFalse(t, spatialRelationApplies(SpatialOpContains, orb.Point{1, 1}, square))
+
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpIntersects, crossingLine, square))
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpIntersects, innerLine, square))
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpIntersects, orb.Point{1, 1}, innerLine))
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpIntersects, orb.Point{1, 1}, orb.Point{1, 1}))
+	common.AssertTrue(t, spatialRelationApplies(SpatialOpIntersects, crossingLine, outerLine))
+	common.AssertFalse(t, spatialRelationApplies(SpatialOpIntersects, outerLine, square))
+	common.AssertFalse(t, spatialRelationApplies(SpatialOpIntersects, orb.Point{1, 0.5}, innerLine))
+}
+
+func TestQuery_Execute_spatialJoin(t *testing.T) {
+	// Arrange
+	park := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       10,
+			Geometry: &orb.LineString{{0.5, 0.5}, {1.5, 0.5}, {1.5, 1.5}, {0.5, 1.5}, {0.5, 0.5}},
+			Keys:     []int{1},
+			Values:   []int{0},
+		},
+	}
+	benchInPark := newTestNode(1, 1.2, 1.2)
+	benchInPark.Keys, benchInPark.Values = []int{0}, []int{0}
+	benchOutsidePark := newTestNode(2, 1.8, 1.8)
+	benchOutsidePark.Keys, benchOutsidePark.Values = []int{0}, []int{0}
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {park},
+			{1, 0}: {park},
+			{0, 1}: {park},
+			{1, 1}: {park, benchInPark, benchOutsidePark},
+		},
+	}
+
+	bbox := &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.9, 1.9}}
+	parkStatement := NewStatement(NewBboxLocationExpression(bbox), ownOsm.OsmQueryWay, NewKeyFilterExpression(1, true))
+	benchStatement := NewStatement(NewBboxLocationExpression(bbox), ownOsm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	benchStatement.SetSpatialJoin(NewSpatialJoin(SpatialOpWithin, parkStatement))
+	q := NewQuery([]Statement{*benchStatement})
+
+	// Act
+	features, err := q.Execute(geomIndex)
+	pagedFeatures, cursor, pageErr := q.ExecutePage(geomIndex, nil, 10)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []uint64{1}, getIds(features))
+	common.AssertNil(t, pageErr)
+	common.AssertEqual(t, []uint64{1}, getIds(pagedFeatures))
+	common.AssertNil(t, cursor)
+}
+
+func TestDistanceInMeters(t *testing.T) {
+	// Arrange
+	line := orb.LineString{{10, 53.5}, {10.01, 53.5}}
+
+	// Act & Assert
+	common.AssertApprox(t, 0, distanceInMeters(orb.Point{10.005, 53.5}, line), 0.001)
+	common.AssertApprox(t, 111.3, distanceInMeters(orb.Point{10.005, 53.501}, line), 0.5)
+	common.AssertApprox(t, 66.2, distanceInMeters(orb.Point{10.011, 53.5}, line), 0.5)
+	common.AssertApprox(t, 111.3, distanceInMeters(line, orb.LineString{{10.005, 53.501}, {10.005, 53.502}}), 0.5)
+}
+
+func TestGetCoveredCellsWithinDistance(t *testing.T) {
+	// Arrange
+	geomIndex := &testGeometryIndex{}
+
+	// Act & Assert
+	common.AssertEqual(t, []common.CellIndex{{0, 0}}, getCoveredCellsWithinDistance(geomIndex, orb.Point{0.5, 0.5}, 1000))
+	common.AssertEqual(t, []common.CellIndex{{0, 0}, {0, 1}}, getCoveredCellsWithinDistance(geomIndex, orb.Point{0.5, 0.995}, 1000))
+}
+
+func TestQuery_Execute_nearSpatialJoin(t *testing.T) {
+	// Arrange
+	cycleway := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       10,
+			Geometry: &orb.LineString{{0.2, 0.9999}, {0.8, 0.9999}},
+			Keys:     []int{1},
+			Values:   []int{0},
+		},
+	}
+	benchNearCycleway := newTestNode(1, 0.5, 1.0002)
+	benchNearCycleway.Keys, benchNearCycleway.Values = []int{0}, []int{0}
+	benchFarAway := newTestNode(2, 0.5, 1.5)
+	benchFarAway.Keys, benchFarAway.Values = []int{0}, []int{0}
+	geomIndex := &testGeometryIndex{
+		cells: map[common.CellIndex][]feature.Feature{
+			{0, 0}: {cycleway},
+			{0, 1}: {benchNearCycleway, benchFarAway},
+		},
+	}
+
+	bbox := &orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{0.9, 1.9}}
+	cyclewayStatement := NewStatement(NewBboxLocationExpression(bbox), ownOsm.OsmQueryWay, NewKeyFilterExpression(1, true))
+	benchStatement := NewStatement(NewBboxLocationExpression(bbox), ownOsm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	benchStatement.SetSpatialJoin(NewNearSpatialJoin(50, cyclewayStatement))
+	q := NewQuery([]Statement{*benchStatement})
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, []uint64{1}, getIds(features))
+}
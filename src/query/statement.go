@@ -11,6 +11,24 @@ type Statement struct {
 	location  LocationExpression
 	queryType osm.OsmQueryType
 	filter    FilterExpression
+	assertion *Assertion // Optional assertion on the result of this statement, might be nil.
+
+	// Key indices of the tags that should be part of the result, e.g. from "select(name, amenity)". Nil means all tags.
+	selectedKeys []int
+	// Transformation of the result geometries, e.g. from "centroid()".
+	geometryTransform GeometryTransform
+	// Optional spatial relation to the features of another statement, e.g. "within bbox(...).ways{...}". Might be nil.
+	spatialJoin *SpatialJoin
+	// Key of "stats(key)", which counts the values of the features instead of returning them. Might be nil.
+	statisticsKey *statisticsKey
+	// Number of goroutines filtering the cells in parallel. Set by the query for top-level statements, 1 or less means
+	// sequential filtering.
+	filterWorkers int
+	// Trace of the cells filtered by this statement, set by the query for top-level statements when tracing is enabled.
+	// Nil means no tracing.
+	trace *StatementTrace
+	// Index the features are read from. Set by the query before each execution, s. setGeometryIndexOnStatement.
+	geometryIndex index.GeometryIndex
 }
 
 func NewStatement(locationExpression LocationExpression, queryType osm.OsmQueryType, filterExpression FilterExpression) *Statement {
@@ -21,8 +39,67 @@ func NewStatement(locationExpression LocationExpression, queryType osm.OsmQueryT
 	}
 }
 
+// SetAssertion sets an assertion, which is checked by the query after executing this statement.
+func (s *Statement) SetAssertion(assertion *Assertion) {
+	s.assertion = assertion
+}
+
+func (s Statement) GetAssertion() *Assertion {
+	return s.assertion
+}
+
+// SetSelectedKeys restricts the tags of the result features to the given key indices. Nil means all tags are kept.
+func (s *Statement) SetSelectedKeys(keyIndices []int) {
+	s.selectedKeys = keyIndices
+}
+
+func (s Statement) GetSelectedKeys() []int {
+	return s.selectedKeys
+}
+
+// SetSpatialJoin restricts the result to features having the spatial relation of the join to features of another
+// statement.
+func (s *Statement) SetSpatialJoin(spatialJoin *SpatialJoin) {
+	s.spatialJoin = spatialJoin
+}
+
+func (s Statement) GetSpatialJoin() *SpatialJoin {
+	return s.spatialJoin
+}
+
+// SetGeometryTransform sets the transformation applied to the geometries of the result features.
+func (s *Statement) SetGeometryTransform(transform GeometryTransform) {
+	s.geometryTransform = transform
+}
+
+func (s Statement) GetGeometryTransform() GeometryTransform {
+	return s.geometryTransform
+}
+
+// applyOutputModifiers returns the given features with only the selected tags and transformed geometries, when this
+// statement has a tag selection or geometry transform.
+func (s Statement) applyOutputModifiers(features []feature.Feature) []feature.Feature {
+	if s.selectedKeys == nil && s.geometryTransform == GeometryTransformNone {
+		return features
+	}
+
+	modifiedFeatures := make([]feature.Feature, len(features))
+	for i, f := range features {
+		modifiedFeatures[i] = s.applyOutputModifiersToFeature(f)
+	}
+	return modifiedFeatures
+}
+
+// applyOutputModifiersToFeature is like applyOutputModifiers but for a single feature.
+func (s Statement) applyOutputModifiersToFeature(f feature.Feature) feature.Feature {
+	if s.selectedKeys != nil {
+		f = index.WithSelectedTags(f, s.selectedKeys)
+	}
+	return s.geometryTransform.apply(f)
+}
+
 func (s Statement) GetFeatures(context feature.Feature) (chan *index.GetFeaturesResult, error) {
-	return s.location.GetFeatures(geometryIndex, context, s.queryType.GetObjectType())
+	return s.location.GetFeatures(s.geometryIndex, context, s.queryType.GetObjectType(), getIdFilter(s.filter), getKeyFilter(s.filter), getTagFilter(s.filter))
 }
 
 func (s Statement) Applies(feature feature.Feature, context feature.Feature) (bool, error) {
@@ -33,40 +110,72 @@ func (s Statement) Applies(feature feature.Feature, context feature.Feature) (bo
 		return false, err
 	}
 
+	if applies && s.spatialJoin != nil {
+		applies = s.spatialJoin.matches(feature)
+	}
+
 	return applies, nil
 }
 
-func (s Statement) Execute(context feature.Feature) ([]feature.Feature, error) {
-	s.Print(0)
+// Execute returns all features fulfilling this statement. The given budget is used to track the memory of the buffered
+// cell features and the result.
+func (s Statement) Execute(context feature.Feature, budget *MemoryBudget) ([]feature.Feature, error) {
+	var result []feature.Feature
 
-	featuresChannel, err := s.GetFeatures(context)
+	err := s.Stream(context, budget, func(f feature.Feature) error {
+		err := budget.reserve(feature.EstimateSize(f))
+		if err != nil {
+			return err
+		}
+		result = append(result, f)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var result []feature.Feature
+	return result, nil
+}
 
-	for getFeatureResult := range featuresChannel {
-		sigolo.Tracef("Received %d features from cell %v", len(getFeatureResult.Features), getFeatureResult.Cell)
+// Stream passes all features fulfilling this statement to the given function as soon as they're found. The given budget
+// is only used to track the memory of the buffered cell features, the caller is responsible for the memory of the passed
+// features. An error of the given function stops the execution and is returned.
+func (s Statement) Stream(context feature.Feature, budget *MemoryBudget, handleFeature func(feature.Feature) error) error {
+	s.Print(0)
 
-		for _, feature := range getFeatureResult.Features {
-			sigolo.Trace("----- next feature -----")
-			if feature != nil {
-				feature.Print()
+	if s.spatialJoin != nil {
+		err := s.spatialJoin.prepare(budget)
+		if err != nil {
+			return err
+		}
+	}
 
-				applies, err := s.Applies(feature, context)
-				if err != nil {
-					return nil, err
-				}
+	featuresChannel, err := s.GetFeatures(context)
+	if err != nil {
+		return err
+	}
 
-				if applies {
-					result = append(result, feature)
-				}
+	if s.filterWorkers > 1 && !hasSubStatements(s.filter) {
+		return s.streamParallel(featuresChannel, context, budget, s.filterWorkers, handleFeature)
+	}
+
+	for getFeatureResult := range featuresChannel {
+		matchingFeatures, err := s.filterCell(getFeatureResult, context, budget)
+		if err != nil {
+			go drainChannel(featuresChannel)
+			return err
+		}
+
+		for _, f := range matchingFeatures {
+			err = handleFeature(f)
+			if err != nil {
+				go drainChannel(featuresChannel)
+				return err
 			}
 		}
 	}
 
-	return result, nil
+	return nil
 }
 
 func (s Statement) Print(indent int) {
@@ -74,8 +183,37 @@ func (s Statement) Print(indent int) {
 	s.location.Print(indent + 2)
 	sigolo.Debugf("%stype: %s", spacing(indent+2), s.queryType.String())
 	s.filter.Print(indent + 2)
+	if s.selectedKeys != nil {
+		sigolo.Debugf("%sselect: %v", spacing(indent+2), s.selectedKeys)
+	}
+	if s.geometryTransform != GeometryTransformNone {
+		sigolo.Debugf("%stransform: %s", spacing(indent+2), s.geometryTransform.String())
+	}
+	if s.spatialJoin != nil {
+		s.spatialJoin.Print(indent + 2)
+	}
+	if s.statisticsKey != nil {
+		sigolo.Debugf("%sstats: %s", spacing(indent+2), s.statisticsKey.key)
+	}
+	if s.assertion != nil {
+		s.assertion.Print(indent + 2)
+	}
+}
+
+func (s Statement) GetLocationExpression() LocationExpression {
+	return s.location
 }
 
 func (s Statement) GetFilterExpression() FilterExpression {
 	return s.filter
 }
+
+func (s Statement) GetQueryType() osm.OsmQueryType {
+	return s.queryType
+}
+
+// drainChannel reads all remaining results from the channel so that the goroutines filling it are able to finish.
+func drainChannel(featuresChannel chan *index.GetFeaturesResult) {
+	for range featuresChannel {
+	}
+}
@@ -0,0 +1,78 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"soq/feature"
+	"soq/index"
+)
+
+// ValueStatistics contains the number of features per value of a key, e.g. the result of
+// "bbox(...).ways.stats(surface){ highway=* }".
+type ValueStatistics struct {
+	Key string `json:"key"`
+	// Number of features matching the statement.
+	Total int `json:"total"`
+	// Number of matching features without the key.
+	Missing int `json:"missing"`
+	// Number of matching features per value of the key.
+	Values map[string]int `json:"values"`
+
+	keyIndex    int
+	valueCounts map[int]int // Counts per value index, which are turned into strings by GetStatistics.
+}
+
+func newValueStatistics(key string, keyIndex int) *ValueStatistics {
+	return &ValueStatistics{
+		Key:         key,
+		Values:      map[string]int{},
+		keyIndex:    keyIndex,
+		valueCounts: map[int]int{},
+	}
+}
+
+func (s *ValueStatistics) add(f feature.Feature) {
+	s.Total++
+	if s.keyIndex == index.NotFound || !f.HasKey(s.keyIndex) {
+		s.Missing++
+		return
+	}
+	s.valueCounts[f.GetValueIndex(s.keyIndex)]++
+}
+
+// SetStatisticsKey turns this statement into an aggregation, which doesn't return its features but counts their values
+// of the given key. The key index might be index.NotFound for keys not existing in the data.
+func (s *Statement) SetStatisticsKey(key string, keyIndex int) {
+	s.statisticsKey = &statisticsKey{key: key, keyIndex: keyIndex}
+}
+
+// HasStatistics returns true when this statement counts values instead of returning features.
+func (s Statement) HasStatistics() bool {
+	return s.statisticsKey != nil
+}
+
+// HasStatistics returns true when the top-level statements of this query count values instead of returning features.
+func (q *Query) HasStatistics() bool {
+	for _, statement := range q.topLevelStatements {
+		if statement.HasStatistics() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStatistics returns the value statistics of all aggregating top-level statements of the last execution in the
+// order of the statements.
+func (q *Query) GetStatistics(tagIndex *index.TagIndex) []*ValueStatistics {
+	for _, statistics := range q.statistics {
+		for valueIndex, count := range statistics.valueCounts {
+			statistics.Values[tagIndex.GetValueForKey(statistics.keyIndex, valueIndex)] = count
+		}
+		sigolo.Debugf("Statistics of key '%s': %d features, %d different values", statistics.Key, statistics.Total, len(statistics.Values))
+	}
+	return q.statistics
+}
+
+type statisticsKey struct {
+	key      string
+	keyIndex int
+}
@@ -0,0 +1,58 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	"soq/osm"
+	"testing"
+)
+
+func TestQuery_Execute_statistics(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"highway", "surface"}, [][]string{{"primary"}, {"asphalt", "gravel"}})
+	geomIndex := &testGeometryIndex{cells: map[common.CellIndex][]feature.Feature{}}
+	for i, tags := range [][]int{{0, 0, 1, 0}, {0, 0, 1, 1}, {0, 0, 1, 0}, {0, 0}, {1, 1}} {
+		node := newTestNode(uint64(i+1), 0.5, 0.5)
+		for j := 0; j < len(tags); j += 2 {
+			node.Keys = append(node.Keys, tags[j])
+			node.Values = append(node.Values, tags[j+1])
+		}
+		geomIndex.cells[common.CellIndex{0, 0}] = append(geomIndex.cells[common.CellIndex{0, 0}], node)
+	}
+
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	statement.SetStatisticsKey("surface", 1)
+	statement.SetAssertion(NewCountAssertion(BinOpEqual, 4))
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	features, err := q.Execute(geomIndex)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(features))
+	common.AssertEqual(t, 0, len(q.GetFailedAssertions()))
+	statistics := q.GetStatistics(tagIndex)
+	common.AssertEqual(t, 1, len(statistics))
+	common.AssertEqual(t, "surface", statistics[0].Key)
+	common.AssertEqual(t, 4, statistics[0].Total)
+	common.AssertEqual(t, 1, statistics[0].Missing)
+	common.AssertEqual(t, map[string]int{"asphalt": 2, "gravel": 1}, statistics[0].Values)
+}
+
+func TestQuery_ExecutePage_statisticsNotSupported(t *testing.T) {
+	// Arrange
+	statement := NewStatement(NewBboxLocationExpression(&orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}), osm.OsmQueryNode, NewKeyFilterExpression(0, true))
+	statement.SetStatisticsKey("surface", index.NotFound)
+	q := NewQuery([]Statement{*statement})
+
+	// Act
+	features, cursor, err := q.ExecutePage(&testGeometryIndex{}, nil, 10)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, features)
+	common.AssertNil(t, cursor)
+}
@@ -0,0 +1,106 @@
+package query
+
+import (
+	"fmt"
+	"soq/index"
+)
+
+// StatementSummary is a short, serializable description of a parsed statement. It's used by editors to show what the
+// parser understood without executing the query.
+type StatementSummary struct {
+	// Location expression, e.g. "bbox(1,2,3,4)", "coverage()" or "this" for sub-statements.
+	Location     string   `json:"location"`
+	ObjectType   string   `json:"objectType"`
+	SelectedKeys []string `json:"selectedKeys,omitempty"`
+	Transform    string   `json:"transform,omitempty"`
+	Assertion    string   `json:"assertion,omitempty"`
+	// Key of "stats(key)", when the statement counts values instead of returning features.
+	StatisticsKey string `json:"statisticsKey,omitempty"`
+
+	// Operator of the spatial join (e.g. "within") and the statement of the other features. Empty without a join.
+	SpatialJoin          string            `json:"spatialJoin,omitempty"`
+	SpatialJoinStatement *StatementSummary `json:"spatialJoinStatement,omitempty"`
+
+	// Context-aware statements like "this.ways{...}" within the filter expression.
+	SubStatements []StatementSummary `json:"subStatements,omitempty"`
+}
+
+// Summarize returns a summary of each top-level statement of this query.
+func (q *Query) Summarize(tagIndex *index.TagIndex) []StatementSummary {
+	var summaries []StatementSummary
+	for _, statement := range q.topLevelStatements {
+		summaries = append(summaries, statement.summarize(tagIndex))
+	}
+	return summaries
+}
+
+func (s Statement) summarize(tagIndex *index.TagIndex) StatementSummary {
+	summary := StatementSummary{
+		Location:   getLocationSummary(s.location),
+		ObjectType: s.queryType.String(),
+	}
+
+	for _, keyIndex := range s.selectedKeys {
+		if keyIndex != index.NotFound {
+			summary.SelectedKeys = append(summary.SelectedKeys, tagIndex.GetKeyFromIndex(keyIndex))
+		}
+	}
+
+	if s.geometryTransform != GeometryTransformNone {
+		summary.Transform = s.geometryTransform.String()
+	}
+
+	if s.assertion != nil {
+		summary.Assertion = s.assertion.String()
+	}
+
+	if s.statisticsKey != nil {
+		summary.StatisticsKey = s.statisticsKey.key
+	}
+
+	if s.spatialJoin != nil {
+		summary.SpatialJoin = s.spatialJoin.operator.String()
+		if s.spatialJoin.operator == SpatialOpNear {
+			summary.SpatialJoin = fmt.Sprintf("%s(%g)", summary.SpatialJoin, s.spatialJoin.distance)
+		}
+		joinedStatementSummary := s.spatialJoin.statement.summarize(tagIndex)
+		summary.SpatialJoinStatement = &joinedStatementSummary
+	}
+
+	for _, subStatement := range getSubStatements(s.filter) {
+		summary.SubStatements = append(summary.SubStatements, subStatement.summarize(tagIndex))
+	}
+
+	return summary
+}
+
+func getLocationSummary(location LocationExpression) string {
+	switch typedLocation := location.(type) {
+	case *BboxLocationExpression:
+		bbox := typedLocation.GetBbox()
+		return fmt.Sprintf("bbox(%g,%g,%g,%g)", bbox.Min.Lon(), bbox.Min.Lat(), bbox.Max.Lon(), bbox.Max.Lat())
+	case *AreaLocationExpression:
+		return fmt.Sprintf("areaByName(%q)", typedLocation.GetName())
+	case *AlongLocationExpression:
+		return fmt.Sprintf("along(way:%d, %g)", typedLocation.GetWayId(), typedLocation.GetDistance())
+	case *CoverageLocationExpression:
+		return "coverage()"
+	case *ContextAwareLocationExpression:
+		return "this"
+	}
+	return fmt.Sprintf("%T", location)
+}
+
+// getSubStatements returns the statements of all context-aware expressions within the given expression. Nested
+// sub-statements are not included, they're part of the returned statements.
+func getSubStatements(expression FilterExpression) []*Statement {
+	switch typedExpression := expression.(type) {
+	case *NegatedFilterExpression:
+		return getSubStatements(typedExpression.baseExpression)
+	case *LogicalFilterExpression:
+		return append(getSubStatements(typedExpression.statementA), getSubStatements(typedExpression.statementB)...)
+	case *SubStatementFilterExpression:
+		return []*Statement{typedExpression.statement}
+	}
+	return nil
+}
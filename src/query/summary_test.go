@@ -0,0 +1,43 @@
+package query
+
+import (
+	"soq/common"
+	"soq/index"
+	"testing"
+)
+
+func TestQuery_Summarize(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"amenity", "name"}, [][]string{{"bench", "cafe"}, {"Foo"}})
+	q, err := Builder().
+		Bbox(1, 2, 3, 4.5).Nodes().
+		Where(Tag("amenity", "cafe")).
+		And(Not(This().Ways().Where(Tag("amenity", "*")))).
+		Select("name").
+		Centroid().
+		AssertCount(BinOpGreaterEqual, 2).
+		All().Relations().Where(Tag("amenity", "bench")).
+		Build(tagIndex)
+	common.AssertNil(t, err)
+
+	// Act
+	summaries := q.Summarize(tagIndex)
+
+	// Assert
+	common.AssertEqual(t, []StatementSummary{
+		{
+			Location:     "bbox(1,2,3,4.5)",
+			ObjectType:   "nodes",
+			SelectedKeys: []string{"name"},
+			Transform:    "centroid",
+			Assertion:    "count >= 2",
+			SubStatements: []StatementSummary{
+				{Location: "this", ObjectType: "ways"},
+			},
+		},
+		{
+			Location:   "coverage()",
+			ObjectType: "relations",
+		},
+	}, summaries)
+}
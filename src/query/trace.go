@@ -0,0 +1,99 @@
+package query
+
+import (
+	"soq/common"
+	"soq/index"
+	"sync"
+	"time"
+)
+
+// ExecutionTrace contains the timings and cell counts of each top-level statement of the last execution, s.
+// Query.SetTracing. It shows whether a query spends its time reading and decoding cells or filtering their features.
+type ExecutionTrace struct {
+	DurationMs float64           `json:"durationMs"`
+	Statements []*StatementTrace `json:"statements"`
+}
+
+// StatementTrace contains the sums of the cell traces of a top-level statement. Sub-statements are not traced, their
+// execution time is part of the filter time of the statement using them.
+type StatementTrace struct {
+	// Position of the statement within the query.
+	Statement  int     `json:"statement"`
+	Type       string  `json:"type"`
+	DurationMs float64 `json:"durationMs"`
+	// Number of cells received from the index, including the skipped ones.
+	CellsEnumerated int `json:"cellsEnumerated"`
+	// Number of cells the index actually read, i.e. that haven't been skipped due to e.g. their key bitmap.
+	CellsRead int `json:"cellsRead"`
+	// Time the index needed to read and decode the cells. The cells are read in parallel, so this might be larger than
+	// the duration of the statement.
+	DecodeMs float64 `json:"decodeMs"`
+	// Time needed to apply the filter to the features of the cells, including sub-statements and spatial joins.
+	FilterMs float64 `json:"filterMs"`
+	// Number of features received from the index.
+	Features int `json:"features"`
+	// Number of features fulfilling the statement. Features found in multiple cells might be counted more than once.
+	MatchedFeatures int `json:"matchedFeatures"`
+	// Traces of the cells with features. Cells without features are only counted.
+	Cells []*CellTrace `json:"cells"`
+
+	decodeDuration time.Duration
+	filterDuration time.Duration
+	mutex          sync.Mutex // Cells are filtered by multiple goroutines when parallel filtering is enabled.
+}
+
+// CellTrace contains the timings and feature counts of one cell read for a statement.
+type CellTrace struct {
+	Cell            common.CellIndex `json:"cell"`
+	DecodeMs        float64          `json:"decodeMs"`
+	FilterMs        float64          `json:"filterMs"`
+	Features        int              `json:"features"`
+	MatchedFeatures int              `json:"matchedFeatures"`
+}
+
+func newStatementTrace(statementIndex int, statement Statement) *StatementTrace {
+	return &StatementTrace{
+		Statement: statementIndex,
+		Type:      statement.queryType.String(),
+		Cells:     []*CellTrace{},
+	}
+}
+
+// addCell adds the trace of a filtered cell. Calling this on nil has no effect, so statements don't need to check
+// whether they're traced.
+func (t *StatementTrace) addCell(result *index.GetFeaturesResult, filterDuration time.Duration, matchedFeatures int) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.CellsEnumerated++
+	if result.Skipped {
+		return
+	}
+	t.CellsRead++
+
+	// The sums are kept as durations, since adding up the rounded milliseconds would add up the rounding errors.
+	t.decodeDuration += result.DecodeDuration
+	t.filterDuration += filterDuration
+	t.DecodeMs = durationToMs(t.decodeDuration)
+	t.FilterMs = durationToMs(t.filterDuration)
+	t.Features += len(result.Features)
+	t.MatchedFeatures += matchedFeatures
+
+	if len(result.Features) > 0 {
+		t.Cells = append(t.Cells, &CellTrace{
+			Cell:            result.Cell,
+			DecodeMs:        durationToMs(result.DecodeDuration),
+			FilterMs:        durationToMs(filterDuration),
+			Features:        len(result.Features),
+			MatchedFeatures: matchedFeatures,
+		})
+	}
+}
+
+func durationToMs(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
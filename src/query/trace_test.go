@@ -0,0 +1,52 @@
+package query
+
+import (
+	"soq/common"
+	"testing"
+)
+
+func TestQuery_Execute_trace(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		// Arrange
+		geomIndex := newPipelineTestIndex()
+		q := newPipelineTestQuery()
+		q.SetFilterWorkers(workers)
+		q.SetTracing(true)
+
+		// Act
+		_, err := q.Execute(geomIndex)
+
+		// Assert
+		common.AssertNil(t, err)
+		trace := q.GetExecutionTrace()
+		common.AssertNotNil(t, trace)
+		common.AssertEqual(t, 1, len(trace.Statements))
+
+		statementTrace := trace.Statements[0]
+		common.AssertEqual(t, "nodes", statementTrace.Type)
+		common.AssertEqual(t, 4, statementTrace.CellsEnumerated)
+		common.AssertEqual(t, 4, statementTrace.CellsRead)
+		common.AssertEqual(t, 13, statementTrace.Features)
+		// The node in two cells matches in both of them.
+		common.AssertEqual(t, 9, statementTrace.MatchedFeatures)
+		common.AssertEqual(t, 4, len(statementTrace.Cells))
+
+		matchedFeaturesOfCells := map[common.CellIndex]int{}
+		for _, cellTrace := range statementTrace.Cells {
+			matchedFeaturesOfCells[cellTrace.Cell] = cellTrace.MatchedFeatures
+		}
+		common.AssertEqual(t, map[common.CellIndex]int{{0, 0}: 2, {1, 0}: 3, {2, 0}: 2, {3, 0}: 2}, matchedFeaturesOfCells)
+	}
+}
+
+func TestQuery_Execute_traceDisabled(t *testing.T) {
+	// Arrange
+	q := newPipelineTestQuery()
+
+	// Act
+	_, err := q.Execute(newPipelineTestIndex())
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertNil(t, q.GetExecutionTrace())
+}
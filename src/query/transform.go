@@ -0,0 +1,61 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"soq/feature"
+	"soq/index"
+)
+
+// GeometryTransform converts the geometry of result features before they are serialized, e.g. from "centroid()".
+type GeometryTransform int
+
+const (
+	GeometryTransformNone GeometryTransform = iota
+	// GeometryTransformCentroid turns ways and relations into the point of their centroid.
+	GeometryTransformCentroid
+	// GeometryTransformBbox turns ways and relations into the rectangle of their bounding box.
+	GeometryTransformBbox
+)
+
+func (t GeometryTransform) String() string {
+	switch t {
+	case GeometryTransformCentroid:
+		return "centroid"
+	case GeometryTransformBbox:
+		return "bbox"
+	}
+	return "none"
+}
+
+// apply returns the given feature with the transformed geometry. Nodes are returned unchanged, since they already are
+// points.
+func (t GeometryTransform) apply(f feature.Feature) feature.Feature {
+	if t == GeometryTransformNone {
+		return f
+	}
+	if _, isNode := f.(feature.NodeFeature); isNode {
+		return f
+	}
+
+	geometry := f.GetGeometry()
+	if geometry == nil {
+		return f
+	}
+
+	geometry = index.DereferenceGeometry(geometry)
+
+	var transformedGeometry orb.Geometry
+	switch t {
+	case GeometryTransformCentroid:
+		centroid, _ := planar.CentroidArea(geometry)
+		transformedGeometry = &centroid
+	case GeometryTransformBbox:
+		bboxPolygon := geometry.Bound().ToPolygon()
+		transformedGeometry = &bboxPolygon
+	default:
+		return f
+	}
+
+	return index.WithGeometry(f, transformedGeometry)
+}
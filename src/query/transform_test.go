@@ -0,0 +1,54 @@
+package query
+
+import (
+	"github.com/paulmach/orb"
+	"soq/common"
+	"soq/index"
+	"testing"
+)
+
+func TestGeometryTransform_centroid(t *testing.T) {
+	// Arrange
+	way := &index.EncodedWayFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       1,
+			Geometry: &orb.LineString{{0, 0}, {2, 0}, {2, 2}},
+		},
+	}
+
+	// Act
+	transformedWay := GeometryTransformCentroid.apply(way)
+
+	// Assert
+	common.AssertEqual(t, &orb.Point{1.5, 0.5}, transformedWay.GetGeometry())
+	common.AssertEqual(t, uint64(1), transformedWay.GetID())
+	common.AssertEqual(t, &orb.LineString{{0, 0}, {2, 0}, {2, 2}}, way.GetGeometry())
+}
+
+func TestGeometryTransform_bbox(t *testing.T) {
+	// Arrange
+	relation := &index.EncodedRelationFeature{
+		AbstractEncodedFeature: index.AbstractEncodedFeature{
+			ID:       1,
+			Geometry: &orb.Polygon{{{0, 1}, {2, 1}, {2, 3}, {0, 3}, {0, 1}}},
+		},
+	}
+
+	// Act
+	transformedRelation := GeometryTransformBbox.apply(relation)
+
+	// Assert
+	expectedPolygon := orb.Bound{Min: orb.Point{0, 1}, Max: orb.Point{2, 3}}.ToPolygon()
+	common.AssertEqual(t, &expectedPolygon, transformedRelation.GetGeometry())
+	_, isRelation := transformedRelation.(*index.EncodedRelationFeature)
+	common.AssertTrue(t, isRelation)
+}
+
+func TestGeometryTransform_nodesUnchanged(t *testing.T) {
+	// Arrange
+	node := newTestNode(1, 0.5, 0.5)
+
+	// Act & Assert
+	common.AssertEqual(t, node, GeometryTransformCentroid.apply(node))
+	common.AssertEqual(t, node, GeometryTransformBbox.apply(node))
+}
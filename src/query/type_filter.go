@@ -0,0 +1,32 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"soq/feature"
+	"soq/osm"
+)
+
+// TypeFilterExpression checks the OSM object type of features. This is the "type()" filter function, e.g.
+// "type()=node" or "type()!=relation", which is useful in statements returning different object types like "nwr" or
+// to filter the members of relations in sub-statements.
+type TypeFilterExpression struct {
+	objectType  osm.OsmObjectType
+	shouldMatch bool // False for "!=" expressions
+}
+
+func NewTypeFilterExpression(objectType osm.OsmObjectType, shouldMatch bool) *TypeFilterExpression {
+	return &TypeFilterExpression{
+		objectType:  objectType,
+		shouldMatch: shouldMatch,
+	}
+}
+
+func (f TypeFilterExpression) Applies(feature feature.Feature, context feature.Feature) (bool, error) {
+	sigolo.Tracef("TypeFilterExpression")
+	objectType, ok := getObjectType(feature)
+	return (ok && objectType == f.objectType) == f.shouldMatch, nil
+}
+
+func (f TypeFilterExpression) Print(indent int) {
+	sigolo.Debugf("%s%s: %s (shouldMatch=%v)", spacing(indent), "TypeFilterExpression", f.objectType.String(), f.shouldMatch)
+}
@@ -0,0 +1,34 @@
+package query
+
+import (
+	"soq/common"
+	"soq/index"
+	"soq/osm"
+	"testing"
+)
+
+func TestTypeFilterExpression_Applies(t *testing.T) {
+	// Arrange
+	node := newTestNode(1, 0, 0)
+	way := newTestWayWithNodes(nil, nil, 1, 2)
+	relation := &index.EncodedRelationFeature{AbstractEncodedFeature: index.AbstractEncodedFeature{ID: 1}}
+
+	// Act
+	nodeExpression := NewTypeFilterExpression(osm.OsmObjNode, true)
+	nodeOnNode, err := nodeExpression.Applies(node, nil)
+	common.AssertNil(t, err)
+	nodeOnWay, err := nodeExpression.Applies(way, nil)
+	common.AssertNil(t, err)
+
+	notRelationExpression := NewTypeFilterExpression(osm.OsmObjRelation, false)
+	notRelationOnWay, err := notRelationExpression.Applies(way, nil)
+	common.AssertNil(t, err)
+	notRelationOnRelation, err := notRelationExpression.Applies(relation, nil)
+	common.AssertNil(t, err)
+
+	// Assert
+	common.AssertTrue(t, nodeOnNode)
+	common.AssertFalse(t, nodeOnWay)
+	common.AssertTrue(t, notRelationOnWay)
+	common.AssertFalse(t, notRelationOnRelation)
+}
@@ -0,0 +1,115 @@
+package query
+
+import (
+	"bufio"
+	"os"
+	"slices"
+	"soq/common"
+	"soq/index"
+	"strings"
+	"testing"
+)
+
+const valueComparisonCorpusFile = "testdata/value-comparison.txt"
+
+var corpusOperators = map[string]BinaryOperator{
+	"=":  BinOpEqual,
+	"!=": BinOpNotEqual,
+	">":  BinOpGreater,
+	">=": BinOpGreaterEqual,
+	"<":  BinOpLower,
+	"<=": BinOpLowerEqual,
+}
+
+// valueComparisonCase is one line of the value comparison corpus. See the corpus file for a description of the format.
+type valueComparisonCase struct {
+	line           int
+	values         []string
+	operator       BinaryOperator
+	value          string
+	expectedValues []string
+}
+
+func TestTagFilterExpression_valueComparisonCorpus(t *testing.T) {
+	// Arrange
+	cases := readValueComparisonCorpus(t)
+
+	for _, c := range cases {
+		common.AssertEqual(t, common.Sort(c.values), c.values)
+		tagIndex := index.NewTagIndex([]string{"width"}, [][]string{c.values})
+
+		// Act
+		expression := NewTagFilterExpressionFromStrings(tagIndex, "width", c.value, false, c.operator)
+
+		var matchingValues []string
+		for valueIndex, value := range c.values {
+			f := &index.EncodedNodeFeature{
+				AbstractEncodedFeature: index.AbstractEncodedFeature{
+					Keys:   []int{0},
+					Values: []int{valueIndex},
+				},
+			}
+			applies, err := expression.Applies(f, nil)
+			common.AssertNil(t, err)
+			if applies {
+				matchingValues = append(matchingValues, value)
+			}
+		}
+		featureWithoutKey := &index.EncodedNodeFeature{}
+		appliesWithoutKey, err := expression.Applies(featureWithoutKey, nil)
+
+		// Assert
+		if !slices.Equal(c.expectedValues, matchingValues) || appliesWithoutKey || err != nil {
+			t.Errorf("%s:%d: width%s%s matches %v (feature without key: %v, error: %v), expected %v", valueComparisonCorpusFile, c.line, c.operator.string(), c.value, matchingValues, appliesWithoutKey, err, c.expectedValues)
+		}
+	}
+}
+
+func readValueComparisonCorpus(t *testing.T) []valueComparisonCase {
+	file, err := os.Open(valueComparisonCorpusFile)
+	common.AssertNil(t, err)
+	defer file.Close()
+
+	var cases []valueComparisonCase
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		columns := strings.Split(line, "|")
+		if len(columns) != 4 {
+			t.Fatalf("%s:%d: Expected 4 columns but found %d", valueComparisonCorpusFile, lineNumber, len(columns))
+		}
+
+		operator, ok := corpusOperators[strings.TrimSpace(columns[1])]
+		if !ok {
+			t.Fatalf("%s:%d: Unknown operator '%s'", valueComparisonCorpusFile, lineNumber, columns[1])
+		}
+
+		var expectedValues []string
+		if strings.TrimSpace(columns[3]) != "-" {
+			expectedValues = splitCorpusValues(columns[3])
+		}
+
+		cases = append(cases, valueComparisonCase{
+			line:           lineNumber,
+			values:         splitCorpusValues(columns[0]),
+			operator:       operator,
+			value:          strings.TrimSpace(columns[2]),
+			expectedValues: expectedValues,
+		})
+	}
+	common.AssertNil(t, scanner.Err())
+
+	return cases
+}
+
+func splitCorpusValues(column string) []string {
+	values := strings.Split(column, ",")
+	for i, value := range values {
+		values[i] = strings.TrimSpace(value)
+	}
+	return values
+}
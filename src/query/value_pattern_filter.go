@@ -0,0 +1,46 @@
+package query
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"slices"
+	"soq/feature"
+	"soq/index"
+)
+
+// ValuePatternFilterExpression checks the value of a key against a glob pattern like "name=Super*". The pattern is
+// resolved against the values of the tag index once, so that each feature only needs a lookup of its value index.
+type ValuePatternFilterExpression struct {
+	key     int
+	pattern string
+	values  []int // Ascending indices of all values of the key matching the pattern
+	// Either BinOpEqual or BinOpNotEqual
+	operator BinaryOperator
+}
+
+func NewValuePatternFilterExpression(tagIndex *index.TagIndex, key string, pattern string, operator BinaryOperator) *ValuePatternFilterExpression {
+	keyIndex := tagIndex.GetKeyIndexFromKeyString(key)
+	return &ValuePatternFilterExpression{
+		key:      keyIndex,
+		pattern:  pattern,
+		values:   tagIndex.GetValueIndicesByPattern(keyIndex, pattern),
+		operator: operator,
+	}
+}
+
+func (f ValuePatternFilterExpression) Applies(feature feature.Feature, context feature.Feature) (bool, error) {
+	if sigolo.ShouldLogTrace() {
+		sigolo.Tracef("ValuePatternFilterExpression: %d%s%s", f.key, f.operator.string(), f.pattern)
+	}
+
+	// Like for tag expressions, both operators only apply to features having the key.
+	if !feature.HasKey(f.key) {
+		return false, nil
+	}
+
+	_, matches := slices.BinarySearch(f.values, feature.GetValueIndex(f.key))
+	return matches == (f.operator == BinOpEqual), nil
+}
+
+func (f ValuePatternFilterExpression) Print(indent int) {
+	sigolo.Debugf("%s%s: %d%s%s (%d values)", spacing(indent), "ValuePatternFilterExpression", f.key, f.operator.string(), f.pattern, len(f.values))
+}
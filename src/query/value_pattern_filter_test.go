@@ -0,0 +1,50 @@
+package query
+
+import (
+	"soq/common"
+	"soq/feature"
+	"soq/index"
+	"testing"
+)
+
+func TestValuePatternFilterExpression_Applies(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"name", "shop"}, [][]string{{"Bakery", "Supermarket", "Superstore"}, {"bakery"}})
+	equalExpression := NewValuePatternFilterExpression(tagIndex, "name", "Super*", BinOpEqual)
+	notEqualExpression := NewValuePatternFilterExpression(tagIndex, "name", "Super*", BinOpNotEqual)
+
+	for _, testCase := range []struct {
+		feature          feature.Feature
+		expectedEqual    bool
+		expectedNotEqual bool
+	}{
+		{newTaggedTestNode(1, 0, 0, []int{0}, []int{1}), true, false},
+		{newTaggedTestNode(2, 0, 0, []int{0, 1}, []int{2, 0}), true, false},
+		{newTaggedTestNode(3, 0, 0, []int{0}, []int{0}), false, true},
+		{newTaggedTestNode(4, 0, 0, []int{1}, []int{0}), false, false},
+	} {
+		// Act
+		equalApplies, equalErr := equalExpression.Applies(testCase.feature, nil)
+		notEqualApplies, notEqualErr := notEqualExpression.Applies(testCase.feature, nil)
+
+		// Assert
+		common.AssertNil(t, equalErr)
+		common.AssertNil(t, notEqualErr)
+		common.AssertEqual(t, testCase.expectedEqual, equalApplies)
+		common.AssertEqual(t, testCase.expectedNotEqual, notEqualApplies)
+	}
+}
+
+func TestValuePatternFilterExpression_unknownKey(t *testing.T) {
+	// Arrange
+	tagIndex := index.NewTagIndex([]string{"name"}, [][]string{{"Supermarket"}})
+	expression := NewValuePatternFilterExpression(tagIndex, "brand", "Super*", BinOpEqual)
+
+	// Act
+	applies, err := expression.Applies(newTaggedTestNode(1, 0, 0, []int{0}, []int{0}), nil)
+
+	// Assert
+	common.AssertNil(t, err)
+	common.AssertFalse(t, applies)
+	common.AssertEqual(t, 0, len(expression.values))
+}
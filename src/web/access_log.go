@@ -0,0 +1,195 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"soq/common"
+	"soq/query"
+	"sync"
+	"time"
+)
+
+// AccessLogOptions configure the access log of the server. An empty filename disables the access log, "-" writes it to
+// stdout.
+type AccessLogOptions struct {
+	Filename       string
+	MaxSizeInBytes int64 // Size at which the file is rotated. 0 disables the rotation.
+	MaxBackups     int   // Number of rotated files to keep.
+}
+
+// AccessLogEntry is one line of the access log, which contains one JSON object per request. The query fields are only
+// set for requests executing a query.
+type AccessLogEntry struct {
+	Time         time.Time `json:"time"`
+	ClientIp     string    `json:"clientIp"`
+	ForwardedFor string    `json:"forwardedFor,omitempty"` // Content of the X-Forwarded-For header, e.g. behind a reverse proxy.
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Status       int       `json:"status"`
+	DurationMs   int64     `json:"durationMs"`
+
+	StoredQuery    string `json:"storedQuery,omitempty"`
+	Query          string `json:"query,omitempty"`
+	ResultFeatures *int64 `json:"resultFeatures,omitempty"`
+	CellsRead      *int64 `json:"cellsRead,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+type accessLogEntryContextKey struct{}
+
+// accessLogger writes an AccessLogEntry for each request.
+type accessLogger struct {
+	writer io.Writer
+	mutex  *sync.Mutex
+}
+
+func newAccessLogger(options AccessLogOptions) (*accessLogger, error) {
+	if options.Filename == "" {
+		return nil, nil
+	}
+
+	var writer io.Writer = os.Stdout
+	if options.Filename != "-" {
+		var err error
+		writer, err = common.NewRotatingFileWriter(options.Filename, options.MaxSizeInBytes, options.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sigolo.Infof("Write access log to %s", options.Filename)
+	}
+
+	return &accessLogger{
+		writer: writer,
+		mutex:  &sync.Mutex{},
+	}, nil
+}
+
+// middleware logs each request after it has been handled. Handlers executing queries add their details to the entry
+// of the request, s. getAccessLogEntry. Requests of health checks are not logged, since probes would flood the log.
+func (l *accessLogger) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/healthz" || request.URL.Path == "/readyz" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		entry := &AccessLogEntry{
+			Time:         time.Now(),
+			ClientIp:     getClientIp(request),
+			ForwardedFor: request.Header.Get("X-Forwarded-For"),
+			Method:       request.Method,
+			Path:         request.URL.Path,
+		}
+		statusWriter := &statusRecordingResponseWriter{ResponseWriter: writer, status: http.StatusOK}
+
+		next.ServeHTTP(statusWriter, request.WithContext(context.WithValue(request.Context(), accessLogEntryContextKey{}, entry)))
+
+		entry.Status = statusWriter.status
+		entry.DurationMs = time.Since(entry.Time).Milliseconds()
+		l.write(entry)
+	})
+}
+
+// close closes the log file, if any. Entries written afterward are lost.
+func (l *accessLogger) close() {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	closer, ok := l.writer.(io.Closer)
+	if !ok || l.writer == os.Stdout {
+		return
+	}
+	err := closer.Close()
+	if err != nil {
+		sigolo.Errorf("Error closing access log: %+v", err)
+	}
+}
+
+func (l *accessLogger) write(entry *AccessLogEntry) {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		sigolo.Errorf("Error marshalling access log entry: %+v", err)
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, err = l.writer.Write(append(entryBytes, '\n'))
+	if err != nil {
+		sigolo.Errorf("Error writing access log entry: %+v", err)
+	}
+}
+
+// getAccessLogEntry returns the access log entry of the given request. It's nil when the access log is disabled, all
+// functions of the entry can be called on nil nevertheless.
+func getAccessLogEntry(request *http.Request) *AccessLogEntry {
+	entry, _ := request.Context().Value(accessLogEntryContextKey{}).(*AccessLogEntry)
+	return entry
+}
+
+func (e *AccessLogEntry) setQuery(queryString string) {
+	if e == nil {
+		return
+	}
+	e.Query = queryString
+}
+
+func (e *AccessLogEntry) setStoredQuery(name string) {
+	if e == nil {
+		return
+	}
+	e.StoredQuery = name
+}
+
+// setExecution adds the statistics of the execution of the given query. The number of result features is ignored when
+// it's negative, e.g. for queries with value statistics.
+func (e *AccessLogEntry) setExecution(queryObj *query.Query, resultFeatures int64, err error) {
+	if e == nil {
+		return
+	}
+
+	cellsRead := queryObj.GetMemoryBudget().GetReadCells()
+	e.CellsRead = &cellsRead
+	if resultFeatures >= 0 {
+		e.ResultFeatures = &resultFeatures
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+func (e *AccessLogEntry) setError(err error) {
+	if e == nil {
+		return
+	}
+	e.Error = err.Error()
+}
+
+func getClientIp(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// statusRecordingResponseWriter remembers the status code of the response.
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecordingResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -1,19 +1,44 @@
 package web
 
 import (
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
 	"io"
 	"net/http"
+	"soq/common"
+	"soq/feature"
 	"soq/index"
 	"soq/parser"
+	"soq/query"
+	"strconv"
+	"time"
 )
 
+const defaultPageSize = 1000
+
+// The query editor is embedded into the binary, so it's available independent of the working directory of the server.
+//
+//go:embed index.html
+var queryEditorHtml []byte
+
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Details error  `json:"details"`
+
+	// Set when the query has been aborted because it exceeded a limit of the server.
+	Limit *LimitResponse `json:"limit,omitempty"`
+}
+
+type LimitResponse struct {
+	// Name of the limit: "memory", "duration", "cells", "result_features" or "area".
+	Name string `json:"name"`
+	// Maximum value of the limit in bytes, milliseconds, cells or features.
+	Maximum int64 `json:"maximum"`
 }
 
 func NewErrorResponse(message string, err error) ErrorResponse {
@@ -23,30 +48,107 @@ func NewErrorResponse(message string, err error) ErrorResponse {
 	}
 }
 
-func StartServer(port string, indexBaseFolder string, defaultCellSize float64, checkFeatureValidity bool) {
-	r := initRouter(indexBaseFolder, defaultCellSize, checkFeatureValidity)
-	sigolo.Infof("Start server with TLS support on port %s", port)
-	err := http.ListenAndServe(":"+port, r)
-	sigolo.FatalCheck(err)
+type ReloadResponse struct {
+	// Creation time of the index in use after the reload.
+	CreatedAt time.Time `json:"createdAt"`
 }
 
-func StartServerTls(port string, certFile string, keyFile string, indexBaseFolder string, defaultCellSize float64, checkFeatureValidity bool) {
-	r := initRouter(indexBaseFolder, defaultCellSize, checkFeatureValidity)
-	sigolo.Infof("Start server without TLS support on port %s", port)
-	err := http.ListenAndServeTLS(":"+port, certFile, keyFile, r)
-	sigolo.FatalCheck(err)
+type StatsResponse struct {
+	// Creation time of the index in use.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Progress of building the relation geometries. This is nil when relation geometries are not built by the server.
+	RelationGeometries *index.RelationGeometryStats `json:"relationGeometries,omitempty"`
+	Preload            *index.PreloadStats          `json:"preload,omitempty"`
+
+	// Estimated memory in bytes used by the caches, grouped by the kind of cache.
+	CacheMemory map[string]int64 `json:"cacheMemory,omitempty"`
+}
+
+// ServerOptions configure the server and the queries it executes.
+type ServerOptions struct {
+	Port string
+	// TLS is used when both files are set.
+	CertFile string
+	KeyFile  string
+
+	IndexBaseFolder      string
+	CellSize             float64
+	CheckFeatureValidity bool
+	// Approximate maximum amount of memory in bytes a single query may use, 0 means unlimited.
+	QueryMemoryLimit int64
+	QueryLimits      query.Limits
+	// Folder with the stored queries, s. queryLibrary.
+	QueriesFolder string
+	// Interval in which the server checks for a new index and changed stored queries. 0 disables the check.
+	ReloadInterval time.Duration
+
+	BuildRelationGeometries bool
+	RelationGeometryDelay   time.Duration
+	// The cells within this bbox are preloaded after loading an index. Nil disables this.
+	PreloadBbox *orb.Bound
+
+	AccessLog AccessLogOptions
+	// Time running requests get to finish when the server shuts down, s. runServer.
+	ShutdownGracePeriod time.Duration
+
+	// The following endpoints have no authentication and are therefore disabled by default.
+	ReloadEndpoint bool
+	StoreQueries   bool
+	Pprof          bool
+}
+
+// StartServer loads the index and serves the API until the process receives SIGTERM or SIGINT.
+func StartServer(options ServerOptions, settings common.Settings) {
+	r, stop := initRouter(options, settings)
+
+	if options.CertFile != "" && options.KeyFile != "" {
+		sigolo.Infof("Start server with TLS support on port %s", options.Port)
+		runServer(options.Port, r, stop, options.ShutdownGracePeriod, func(server *http.Server) error {
+			return server.ListenAndServeTLS(options.CertFile, options.KeyFile)
+		})
+		return
+	}
+
+	sigolo.Infof("Start server without TLS support on port %s", options.Port)
+	runServer(options.Port, r, stop, options.ShutdownGracePeriod, func(server *http.Server) error {
+		return server.ListenAndServe()
+	})
 }
 
-func initRouter(indexBaseFolder string, defaultCellSize float64, checkFeatureValidity bool) *mux.Router {
-	tagIndex, err := index.LoadTagIndex(indexBaseFolder)
+// initRouter loads the index and stored queries and creates the router. The returned function stops the background
+// tasks and closes the access log, it must be called once no requests are running anymore.
+func initRouter(options ServerOptions, settings common.Settings) (*mux.Router, func()) {
+	indices, err := newIndexHolder(options.IndexBaseFolder, options.CellSize, options.CheckFeatureValidity, options.BuildRelationGeometries, options.RelationGeometryDelay, options.PreloadBbox, settings)
+	sigolo.FatalCheck(err)
+	queries := newQueryLibrary(options.QueriesFolder)
+	_, err = queries.reloadIfChanged(indices.get())
+	sigolo.FatalCheck(err)
+	logger, err := newAccessLogger(options.AccessLog)
 	sigolo.FatalCheck(err)
-	geometryIndex := index.LoadGridIndex(indexBaseFolder, defaultCellSize, defaultCellSize, checkFeatureValidity, tagIndex)
+
+	if options.ReloadInterval > 0 {
+		sigolo.Infof("Check for a new index and changed stored queries every %s", options.ReloadInterval)
+		go indices.watch(options.ReloadInterval)
+		go queries.watch(options.ReloadInterval, indices)
+	}
 
 	r := mux.NewRouter()
+	if logger != nil {
+		r.Use(logger.middleware)
+	}
+	r.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+		sigolo.Infof("Serve query editor")
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := writer.Write(queryEditorHtml)
+		if err != nil {
+			sigolo.Errorf("Error writing query editor: %+v", err)
+		}
+	}).Methods(http.MethodGet)
 	r.HandleFunc("/app", func(writer http.ResponseWriter, request *http.Request) {
-		sigolo.Infof("Serve index.html")
-		http.ServeFile(writer, request, "./web/index.html")
-	})
+		// Old location of the query editor
+		http.Redirect(writer, request, "/", http.StatusMovedPermanently)
+	}).Methods(http.MethodGet)
 	r.HandleFunc("/query", func(writer http.ResponseWriter, request *http.Request) {
 		writer.Header().Set("Access-Control-Allow-Origin", "*")
 		writer.Header().Set("Content-Type", "application/json")
@@ -54,83 +156,512 @@ func initRouter(indexBaseFolder string, defaultCellSize float64, checkFeatureVal
 		queryBytes, err := io.ReadAll(request.Body)
 		if err != nil {
 			sigolo.Errorf("Error reding HTTP body of request to '/query': %+v", err)
-			writer.WriteHeader(http.StatusInternalServerError)
-
-			errorResponseBytes, err := json.Marshal(NewErrorResponse("Error reading HTTP body.", nil))
-			if err != nil {
-				sigolo.Errorf("Error creating and marshalling error response object: %+v", err)
-			}
-
-			_, err = writer.Write(errorResponseBytes)
-			if err != nil {
-				sigolo.Errorf("Error writing error response: %+v", err)
-			}
+			writeErrorResponse(writer, http.StatusInternalServerError, "Error reading HTTP body.", nil)
 			return
 		}
 
-		queryString := string(queryBytes)
+		executeQuery(writer, request, indices, string(queryBytes), options, settings)
+	}).Methods(http.MethodPost)
+	r.HandleFunc("/api/queries", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Access-Control-Allow-Origin", "*")
+		writer.Header().Set("Content-Type", "application/json")
 
-		trimmedQueryString := queryString
-		queryRunes := []rune(queryString)
-		maxLengthOfPrintedQuery := 10000
-		if len(queryRunes) > maxLengthOfPrintedQuery {
-			trimmedQueryString = string(queryRunes[:maxLengthOfPrintedQuery]) + "... [truncated]"
+		responseBytes, err := json.Marshal(queries.getAll())
+		if err != nil {
+			sigolo.Errorf("Error marshalling stored queries: %+v", err)
+			writeErrorResponse(writer, http.StatusInternalServerError, "Error marshalling stored queries.", nil)
+			return
 		}
-		sigolo.Infof("Query:\n%s", trimmedQueryString)
 
-		queryObj, err := parser.ParseQueryString(queryString, tagIndex, geometryIndex)
+		_, err = writer.Write(responseBytes)
 		if err != nil {
-			sigolo.Errorf("Error parsing query: %+v", err)
-			writer.WriteHeader(http.StatusBadRequest)
+			sigolo.Errorf("Error writing stored queries: %+v", err)
+		}
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/api/queries/{name}", func(writer http.ResponseWriter, request *http.Request) {
+		executeStoredQuery(writer, request, indices, queries, options, settings)
+	}).Methods(http.MethodPost)
+	if options.StoreQueries {
+		sigolo.Info("Enable storing queries at /api/queries/{name}")
+		r.HandleFunc("/api/queries/{name}", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+			writer.Header().Set("Content-Type", "application/json")
 
-			errorResponseBytes, err := json.Marshal(NewErrorResponse(fmt.Sprintf("Error parsing query: %s", err.Error()), err))
+			queryBytes, err := io.ReadAll(request.Body)
 			if err != nil {
-				sigolo.Errorf("Error creating and marshalling error response object: %+v", err)
+				sigolo.Errorf("Error reding HTTP body of request to '/api/queries': %+v", err)
+				writeErrorResponse(writer, http.StatusInternalServerError, "Error reading HTTP body.", nil)
+				return
 			}
 
-			_, err = writer.Write(errorResponseBytes)
+			currentIndex := indices.acquire()
+			defer currentIndex.release()
+			storedQuery, err := queries.store(mux.Vars(request)["name"], string(queryBytes), currentIndex)
 			if err != nil {
-				sigolo.Errorf("Error writing error response: %+v", err)
+				sigolo.Errorf("Error storing query: %+v", err)
+				writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Error storing query: %s", err.Error()), nil)
+				return
 			}
-			return
-		}
 
-		features, err := queryObj.Execute(geometryIndex)
-		if err != nil {
-			sigolo.Errorf("Error executing query: %+v", err)
-			writer.WriteHeader(http.StatusInternalServerError)
+			responseBytes, err := json.Marshal(storedQuery)
+			if err != nil {
+				sigolo.Errorf("Error marshalling stored query: %+v", err)
+				writeErrorResponse(writer, http.StatusInternalServerError, "Error marshalling stored query.", nil)
+				return
+			}
 
-			errorResponseBytes, err := json.Marshal(NewErrorResponse(fmt.Sprintf("Error executing query: %s", err.Error()), err))
+			_, err = writer.Write(responseBytes)
 			if err != nil {
-				sigolo.Errorf("Error creating and marshalling error response object: %+v", err)
+				sigolo.Errorf("Error writing stored query: %+v", err)
+			}
+		}).Methods(http.MethodPut)
+	}
+	r.HandleFunc("/api/run/{name}", func(writer http.ResponseWriter, request *http.Request) {
+		executeStoredQuery(writer, request, indices, queries, options, settings)
+	}).Methods(http.MethodGet)
+	if options.ReloadEndpoint {
+		sigolo.Info("Enable reload endpoint at /api/reload")
+		r.HandleFunc("/api/reload", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+
+			err := indices.reload()
+			if err != nil {
+				sigolo.Errorf("Error reloading index: %+v", err)
+				writeErrorResponse(writer, http.StatusInternalServerError, fmt.Sprintf("Error reloading index, the old index stays in use: %s", err.Error()), err)
+				return
+			}
+
+			responseBytes, err := json.Marshal(ReloadResponse{CreatedAt: indices.get().createdAt()})
+			if err != nil {
+				sigolo.Errorf("Error marshalling reload response: %+v", err)
+				writer.WriteHeader(http.StatusInternalServerError)
+				return
 			}
 
-			_, err = writer.Write(errorResponseBytes)
+			_, err = writer.Write(responseBytes)
 			if err != nil {
-				sigolo.Errorf("Error writing error response: %+v", err)
+				sigolo.Errorf("Error writing reload response: %+v", err)
 			}
+		}).Methods(http.MethodPost)
+	}
+	r.HandleFunc("/api/validate", func(writer http.ResponseWriter, request *http.Request) {
+		handleValidation(writer, request, indices)
+	}).Methods(http.MethodPost)
+	r.HandleFunc("/api/keys", func(writer http.ResponseWriter, request *http.Request) {
+		handleKeyAutocomplete(writer, request, indices)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/api/values", func(writer http.ResponseWriter, request *http.Request) {
+		handleValueAutocomplete(writer, request, indices)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/api/stats", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Access-Control-Allow-Origin", "*")
+		writer.Header().Set("Content-Type", "application/json")
+
+		currentIndex := indices.get()
+		response := StatsResponse{CreatedAt: currentIndex.createdAt()}
+		if currentIndex.relationGeometryBuilder != nil {
+			relationGeometryStats := currentIndex.relationGeometryBuilder.Stats()
+			response.RelationGeometries = &relationGeometryStats
+		}
+		if currentIndex.cellPreloader != nil {
+			preloadStats := currentIndex.cellPreloader.Stats()
+			response.Preload = &preloadStats
+		}
+		if settings.MemoryAccountant != nil {
+			response.CacheMemory = settings.MemoryAccountant.GetUsage()
+		}
+
+		responseBytes, err := json.Marshal(response)
+		if err != nil {
+			sigolo.Errorf("Error marshalling stats response: %+v", err)
+			writeErrorResponse(writer, http.StatusInternalServerError, "Error marshalling stats.", nil)
 			return
 		}
 
-		sigolo.Debugf("Found %d features", len(features))
+		_, err = writer.Write(responseBytes)
+		if err != nil {
+			sigolo.Errorf("Error writing stats response: %+v", err)
+		}
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
+		handleHealth(writer)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", func(writer http.ResponseWriter, request *http.Request) {
+		handleReadiness(writer, indices)
+	}).Methods(http.MethodGet)
+	if options.Pprof {
+		sigolo.Info("Enable profiling endpoints at /debug/pprof/")
+		registerPprofHandlers(r)
+	}
+
+	stop := func() {
+		indices.close()
+		logger.close()
+	}
+
+	return r, stop
+}
+
+// executeStoredQuery executes the stored query of the "name" path parameter. Placeholders of the query are replaced by
+// the URL parameters of the same name, e.g. "{{bbox}}" by the value of "?bbox=...".
+func executeStoredQuery(writer http.ResponseWriter, request *http.Request, indices *indexHolder, queries *queryLibrary, options ServerOptions, settings common.Settings) {
+	writer.Header().Set("Access-Control-Allow-Origin", "*")
+	writer.Header().Set("Content-Type", "application/json")
+
+	name := mux.Vars(request)["name"]
+	getAccessLogEntry(request).setStoredQuery(name)
+	storedQuery, ok := queries.get(name)
+	if !ok {
+		writeErrorResponse(writer, http.StatusNotFound, fmt.Sprintf("Stored query '%s' not found", name), nil)
+		return
+	}
+
+	values := map[string]string{}
+	for _, parameter := range storedQuery.Parameters {
+		if request.URL.Query().Has(parameter) {
+			values[parameter] = request.URL.Query().Get(parameter)
+		}
+	}
+
+	queryString, err := parser.SubstitutePlaceholders(storedQuery.Query, values)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Error substituting parameters of query '%s': %s", name, err.Error()), nil)
+		return
+	}
+
+	executeQuery(writer, request, indices, queryString, options, settings)
+}
+
+// executeQuery parses and executes the given query string on the current index and writes the result as GeoJSON. The
+// same index is used for the whole request, even when a new index is loaded in the meantime.
+func executeQuery(writer http.ResponseWriter, request *http.Request, indices *indexHolder, queryString string, options ServerOptions, settings common.Settings) {
+	currentIndex := indices.acquire()
+	defer currentIndex.release()
+	tagIndex := currentIndex.tagIndex
+	geometryIndex := currentIndex.geometryIndex
+
+	trimmedQueryString := queryString
+	queryRunes := []rune(queryString)
+	maxLengthOfPrintedQuery := 10000
+	if len(queryRunes) > maxLengthOfPrintedQuery {
+		trimmedQueryString = string(queryRunes[:maxLengthOfPrintedQuery]) + "... [truncated]"
+	}
+	sigolo.Infof("Query:\n%s", trimmedQueryString)
+	logEntry := getAccessLogEntry(request)
+	logEntry.setQuery(trimmedQueryString)
+
+	queryObj, err := parseQueryString(request, queryString, tagIndex, geometryIndex)
+	if err != nil {
+		logEntry.setError(err)
+		sigolo.Errorf("Error parsing query: %+v", err)
+		writeErrorResponse(writer, getParsingErrorStatus(err), fmt.Sprintf("Error parsing query: %s", err.Error()), err)
+		return
+	}
+
+	queryObj.SetMemoryLimit(options.QueryMemoryLimit)
+	queryObj.SetLimits(options.QueryLimits)
+	queryObj.SetFilterWorkers(settings.FilterWorkers)
+	queryObj.SetMemoryAccountant(settings.MemoryAccountant)
+	// Cancels the query when the client disconnects or the grace period of a shutdown is over
+	queryObj.SetContext(request.Context())
+
+	if queryObj.HasStatistics() {
+		err = writeStatisticsResult(writer, currentIndex, queryObj)
+		logEntry.setExecution(queryObj, -1, err)
+		return
+	}
+
+	if queryObj.IsIntrospection() {
+		err = writeIntrospectionResult(writer, currentIndex, queryObj)
+		logEntry.setExecution(queryObj, -1, err)
+		return
+	}
+
+	outputOptions := index.OutputOptions{
+		GeometryMetrics: request.URL.Query().Get("geometry_metrics") == "true",
+		Timestamp:       request.URL.Query().Get("timestamp") == "true",
+		TagKeyPrefix:    request.URL.Query().Get("tag_key_prefix"),
+		Warnings:        queryObj.GetWarnings,
+	}
+	isPaginated := request.URL.Query().Has("cursor") || request.URL.Query().Has("page_size")
+	memberRoles := request.URL.Query().Get("member_roles") == "true"
+	resolveMembers := request.URL.Query().Get("resolve_members") == "true"
+	if !isPaginated && !memberRoles && !resolveMembers {
+		numberOfFeatures, err := streamQueryResult(writer, currentIndex, queryObj, outputOptions)
+		logEntry.setExecution(queryObj, numberOfFeatures, err)
+		return
+	}
+
+	var features []feature.Feature
+	if isPaginated {
+		var cursor *query.Cursor
+		var nextCursor *query.Cursor
+		var pageSize int
 
-		err = index.WriteFeaturesAsGeoJson(features, tagIndex, writer)
+		cursor, pageSize, err = getPaginationParameters(request)
 		if err != nil {
-			sigolo.Errorf("Error writing query result: %+v", err)
-			writer.WriteHeader(http.StatusInternalServerError)
+			logEntry.setError(err)
+			sigolo.Errorf("Error parsing pagination parameters: %+v", err)
+			writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Error parsing pagination parameters: %s", err.Error()), err)
+			return
+		}
 
-			errorResponseBytes, err := json.Marshal(NewErrorResponse(fmt.Sprintf("Error writing query result: %s", err.Error()), err))
-			if err != nil {
-				sigolo.Errorf("Error creating and marshalling error response object: %+v", err)
-			}
+		features, nextCursor, err = queryObj.ExecutePage(geometryIndex, cursor, pageSize)
+		if err == nil && nextCursor != nil {
+			writer.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
+			writer.Header().Set("X-Next-Cursor", query.EncodeCursor(nextCursor))
+		}
+	} else {
+		features, err = queryObj.Execute(geometryIndex)
+	}
+	logEntry.setExecution(queryObj, int64(len(features)), err)
+	if err != nil {
+		writeExecutionErrorResponse(writer, err)
+		return
+	}
 
-			_, err = writer.Write(errorResponseBytes)
-			if err != nil {
-				sigolo.Errorf("Error writing error response: %+v", err)
-			}
+	sigolo.Debugf("Found %d features", len(features))
+
+	if currentIndex.relationGeometryBuilder != nil {
+		currentIndex.relationGeometryBuilder.Prioritize(features)
+	}
+
+	if memberRoles {
+		outputOptions.RelationMembers, err = index.GetRelationMemberGeometriesByRole(geometryIndex, features)
+		if err != nil {
+			sigolo.Errorf("Error getting relation members: %+v", err)
+			writeErrorResponse(writer, http.StatusInternalServerError, fmt.Sprintf("Error getting relation members: %s", err.Error()), err)
 			return
 		}
-	}).Methods(http.MethodPost)
+	}
+	if resolveMembers {
+		outputOptions.RelationMemberWays, err = index.GetRelationMemberWays(geometryIndex, features)
+		if err != nil {
+			sigolo.Errorf("Error getting relation member ways: %+v", err)
+			writeErrorResponse(writer, http.StatusInternalServerError, fmt.Sprintf("Error getting relation member ways: %s", err.Error()), err)
+			return
+		}
+	}
+
+	err = index.WriteFeaturesAsGeoJson(features, tagIndex, outputOptions, writer)
+	if err != nil {
+		sigolo.Errorf("Error writing query result: %+v", err)
+		writeErrorResponse(writer, http.StatusInternalServerError, fmt.Sprintf("Error writing query result: %s", err.Error()), err)
+		return
+	}
+}
+
+// writeStatisticsResult executes a query aggregating values with "stats(key)" and writes the statistics of all
+// statements as JSON array. The error of the execution is returned, after it has been written as response.
+func writeStatisticsResult(writer http.ResponseWriter, currentIndex *loadedIndex, queryObj *query.Query) error {
+	_, err := queryObj.Execute(currentIndex.geometryIndex)
+	if err != nil {
+		writeExecutionErrorResponse(writer, err)
+		return err
+	}
+
+	responseBytes, err := json.Marshal(queryObj.GetStatistics(currentIndex.tagIndex))
+	if err != nil {
+		sigolo.Errorf("Error marshalling statistics: %+v", err)
+		writeErrorResponse(writer, http.StatusInternalServerError, "Error marshalling statistics.", nil)
+		return nil
+	}
+
+	_, err = writer.Write(responseBytes)
+	if err != nil {
+		sigolo.Errorf("Error writing statistics: %+v", err)
+	}
+	return nil
+}
+
+// writeIntrospectionResult lists the keys or values of a query like "keys()" or "values(highway)" and writes them as
+// JSON. The error of the execution is returned, after it has been written as response.
+func writeIntrospectionResult(writer http.ResponseWriter, currentIndex *loadedIndex, queryObj *query.Query) error {
+	result, err := queryObj.ExecuteIntrospection(currentIndex.tagIndex, currentIndex.geometryIndex)
+	if err != nil {
+		writeExecutionErrorResponse(writer, err)
+		return err
+	}
+
+	responseBytes, err := json.Marshal(result)
+	if err != nil {
+		sigolo.Errorf("Error marshalling introspection result: %+v", err)
+		writeErrorResponse(writer, http.StatusInternalServerError, "Error marshalling introspection result.", nil)
+		return nil
+	}
+
+	_, err = writer.Write(responseBytes)
+	if err != nil {
+		sigolo.Errorf("Error writing introspection result: %+v", err)
+	}
+	return nil
+}
+
+// streamQueryResult writes the features to the response while the query is still being executed, so that the result
+// isn't held in memory. Errors after the first written bytes can't be turned into an error response anymore, the response
+// is then incomplete and no valid GeoJSON. The number of written features and the error (if any) are returned.
+func streamQueryResult(writer http.ResponseWriter, currentIndex *loadedIndex, queryObj *query.Query, outputOptions index.OutputOptions) (int64, error) {
+	features, err := queryObj.Stream(currentIndex.geometryIndex, query.DefaultResultBufferSize)
+	if err != nil {
+		writeExecutionErrorResponse(writer, err)
+		return 0, err
+	}
+	defer features.Close()
+
+	iterator := &countingIterator{FeatureIterator: features}
+	if currentIndex.relationGeometryBuilder != nil {
+		iterator.FeatureIterator = &prioritizingIterator{FeatureIterator: features, builder: currentIndex.relationGeometryBuilder}
+	}
+
+	responseWriter := &trackingResponseWriter{writer: writer}
+	err = index.WriteFeatureIteratorAsGeoJson(iterator, currentIndex.tagIndex, outputOptions, responseWriter)
+	if err != nil && !responseWriter.hasWritten {
+		// The output is buffered, so errors occurring early (e.g. exceeded limits) can still be sent as error response.
+		writeExecutionErrorResponse(writer, err)
+	} else if err != nil {
+		sigolo.Errorf("Error writing query result: %+v", err)
+	}
+	return iterator.count, err
+}
+
+// trackingResponseWriter remembers whether any data has been written to the response.
+type trackingResponseWriter struct {
+	writer     io.Writer
+	hasWritten bool
+}
+
+func (w *trackingResponseWriter) Write(p []byte) (int, error) {
+	w.hasWritten = true
+	return w.writer.Write(p)
+}
+
+// prioritizingIterator passes all features to the relation geometry builder, so that the geometries of the relations
+// in the result are built next.
+type prioritizingIterator struct {
+	feature.FeatureIterator
+	builder *index.RelationGeometryBuilder
+}
+
+func (i *prioritizingIterator) Next() bool {
+	if !i.FeatureIterator.Next() {
+		return false
+	}
+	i.builder.Prioritize([]feature.Feature{i.Feature()})
+	return true
+}
+
+// countingIterator counts the features returned by the underlying iterator.
+type countingIterator struct {
+	feature.FeatureIterator
+	count int64
+}
+
+func (i *countingIterator) Next() bool {
+	if !i.FeatureIterator.Next() {
+		return false
+	}
+	i.count++
+	return true
+}
+
+// parseQueryString parses the query of the request. With the parameter "strict=true", keys and values not existing in
+// the index are errors instead of warnings.
+func parseQueryString(request *http.Request, queryString string, tagIndex *index.TagIndex, geometryIndex index.GeometryIndex) (*query.Query, error) {
+	if request.URL.Query().Get("strict") == "true" {
+		return parser.ParseQueryStringStrict(queryString, tagIndex, geometryIndex)
+	}
+	return parser.ParseQueryString(queryString, tagIndex, geometryIndex)
+}
+
+// getParsingErrorStatus returns the status of the response to a query that couldn't be parsed. Usually the query is
+// invalid, but a missing index is a problem of the server, which is hopefully solved after the running import.
+func getParsingErrorStatus(err error) int {
+	if errors.Is(err, index.ErrIndexMissing) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// writeExecutionErrorResponse writes the error of a failed query execution. Exceeded limits are a problem of the query
+// and not of the server, so they result in a response with status 422 and the information about the limit. Queries
+// whose context reached its deadline result in status 504, other cancelled queries and queries on a missing index in
+// status 503.
+func writeExecutionErrorResponse(writer http.ResponseWriter, err error) {
+	sigolo.Errorf("Error executing query: %+v", err)
+
+	var limitErr *query.LimitExceededError
+	if errors.As(err, &limitErr) {
+		response := NewErrorResponse(fmt.Sprintf("Query aborted: %s", limitErr.Error()), nil)
+		response.Limit = &LimitResponse{
+			Name:    limitErr.Limit,
+			Maximum: limitErr.Maximum,
+		}
+		writeErrorResponseObject(writer, http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	if errors.Is(err, query.ErrTimeout) {
+		writeErrorResponse(writer, http.StatusGatewayTimeout, fmt.Sprintf("Query aborted: %s", err.Error()), nil)
+		return
+	}
+
+	var cancelledErr *query.ExecutionCancelledError
+	if errors.As(err, &cancelledErr) {
+		writeErrorResponse(writer, http.StatusServiceUnavailable, fmt.Sprintf("Query aborted: %s", cancelledErr.Error()), nil)
+		return
+	}
+
+	if errors.Is(err, index.ErrIndexMissing) {
+		writeErrorResponse(writer, http.StatusServiceUnavailable, fmt.Sprintf("Error executing query: %s", err.Error()), err)
+		return
+	}
+
+	writeErrorResponse(writer, http.StatusInternalServerError, fmt.Sprintf("Error executing query: %s", err.Error()), err)
+}
+
+func writeErrorResponse(writer http.ResponseWriter, status int, message string, err error) {
+	writeErrorResponseObject(writer, status, NewErrorResponse(message, err))
+}
+
+func writeErrorResponseObject(writer http.ResponseWriter, status int, response ErrorResponse) {
+	writer.WriteHeader(status)
+
+	errorResponseBytes, err := json.Marshal(response)
+	if err != nil {
+		sigolo.Errorf("Error creating and marshalling error response object: %+v", err)
+	}
+
+	_, err = writer.Write(errorResponseBytes)
+	if err != nil {
+		sigolo.Errorf("Error writing error response: %+v", err)
+	}
+}
+
+// getPaginationParameters reads the "cursor" and "page_size" URL parameters. The cursor is nil when no cursor is given,
+// which means the first page is requested.
+func getPaginationParameters(request *http.Request) (*query.Cursor, int, error) {
+	var cursor *query.Cursor
+	var err error
+	pageSize := defaultPageSize
+
+	encodedCursor := request.URL.Query().Get("cursor")
+	if encodedCursor != "" {
+		cursor, err = query.DecodeCursor(encodedCursor)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	pageSizeString := request.URL.Query().Get("page_size")
+	if pageSizeString != "" {
+		pageSize, err = strconv.Atoi(pageSizeString)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "Invalid page size '%s'", pageSizeString)
+		}
+		if pageSize <= 0 {
+			return nil, 0, errors.Errorf("Invalid page size %d, it must be greater than 0", pageSize)
+		}
+	}
 
-	return r
+	return cursor, pageSize, nil
 }
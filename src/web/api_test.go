@@ -0,0 +1,88 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"soq/common"
+	"strings"
+	"testing"
+)
+
+const testQuery = "bbox(9.9,53.5,10.0,53.6).nodes{ amenity=bench }"
+
+func newTestRouter(t *testing.T, queriesFolder string, storeQueries bool) http.Handler {
+	options := ServerOptions{
+		IndexBaseFolder: newTestIndex(t),
+		CellSize:        testCellSize,
+		QueriesFolder:   queriesFolder,
+		StoreQueries:    storeQueries,
+	}
+	router, stop := initRouter(options, common.DefaultSettings())
+	t.Cleanup(stop)
+	return router
+}
+
+func sendTestRequest(router http.Handler, method string, url string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return recorder
+}
+
+func TestRouter_storeAndGetQuery(t *testing.T) {
+	// Arrange
+	queriesFolder := t.TempDir()
+	router := newTestRouter(t, queriesFolder, true)
+
+	// Act
+	storeResponse := sendTestRequest(router, http.MethodPut, "/api/queries/benches", testQuery)
+	getResponse := sendTestRequest(router, http.MethodGet, "/api/queries", "")
+	executeResponse := sendTestRequest(router, http.MethodPost, "/api/queries/benches", "")
+
+	// Assert
+	common.AssertEqual(t, http.StatusOK, storeResponse.Code)
+
+	common.AssertEqual(t, http.StatusOK, getResponse.Code)
+	var storedQueries []*StoredQuery
+	common.AssertNil(t, json.Unmarshal(getResponse.Body.Bytes(), &storedQueries))
+	common.AssertEqual(t, []*StoredQuery{{Name: "benches", Query: testQuery}}, storedQueries)
+
+	common.AssertEqual(t, http.StatusOK, executeResponse.Code)
+	common.AssertTrue(t, strings.Contains(executeResponse.Body.String(), `"FeatureCollection"`))
+
+	fileContent, err := os.ReadFile(path.Join(queriesFolder, "benches.soq"))
+	common.AssertNil(t, err)
+	common.AssertEqual(t, testQuery, string(fileContent))
+}
+
+func TestRouter_storeQuery_invalidName(t *testing.T) {
+	// Arrange
+	queriesFolder := t.TempDir()
+	router := newTestRouter(t, queriesFolder, true)
+
+	// Act
+	response := sendTestRequest(router, http.MethodPut, "/api/queries/my.benches", testQuery)
+
+	// Assert
+	common.AssertEqual(t, http.StatusBadRequest, response.Code)
+	entries, err := os.ReadDir(queriesFolder)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(entries))
+}
+
+func TestRouter_storeQuery_disabled(t *testing.T) {
+	// Arrange
+	queriesFolder := t.TempDir()
+	router := newTestRouter(t, queriesFolder, false)
+
+	// Act
+	response := sendTestRequest(router, http.MethodPut, "/api/queries/benches", testQuery)
+
+	// Assert
+	common.AssertEqual(t, http.StatusMethodNotAllowed, response.Code)
+	entries, err := os.ReadDir(queriesFolder)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(entries))
+}
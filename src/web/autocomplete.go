@@ -0,0 +1,102 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"net/http"
+	"soq/index"
+	"strconv"
+)
+
+const defaultAutocompleteLimit = 20
+const maxAutocompleteLimit = 1000
+
+type AutocompleteEntry struct {
+	Value string `json:"value"`
+	// Number of OSM objects with this key or tag. Always 0 when the index has no counts.
+	Count int `json:"count"`
+}
+
+// handleKeyAutocomplete answers requests like "/api/keys?q=ame" with all keys starting with the given prefix.
+func handleKeyAutocomplete(writer http.ResponseWriter, request *http.Request, indices *indexHolder) {
+	writer.Header().Set("Access-Control-Allow-Origin", "*")
+	writer.Header().Set("Content-Type", "application/json")
+
+	limit, err := getAutocompleteLimit(request)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	results := indices.get().tagIndex.SearchKeysByPrefix(request.URL.Query().Get("q"), limit)
+	writeAutocompleteResponse(writer, results)
+}
+
+// handleValueAutocomplete answers requests like "/api/values?key=amenity&q=rest" with all values of the key starting
+// with the given prefix.
+func handleValueAutocomplete(writer http.ResponseWriter, request *http.Request, indices *indexHolder) {
+	writer.Header().Set("Access-Control-Allow-Origin", "*")
+	writer.Header().Set("Content-Type", "application/json")
+
+	limit, err := getAutocompleteLimit(request)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	key := request.URL.Query().Get("key")
+	if key == "" {
+		writeErrorResponse(writer, http.StatusBadRequest, "Parameter 'key' is missing", nil)
+		return
+	}
+
+	results, err := indices.get().tagIndex.SearchValuesByPrefix(key, request.URL.Query().Get("q"), limit)
+	if errors.Is(err, index.ErrUnknownKey) {
+		writeErrorResponse(writer, http.StatusNotFound, err.Error(), nil)
+		return
+	} else if err != nil {
+		sigolo.Errorf("Error searching values of key '%s': %+v", key, err)
+		writeErrorResponse(writer, http.StatusInternalServerError, "Error searching values.", nil)
+		return
+	}
+
+	writeAutocompleteResponse(writer, results)
+}
+
+// getAutocompleteLimit reads the optional "limit" URL parameter.
+func getAutocompleteLimit(request *http.Request) (int, error) {
+	limitString := request.URL.Query().Get("limit")
+	if limitString == "" {
+		return defaultAutocompleteLimit, nil
+	}
+
+	limit, err := strconv.Atoi(limitString)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Invalid limit '%s'", limitString)
+	}
+	if limit <= 0 || limit > maxAutocompleteLimit {
+		return 0, errors.Errorf("Invalid limit %d, it must be between 1 and %d", limit, maxAutocompleteLimit)
+	}
+
+	return limit, nil
+}
+
+func writeAutocompleteResponse(writer http.ResponseWriter, results []index.PrefixSearchResult) {
+	entries := make([]AutocompleteEntry, len(results))
+	for i, result := range results {
+		entries[i] = AutocompleteEntry{Value: result.Value, Count: result.Count}
+	}
+
+	responseBytes, err := json.Marshal(entries)
+	if err != nil {
+		sigolo.Errorf("Error marshalling autocomplete response: %+v", err)
+		writeErrorResponse(writer, http.StatusInternalServerError, "Error marshalling autocomplete response.", nil)
+		return
+	}
+
+	_, err = writer.Write(responseBytes)
+	if err != nil {
+		sigolo.Errorf("Error writing autocomplete response: %+v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"path"
+	"soq/index"
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+
+	// Reason why the server isn't ready. Empty when the server is ready.
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleHealth answers as long as the process is able to handle requests, e.g. for liveness probes.
+func handleHealth(writer http.ResponseWriter) {
+	writeHealthResponse(writer, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// handleReadiness answers with 200 when queries can be executed and with 503 otherwise, e.g. for readiness probes and
+// load balancers.
+func handleReadiness(writer http.ResponseWriter, indices *indexHolder) {
+	err := indices.checkReadiness()
+	if err != nil {
+		sigolo.Debugf("Server not ready: %+v", err)
+		writeHealthResponse(writer, http.StatusServiceUnavailable, HealthResponse{Status: "not ready", Reason: err.Error()})
+		return
+	}
+
+	writeHealthResponse(writer, http.StatusOK, HealthResponse{Status: "ready"})
+}
+
+// checkReadiness returns an error when no index is loaded or the folder of the cells can't be read, e.g. because the
+// disk isn't accessible or an import removed the index.
+func (h *indexHolder) checkReadiness() error {
+	if h.get() == nil {
+		return errors.New("No index loaded")
+	}
+	if index.IsMountedPack(h.indexBaseFolder) {
+		// The files of packs can't be removed while they're mounted.
+		return nil
+	}
+
+	gridIndexFolder := path.Join(h.indexBaseFolder, index.GridIndexFolder)
+	_, err := os.ReadDir(gridIndexFolder)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read index folder %s", gridIndexFolder)
+	}
+
+	return nil
+}
+
+func writeHealthResponse(writer http.ResponseWriter, status int, response HealthResponse) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		sigolo.Errorf("Error marshalling health response: %+v", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.WriteHeader(status)
+	_, err = writer.Write(responseBytes)
+	if err != nil {
+		sigolo.Errorf("Error writing health response: %+v", err)
+	}
+}
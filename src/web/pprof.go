@@ -0,0 +1,17 @@
+package web
+
+import (
+	"github.com/gorilla/mux"
+	"net/http/pprof"
+)
+
+// registerPprofHandlers adds the endpoints of the Go profiler under /debug/pprof/, e.g. "/debug/pprof/heap" for an
+// allocation profile of the running server. They expose internals of the process and should not be publicly reachable.
+func registerPprofHandlers(r *mux.Router) {
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// The index handler serves the list of profiles as well as the named profiles like "heap" and "goroutine".
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
@@ -0,0 +1,212 @@
+package web
+
+import (
+	"fmt"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"soq/parser"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const storedQueryFileExtension = ".soq"
+
+// StoredQuery is a query from a file of the query library. The name is the filename without extension.
+type StoredQuery struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Names of the placeholders (e.g. "bbox" for "{{bbox}}"), which need a value when executing the query.
+	Parameters []string `json:"parameters,omitempty"`
+	// Validation error of the query, empty for valid queries. Invalid queries stay in the library to show their errors.
+	Error string `json:"error,omitempty"`
+}
+
+// queryLibrary holds the stored queries of a folder. The queries are validated against the current index, since
+// unknown keys and values are syntax errors as well.
+type queryLibrary struct {
+	folder string
+
+	mutex   sync.RWMutex
+	queries map[string]*StoredQuery
+
+	// Held while the queries are reloaded or stored, so that the folder isn't read and written at the same time.
+	updateMutex sync.Mutex
+
+	// State of the folder and index of the last load to detect changes.
+	loadedFileState string
+	loadedIndex     *loadedIndex
+}
+
+func newQueryLibrary(folder string) *queryLibrary {
+	return &queryLibrary{
+		folder:  folder,
+		queries: map[string]*StoredQuery{},
+	}
+}
+
+func (l *queryLibrary) get(name string) (*StoredQuery, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	storedQuery, ok := l.queries[name]
+	return storedQuery, ok
+}
+
+// getAll returns all stored queries sorted by name.
+func (l *queryLibrary) getAll() []*StoredQuery {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	result := make([]*StoredQuery, 0, len(l.queries))
+	for _, storedQuery := range l.queries {
+		result = append(result, storedQuery)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// reloadIfChanged reads and validates all stored queries again when a file of the folder changed or a new index has
+// been loaded. A missing folder results in an empty library.
+func (l *queryLibrary) reloadIfChanged(currentIndex *loadedIndex) (bool, error) {
+	l.updateMutex.Lock()
+	defer l.updateMutex.Unlock()
+
+	entries, err := os.ReadDir(l.folder)
+	if errors.Is(err, os.ErrNotExist) {
+		entries = nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "Unable to read query library folder %s", l.folder)
+	}
+
+	var queryFiles []os.DirEntry
+	fileState := strings.Builder{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), storedQueryFileExtension) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// The file might have been removed in the meantime, which is detected during the next check.
+			continue
+		}
+
+		queryFiles = append(queryFiles, entry)
+		fileState.WriteString(fmt.Sprintf("%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+
+	if fileState.String() == l.loadedFileState && currentIndex == l.loadedIndex {
+		return false, nil
+	}
+
+	queries := map[string]*StoredQuery{}
+	numberOfInvalidQueries := 0
+	for _, entry := range queryFiles {
+		queryBytes, err := os.ReadFile(path.Join(l.folder, entry.Name()))
+		if err != nil {
+			return false, errors.Wrapf(err, "Unable to read stored query file %s", entry.Name())
+		}
+
+		storedQuery := newStoredQuery(strings.TrimSuffix(entry.Name(), storedQueryFileExtension), string(queryBytes), currentIndex)
+		if storedQuery.Error != "" {
+			sigolo.Errorf("Stored query '%s' is invalid: %s", storedQuery.Name, storedQuery.Error)
+			numberOfInvalidQueries++
+		}
+
+		queries[storedQuery.Name] = storedQuery
+	}
+
+	l.mutex.Lock()
+	l.queries = queries
+	l.mutex.Unlock()
+
+	l.loadedFileState = fileState.String()
+	l.loadedIndex = currentIndex
+
+	sigolo.Infof("Loaded %d stored queries from %s (%d invalid)", len(queries), l.folder, numberOfInvalidQueries)
+	return true, nil
+}
+
+// store writes the query into the folder of the library and adds it to the library. Existing queries with the same name
+// are overwritten. Invalid queries are not stored.
+func (l *queryLibrary) store(name string, queryString string, currentIndex *loadedIndex) (*StoredQuery, error) {
+	if !isValidStoredQueryName(name) {
+		return nil, errors.Errorf("Invalid name '%s', only letters, digits, '_' and '-' are allowed", name)
+	}
+
+	storedQuery := newStoredQuery(name, queryString, currentIndex)
+	if storedQuery.Error != "" {
+		return nil, errors.Errorf("Invalid query: %s", storedQuery.Error)
+	}
+
+	l.updateMutex.Lock()
+	defer l.updateMutex.Unlock()
+
+	err := os.MkdirAll(l.folder, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to create query library folder %s", l.folder)
+	}
+
+	err = os.WriteFile(path.Join(l.folder, name+storedQueryFileExtension), []byte(queryString), 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to write stored query file for query '%s'", name)
+	}
+
+	l.mutex.Lock()
+	l.queries[name] = storedQuery
+	l.mutex.Unlock()
+
+	sigolo.Infof("Stored query '%s' with parameters %v", name, storedQuery.Parameters)
+	return storedQuery, nil
+}
+
+// newStoredQuery validates the query and returns the stored query with the validation error, if any. Queries with
+// placeholders can't be parsed without values, so only their placeholder syntax is validated here. Their remaining
+// errors are returned when the query is executed.
+func newStoredQuery(name string, queryString string, currentIndex *loadedIndex) *StoredQuery {
+	storedQuery := &StoredQuery{
+		Name:  name,
+		Query: queryString,
+	}
+
+	var err error
+	storedQuery.Parameters, err = parser.GetPlaceholders(queryString)
+	if err == nil && len(storedQuery.Parameters) == 0 {
+		_, err = parser.ParseQueryString(queryString, currentIndex.tagIndex, currentIndex.geometryIndex)
+	}
+	if err != nil {
+		storedQuery.Error = err.Error()
+	}
+
+	return storedQuery
+}
+
+func isValidStoredQueryName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, char := range name {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '_' || char == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// watch checks for changed stored queries in the given interval and reloads them. This function blocks and should be
+// called as goroutine.
+func (l *queryLibrary) watch(interval time.Duration, indices *indexHolder) {
+	for range time.Tick(interval) {
+		currentIndex := indices.acquire()
+		_, err := l.reloadIfChanged(currentIndex)
+		currentIndex.release()
+		if err != nil {
+			sigolo.Errorf("Error reloading stored queries, the old queries stay in use: %+v", err)
+		}
+	}
+}
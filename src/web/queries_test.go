@@ -0,0 +1,45 @@
+package web
+
+import (
+	"os"
+	"soq/common"
+	"testing"
+)
+
+func TestQueryLibrary_store_invalidNames(t *testing.T) {
+	// Arrange
+	holder := newTestIndexHolder(t)
+	currentIndex := holder.acquire()
+	defer currentIndex.release()
+	library := newQueryLibrary(t.TempDir())
+
+	for _, name := range []string{"", "../benches", "sub/benches", "benches.soq", "my benches", "bänke"} {
+		// Act
+		storedQuery, err := library.store(name, "bbox(9.9,53.5,10.0,53.6).nodes{ amenity=bench }", currentIndex)
+
+		// Assert
+		common.AssertNotNil(t, err)
+		common.AssertNil(t, storedQuery)
+	}
+	entries, err := os.ReadDir(library.folder)
+	common.AssertNil(t, err)
+	common.AssertEqual(t, 0, len(entries))
+	common.AssertEqual(t, 0, len(library.getAll()))
+}
+
+func TestQueryLibrary_store_invalidQuery(t *testing.T) {
+	// Arrange
+	holder := newTestIndexHolder(t)
+	currentIndex := holder.acquire()
+	defer currentIndex.release()
+	library := newQueryLibrary(t.TempDir())
+
+	// Act
+	storedQuery, err := library.store("benches", "bbox(9.9,53.5,10.0,53.6).nodes{ amenity=", currentIndex)
+
+	// Assert
+	common.AssertNotNil(t, err)
+	common.AssertNil(t, storedQuery)
+	_, ok := library.get("benches")
+	common.AssertFalse(t, ok)
+}
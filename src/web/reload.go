@@ -0,0 +1,227 @@
+package web
+
+import (
+	"github.com/hauke96/sigolo/v2"
+	"github.com/paulmach/orb"
+	"github.com/pkg/errors"
+	"soq/common"
+	"soq/index"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loadedIndex bundles the indices needed by a query, so that they can be swapped together when a new index is loaded.
+type loadedIndex struct {
+	tagIndex      *index.TagIndex
+	geometryIndex *index.GridIndexReader
+
+	// The holder and each request using this index hold one reference. The index is closed when the last one is
+	// released, s. acquire and release.
+	references atomic.Int64
+
+	// Builds the relation geometries of this index in the background. Nil when this is disabled.
+	relationGeometryBuilder     *index.RelationGeometryBuilder
+	stopRelationGeometryBuilder chan struct{}
+
+	// Preloads the cells of an area into the cell cache in the background. Nil when this is disabled.
+	cellPreloader     *index.CellPreloader
+	stopCellPreloader chan struct{}
+}
+
+func (l *loadedIndex) createdAt() time.Time {
+	return l.geometryIndex.GetMetadata().CreatedAt
+}
+
+// startRelationGeometryBuilder builds the relation geometries of this index in the background until all relations are
+// handled or the builder is stopped.
+func (l *loadedIndex) startRelationGeometryBuilder(delay time.Duration) {
+	l.relationGeometryBuilder = index.NewRelationGeometryBuilder(l.geometryIndex, delay)
+	l.stopRelationGeometryBuilder = make(chan struct{})
+
+	go func() {
+		err := l.relationGeometryBuilder.Run(l.stopRelationGeometryBuilder)
+		if err != nil {
+			sigolo.Errorf("Error building relation geometries: %+v", err)
+		}
+	}()
+}
+
+// startCellPreloader reads the cells within the given bbox into the cell cache in the background until all cells are
+// cached or the preloader is stopped.
+func (l *loadedIndex) startCellPreloader(bbox orb.Bound) {
+	l.cellPreloader = index.NewCellPreloader(l.geometryIndex, bbox)
+	l.stopCellPreloader = make(chan struct{})
+
+	go func() {
+		err := l.cellPreloader.Run(l.stopCellPreloader)
+		if err != nil {
+			sigolo.Errorf("Error preloading cells: %+v", err)
+		}
+	}()
+}
+
+// tryAcquire adds a reference to this index. False is returned when the index has already been closed.
+func (l *loadedIndex) tryAcquire() bool {
+	for {
+		references := l.references.Load()
+		if references <= 0 {
+			return false
+		}
+		if l.references.CompareAndSwap(references, references+1) {
+			return true
+		}
+	}
+}
+
+// release removes a reference from this index and closes it, when this was the last one.
+func (l *loadedIndex) release() {
+	if l.references.Add(-1) == 0 {
+		l.close()
+	}
+}
+
+// close stops the relation geometry builder and cell preloader of this index and closes the geometry index, which
+// releases its caches from the memory accountant and allows imports to remove its files.
+func (l *loadedIndex) close() {
+	l.geometryIndex.Close()
+	if l.relationGeometryBuilder != nil {
+		close(l.stopRelationGeometryBuilder)
+	}
+	if l.cellPreloader != nil {
+		close(l.stopCellPreloader)
+	}
+}
+
+// indexHolder holds the currently used index. Requests acquire the current index once at their beginning, so a reload
+// doesn't affect already running queries. The replaced index is closed once the last of these requests has released it.
+type indexHolder struct {
+	current     atomic.Pointer[loadedIndex]
+	reloadMutex sync.Mutex
+
+	indexBaseFolder         string
+	cellSize                float64
+	checkFeatureValidity    bool
+	buildRelationGeometries bool
+	relationGeometryDelay   time.Duration
+	preloadBbox             *orb.Bound // The cells within this bbox are preloaded after loading an index. Nil disables this.
+	settings                common.Settings
+}
+
+func newIndexHolder(indexBaseFolder string, cellSize float64, checkFeatureValidity bool, buildRelationGeometries bool, relationGeometryDelay time.Duration, preloadBbox *orb.Bound, settings common.Settings) (*indexHolder, error) {
+	holder := &indexHolder{
+		indexBaseFolder:         indexBaseFolder,
+		cellSize:                cellSize,
+		checkFeatureValidity:    checkFeatureValidity,
+		buildRelationGeometries: buildRelationGeometries,
+		relationGeometryDelay:   relationGeometryDelay,
+		preloadBbox:             preloadBbox,
+		settings:                settings,
+	}
+
+	err := holder.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return holder, nil
+}
+
+// get returns the current index without acquiring it. Use this only for data that stays valid after the index has been
+// closed, like the metadata or the tag-index.
+func (h *indexHolder) get() *loadedIndex {
+	return h.current.Load()
+}
+
+// acquire returns the current index and keeps it open until it's released. Each request reading the geometry index
+// must acquire it.
+func (h *indexHolder) acquire() *loadedIndex {
+	for {
+		// The loaded index might be replaced and closed before it's acquired, the new one is used then.
+		current := h.current.Load()
+		if current.tryAcquire() {
+			return current
+		}
+	}
+}
+
+// close releases the reference of the holder on the current index, e.g. when the server shuts down.
+func (h *indexHolder) close() {
+	h.current.Load().release()
+}
+
+// reload loads the index from disk and swaps it with the current one. The current index stays in use when loading
+// fails.
+func (h *indexHolder) reload() error {
+	h.reloadMutex.Lock()
+	defer h.reloadMutex.Unlock()
+
+	// The grid-index reads its cells lazily, so it must stay on the version of the tag-index even when an import
+	// activates a new version in the meantime.
+	indexFolder, err := index.ResolveIndexFolder(h.indexBaseFolder)
+	if err != nil {
+		return err
+	}
+
+	sigolo.Infof("Load index from %s", indexFolder)
+	loadStartTime := time.Now()
+
+	tagIndex, err := index.LoadTagIndex(indexFolder)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to load tag-index")
+	}
+
+	geometryIndex, err := index.LoadGridIndex(indexFolder, h.cellSize, h.cellSize, h.checkFeatureValidity, tagIndex, h.settings)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to load grid-index")
+	}
+
+	newIndex := &loadedIndex{
+		tagIndex:      tagIndex,
+		geometryIndex: geometryIndex,
+	}
+	newIndex.references.Store(1) // The reference of the holder
+	if h.buildRelationGeometries {
+		newIndex.startRelationGeometryBuilder(h.relationGeometryDelay)
+	}
+	if h.preloadBbox != nil {
+		newIndex.startCellPreloader(*h.preloadBbox)
+	}
+
+	oldIndex := h.current.Swap(newIndex)
+	if oldIndex != nil {
+		oldIndex.release()
+	}
+
+	sigolo.Infof("Loaded index created at %s in %s", geometryIndex.GetMetadata().CreatedAt.Format(time.RFC3339), time.Since(loadStartTime))
+	return nil
+}
+
+// reloadIfChanged reloads the index when the creation time in the metadata file differs from the current index. This
+// is the case when an import finished. During an import, the metadata file doesn't exist, which is no change.
+func (h *indexHolder) reloadIfChanged() (bool, error) {
+	metadata, err := index.LoadIndexMetadata(h.indexBaseFolder)
+	if err != nil {
+		// The metadata file might be written at this moment, so simply try again next time.
+		sigolo.Debugf("Unable to read index metadata: %+v", err)
+		return false, nil
+	}
+
+	if metadata.CreatedAt.IsZero() || metadata.CreatedAt.Equal(h.get().createdAt()) {
+		return false, nil
+	}
+
+	sigolo.Infof("Found new index created at %s", metadata.CreatedAt.Format(time.RFC3339))
+	return true, h.reload()
+}
+
+// watch checks for a new index in the given interval and loads it. This function blocks and should be called as
+// goroutine.
+func (h *indexHolder) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		_, err := h.reloadIfChanged()
+		if err != nil {
+			sigolo.Errorf("Error reloading index, the old index stays in use: %+v", err)
+		}
+	}
+}
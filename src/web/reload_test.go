@@ -0,0 +1,53 @@
+package web
+
+import (
+	"path"
+	"soq/common"
+	"soq/encoding"
+	"soq/importing"
+	"soq/index"
+	"testing"
+)
+
+const testCellSize = 0.1
+
+// newTestIndex imports the small test file and returns the index folder.
+func newTestIndex(t *testing.T) string {
+	indexBaseFolder := path.Join(t.TempDir(), "soq-index")
+	importOptions := importing.ImportOptions{
+		CellScheme:          &common.LatLonCellScheme{CellWidth: testCellSize, CellHeight: testCellSize},
+		CellSplitThreshold:  index.DefaultCellSplitThreshold,
+		CoordinatePrecision: encoding.CoordinatePrecisionFloat32,
+	}
+	err := importing.Import("../../test-small.osm", indexBaseFolder, importOptions, common.DefaultSettings())
+	common.AssertNil(t, err)
+	return indexBaseFolder
+}
+
+func newTestIndexHolder(t *testing.T) *indexHolder {
+	holder, err := newIndexHolder(newTestIndex(t), testCellSize, false, false, 0, nil, common.DefaultSettings())
+	common.AssertNil(t, err)
+	return holder
+}
+
+func TestIndexHolder_reloadKeepsAcquiredIndexOpen(t *testing.T) {
+	// Arrange
+	holder := newTestIndexHolder(t)
+	oldIndex := holder.acquire()
+
+	// Act
+	err := holder.reload()
+
+	// Assert
+	common.AssertNil(t, err)
+	newIndex := holder.acquire()
+	common.AssertTrue(t, oldIndex != newIndex)
+	common.AssertEqual(t, int64(1), oldIndex.references.Load())
+	common.AssertEqual(t, int64(2), newIndex.references.Load())
+
+	oldIndex.release()
+	newIndex.release()
+	common.AssertEqual(t, int64(0), oldIndex.references.Load())
+	common.AssertFalse(t, oldIndex.tryAcquire())
+	common.AssertEqual(t, int64(1), newIndex.references.Load())
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"context"
+	"github.com/hauke96/sigolo/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Time the cancelled queries get to stop after the grace period is over, before their connections are closed.
+const cancelledRequestsTimeout = 5 * time.Second
+
+// runServer serves the given handler until the process receives SIGTERM or SIGINT and then shuts the server down
+// gracefully: No new connections are accepted and running requests get the grace period to finish. Queries still
+// running afterward are cancelled. The stop function is called once all requests are done. The listen function starts
+// the given server and blocks, e.g. server.ListenAndServe.
+func runServer(port string, handler http.Handler, stop func(), gracePeriod time.Duration, listen func(server *http.Server) error) {
+	// Queries use the request context, so cancelling this base context cancels all running queries.
+	requestContext, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: handler,
+		BaseContext: func(net.Listener) context.Context {
+			return requestContext
+		},
+	}
+
+	signalContext, stopSignalNotification := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignalNotification()
+
+	listenErrors := make(chan error, 1)
+	go func() {
+		listenErrors <- listen(server)
+	}()
+
+	select {
+	case err := <-listenErrors:
+		sigolo.FatalCheck(err)
+		return
+	case <-signalContext.Done():
+	}
+	// A second signal terminates the process immediately
+	stopSignalNotification()
+
+	sigolo.Infof("Shut down server, running requests have %s to finish", gracePeriod)
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancelShutdown()
+	err := server.Shutdown(shutdownContext)
+	if err != nil {
+		sigolo.Infof("Grace period is over, cancel running queries")
+		cancelRequests()
+
+		cancelledRequestsContext, cancelCancelledRequests := context.WithTimeout(context.Background(), cancelledRequestsTimeout)
+		defer cancelCancelledRequests()
+		err = server.Shutdown(cancelledRequestsContext)
+		if err != nil {
+			sigolo.Errorf("Requests still running after cancelling them, close their connections: %+v", err)
+			server.Close()
+		}
+	}
+
+	stop()
+	sigolo.Infof("Server stopped")
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/hauke96/sigolo/v2"
+	"io"
+	"net/http"
+	"soq/parser"
+	"soq/query"
+)
+
+type ValidationResponse struct {
+	Valid      bool                     `json:"valid"`
+	Error      *ValidationError         `json:"error,omitempty"`
+	Statements []query.StatementSummary `json:"statements,omitempty"`
+	// Warnings of valid queries, e.g. about keys and values not existing in the index.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type ValidationError struct {
+	Message string `json:"message"`
+	// Position of the erroneous character or token in the query. Not set for errors without a known position.
+	Position *int `json:"position,omitempty"`
+	// Line and column (both starting at 1) of the position. Not set for errors without a known position.
+	Line   *int `json:"line,omitempty"`
+	Column *int `json:"column,omitempty"`
+}
+
+// handleValidation lexes and parses the query in the request body without executing it. Invalid queries are no error
+// of this request, therefore the status is 200 in both cases and the "valid" field tells whether the query is valid.
+func handleValidation(writer http.ResponseWriter, request *http.Request, indices *indexHolder) {
+	writer.Header().Set("Access-Control-Allow-Origin", "*")
+	writer.Header().Set("Content-Type", "application/json")
+
+	queryBytes, err := io.ReadAll(request.Body)
+	if err != nil {
+		sigolo.Errorf("Error reding HTTP body of request to '/api/validate': %+v", err)
+		writeErrorResponse(writer, http.StatusInternalServerError, "Error reading HTTP body.", nil)
+		return
+	}
+
+	currentIndex := indices.acquire()
+	defer currentIndex.release()
+	response := ValidationResponse{}
+
+	queryObj, err := parseQueryString(request, string(queryBytes), currentIndex.tagIndex, currentIndex.geometryIndex)
+	if err != nil {
+		response.Error = &ValidationError{Message: err.Error()}
+		if position, ok := parser.GetErrorPosition(err); ok {
+			response.Error.Position = &position
+		}
+		if line, column, ok := parser.GetErrorLineAndColumn(err); ok {
+			response.Error.Line = &line
+			response.Error.Column = &column
+		}
+	} else {
+		response.Valid = true
+		response.Statements = queryObj.Summarize(currentIndex.tagIndex)
+		response.Warnings = queryObj.GetWarnings()
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		sigolo.Errorf("Error marshalling validation response: %+v", err)
+		writeErrorResponse(writer, http.StatusInternalServerError, "Error marshalling validation response.", nil)
+		return
+	}
+
+	_, err = writer.Write(responseBytes)
+	if err != nil {
+		sigolo.Errorf("Error writing validation response: %+v", err)
+	}
+}